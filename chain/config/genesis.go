@@ -1,10 +1,12 @@
 package config
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"math/big"
 	"os"
+	"strings"
 
 	"quantum-blockchain/chain/types"
 )
@@ -14,6 +16,7 @@ type GenesisConfig struct {
 	Config     *ChainConfig               `json:"config"`
 	Difficulty string                     `json:"difficulty"`
 	GasLimit   string                     `json:"gasLimit"`
+	Timestamp  uint64                     `json:"timestamp,omitempty"` // Time of the genesis block, nodes sharing a chain need the same
 	Alloc      map[string]*GenesisAccount `json:"alloc"`
 	Validators []GenesisValidator         `json:"validators,omitempty"`
 }
@@ -42,8 +45,9 @@ type GenesisAccount struct {
 
 // GenesisValidator represents a genesis validator
 type GenesisValidator struct {
-	Address string `json:"address"`
-	Stake   string `json:"stake"`
+	Address   string `json:"address"`
+	Stake     string `json:"stake"`
+	PublicKey string `json:"publicKey,omitempty"` // Hex Dilithium key signing consensus messages
 }
 
 // LoadGenesisConfig loads the genesis configuration from a file
@@ -194,9 +198,21 @@ func (g *GenesisConfig) GetValidators() ([]ValidatorInfo, error) {
 			return nil, fmt.Errorf("invalid validator stake: %s", validator.Stake)
 		}
 
+		var publicKey []byte
+		if validator.PublicKey != "" {
+			publicKey, err = hex.DecodeString(strings.TrimPrefix(validator.PublicKey, "0x"))
+			if err != nil {
+				return nil, fmt.Errorf("invalid validator public key: %s", validator.PublicKey)
+			}
+			if types.PublicKeyToAddress(publicKey) != addr {
+				return nil, fmt.Errorf("public key of validator %s does not match its address", validator.Address)
+			}
+		}
+
 		validators[i] = ValidatorInfo{
-			Address: addr,
-			Stake:   stake,
+			Address:   addr,
+			Stake:     stake,
+			PublicKey: publicKey,
 		}
 	}
 
@@ -205,8 +221,9 @@ func (g *GenesisConfig) GetValidators() ([]ValidatorInfo, error) {
 
 // ValidatorInfo represents validator information with proper types
 type ValidatorInfo struct {
-	Address types.Address
-	Stake   *big.Int
+	Address   types.Address
+	Stake     *big.Int
+	PublicKey []byte // Absent for validators registering their key later
 }
 
 // DefaultGenesisConfig returns a default genesis configuration
@@ -0,0 +1,88 @@
+package consensus
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/types"
+)
+
+// CommitSigs returns the commit votes known for a block in the round it was
+// proposed in, ordered by validator, for the next block to include
+func (mvc *MultiValidatorConsensus) CommitSigs(blockHeight, round uint64, blockHash types.Hash) []*types.CommitSig {
+	mvc.mu.RLock()
+	defer mvc.mu.RUnlock()
+
+	commit := make([]*types.CommitSig, 0, len(mvc.consensusMessages[blockHeight]))
+	for key, vote := range mvc.consensusMessages[blockHeight] {
+		if key.Round != round || vote.BlockHash != blockHash || vote.VoteType != VoteCommit {
+			continue
+		}
+		commit = append(commit, &types.CommitSig{
+			Validator: vote.Validator,
+			Round:     vote.Round,
+			Timestamp: vote.Timestamp.Unix(),
+			Signature: vote.Signature,
+		})
+	}
+	sort.Slice(commit, func(i, j int) bool {
+		return bytes.Compare(commit[i].Validator.Bytes(), commit[j].Validator.Bytes()) < 0
+	})
+	return commit
+}
+
+// VerifyCommit checks that the commit votes a block includes for its parent
+// are ordered by validator and signed by the registered keys of their
+// validators, and returns the validators that signed. Validators jailed
+// since are still counted for the votes they cast before.
+func (mvc *MultiValidatorConsensus) VerifyCommit(blockHeight uint64, blockHash types.Hash, commit []*types.CommitSig) ([]types.Address, error) {
+	signers := make([]types.Address, 0, len(commit))
+	for i, sig := range commit {
+		if sig == nil {
+			return nil, fmt.Errorf("%w: empty commit vote", ErrInvalidVote)
+		}
+		if i > 0 && bytes.Compare(commit[i-1].Validator.Bytes(), sig.Validator.Bytes()) >= 0 {
+			return nil, fmt.Errorf("%w: commit votes not ordered by validator", ErrInvalidVote)
+		}
+
+		mvc.mu.RLock()
+		validator := mvc.validators[sig.Validator]
+		var publicKey []byte
+		var algorithm crypto.SignatureAlgorithm
+		if validator != nil {
+			publicKey, algorithm = validator.PublicKey, validator.SigAlgorithm
+		}
+		mvc.mu.RUnlock()
+		if validator == nil {
+			return nil, fmt.Errorf("%w: commit vote of unknown validator %s", ErrInvalidVote, sig.Validator.Hex())
+		}
+
+		if !verifyCommitSig(sig, blockHeight, blockHash, publicKey, algorithm) {
+			return nil, fmt.Errorf("%w: bad commit vote signature of validator %s", ErrInvalidVote, sig.Validator.Hex())
+		}
+		signers = append(signers, sig.Validator)
+	}
+	return signers, nil
+}
+
+// verifyCommitSig checks the signature of a commit vote for a block with the
+// key of its validator
+func verifyCommitSig(sig *types.CommitSig, blockHeight uint64, blockHash types.Hash, publicKey []byte, algorithm crypto.SignatureAlgorithm) bool {
+	vote := &ConsensusVote{
+		Validator:   sig.Validator,
+		BlockHash:   blockHash,
+		BlockHeight: blockHeight,
+		Round:       sig.Round,
+		VoteType:    VoteCommit,
+		Timestamp:   time.Unix(sig.Timestamp, 0),
+	}
+	valid, err := crypto.VerifySignature(vote.SigningData(), &crypto.QRSignature{
+		Algorithm: algorithm,
+		Signature: sig.Signature,
+		PublicKey: publicKey,
+	})
+	return err == nil && valid
+}
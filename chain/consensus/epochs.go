@@ -0,0 +1,240 @@
+package consensus
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/types"
+)
+
+// ErrNoQuorum is returned for commit votes cast by less than a quorum of the
+// voting power of a validator set
+var ErrNoQuorum = errors.New("commit without quorum")
+
+// EpochValidator is a member of the validator set of an epoch, with the key
+// it votes with and its voting power fixed for the epoch
+type EpochValidator struct {
+	Address      types.Address             `json:"address"`
+	PublicKey    []byte                    `json:"publicKey"`
+	SigAlgorithm crypto.SignatureAlgorithm `json:"sigAlgorithm"`
+	VotingPower  *big.Int                  `json:"votingPower"`
+}
+
+// EpochValidatorSet is the validator set proposing and voting for the blocks
+// of an epoch, the first block of the epoch commits to its hash
+type EpochValidatorSet struct {
+	Epoch      uint64            `json:"epoch"`
+	FirstBlock uint64            `json:"firstBlock"`
+	Validators []*EpochValidator `json:"validators"`
+}
+
+// Hash returns the hash of the validators of the set in their order
+func (s *EpochValidatorSet) Hash() types.Hash {
+	data := []byte{}
+	for _, validator := range s.Validators {
+		data = append(data, validator.Address.Bytes()...)
+		data = append(data, types.Keccak256(validator.PublicKey)...)
+		data = append(data, byte(validator.SigAlgorithm))
+		data = append(data, types.BytesToHash(validator.VotingPower.Bytes()).Bytes()...)
+	}
+	return types.BytesToHash(types.Keccak256(data))
+}
+
+// TotalVotingPower returns the voting power of the set
+func (s *EpochValidatorSet) TotalVotingPower() *big.Int {
+	total := big.NewInt(0)
+	for _, validator := range s.Validators {
+		total.Add(total, validator.VotingPower)
+	}
+	return total
+}
+
+// Member returns the member of the set with an address, nil if there is none
+func (s *EpochValidatorSet) Member(address types.Address) *EpochValidator {
+	for _, validator := range s.Validators {
+		if validator.Address == address {
+			return validator
+		}
+	}
+	return nil
+}
+
+// SignedPower verifies the commit votes for a block and returns the voting
+// power of the members of the set that cast them. Votes of validators outside
+// the set are skipped, a vote of a member with a bad signature fails.
+func (s *EpochValidatorSet) SignedPower(blockHeight uint64, blockHash types.Hash, commit []*types.CommitSig) (*big.Int, error) {
+	power := big.NewInt(0)
+	for i, sig := range commit {
+		if sig == nil {
+			return nil, fmt.Errorf("%w: empty commit vote", ErrInvalidVote)
+		}
+		if i > 0 && bytes.Compare(commit[i-1].Validator.Bytes(), sig.Validator.Bytes()) >= 0 {
+			return nil, fmt.Errorf("%w: commit votes not ordered by validator", ErrInvalidVote)
+		}
+
+		validator := s.Member(sig.Validator)
+		if validator == nil {
+			continue
+		}
+		if !verifyCommitSig(sig, blockHeight, blockHash, validator.PublicKey, validator.SigAlgorithm) {
+			return nil, fmt.Errorf("%w: bad commit vote signature of validator %s", ErrInvalidVote, sig.Validator.Hex())
+		}
+		power.Add(power, validator.VotingPower)
+	}
+	return power, nil
+}
+
+// VerifyCommit checks that members of the set holding a quorum of its voting
+// power signed the commit votes for a block
+func (s *EpochValidatorSet) VerifyCommit(blockHeight uint64, blockHash types.Hash, commit []*types.CommitSig) error {
+	power, err := s.SignedPower(blockHeight, blockHash, commit)
+	if err != nil {
+		return err
+	}
+	if required := quorumPower(s.TotalVotingPower()); power.Sign() == 0 || power.Cmp(required) < 0 {
+		return fmt.Errorf("%w: commit of block #%d signed by %s of the voting power, %s required",
+			ErrNoQuorum, blockHeight, power, required)
+	}
+	return nil
+}
+
+// EpochBlocks returns the number of blocks of an epoch
+func (mvc *MultiValidatorConsensus) EpochBlocks() uint64 {
+	mvc.mu.RLock()
+	defer mvc.mu.RUnlock()
+
+	return mvc.epochBlocks
+}
+
+// SetEpochBlocks sets the number of blocks of an epoch, before the chain
+// starts
+func (mvc *MultiValidatorConsensus) SetEpochBlocks(blocks uint64) error {
+	if blocks == 0 {
+		return errors.New("epoch must have at least one block")
+	}
+
+	mvc.mu.Lock()
+	defer mvc.mu.Unlock()
+
+	mvc.epochBlocks = blocks
+	return nil
+}
+
+// EpochOf returns the epoch of a block. Epoch e starts with block
+// e*epochBlocks, epoch 0 with the genesis block.
+func (mvc *MultiValidatorConsensus) EpochOf(blockNumber uint64) uint64 {
+	mvc.mu.RLock()
+	defer mvc.mu.RUnlock()
+
+	return blockNumber / mvc.epochBlocks
+}
+
+// CurrentEpoch returns the epoch whose validator set is active
+func (mvc *MultiValidatorConsensus) CurrentEpoch() uint64 {
+	mvc.mu.RLock()
+	defer mvc.mu.RUnlock()
+
+	return mvc.currentEpoch
+}
+
+// StartEpochs fixes the validators registered so far as the set of the epoch
+// of the head. Until then the set follows every change, from then on changes
+// to the validators wait for the next epoch.
+func (mvc *MultiValidatorConsensus) StartEpochs(head uint64) *EpochValidatorSet {
+	mvc.mu.Lock()
+	defer mvc.mu.Unlock()
+
+	mvc.epochsStarted = true
+	mvc.currentEpoch = head / mvc.epochBlocks
+	mvc.updateValidatorSet()
+	return mvc.recordEpochSet()
+}
+
+// BeginEpoch applies the changes to the validators queued during the epoch
+// before and returns the validator set of the new epoch. The node calls it
+// once the last block of the epoch before is committed, so every node
+// changes the set at the same block. A set left without validators keeps
+// the validators of the epoch before.
+func (mvc *MultiValidatorConsensus) BeginEpoch(epoch uint64) (*EpochValidatorSet, error) {
+	mvc.mu.Lock()
+	defer mvc.mu.Unlock()
+
+	if epoch <= mvc.currentEpoch {
+		return nil, fmt.Errorf("epoch %d already began, current epoch %d", epoch, mvc.currentEpoch)
+	}
+
+	previous := mvc.validatorList
+	mvc.updateValidatorSet()
+	if len(mvc.validatorList) == 0 {
+		mvc.validatorList = previous
+	}
+	mvc.currentEpoch = epoch
+	return mvc.recordEpochSet(), nil
+}
+
+// GetEpochValidatorSet returns the validator set of an epoch, if this node
+// began it
+func (mvc *MultiValidatorConsensus) GetEpochValidatorSet(epoch uint64) (*EpochValidatorSet, bool) {
+	mvc.mu.RLock()
+	defer mvc.mu.RUnlock()
+
+	set, ok := mvc.epochSets[epoch]
+	return set, ok
+}
+
+// queueValidatorSetUpdate applies a change to the validators to the set
+// right away before the epochs start and at the next epoch after, the
+// caller holds the lock
+func (mvc *MultiValidatorConsensus) queueValidatorSetUpdate() {
+	if !mvc.epochsStarted {
+		mvc.updateValidatorSet()
+	}
+}
+
+// recordEpochSet remembers the active set as the set of the current epoch,
+// the caller holds the lock
+func (mvc *MultiValidatorConsensus) recordEpochSet() *EpochValidatorSet {
+	set := &EpochValidatorSet{
+		Epoch:      mvc.currentEpoch,
+		FirstBlock: mvc.currentEpoch * mvc.epochBlocks,
+		Validators: make([]*EpochValidator, 0, len(mvc.validatorList)),
+	}
+	for _, validator := range mvc.validatorList {
+		set.Validators = append(set.Validators, &EpochValidator{
+			Address:      validator.Address,
+			PublicKey:    validator.PublicKey,
+			SigAlgorithm: validator.SigAlgorithm,
+			VotingPower:  new(big.Int).Set(validator.VotingPower),
+		})
+	}
+	mvc.epochSets[mvc.currentEpoch] = set
+	return set
+}
+
+// inValidatorSet returns the member of the active set with an address, the
+// caller holds the lock
+func (mvc *MultiValidatorConsensus) inValidatorSet(address types.Address) *ValidatorState {
+	for _, validator := range mvc.validatorList {
+		if validator.Address == address {
+			return validator
+		}
+	}
+	return nil
+}
+
+// snapshot copies the state of a validator, which the set keeps for the epoch
+func (v *ValidatorState) snapshot() *ValidatorState {
+	copied := *v
+	copied.SelfStake = new(big.Int).Set(v.SelfStake)
+	copied.DelegatedStake = new(big.Int).Set(v.DelegatedStake)
+	copied.TotalStake = new(big.Int).Set(v.TotalStake)
+	copied.VotingPower = new(big.Int).Set(v.VotingPower)
+	if v.Performance != nil {
+		performance := *v.Performance
+		copied.Performance = &performance
+	}
+	return &copied
+}
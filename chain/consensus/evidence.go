@@ -0,0 +1,254 @@
+package consensus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/types"
+)
+
+// EvidenceType is the misbehavior a piece of evidence proves
+type EvidenceType uint8
+
+const (
+	EvidenceDuplicateVote     EvidenceType = iota // Votes for two blocks in one round at one height
+	EvidenceDuplicateProposal                     // Two blocks signed in one round at one height
+)
+
+var (
+	// ErrConflictingVote is returned for a vote of a validator that voted
+	// for another block at the same height
+	ErrConflictingVote = errors.New("conflicting consensus vote")
+
+	// ErrInvalidEvidence is returned for evidence that does not prove a
+	// validator signed two conflicting blocks or votes
+	ErrInvalidEvidence = errors.New("invalid evidence")
+)
+
+// Evidence proves that a validator signed two different blocks, or voted for
+// two different blocks, at the same height. Either pair is ordered by block
+// hash, so both orders of the conflict give the same evidence.
+type Evidence struct {
+	Type      EvidenceType         `json:"type"`
+	Validator types.Address        `json:"validator"`
+	Height    uint64               `json:"height"`
+	Votes     []*ConsensusVote     `json:"votes,omitempty"`
+	Headers   []*types.BlockHeader `json:"headers,omitempty"`
+}
+
+// NewDuplicateVoteEvidence creates the evidence of two conflicting votes
+func NewDuplicateVoteEvidence(a, b *ConsensusVote) *Evidence {
+	if bytes.Compare(a.BlockHash.Bytes(), b.BlockHash.Bytes()) > 0 {
+		a, b = b, a
+	}
+	return &Evidence{
+		Type:      EvidenceDuplicateVote,
+		Validator: a.Validator,
+		Height:    a.BlockHeight,
+		Votes:     []*ConsensusVote{a, b},
+	}
+}
+
+// NewDuplicateProposalEvidence creates the evidence of two conflicting
+// signed block headers
+func NewDuplicateProposalEvidence(a, b *types.BlockHeader) *Evidence {
+	if bytes.Compare(a.Hash().Bytes(), b.Hash().Bytes()) > 0 {
+		a, b = b, a
+	}
+	return &Evidence{
+		Type:      EvidenceDuplicateProposal,
+		Validator: a.ValidatorAddr,
+		Height:    a.Number.Uint64(),
+		Headers:   []*types.BlockHeader{a, b},
+	}
+}
+
+// ID identifies the offence, a validator is punished once per height
+// whatever evidence proves it
+func (ev *Evidence) ID() types.Hash {
+	data := make([]byte, 0, types.AddressLength+8)
+	data = append(data, ev.Validator.Bytes()...)
+	data = binary.BigEndian.AppendUint64(data, ev.Height)
+	return types.Keccak256Hash(data)
+}
+
+// Encode encodes the evidence for inclusion in a block
+func (ev *Evidence) Encode() ([]byte, error) {
+	return json.Marshal(ev)
+}
+
+// DecodeEvidence decodes evidence included in a block
+func DecodeEvidence(data []byte) (*Evidence, error) {
+	var ev Evidence
+	if err := json.Unmarshal(data, &ev); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEvidence, err)
+	}
+	return &ev, nil
+}
+
+// VerifyEvidence checks that evidence proves a registered validator signed
+// two conflicting blocks or votes with its registered key. Jailed validators
+// are still accountable for what they signed before.
+func (mvc *MultiValidatorConsensus) VerifyEvidence(ev *Evidence) error {
+	mvc.mu.RLock()
+	validator := mvc.validators[ev.Validator]
+	var registeredKey []byte
+	if validator != nil {
+		registeredKey = validator.PublicKey
+	}
+	mvc.mu.RUnlock()
+
+	if validator == nil {
+		return fmt.Errorf("%w: unknown validator %s", ErrInvalidEvidence, ev.Validator.Hex())
+	}
+
+	switch ev.Type {
+	case EvidenceDuplicateVote:
+		if len(ev.Votes) != 2 || len(ev.Headers) != 0 {
+			return fmt.Errorf("%w: duplicate vote evidence needs two votes", ErrInvalidEvidence)
+		}
+		a, b := ev.Votes[0], ev.Votes[1]
+		if a == nil || b == nil || a.VoteType != b.VoteType || a.Round != b.Round || a.BlockHash == b.BlockHash {
+			return fmt.Errorf("%w: votes do not conflict", ErrInvalidEvidence)
+		}
+		for _, vote := range ev.Votes {
+			if vote.Validator != ev.Validator || vote.BlockHeight != ev.Height {
+				return fmt.Errorf("%w: vote of %s at height %d", ErrInvalidEvidence, vote.Validator.Hex(), vote.BlockHeight)
+			}
+			if !bytes.Equal(vote.PublicKey, registeredKey) {
+				return fmt.Errorf("%w: vote not signed by the key of validator %s", ErrInvalidEvidence, ev.Validator.Hex())
+			}
+			valid, err := crypto.VerifySignature(vote.SigningData(), &crypto.QRSignature{
+				Algorithm: vote.SigAlgorithm,
+				Signature: vote.Signature,
+				PublicKey: vote.PublicKey,
+			})
+			if err != nil || !valid {
+				return fmt.Errorf("%w: bad vote signature of validator %s", ErrInvalidEvidence, ev.Validator.Hex())
+			}
+		}
+
+	case EvidenceDuplicateProposal:
+		if len(ev.Headers) != 2 || len(ev.Votes) != 0 {
+			return fmt.Errorf("%w: duplicate proposal evidence needs two headers", ErrInvalidEvidence)
+		}
+		// The headers come from peers, check the fields they hash first
+		for _, header := range ev.Headers {
+			if header == nil {
+				return fmt.Errorf("%w: missing header", ErrInvalidEvidence)
+			}
+			if err := header.ValidateFields(); err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidEvidence, err)
+			}
+		}
+		a, b := ev.Headers[0], ev.Headers[1]
+		if a.Hash() == b.Hash() || a.Round != b.Round {
+			return fmt.Errorf("%w: headers do not conflict", ErrInvalidEvidence)
+		}
+		for _, header := range ev.Headers {
+			if header.ValidatorAddr != ev.Validator || !header.Number.IsUint64() || header.Number.Uint64() != ev.Height {
+				return fmt.Errorf("%w: header of %s at height %s", ErrInvalidEvidence, header.ValidatorAddr.Hex(), header.Number)
+			}
+			if header.ValidatorSig == nil || !bytes.Equal(header.ValidatorSig.PublicKey, registeredKey) {
+				return fmt.Errorf("%w: header not signed by the key of validator %s", ErrInvalidEvidence, ev.Validator.Hex())
+			}
+			if valid, err := header.VerifyValidatorSignature(); err != nil || !valid {
+				return fmt.Errorf("%w: bad header signature of validator %s", ErrInvalidEvidence, ev.Validator.Hex())
+			}
+		}
+
+	default:
+		return fmt.Errorf("%w: unknown type %d", ErrInvalidEvidence, ev.Type)
+	}
+	return nil
+}
+
+// EvidencePool holds verified evidence until a block includes it, and
+// remembers the offences blocks included so each is punished once
+type EvidencePool struct {
+	consensus *MultiValidatorConsensus
+
+	mu        sync.Mutex
+	pending   map[types.Hash]*Evidence
+	committed map[types.Hash]bool
+}
+
+// NewEvidencePool creates an evidence pool verifying evidence against the
+// validators of the consensus engine
+func NewEvidencePool(consensus *MultiValidatorConsensus) *EvidencePool {
+	return &EvidencePool{
+		consensus: consensus,
+		pending:   make(map[types.Hash]*Evidence),
+		committed: make(map[types.Hash]bool),
+	}
+}
+
+// Add verifies evidence and keeps it until a block includes it. It reports
+// whether the offence is new, evidence of an offence pending or committed
+// already is ignored.
+func (p *EvidencePool) Add(ev *Evidence) (bool, error) {
+	id := ev.ID()
+	p.mu.Lock()
+	known := p.pending[id] != nil || p.committed[id]
+	p.mu.Unlock()
+	if known {
+		return false, nil
+	}
+
+	if err := p.consensus.VerifyEvidence(ev); err != nil {
+		return false, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pending[id] != nil || p.committed[id] {
+		return false, nil
+	}
+	p.pending[id] = ev
+	return true, nil
+}
+
+// Pending returns up to limit pending evidence ordered by height and
+// validator
+func (p *EvidencePool) Pending(limit int) []*Evidence {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	evidence := make([]*Evidence, 0, len(p.pending))
+	for _, ev := range p.pending {
+		evidence = append(evidence, ev)
+	}
+	sort.Slice(evidence, func(i, j int) bool {
+		if evidence[i].Height != evidence[j].Height {
+			return evidence[i].Height < evidence[j].Height
+		}
+		return bytes.Compare(evidence[i].Validator.Bytes(), evidence[j].Validator.Bytes()) < 0
+	})
+	if len(evidence) > limit {
+		evidence = evidence[:limit]
+	}
+	return evidence
+}
+
+// IsCommitted reports whether a block included evidence of the offence
+func (p *EvidencePool) IsCommitted(id types.Hash) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.committed[id]
+}
+
+// MarkCommitted records that a block included evidence of the offence
+func (p *EvidencePool) MarkCommitted(id types.Hash) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.pending, id)
+	p.committed[id] = true
+}
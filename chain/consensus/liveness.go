@@ -0,0 +1,187 @@
+package consensus
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+
+	"quantum-blockchain/chain/types"
+)
+
+// Liveness defaults: a validator signing fewer than half of the last 100
+// committed blocks is jailed for 10 minutes
+const (
+	DefaultSignedBlocksWindow   = 100
+	DefaultMinSignedRatio       = 0.5
+	DefaultDowntimeJailDuration = 10 * time.Minute
+)
+
+// signingWindow remembers which of the last blocks a validator failed to sign
+type signingWindow struct {
+	missed  []bool // Ring of the window, indexed by the counted blocks
+	counted uint64 // Blocks counted since the validator joined the set
+	misses  uint64 // Missed blocks in the window
+}
+
+func newSigningWindow(size uint64) *signingWindow {
+	return &signingWindow{missed: make([]bool, size)}
+}
+
+// record counts a block, forgetting the block that drops out of the window
+func (w *signingWindow) record(signed bool) {
+	i := w.counted % uint64(len(w.missed))
+	if w.missed[i] {
+		w.misses--
+	}
+	w.missed[i] = !signed
+	if !signed {
+		w.misses++
+	}
+	w.counted++
+}
+
+// filled returns the number of blocks in the window
+func (w *signingWindow) filled() uint64 {
+	if size := uint64(len(w.missed)); w.counted > size {
+		return size
+	}
+	return w.counted
+}
+
+// SetLivenessParams sets the number of blocks the signing of validators is
+// tracked over, the share of them a validator must sign and how long a
+// validator falling below it is jailed
+func (mvc *MultiValidatorConsensus) SetLivenessParams(window uint64, minSignedRatio float64, downtimeJail time.Duration) error {
+	if window == 0 || minSignedRatio < 0 || minSignedRatio > 1 {
+		return fmt.Errorf("invalid liveness params: window %d, min signed ratio %.2f", window, minSignedRatio)
+	}
+
+	mvc.mu.Lock()
+	defer mvc.mu.Unlock()
+
+	mvc.signedBlocksWindow = window
+	mvc.minSignedBlocks = uint64(math.Ceil(float64(window) * minSignedRatio))
+	mvc.downtimeJailDuration = downtimeJail
+	mvc.signingWindows = make(map[types.Address]*signingWindow)
+	return nil
+}
+
+// RecordCommit counts a committed block in the signing window of every
+// active validator, given the validators whose commit votes for it a later
+// block included. Blocks without the votes of a quorum are not counted, as
+// their proposer did not see the commit. Validators signing too few blocks
+// of a full window are slashed by the penalty and jailed from the given
+// time; the amounts slashed are returned. Jailed validators leave the set at
+// the next epoch and are not counted until then.
+func (mvc *MultiValidatorConsensus) RecordCommit(
+	signers []types.Address,
+	penalty func(stake *big.Int) *big.Int,
+	at time.Time,
+) map[types.Address]*big.Int {
+	mvc.mu.Lock()
+	defer mvc.mu.Unlock()
+
+	signed := make(map[types.Address]bool, len(signers))
+	for _, signer := range signers {
+		signed[signer] = true
+	}
+
+	activeValidators := mvc.getActiveValidators()
+	totalVotingPower := big.NewInt(0)
+	signedVotingPower := big.NewInt(0)
+	for _, validator := range activeValidators {
+		totalVotingPower.Add(totalVotingPower, validator.VotingPower)
+		if signed[validator.Address] {
+			signedVotingPower.Add(signedVotingPower, validator.VotingPower)
+		}
+	}
+	if totalVotingPower.Sign() == 0 || signedVotingPower.Cmp(quorumPower(totalVotingPower)) < 0 {
+		return nil
+	}
+
+	var slashed map[types.Address]*big.Int
+	for _, member := range activeValidators {
+		validator := mvc.validators[member.Address]
+		if validator == nil || validator.Status != StatusActive {
+			continue
+		}
+		window := mvc.signingWindows[validator.Address]
+		if window == nil {
+			window = newSigningWindow(mvc.signedBlocksWindow)
+			mvc.signingWindows[validator.Address] = window
+		}
+		window.record(signed[validator.Address])
+
+		if !signed[validator.Address] {
+			validator.Performance.BlocksMissed++
+			validator.Performance.AttestationsMissed++
+		}
+		validator.Performance.UptimeScore = 1.0 - float64(window.misses)/float64(window.filled())
+
+		if window.counted < mvc.signedBlocksWindow || window.misses <= mvc.signedBlocksWindow-mvc.minSignedBlocks {
+			continue
+		}
+
+		// Jailed for downtime, the window starts over once it is back
+		amount := mvc.slash(validator, penalty(new(big.Int).Set(validator.TotalStake)), "downtime")
+		validator.Status = StatusJailed
+		validator.JailedUntil = at.Add(mvc.downtimeJailDuration)
+		delete(mvc.signingWindows, validator.Address)
+		if mvc.onJail != nil {
+			mvc.onJail(validator.Address, mvc.downtimeJailDuration)
+		}
+		if slashed == nil {
+			slashed = make(map[types.Address]*big.Int)
+		}
+		slashed[validator.Address] = amount
+	}
+
+	if slashed != nil {
+		mvc.queueValidatorSetUpdate()
+	}
+	return slashed
+}
+
+// Unjail returns a jailed validator to the active set once its jail term is
+// over at the given time. Committed blocks unjail with their own time, so
+// every node changes the validator set alike.
+func (mvc *MultiValidatorConsensus) Unjail(validator types.Address, at time.Time) error {
+	mvc.mu.Lock()
+	defer mvc.mu.Unlock()
+
+	validatorState, exists := mvc.validators[validator]
+	if !exists {
+		return errors.New("validator not found")
+	}
+	if validatorState.Status != StatusJailed {
+		return fmt.Errorf("validator %s is not jailed", validator.Hex())
+	}
+	if at.Before(validatorState.JailedUntil) {
+		return fmt.Errorf("validator %s is jailed until %s", validator.Hex(), validatorState.JailedUntil.Format(time.RFC3339))
+	}
+	if validatorState.TotalStake.Cmp(mvc.minStake) < 0 {
+		return fmt.Errorf("validator %s has stake %s below the minimum %s", validator.Hex(), validatorState.TotalStake, mvc.minStake)
+	}
+
+	validatorState.Status = StatusActive
+	validatorState.JailedUntil = time.Time{}
+	delete(mvc.signingWindows, validator)
+
+	mvc.queueValidatorSetUpdate()
+	return nil
+}
+
+// SigningInfo returns the blocks a validator missed in its signing window and
+// the number of blocks the window holds so far
+func (mvc *MultiValidatorConsensus) SigningInfo(validator types.Address) (missed uint64, counted uint64) {
+	mvc.mu.RLock()
+	defer mvc.mu.RUnlock()
+
+	window := mvc.signingWindows[validator]
+	if window == nil {
+		return 0, 0
+	}
+	return window.misses, window.filled()
+}
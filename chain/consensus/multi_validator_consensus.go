@@ -1,6 +1,7 @@
 package consensus
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"errors"
 	"fmt"
@@ -21,6 +22,8 @@ type MultiValidatorConsensus struct {
 	delegations        map[types.Address]map[types.Address]*big.Int // delegator -> validator -> amount
 	currentEpoch       uint64
 	epochBlocks        uint64
+	epochsStarted      bool                          // Set changes wait for the next epoch
+	epochSets          map[uint64]*EpochValidatorSet // Validator sets of the epochs begun
 	blockTime          time.Duration
 	minValidators      int
 	maxValidators      int
@@ -29,18 +32,27 @@ type MultiValidatorConsensus struct {
 
 	// Consensus state
 	currentProposer    types.Address
-	consensusMessages  map[uint64]map[types.Address]*ConsensusVote
-	finalizationQuorum float64 // 2/3+ required
+	consensusMessages  map[uint64]map[voteKey]*ConsensusVote       // Commit votes per round and validator
+	roundChanges       map[uint64]map[types.Address]*ConsensusVote // Highest round change vote per validator
+	finalizationQuorum float64                                     // 2/3+ required
 
 	// Security and governance
 	proposalTimeout time.Duration
-	maxMissedBlocks uint64
 	jailDuration    time.Duration
 	unbondingPeriod time.Duration
 
+	// Liveness tracking over the last committed blocks
+	signedBlocksWindow   uint64
+	minSignedBlocks      uint64
+	downtimeJailDuration time.Duration
+	signingWindows       map[types.Address]*signingWindow
+
 	// Performance tracking
 	networkPerformance *NetworkPerformance
 
+	// Time of votes and jail terms, the simulator replaces it
+	now func() time.Time
+
 	// Thread safety
 	mu sync.RWMutex
 
@@ -88,6 +100,10 @@ type ValidatorPerformance struct {
 	LastSlash          time.Time `json:"lastSlash"`
 }
 
+// ErrInvalidVote is returned for votes not signed by the registered key of
+// their validator
+var ErrInvalidVote = errors.New("invalid consensus vote")
+
 // ValidatorStatus represents validator status
 type ValidatorStatus uint8
 
@@ -104,6 +120,7 @@ type ConsensusVote struct {
 	Validator    types.Address             `json:"validator"`
 	BlockHash    types.Hash                `json:"blockHash"`
 	BlockHeight  uint64                    `json:"blockHeight"`
+	Round        uint64                    `json:"round,omitempty"`
 	VoteType     VoteType                  `json:"voteType"`
 	Timestamp    time.Time                 `json:"timestamp"`
 	Signature    []byte                    `json:"signature"`
@@ -119,6 +136,7 @@ const (
 	VotePreCommit
 	VoteCommit
 	VoteFinalize
+	VoteRoundChange
 )
 
 // NetworkPerformance tracks overall network performance
@@ -139,23 +157,29 @@ func NewMultiValidatorConsensus(chainID *big.Int) *MultiValidatorConsensus {
 	minStake.SetString("100000000000000000000000", 10) // 100,000 QTM minimum
 
 	return &MultiValidatorConsensus{
-		chainID:            chainID,
-		validators:         make(map[types.Address]*ValidatorState),
-		validatorList:      make([]*ValidatorState, 0),
-		delegations:        make(map[types.Address]map[types.Address]*big.Int),
-		currentEpoch:       0,
-		epochBlocks:        7200, // ~4 hours at 2-second blocks
-		blockTime:          2 * time.Second,
-		minValidators:      3,
-		maxValidators:      21,
-		minStake:           minStake,
-		slashingPercentage: 0.05, // 5% slashing
-		consensusMessages:  make(map[uint64]map[types.Address]*ConsensusVote),
-		finalizationQuorum: 0.67,            // 2/3+ required
-		proposalTimeout:    8 * time.Second, // 4x block time
-		maxMissedBlocks:    50,              // Jail after 50 missed blocks
-		jailDuration:       24 * time.Hour,
-		unbondingPeriod:    21 * 24 * time.Hour, // 21 days
+		chainID:              chainID,
+		validators:           make(map[types.Address]*ValidatorState),
+		validatorList:        make([]*ValidatorState, 0),
+		delegations:          make(map[types.Address]map[types.Address]*big.Int),
+		currentEpoch:         0,
+		epochSets:            make(map[uint64]*EpochValidatorSet),
+		epochBlocks:          7200, // ~4 hours at 2-second blocks
+		blockTime:            2 * time.Second,
+		minValidators:        3,
+		maxValidators:        21,
+		minStake:             minStake,
+		slashingPercentage:   0.05, // 5% slashing
+		consensusMessages:    make(map[uint64]map[voteKey]*ConsensusVote),
+		roundChanges:         make(map[uint64]map[types.Address]*ConsensusVote),
+		finalizationQuorum:   0.67,            // 2/3+ required
+		proposalTimeout:      8 * time.Second, // 4x block time
+		jailDuration:         24 * time.Hour,
+		unbondingPeriod:      21 * 24 * time.Hour, // 21 days
+		signedBlocksWindow:   DefaultSignedBlocksWindow,
+		minSignedBlocks:      DefaultSignedBlocksWindow * DefaultMinSignedRatio,
+		downtimeJailDuration: DefaultDowntimeJailDuration,
+		signingWindows:       make(map[types.Address]*signingWindow),
+		now:                  time.Now,
 		networkPerformance: &NetworkPerformance{
 			BlockTime:  2 * time.Second,
 			LastUpdate: time.Now(),
@@ -205,13 +229,13 @@ func (mvc *MultiValidatorConsensus) RegisterValidator(
 			ReliabilityScore: 1.0,
 		},
 		Status:      StatusActive,
-		LastActive:  time.Now(),
+		LastActive:  mvc.now(),
 		VotingPower: new(big.Int).Set(selfStake),
 		Commission:  commission,
 	}
 
 	mvc.validators[address] = validator
-	mvc.updateValidatorSet()
+	mvc.queueValidatorSetUpdate()
 
 	return nil
 }
@@ -255,7 +279,7 @@ func (mvc *MultiValidatorConsensus) Delegate(
 	validatorState.TotalStake.Add(validatorState.TotalStake, amount)
 	validatorState.VotingPower.Add(validatorState.VotingPower, amount)
 
-	mvc.updateValidatorSet()
+	mvc.queueValidatorSetUpdate()
 	return nil
 }
 
@@ -298,7 +322,7 @@ func (mvc *MultiValidatorConsensus) Undelegate(
 		mvc.onUnbond(delegator, validator, amount)
 	}
 
-	mvc.updateValidatorSet()
+	mvc.queueValidatorSetUpdate()
 	return nil
 }
 
@@ -322,22 +346,66 @@ func (mvc *MultiValidatorConsensus) SlashValidator(
 	slashAmount.Div(slashAmount, big.NewInt(1000))
 
 	// Apply slashing
-	validatorState.TotalStake.Sub(validatorState.TotalStake, slashAmount)
-	validatorState.VotingPower.Sub(validatorState.VotingPower, slashAmount)
-	validatorState.Performance.SlashCount++
-	validatorState.Performance.LastSlash = time.Now()
+	mvc.slash(validatorState, slashAmount, reason)
 	validatorState.Status = StatusSlashed
 
 	// Jail validator
-	validatorState.JailedUntil = time.Now().Add(mvc.jailDuration)
+	validatorState.JailedUntil = mvc.now().Add(mvc.jailDuration)
+
+	mvc.queueValidatorSetUpdate()
+	return nil
+}
+
+// SlashStake takes the penalty computed from its stake from a validator and
+// jails it for the jail duration from the given time, returning the amount
+// slashed. Committed blocks slash with their own time, so every node jails
+// the validator alike.
+func (mvc *MultiValidatorConsensus) SlashStake(
+	validator types.Address,
+	penalty func(stake *big.Int) *big.Int,
+	reason string,
+	at time.Time,
+) (*big.Int, error) {
+	mvc.mu.Lock()
+	defer mvc.mu.Unlock()
+
+	validatorState, exists := mvc.validators[validator]
+	if !exists {
+		return nil, errors.New("validator not found")
+	}
+
+	amount := mvc.slash(validatorState, penalty(new(big.Int).Set(validatorState.TotalStake)), reason)
+	validatorState.Status = StatusJailed
+	validatorState.JailedUntil = at.Add(mvc.jailDuration)
+	if mvc.onJail != nil {
+		mvc.onJail(validator, mvc.jailDuration)
+	}
+
+	mvc.queueValidatorSetUpdate()
+	return amount, nil
+}
+
+// slash takes up to amount from the stake of a validator and returns what it
+// took, the caller holds the lock
+func (mvc *MultiValidatorConsensus) slash(validatorState *ValidatorState, amount *big.Int, reason string) *big.Int {
+	slashAmount := new(big.Int).Set(amount)
+	if slashAmount.Cmp(validatorState.TotalStake) > 0 {
+		slashAmount.Set(validatorState.TotalStake)
+	}
+
+	validatorState.TotalStake.Sub(validatorState.TotalStake, slashAmount)
+	validatorState.VotingPower.Sub(validatorState.VotingPower, slashAmount)
+	if validatorState.VotingPower.Sign() < 0 {
+		validatorState.VotingPower.SetInt64(0)
+	}
+	validatorState.Performance.SlashCount++
+	validatorState.Performance.LastSlash = mvc.now()
 
 	// Trigger slash callback
 	if mvc.onSlash != nil {
-		mvc.onSlash(validator, reason, slashAmount)
+		mvc.onSlash(validatorState.Address, reason, slashAmount)
 	}
-
-	mvc.updateValidatorSet()
-	return nil
+	return slashAmount
 }
 
 // GetNextProposer determines next block proposer with enhanced selection
@@ -387,52 +455,190 @@ func (mvc *MultiValidatorConsensus) GetNextProposer(blockHeight uint64) (types.A
 	return activeValidators[0].Address, nil
 }
 
-// SubmitConsensusVote submits a consensus vote
+// voteKey identifies the vote of a validator in a round
+type voteKey struct {
+	Round     uint64
+	Validator types.Address
+}
+
+// SubmitConsensusVote signs and stores a vote of a local validator in a
+// round, and returns it to be sent to the other validators
 func (mvc *MultiValidatorConsensus) SubmitConsensusVote(
 	validator types.Address,
 	blockHash types.Hash,
 	blockHeight uint64,
+	round uint64,
 	voteType VoteType,
 	privateKey []byte,
-) error {
+) (*ConsensusVote, error) {
 	mvc.mu.Lock()
 	defer mvc.mu.Unlock()
 
-	validatorState, exists := mvc.validators[validator]
-	if !exists || validatorState.Status != StatusActive {
-		return errors.New("validator not active")
-	}
-
-	// Create vote message
-	voteData := fmt.Sprintf("%s:%d:%d:%d",
-		blockHash.Hex(), blockHeight, voteType, time.Now().Unix())
-
-	// Sign vote
-	qrSig, err := crypto.SignMessage([]byte(voteData), validatorState.SigAlgorithm, privateKey)
-	if err != nil {
-		return fmt.Errorf("failed to sign vote: %w", err)
+	validatorState := mvc.inValidatorSet(validator)
+	if validatorState == nil {
+		return nil, errors.New("validator not in the validator set")
 	}
 
 	vote := &ConsensusVote{
 		Validator:    validator,
 		BlockHash:    blockHash,
 		BlockHeight:  blockHeight,
+		Round:        round,
 		VoteType:     voteType,
-		Timestamp:    time.Now(),
-		Signature:    qrSig.Signature,
+		Timestamp:    mvc.now(),
 		PublicKey:    validatorState.PublicKey,
 		SigAlgorithm: validatorState.SigAlgorithm,
 	}
 
+	// Sign vote
+	qrSig, err := crypto.SignMessage(vote.SigningData(), validatorState.SigAlgorithm, privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign vote: %w", err)
+	}
+	vote.Signature = qrSig.Signature
+
 	// Store vote
-	if mvc.consensusMessages[blockHeight] == nil {
-		mvc.consensusMessages[blockHeight] = make(map[types.Address]*ConsensusVote)
+	mvc.storeVote(vote)
+	return vote, nil
+}
+
+// AddVote verifies and stores a vote received from another validator. Votes
+// not signed by the registered key of a member of the validator set fail with
+// ErrInvalidVote. A validator voting again in a round keeps its first vote,
+// a vote for another block fails with ErrConflictingVote.
+func (mvc *MultiValidatorConsensus) AddVote(vote *ConsensusVote) error {
+	mvc.mu.RLock()
+	validator := mvc.inValidatorSet(vote.Validator)
+	var registeredKey []byte
+	if validator != nil {
+		registeredKey = validator.PublicKey
+	}
+	key := voteKey{Round: vote.Round, Validator: vote.Validator}
+	existing := mvc.consensusMessages[vote.BlockHeight][key]
+	mvc.mu.RUnlock()
+
+	if validator == nil {
+		return fmt.Errorf("vote of validator %s outside the validator set", vote.Validator.Hex())
+	}
+	if existing != nil {
+		if existing.BlockHash != vote.BlockHash {
+			return fmt.Errorf("%w: validator %s already voted for block %s in round %d at height %d",
+				ErrConflictingVote, vote.Validator.Hex(), existing.BlockHash.Hex(), vote.Round, vote.BlockHeight)
+		}
+		return nil
+	}
+	if err := mvc.verifyVote(vote, registeredKey); err != nil {
+		return err
+	}
+
+	mvc.mu.Lock()
+	defer mvc.mu.Unlock()
+	if existing := mvc.consensusMessages[vote.BlockHeight][key]; existing == nil {
+		mvc.storeVote(vote)
+	}
+	return nil
+}
+
+// verifyVote checks that a vote is recent and signed by the registered key
+// of its validator
+func (mvc *MultiValidatorConsensus) verifyVote(vote *ConsensusVote, registeredKey []byte) error {
+	now := mvc.now()
+	if vote.Timestamp.Before(now.Add(-10*time.Minute)) || vote.Timestamp.After(now.Add(1*time.Minute)) {
+		return fmt.Errorf("vote timestamp %s outside acceptable range", vote.Timestamp.Format(time.RFC3339))
 	}
-	mvc.consensusMessages[blockHeight][validator] = vote
 
+	// SECURITY: The vote must be signed by the registered key of the validator
+	if len(vote.Signature) == 0 || !bytes.Equal(vote.PublicKey, registeredKey) {
+		return fmt.Errorf("%w: not signed by the key of validator %s", ErrInvalidVote, vote.Validator.Hex())
+	}
+	valid, err := crypto.VerifySignature(vote.SigningData(), &crypto.QRSignature{
+		Algorithm: vote.SigAlgorithm,
+		Signature: vote.Signature,
+		PublicKey: vote.PublicKey,
+	})
+	if err != nil || !valid {
+		return fmt.Errorf("%w: bad signature of validator %s", ErrInvalidVote, vote.Validator.Hex())
+	}
 	return nil
 }
 
+// QuorumVotes returns the verified votes for a block in a round once
+// validators holding 2/3+ of the voting power voted for it, ordered by
+// validator address
+func (mvc *MultiValidatorConsensus) QuorumVotes(blockHeight, round uint64, blockHash types.Hash) ([]*ConsensusVote, bool) {
+	mvc.mu.RLock()
+	defer mvc.mu.RUnlock()
+
+	totalVotingPower := big.NewInt(0)
+	for _, validator := range mvc.getActiveValidators() {
+		totalVotingPower.Add(totalVotingPower, validator.VotingPower)
+	}
+
+	votingPower := big.NewInt(0)
+	votes := make([]*ConsensusVote, 0)
+	for key, vote := range mvc.consensusMessages[blockHeight] {
+		validator := mvc.inValidatorSet(key.Validator)
+		if validator == nil || key.Round != round || vote.BlockHash != blockHash {
+			continue
+		}
+		votingPower.Add(votingPower, validator.VotingPower)
+		votes = append(votes, vote)
+	}
+	if totalVotingPower.Sign() == 0 || votingPower.Cmp(quorumPower(totalVotingPower)) < 0 {
+		return nil, false
+	}
+
+	sort.Slice(votes, func(i, j int) bool {
+		return bytes.Compare(votes[i].Validator[:], votes[j].Validator[:]) < 0
+	})
+	return votes, true
+}
+
+// GetVote returns the vote of a validator in a round at a height
+func (mvc *MultiValidatorConsensus) GetVote(blockHeight, round uint64, validator types.Address) (*ConsensusVote, bool) {
+	mvc.mu.RLock()
+	defer mvc.mu.RUnlock()
+
+	vote, ok := mvc.consensusMessages[blockHeight][voteKey{Round: round, Validator: validator}]
+	return vote, ok
+}
+
+// PruneVotes forgets the votes below a height and the round changes up to it
+func (mvc *MultiValidatorConsensus) PruneVotes(blockHeight uint64) {
+	mvc.mu.Lock()
+	defer mvc.mu.Unlock()
+
+	for height := range mvc.consensusMessages {
+		if height < blockHeight {
+			delete(mvc.consensusMessages, height)
+		}
+	}
+	for height := range mvc.roundChanges {
+		if height <= blockHeight {
+			delete(mvc.roundChanges, height)
+		}
+	}
+}
+
+// storeVote records a vote, the caller holds the lock
+func (mvc *MultiValidatorConsensus) storeVote(vote *ConsensusVote) {
+	if mvc.consensusMessages[vote.BlockHeight] == nil {
+		mvc.consensusMessages[vote.BlockHeight] = make(map[voteKey]*ConsensusVote)
+	}
+	mvc.consensusMessages[vote.BlockHeight][voteKey{Round: vote.Round, Validator: vote.Validator}] = vote
+}
+
+// SigningData returns the data a validator signs to cast the vote, votes
+// past round 0 sign their round too
+func (vote *ConsensusVote) SigningData() []byte {
+	data := fmt.Sprintf("%s:%d:%d:%d",
+		vote.BlockHash.Hex(), vote.BlockHeight, vote.VoteType, vote.Timestamp.Unix())
+	if vote.Round > 0 {
+		data += fmt.Sprintf(":%d", vote.Round)
+	}
+	return []byte(data)
+}
+
 // CheckConsensus checks if consensus is reached for a block
 func (mvc *MultiValidatorConsensus) CheckConsensus(blockHeight uint64) (bool, error) {
 	mvc.mu.RLock()
@@ -453,16 +659,12 @@ func (mvc *MultiValidatorConsensus) CheckConsensus(blockHeight uint64) (bool, er
 	votingPower := big.NewInt(0)
 	validVoteCount := 0
 
-	for validatorAddr, vote := range votes {
-		validator := mvc.validators[validatorAddr]
-		if validator == nil || validator.Status != StatusActive {
-			continue // Skip inactive validators
+	for key, vote := range votes {
+		validator := mvc.inValidatorSet(key.Validator)
+		if validator == nil {
+			continue // Skip validators outside the set
 		}
 
-		// SECURITY: Critical vote verification with proper error handling
-		voteData := fmt.Sprintf("%s:%d:%d:%d",
-			vote.BlockHash.Hex(), vote.BlockHeight, vote.VoteType, vote.Timestamp.Unix())
-
 		// SECURITY: Validate vote data structure
 		if vote.Signature == nil || len(vote.Signature) == 0 {
 			continue // Skip votes with empty signatures
@@ -487,7 +689,7 @@ func (mvc *MultiValidatorConsensus) CheckConsensus(blockHeight uint64) (bool, er
 		}
 
 		// SECURITY: Verify vote timestamp is reasonable (not too old/future)
-		now := time.Now()
+		now := mvc.now()
 		if vote.Timestamp.Before(now.Add(-10*time.Minute)) || vote.Timestamp.After(now.Add(1*time.Minute)) {
 			continue // Vote timestamp outside acceptable range
 		}
@@ -499,7 +701,7 @@ func (mvc *MultiValidatorConsensus) CheckConsensus(blockHeight uint64) (bool, er
 		}
 
 		// CRITICAL: Proper signature verification with error handling
-		valid, err := crypto.VerifySignature([]byte(voteData), qrSig)
+		valid, err := crypto.VerifySignature(vote.SigningData(), qrSig)
 		if err != nil {
 			// Log but don't count invalid signatures
 			continue
@@ -515,28 +717,36 @@ func (mvc *MultiValidatorConsensus) CheckConsensus(blockHeight uint64) (bool, er
 	}
 
 	// Check if we have 2/3+ voting power
+	return votingPower.Cmp(quorumPower(totalVotingPower)) >= 0, nil
+}
+
+// quorumPower returns the voting power needed to reach consensus
+func quorumPower(totalVotingPower *big.Int) *big.Int {
 	requiredPower := new(big.Int).Set(totalVotingPower)
 	requiredPower.Mul(requiredPower, big.NewInt(67)) // 67% for safety
-	requiredPower.Div(requiredPower, big.NewInt(100))
-
-	return votingPower.Cmp(requiredPower) >= 0, nil
+	return requiredPower.Div(requiredPower, big.NewInt(100))
 }
 
-// updateValidatorSet updates the active validator set
+// updateValidatorSet updates the active validator set, fixing the state of
+// its members until the next update
 func (mvc *MultiValidatorConsensus) updateValidatorSet() {
 	mvc.validatorList = make([]*ValidatorState, 0)
 
 	for _, validator := range mvc.validators {
 		if validator.Status == StatusActive &&
 			validator.TotalStake.Cmp(mvc.minStake) >= 0 &&
-			time.Now().After(validator.JailedUntil) {
-			mvc.validatorList = append(mvc.validatorList, validator)
+			mvc.now().After(validator.JailedUntil) {
+			mvc.validatorList = append(mvc.validatorList, validator.snapshot())
 		}
 	}
 
-	// Sort by total stake (descending)
+	// Sort by total stake (descending), then by address so that every node
+	// orders validators with equal stake alike
 	sort.Slice(mvc.validatorList, func(i, j int) bool {
-		return mvc.validatorList[i].TotalStake.Cmp(mvc.validatorList[j].TotalStake) > 0
+		if cmp := mvc.validatorList[i].TotalStake.Cmp(mvc.validatorList[j].TotalStake); cmp != 0 {
+			return cmp > 0
+		}
+		return bytes.Compare(mvc.validatorList[i].Address.Bytes(), mvc.validatorList[j].Address.Bytes()) < 0
 	})
 
 	// Limit to max validators
@@ -545,14 +755,11 @@ func (mvc *MultiValidatorConsensus) updateValidatorSet() {
 	}
 }
 
-// getActiveValidators returns active validators (thread-safe helper)
+// getActiveValidators returns the members of the active set, the caller
+// holds the lock
 func (mvc *MultiValidatorConsensus) getActiveValidators() []*ValidatorState {
-	activeValidators := make([]*ValidatorState, 0)
-	for _, validator := range mvc.validatorList {
-		if validator.Status == StatusActive && time.Now().After(validator.JailedUntil) {
-			activeValidators = append(activeValidators, validator)
-		}
-	}
+	activeValidators := make([]*ValidatorState, len(mvc.validatorList))
+	copy(activeValidators, mvc.validatorList)
 	return activeValidators
 }
 
@@ -623,6 +830,15 @@ func (mvc *MultiValidatorConsensus) GetValidatorSet() []*ValidatorState {
 	return result
 }
 
+// GetValidator returns a registered validator, active or not
+func (mvc *MultiValidatorConsensus) GetValidator(address types.Address) (*ValidatorState, bool) {
+	mvc.mu.RLock()
+	defer mvc.mu.RUnlock()
+
+	validator, ok := mvc.validators[address]
+	return validator, ok
+}
+
 // GetNetworkPerformance returns network performance metrics
 func (mvc *MultiValidatorConsensus) GetNetworkPerformance() *NetworkPerformance {
 	mvc.mu.RLock()
@@ -630,7 +846,7 @@ func (mvc *MultiValidatorConsensus) GetNetworkPerformance() *NetworkPerformance
 
 	// Update current metrics
 	mvc.networkPerformance.ValidatorOnline = len(mvc.getActiveValidators())
-	mvc.networkPerformance.LastUpdate = time.Now()
+	mvc.networkPerformance.LastUpdate = mvc.now()
 
 	return mvc.networkPerformance
 }
@@ -657,6 +873,14 @@ func (mvc *MultiValidatorConsensus) GetConsensusInfo() map[string]interface{} {
 	}
 }
 
+// SetClock replaces the clock timing votes and jail terms
+func (mvc *MultiValidatorConsensus) SetClock(now func() time.Time) {
+	mvc.mu.Lock()
+	defer mvc.mu.Unlock()
+
+	mvc.now = now
+}
+
 // SetEventHandlers sets event handlers for slashing, jailing, etc.
 func (mvc *MultiValidatorConsensus) SetEventHandlers(
 	onSlash func(types.Address, string, *big.Int),
@@ -713,7 +937,7 @@ func (mvc *MultiValidatorConsensus) DistributeBlockReward(
 	// Update validator performance metrics
 	validatorState.Performance.BlocksProposed++
 	validatorState.Performance.BlocksProposedOK++
-	validatorState.LastActive = time.Now()
+	validatorState.LastActive = mvc.now()
 
 	// Update reliability score based on recent performance
 	totalProposed := validatorState.Performance.BlocksProposed
@@ -746,32 +970,3 @@ func (mvc *MultiValidatorConsensus) ValidateBlockProposer(blockHeight uint64, pr
 
 	return nil
 }
-
-// RecordMissedBlock records when a validator misses their block proposal slot
-func (mvc *MultiValidatorConsensus) RecordMissedBlock(validator types.Address) {
-	mvc.mu.Lock()
-	defer mvc.mu.Unlock()
-
-	validatorState, exists := mvc.validators[validator]
-	if !exists {
-		return
-	}
-
-	validatorState.Performance.BlocksMissed++
-
-	// Check if validator should be jailed for too many missed blocks
-	if validatorState.Performance.BlocksMissed >= mvc.maxMissedBlocks {
-		validatorState.Status = StatusJailed
-		validatorState.JailedUntil = time.Now().Add(mvc.jailDuration)
-
-		if mvc.onJail != nil {
-			mvc.onJail(validator, mvc.jailDuration)
-		}
-	}
-
-	// Update uptime score
-	totalBlocks := validatorState.Performance.BlocksProposed + validatorState.Performance.BlocksMissed
-	if totalBlocks > 0 {
-		validatorState.Performance.UptimeScore = 1.0 - (float64(validatorState.Performance.BlocksMissed) / float64(totalBlocks))
-	}
-}
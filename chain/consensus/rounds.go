@@ -0,0 +1,170 @@
+package consensus
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/types"
+)
+
+// GetProposer returns the proposer of a block in a round. Round 0 is
+// proposed by the scheduled proposer, every later round by the next active
+// validator after the proposer of the round before.
+func (mvc *MultiValidatorConsensus) GetProposer(blockHeight, round uint64) (types.Address, error) {
+	proposer, err := mvc.GetNextProposer(blockHeight)
+	if err != nil || round == 0 {
+		return proposer, err
+	}
+
+	mvc.mu.RLock()
+	defer mvc.mu.RUnlock()
+
+	activeValidators := mvc.getActiveValidators()
+	for i, validator := range activeValidators {
+		if validator.Address == proposer {
+			return activeValidators[(uint64(i)+round)%uint64(len(activeValidators))].Address, nil
+		}
+	}
+	return types.Address{}, errors.New("proposer left the validator set")
+}
+
+// ProposalTimeout returns how long validators wait for a proposal before
+// they vote to move on to the next round
+func (mvc *MultiValidatorConsensus) ProposalTimeout() time.Duration {
+	mvc.mu.RLock()
+	defer mvc.mu.RUnlock()
+
+	return mvc.proposalTimeout
+}
+
+// SetProposalTimeout sets how long validators wait for a proposal, in whole
+// seconds as block times are
+func (mvc *MultiValidatorConsensus) SetProposalTimeout(timeout time.Duration) error {
+	if timeout < time.Second || timeout%time.Second != 0 {
+		return fmt.Errorf("proposal timeout must be a positive number of seconds, got %s", timeout)
+	}
+
+	mvc.mu.Lock()
+	defer mvc.mu.Unlock()
+
+	mvc.proposalTimeout = timeout
+	return nil
+}
+
+// SubmitRoundChange signs and stores a vote of a local validator to move on
+// to a round at a height, and returns it to be sent to the other validators
+func (mvc *MultiValidatorConsensus) SubmitRoundChange(
+	validator types.Address,
+	blockHeight uint64,
+	round uint64,
+	privateKey []byte,
+) (*ConsensusVote, error) {
+	mvc.mu.Lock()
+	defer mvc.mu.Unlock()
+
+	validatorState := mvc.inValidatorSet(validator)
+	if validatorState == nil {
+		return nil, errors.New("validator not in the validator set")
+	}
+
+	vote := &ConsensusVote{
+		Validator:    validator,
+		BlockHeight:  blockHeight,
+		Round:        round,
+		VoteType:     VoteRoundChange,
+		Timestamp:    mvc.now(),
+		PublicKey:    validatorState.PublicKey,
+		SigAlgorithm: validatorState.SigAlgorithm,
+	}
+	qrSig, err := crypto.SignMessage(vote.SigningData(), validatorState.SigAlgorithm, privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign round change: %w", err)
+	}
+	vote.Signature = qrSig.Signature
+
+	mvc.storeRoundChange(vote)
+	return vote, nil
+}
+
+// AddRoundChange verifies and stores a round change vote received from
+// another validator. Votes not signed by the registered key of a member of
+// the validator set fail with ErrInvalidVote, a validator's vote for a lower
+// round than it voted for before is ignored.
+func (mvc *MultiValidatorConsensus) AddRoundChange(vote *ConsensusVote) error {
+	if vote.VoteType != VoteRoundChange || vote.Round == 0 || !vote.BlockHash.IsZero() {
+		return fmt.Errorf("%w: malformed round change of validator %s", ErrInvalidVote, vote.Validator.Hex())
+	}
+
+	mvc.mu.RLock()
+	validator := mvc.inValidatorSet(vote.Validator)
+	var registeredKey []byte
+	if validator != nil {
+		registeredKey = validator.PublicKey
+	}
+	existing := mvc.roundChanges[vote.BlockHeight][vote.Validator]
+	mvc.mu.RUnlock()
+
+	if validator == nil {
+		return fmt.Errorf("round change of validator %s outside the validator set", vote.Validator.Hex())
+	}
+	if existing != nil && existing.Round >= vote.Round {
+		return nil
+	}
+	if err := mvc.verifyVote(vote, registeredKey); err != nil {
+		return err
+	}
+
+	mvc.mu.Lock()
+	defer mvc.mu.Unlock()
+	mvc.storeRoundChange(vote)
+	return nil
+}
+
+// RoundChangeQuorum returns the highest round at a height that validators
+// holding 2/3+ of the voting power voted to move on to, 0 if there is none
+func (mvc *MultiValidatorConsensus) RoundChangeQuorum(blockHeight uint64) uint64 {
+	mvc.mu.RLock()
+	defer mvc.mu.RUnlock()
+
+	totalVotingPower := big.NewInt(0)
+	for _, validator := range mvc.getActiveValidators() {
+		totalVotingPower.Add(totalVotingPower, validator.VotingPower)
+	}
+	if totalVotingPower.Sign() == 0 {
+		return 0
+	}
+
+	votes := make([]*ConsensusVote, 0, len(mvc.roundChanges[blockHeight]))
+	for validatorAddr, vote := range mvc.roundChanges[blockHeight] {
+		if mvc.inValidatorSet(validatorAddr) != nil {
+			votes = append(votes, vote)
+		}
+	}
+	sort.Slice(votes, func(i, j int) bool { return votes[i].Round > votes[j].Round })
+
+	// A validator voting for a round also votes for the rounds before it
+	votingPower := big.NewInt(0)
+	required := quorumPower(totalVotingPower)
+	for _, vote := range votes {
+		votingPower.Add(votingPower, mvc.inValidatorSet(vote.Validator).VotingPower)
+		if votingPower.Cmp(required) >= 0 {
+			return vote.Round
+		}
+	}
+	return 0
+}
+
+// storeRoundChange records the round change vote of a validator if it is
+// for a higher round than its last one, the caller holds the lock
+func (mvc *MultiValidatorConsensus) storeRoundChange(vote *ConsensusVote) {
+	if mvc.roundChanges[vote.BlockHeight] == nil {
+		mvc.roundChanges[vote.BlockHeight] = make(map[types.Address]*ConsensusVote)
+	}
+	if existing := mvc.roundChanges[vote.BlockHeight][vote.Validator]; existing == nil || existing.Round < vote.Round {
+		mvc.roundChanges[vote.BlockHeight][vote.Validator] = vote
+	}
+}
@@ -314,6 +314,9 @@ func (c *QuantumPoSConsensus) PrepareBlock(parentBlock *types.Block, transaction
 		gasLimit,
 		uint64(time.Now().Unix()),
 	)
+	if parentBlock != nil {
+		header.BaseFee = types.CalcBaseFee(parentBlock.Header)
+	}
 
 	// Create block
 	block := types.NewBlock(header, transactions, []*types.BlockHeader{})
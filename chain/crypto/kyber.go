@@ -13,6 +13,7 @@ const (
 	KyberPrivateKeySize   = kyber512.PrivateKeySize
 	KyberCiphertextSize   = kyber512.CiphertextSize
 	KyberSharedSecretSize = kyber512.SharedKeySize
+	KyberSeedSize         = kyber512.KeySeedSize
 )
 
 type KyberPrivateKey struct {
@@ -40,6 +41,21 @@ func GenerateKyberKeyPair() (*KyberPrivateKey, *KyberPublicKey, error) {
 	return &privKey, &pubKey, nil
 }
 
+// KyberKeyPairFromSeed derives a Kyber key pair deterministically from a seed
+func KyberKeyPairFromSeed(seed []byte) (*KyberPrivateKey, *KyberPublicKey, error) {
+	if len(seed) != KyberSeedSize {
+		return nil, nil, fmt.Errorf("invalid seed size: %d bytes, want %d", len(seed), KyberSeedSize)
+	}
+	publicKey, privateKey := kyber512.NewKeyFromSeed(seed)
+
+	var privKey KyberPrivateKey
+	var pubKey KyberPublicKey
+	privateKey.Pack(privKey.privateKey[:])
+	publicKey.Pack(pubKey.publicKey[:])
+
+	return &privKey, &pubKey, nil
+}
+
 // Encapsulate generates a shared secret and encapsulates it using Kyber KEM
 func (pub *KyberPublicKey) Encapsulate() ([]byte, []byte, error) {
 	// Unpack public key
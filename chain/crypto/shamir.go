@@ -0,0 +1,98 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// SplitSecret splits a secret into n shares of Shamir's scheme over GF(256),
+// any threshold of which recover it while fewer reveal nothing. Share i is
+// the point at x = i+1.
+func SplitSecret(secret []byte, threshold, n int) ([][]byte, error) {
+	if threshold < 1 || threshold > n || n > 255 {
+		return nil, fmt.Errorf("invalid secret sharing: %d of %d shares", threshold, n)
+	}
+
+	// One random polynomial per byte, its constant term is the secret byte
+	coefficients := make([]byte, len(secret)*(threshold-1))
+	if _, err := rand.Read(coefficients); err != nil {
+		return nil, fmt.Errorf("failed to generate polynomials: %w", err)
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		x := byte(i + 1)
+		share := make([]byte, len(secret))
+		for j, s := range secret {
+			// Horner's rule from the highest coefficient down
+			y := byte(0)
+			for k := threshold - 2; k >= 0; k-- {
+				y = gfMul(y, x) ^ coefficients[j*(threshold-1)+k]
+			}
+			share[j] = gfMul(y, x) ^ s
+		}
+		shares[i] = share
+	}
+	return shares, nil
+}
+
+// CombineShares recovers the secret from shares by their x coordinate, at
+// least the threshold they were split with
+func CombineShares(shares map[byte][]byte) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("no shares to combine")
+	}
+	size := -1
+	for x, share := range shares {
+		if x == 0 {
+			return nil, errors.New("share at x = 0")
+		}
+		if size >= 0 && len(share) != size {
+			return nil, errors.New("shares differ in size")
+		}
+		size = len(share)
+	}
+
+	// Lagrange interpolation at x = 0
+	secret := make([]byte, size)
+	for xi, share := range shares {
+		basis := byte(1)
+		for xj := range shares {
+			if xj != xi {
+				basis = gfMul(basis, gfDiv(xj, xj^xi))
+			}
+		}
+		for j := range secret {
+			secret[j] ^= gfMul(share[j], basis)
+		}
+	}
+	return secret, nil
+}
+
+// gfMul multiplies in GF(256) with the AES polynomial
+func gfMul(a, b byte) byte {
+	var p byte
+	for b > 0 {
+		if b&1 == 1 {
+			p ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return p
+}
+
+// gfDiv divides in GF(256), b is not zero
+func gfDiv(a, b byte) byte {
+	// b^254 is the inverse of b
+	inverse := byte(1)
+	for i := 0; i < 254; i++ {
+		inverse = gfMul(inverse, b)
+	}
+	return gfMul(a, inverse)
+}
@@ -353,6 +353,16 @@ func (te *TokenomicsEngine) ProcessFeeBurn(totalFees *big.Int) (*big.Int, *big.I
 	return burnAmount, treasuryAmount
 }
 
+// RecordBaseFeeBurn records the base fees of a block, which are burned in
+// full rather than shared with the treasury like the fees ProcessFeeBurn splits
+func (te *TokenomicsEngine) RecordBaseFeeBurn(amount *big.Int) {
+	te.mu.Lock()
+	defer te.mu.Unlock()
+
+	te.totalBurned.Add(te.totalBurned, amount)
+	te.circulatingSupply.Sub(te.circulatingSupply, amount)
+}
+
 // CalculateSlashingPenalty calculates slashing penalty amount
 func (te *TokenomicsEngine) CalculateSlashingPenalty(
 	stakedAmount *big.Int,
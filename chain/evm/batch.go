@@ -0,0 +1,198 @@
+package evm
+
+import (
+	"fmt"
+	"math/big"
+
+	"quantum-blockchain/chain/types"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// BatchCallGas is charged for every call of a batch instead of the full
+// transaction base cost, the signature is only paid for once per batch
+const BatchCallGas = uint64(5000)
+
+// CallResult is the outcome of a single call of a batch transaction
+type CallResult struct {
+	Status     uint          `json:"status"` // 1 for success, 0 for failure
+	GasUsed    uint64        `json:"gasUsed"`
+	ReturnData hexutil.Bytes `json:"returnData,omitempty"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// executeBatch runs the calls of a batch message in order. Atomic batches
+// discard every effect once a call fails, best-effort batches only discard
+// the effects of the failing call and continue with the next one.
+func (evm *SimpleEVM) executeBatch(msg *Message, gasLimit uint64) (*ExecutionResult, error) {
+	gasUsed := msg.IntrinsicGas()
+	if gasUsed > gasLimit {
+		return &ExecutionResult{
+			GasUsed: gasLimit,
+			Err:     ErrOutOfGas,
+		}, nil
+	}
+
+	parent := evm.stateDB
+	defer func() { evm.stateDB = parent }()
+
+	batchState := newStateBuffer(parent)
+	result := &ExecutionResult{}
+	for i, call := range msg.Calls {
+		callState := batchState
+		if msg.BatchMode == types.BatchBestEffort {
+			callState = newStateBuffer(parent)
+		}
+		evm.stateDB = callState
+
+		to := call.To
+		callMsg := &Message{
+			From:     msg.From,
+			To:       &to,
+			Nonce:    msg.Nonce,
+			Value:    call.Value,
+			Gas:      gasLimit - gasUsed,
+			GasPrice: msg.GasPrice,
+			Data:     call.Data,
+		}
+
+		if evm.tracer != nil {
+			evm.tracer.CaptureEnter(vm.CALL, msg.From, to, call.Data, callMsg.Gas, call.Value)
+		}
+		res, err := evm.executeContractCall(callMsg, to, BatchCallGas, callMsg.Gas)
+		if err != nil {
+			return nil, fmt.Errorf("batch call %d: %w", i, err)
+		}
+		if evm.tracer != nil {
+			evm.tracer.CaptureExit(res.ReturnData, res.GasUsed, res.Err)
+		}
+
+		gasUsed += res.GasUsed
+		outcome := &CallResult{Status: 1, GasUsed: res.GasUsed, ReturnData: res.ReturnData}
+		if res.Err != nil {
+			outcome.Status = 0
+			outcome.Error = res.Err.Error()
+		}
+		result.CallResults = append(result.CallResults, outcome)
+
+		if res.Err != nil {
+			if msg.BatchMode == types.BatchAtomic {
+				result.GasUsed = gasUsed
+				result.ReturnData = res.ReturnData
+				result.Logs = nil
+				result.Err = fmt.Errorf("batch call %d failed: %w", i, res.Err)
+				return result, nil
+			}
+			continue
+		}
+
+		result.Logs = append(result.Logs, res.Logs...)
+		if msg.BatchMode == types.BatchBestEffort {
+			callState.commit()
+		}
+	}
+
+	if msg.BatchMode == types.BatchAtomic {
+		batchState.commit()
+	}
+	result.GasUsed = gasUsed
+	return result, nil
+}
+
+// stateBuffer collects writes on top of a state so that they can be committed
+// or discarded together
+type stateBuffer struct {
+	parent   StateInterface
+	balances map[types.Address]*big.Int
+	nonces   map[types.Address]uint64
+	codes    map[types.Address][]byte
+	storage  map[types.Address]map[types.Hash]types.Hash
+}
+
+// newStateBuffer creates an empty write buffer on top of parent
+func newStateBuffer(parent StateInterface) *stateBuffer {
+	return &stateBuffer{
+		parent:   parent,
+		balances: make(map[types.Address]*big.Int),
+		nonces:   make(map[types.Address]uint64),
+		codes:    make(map[types.Address][]byte),
+		storage:  make(map[types.Address]map[types.Hash]types.Hash),
+	}
+}
+
+// commit writes the buffered changes to the parent state
+func (b *stateBuffer) commit() {
+	for addr, balance := range b.balances {
+		b.parent.SetBalance(addr, balance)
+	}
+	for addr, nonce := range b.nonces {
+		b.parent.SetNonce(addr, nonce)
+	}
+	for addr, code := range b.codes {
+		b.parent.SetCode(addr, code)
+	}
+	for addr, slots := range b.storage {
+		for key, value := range slots {
+			b.parent.SetState(addr, key, value)
+		}
+	}
+}
+
+func (b *stateBuffer) GetBalance(addr types.Address) *big.Int {
+	if balance, ok := b.balances[addr]; ok {
+		return new(big.Int).Set(balance)
+	}
+	return b.parent.GetBalance(addr)
+}
+
+func (b *stateBuffer) SetBalance(addr types.Address, balance *big.Int) {
+	b.balances[addr] = new(big.Int).Set(balance)
+}
+
+func (b *stateBuffer) GetNonce(addr types.Address) uint64 {
+	if nonce, ok := b.nonces[addr]; ok {
+		return nonce
+	}
+	return b.parent.GetNonce(addr)
+}
+
+func (b *stateBuffer) SetNonce(addr types.Address, nonce uint64) {
+	b.nonces[addr] = nonce
+}
+
+func (b *stateBuffer) GetCode(addr types.Address) []byte {
+	if code, ok := b.codes[addr]; ok {
+		return code
+	}
+	return b.parent.GetCode(addr)
+}
+
+func (b *stateBuffer) SetCode(addr types.Address, code []byte) {
+	b.codes[addr] = code
+}
+
+func (b *stateBuffer) GetState(addr types.Address, key types.Hash) types.Hash {
+	if value, ok := b.storage[addr][key]; ok {
+		return value
+	}
+	return b.parent.GetState(addr, key)
+}
+
+func (b *stateBuffer) SetState(addr types.Address, key types.Hash, value types.Hash) {
+	if b.storage[addr] == nil {
+		b.storage[addr] = make(map[types.Hash]types.Hash)
+	}
+	b.storage[addr][key] = value
+}
+
+func (b *stateBuffer) Exist(addr types.Address) bool {
+	_, balance := b.balances[addr]
+	_, nonce := b.nonces[addr]
+	_, code := b.codes[addr]
+	return balance || nonce || code || b.parent.Exist(addr)
+}
+
+func (b *stateBuffer) Empty(addr types.Address) bool {
+	return b.GetBalance(addr).Sign() == 0 && b.GetNonce(addr) == 0 && len(b.GetCode(addr)) == 0
+}
@@ -0,0 +1,60 @@
+package evm
+
+import (
+	"fmt"
+
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/types"
+)
+
+// KeyShareByteGas is charged per byte of the key shares of an encrypted
+// transaction, on top of the decapsulation of every share
+const KeyShareByteGas = uint64(2)
+
+// EncryptionGas returns the gas paid for carrying the key shares of an
+// encrypted transaction and for their validators decapsulating them
+func EncryptionGas(shares int) uint64 {
+	return uint64(shares) * (KeyShareByteGas*uint64(types.KeyShareSize) + KyberDecapsGas)
+}
+
+// KeyShareSecret recovers the secret of the capsule of a key share with the
+// private key of its validator for the epoch, using the logic of the
+// KyberDecaps precompile
+func KeyShareSecret(tx *types.QuantumTransaction, index int, epochKey *crypto.KyberPrivateKey) ([]byte, error) {
+	input := append(append([]byte{}, tx.KeyShares[index].Capsule...), epochKey.Bytes()...)
+	secret, err := (&KyberDecaps{}).Run(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decapsulate key share %d of %s: %w", index, tx.Hash().Hex(), err)
+	}
+	return secret[:crypto.KyberSharedSecretSize], nil
+}
+
+// DecryptMessage converts an encrypted transaction into a message executing
+// its payload, decrypted with the key revealed in the next block. A payload
+// that can not be decrypted only pays for its intrinsic gas.
+func DecryptMessage(tx *types.QuantumTransaction, key []byte) *Message {
+	msg := TransactionToMessage(tx)
+	payload, err := tx.DecryptPayload(key)
+	if err != nil {
+		msg.DecryptErr = err
+		return msg
+	}
+	msg.To = payload.To
+	msg.Value = payload.Value
+	msg.Data = payload.Data
+	msg.DecryptErr = nil
+	return msg
+}
+
+// executeUndecryptable charges the intrinsic gas of an encrypted message
+// whose payload could not be executed
+func (evm *SimpleEVM) executeUndecryptable(msg *Message, gasLimit uint64) (*ExecutionResult, error) {
+	gasUsed := msg.IntrinsicGas()
+	if gasUsed > gasLimit {
+		gasUsed = gasLimit
+	}
+	return &ExecutionResult{
+		GasUsed: gasUsed,
+		Err:     msg.DecryptErr,
+	}, nil
+}
@@ -0,0 +1,75 @@
+package evm
+
+import (
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/types"
+)
+
+// Intrinsic gas schedule, charged before any execution. Post-quantum
+// signatures and public keys are kilobytes large, so their bytes are paid
+// for on top of the flat base cost and the verification of the algorithm.
+const (
+	TxBaseGas        = uint64(21000) // Flat cost of every transaction
+	SignatureByteGas = uint64(2)     // Per byte of the signature
+	PublicKeyByteGas = uint64(2)     // Per byte of the public key
+)
+
+// IntrinsicGas returns the gas a transaction signed with alg pays before
+// execution, given the sizes of its signature and public key
+func IntrinsicGas(alg crypto.SignatureAlgorithm, sigSize, pubKeySize int) uint64 {
+	return TxBaseGas + SignatureGas(alg, sigSize, pubKeySize)
+}
+
+// SignatureGas returns the gas paid for carrying and verifying one signature
+func SignatureGas(alg crypto.SignatureAlgorithm, sigSize, pubKeySize int) uint64 {
+	gas := SignatureByteGas * uint64(sigSize)
+	gas += PublicKeyByteGas * uint64(pubKeySize)
+	gas += SignatureVerificationGas(alg)
+	return gas
+}
+
+// TransactionIntrinsicGas returns the intrinsic gas of a signed transaction,
+// sponsored transactions also pay for the fee payer signature and encrypted
+// transactions for their key shares
+func TransactionIntrinsicGas(tx *types.QuantumTransaction) uint64 {
+	gas := TxBaseGas
+	if tx.IsMultisig() {
+		gas += MultisigGas(tx.Multisig, tx.MultisigSignatures)
+	} else {
+		gas += SignatureGas(tx.SigAlg, len(tx.Signature), len(tx.PublicKey))
+	}
+	if tx.IsSponsored() {
+		gas += SignatureGas(tx.FeePayerSigAlg, len(tx.FeePayerSignature), len(tx.FeePayerPublicKey))
+	}
+	if tx.IsEncrypted() {
+		gas += EncryptionGas(len(tx.KeyShares))
+	}
+	return gas
+}
+
+// MultisigGas returns the gas paid for the policy keys of a multisig sender
+// and for every signature it carries. Signatures name their key by index, so
+// their public keys are paid for once, with the policy.
+func MultisigGas(policy *types.MultisigPolicy, signatures []*crypto.QRSignature) uint64 {
+	var gas uint64
+	for _, key := range policy.Keys {
+		if key != nil {
+			gas += PublicKeyByteGas * uint64(len(key.PublicKey))
+		}
+	}
+	for _, sig := range signatures {
+		gas += SignatureGas(sig.Algorithm, len(sig.Signature), 0)
+	}
+	return gas
+}
+
+// SignatureSizes returns the signature and public key sizes of alg, used to
+// price transactions that have not been signed yet
+func SignatureSizes(alg crypto.SignatureAlgorithm) (sigSize, pubKeySize int) {
+	switch alg {
+	case crypto.SigAlgFalcon:
+		return crypto.FalconSignatureSize, crypto.FalconPublicKeySize
+	default:
+		return crypto.DilithiumSignatureSize, crypto.DilithiumPublicKeySize
+	}
+}
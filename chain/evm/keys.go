@@ -0,0 +1,211 @@
+package evm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/types"
+)
+
+// KeyRegistryAddress holds the key bindings of rotated accounts in its storage,
+// so they are part of the state like any other account data
+var KeyRegistryAddress = types.BytesToAddress([]byte{0x01, 0x00}) // 0x0100
+
+// Key rotation gas schedule, charged on top of the intrinsic gas
+const (
+	KeyRotationGas    = uint64(20000) // Flat cost of binding a new key
+	KeyStorageByteGas = uint64(200)   // Per byte of the stored public key, as for contract code
+)
+
+var (
+	// ErrKeyNotBound is returned when a transaction is signed by a key that is not bound to its sender
+	ErrKeyNotBound = errors.New("signing key is not bound to sender")
+)
+
+// keyRegistryDomain prefixes the storage slots of the key registry
+var keyRegistryDomain = []byte("quantum-key-registry")
+
+// KeyBinding is a public key bound to an account by a key rotation
+type KeyBinding struct {
+	Algorithm   crypto.SignatureAlgorithm
+	PublicKey   []byte
+	BlockNumber uint64 // Block the rotation was included in
+}
+
+// KeyBindingAt returns the key currently bound to addr, or nil if the key of
+// the account was never rotated and still derives its address
+func KeyBindingAt(state StateInterface, addr types.Address) *KeyBinding {
+	count := keyRotationCount(state, addr)
+	if count == 0 {
+		return nil
+	}
+	return readKeyBinding(state, addr, count)
+}
+
+// KeyHistory returns every key bound to addr, oldest first
+func KeyHistory(state StateInterface, addr types.Address) []*KeyBinding {
+	count := keyRotationCount(state, addr)
+	history := make([]*KeyBinding, 0, count)
+	for i := uint64(1); i <= count; i++ {
+		history = append(history, readKeyBinding(state, addr, i))
+	}
+	return history
+}
+
+// CheckSenderKey checks that a transaction is signed by the key bound to its
+// sender. Without a binding the key must derive the sender address.
+func CheckSenderKey(tx *types.QuantumTransaction, binding *KeyBinding) error {
+	if tx.IsMultisig() {
+		if tx.Sender != nil {
+			return errors.New("multisig transactions can not set a sender")
+		}
+		return nil
+	}
+
+	from := tx.From()
+	if binding == nil {
+		if types.PublicKeyToAddress(tx.PublicKey) != from {
+			return fmt.Errorf("%w: %s", ErrKeyNotBound, from.Hex())
+		}
+		return nil
+	}
+	if tx.SigAlg != binding.Algorithm || !bytes.Equal(tx.PublicKey, binding.PublicKey) {
+		return fmt.Errorf("%w: %s rotated its key in block %d", ErrKeyNotBound, from.Hex(), binding.BlockNumber)
+	}
+	return nil
+}
+
+// CheckFeePayerKey checks that a sponsored transaction is signed by the key
+// bound to its fee payer. Without a binding the key must derive the fee payer
+// address.
+func CheckFeePayerKey(tx *types.QuantumTransaction, binding *KeyBinding) error {
+	if !tx.IsSponsored() {
+		return nil
+	}
+
+	payer := *tx.FeePayer
+	if binding == nil {
+		if types.PublicKeyToAddress(tx.FeePayerPublicKey) != payer {
+			return fmt.Errorf("%w: %s", types.ErrFeePayerMismatch, payer.Hex())
+		}
+		return nil
+	}
+	if tx.FeePayerSigAlg != binding.Algorithm || !bytes.Equal(tx.FeePayerPublicKey, binding.PublicKey) {
+		return fmt.Errorf("%w: fee payer %s rotated its key in block %d", ErrKeyNotBound, payer.Hex(), binding.BlockNumber)
+	}
+	return nil
+}
+
+// CheckSigningKeys checks the sender key and the fee payer key of a
+// transaction against the keys bound to their accounts, which keyOf returns
+func CheckSigningKeys(tx *types.QuantumTransaction, keyOf func(types.Address) *KeyBinding) error {
+	if err := CheckSenderKey(tx, keyOf(tx.From())); err != nil {
+		return err
+	}
+	if tx.IsSponsored() {
+		return CheckFeePayerKey(tx, keyOf(*tx.FeePayer))
+	}
+	return nil
+}
+
+// KeyBindings returns a lookup of the keys bound to accounts in state
+func KeyBindings(state StateInterface) func(types.Address) *KeyBinding {
+	return func(addr types.Address) *KeyBinding {
+		return KeyBindingAt(state, addr)
+	}
+}
+
+// executeKeyRotation binds the new key of a key rotation message to its sender
+func (evm *SimpleEVM) executeKeyRotation(msg *Message, block *types.Block, gasLimit uint64) (*ExecutionResult, error) {
+	gasUsed := msg.IntrinsicGas() + KeyRotationGas + KeyStorageByteGas*uint64(len(msg.NewPublicKey))
+	if gasUsed > gasLimit {
+		return &ExecutionResult{
+			GasUsed: gasLimit,
+			Err:     ErrOutOfGas,
+		}, nil
+	}
+
+	size, err := crypto.GetPublicKeySize(msg.NewSigAlg)
+	if err == nil && len(msg.NewPublicKey) != size {
+		err = fmt.Errorf("public key has %d bytes, want %d", len(msg.NewPublicKey), size)
+	}
+	if err != nil {
+		return &ExecutionResult{
+			GasUsed: gasUsed,
+			Err:     fmt.Errorf("invalid key rotation: %w", err),
+		}, nil
+	}
+
+	count := keyRotationCount(evm.stateDB, msg.From) + 1
+	writeKeyBinding(evm.stateDB, msg.From, count, &KeyBinding{
+		Algorithm:   msg.NewSigAlg,
+		PublicKey:   msg.NewPublicKey,
+		BlockNumber: block.Number().Uint64(),
+	})
+	evm.stateDB.SetState(KeyRegistryAddress, keyCountSlot(msg.From), uint64ToHash(count))
+
+	return &ExecutionResult{GasUsed: gasUsed}, nil
+}
+
+// Storage layout of the registry: the count slot of an account holds the
+// number of rotations, binding i starts at its entry slot with a header of
+// algorithm, key length and block number followed by the key in 32 byte words.
+
+func keyCountSlot(addr types.Address) types.Hash {
+	data := append(append([]byte{}, keyRegistryDomain...), addr.Bytes()...)
+	return types.Keccak256Hash(data)
+}
+
+func keyEntrySlot(addr types.Address, index uint64, offset uint64) types.Hash {
+	data := append(append([]byte{}, keyRegistryDomain...), addr.Bytes()...)
+	data = binary.BigEndian.AppendUint64(data, index)
+	slot := new(big.Int).SetBytes(types.Keccak256(data))
+	slot.Add(slot, new(big.Int).SetUint64(offset))
+	return types.BytesToHash(slot.Bytes())
+}
+
+func keyRotationCount(state StateInterface, addr types.Address) uint64 {
+	value := state.GetState(KeyRegistryAddress, keyCountSlot(addr))
+	return binary.BigEndian.Uint64(value[24:])
+}
+
+func readKeyBinding(state StateInterface, addr types.Address, index uint64) *KeyBinding {
+	header := state.GetState(KeyRegistryAddress, keyEntrySlot(addr, index, 0))
+	binding := &KeyBinding{
+		Algorithm:   crypto.SignatureAlgorithm(header[0]),
+		BlockNumber: binary.BigEndian.Uint64(header[9:17]),
+	}
+
+	length := binary.BigEndian.Uint64(header[1:9])
+	key := make([]byte, 0, length)
+	for word := uint64(1); uint64(len(key)) < length; word++ {
+		value := state.GetState(KeyRegistryAddress, keyEntrySlot(addr, index, word))
+		key = append(key, value[:]...)
+	}
+	binding.PublicKey = key[:length]
+	return binding
+}
+
+func writeKeyBinding(state StateInterface, addr types.Address, index uint64, binding *KeyBinding) {
+	var header types.Hash
+	header[0] = byte(binding.Algorithm)
+	binary.BigEndian.PutUint64(header[1:9], uint64(len(binding.PublicKey)))
+	binary.BigEndian.PutUint64(header[9:17], binding.BlockNumber)
+	state.SetState(KeyRegistryAddress, keyEntrySlot(addr, index, 0), header)
+
+	for word := uint64(0); word*32 < uint64(len(binding.PublicKey)); word++ {
+		var value types.Hash
+		copy(value[:], binding.PublicKey[word*32:])
+		state.SetState(KeyRegistryAddress, keyEntrySlot(addr, index, word+1), value)
+	}
+}
+
+func uint64ToHash(n uint64) types.Hash {
+	var hash types.Hash
+	binary.BigEndian.PutUint64(hash[24:], n)
+	return hash
+}
@@ -0,0 +1,175 @@
+package evm
+
+import (
+	"errors"
+	"math/big"
+
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/types"
+)
+
+var (
+	// ErrOutOfGas is returned when execution needs more gas than the message provides
+	ErrOutOfGas = errors.New("out of gas")
+
+	// ErrExecutionReverted is returned when execution fails with a revert reason
+	ErrExecutionReverted = errors.New("execution reverted")
+)
+
+// revertSelector is the ABI selector of Error(string)
+var revertSelector = []byte{0x08, 0xc3, 0x79, 0xa0}
+
+// Message is the execution payload of a transaction, independent of its signature
+type Message struct {
+	From      types.Address
+	To        *types.Address
+	Nonce     uint64
+	Value     *big.Int
+	Gas       uint64
+	GasPrice  *big.Int // Effective price per gas, set when the message is applied
+	GasFeeCap *big.Int // Maximum total price per gas
+	GasTipCap *big.Int // Maximum tip per gas paid to the block producer
+	Data      []byte
+
+	// NoBaseFee lets simulated calls without any gas price run below the base fee
+	NoBaseFee bool
+
+	// Signature the transaction carries, zero for messages that are not signed
+	SigAlg        crypto.SignatureAlgorithm
+	SignatureSize int
+	PublicKeySize int
+
+	// Gas for the policy keys and signatures of a multisig sender
+	MultisigGas uint64
+
+	// Account paying for gas instead of the sender, and the signature it carries
+	FeePayer              *types.Address
+	FeePayerSigAlg        crypto.SignatureAlgorithm
+	FeePayerSignatureSize int
+	FeePayerPublicKeySize int
+
+	// New key of a key rotation message, bound to the sender
+	NewSigAlg    crypto.SignatureAlgorithm
+	NewPublicKey []byte
+
+	// Unjail messages return their sender to the validator set, which the
+	// consensus engine does once the block is committed
+	Unjail bool
+
+	// Calls of a batch message, executed in order instead of To and Data
+	Calls     []*types.BatchCall
+	BatchMode types.BatchMode
+
+	// Encrypted messages carry the key shares of their payload key and
+	// execute their decrypted payload, DecryptErr is set while the payload
+	// is not available
+	Encrypted  bool
+	KeyShares  int
+	DecryptErr error
+}
+
+// IsBatch returns true if the message executes a list of calls
+func (msg *Message) IsBatch() bool {
+	return msg.Calls != nil
+}
+
+// IsKeyRotation returns true if the message binds a new key to its sender
+func (msg *Message) IsKeyRotation() bool {
+	return msg.NewPublicKey != nil
+}
+
+// IntrinsicGas returns the gas charged for the message before execution
+func (msg *Message) IntrinsicGas() uint64 {
+	if msg.SigAlg == 0 && msg.MultisigGas == 0 {
+		return TxBaseGas
+	}
+	gas := TxBaseGas + msg.MultisigGas
+	if msg.SigAlg != 0 {
+		gas += SignatureGas(msg.SigAlg, msg.SignatureSize, msg.PublicKeySize)
+	}
+	if msg.FeePayer != nil {
+		gas += SignatureGas(msg.FeePayerSigAlg, msg.FeePayerSignatureSize, msg.FeePayerPublicKeySize)
+	}
+	if msg.Encrypted {
+		gas += EncryptionGas(msg.KeyShares)
+	}
+	return gas
+}
+
+// GasPayer returns the account charged for the gas of the message
+func (msg *Message) GasPayer() types.Address {
+	if msg.FeePayer != nil {
+		return *msg.FeePayer
+	}
+	return msg.From
+}
+
+// TransactionToMessage converts a signed transaction into a message
+func TransactionToMessage(tx *types.QuantumTransaction) *Message {
+	msg := &Message{
+		From:      tx.From(),
+		To:        tx.GetTo(),
+		Nonce:     tx.GetNonce(),
+		Value:     tx.GetValue(),
+		Gas:       tx.GetGas(),
+		GasPrice:  tx.GetGasPrice(),
+		GasFeeCap: tx.GetGasFeeCap(),
+		GasTipCap: tx.GetGasTipCap(),
+		Data:      tx.GetData(),
+
+		SigAlg:        tx.SigAlg,
+		SignatureSize: len(tx.Signature),
+		PublicKeySize: len(tx.PublicKey),
+	}
+	if tx.IsBatch() {
+		msg.Calls = tx.Calls
+		msg.BatchMode = tx.BatchMode
+	}
+	if tx.IsKeyRotation() {
+		msg.NewSigAlg = tx.NewSigAlg
+		msg.NewPublicKey = tx.NewPublicKey
+	}
+	if tx.IsUnjail() {
+		msg.Unjail = true
+	}
+	if tx.IsEncrypted() {
+		msg.Encrypted = true
+		msg.KeyShares = len(tx.KeyShares)
+		msg.DecryptErr = types.ErrUndecryptable
+	}
+	if tx.IsMultisig() {
+		msg.MultisigGas = MultisigGas(tx.Multisig, tx.MultisigSignatures)
+	}
+	if tx.IsSponsored() {
+		msg.FeePayer = tx.FeePayer
+		msg.FeePayerSigAlg = tx.FeePayerSigAlg
+		msg.FeePayerSignatureSize = len(tx.FeePayerSignature)
+		msg.FeePayerPublicKeySize = len(tx.FeePayerPublicKey)
+	}
+	return msg
+}
+
+// EncodeRevertReason ABI encodes a revert reason as Error(string)
+func EncodeRevertReason(reason string) []byte {
+	length := len(reason)
+	padded := (length + 31) / 32 * 32
+
+	data := make([]byte, 4+32+32+padded)
+	copy(data, revertSelector)
+	new(big.Int).SetUint64(32).FillBytes(data[4:36])
+	new(big.Int).SetUint64(uint64(length)).FillBytes(data[36:68])
+	copy(data[68:], reason)
+	return data
+}
+
+// DecodeRevertReason extracts the reason from ABI encoded Error(string) data
+func DecodeRevertReason(data []byte) (string, bool) {
+	if len(data) < 68 || string(data[:4]) != string(revertSelector) {
+		return "", false
+	}
+	length := new(big.Int).SetBytes(data[36:68])
+	if !length.IsUint64() || uint64(len(data)-68) < length.Uint64() {
+		return "", false
+	}
+	return string(data[68 : 68+length.Uint64()]), true
+}
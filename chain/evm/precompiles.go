@@ -5,6 +5,7 @@ import (
 	"math/big"
 
 	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/types"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/vm"
@@ -42,6 +43,19 @@ const (
 	MaxCongestionMultiplier = 150 // Max 1.5x during congestion (150/100)
 )
 
+// SignatureVerificationGas returns the gas needed to verify a signature of the
+// given algorithm, priced the same as the matching verification precompile
+func SignatureVerificationGas(alg crypto.SignatureAlgorithm) uint64 {
+	switch alg {
+	case crypto.SigAlgFalcon:
+		return FalconVerifyGas
+	case crypto.SigAlgSPHINCS:
+		return SPHINCSVerifyGas
+	default:
+		return DilithiumVerifyGas
+	}
+}
+
 // QuantumPrecompiles returns the quantum-resistant precompiled contracts - now with optimized versions
 func QuantumPrecompiles() map[common.Address]vm.PrecompiledContract {
 	return map[common.Address]vm.PrecompiledContract{
@@ -56,6 +70,30 @@ func QuantumPrecompiles() map[common.Address]vm.PrecompiledContract {
 	}
 }
 
+// PrecompileInfo describes a quantum precompile for tracing and diagnostics
+type PrecompileInfo struct {
+	Name      string `json:"name"`
+	Algorithm string `json:"algorithm,omitempty"`
+}
+
+// quantumPrecompileInfo maps precompile addresses to their descriptions
+var quantumPrecompileInfo = map[common.Address]PrecompileInfo{
+	DilithiumVerifyAddress:  {Name: "DilithiumVerify", Algorithm: "dilithium"},
+	FalconVerifyAddress:     {Name: "FalconVerify", Algorithm: "falcon"},
+	KyberDecapsAddress:      {Name: "KyberDecaps", Algorithm: "kyber"},
+	SPHINCSVerifyAddress:    {Name: "SPHINCSVerify", Algorithm: "sphincs"},
+	AggregatedVerifyAddress: {Name: "AggregatedVerify", Algorithm: "aggregated"},
+	BatchVerifyAddress:      {Name: "BatchVerify", Algorithm: "batch"},
+	CompressedVerifyAddress: {Name: "CompressedVerify", Algorithm: "compressed"},
+	QuantumRandomAddress:    {Name: "QuantumRandom"},
+}
+
+// LookupPrecompile returns the description of the quantum precompile at addr
+func LookupPrecompile(addr types.Address) (PrecompileInfo, bool) {
+	info, ok := quantumPrecompileInfo[common.BytesToAddress(addr.Bytes())]
+	return info, ok
+}
+
 // DilithiumVerify precompiled contract
 type DilithiumVerify struct{}
 
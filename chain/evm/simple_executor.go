@@ -2,18 +2,21 @@ package evm
 
 import (
 	"errors"
+	"fmt"
 	"math/big"
 
 	"quantum-blockchain/chain/types"
 
 	"github.com/ethereum/go-ethereum/common"
 	etypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
 )
 
 // SimpleEVM represents a simplified EVM implementation for smart contracts
 type SimpleEVM struct {
 	stateDB StateInterface
 	chainID *big.Int
+	tracer  Tracer
 }
 
 // StateInterface defines the interface for state management
@@ -37,6 +40,7 @@ type ExecutionResult struct {
 	Err             error
 	ContractAddress *types.Address
 	Logs            []*etypes.Log
+	CallResults     []*CallResult // Outcome of every executed call of a batch
 }
 
 // ContractLog represents an event log from contract execution
@@ -54,37 +58,70 @@ func NewSimpleEVM(stateDB StateInterface, chainID *big.Int) *SimpleEVM {
 	}
 }
 
+// SetTracer attaches a tracer that receives execution events, nil disables tracing
+func (evm *SimpleEVM) SetTracer(tracer Tracer) {
+	evm.tracer = tracer
+}
+
+// Tracer returns the attached tracer, if any
+func (evm *SimpleEVM) Tracer() Tracer {
+	return evm.tracer
+}
+
 // ExecuteTransaction executes a quantum transaction using simplified EVM
 func (evm *SimpleEVM) ExecuteTransaction(
 	tx *types.QuantumTransaction,
 	block *types.Block,
 	gasLimit uint64,
 ) (*ExecutionResult, error) {
-	from := tx.From()
+	return evm.ExecuteMessage(TransactionToMessage(tx), block, gasLimit)
+}
 
-	if tx.IsContractCreation() {
-		return evm.executeContractCreation(tx, from, gasLimit)
-	} else if tx.GetTo() != nil {
-		return evm.executeContractCall(tx, from, *tx.GetTo(), gasLimit)
-	} else {
-		return nil, errors.New("invalid transaction: no recipient")
+// ExecuteMessage executes a message, which need not carry a signature.
+// Execution is bounded by gasLimit, which callers set to the gas the message
+// pays for. The caller debits the gas cost and advances the sender nonce
+// beforehand, value is moved here and only here.
+func (evm *SimpleEVM) ExecuteMessage(
+	msg *Message,
+	block *types.Block,
+	gasLimit uint64,
+) (*ExecutionResult, error) {
+	if msg.DecryptErr != nil {
+		return evm.executeUndecryptable(msg, gasLimit)
 	}
+	if msg.IsBatch() {
+		return evm.executeBatch(msg, gasLimit)
+	}
+	if msg.IsKeyRotation() {
+		return evm.executeKeyRotation(msg, block, gasLimit)
+	}
+	if msg.Unjail {
+		return evm.executeUnjail(msg, gasLimit)
+	}
+	if msg.To == nil {
+		return evm.executeContractCreation(msg, msg.IntrinsicGas(), gasLimit)
+	}
+	return evm.executeContractCall(msg, *msg.To, msg.IntrinsicGas(), gasLimit)
 }
 
+// executeContractCreation deploys msg.Data at the address derived from the
+// sender and msg.Nonce, the nonce the transaction was signed with
 func (evm *SimpleEVM) executeContractCreation(
-	tx *types.QuantumTransaction,
-	from types.Address,
+	msg *Message,
+	intrinsicGas uint64,
 	gasLimit uint64,
 ) (*ExecutionResult, error) {
-	// Calculate contract address using deterministic Ethereum-compatible method
-	nonce := evm.stateDB.GetNonce(from)
-	contractAddr := types.CreateContractAddress(from, nonce)
+	from := msg.From
+
+	// Calculate contract address from the message nonce, the transaction
+	// processor has already advanced the sender's account nonce
+	contractAddr := types.CreateContractAddress(from, msg.Nonce)
 
 	// Enhanced gas calculation for quantum-resistant contract creation
-	gasUsed := uint64(21000) // Base transaction cost
+	gasUsed := intrinsicGas // Base cost plus signature bytes and verification
 
 	// Data cost: 4 gas per zero byte, 16 gas per non-zero byte (EIP-2028)
-	for _, b := range tx.GetData() {
+	for _, b := range msg.Data {
 		if b == 0 {
 			gasUsed += 4
 		} else {
@@ -93,10 +130,7 @@ func (evm *SimpleEVM) executeContractCreation(
 	}
 
 	// Code storage cost: 200 gas per byte stored
-	gasUsed += uint64(200) * uint64(len(tx.GetData()))
-
-	// Quantum signature verification cost (already paid during validation)
-	// No additional cost here since signature was verified in transaction pool
+	gasUsed += uint64(200) * uint64(len(msg.Data))
 
 	// Additional cost for quantum-resistant contract initialization
 	gasUsed += uint64(5000) // Quantum contract setup overhead
@@ -104,14 +138,14 @@ func (evm *SimpleEVM) executeContractCreation(
 	if gasUsed > gasLimit {
 		return &ExecutionResult{
 			GasUsed: gasLimit,
-			Err:     errors.New("out of gas during contract creation"),
+			Err:     ErrOutOfGas,
 		}, nil
 	}
 
 	// Check if sender has sufficient balance for value transfer
-	if tx.GetValue().Sign() > 0 {
+	if msg.Value.Sign() > 0 {
 		fromBalance := evm.stateDB.GetBalance(from)
-		if fromBalance.Cmp(tx.GetValue()) < 0 {
+		if fromBalance.Cmp(msg.Value) < 0 {
 			return &ExecutionResult{
 				GasUsed: gasUsed,
 				Err:     errors.New("insufficient balance for contract creation"),
@@ -127,11 +161,20 @@ func (evm *SimpleEVM) executeContractCreation(
 		}, nil
 	}
 
-	// Increment sender nonce BEFORE storing contract code
-	evm.stateDB.SetNonce(from, nonce+1)
+	// Execute contract constructor and check for quantum precompile calls.
+	// The constructor does not touch state, so gas is checked before any writes.
+	logs, constructorGas := evm.executeContractConstructor(msg.Data, contractAddr, from, gasLimit-gasUsed)
+	gasUsed += constructorGas
+
+	if gasUsed > gasLimit {
+		return &ExecutionResult{
+			GasUsed: gasLimit,
+			Err:     ErrOutOfGas,
+		}, nil
+	}
 
 	// Store the contract code and mark contract as created
-	evm.stateDB.SetCode(contractAddr, tx.GetData())
+	evm.stateDB.SetCode(contractAddr, msg.Data)
 
 	// Initialize contract with zero balance if it doesn't exist
 	if !evm.stateDB.Exist(contractAddr) {
@@ -139,29 +182,17 @@ func (evm *SimpleEVM) executeContractCreation(
 	}
 
 	// Transfer value if any
-	if tx.GetValue().Sign() > 0 {
+	if msg.Value.Sign() > 0 {
 		fromBalance := evm.stateDB.GetBalance(from)
 		contractBalance := evm.stateDB.GetBalance(contractAddr)
 
-		fromBalance.Sub(fromBalance, tx.GetValue())
-		contractBalance.Add(contractBalance, tx.GetValue())
+		fromBalance.Sub(fromBalance, msg.Value)
+		contractBalance.Add(contractBalance, msg.Value)
 
 		evm.stateDB.SetBalance(from, fromBalance)
 		evm.stateDB.SetBalance(contractAddr, contractBalance)
 	}
 
-	// Execute contract constructor and check for quantum precompile calls
-	logs, constructorGas := evm.executeContractConstructor(tx.GetData(), contractAddr, from)
-	gasUsed += constructorGas
-
-	// Final gas check
-	if gasUsed > gasLimit {
-		return &ExecutionResult{
-			GasUsed: gasLimit,
-			Err:     errors.New("out of gas during constructor execution"),
-		}, nil
-	}
-
 	return &ExecutionResult{
 		ReturnData:      contractAddr.Bytes(),
 		GasUsed:         gasUsed,
@@ -170,56 +201,80 @@ func (evm *SimpleEVM) executeContractCreation(
 	}, nil
 }
 
+// executeContractCall calls to, running the quantum precompile when to is one.
+// Precompile failures are execution errors, so the receipt reports status 0.
 func (evm *SimpleEVM) executeContractCall(
-	tx *types.QuantumTransaction,
-	from types.Address,
+	msg *Message,
 	to types.Address,
+	intrinsicGas uint64,
 	gasLimit uint64,
 ) (*ExecutionResult, error) {
+	from := msg.From
+
 	// Check if target is a contract
 	code := evm.stateDB.GetCode(to)
 
 	// Basic gas calculation
-	gasUsed := uint64(21000) // Base transaction cost
+	gasUsed := intrinsicGas // Base cost plus signature bytes and verification
 	if len(code) > 0 {
-		gasUsed += uint64(len(tx.GetData())) * 4 // Data cost for contract call
+		gasUsed += uint64(len(msg.Data)) * 4 // Data cost for contract call
+		gasUsed += uint64(len(code)) / 10    // Simplified contract execution cost
 	}
 
 	if gasUsed > gasLimit {
 		return &ExecutionResult{
 			GasUsed: gasLimit,
-			Err:     errors.New("out of gas"),
+			Err:     ErrOutOfGas,
 		}, nil
 	}
 
+	// Direct calls to quantum precompiles run the precompiled contract before any value moves
+	var returnData []byte
+	if precompile, ok := QuantumPrecompiles()[common.BytesToAddress(to.Bytes())]; ok {
+		output, precompileGas, err := evm.runPrecompile(precompile, from, to, msg.Data, gasLimit-gasUsed, msg.Value)
+		gasUsed += precompileGas
+		if err == vm.ErrOutOfGas {
+			return &ExecutionResult{
+				GasUsed: gasLimit,
+				Err:     ErrOutOfGas,
+			}, nil
+		}
+		if err != nil {
+			info, _ := LookupPrecompile(to)
+			reason := fmt.Sprintf("%s: %v", info.Name, err)
+			return &ExecutionResult{
+				ReturnData: EncodeRevertReason(reason),
+				GasUsed:    gasUsed,
+				Err:        fmt.Errorf("%w: %s", ErrExecutionReverted, reason),
+			}, nil
+		}
+		returnData = output
+	}
+
 	// Transfer value if any
-	if tx.GetValue().Sign() > 0 {
+	if msg.Value.Sign() > 0 {
 		fromBalance := evm.stateDB.GetBalance(from)
 		toBalance := evm.stateDB.GetBalance(to)
 
-		if fromBalance.Cmp(tx.GetValue()) < 0 {
+		if fromBalance.Cmp(msg.Value) < 0 {
 			return &ExecutionResult{
 				GasUsed: gasUsed,
 				Err:     errors.New("insufficient balance"),
 			}, nil
 		}
 
-		fromBalance.Sub(fromBalance, tx.GetValue())
-		toBalance.Add(toBalance, tx.GetValue())
+		fromBalance.Sub(fromBalance, msg.Value)
+		toBalance.Add(toBalance, msg.Value)
 
 		evm.stateDB.SetBalance(from, fromBalance)
 		evm.stateDB.SetBalance(to, toBalance)
 	}
 
-	var returnData []byte
 	var logs []*etypes.Log
 
 	if len(code) > 0 {
 		// Execute contract code (simplified)
-		returnData, logs = evm.executeContract(tx.GetData(), to, from)
-
-		// Additional gas for contract execution
-		gasUsed += uint64(len(code)) / 10 // Simplified gas calculation
+		returnData, logs = evm.executeContract(code, msg.Data, to, from, gasLimit-gasUsed+uint64(len(code))/10)
 	}
 
 	return &ExecutionResult{
@@ -230,15 +285,20 @@ func (evm *SimpleEVM) executeContractCall(
 }
 
 func (evm *SimpleEVM) executeContract(
+	code []byte,
 	input []byte,
 	contract types.Address,
 	caller types.Address,
+	gas uint64,
 ) ([]byte, []*etypes.Log) {
 	// Simplified contract execution
 	// In a real implementation, this would parse and execute EVM bytecode
 
 	var logs []*etypes.Log
 
+	// Execution is charged at one gas per ten bytes of code
+	evm.traceCode(code, gas, func(n int) uint64 { return uint64(n) / 10 })
+
 	// Check for quantum precompile calls
 	quantumLogs := evm.executeQuantumPrecompiles(input, contract)
 	logs = append(logs, quantumLogs...)
@@ -251,10 +311,14 @@ func (evm *SimpleEVM) executeContractConstructor(
 	code []byte,
 	contract types.Address,
 	from types.Address,
+	gas uint64,
 ) ([]*etypes.Log, uint64) {
 	var logs []*etypes.Log
 	gasUsed := uint64(0)
 
+	// Constructor code is charged at two gas per byte
+	evm.traceCode(code, gas, func(n int) uint64 { return uint64(n) * 2 })
+
 	// Constructor execution gas - simplified model
 	gasUsed += uint64(len(code)) * 2 // Gas for processing constructor code
 
@@ -268,6 +332,69 @@ func (evm *SimpleEVM) executeContractConstructor(
 	return logs, gasUsed
 }
 
+// runPrecompile executes a quantum precompile, reporting it to the tracer as a nested call
+func (evm *SimpleEVM) runPrecompile(
+	precompile vm.PrecompiledContract,
+	caller types.Address,
+	addr types.Address,
+	input []byte,
+	gas uint64,
+	value *big.Int,
+) ([]byte, uint64, error) {
+	if evm.tracer != nil {
+		evm.tracer.CaptureEnter(vm.CALL, caller, addr, input, gas, value)
+	}
+
+	var (
+		output []byte
+		err    error
+	)
+	gasUsed := precompile.RequiredGas(input)
+	if gasUsed > gas {
+		gasUsed = gas
+		err = vm.ErrOutOfGas
+	} else {
+		output, err = precompile.Run(input)
+	}
+
+	if evm.tracer != nil {
+		evm.tracer.CaptureExit(output, gasUsed, err)
+	}
+
+	return output, gasUsed, err
+}
+
+// traceCode reports each instruction of code to the tracer in the order the
+// simplified executor walks it. meter returns the gas charged for the first n
+// bytes so that per-instruction costs add up to the executor's total charge.
+func (evm *SimpleEVM) traceCode(code []byte, gas uint64, meter func(n int) uint64) {
+	if evm.tracer == nil {
+		return
+	}
+
+	var charged uint64
+	for pc := 0; pc < len(code); {
+		op := vm.OpCode(code[pc])
+		next := pc + 1
+		if op.IsPush() {
+			next += int(op - vm.PUSH0)
+		}
+		if next > len(code) {
+			next = len(code)
+		}
+
+		cost := meter(next) - charged
+		remaining := uint64(0)
+		if gas > charged {
+			remaining = gas - charged
+		}
+		evm.tracer.CaptureState(uint64(pc), op, remaining, cost, 1, nil)
+
+		charged += cost
+		pc = next
+	}
+}
+
 func (evm *SimpleEVM) executeQuantumPrecompiles(
 	input []byte,
 	contract types.Address,
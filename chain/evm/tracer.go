@@ -0,0 +1,132 @@
+package evm
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"quantum-blockchain/chain/types"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// TraceEnv describes the environment a traced transaction executes in
+type TraceEnv struct {
+	State       StateInterface
+	Coinbase    types.Address
+	BlockNumber *big.Int
+}
+
+// Tracer receives execution events from the SimpleEVM and the transaction processor
+type Tracer interface {
+	// CaptureStart is called before the sender is charged for the transaction
+	CaptureStart(env *TraceEnv, from, to types.Address, create bool, input []byte, gas uint64, value *big.Int)
+	// CaptureEnd is called once the transaction has been fully processed
+	CaptureEnd(output []byte, gasUsed uint64, err error)
+	// CaptureEnter is called when execution enters a nested call frame
+	CaptureEnter(typ vm.OpCode, from, to types.Address, input []byte, gas uint64, value *big.Int)
+	// CaptureExit is called when a nested call frame returns
+	CaptureExit(output []byte, gasUsed uint64, err error)
+	// CaptureState is called for every instruction walked by the executor
+	CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, depth int, err error)
+}
+
+// TraceResultProvider is implemented by tracers that produce a JSON result
+type TraceResultProvider interface {
+	Tracer
+	GetResult() (json.RawMessage, error)
+}
+
+// Names of the built-in tracers
+const (
+	StructLoggerName   = "structLogger"
+	CallTracerName     = "callTracer"
+	PrestateTracerName = "prestateTracer"
+)
+
+// NewTracer creates a built-in tracer by name, an empty name selects the struct logger
+func NewTracer(name string) (TraceResultProvider, error) {
+	switch name {
+	case "", StructLoggerName:
+		return NewStructLogger(), nil
+	case CallTracerName:
+		return NewCallTracer(), nil
+	case PrestateTracerName:
+		return NewPrestateTracer(), nil
+	default:
+		return nil, fmt.Errorf("unknown tracer: %s", name)
+	}
+}
+
+// StructLog is a single instruction recorded by the struct logger
+type StructLog struct {
+	Pc         uint64          `json:"pc"`
+	Op         string          `json:"op"`
+	Gas        uint64          `json:"gas"`
+	GasCost    uint64          `json:"gasCost"`
+	Depth      int             `json:"depth"`
+	Error      string          `json:"error,omitempty"`
+	Precompile *PrecompileInfo `json:"precompile,omitempty"`
+}
+
+// StructLogger records every instruction walked by the executor
+type StructLogger struct {
+	logs    []StructLog
+	gas     uint64
+	gasUsed uint64
+	output  []byte
+	err     error
+}
+
+// NewStructLogger creates a new struct/opcode logger
+func NewStructLogger() *StructLogger {
+	return &StructLogger{}
+}
+
+func (l *StructLogger) CaptureStart(env *TraceEnv, from, to types.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	l.gas = gas
+}
+
+func (l *StructLogger) CaptureEnd(output []byte, gasUsed uint64, err error) {
+	l.output = output
+	l.gasUsed = gasUsed
+	l.err = err
+}
+
+func (l *StructLogger) CaptureEnter(typ vm.OpCode, from, to types.Address, input []byte, gas uint64, value *big.Int) {
+	// Precompile calls have no instructions of their own, record the call itself
+	entry := StructLog{Op: typ.String(), Gas: gas, Depth: 1}
+	if info, ok := LookupPrecompile(to); ok {
+		entry.Precompile = &info
+	}
+	l.logs = append(l.logs, entry)
+}
+
+func (l *StructLogger) CaptureExit(output []byte, gasUsed uint64, err error) {
+	if len(l.logs) == 0 {
+		return
+	}
+	last := &l.logs[len(l.logs)-1]
+	last.GasCost = gasUsed
+	if err != nil {
+		last.Error = err.Error()
+	}
+}
+
+func (l *StructLogger) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, depth int, err error) {
+	entry := StructLog{Pc: pc, Op: op.String(), Gas: gas, GasCost: cost, Depth: depth}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	l.logs = append(l.logs, entry)
+}
+
+// GetResult returns the recorded instructions in the geth struct logger format
+func (l *StructLogger) GetResult() (json.RawMessage, error) {
+	return json.Marshal(map[string]interface{}{
+		"gas":         l.gasUsed,
+		"failed":      l.err != nil,
+		"returnValue": fmt.Sprintf("%x", l.output),
+		"structLogs":  l.logs,
+	})
+}
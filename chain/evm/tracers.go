@@ -0,0 +1,186 @@
+package evm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"quantum-blockchain/chain/types"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// CallFrame is a single call in the call tracer output
+type CallFrame struct {
+	Type       string          `json:"type"`
+	From       string          `json:"from"`
+	To         string          `json:"to"`
+	Value      string          `json:"value,omitempty"`
+	Gas        string          `json:"gas"`
+	GasUsed    string          `json:"gasUsed"`
+	Input      string          `json:"input"`
+	Output     string          `json:"output,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Precompile *PrecompileInfo `json:"precompile,omitempty"`
+	Calls      []*CallFrame    `json:"calls,omitempty"`
+}
+
+// CallTracer records the nested call tree of a transaction
+type CallTracer struct {
+	root   *CallFrame
+	stack  []*CallFrame
+	create bool
+}
+
+// NewCallTracer creates a new call tracer
+func NewCallTracer() *CallTracer {
+	return &CallTracer{}
+}
+
+func newCallFrame(typ vm.OpCode, from, to types.Address, input []byte, gas uint64, value *big.Int) *CallFrame {
+	frame := &CallFrame{
+		Type:  typ.String(),
+		From:  from.Hex(),
+		To:    to.Hex(),
+		Gas:   fmt.Sprintf("0x%x", gas),
+		Input: fmt.Sprintf("0x%x", input),
+	}
+	if value != nil {
+		frame.Value = fmt.Sprintf("0x%x", value)
+	}
+	if info, ok := LookupPrecompile(to); ok {
+		frame.Precompile = &info
+	}
+	return frame
+}
+
+func (t *CallTracer) CaptureStart(env *TraceEnv, from, to types.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	typ := vm.CALL
+	if create {
+		typ = vm.CREATE
+	}
+	t.create = create
+	t.root = newCallFrame(typ, from, to, input, gas, value)
+	t.stack = []*CallFrame{t.root}
+}
+
+func (t *CallTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {
+	if t.root == nil {
+		return
+	}
+	// Contract creation returns the address of the new contract
+	if t.create && err == nil && len(output) == len(types.Address{}) {
+		t.root.To = types.BytesToAddress(output).Hex()
+	} else if len(output) > 0 {
+		t.root.Output = fmt.Sprintf("0x%x", output)
+	}
+	t.root.GasUsed = fmt.Sprintf("0x%x", gasUsed)
+	if err != nil {
+		t.root.Error = err.Error()
+	}
+}
+
+func (t *CallTracer) CaptureEnter(typ vm.OpCode, from, to types.Address, input []byte, gas uint64, value *big.Int) {
+	if len(t.stack) == 0 {
+		return
+	}
+	frame := newCallFrame(typ, from, to, input, gas, value)
+	parent := t.stack[len(t.stack)-1]
+	parent.Calls = append(parent.Calls, frame)
+	t.stack = append(t.stack, frame)
+}
+
+func (t *CallTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	if len(t.stack) <= 1 {
+		return
+	}
+	frame := t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+
+	frame.GasUsed = fmt.Sprintf("0x%x", gasUsed)
+	if len(output) > 0 {
+		frame.Output = fmt.Sprintf("0x%x", output)
+	}
+	if err != nil {
+		frame.Error = err.Error()
+	}
+}
+
+func (t *CallTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, depth int, err error) {}
+
+// GetResult returns the root call frame
+func (t *CallTracer) GetResult() (json.RawMessage, error) {
+	if t.root == nil {
+		return nil, errors.New("no transaction traced")
+	}
+	return json.Marshal(t.root)
+}
+
+// PrestateAccount is the state of an account before the traced transaction
+type PrestateAccount struct {
+	Balance string `json:"balance"`
+	Nonce   uint64 `json:"nonce"`
+	Code    string `json:"code,omitempty"`
+}
+
+// PrestateTracer records the state of every account touched by a transaction
+// as it was before the transaction executed
+type PrestateTracer struct {
+	env      *TraceEnv
+	prestate map[string]*PrestateAccount
+}
+
+// NewPrestateTracer creates a new prestate tracer
+func NewPrestateTracer() *PrestateTracer {
+	return &PrestateTracer{
+		prestate: make(map[string]*PrestateAccount),
+	}
+}
+
+// lookupAccount records the current state of addr if it has not been seen yet
+func (t *PrestateTracer) lookupAccount(addr types.Address) {
+	if t.env == nil || t.env.State == nil {
+		return
+	}
+	if _, seen := t.prestate[addr.Hex()]; seen {
+		return
+	}
+	if _, isPrecompile := LookupPrecompile(addr); isPrecompile {
+		return
+	}
+
+	account := &PrestateAccount{
+		Balance: fmt.Sprintf("0x%x", t.env.State.GetBalance(addr)),
+		Nonce:   t.env.State.GetNonce(addr),
+	}
+	if code := t.env.State.GetCode(addr); len(code) > 0 {
+		account.Code = fmt.Sprintf("0x%x", code)
+	}
+	t.prestate[addr.Hex()] = account
+}
+
+func (t *PrestateTracer) CaptureStart(env *TraceEnv, from, to types.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.env = env
+	t.lookupAccount(from)
+	if !create {
+		t.lookupAccount(to)
+	}
+	t.lookupAccount(env.Coinbase)
+}
+
+func (t *PrestateTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {}
+
+func (t *PrestateTracer) CaptureEnter(typ vm.OpCode, from, to types.Address, input []byte, gas uint64, value *big.Int) {
+	t.lookupAccount(to)
+}
+
+func (t *PrestateTracer) CaptureExit(output []byte, gasUsed uint64, err error) {}
+
+func (t *PrestateTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, depth int, err error) {
+}
+
+// GetResult returns the recorded prestate keyed by address
+func (t *PrestateTracer) GetResult() (json.RawMessage, error) {
+	return json.Marshal(t.prestate)
+}
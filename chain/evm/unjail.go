@@ -0,0 +1,17 @@
+package evm
+
+// UnjailGas is the flat cost of an unjail message on top of the intrinsic gas
+const UnjailGas = uint64(10000)
+
+// executeUnjail charges the gas of an unjail message. Returning the sender to
+// the validator set is up to the consensus engine, which knows its jail term.
+func (evm *SimpleEVM) executeUnjail(msg *Message, gasLimit uint64) (*ExecutionResult, error) {
+	gasUsed := msg.IntrinsicGas() + UnjailGas
+	if gasUsed > gasLimit {
+		return &ExecutionResult{
+			GasUsed: gasLimit,
+			Err:     ErrOutOfGas,
+		}, nil
+	}
+	return &ExecutionResult{GasUsed: gasUsed}, nil
+}
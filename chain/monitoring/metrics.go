@@ -50,6 +50,11 @@ type MetricsServer struct {
 	bandwidthUsage   *prometheus.CounterVec
 	connectionErrors prometheus.Counter
 
+	// Discovery metrics
+	discoveryTableNodes prometheus.Gauge
+	discoveryKnownNodes prometheus.Gauge
+	discoveryLookups    prometheus.Counter
+
 	// Quantum crypto metrics
 	dilithiumVerifyTime prometheus.Histogram
 	kyberEncryptTime    prometheus.Histogram
@@ -309,6 +314,22 @@ func (ms *MetricsServer) initMetrics() {
 		Help: "Total signature verification failures",
 	}, []string{"algorithm"})
 
+	// Discovery metrics
+	ms.discoveryTableNodes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "quantum_discovery_table_nodes",
+		Help: "Number of nodes in the discovery routing table",
+	})
+
+	ms.discoveryKnownNodes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "quantum_discovery_known_nodes",
+		Help: "Number of nodes in the peer database",
+	})
+
+	ms.discoveryLookups = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "quantum_discovery_lookups_total",
+		Help: "Total number of discovery lookups",
+	})
+
 	// System metrics
 	ms.memoryUsage = prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "quantum_memory_usage_bytes",
@@ -346,6 +367,9 @@ func (ms *MetricsServer) initMetrics() {
 		ms.messageRate,
 		ms.bandwidthUsage,
 		ms.connectionErrors,
+		ms.discoveryTableNodes,
+		ms.discoveryKnownNodes,
+		ms.discoveryLookups,
 		ms.dilithiumVerifyTime,
 		ms.kyberEncryptTime,
 		ms.signatureFailures,
@@ -677,6 +701,17 @@ func (ms *MetricsServer) RecordSlashingEvent() {
 	ms.slashingEvents.Inc()
 }
 
+// SetDiscoveryNodes records the size of the discovery table and peer database
+func (ms *MetricsServer) SetDiscoveryNodes(tableNodes, knownNodes int) {
+	ms.discoveryTableNodes.Set(float64(tableNodes))
+	ms.discoveryKnownNodes.Set(float64(knownNodes))
+}
+
+// RecordDiscoveryLookup records a discovery lookup
+func (ms *MetricsServer) RecordDiscoveryLookup() {
+	ms.discoveryLookups.Inc()
+}
+
 // Helper methods (simplified implementations)
 func (ms *MetricsServer) getCPUUsage() float64 {
 	// Implementation would measure actual CPU usage
@@ -1,14 +1,16 @@
 package network
 
 import (
+	"bytes"
 	"context"
-	"crypto/sha256"
 	"crypto/tls"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"math/big"
-	"math/rand"
 	"net"
 	"net/http"
 	"sync"
@@ -24,6 +26,7 @@ import (
 // EnhancedP2PNetwork provides production-grade P2P networking for validators
 type EnhancedP2PNetwork struct {
 	// Core configuration
+	identity   *NodeIdentity
 	nodeID     string
 	networkID  uint64
 	chainID    *big.Int
@@ -49,16 +52,29 @@ type EnhancedP2PNetwork struct {
 
 	// Security
 	tlsConfig    *tls.Config
-	allowedPeers map[string]bool // Permissioned network option
-	bannedPeers  map[string]time.Time
+	permissioned bool            // Only registered validators and allowed peers may connect
+	allowedPeers map[string]bool // Node IDs admitted to a permissioned network
+	scorer       *PeerScorer
 	rateLimiter  *RateLimiter
+	dialing      map[string]bool // Addresses being dialed
 
 	// Performance
 	networkMetrics *NetworkMetrics
+	metricsMu      sync.Mutex
+	lastCollect    time.Time
+	lastMessages   uint64
+	lastBytes      uint64
 	connectionPool *ConnectionPool
 
 	// Consensus integration
 	consensusEngine *consensus.MultiValidatorConsensus
+	onProposal      func(*types.Block) error
+	onBlock         func(*types.Block) error
+	onTransaction   func(*types.QuantumTransaction) error
+	onEvidence      func(*consensus.Evidence) error
+	onEncryptionKey func(*EncryptionKeyData) error
+	onShares        func(*DecryptionSharesData) error
+	blockSource     func(uint64) *types.Block
 
 	// Control
 	ctx    context.Context
@@ -69,11 +85,12 @@ type EnhancedP2PNetwork struct {
 	// Network status
 	running  bool
 	listener net.Listener
+	server   *http.Server
 
 	// Event handlers
 	onPeerConnect    func(*ValidatorPeer)
 	onPeerDisconnect func(*ValidatorPeer)
-	onConsensusMsg   func(*ConsensusMessage)
+	onConsensusMsg   func(*ConsensusMessage) error
 	onNetworkEvent   func(NetworkEvent)
 }
 
@@ -86,10 +103,15 @@ type ValidatorPeer struct {
 	SigAlgorithm  crypto.SignatureAlgorithm `json:"sigAlgorithm"`
 
 	// Connection
-	Conn        *websocket.Conn `json:"-"`
-	ConnectedAt time.Time       `json:"connectedAt"`
-	LastSeen    time.Time       `json:"lastSeen"`
-	LastPing    time.Time       `json:"lastPing"`
+	Conn        *SecureConn `json:"-"`
+	Protocol    uint32      `json:"protocol"`             // Negotiated protocol version
+	ListenAddr  string      `json:"listenAddr,omitempty"` // Address the peer accepts connections on
+	Inbound     bool        `json:"inbound"`
+	ConnectedAt time.Time   `json:"connectedAt"`
+	LastSeen    time.Time   `json:"lastSeen"`
+	LastPing    time.Time   `json:"lastPing"`
+	pingNonce   uint64
+	syncFrom    uint64 // First block number of the pending block request
 
 	// Performance metrics
 	Latency          time.Duration `json:"latency"`
@@ -107,10 +129,31 @@ type ValidatorPeer struct {
 	FailedAttempts int       `json:"failedAttempts"`
 	LastFailure    time.Time `json:"lastFailure"`
 
+	// Per message type rate limits
+	limiters map[MessageType]*TokenBucket
+
 	// Thread safety
 	mu sync.RWMutex
 }
 
+const (
+	// pingInterval is how often peers are pinged to measure their latency,
+	// and how often lost bootstrap peers are redialed
+	pingInterval = 10 * time.Second
+
+	// peerTimeout is how long a peer may stay silent before it is dropped
+	peerTimeout = 3 * pingInterval
+
+	// metricsInterval is how often message and bandwidth rates are sampled
+	metricsInterval = 10 * time.Second
+
+	// maxValidatorAnnounce bounds the validators a single announcement lists
+	maxValidatorAnnounce = 64
+
+	// maxBlocksPerResponse bounds the blocks served for one block request
+	maxBlocksPerResponse = 64
+)
+
 // MessageType defines enhanced message types for validator networking
 type MessageType uint8
 
@@ -142,6 +185,13 @@ const (
 	MsgNetworkStatus
 	MsgSyncRequest
 	MsgSyncResponse
+
+	// Misbehavior messages, after the others to keep their values
+	MsgEvidence
+
+	// Encrypted mempool messages
+	MsgEncryptionKey
+	MsgDecryptionShares
 )
 
 // MessageHandler defines message handler interface
@@ -231,19 +281,95 @@ type ConsensusMessage struct {
 	Type        consensus.VoteType `json:"type"`
 	BlockHash   types.Hash         `json:"blockHash"`
 	BlockHeight uint64             `json:"blockHeight"`
+	Round       uint64             `json:"round,omitempty"`
 	Validator   types.Address      `json:"validator"`
 	Signature   []byte             `json:"signature"`
 	PublicKey   []byte             `json:"publicKey"`
 	Timestamp   time.Time          `json:"timestamp"`
 	Evidence    []byte             `json:"evidence,omitempty"`
+
+	SigAlgorithm crypto.SignatureAlgorithm `json:"sigAlgorithm"`
+}
+
+// ValidatorEndpoint tells where a validator accepts connections
+type ValidatorEndpoint struct {
+	NodeID    string        `json:"nodeId"`
+	Validator types.Address `json:"validator"`
+	Address   string        `json:"address"`
+}
+
+// ValidatorAnnounceData lists the validators a peer is connected to, so the
+// validators form a full mesh
+type ValidatorAnnounceData struct {
+	Validators []*ValidatorEndpoint `json:"validators"`
+}
+
+// BlockRequestData requests the committed blocks from a number on, lagging
+// validators catch up with it
+type BlockRequestData struct {
+	From uint64 `json:"from"`
+}
+
+// BlockResponseData answers a block request with consecutive blocks
+type BlockResponseData struct {
+	Blocks []*types.Block `json:"blocks"`
+}
+
+// encryptionKeyDomain separates the signatures of encryption keys from others
+var encryptionKeyDomain = []byte("quantum-encryption-key")
+
+// EncryptionKeyData announces the Kyber key a validator receives the key
+// shares of encrypted transactions with in an epoch, signed by the validator
+type EncryptionKeyData struct {
+	Validator types.Address       `json:"validator"`
+	Epoch     uint64              `json:"epoch"`
+	PublicKey []byte              `json:"publicKey"`
+	Signature *crypto.QRSignature `json:"signature"`
+}
+
+// SigningHash returns the hash the validator signs
+func (d *EncryptionKeyData) SigningHash() types.Hash {
+	data := append([]byte{}, encryptionKeyDomain...)
+	data = append(data, d.Validator.Bytes()...)
+	data = binary.BigEndian.AppendUint64(data, d.Epoch)
+	data = append(data, d.PublicKey...)
+	return types.Keccak256Hash(data)
+}
+
+// DecryptionSharesData releases the capsule secrets of the key shares of a
+// validator for the encrypted transactions of a committed block, one per
+// transaction and empty where it holds no share. A secret proves itself by
+// opening its share.
+type DecryptionSharesData struct {
+	Validator   types.Address `json:"validator"`
+	BlockHash   types.Hash    `json:"blockHash"`
+	BlockHeight uint64        `json:"blockHeight"`
+	Secrets     [][]byte      `json:"secrets"`
 }
 
 // NewEnhancedP2PNetwork creates a new enhanced P2P network
 func NewEnhancedP2PNetwork(config *NetworkConfig) *EnhancedP2PNetwork {
 	ctx, cancel := context.WithCancel(context.Background())
 
+	identity := config.Identity
+	if identity == nil {
+		var err error
+		if identity, err = GenerateNodeIdentity(); err != nil {
+			log.Printf("⚠️ Failed to generate node identity, handshakes will fail: %v", err)
+		}
+	}
+	var nodeID string
+	if identity != nil {
+		nodeID = identity.ID()
+	}
+	scorer := config.Scorer
+	if scorer == nil {
+		scorer, _ = NewPeerScorer("")
+	}
+
 	network := &EnhancedP2PNetwork{
-		nodeID:           generateSecureNodeID(),
+		identity:         identity,
+		nodeID:           nodeID,
 		networkID:        config.NetworkID,
 		chainID:          config.ChainID,
 		listenAddr:       config.ListenAddr,
@@ -255,8 +381,10 @@ func NewEnhancedP2PNetwork(config *NetworkConfig) *EnhancedP2PNetwork {
 		peersByAddr:      make(map[types.Address]*ValidatorPeer),
 		messageHandlers:  make(map[MessageType]MessageHandler),
 		messageRateLimit: make(map[MessageType]RateLimit),
+		permissioned:     config.Permissioned,
 		allowedPeers:     make(map[string]bool),
-		bannedPeers:      make(map[string]time.Time),
+		dialing:          make(map[string]bool),
+		scorer:           scorer,
 		ctx:              ctx,
 		cancel:           cancel,
 		networkMetrics: &NetworkMetrics{
@@ -273,6 +401,11 @@ func NewEnhancedP2PNetwork(config *NetworkConfig) *EnhancedP2PNetwork {
 	// Register message handlers
 	network.registerMessageHandlers()
 
+	// Disconnect the peers the scorer bans
+	scorer.OnBan(func(ban *Ban) {
+		network.removePeer(ban.PeerID)
+	})
+
 	return network
 }
 
@@ -288,6 +421,13 @@ type NetworkConfig struct {
 	MinPeerLatency time.Duration `json:"minPeerLatency"`
 	EnableTLS      bool          `json:"enableTLS"`
 	Permissioned   bool          `json:"permissioned"`
+
+	// Identity proven in handshakes, a random one is generated if nil
+	Identity *NodeIdentity `json:"-"`
+
+	// Reputation of peers, possibly shared with another network, kept in
+	// memory if nil
+	Scorer *PeerScorer `json:"-"`
 }
 
 // SetValidator configures this node as a validator
@@ -305,11 +445,65 @@ func (n *EnhancedP2PNetwork) SetValidator(
 	n.isValidator = true
 }
 
-// SetConsensusEngine integrates with consensus engine
+// SetConsensusEngine integrates with consensus engine. Validators are only
+// recognized as such while registered with the engine under the key they
+// prove in the handshake.
 func (n *EnhancedP2PNetwork) SetConsensusEngine(consensus *consensus.MultiValidatorConsensus) {
 	n.consensusEngine = consensus
 }
 
+// SetConsensusHandler sets the handler of votes received from validators, an
+// error wrapping one of the network errors of misbehavior penalizes the peer
+func (n *EnhancedP2PNetwork) SetConsensusHandler(handler func(*ConsensusMessage) error) {
+	n.onConsensusMsg = handler
+}
+
+// SetProposalHandler sets the handler of blocks proposed by validators
+func (n *EnhancedP2PNetwork) SetProposalHandler(handler func(*types.Block) error) {
+	n.onProposal = handler
+}
+
+// SetBlockHandler sets the handler of committed blocks
+func (n *EnhancedP2PNetwork) SetBlockHandler(handler func(*types.Block) error) {
+	n.onBlock = handler
+}
+
+// SetTransactionHandler sets the handler of transactions
+func (n *EnhancedP2PNetwork) SetTransactionHandler(handler func(*types.QuantumTransaction) error) {
+	n.onTransaction = handler
+}
+
+// SetEvidenceHandler sets the handler of evidence of validators signing
+// conflicting blocks or votes
+func (n *EnhancedP2PNetwork) SetEvidenceHandler(handler func(*consensus.Evidence) error) {
+	n.onEvidence = handler
+}
+
+// SetEncryptionKeyHandler sets the handler of the encryption keys validators announce
+func (n *EnhancedP2PNetwork) SetEncryptionKeyHandler(handler func(*EncryptionKeyData) error) {
+	n.onEncryptionKey = handler
+}
+
+// SetDecryptionSharesHandler sets the handler of the key share secrets
+// validators release for committed blocks
+func (n *EnhancedP2PNetwork) SetDecryptionSharesHandler(handler func(*DecryptionSharesData) error) {
+	n.onShares = handler
+}
+
+// SetBlockSource sets the lookup of committed blocks by number served to
+// validators catching up
+func (n *EnhancedP2PNetwork) SetBlockSource(source func(uint64) *types.Block) {
+	n.blockSource = source
+}
+
+// AllowPeer admits a node that is not a validator to a permissioned network
+func (n *EnhancedP2PNetwork) AllowPeer(nodeID string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.allowedPeers[nodeID] = true
+}
+
 // Start starts the enhanced P2P network
 func (n *EnhancedP2PNetwork) Start() error {
 	n.mu.Lock()
@@ -329,6 +523,10 @@ func (n *EnhancedP2PNetwork) Start() error {
 	log.Printf("Enhanced P2P network listening on %s", n.listenAddr)
 
 	// Start connection acceptor
+	n.server = &http.Server{
+		Handler:           http.HandlerFunc(n.serveWebSocket),
+		ReadHeaderTimeout: HandshakeTimeout,
+	}
 	n.wg.Add(1)
 	go n.acceptConnections()
 
@@ -353,33 +551,118 @@ func (n *EnhancedP2PNetwork) Start() error {
 // Stop stops the P2P network
 func (n *EnhancedP2PNetwork) Stop() {
 	n.mu.Lock()
-	defer n.mu.Unlock()
-
 	if !n.running {
+		n.mu.Unlock()
 		return
 	}
 
 	n.cancel()
 
-	if n.listener != nil {
-		n.listener.Close()
+	if n.server != nil {
+		n.server.Close()
 	}
 
 	// Close all peer connections
 	for _, peer := range n.peers {
 		peer.Conn.Close()
 	}
+	n.running = false
+	n.mu.Unlock()
 
+	// Connection goroutines take the lock to unregister their peers
 	n.wg.Wait()
-	n.running = false
 	log.Printf("Enhanced P2P network stopped")
 }
 
 // BroadcastConsensusMessage broadcasts consensus messages to all validator peers
 func (n *EnhancedP2PNetwork) BroadcastConsensusMessage(msg *ConsensusMessage) error {
-	data, err := json.Marshal(msg)
+	p2pMsg, err := n.signedMessage(MsgConsensusVote, msg)
+	if err != nil {
+		return fmt.Errorf("failed to create consensus message: %w", err)
+	}
+	return n.broadcastToValidators(p2pMsg)
+}
+
+// BroadcastProposal sends a block proposed by, or voted for by, this
+// validator to the validator peers
+func (n *EnhancedP2PNetwork) BroadcastProposal(block *types.Block) error {
+	p2pMsg, err := n.signedMessage(MsgConsensusProposal, block)
+	if err != nil {
+		return fmt.Errorf("failed to create proposal: %w", err)
+	}
+	return n.broadcastToValidators(p2pMsg)
+}
+
+// BroadcastBlock sends a committed block to all peers
+func (n *EnhancedP2PNetwork) BroadcastBlock(block *types.Block) error {
+	data, err := json.Marshal(block)
+	if err != nil {
+		return fmt.Errorf("failed to marshal block: %w", err)
+	}
+	msg := &P2PMessage{
+		Type:      MsgBlock,
+		Data:      data,
+		Timestamp: time.Now().Unix(),
+		From:      n.nodeID,
+	}
+
+	for _, peer := range n.Peers() {
+		if err := peer.SendMessage(msg); err != nil {
+			log.Printf("Failed to send block to peer %s: %v", peer.ID, err)
+		}
+	}
+	return nil
+}
+
+// BroadcastEvidence sends evidence of a validator signing conflicting blocks
+// or votes to all peers. Evidence proves itself, any peer may relay it.
+func (n *EnhancedP2PNetwork) BroadcastEvidence(ev *consensus.Evidence) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("failed to marshal evidence: %w", err)
+	}
+	msg := &P2PMessage{
+		Type:      MsgEvidence,
+		Data:      data,
+		Timestamp: time.Now().Unix(),
+		From:      n.nodeID,
+		Priority:  255,
+	}
+
+	for _, peer := range n.Peers() {
+		if err := peer.SendMessage(msg); err != nil {
+			log.Printf("Failed to send evidence to peer %s: %v", peer.ID, err)
+		}
+	}
+	return nil
+}
+
+// BroadcastEncryptionKey announces an encryption key of this validator to
+// the validator peers
+func (n *EnhancedP2PNetwork) BroadcastEncryptionKey(key *EncryptionKeyData) error {
+	p2pMsg, err := n.signedMessage(MsgEncryptionKey, key)
+	if err != nil {
+		return fmt.Errorf("failed to create encryption key message: %w", err)
+	}
+	return n.broadcastToValidators(p2pMsg)
+}
+
+// BroadcastDecryptionShares releases the key share secrets of this validator
+// for a committed block to the validator peers
+func (n *EnhancedP2PNetwork) BroadcastDecryptionShares(shares *DecryptionSharesData) error {
+	p2pMsg, err := n.signedMessage(MsgDecryptionShares, shares)
+	if err != nil {
+		return fmt.Errorf("failed to create decryption shares message: %w", err)
+	}
+	return n.broadcastToValidators(p2pMsg)
+}
+
+// signedMessage wraps data in a message signed by the validator key, which
+// validator peers require for consensus messages
+func (n *EnhancedP2PNetwork) signedMessage(msgType MessageType, v interface{}) (*P2PMessage, error) {
+	data, err := json.Marshal(v)
 	if err != nil {
-		return fmt.Errorf("failed to marshal consensus message: %w", err)
+		return nil, err
 	}
 
 	// Sign message if we're a validator
@@ -390,15 +673,15 @@ func (n *EnhancedP2PNetwork) BroadcastConsensusMessage(msg *ConsensusMessage) er
 	if n.isValidator && n.validatorPrivKey != nil {
 		qrSig, err := crypto.SignMessage(data, n.sigAlgorithm, n.validatorPrivKey)
 		if err != nil {
-			return fmt.Errorf("failed to sign consensus message: %w", err)
+			return nil, fmt.Errorf("failed to sign message: %w", err)
 		}
 		signature = qrSig.Signature
 		publicKey = n.getPublicKey()
 		sigAlg = n.sigAlgorithm
 	}
 
-	p2pMsg := &P2PMessage{
-		Type:         MsgConsensusVote,
+	return &P2PMessage{
+		Type:         msgType,
 		Data:         data,
 		Timestamp:    time.Now().Unix(),
 		From:         n.nodeID,
@@ -406,18 +689,13 @@ func (n *EnhancedP2PNetwork) BroadcastConsensusMessage(msg *ConsensusMessage) er
 		PublicKey:    publicKey,
 		SigAlgorithm: sigAlg,
 		Priority:     255, // Highest priority for consensus
-	}
-
-	return n.broadcastToValidators(p2pMsg)
+	}, nil
 }
 
 // broadcastToValidators broadcasts messages to validator peers only
 func (n *EnhancedP2PNetwork) broadcastToValidators(msg *P2PMessage) error {
-	n.mu.RLock()
-	defer n.mu.RUnlock()
-
 	validatorPeers := make([]*ValidatorPeer, 0)
-	for _, peer := range n.peers {
+	for _, peer := range n.Peers() {
 		if peer.IsValidator {
 			validatorPeers = append(validatorPeers, peer)
 		}
@@ -436,36 +714,85 @@ func (n *EnhancedP2PNetwork) broadcastToValidators(msg *P2PMessage) error {
 	}
 
 	// Collect errors
-	var errors []error
+	failed := 0
 	for i := 0; i < len(validatorPeers); i++ {
 		if err := <-errChan; err != nil {
-			errors = append(errors, err)
+			failed++
 		}
 	}
 
-	if len(errors) == len(validatorPeers) {
+	if failed == len(validatorPeers) {
 		return fmt.Errorf("failed to send to all validator peers")
 	}
 
 	return nil
 }
 
-// SendMessage sends a message to a specific peer
+// SendMessage sends a message to a specific peer. On the framed protocol
+// version the message is sent as a compressed frame of its type, with the
+// nonce as request ID.
 func (peer *ValidatorPeer) SendMessage(msg *P2PMessage) error {
 	peer.mu.Lock()
 	defer peer.mu.Unlock()
 
-	err := peer.Conn.WriteJSON(msg)
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	size := len(data)
+	if peer.Protocol < FramedProtocolVersion {
+		err = peer.Conn.WriteFrame(data)
+	} else {
+		size, err = peer.Conn.WriteMessageFrame(&Frame{
+			Version:   uint8(peer.Protocol),
+			Type:      uint8(msg.Type),
+			RequestID: msg.Nonce,
+			Payload:   data,
+		})
+	}
 	if err != nil {
 		return err
 	}
 
 	peer.MessagesSent++
+	peer.BytesSent += uint64(size)
 	peer.LastSeen = time.Now()
 
 	return nil
 }
 
+// readMessage receives the next message from the peer, returning its size
+// on the wire
+func (peer *ValidatorPeer) readMessage() (*P2PMessage, int, error) {
+	var (
+		data []byte
+		size int
+		err  error
+	)
+	if peer.Protocol < FramedProtocolVersion {
+		data, err = peer.Conn.ReadFrame()
+		size = len(data)
+	} else {
+		var frame *Frame
+		frame, size, err = peer.Conn.ReadMessageFrame()
+		if err == nil && uint32(frame.Version) != peer.Protocol {
+			err = fmt.Errorf("%w: version %d on a version %d session", ErrInvalidFrame, frame.Version, peer.Protocol)
+		}
+		if err == nil {
+			data = frame.Payload
+		}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var msg P2PMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrInvalidFrame, err)
+	}
+	return &msg, size, nil
+}
+
 // configureRateLimits sets up rate limiting for different message types
 func (n *EnhancedP2PNetwork) configureRateLimits() {
 	n.messageRateLimit[MsgConsensusVote] = RateLimit{
@@ -474,6 +801,12 @@ func (n *EnhancedP2PNetwork) configureRateLimits() {
 		BurstLimit:  10,
 	}
 
+	n.messageRateLimit[MsgConsensusProposal] = RateLimit{
+		MaxMessages: 50,
+		TimeWindow:  time.Minute,
+		BurstLimit:  5,
+	}
+
 	n.messageRateLimit[MsgBlock] = RateLimit{
 		MaxMessages: 50,
 		TimeWindow:  time.Minute,
@@ -486,6 +819,30 @@ func (n *EnhancedP2PNetwork) configureRateLimits() {
 		BurstLimit:  100,
 	}
 
+	n.messageRateLimit[MsgBlockRequest] = RateLimit{
+		MaxMessages: 30,
+		TimeWindow:  time.Minute,
+		BurstLimit:  5,
+	}
+
+	n.messageRateLimit[MsgEvidence] = RateLimit{
+		MaxMessages: 20,
+		TimeWindow:  time.Minute,
+		BurstLimit:  5,
+	}
+
+	n.messageRateLimit[MsgEncryptionKey] = RateLimit{
+		MaxMessages: 20,
+		TimeWindow:  time.Minute,
+		BurstLimit:  5,
+	}
+
+	n.messageRateLimit[MsgDecryptionShares] = RateLimit{
+		MaxMessages: 120,
+		TimeWindow:  time.Minute,
+		BurstLimit:  10,
+	}
+
 	// More restrictive for handshake to prevent DoS
 	n.messageRateLimit[MsgHandshake] = RateLimit{
 		MaxMessages: 10,
@@ -500,126 +857,168 @@ func (n *EnhancedP2PNetwork) registerMessageHandlers() {
 	n.messageHandlers[MsgPing] = n.handlePing
 	n.messageHandlers[MsgPong] = n.handlePong
 	n.messageHandlers[MsgConsensusVote] = n.handleConsensusMessage
+	n.messageHandlers[MsgConsensusProposal] = n.handleProposal
 	n.messageHandlers[MsgBlock] = n.handleBlock
 	n.messageHandlers[MsgTransaction] = n.handleTransaction
 	n.messageHandlers[MsgValidatorAnnounce] = n.handleValidatorAnnounce
+	n.messageHandlers[MsgBlockRequest] = n.handleBlockRequest
+	n.messageHandlers[MsgBlockResponse] = n.handleBlockResponse
+	n.messageHandlers[MsgEvidence] = n.handleEvidence
+	n.messageHandlers[MsgEncryptionKey] = n.handleEncryptionKey
+	n.messageHandlers[MsgDecryptionShares] = n.handleDecryptionShares
 }
 
-// acceptConnections accepts incoming connections
+// acceptConnections serves incoming connections until the network stops
 func (n *EnhancedP2PNetwork) acceptConnections() {
 	defer n.wg.Done()
 
-	for {
-		select {
-		case <-n.ctx.Done():
-			return
-		default:
-		}
-
-		conn, err := n.listener.Accept()
-		if err != nil {
-			if n.ctx.Err() != nil {
-				return
-			}
-			log.Printf("Failed to accept connection: %v", err)
-			continue
-		}
-
-		// Check if we have room for more peers
-		n.mu.RLock()
-		peerCount := len(n.peers)
-		n.mu.RUnlock()
+	err := n.server.Serve(n.listener)
+	if err != nil && err != http.ErrServerClosed {
+		log.Printf("Failed to accept connections: %v", err)
+	}
+}
 
-		if peerCount >= n.maxPeers {
-			log.Printf("Max peers reached, rejecting connection")
-			conn.Close()
-			continue
-		}
+// serveWebSocket admits an incoming connection and upgrades it to WebSocket
+func (n *EnhancedP2PNetwork) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	if n.ctx.Err() != nil {
+		http.Error(w, "network is stopped", http.StatusServiceUnavailable)
+		return
+	}
 
-		// Rate limit connections
-		clientAddr := conn.RemoteAddr().String()
-		if !n.rateLimiter.Allow(clientAddr) {
-			log.Printf("Rate limit exceeded for %s", clientAddr)
-			conn.Close()
-			continue
-		}
+	// Check if we have room for more peers
+	n.mu.RLock()
+	peerCount := len(n.peers)
+	n.mu.RUnlock()
 
-		n.wg.Add(1)
-		go n.handleIncomingConnection(conn)
+	if peerCount >= n.maxPeers {
+		log.Printf("Max peers reached, rejecting connection")
+		http.Error(w, "too many peers", http.StatusServiceUnavailable)
+		return
 	}
-}
 
-// handleIncomingConnection handles new incoming connections
-func (n *EnhancedP2PNetwork) handleIncomingConnection(conn net.Conn) {
-	defer n.wg.Done()
-	defer conn.Close()
+	// Rate limit connections
+	clientAddr := r.RemoteAddr
+	if !n.rateLimiter.Allow(clientAddr) {
+		log.Printf("Rate limit exceeded for %s", clientAddr)
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
 
 	// Upgrade to WebSocket with timeout
 	upgrader := websocket.Upgrader{
-		HandshakeTimeout: 10 * time.Second,
+		HandshakeTimeout: HandshakeTimeout,
 	}
 
-	wsConn, err := upgrader.Upgrade(&httpResponseWriter{conn}, nil, nil)
+	wsConn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("Failed to upgrade connection: %v", err)
 		return
 	}
-	defer wsConn.Close()
+	wsConn.SetReadLimit(MaxWireMessageSize)
+
+	n.wg.Add(1)
+	n.handleIncomingConnection(wsConn)
+}
 
-	// Set connection timeouts
-	wsConn.SetReadDeadline(time.Now().Add(30 * time.Second))
-	wsConn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+// handleIncomingConnection authenticates a new incoming connection
+func (n *EnhancedP2PNetwork) handleIncomingConnection(wsConn *websocket.Conn) {
+	defer n.wg.Done()
+	defer wsConn.Close()
 
-	// Handle the connection (simplified for now)
-	peer := &ValidatorPeer{
-		ID:             "peer-" + wsConn.RemoteAddr().String(),
-		Address:        wsConn.RemoteAddr().String(),
-		Conn:           wsConn,
-		ConnectedAt:    time.Now(),
-		LastSeen:       time.Now(),
-		IsValidator:    false,
-		Reputation:     1.0,
-		FailedAttempts: 0,
+	peer, err := n.performHandshake(wsConn, false)
+	if err != nil {
+		log.Printf("Handshake with %s failed: %v", wsConn.RemoteAddr(), err)
+		return
 	}
 
-	n.addPeer(peer)
+	if !n.addPeer(peer) {
+		return
+	}
 	n.handlePeerMessages(peer)
 }
 
 // GetNetworkMetrics returns current network metrics
 func (n *EnhancedP2PNetwork) GetNetworkMetrics() *NetworkMetrics {
-	n.mu.RLock()
-	defer n.mu.RUnlock()
-
-	// Update real-time metrics
-	n.networkMetrics.TotalPeers = len(n.peers)
+	peers := n.Peers()
 
 	validatorCount := 0
 	totalLatency := time.Duration(0)
-	for _, peer := range n.peers {
+	for _, peer := range peers {
+		peer.mu.RLock()
 		if peer.IsValidator {
 			validatorCount++
 		}
 		totalLatency += peer.Latency
+		peer.mu.RUnlock()
 	}
 
+	n.metricsMu.Lock()
+	defer n.metricsMu.Unlock()
+
+	// Update real-time metrics
+	n.networkMetrics.TotalPeers = len(peers)
 	n.networkMetrics.ValidatorPeers = validatorCount
-	if len(n.peers) > 0 {
-		n.networkMetrics.AvgLatency = totalLatency / time.Duration(len(n.peers))
+	if len(peers) > 0 {
+		n.networkMetrics.AvgLatency = totalLatency / time.Duration(len(peers))
 	}
-
 	n.networkMetrics.LastUpdate = time.Now()
 
-	return n.networkMetrics
+	metrics := *n.networkMetrics
+	metrics.MessageStats = make(map[MessageType]*MessageStats, len(n.networkMetrics.MessageStats))
+	for msgType, stats := range n.networkMetrics.MessageStats {
+		copied := *stats
+		metrics.MessageStats[msgType] = &copied
+	}
+	return &metrics
 }
 
-// Helper functions continue...
+// Peers returns the connected peers
+func (n *EnhancedP2PNetwork) Peers() []*ValidatorPeer {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	peers := make([]*ValidatorPeer, 0, len(n.peers))
+	for _, peer := range n.peers {
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+// ValidatorPeer returns the connected peer of a validator
+func (n *EnhancedP2PNetwork) ValidatorPeer(addr types.Address) (*ValidatorPeer, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	peer, ok := n.peersByAddr[addr]
+	return peer, ok
+}
+
+// NodeID returns the ID of the node identity
+func (n *EnhancedP2PNetwork) NodeID() string {
+	return n.nodeID
+}
+
+// ListenAddr returns the address the network accepts connections on
+func (n *EnhancedP2PNetwork) ListenAddr() string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if n.listener != nil {
+		return n.listener.Addr().String()
+	}
+	return n.listenAddr
+}
 
-// generateSecureNodeID generates a secure node ID
-func generateSecureNodeID() string {
-	return fmt.Sprintf("qnode-%d-%x", time.Now().UnixNano(), rand.Uint64())
+// advertisedAddr returns the address peers are told to connect to
+func (n *EnhancedP2PNetwork) advertisedAddr() string {
+	if n.publicAddr != "" {
+		return n.publicAddr
+	}
+	return n.ListenAddr()
 }
 
+// Helper functions continue...
+
 // NewRateLimiter creates a new rate limiter
 func NewRateLimiter() *RateLimiter {
 	rl := &RateLimiter{
@@ -718,99 +1117,138 @@ func min(a, b uint64) uint64 {
 	return b
 }
 
-// performHandshake performs secure authentication handshake with a peer
+// performHandshake establishes an encrypted session with a peer. The node
+// identity is proven by the session, a validator additionally signs the
+// handshake with its validator key to bind its address to the node identity.
 func (n *EnhancedP2PNetwork) performHandshake(conn *websocket.Conn, isOutgoing bool) (*ValidatorPeer, error) {
-	// SECURITY: Implement comprehensive P2P authentication
+	if n.identity == nil {
+		return nil, fmt.Errorf("no node identity")
+	}
 
-	// Step 1: Send handshake request
+	// Step 1: Prepare handshake request
 	handshakeReq := &HandshakeRequest{
-		NodeID:        n.nodeID,
-		NetworkID:     n.networkID,
-		ChainID:       n.chainID.Uint64(),
-		ValidatorAddr: n.validatorAddr,
-		PublicKey:     n.getPublicKey(),
-		SigAlgorithm:  n.sigAlgorithm,
-		Timestamp:     time.Now().Unix(),
-		Version:       "1.0.0",
-		Capabilities:  []string{"consensus", "blocks", "transactions"},
-	}
-
-	// SECURITY: Sign handshake request to prove identity
-	handshakeData := fmt.Sprintf("handshake:%s:%d:%d:%d",
-		n.nodeID, n.networkID, n.chainID.Uint64(), handshakeReq.Timestamp)
-
-	if n.validatorPrivKey != nil {
-		signature, err := crypto.SignMessage([]byte(handshakeData), n.sigAlgorithm, n.validatorPrivKey)
+		NodeID:          n.nodeID,
+		NetworkID:       n.networkID,
+		ChainID:         n.chainIDValue(),
+		Timestamp:       time.Now().Unix(),
+		Version:         "1.0.0",
+		ProtocolVersion: ProtocolVersion,
+		ListenAddr:      n.advertisedAddr(),
+		Capabilities:    []string{"consensus", "blocks", "transactions"},
+	}
+
+	// SECURITY: Sign handshake with the validator key to prove the validator address
+	if n.isValidator && n.validatorPrivKey != nil {
+		signature, err := crypto.SignMessage([]byte(handshakeReq.signingData()), n.sigAlgorithm, n.validatorPrivKey)
 		if err != nil {
 			return nil, fmt.Errorf("failed to sign handshake: %w", err)
 		}
+		handshakeReq.ValidatorAddr = n.validatorAddr
+		handshakeReq.PublicKey = n.getPublicKey()
+		handshakeReq.SigAlgorithm = n.sigAlgorithm
 		handshakeReq.Signature = signature.Signature
 	}
 
-	// Send handshake request
 	handshakeBytes, err := json.Marshal(handshakeReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal handshake: %w", err)
 	}
 
-	message := &P2PMessage{
-		Type:      MsgHandshake,
-		Data:      json.RawMessage(handshakeBytes),
-		Timestamp: time.Now().Unix(),
-		From:      n.nodeID,
-	}
-
-	err = conn.WriteJSON(message)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send handshake: %w", err)
-	}
-
-	// Step 2: Receive and verify handshake response
-	conn.SetReadDeadline(time.Now().Add(15 * time.Second))
-
-	var response P2PMessage
-	err = conn.ReadJSON(&response)
+	// Step 2: Establish the session, exchanging the handshake requests
+	secureConn, err := Handshake(conn, n.identity, isOutgoing, handshakeBytes)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read handshake response: %w", err)
-	}
-
-	if response.Type != MsgHandshake {
-		return nil, fmt.Errorf("expected handshake response, got %d", response.Type)
+		return nil, err
 	}
 
 	var handshakeResp HandshakeRequest
-	err = json.Unmarshal(response.Data, &handshakeResp)
+	err = json.Unmarshal(secureConn.RemotePayload(), &handshakeResp)
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal handshake response: %w", err)
 	}
 
 	// SECURITY: Validate handshake response
-	err = n.validateHandshakeResponse(&handshakeResp)
+	err = n.validateHandshakeResponse(&handshakeResp, secureConn.RemoteID())
+	if err != nil {
+		return nil, fmt.Errorf("handshake validation failed: %w", err)
+	}
+	if n.scorer.IsBanned(secureConn.RemoteID()) {
+		return nil, fmt.Errorf("peer %s is banned", secureConn.RemoteID())
+	}
+	protocol, err := NegotiateProtocolVersion(handshakeResp.ProtocolVersion)
 	if err != nil {
 		return nil, fmt.Errorf("handshake validation failed: %w", err)
 	}
+	isValidator, err := n.admitPeer(&handshakeResp, secureConn.RemoteID())
+	if err != nil {
+		return nil, err
+	}
 
 	// Step 3: Create authenticated peer
 	peer := &ValidatorPeer{
-		ID:             handshakeResp.NodeID,
+		ID:             secureConn.RemoteID(),
 		Address:        conn.RemoteAddr().String(),
 		ValidatorAddr:  handshakeResp.ValidatorAddr,
 		PublicKey:      handshakeResp.PublicKey,
 		SigAlgorithm:   handshakeResp.SigAlgorithm,
-		Conn:           conn,
+		Conn:           secureConn,
+		Protocol:       protocol,
+		ListenAddr:     dialableAddr(handshakeResp.ListenAddr, conn.RemoteAddr()),
+		Inbound:        !isOutgoing,
 		ConnectedAt:    time.Now(),
 		LastSeen:       time.Now(),
-		IsValidator:    len(handshakeResp.ValidatorAddr) > 0,
-		Reputation:     1.0, // Start with good reputation
+		IsValidator:    isValidator,
+		Reputation:     n.scorer.Score(secureConn.RemoteID()),
 		FailedAttempts: 0,
+		limiters:       make(map[MessageType]*TokenBucket),
 	}
 
 	log.Printf("Authenticated peer: %s (validator: %v)", peer.ID, peer.IsValidator)
 	return peer, nil
 }
 
-// validateHandshakeResponse validates incoming handshake response
-func (n *EnhancedP2PNetwork) validateHandshakeResponse(req *HandshakeRequest) error {
+// admitPeer decides whether a peer that passed handshake validation may
+// connect, and whether it is treated as a validator: it must be registered
+// with the consensus engine under the key it signed the handshake with. A
+// permissioned network only admits validators and allowed peers.
+func (n *EnhancedP2PNetwork) admitPeer(req *HandshakeRequest, peerID string) (bool, error) {
+	isValidator := !req.ValidatorAddr.IsZero()
+	if isValidator && n.consensusEngine != nil {
+		validator, registered := n.consensusEngine.GetValidator(req.ValidatorAddr)
+		isValidator = registered && bytes.Equal(validator.PublicKey, req.PublicKey)
+	}
+	if !n.permissioned || isValidator {
+		return isValidator, nil
+	}
+
+	n.mu.RLock()
+	allowed := n.allowedPeers[peerID]
+	n.mu.RUnlock()
+	if !allowed {
+		return false, fmt.Errorf("peer %s is not a registered validator", peerID)
+	}
+	return false, nil
+}
+
+// dialableAddr returns the address a peer listens on. A peer listening on
+// all interfaces is reached at the address its connection came from.
+func dialableAddr(listenAddr string, remote net.Addr) string {
+	host, port, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return ""
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		remoteHost, _, err := net.SplitHostPort(remote.String())
+		if err != nil {
+			return ""
+		}
+		host = remoteHost
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// validateHandshakeResponse validates the handshake of the peer that proved
+// the identity with the given node ID
+func (n *EnhancedP2PNetwork) validateHandshakeResponse(req *HandshakeRequest, peerID string) error {
 	// SECURITY: Comprehensive handshake validation
 
 	// Validate network ID
@@ -819,8 +1257,8 @@ func (n *EnhancedP2PNetwork) validateHandshakeResponse(req *HandshakeRequest) er
 	}
 
 	// Validate chain ID
-	if req.ChainID != n.chainID.Uint64() {
-		return fmt.Errorf("chain ID mismatch: expected %d, got %d", n.chainID.Uint64(), req.ChainID)
+	if req.ChainID != n.chainIDValue() {
+		return fmt.Errorf("chain ID mismatch: expected %d, got %d", n.chainIDValue(), req.ChainID)
 	}
 
 	// Validate timestamp (prevent replay attacks)
@@ -829,20 +1267,19 @@ func (n *EnhancedP2PNetwork) validateHandshakeResponse(req *HandshakeRequest) er
 		return fmt.Errorf("timestamp outside acceptable range")
 	}
 
-	// Validate node ID format
-	if len(req.NodeID) < 8 || len(req.NodeID) > 64 {
-		return fmt.Errorf("invalid node ID length")
+	// The node ID must be the one derived from the identity key of the session
+	if req.NodeID != peerID {
+		return fmt.Errorf("node ID %s does not match the proven identity %s", req.NodeID, peerID)
 	}
 
-	// Validate public key
-	if len(req.PublicKey) == 0 {
-		return fmt.Errorf("public key required")
-	}
-
-	// SECURITY: Verify signature if present
-	if len(req.Signature) > 0 {
-		handshakeData := fmt.Sprintf("handshake:%s:%d:%d:%d",
-			req.NodeID, req.NetworkID, req.ChainID, req.Timestamp)
+	// SECURITY: A validator must sign the handshake with the key of its address
+	if !req.ValidatorAddr.IsZero() {
+		if len(req.PublicKey) == 0 || len(req.Signature) == 0 {
+			return fmt.Errorf("validator handshake must be signed")
+		}
+		if types.PublicKeyToAddress(req.PublicKey) != req.ValidatorAddr {
+			return fmt.Errorf("public key does not match validator %s", req.ValidatorAddr.Hex())
+		}
 
 		qrSig := &crypto.QRSignature{
 			Algorithm: req.SigAlgorithm,
@@ -850,7 +1287,7 @@ func (n *EnhancedP2PNetwork) validateHandshakeResponse(req *HandshakeRequest) er
 			PublicKey: req.PublicKey,
 		}
 
-		valid, err := crypto.VerifySignature([]byte(handshakeData), qrSig)
+		valid, err := crypto.VerifySignature([]byte(req.signingData()), qrSig)
 		if err != nil {
 			return fmt.Errorf("signature verification failed: %w", err)
 		}
@@ -867,17 +1304,36 @@ func (n *EnhancedP2PNetwork) validateHandshakeResponse(req *HandshakeRequest) er
 	return nil
 }
 
-// getPublicKey returns the node's public key
+// getPublicKey returns the public key of the validator key, nil if the node
+// is not a validator
 func (n *EnhancedP2PNetwork) getPublicKey() []byte {
-	// For now, return a placeholder - in production this would derive from private key
 	if n.validatorPrivKey == nil {
-		return []byte("placeholder_public_key")
+		return nil
 	}
 
-	// In production, derive public key from private key based on algorithm
-	// For now, use a simple hash of the private key as placeholder
-	hash := sha256.Sum256(n.validatorPrivKey)
-	return hash[:]
+	switch n.sigAlgorithm {
+	case crypto.SigAlgDilithium:
+		priv, err := crypto.DilithiumPrivateKeyFromBytes(n.validatorPrivKey)
+		if err != nil {
+			return nil
+		}
+		return priv.Public().Bytes()
+	case crypto.SigAlgFalcon:
+		priv, err := crypto.FalconPrivateKeyFromBytes(n.validatorPrivKey)
+		if err != nil {
+			return nil
+		}
+		return priv.Public().Bytes()
+	}
+	return nil
+}
+
+// chainIDValue returns the configured chain ID, 0 if none is set
+func (n *EnhancedP2PNetwork) chainIDValue() uint64 {
+	if n.chainID == nil {
+		return 0
+	}
+	return n.chainID.Uint64()
 }
 
 // HandshakeRequest represents a P2P handshake request/response
@@ -892,81 +1348,702 @@ type HandshakeRequest struct {
 	Timestamp     int64                     `json:"timestamp"`
 	Version       string                    `json:"version"`
 	Capabilities  []string                  `json:"capabilities"`
+
+	// ProtocolVersion is the highest wire protocol version of the node,
+	// absent for nodes predating version negotiation
+	ProtocolVersion uint32 `json:"protocolVersion,omitempty"`
+
+	// ListenAddr is the address the node accepts connections on
+	ListenAddr string `json:"listenAddr,omitempty"`
+}
+
+// signingData returns the data a validator signs, binding its address to the
+// node ID proven by the session
+func (req *HandshakeRequest) signingData() string {
+	return fmt.Sprintf("handshake:%s:%d:%d:%d", req.NodeID, req.NetworkID, req.ChainID, req.Timestamp)
 }
 
-// Placeholder for additional methods
+// handleHandshake rejects handshakes within an established session, peers
+// are authenticated once when they connect
 func (n *EnhancedP2PNetwork) handleHandshake(peer *ValidatorPeer, msg *P2PMessage) error {
-	// Implementation would go here for handling handshake messages
-	return nil
+	return fmt.Errorf("%w: handshake within an established session", ErrInvalidMessage)
 }
 
 func (n *EnhancedP2PNetwork) handlePing(peer *ValidatorPeer, msg *P2PMessage) error {
-	// Implementation would go here
+	pong := &P2PMessage{
+		Type:      MsgPong,
+		Timestamp: time.Now().Unix(),
+		From:      n.nodeID,
+		Nonce:     msg.Nonce,
+	}
+	if err := peer.SendMessage(pong); err != nil {
+		log.Printf("Failed to send pong to peer %s: %v", peer.ID, err)
+	}
 	return nil
 }
 
+// handlePong measures the latency of the peer answering the last ping
 func (n *EnhancedP2PNetwork) handlePong(peer *ValidatorPeer, msg *P2PMessage) error {
-	// Implementation would go here
+	peer.mu.Lock()
+	defer peer.mu.Unlock()
+
+	if msg.Nonce == peer.pingNonce && !peer.LastPing.IsZero() {
+		peer.Latency = time.Since(peer.LastPing)
+	}
 	return nil
 }
 
+// handleConsensusMessage hands the vote of a validator peer to the consensus
+// handler. Validators send their own votes, signed with their key.
 func (n *EnhancedP2PNetwork) handleConsensusMessage(peer *ValidatorPeer, msg *P2PMessage) error {
-	// Implementation would go here
-	return nil
+	if err := verifyValidatorMessage(peer, msg); err != nil {
+		return err
+	}
+
+	var vote ConsensusMessage
+	if err := json.Unmarshal(msg.Data, &vote); err != nil {
+		return fmt.Errorf("%w: failed to unmarshal consensus message: %v", ErrInvalidMessage, err)
+	}
+	if vote.Validator != peer.ValidatorAddr {
+		return fmt.Errorf("%w: vote of %s sent by validator %s", ErrInvalidMessage, vote.Validator.Hex(), peer.ValidatorAddr.Hex())
+	}
+
+	if n.onConsensusMsg == nil {
+		return nil
+	}
+	return n.onConsensusMsg(&vote)
+}
+
+// handleProposal hands a block sent by a validator peer to the proposal
+// handler. Validators send their own proposals and relay the ones they voted
+// for, the handler checks the signature of the proposer.
+func (n *EnhancedP2PNetwork) handleProposal(peer *ValidatorPeer, msg *P2PMessage) error {
+	if err := verifyValidatorMessage(peer, msg); err != nil {
+		return err
+	}
+
+	var block types.Block
+	if err := json.Unmarshal(msg.Data, &block); err != nil {
+		return fmt.Errorf("%w: failed to unmarshal proposal: %v", ErrInvalidMessage, err)
+	}
+	if block.Header == nil {
+		return fmt.Errorf("%w: proposal without header from validator %s", ErrInvalidMessage, peer.ValidatorAddr.Hex())
+	}
+	if err := block.Header.ValidateFields(); err != nil {
+		return fmt.Errorf("%w: proposal from validator %s: %v", ErrInvalidMessage, peer.ValidatorAddr.Hex(), err)
+	}
+
+	if n.onProposal == nil {
+		return nil
+	}
+	return n.onProposal(&block)
 }
 
 func (n *EnhancedP2PNetwork) handleBlock(peer *ValidatorPeer, msg *P2PMessage) error {
-	// Implementation would go here
-	return nil
+	var block types.Block
+	if err := json.Unmarshal(msg.Data, &block); err != nil || block.Header == nil {
+		return fmt.Errorf("%w: failed to unmarshal block: %v", ErrInvalidMessage, err)
+	}
+	if err := block.Header.ValidateFields(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+
+	if n.onBlock == nil {
+		return nil
+	}
+	return n.onBlock(&block)
 }
 
 func (n *EnhancedP2PNetwork) handleTransaction(peer *ValidatorPeer, msg *P2PMessage) error {
-	// Implementation would go here
+	var tx types.QuantumTransaction
+	if err := json.Unmarshal(msg.Data, &tx); err != nil {
+		return fmt.Errorf("%w: failed to unmarshal transaction: %v", ErrInvalidMessage, err)
+	}
+
+	if n.onTransaction == nil {
+		return nil
+	}
+	return n.onTransaction(&tx)
+}
+
+// handleEvidence hands evidence relayed by a peer to the evidence handler,
+// which penalizes the peer for evidence that proves nothing
+func (n *EnhancedP2PNetwork) handleEvidence(peer *ValidatorPeer, msg *P2PMessage) error {
+	var ev consensus.Evidence
+	if err := json.Unmarshal(msg.Data, &ev); err != nil {
+		return fmt.Errorf("%w: failed to unmarshal evidence: %v", ErrInvalidMessage, err)
+	}
+
+	if n.onEvidence == nil {
+		return nil
+	}
+	return n.onEvidence(&ev)
+}
+
+// handleEncryptionKey hands the encryption key a validator peer announces to
+// the encryption key handler, which checks the signature of the validator
+func (n *EnhancedP2PNetwork) handleEncryptionKey(peer *ValidatorPeer, msg *P2PMessage) error {
+	if err := verifyValidatorMessage(peer, msg); err != nil {
+		return err
+	}
+
+	var key EncryptionKeyData
+	if err := json.Unmarshal(msg.Data, &key); err != nil {
+		return fmt.Errorf("%w: failed to unmarshal encryption key: %v", ErrInvalidMessage, err)
+	}
+	if key.Validator != peer.ValidatorAddr {
+		return fmt.Errorf("%w: encryption key of %s sent by validator %s", ErrInvalidMessage, key.Validator.Hex(), peer.ValidatorAddr.Hex())
+	}
+
+	if n.onEncryptionKey == nil {
+		return nil
+	}
+	return n.onEncryptionKey(&key)
+}
+
+// handleDecryptionShares hands the key share secrets a validator peer
+// releases to the decryption shares handler
+func (n *EnhancedP2PNetwork) handleDecryptionShares(peer *ValidatorPeer, msg *P2PMessage) error {
+	if err := verifyValidatorMessage(peer, msg); err != nil {
+		return err
+	}
+
+	var shares DecryptionSharesData
+	if err := json.Unmarshal(msg.Data, &shares); err != nil {
+		return fmt.Errorf("%w: failed to unmarshal decryption shares: %v", ErrInvalidMessage, err)
+	}
+	if shares.Validator != peer.ValidatorAddr {
+		return fmt.Errorf("%w: decryption shares of %s sent by validator %s", ErrInvalidMessage, shares.Validator.Hex(), peer.ValidatorAddr.Hex())
+	}
+
+	if n.onShares == nil {
+		return nil
+	}
+	return n.onShares(&shares)
+}
+
+// RequestBlocks asks a validator for the committed blocks from a number on,
+// which are handed to the block handler in order
+func (n *EnhancedP2PNetwork) RequestBlocks(validator types.Address, from uint64) error {
+	peer, ok := n.ValidatorPeer(validator)
+	if !ok {
+		return fmt.Errorf("validator %s is not connected", validator.Hex())
+	}
+
+	data, err := json.Marshal(&BlockRequestData{From: from})
+	if err != nil {
+		return fmt.Errorf("failed to marshal block request: %w", err)
+	}
+
+	peer.mu.Lock()
+	peer.syncFrom = from
+	peer.mu.Unlock()
+
+	return peer.SendMessage(&P2PMessage{
+		Type:      MsgBlockRequest,
+		Data:      data,
+		Timestamp: time.Now().Unix(),
+		From:      n.nodeID,
+	})
+}
+
+func (n *EnhancedP2PNetwork) handleBlockRequest(peer *ValidatorPeer, msg *P2PMessage) error {
+	var request BlockRequestData
+	if err := json.Unmarshal(msg.Data, &request); err != nil {
+		return fmt.Errorf("%w: failed to unmarshal block request: %v", ErrInvalidMessage, err)
+	}
+	if n.blockSource == nil {
+		return nil
+	}
+
+	response := &BlockResponseData{Blocks: []*types.Block{}}
+	for number := request.From; len(response.Blocks) < maxBlocksPerResponse; number++ {
+		block := n.blockSource(number)
+		if block == nil {
+			break
+		}
+		response.Blocks = append(response.Blocks, block)
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("failed to marshal blocks: %w", err)
+	}
+	err = peer.SendMessage(&P2PMessage{
+		Type:      MsgBlockResponse,
+		Data:      data,
+		Timestamp: time.Now().Unix(),
+		From:      n.nodeID,
+	})
+	if err != nil {
+		log.Printf("Failed to send blocks to peer %s: %v", peer.ID, err)
+	}
 	return nil
 }
 
+// handleBlockResponse hands the requested blocks to the block handler in
+// order, stopping at the first one it rejects
+func (n *EnhancedP2PNetwork) handleBlockResponse(peer *ValidatorPeer, msg *P2PMessage) error {
+	peer.mu.Lock()
+	from := peer.syncFrom
+	peer.syncFrom = 0
+	peer.mu.Unlock()
+	if from == 0 {
+		return fmt.Errorf("%w: unrequested blocks", ErrInvalidMessage)
+	}
+
+	var response BlockResponseData
+	if err := json.Unmarshal(msg.Data, &response); err != nil {
+		return fmt.Errorf("%w: failed to unmarshal blocks: %v", ErrInvalidMessage, err)
+	}
+	if len(response.Blocks) > maxBlocksPerResponse {
+		return fmt.Errorf("%w: response of %d blocks", ErrInvalidMessage, len(response.Blocks))
+	}
+
+	for i, block := range response.Blocks {
+		if block == nil || block.Header == nil || block.Header.ValidateFields() != nil || block.Number().Uint64() != from+uint64(i) {
+			return fmt.Errorf("%w: blocks not following the requested number %d", ErrInvalidMessage, from)
+		}
+		if n.onBlock == nil {
+			continue
+		}
+		if err := n.onBlock(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleValidatorAnnounce connects to the announced validators this node is
+// not connected to yet
 func (n *EnhancedP2PNetwork) handleValidatorAnnounce(peer *ValidatorPeer, msg *P2PMessage) error {
-	// Implementation would go here
+	var announcement ValidatorAnnounceData
+	if err := json.Unmarshal(msg.Data, &announcement); err != nil {
+		return fmt.Errorf("%w: failed to unmarshal validator announcement: %v", ErrInvalidMessage, err)
+	}
+	if len(announcement.Validators) > maxValidatorAnnounce {
+		return fmt.Errorf("%w: announcement of %d validators", ErrInvalidMessage, len(announcement.Validators))
+	}
+
+	for _, endpoint := range announcement.Validators {
+		if endpoint == nil || endpoint.Address == "" || endpoint.NodeID == n.nodeID || endpoint.Validator == n.validatorAddr {
+			continue
+		}
+		if n.consensusEngine != nil {
+			if _, registered := n.consensusEngine.GetValidator(endpoint.Validator); !registered {
+				continue
+			}
+		}
+
+		n.mu.RLock()
+		_, connected := n.peers[endpoint.NodeID]
+		full := len(n.peers) >= n.maxPeers
+		n.mu.RUnlock()
+		if !connected && !full {
+			n.dial(endpoint.Address, false)
+		}
+	}
+	return nil
+}
+
+// verifyValidatorMessage checks that a consensus message comes from a
+// validator peer and is signed with the key it proved in the handshake
+func verifyValidatorMessage(peer *ValidatorPeer, msg *P2PMessage) error {
+	if !peer.IsValidator {
+		return fmt.Errorf("%w: consensus message from peer %s which is not a validator", ErrInvalidMessage, peer.ID)
+	}
+	if len(msg.Signature) == 0 || !bytes.Equal(msg.PublicKey, peer.PublicKey) || msg.SigAlgorithm != peer.SigAlgorithm {
+		return fmt.Errorf("%w: consensus message not signed by validator %s", ErrInvalidSignature, peer.ValidatorAddr.Hex())
+	}
+	valid, err := crypto.VerifySignature(msg.Data, &crypto.QRSignature{
+		Algorithm: msg.SigAlgorithm,
+		Signature: msg.Signature,
+		PublicKey: msg.PublicKey,
+	})
+	if err != nil || !valid {
+		return fmt.Errorf("%w: bad consensus message signature of validator %s", ErrInvalidSignature, peer.ValidatorAddr.Hex())
+	}
 	return nil
 }
 
-// Additional placeholder methods for completeness
+// connectToBootstrapPeer connects to a configured peer
 func (n *EnhancedP2PNetwork) connectToBootstrapPeer(addr string) {
 	defer n.wg.Done()
-	// Implementation would go here
+	n.connect(addr, true)
+}
+
+// dial connects to a peer in the background unless it is being dialed already
+func (n *EnhancedP2PNetwork) dial(addr string, bootstrap bool) {
+	if n.ctx.Err() != nil {
+		return
+	}
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		n.connect(addr, bootstrap)
+	}()
+}
+
+// connect dials a peer and handles its messages until it disconnects
+func (n *EnhancedP2PNetwork) connect(addr string, bootstrap bool) {
+	n.mu.Lock()
+	if n.dialing[addr] {
+		n.mu.Unlock()
+		return
+	}
+	n.dialing[addr] = true
+	n.mu.Unlock()
+
+	dialed := func() {
+		n.mu.Lock()
+		delete(n.dialing, addr)
+		n.mu.Unlock()
+	}
+
+	dialer := &websocket.Dialer{HandshakeTimeout: HandshakeTimeout}
+	wsConn, _, err := dialer.DialContext(n.ctx, "ws://"+addr, nil)
+	if err != nil {
+		dialed()
+		log.Printf("Failed to connect to peer %s: %v", addr, err)
+		return
+	}
+	defer wsConn.Close()
+	wsConn.SetReadLimit(MaxWireMessageSize)
+
+	peer, err := n.performHandshake(wsConn, true)
+	dialed()
+	if err != nil {
+		log.Printf("Handshake with peer %s failed: %v", addr, err)
+		return
+	}
+	peer.Address = addr
+	peer.IsBootstrap = bootstrap
+
+	if !n.addPeer(peer) {
+		return
+	}
+	n.handlePeerMessages(peer)
 }
 
+// maintainNetwork pings the peers, drops the silent ones, redials lost
+// bootstrap peers and announces the connected validators
 func (n *EnhancedP2PNetwork) maintainNetwork() {
 	defer n.wg.Done()
-	// Implementation would go here
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case <-ticker.C:
+			n.pingPeers()
+			n.redialBootstrapPeers()
+			n.announceValidators()
+		}
+	}
 }
 
+// pingPeers pings every peer, disconnecting the peers silent for too long
+func (n *EnhancedP2PNetwork) pingPeers() {
+	for _, peer := range n.Peers() {
+		peer.mu.Lock()
+		silent := time.Since(peer.LastSeen) > peerTimeout
+		peer.pingNonce++
+		peer.LastPing = time.Now()
+		ping := &P2PMessage{
+			Type:      MsgPing,
+			Timestamp: time.Now().Unix(),
+			From:      n.nodeID,
+			Nonce:     peer.pingNonce,
+		}
+		peer.mu.Unlock()
+
+		if silent {
+			log.Printf("Peer %s timed out", peer.ID)
+			n.removePeer(peer.ID)
+			continue
+		}
+		if err := peer.SendMessage(ping); err != nil {
+			log.Printf("Failed to ping peer %s: %v", peer.ID, err)
+		}
+	}
+}
+
+// redialBootstrapPeers reconnects to the bootstrap peers that disconnected
+func (n *EnhancedP2PNetwork) redialBootstrapPeers() {
+	connected := make(map[string]bool)
+	for _, peer := range n.Peers() {
+		connected[peer.Address] = true
+		connected[peer.ListenAddr] = true
+	}
+	for _, addr := range n.bootstrapPeers {
+		if !connected[addr] {
+			n.dial(addr, true)
+		}
+	}
+}
+
+// announceValidators tells the peers which validators this node is
+// connected to and where they listen
+func (n *EnhancedP2PNetwork) announceValidators() {
+	peers := n.Peers()
+	announcement := &ValidatorAnnounceData{Validators: make([]*ValidatorEndpoint, 0)}
+	for _, peer := range peers {
+		if peer.IsValidator && peer.ListenAddr != "" && len(announcement.Validators) < maxValidatorAnnounce {
+			announcement.Validators = append(announcement.Validators, &ValidatorEndpoint{
+				NodeID:    peer.ID,
+				Validator: peer.ValidatorAddr,
+				Address:   peer.ListenAddr,
+			})
+		}
+	}
+	if len(announcement.Validators) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(announcement)
+	if err != nil {
+		return
+	}
+	msg := &P2PMessage{
+		Type:      MsgValidatorAnnounce,
+		Data:      data,
+		Timestamp: time.Now().Unix(),
+		From:      n.nodeID,
+	}
+	for _, peer := range peers {
+		if err := peer.SendMessage(msg); err != nil {
+			log.Printf("Failed to announce validators to peer %s: %v", peer.ID, err)
+		}
+	}
+}
+
+// collectMetrics samples the message and bandwidth rates and the share of
+// the other validators this node is connected to
 func (n *EnhancedP2PNetwork) collectMetrics() {
 	defer n.wg.Done()
-	// Implementation would go here
+
+	ticker := time.NewTicker(metricsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case now := <-ticker.C:
+			n.sampleMetrics(now)
+		}
+	}
+}
+
+func (n *EnhancedP2PNetwork) sampleMetrics(now time.Time) {
+	var messages, bytes uint64
+	validatorPeers := 0
+	for _, peer := range n.Peers() {
+		peer.mu.RLock()
+		messages += peer.MessagesSent + peer.MessagesReceived
+		bytes += peer.BytesSent + peer.BytesReceived
+		if peer.IsValidator {
+			validatorPeers++
+		}
+		peer.mu.RUnlock()
+	}
+
+	health := 1.0
+	if n.consensusEngine != nil {
+		others := len(n.consensusEngine.GetValidatorSet())
+		if n.isValidator {
+			others--
+		}
+		if others > 0 {
+			health = math.Min(float64(validatorPeers)/float64(others), 1)
+		}
+	}
+
+	n.metricsMu.Lock()
+	defer n.metricsMu.Unlock()
+
+	if !n.lastCollect.IsZero() {
+		elapsed := now.Sub(n.lastCollect).Seconds()
+		// Counters of disconnected peers are gone, rates restart from the survivors
+		if messages >= n.lastMessages && bytes >= n.lastBytes && elapsed > 0 {
+			n.networkMetrics.MessageRate = float64(messages-n.lastMessages) / elapsed
+			n.networkMetrics.BandwidthUsage = uint64(float64(bytes-n.lastBytes) / elapsed)
+		}
+	}
+	n.lastCollect = now
+	n.lastMessages = messages
+	n.lastBytes = bytes
+	n.networkMetrics.NetworkHealth = health
 }
 
-func (n *EnhancedP2PNetwork) addPeer(peer *ValidatorPeer) {
-	// Implementation would go here
+// recordMessage counts a received message in the metrics
+func (n *EnhancedP2PNetwork) recordMessage(msgType MessageType, size int, dropped, failed bool) {
+	n.metricsMu.Lock()
+	defer n.metricsMu.Unlock()
+
+	n.networkMetrics.TotalMessages++
+	if dropped {
+		n.networkMetrics.DroppedMessages++
+	}
+	stats, ok := n.networkMetrics.MessageStats[msgType]
+	if !ok {
+		stats = &MessageStats{}
+		n.networkMetrics.MessageStats[msgType] = stats
+	}
+	stats.Count++
+	stats.Bytes += uint64(size)
+	if failed {
+		stats.Errors++
+	}
 }
 
-func (n *EnhancedP2PNetwork) handlePeerMessages(peer *ValidatorPeer) {
-	// Implementation would go here
+// addPeer registers an authenticated peer and reports whether it was kept.
+// A new connection replaces an older one in the same direction. When two
+// nodes dial each other at once, both keep the connection dialed by the
+// lower node ID.
+func (n *EnhancedP2PNetwork) addPeer(peer *ValidatorPeer) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.ctx.Err() != nil {
+		return false
+	}
+	if existing, ok := n.peers[peer.ID]; ok {
+		if existing.Inbound != peer.Inbound {
+			dialer := n.nodeID
+			if peer.Inbound {
+				dialer = peer.ID
+			}
+			existingDialer := n.nodeID
+			if existing.Inbound {
+				existingDialer = existing.ID
+			}
+			if existingDialer < dialer {
+				return false
+			}
+		}
+		existing.Conn.Close()
+	}
+	n.peers[peer.ID] = peer
+	if peer.IsValidator {
+		n.peersByAddr[peer.ValidatorAddr] = peer
+	}
+	return true
 }
 
-// httpResponseWriter is a simple implementation for WebSocket upgrade
-type httpResponseWriter struct {
-	conn net.Conn
+// removePeer disconnects a peer and reports whether it was connected
+func (n *EnhancedP2PNetwork) removePeer(peerID string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	peer, ok := n.peers[peerID]
+	if !ok {
+		return false
+	}
+	delete(n.peers, peerID)
+	if n.peersByAddr[peer.ValidatorAddr] == peer {
+		delete(n.peersByAddr, peer.ValidatorAddr)
+	}
+	peer.Conn.Close()
+	return true
 }
 
-func (w *httpResponseWriter) Header() http.Header {
-	return make(http.Header)
+// handlePeerMessages dispatches the messages of a peer until it disconnects.
+// Messages beyond the rate limit of their type are dropped, they and the
+// messages failing with an error of misbehavior lower the peer score.
+func (n *EnhancedP2PNetwork) handlePeerMessages(peer *ValidatorPeer) {
+	defer func() {
+		n.mu.Lock()
+		if n.peers[peer.ID] == peer {
+			delete(n.peers, peer.ID)
+			if n.peersByAddr[peer.ValidatorAddr] == peer {
+				delete(n.peersByAddr, peer.ValidatorAddr)
+			}
+		}
+		n.mu.Unlock()
+	}()
+
+	for n.ctx.Err() == nil {
+		msg, size, err := peer.readMessage()
+		if err != nil {
+			if errors.Is(err, ErrInvalidFrame) {
+				log.Printf("⚠️ Peer %s misbehaved: %v", peer.ID, err)
+				n.scorePeer(peer, ScoreMalformedMessage)
+			}
+			return
+		}
+
+		peer.mu.Lock()
+		peer.MessagesReceived++
+		peer.BytesReceived += uint64(size)
+		peer.LastSeen = time.Now()
+		peer.mu.Unlock()
+
+		if !n.allowMessage(peer, msg.Type) {
+			n.recordMessage(msg.Type, size, true, false)
+			if n.scorePeer(peer, ScoreRateLimited) {
+				return
+			}
+			continue
+		}
+
+		handler, exists := n.messageHandlers[msg.Type]
+		if !exists {
+			n.recordMessage(msg.Type, size, true, false)
+			continue
+		}
+		err = handler(peer, msg)
+		n.recordMessage(msg.Type, size, false, err != nil)
+		if err != nil {
+			event, misbehaved := ScoreEventForError(err)
+			if !misbehaved {
+				log.Printf("Ignored message from peer %s: %v", peer.ID, err)
+				continue
+			}
+			log.Printf("⚠️ Peer %s misbehaved: %v", peer.ID, err)
+			if n.scorePeer(peer, event) {
+				return
+			}
+		}
+	}
+}
+
+// allowMessage applies the rate limit of the message type to a peer
+func (n *EnhancedP2PNetwork) allowMessage(peer *ValidatorPeer, msgType MessageType) bool {
+	limit, ok := n.messageRateLimit[msgType]
+	if !ok {
+		return true
+	}
+
+	peer.mu.Lock()
+	bucket, exists := peer.limiters[msgType]
+	if !exists {
+		perSecond := uint64(float64(limit.MaxMessages) / limit.TimeWindow.Seconds())
+		if perSecond == 0 {
+			perSecond = 1
+		}
+		bucket = NewTokenBucket(limit.BurstLimit, perSecond)
+		peer.limiters[msgType] = bucket
+	}
+	peer.mu.Unlock()
+
+	return bucket.Consume(1)
 }
 
-func (w *httpResponseWriter) Write(data []byte) (int, error) {
-	return w.conn.Write(data)
+// scorePeer records a behavior of a peer and reports whether it got banned
+func (n *EnhancedP2PNetwork) scorePeer(peer *ValidatorPeer, event ScoreEvent) bool {
+	banned := n.scorer.Record(peer.ID, event)
+
+	peer.mu.Lock()
+	peer.Reputation = n.scorer.Score(peer.ID)
+	peer.mu.Unlock()
+	return banned
 }
 
-func (w *httpResponseWriter) WriteHeader(statusCode int) {
-	// No-op for WebSocket upgrade
+// PeerScorer returns the scorer keeping the reputation of peers
+func (n *EnhancedP2PNetwork) PeerScorer() *PeerScorer {
+	return n.scorer
 }
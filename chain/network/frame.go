@@ -0,0 +1,133 @@
+package network
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/golang/snappy"
+)
+
+const (
+	// ProtocolVersion is the wire protocol version spoken by this node
+	ProtocolVersion = 2
+
+	// MinProtocolVersion is the oldest wire protocol version still spoken,
+	// peers only supporting older versions are refused
+	MinProtocolVersion = 1
+
+	// FramedProtocolVersion is the first version exchanging binary frames,
+	// peers on older versions exchange JSON messages
+	FramedProtocolVersion = 2
+
+	// MaxFramePayload bounds the decompressed payload of a frame
+	MaxFramePayload = 16 << 20
+
+	// MaxWireMessageSize bounds a websocket message of a P2P connection: a
+	// frame of the largest payload grown by snappy (32 + n/6 bytes at most)
+	// and sealed with a 16 byte GCM tag. Connections set it as their read
+	// limit, so oversized messages are refused before they are buffered.
+	MaxWireMessageSize = frameHeaderSize + 32 + MaxFramePayload + MaxFramePayload/6 + 16
+
+	// frameHeaderSize is the size of the header preceding the payload:
+	// length (4), version (1), message type (1) and request ID (8)
+	frameHeaderSize = 14
+)
+
+// ErrInvalidFrame is returned for frames that can not be decoded
+var ErrInvalidFrame = errors.New("invalid frame")
+
+// Frame is a binary P2P message. Its payload is compressed with snappy on
+// the wire, the length prefix covers everything after it.
+//
+//	| length uint32 | version uint8 | type uint8 | request ID uint64 | payload |
+type Frame struct {
+	Version   uint8
+	Type      uint8
+	RequestID uint64 // Pairs responses with requests, 0 for other messages
+	Payload   []byte
+}
+
+// NegotiateProtocolVersion returns the version spoken with a peer announcing
+// the given version, the highest both sides support. Peers predating version
+// negotiation announce 0 and speak version 1.
+func NegotiateProtocolVersion(remote uint32) (uint32, error) {
+	if remote == 0 {
+		remote = 1
+	}
+	if remote < MinProtocolVersion {
+		return 0, fmt.Errorf("unsupported protocol version %d, need at least %d", remote, MinProtocolVersion)
+	}
+	if remote > ProtocolVersion {
+		return ProtocolVersion, nil
+	}
+	return remote, nil
+}
+
+// EncodeFrame encodes a frame, compressing its payload
+func EncodeFrame(f *Frame) ([]byte, error) {
+	if len(f.Payload) > MaxFramePayload {
+		return nil, fmt.Errorf("frame payload of %d bytes exceeds %d", len(f.Payload), MaxFramePayload)
+	}
+
+	data := make([]byte, frameHeaderSize+snappy.MaxEncodedLen(len(f.Payload)))
+	compressed := snappy.Encode(data[frameHeaderSize:], f.Payload)
+	data = data[:frameHeaderSize+len(compressed)]
+
+	binary.BigEndian.PutUint32(data[0:4], uint32(len(data)-4))
+	data[4] = f.Version
+	data[5] = f.Type
+	binary.BigEndian.PutUint64(data[6:14], f.RequestID)
+	return data, nil
+}
+
+// DecodeFrame decodes a frame, decompressing its payload
+func DecodeFrame(data []byte) (*Frame, error) {
+	if len(data) < frameHeaderSize {
+		return nil, fmt.Errorf("%w: %d bytes is shorter than the header", ErrInvalidFrame, len(data))
+	}
+	if length := binary.BigEndian.Uint32(data[0:4]); int(length) != len(data)-4 {
+		return nil, fmt.Errorf("%w: length %d does not match %d bytes", ErrInvalidFrame, length, len(data)-4)
+	}
+
+	compressed := data[frameHeaderSize:]
+	size, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFrame, err)
+	}
+	if size > MaxFramePayload {
+		return nil, fmt.Errorf("%w: payload of %d bytes exceeds %d", ErrInvalidFrame, size, MaxFramePayload)
+	}
+	payload, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFrame, err)
+	}
+
+	return &Frame{
+		Version:   data[4],
+		Type:      data[5],
+		RequestID: binary.BigEndian.Uint64(data[6:14]),
+		Payload:   payload,
+	}, nil
+}
+
+// WriteMessageFrame encodes, encrypts and sends a frame, returning the
+// number of bytes sent
+func (c *SecureConn) WriteMessageFrame(f *Frame) (int, error) {
+	data, err := EncodeFrame(f)
+	if err != nil {
+		return 0, err
+	}
+	return len(data), c.WriteFrame(data)
+}
+
+// ReadMessageFrame receives and decodes the next frame, returning the
+// number of bytes received
+func (c *SecureConn) ReadMessageFrame() (*Frame, int, error) {
+	data, err := c.ReadFrame()
+	if err != nil {
+		return nil, 0, err
+	}
+	f, err := DecodeFrame(data)
+	return f, len(data), err
+}
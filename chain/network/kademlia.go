@@ -0,0 +1,238 @@
+package network
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"math/bits"
+	"sort"
+	"sync"
+)
+
+const (
+	// BucketSize is the number of nodes kept per routing table bucket, and
+	// the number of neighbors returned for a query
+	BucketSize = 16
+
+	// nodeIDBits is the size of a node ID, one bucket per log distance
+	nodeIDBits = 256
+
+	// maxReplacements is the number of nodes remembered per full bucket, they
+	// take the place of entries that are removed
+	maxReplacements = 10
+)
+
+// RoutingTable is a Kademlia table of node records, bucketed by their XOR
+// log distance to the local node. Full buckets keep their long-lived entries
+// and remember newcomers as replacements.
+type RoutingTable struct {
+	self []byte
+
+	mu      sync.RWMutex
+	buckets [nodeIDBits + 1]*bucket
+}
+
+type bucket struct {
+	entries      []*NodeRecord // Least recently seen first
+	replacements []*NodeRecord
+}
+
+// NewRoutingTable creates an empty table for the node with the given ID
+func NewRoutingTable(selfID string) *RoutingTable {
+	self, _ := hex.DecodeString(selfID)
+	table := &RoutingTable{self: self}
+	for i := range table.buckets {
+		table.buckets[i] = &bucket{}
+	}
+	return table
+}
+
+// LogDistance returns the XOR log distance between two node IDs, the number
+// of the highest differing bit, 0 for equal IDs
+func LogDistance(a, b string) int {
+	idA, _ := hex.DecodeString(a)
+	idB, _ := hex.DecodeString(b)
+	return logDistance(idA, idB)
+}
+
+func logDistance(a, b []byte) int {
+	if len(a) != len(b) {
+		return nodeIDBits
+	}
+	for i := range a {
+		if x := a[i] ^ b[i]; x != 0 {
+			return (len(a)-i-1)*8 + bits.Len8(x)
+		}
+	}
+	return 0
+}
+
+// RandomNodeID returns a random ID, the target of a lookup refreshing the table
+func RandomNodeID() string {
+	id := make([]byte, nodeIDBits/8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Add inserts a verified record or refreshes a known one, and reports whether
+// the record is in the table
+func (t *RoutingTable) Add(record *NodeRecord) bool {
+	id, _ := hex.DecodeString(record.ID())
+	distance := logDistance(t.self, id)
+	if distance == 0 {
+		return false // Ourselves
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b := t.buckets[distance]
+	if i := indexOf(b.entries, record.ID()); i >= 0 {
+		if record.Seq >= b.entries[i].Seq {
+			b.entries[i] = record
+		}
+		// Move to the back as most recently seen
+		entry := b.entries[i]
+		b.entries = append(append(b.entries[:i:i], b.entries[i+1:]...), entry)
+		return true
+	}
+	if len(b.entries) < BucketSize {
+		b.entries = append(b.entries, record)
+		b.replacements = removeRecord(b.replacements, record.ID())
+		return true
+	}
+
+	b.replacements = append(removeRecord(b.replacements, record.ID()), record)
+	if len(b.replacements) > maxReplacements {
+		b.replacements = b.replacements[1:]
+	}
+	return false
+}
+
+// Remove drops a node, typically one that failed to respond, and promotes the
+// most recent replacement of its bucket
+func (t *RoutingTable) Remove(nodeID string) {
+	id, _ := hex.DecodeString(nodeID)
+	distance := logDistance(t.self, id)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b := t.buckets[distance]
+	if indexOf(b.entries, nodeID) < 0 {
+		b.replacements = removeRecord(b.replacements, nodeID)
+		return
+	}
+	b.entries = removeRecord(b.entries, nodeID)
+	if n := len(b.replacements); n > 0 {
+		b.entries = append(b.entries, b.replacements[n-1])
+		b.replacements = b.replacements[:n-1]
+	}
+}
+
+// Get returns the record of a node in the table, nil if unknown
+func (t *RoutingTable) Get(nodeID string) *NodeRecord {
+	id, _ := hex.DecodeString(nodeID)
+	distance := logDistance(t.self, id)
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	b := t.buckets[distance]
+	if i := indexOf(b.entries, nodeID); i >= 0 {
+		return b.entries[i]
+	}
+	return nil
+}
+
+// Closest returns up to n records closest to the target by XOR distance
+func (t *RoutingTable) Closest(target string, n int) []*NodeRecord {
+	return ClosestRecords(target, t.Nodes(), n)
+}
+
+// Nodes returns every record in the table
+func (t *RoutingTable) Nodes() []*NodeRecord {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var nodes []*NodeRecord
+	for _, b := range t.buckets {
+		nodes = append(nodes, b.entries...)
+	}
+	return nodes
+}
+
+// Len returns the number of records in the table
+func (t *RoutingTable) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	count := 0
+	for _, b := range t.buckets {
+		count += len(b.entries)
+	}
+	return count
+}
+
+// Buckets returns the number of non-empty buckets
+func (t *RoutingTable) Buckets() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	count := 0
+	for _, b := range t.buckets {
+		if len(b.entries) > 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// ClosestRecords sorts records by XOR distance to the target and returns up
+// to n of them
+func ClosestRecords(target string, records []*NodeRecord, n int) []*NodeRecord {
+	targetID, _ := hex.DecodeString(target)
+	type entry struct {
+		record   *NodeRecord
+		distance []byte
+	}
+	entries := make([]entry, 0, len(records))
+	for _, record := range records {
+		id, _ := hex.DecodeString(record.ID())
+		distance := make([]byte, len(id))
+		for i := range id {
+			if i < len(targetID) {
+				distance[i] = id[i] ^ targetID[i]
+			}
+		}
+		entries = append(entries, entry{record, distance})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].distance, entries[j].distance) < 0
+	})
+
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+	closest := make([]*NodeRecord, len(entries))
+	for i, e := range entries {
+		closest[i] = e.record
+	}
+	return closest
+}
+
+func indexOf(records []*NodeRecord, nodeID string) int {
+	for i, record := range records {
+		if record.ID() == nodeID {
+			return i
+		}
+	}
+	return -1
+}
+
+func removeRecord(records []*NodeRecord, nodeID string) []*NodeRecord {
+	if i := indexOf(records, nodeID); i >= 0 {
+		return append(records[:i:i], records[i+1:]...)
+	}
+	return records
+}
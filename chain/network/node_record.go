@@ -0,0 +1,116 @@
+package network
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/types"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// maxRecordAddressLength bounds the address a node record may advertise
+const maxRecordAddressLength = 256
+
+// recordDomain separates record signatures from other uses of the identity key
+var recordDomain = []byte("quantum-node-record")
+
+// ForkID identifies the chain a node follows, peers on another fork are not
+// worth connecting to
+type ForkID [4]byte
+
+// NewForkID derives the fork ID of the chain starting at the given genesis block
+func NewForkID(genesis types.Hash) ForkID {
+	var id ForkID
+	copy(id[:], types.Keccak256(genesis.Bytes()))
+	return id
+}
+
+// String returns the hex representation of the fork ID
+func (id ForkID) String() string {
+	return "0x" + hex.EncodeToString(id[:])
+}
+
+// MarshalText encodes the fork ID as hex
+func (id ForkID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+// UnmarshalText decodes a hex fork ID
+func (id *ForkID) UnmarshalText(text []byte) error {
+	data, err := hex.DecodeString(strings.TrimPrefix(string(text), "0x"))
+	if err != nil {
+		return fmt.Errorf("invalid fork ID: %w", err)
+	}
+	if len(data) != len(id) {
+		return fmt.Errorf("invalid fork ID length: %d", len(data))
+	}
+	copy(id[:], data)
+	return nil
+}
+
+// NodeRecord is the signed description of a node shared through discovery.
+// A node publishes a new record with a higher sequence number when its
+// address changes, records can be relayed by anyone as they are signed.
+type NodeRecord struct {
+	Seq       uint64 `json:"seq"`
+	PublicKey []byte `json:"publicKey"`
+	Address   string `json:"address"`
+	ChainID   uint64 `json:"chainId"`
+	ForkID    ForkID `json:"forkId"`
+	Signature []byte `json:"signature"`
+}
+
+// NewNodeRecord creates a record of the identity signed with its key
+func NewNodeRecord(identity *NodeIdentity, seq uint64, address string, chainID uint64, forkID ForkID) (*NodeRecord, error) {
+	record := &NodeRecord{
+		Seq:       seq,
+		PublicKey: identity.PublicKey(),
+		Address:   address,
+		ChainID:   chainID,
+		ForkID:    forkID,
+	}
+	signature, err := identity.Sign(record.signingHash())
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign node record: %w", err)
+	}
+	record.Signature = signature
+	return record, nil
+}
+
+// ID returns the node ID of the record, derived from its identity key
+func (r *NodeRecord) ID() string {
+	return NodeIDFromPublicKey(r.PublicKey)
+}
+
+// Verify checks that the record is well formed and signed by its identity key
+func (r *NodeRecord) Verify() error {
+	if r.Address == "" || len(r.Address) > maxRecordAddressLength {
+		return fmt.Errorf("invalid node record address length: %d", len(r.Address))
+	}
+	publicKey, err := crypto.DilithiumPublicKeyFromBytes(r.PublicKey)
+	if err != nil {
+		return fmt.Errorf("invalid node record key: %w", err)
+	}
+	if !publicKey.Verify(r.signingHash(), r.Signature) {
+		return errors.New("invalid node record signature")
+	}
+	return nil
+}
+
+// signingHash returns the hash of every record field but the signature
+func (r *NodeRecord) signingHash() []byte {
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(recordDomain)
+	hash.Write(binary.BigEndian.AppendUint64(nil, r.Seq))
+	hash.Write(r.PublicKey)
+	hash.Write(binary.BigEndian.AppendUint32(nil, uint32(len(r.Address))))
+	hash.Write([]byte(r.Address))
+	hash.Write(binary.BigEndian.AppendUint64(nil, r.ChainID))
+	hash.Write(r.ForkID[:])
+	return hash.Sum(nil)
+}
@@ -0,0 +1,190 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxDialFailures is the number of consecutive failed contacts after which
+	// a node is forgotten
+	MaxDialFailures = 5
+
+	// peerDBExpiry is how long a node that was never seen again is remembered
+	peerDBExpiry = 7 * 24 * time.Hour
+)
+
+// PeerDBEntry is what the peer database remembers about a node
+type PeerDBEntry struct {
+	Record   *NodeRecord `json:"record"`
+	LastSeen time.Time   `json:"lastSeen"`
+	LastDial time.Time   `json:"lastDial"`
+	Failures int         `json:"failures"`
+}
+
+// PeerDB persists the nodes found through discovery so a restarted node can
+// rejoin the network without its bootstrap peers
+type PeerDB struct {
+	path string
+
+	mu    sync.RWMutex
+	nodes map[string]*PeerDBEntry
+}
+
+// OpenPeerDB loads the database stored at path, an empty path keeps it in memory
+func OpenPeerDB(path string) (*PeerDB, error) {
+	db := &PeerDB{
+		path:  path,
+		nodes: make(map[string]*PeerDBEntry),
+	}
+	if path == "" {
+		return db, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read peer database: %w", err)
+	}
+
+	var entries []*PeerDBEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid peer database %s: %w", path, err)
+	}
+	for _, entry := range entries {
+		if entry.Record == nil || entry.Record.Verify() != nil || time.Since(entry.LastSeen) > peerDBExpiry {
+			continue
+		}
+		db.nodes[entry.Record.ID()] = entry
+	}
+	return db, nil
+}
+
+// Update stores a verified record, replacing an older one of the same node
+func (db *PeerDB) Update(record *NodeRecord) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	id := record.ID()
+	entry, exists := db.nodes[id]
+	if !exists {
+		db.nodes[id] = &PeerDBEntry{Record: record, LastSeen: time.Now()}
+		return
+	}
+	if record.Seq >= entry.Record.Seq {
+		entry.Record = record
+	}
+}
+
+// MarkSeen records a successful contact with a node
+func (db *PeerDB) MarkSeen(nodeID string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if entry, ok := db.nodes[nodeID]; ok {
+		entry.LastSeen = time.Now()
+		entry.Failures = 0
+	}
+}
+
+// MarkDialed records an attempt to contact a node
+func (db *PeerDB) MarkDialed(nodeID string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if entry, ok := db.nodes[nodeID]; ok {
+		entry.LastDial = time.Now()
+	}
+}
+
+// MarkFailed records a failed contact and returns the number of consecutive
+// failures. The node is forgotten once it reaches MaxDialFailures.
+func (db *PeerDB) MarkFailed(nodeID string) int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	entry, ok := db.nodes[nodeID]
+	if !ok {
+		return MaxDialFailures
+	}
+	entry.Failures++
+	if entry.Failures >= MaxDialFailures {
+		delete(db.nodes, nodeID)
+	}
+	return entry.Failures
+}
+
+// Get returns what the database knows about a node, nil if unknown
+func (db *PeerDB) Get(nodeID string) *PeerDBEntry {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	entry, ok := db.nodes[nodeID]
+	if !ok {
+		return nil
+	}
+	copied := *entry
+	return &copied
+}
+
+// Records returns the records of every known node
+func (db *PeerDB) Records() []*NodeRecord {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	records := make([]*NodeRecord, 0, len(db.nodes))
+	for _, entry := range db.nodes {
+		records = append(records, entry.Record)
+	}
+	return records
+}
+
+// Len returns the number of known nodes
+func (db *PeerDB) Len() int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return len(db.nodes)
+}
+
+// Save writes the database to its file, replacing it atomically
+func (db *PeerDB) Save() error {
+	if db.path == "" {
+		return nil
+	}
+
+	db.mu.RLock()
+	entries := make([]*PeerDBEntry, 0, len(db.nodes))
+	for _, entry := range db.nodes {
+		entries = append(entries, entry)
+	}
+	data, err := json.Marshal(entries)
+	db.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode peer database: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(db.path), filepath.Base(db.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write peer database: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write peer database: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write peer database: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), db.path); err != nil {
+		return fmt.Errorf("failed to write peer database: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,329 @@
+package network
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// BanThreshold is the score at or below which a peer is disconnected and banned
+	BanThreshold = -100.0
+
+	// MaxPeerScore caps the credit a peer can build up with useful data, so a
+	// long-lived peer can not buy itself room for misbehavior
+	MaxPeerScore = 100.0
+
+	// DefaultBanDuration is the length of a first ban, doubled for every
+	// repeated ban up to MaxBanDuration
+	DefaultBanDuration = time.Hour
+
+	// MaxBanDuration bounds automatic bans
+	MaxBanDuration = 24 * time.Hour
+
+	// scoreHalfLife is the time after which a score has decayed to half,
+	// old misbehavior and old merits are forgotten over time
+	scoreHalfLife = 10 * time.Minute
+)
+
+// Errors returned by message handlers to have the sending peer penalized
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrInvalidBlock     = errors.New("invalid block")
+	ErrInvalidMessage   = errors.New("malformed message")
+)
+
+// ScoreEvent is a peer behavior affecting its score
+type ScoreEvent struct {
+	Name  string
+	Delta float64
+}
+
+// Behaviors peers are scored on
+var (
+	ScoreInvalidSignature  = ScoreEvent{"invalid signature", -60}
+	ScoreInvalidBlock      = ScoreEvent{"invalid block", -40}
+	ScoreMalformedMessage  = ScoreEvent{"malformed message", -20}
+	ScoreRateLimited       = ScoreEvent{"rate limit exceeded", -5}
+	ScoreUsefulBlock       = ScoreEvent{"useful block", 5}
+	ScoreUsefulTransaction = ScoreEvent{"useful transaction", 0.5}
+)
+
+// ScoreEventForError returns the penalty for a message a handler rejected
+// with err, and false for errors that are no fault of the peer, such as
+// already known or outdated data
+func ScoreEventForError(err error) (ScoreEvent, bool) {
+	switch {
+	case errors.Is(err, ErrInvalidSignature):
+		return ScoreInvalidSignature, true
+	case errors.Is(err, ErrInvalidBlock):
+		return ScoreInvalidBlock, true
+	case errors.Is(err, ErrInvalidMessage):
+		return ScoreMalformedMessage, true
+	}
+	return ScoreEvent{}, false
+}
+
+// Ban is a peer refused until a point in time
+type Ban struct {
+	PeerID string    `json:"peerId"`
+	Reason string    `json:"reason"`
+	Since  time.Time `json:"since"`
+	Until  time.Time `json:"until"`
+	Count  int       `json:"count"` // Number of bans of the peer, lengthening the next one
+}
+
+type peerScore struct {
+	value   float64
+	updated time.Time
+}
+
+// PeerScorer keeps the reputation of peers by node ID. Misbehavior lowers
+// the score, useful data raises it, and both decay towards zero. Peers
+// dropping to BanThreshold are banned for a time that grows with every
+// repeated ban. A scorer can be shared by several networks, they register
+// with OnBan to disconnect the peers it bans.
+type PeerScorer struct {
+	path string
+
+	mu     sync.Mutex
+	scores map[string]*peerScore
+	bans   map[string]*Ban
+	onBan  []func(*Ban)
+}
+
+// NewPeerScorer creates a scorer keeping its bans in the file at path, an
+// empty path keeps them in memory
+func NewPeerScorer(path string) (*PeerScorer, error) {
+	s := &PeerScorer{
+		path:   path,
+		scores: make(map[string]*peerScore),
+		bans:   make(map[string]*Ban),
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ban list: %w", err)
+	}
+
+	var bans []*Ban
+	if err := json.Unmarshal(data, &bans); err != nil {
+		return nil, fmt.Errorf("invalid ban list %s: %w", path, err)
+	}
+	for _, ban := range bans {
+		if ban.PeerID != "" {
+			s.bans[ban.PeerID] = ban
+		}
+	}
+	return s, nil
+}
+
+// OnBan registers a function called with every new ban
+func (s *PeerScorer) OnBan(fn func(*Ban)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onBan = append(s.onBan, fn)
+}
+
+// Record applies a behavior to the score of a peer and reports whether the
+// peer is banned
+func (s *PeerScorer) Record(peerID string, event ScoreEvent) bool {
+	s.mu.Lock()
+	if s.isBanned(peerID) {
+		s.mu.Unlock()
+		return true
+	}
+
+	score := s.decayed(peerID)
+	score.value = math.Min(score.value+event.Delta, MaxPeerScore)
+	if score.value > BanThreshold {
+		s.mu.Unlock()
+		return false
+	}
+
+	ban := s.ban(peerID, fmt.Sprintf("score %.1f after %s", score.value, event.Name), 0)
+	callbacks := s.onBan
+	s.mu.Unlock()
+
+	s.banned(ban, callbacks)
+	return true
+}
+
+// Score returns the current score of a peer
+func (s *PeerScorer) Score(peerID string) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.scores[peerID]; !ok {
+		return 0
+	}
+	return s.decayed(peerID).value
+}
+
+// IsBanned reports whether a peer is currently banned
+func (s *PeerScorer) IsBanned(peerID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.isBanned(peerID)
+}
+
+// Ban bans a peer for the given duration, the default growing duration if 0
+func (s *PeerScorer) Ban(peerID, reason string, duration time.Duration) *Ban {
+	s.mu.Lock()
+	ban := s.ban(peerID, reason, duration)
+	callbacks := s.onBan
+	s.mu.Unlock()
+
+	s.banned(ban, callbacks)
+	copied := *ban
+	return &copied
+}
+
+// Unban lifts the ban of a peer and resets its score, reporting whether it
+// was banned
+func (s *PeerScorer) Unban(peerID string) bool {
+	s.mu.Lock()
+	banned := s.isBanned(peerID)
+	delete(s.bans, peerID)
+	delete(s.scores, peerID)
+	s.mu.Unlock()
+
+	if err := s.Save(); err != nil {
+		log.Printf("⚠️ Failed to save ban list: %v", err)
+	}
+	return banned
+}
+
+// Bans returns the active bans, the longest lasting first
+func (s *PeerScorer) Bans() []*Ban {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bans := make([]*Ban, 0, len(s.bans))
+	for id, ban := range s.bans {
+		if s.isBanned(id) {
+			copied := *ban
+			bans = append(bans, &copied)
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Until.After(bans[j].Until)
+	})
+	return bans
+}
+
+// Save writes the ban list to its file, replacing it atomically
+func (s *PeerScorer) Save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	bans := make([]*Ban, 0, len(s.bans))
+	for _, ban := range s.bans {
+		// Expired bans are kept for a day to lengthen the next ban of the peer
+		if time.Since(ban.Until) < MaxBanDuration {
+			bans = append(bans, ban)
+		}
+	}
+	data, err := json.Marshal(bans)
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode ban list: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write ban list: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write ban list: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write ban list: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to write ban list: %w", err)
+	}
+	return nil
+}
+
+// banned persists a new ban and has the networks disconnect the peer
+func (s *PeerScorer) banned(ban *Ban, callbacks []func(*Ban)) {
+	log.Printf("⛔ Banned peer %s until %s: %s", ban.PeerID, ban.Until.Format(time.RFC3339), ban.Reason)
+	if err := s.Save(); err != nil {
+		log.Printf("⚠️ Failed to save ban list: %v", err)
+	}
+	for _, fn := range callbacks {
+		fn(ban)
+	}
+}
+
+func (s *PeerScorer) isBanned(peerID string) bool {
+	ban, ok := s.bans[peerID]
+	return ok && time.Now().Before(ban.Until)
+}
+
+// ban records a ban of the peer, the caller holds the lock
+func (s *PeerScorer) ban(peerID, reason string, duration time.Duration) *Ban {
+	count := 1
+	if previous, ok := s.bans[peerID]; ok {
+		count = previous.Count + 1
+	}
+	if duration <= 0 {
+		duration = DefaultBanDuration
+		for i := 1; i < count && duration < MaxBanDuration; i++ {
+			duration *= 2
+		}
+		if duration > MaxBanDuration {
+			duration = MaxBanDuration
+		}
+	}
+
+	now := time.Now()
+	ban := &Ban{
+		PeerID: peerID,
+		Reason: reason,
+		Since:  now,
+		Until:  now.Add(duration),
+		Count:  count,
+	}
+	s.bans[peerID] = ban
+
+	// A peer comes back from its ban with a clean score
+	delete(s.scores, peerID)
+	return ban
+}
+
+// decayed returns the score of a peer decayed to now, the caller holds the lock
+func (s *PeerScorer) decayed(peerID string) *peerScore {
+	now := time.Now()
+	score, ok := s.scores[peerID]
+	if !ok {
+		score = &peerScore{updated: now}
+		s.scores[peerID] = score
+		return score
+	}
+	elapsed := now.Sub(score.updated)
+	score.value *= math.Pow(0.5, float64(elapsed)/float64(scoreHalfLife))
+	score.updated = now
+	return score
+}
@@ -0,0 +1,479 @@
+package network
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/types"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	// HandshakeTimeout bounds the time a peer has to complete the secure handshake
+	HandshakeTimeout = 10 * time.Second
+
+	// sessionProtocol names the handshake, it prefixes the transcript so
+	// sessions of other protocols can not be confused with it
+	sessionProtocol = "quantum-p2p/kyber512-dilithium2-aesgcm/1"
+)
+
+var (
+	// ErrHandshakeFailed is returned when a peer does not complete the secure handshake
+	ErrHandshakeFailed = errors.New("secure handshake failed")
+
+	// ErrFrameAuthentication is returned when a frame fails AEAD authentication
+	ErrFrameAuthentication = errors.New("frame authentication failed")
+)
+
+// Roles authenticated by the identity signatures, binding each signature to
+// one side of the session
+var (
+	initiatorRole = []byte("initiator")
+	responderRole = []byte("responder")
+)
+
+// NodeIdentity is the long-term Dilithium key a node proves in the handshake,
+// its peer ID is derived from the public key
+type NodeIdentity struct {
+	privateKey *crypto.DilithiumPrivateKey
+	publicKey  *crypto.DilithiumPublicKey
+	id         string
+}
+
+// GenerateNodeIdentity creates a new random node identity
+func GenerateNodeIdentity() (*NodeIdentity, error) {
+	priv, _, err := crypto.GenerateDilithiumKeyPair()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate node identity: %w", err)
+	}
+	return NewNodeIdentity(priv), nil
+}
+
+// NewNodeIdentity wraps a Dilithium private key as a node identity
+func NewNodeIdentity(priv *crypto.DilithiumPrivateKey) *NodeIdentity {
+	pub := priv.Public()
+	return &NodeIdentity{
+		privateKey: priv,
+		publicKey:  pub,
+		id:         NodeIDFromPublicKey(pub.Bytes()),
+	}
+}
+
+// LoadNodeIdentity reads the hex encoded Dilithium node key, generating and
+// storing a new one if the file does not exist
+func LoadNodeIdentity(path string) (*NodeIdentity, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		keyBytes, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid node key in %s: %w", path, err)
+		}
+		priv, err := crypto.DilithiumPrivateKeyFromBytes(keyBytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid node key in %s: %w", path, err)
+		}
+		return NewNodeIdentity(priv), nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read node key: %w", err)
+	}
+
+	identity, err := GenerateNodeIdentity()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(identity.privateKey.Bytes())), 0600); err != nil {
+		return nil, fmt.Errorf("failed to store node key: %w", err)
+	}
+	return identity, nil
+}
+
+// ID returns the peer ID of the identity
+func (id *NodeIdentity) ID() string {
+	return id.id
+}
+
+// PublicKey returns the Dilithium public key of the identity
+func (id *NodeIdentity) PublicKey() []byte {
+	return id.publicKey.Bytes()
+}
+
+// Sign signs data with the identity key
+func (id *NodeIdentity) Sign(data []byte) ([]byte, error) {
+	return id.privateKey.Sign(data)
+}
+
+// NodeIDFromPublicKey derives the peer ID of a Dilithium identity key
+func NodeIDFromPublicKey(publicKey []byte) string {
+	return hex.EncodeToString(types.Keccak256(publicKey))
+}
+
+// FrameConn is a message oriented connection the secure session runs over,
+// implemented by *websocket.Conn
+type FrameConn interface {
+	ReadMessage() (messageType int, data []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	SetReadDeadline(t time.Time) error
+	RemoteAddr() net.Addr
+	Close() error
+}
+
+// SecureConn is an authenticated and encrypted session with a peer. Every
+// frame is sealed with AES-GCM under the key of its direction, with the frame
+// counter as nonce, so frames can not be forged, replayed or reordered.
+type SecureConn struct {
+	conn FrameConn
+
+	localID         string
+	remoteID        string
+	remotePublicKey []byte
+	remotePayload   []byte
+
+	sendMu      sync.Mutex
+	sendCipher  cipher.AEAD
+	sendCounter uint64
+
+	recvMu      sync.Mutex
+	recvCipher  cipher.AEAD
+	recvCounter uint64
+}
+
+// handshakeAuth is the first encrypted frame of each side, proving its
+// identity by signing the handshake transcript
+type handshakeAuth struct {
+	PublicKey []byte `json:"publicKey"`
+	Signature []byte `json:"signature"`
+	Payload   []byte `json:"payload,omitempty"`
+}
+
+// Handshake establishes a secure session over conn. Both sides exchange
+// ephemeral Kyber keys and encapsulate a secret to each other, the session
+// keys are derived from both secrets and the transcript. Each side then
+// proves its identity by signing the transcript inside the encrypted channel.
+// The payload is authenticated with the identity and handed to the peer, it
+// carries the application handshake such as the network ID.
+func Handshake(conn FrameConn, identity *NodeIdentity, initiator bool, payload []byte) (*SecureConn, error) {
+	conn.SetReadDeadline(time.Now().Add(HandshakeTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	var (
+		secureConn *SecureConn
+		err        error
+	)
+	if initiator {
+		secureConn, err = initiateHandshake(conn, identity, payload)
+	} else {
+		secureConn, err = acceptHandshake(conn, identity, payload)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHandshakeFailed, err)
+	}
+	return secureConn, nil
+}
+
+// initiateHandshake runs the handshake as the dialing side:
+//
+//	-> e_i
+//	<- e_r, encaps(e_i)
+//	-> encaps(e_r)
+//	-> auth_i
+//	<- auth_r
+func initiateHandshake(conn FrameConn, identity *NodeIdentity, payload []byte) (*SecureConn, error) {
+	ephPriv, ephPub, err := crypto.GenerateKyberKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	hello := ephPub.Bytes()
+	if err := conn.WriteMessage(websocket.BinaryMessage, hello); err != nil {
+		return nil, fmt.Errorf("failed to send ephemeral key: %w", err)
+	}
+
+	reply, err := readHandshakeMessage(conn, crypto.KyberPublicKeySize+crypto.KyberCiphertextSize)
+	if err != nil {
+		return nil, err
+	}
+	remotePub, err := crypto.KyberPublicKeyFromBytes(reply[:crypto.KyberPublicKeySize])
+	if err != nil {
+		return nil, err
+	}
+	responderSecret, err := ephPriv.Decapsulate(reply[crypto.KyberPublicKeySize:])
+	if err != nil {
+		return nil, err
+	}
+
+	capsule, initiatorSecret, err := remotePub.Encapsulate()
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.WriteMessage(websocket.BinaryMessage, capsule); err != nil {
+		return nil, fmt.Errorf("failed to send capsule: %w", err)
+	}
+
+	transcript := transcriptHash(hello, reply, capsule)
+	secureConn, err := newSecureConn(conn, identity, transcript, responderSecret, initiatorSecret, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := secureConn.sendAuth(identity, transcript, initiatorRole, payload); err != nil {
+		return nil, err
+	}
+	if err := secureConn.receiveAuth(transcript, responderRole); err != nil {
+		return nil, err
+	}
+	return secureConn, nil
+}
+
+// acceptHandshake runs the handshake as the listening side
+func acceptHandshake(conn FrameConn, identity *NodeIdentity, payload []byte) (*SecureConn, error) {
+	hello, err := readHandshakeMessage(conn, crypto.KyberPublicKeySize)
+	if err != nil {
+		return nil, err
+	}
+	remotePub, err := crypto.KyberPublicKeyFromBytes(hello)
+	if err != nil {
+		return nil, err
+	}
+
+	ephPriv, ephPub, err := crypto.GenerateKyberKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	capsule, responderSecret, err := remotePub.Encapsulate()
+	if err != nil {
+		return nil, err
+	}
+	reply := append(ephPub.Bytes(), capsule...)
+	if err := conn.WriteMessage(websocket.BinaryMessage, reply); err != nil {
+		return nil, fmt.Errorf("failed to send ephemeral key: %w", err)
+	}
+
+	remoteCapsule, err := readHandshakeMessage(conn, crypto.KyberCiphertextSize)
+	if err != nil {
+		return nil, err
+	}
+	initiatorSecret, err := ephPriv.Decapsulate(remoteCapsule)
+	if err != nil {
+		return nil, err
+	}
+
+	transcript := transcriptHash(hello, reply, remoteCapsule)
+	secureConn, err := newSecureConn(conn, identity, transcript, responderSecret, initiatorSecret, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := secureConn.receiveAuth(transcript, initiatorRole); err != nil {
+		return nil, err
+	}
+	if err := secureConn.sendAuth(identity, transcript, responderRole, payload); err != nil {
+		return nil, err
+	}
+	return secureConn, nil
+}
+
+// readHandshakeMessage reads a plaintext handshake message of the expected size
+func readHandshakeMessage(conn FrameConn, size int) ([]byte, error) {
+	messageType, data, err := conn.ReadMessage()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read handshake message: %w", err)
+	}
+	if messageType != websocket.BinaryMessage || len(data) != size {
+		return nil, fmt.Errorf("malformed handshake message: %d bytes, want %d", len(data), size)
+	}
+	return data, nil
+}
+
+// transcriptHash commits to the protocol and every plaintext handshake message
+func transcriptHash(messages ...[]byte) []byte {
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write([]byte(sessionProtocol))
+	for _, msg := range messages {
+		hash.Write(binary.BigEndian.AppendUint32(nil, uint32(len(msg))))
+		hash.Write(msg)
+	}
+	return hash.Sum(nil)
+}
+
+// newSecureConn derives the keys of both directions from the two shared
+// secrets and the transcript
+func newSecureConn(conn FrameConn, identity *NodeIdentity, transcript, responderSecret, initiatorSecret []byte, initiator bool) (*SecureConn, error) {
+	keys := make([]byte, 64)
+	hash := sha3.NewShake256()
+	hash.Write([]byte(sessionProtocol))
+	hash.Write(transcript)
+	hash.Write(responderSecret)
+	hash.Write(initiatorSecret)
+	hash.Read(keys)
+
+	initiatorCipher, err := sessionCipher(keys[:32])
+	if err != nil {
+		return nil, err
+	}
+	responderCipher, err := sessionCipher(keys[32:])
+	if err != nil {
+		return nil, err
+	}
+
+	secureConn := &SecureConn{
+		conn:       conn,
+		localID:    identity.ID(),
+		sendCipher: responderCipher,
+		recvCipher: initiatorCipher,
+	}
+	if initiator {
+		secureConn.sendCipher, secureConn.recvCipher = initiatorCipher, responderCipher
+	}
+	return secureConn, nil
+}
+
+func sessionCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// authMessage is the data an identity signs to prove itself in a session
+func authMessage(transcript, role, payload []byte) []byte {
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write([]byte(sessionProtocol))
+	hash.Write(role)
+	hash.Write(transcript)
+	hash.Write(payload)
+	return hash.Sum(nil)
+}
+
+func (c *SecureConn) sendAuth(identity *NodeIdentity, transcript, role, payload []byte) error {
+	signature, err := identity.privateKey.Sign(authMessage(transcript, role, payload))
+	if err != nil {
+		return fmt.Errorf("failed to sign handshake: %w", err)
+	}
+	return c.WriteJSON(&handshakeAuth{
+		PublicKey: identity.PublicKey(),
+		Signature: signature,
+		Payload:   payload,
+	})
+}
+
+func (c *SecureConn) receiveAuth(transcript, role []byte) error {
+	var auth handshakeAuth
+	if err := c.ReadJSON(&auth); err != nil {
+		return fmt.Errorf("failed to read peer identity: %w", err)
+	}
+	publicKey, err := crypto.DilithiumPublicKeyFromBytes(auth.PublicKey)
+	if err != nil {
+		return fmt.Errorf("invalid peer identity: %w", err)
+	}
+	if !publicKey.Verify(authMessage(transcript, role, auth.Payload), auth.Signature) {
+		return errors.New("invalid peer identity signature")
+	}
+
+	c.remotePublicKey = auth.PublicKey
+	c.remoteID = NodeIDFromPublicKey(auth.PublicKey)
+	c.remotePayload = auth.Payload
+	if c.remoteID == c.localID {
+		return errors.New("connected to self")
+	}
+	return nil
+}
+
+// frameNonce returns the GCM nonce of the frame with the given counter
+func frameNonce(counter uint64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], counter)
+	return nonce
+}
+
+// WriteFrame encrypts and sends a frame
+func (c *SecureConn) WriteFrame(data []byte) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	sealed := c.sendCipher.Seal(nil, frameNonce(c.sendCounter), data, nil)
+	c.sendCounter++
+	return c.conn.WriteMessage(websocket.BinaryMessage, sealed)
+}
+
+// ReadFrame receives and decrypts the next frame. A frame failing
+// authentication breaks the session, the connection should be closed.
+func (c *SecureConn) ReadFrame() ([]byte, error) {
+	c.recvMu.Lock()
+	defer c.recvMu.Unlock()
+
+	messageType, sealed, err := c.conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	if messageType != websocket.BinaryMessage {
+		return nil, fmt.Errorf("%w: unexpected message type %d", ErrFrameAuthentication, messageType)
+	}
+	data, err := c.recvCipher.Open(nil, frameNonce(c.recvCounter), sealed, nil)
+	if err != nil {
+		return nil, ErrFrameAuthentication
+	}
+	c.recvCounter++
+	return data, nil
+}
+
+// WriteJSON encrypts and sends v encoded as JSON
+func (c *SecureConn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteFrame(data)
+}
+
+// ReadJSON receives the next frame and decodes it into v
+func (c *SecureConn) ReadJSON(v interface{}) error {
+	data, err := c.ReadFrame()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// RemoteID returns the peer ID derived from the identity the peer proved
+func (c *SecureConn) RemoteID() string {
+	return c.remoteID
+}
+
+// RemotePublicKey returns the Dilithium identity key of the peer
+func (c *SecureConn) RemotePublicKey() []byte {
+	return c.remotePublicKey
+}
+
+// RemotePayload returns the authenticated application handshake of the peer
+func (c *SecureConn) RemotePayload() []byte {
+	return c.remotePayload
+}
+
+// RemoteAddr returns the network address of the peer
+func (c *SecureConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// SetReadDeadline sets the deadline for reading the next frame
+func (c *SecureConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// Close closes the underlying connection
+func (c *SecureConn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,189 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"quantum-blockchain/chain/types"
+)
+
+// Block tags accepted wherever a block parameter is expected
+const (
+	BlockTagEarliest  = "earliest"
+	BlockTagLatest    = "latest"
+	BlockTagPending   = "pending"
+	BlockTagSafe      = "safe"
+	BlockTagFinalized = "finalized"
+)
+
+// BlockParam is a block number, tag or hash as accepted by the eth namespace.
+// Besides plain strings it accepts the EIP-1898 object form
+// {"blockNumber": "0x1"} or {"blockHash": "0x..", "requireCanonical": true}.
+type BlockParam struct {
+	Tag              string
+	Number           *uint64
+	Hash             *types.Hash
+	RequireCanonical bool
+}
+
+// LatestBlock is the block parameter used when a method omits it
+var LatestBlock = BlockParam{Tag: BlockTagLatest}
+
+// UnmarshalJSON decodes a block parameter from a string or an EIP-1898 object
+func (b *BlockParam) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		return b.parseString(str)
+	}
+
+	var obj struct {
+		BlockNumber      *string `json:"blockNumber"`
+		BlockHash        *string `json:"blockHash"`
+		RequireCanonical bool    `json:"requireCanonical"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return invalidParams("invalid block parameter: %v", err)
+	}
+
+	switch {
+	case obj.BlockNumber != nil && obj.BlockHash != nil:
+		return invalidParams("invalid block parameter: both blockNumber and blockHash given")
+	case obj.BlockNumber != nil:
+		return b.parseString(*obj.BlockNumber)
+	case obj.BlockHash != nil:
+		hash, err := types.HexToHash(*obj.BlockHash)
+		if err != nil {
+			return invalidParams("invalid block hash: %v", err)
+		}
+		b.Hash = &hash
+		b.RequireCanonical = obj.RequireCanonical
+		return nil
+	default:
+		return invalidParams("invalid block parameter: blockNumber or blockHash required")
+	}
+}
+
+func (b *BlockParam) parseString(str string) error {
+	switch str {
+	case BlockTagEarliest, BlockTagLatest, BlockTagPending, BlockTagSafe, BlockTagFinalized:
+		b.Tag = str
+		return nil
+	}
+
+	// A 32 byte hash is 66 characters including the 0x prefix
+	if len(str) == 66 {
+		hash, err := types.HexToHash(str)
+		if err != nil {
+			return invalidParams("invalid block hash: %v", err)
+		}
+		b.Hash = &hash
+		return nil
+	}
+
+	if !strings.HasPrefix(str, "0x") {
+		return invalidParams("invalid block number: %s", str)
+	}
+	num, err := strconv.ParseUint(str[2:], 16, 64)
+	if err != nil {
+		return invalidParams("invalid block number format: %v", err)
+	}
+	b.Number = &num
+	return nil
+}
+
+// IsPending reports whether the parameter refers to the pending block
+func (b BlockParam) IsPending() bool {
+	return b.Tag == BlockTagPending
+}
+
+// String returns a readable form of the parameter for error messages
+func (b BlockParam) String() string {
+	switch {
+	case b.Hash != nil:
+		return b.Hash.Hex()
+	case b.Number != nil:
+		return fmt.Sprintf("0x%x", *b.Number)
+	default:
+		return b.Tag
+	}
+}
+
+// parseBlockParam decodes the optional block parameter at index i of a
+// method's positional parameters, defaulting to latest when it is absent
+func parseBlockParam(p []interface{}, i int) (BlockParam, error) {
+	if len(p) <= i || p[i] == nil {
+		return LatestBlock, nil
+	}
+
+	data, err := json.Marshal(p[i])
+	if err != nil {
+		return BlockParam{}, invalidParams("invalid block parameter: %v", err)
+	}
+
+	var param BlockParam
+	if err := json.Unmarshal(data, &param); err != nil {
+		return BlockParam{}, err
+	}
+	return param, nil
+}
+
+// resolveBlock returns the block a parameter refers to. Blocks are final once
+// added because the chain does not reorganise, so safe and finalized resolve
+// to the head. The pending block resolves to the head it will build on.
+func (s *RPCServer) resolveBlock(param BlockParam) (*types.Block, error) {
+	bc := s.node.blockchain
+
+	if param.Hash != nil {
+		block, err := bc.GetBlockByHash(*param.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("block %s not found", param.Hash.Hex())
+		}
+		// Every stored block is canonical, but check the height index anyway
+		if param.RequireCanonical {
+			canonical, err := bc.GetBlockByNumber(block.Number())
+			if err != nil || !canonical.Hash().Equal(block.Hash()) {
+				return nil, fmt.Errorf("block %s is not canonical", param.Hash.Hex())
+			}
+		}
+		return block, nil
+	}
+
+	if param.Number != nil {
+		block, err := bc.GetBlockByNumber(new(big.Int).SetUint64(*param.Number))
+		if err != nil {
+			return nil, fmt.Errorf("block 0x%x not found", *param.Number)
+		}
+		return block, nil
+	}
+
+	switch param.Tag {
+	case BlockTagEarliest:
+		return bc.GetBlockByNumber(big.NewInt(0))
+	default:
+		return bc.GetCurrentBlock(), nil
+	}
+}
+
+// stateAt returns a state overlay and the block context for a block parameter.
+// For the pending block the pool transactions are applied on top of the head.
+// The overlay must be released by the caller.
+func (s *RPCServer) stateAt(param BlockParam) (*StateOverlay, *types.Block, error) {
+	block, err := s.resolveBlock(param)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	state, err := s.node.blockchain.StateAt(block.Number().Uint64())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if param.IsPending() {
+		block = s.applyPendingTransactions(state, block)
+	}
+
+	return state, block, nil
+}
@@ -26,11 +26,19 @@ type Blockchain struct {
 	mu            sync.RWMutex
 
 	// State management
-	stateDB *StateDB
+	stateDB      *StateDB
+	stateHistory uint64 // Blocks of reverse state diffs to retain, 0 keeps all
+
+	// Diffs below historyTail are known to be pruned once historyPruned is set
+	historyPruned bool
+	historyTail   uint64
 
 	// EVM execution engine
 	evm *evm.SimpleEVM
 
+	// State trees of recent blocks by block hash, see CacheStateRoot
+	stateTrees *stateTreeCache
+
 	// Chain metrics
 	totalDifficulty *big.Int
 	gasUsed         uint64
@@ -49,6 +57,11 @@ type Receipt struct {
 	ContractAddress   *types.Address `json:"contractAddress"`
 	Status            uint           `json:"status"` // 1 for success, 0 for failure
 	Logs              []*Log         `json:"logs"`
+	EffectiveGasPrice *big.Int       `json:"effectiveGasPrice"`  // Base fee plus the tip actually paid
+	FeePayer          *types.Address `json:"feePayer,omitempty"` // Account that paid for gas, if sponsored
+
+	// Outcome of every executed call of a batch transaction
+	CallResults []*evm.CallResult `json:"callResults,omitempty"`
 }
 
 // Log represents an event log (alias for Ethereum log)
@@ -63,6 +76,8 @@ type StateDB struct {
 	code       map[types.Address][]byte
 	codeHashes map[types.Address]types.Hash
 	suicides   map[types.Address]bool
+	journal    map[string]*journalEntry // Pre-images of keys written since the last journal commit
+	changed    map[string]bool          // Keys written since the state tree took them, see CacheStateRoot
 	mu         sync.RWMutex
 }
 
@@ -93,6 +108,8 @@ func NewStateDB(db *leveldb.DB) *StateDB {
 		code:       make(map[types.Address][]byte),
 		codeHashes: make(map[types.Address]types.Hash),
 		suicides:   make(map[types.Address]bool),
+		journal:    make(map[string]*journalEntry),
+		changed:    make(map[string]bool),
 	}
 }
 
@@ -128,6 +145,7 @@ func (s *StateDB) SetBalance(addr types.Address, balance *big.Int) {
 
 	// Persist to storage
 	key := append([]byte("balance-"), addr.Bytes()...)
+	s.recordPreimage(key)
 	s.db.Put(key, balance.Bytes(), nil)
 }
 
@@ -163,6 +181,7 @@ func (s *StateDB) SetNonce(addr types.Address, nonce uint64) {
 
 	// Persist to storage
 	key := append([]byte("nonce-"), addr.Bytes()...)
+	s.recordPreimage(key)
 	s.db.Put(key, big.NewInt(int64(nonce)).Bytes(), nil)
 }
 
@@ -207,6 +226,7 @@ func (s *StateDB) SetState(addr types.Address, hash types.Hash, value types.Hash
 
 	// Persist to storage
 	key := append(append([]byte("storage-"), addr.Bytes()...), hash.Bytes()...)
+	s.recordPreimage(key)
 	s.db.Put(key, value.Bytes(), nil)
 }
 
@@ -243,9 +263,11 @@ func (s *StateDB) SetCode(addr types.Address, code []byte) {
 
 	// Persist to storage
 	codeKey := append([]byte("code-"), addr.Bytes()...)
+	s.recordPreimage(codeKey)
 	s.db.Put(codeKey, code, nil)
 
 	hashKey := append([]byte("codehash-"), addr.Bytes()...)
+	s.recordPreimage(hashKey)
 	s.db.Put(hashKey, codeHash.Bytes(), nil)
 }
 
@@ -386,6 +408,7 @@ func NewBlockchain(dataDir string, genesisConfigPath string) (*Blockchain, error
 		genesisConfig:   genesisConfig,
 		totalDifficulty: big.NewInt(0),
 		gasUsed:         0,
+		stateTrees:      newStateTreeCache(),
 	}
 
 	// Initialize state database
@@ -426,6 +449,9 @@ func (bc *Blockchain) loadOrCreateGenesis() (*types.Block, error) {
 
 	// Create new genesis block
 	genesis := types.Genesis()
+	if bc.genesisConfig.Timestamp != 0 {
+		genesis.Header.Time = bc.genesisConfig.Timestamp
+	}
 
 	// Initialize genesis state
 	bc.initializeGenesisState(genesis)
@@ -485,6 +511,12 @@ func (bc *Blockchain) AddBlock(block *types.Block) error {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
 
+	// Everything written since the previous block (including its rewards)
+	// belongs to the reverse diff of the current head
+	if err := bc.stateDB.commitJournal(bc.currentBlock.Number().Uint64()); err != nil {
+		return fmt.Errorf("failed to commit state journal: %w", err)
+	}
+
 	// Validate block
 	err := bc.validateBlock(block)
 	if err != nil {
@@ -513,9 +545,22 @@ func (bc *Blockchain) AddBlock(block *types.Block) error {
 	bc.currentBlock = block
 	bc.db.Put([]byte("current-head"), block.Hash().Bytes(), nil)
 
+	if err := bc.pruneStateHistory(); err != nil {
+		fmt.Printf("⚠️ Failed to prune state history: %v\n", err)
+	}
+
 	return nil
 }
 
+// ValidateBlock checks a block on top of the current head without importing
+// it, validators check proposals before voting for them
+func (bc *Blockchain) ValidateBlock(block *types.Block) error {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	return bc.validateBlock(block)
+}
+
 func (bc *Blockchain) validateBlock(block *types.Block) error {
 	// Check parent hash
 	if !block.ParentHash().Equal(bc.currentBlock.Hash()) {
@@ -533,8 +578,60 @@ func (bc *Blockchain) validateBlock(block *types.Block) error {
 		return fmt.Errorf("block timestamp must be greater than parent")
 	}
 
+	// Check block size
+	if block.Size() > types.MaxBlockSize {
+		return fmt.Errorf("block too large: %d bytes, limit %d", block.Size(), types.MaxBlockSize)
+	}
+
+	// Check base fee
+	expectedBaseFee := types.CalcBaseFee(bc.currentBlock.Header)
+	if block.BaseFee() == nil || block.BaseFee().Cmp(expectedBaseFee) != 0 {
+		return fmt.Errorf("invalid base fee: have %v, want %s", block.BaseFee(), expectedBaseFee)
+	}
+
+	// The block reveals the payload keys of the encrypted transactions its
+	// parent ordered, every key it reveals must decrypt its payload
+	if err := block.ValidateDecryptionKeys(bc.currentBlock); err != nil {
+		return err
+	}
+	waiting := make(map[types.Address]bool)
+	for _, tx := range bc.currentBlock.EncryptedTransactions() {
+		waiting[tx.From()] = true
+	}
+
+	// The consensus engine checks the evidence and the commit votes itself,
+	// the header commits to them
+	if err := block.ValidateEvidenceRoot(); err != nil {
+		return err
+	}
+	if err := block.ValidateLastCommitHash(); err != nil {
+		return err
+	}
+
 	// Validate transactions
 	for _, tx := range block.Transactions {
+		// Encrypted transactions execute in the next block, their senders send
+		// nothing else until then
+		if waiting[tx.From()] {
+			return fmt.Errorf("transaction %s: sender awaits the execution of its encrypted transaction", tx.Hash().Hex())
+		}
+		if tx.IsEncrypted() {
+			waiting[tx.From()] = true
+		}
+
+		if err := tx.ValidateFees(); err != nil {
+			return fmt.Errorf("invalid transaction fees: %w", err)
+		}
+		if tx.GetGasFeeCap().Cmp(expectedBaseFee) < 0 {
+			return fmt.Errorf("transaction %s: %w", tx.Hash().Hex(), types.ErrFeeCapTooLow)
+		}
+		if err := checkTransactionLimits(tx); err != nil {
+			return fmt.Errorf("transaction %s: %w", tx.Hash().Hex(), err)
+		}
+		if err := tx.CheckEncryptionEpoch(block.Number().Uint64()); err != nil {
+			return fmt.Errorf("transaction %s: %w", tx.Hash().Hex(), err)
+		}
+
 		valid, err := tx.VerifySignature()
 		if err != nil {
 			return fmt.Errorf("transaction verification failed: %w", err)
@@ -551,28 +648,54 @@ func (bc *Blockchain) validateBlock(block *types.Block) error {
 			return fmt.Errorf("invalid nonce for transaction from %s", tx.From().Hex())
 		}
 
-		// Check balance
-		balance := bc.stateDB.GetBalance(tx.From())
-		cost := new(big.Int).Mul(big.NewInt(int64(tx.GetGas())), tx.GetGasPrice())
-		cost.Add(cost, tx.GetValue())
-
-		if balance.Cmp(cost) < 0 {
-			fmt.Printf("❌ Insufficient balance for tx from %s: balance=%s, cost=%s\n",
-				tx.From().Hex(), balance.String(), cost.String())
-			return fmt.Errorf("insufficient balance for transaction from %s: balance=%s, cost=%s",
-				tx.From().Hex(), balance.String(), cost.String())
+		// Check balances of the gas payer and the sender
+		if err := tx.CheckBalances(bc.stateDB.GetBalance); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return err
 		}
 	}
 
 	return nil
 }
 
+// executedTransactions returns the transactions a block executes in order,
+// with the payload keys of the encrypted ones: first the encrypted
+// transactions its parent ordered, with the keys the block reveals, then its
+// own transactions but the encrypted ones, which the next block executes
+func (bc *Blockchain) executedTransactions(block *types.Block) ([]*types.QuantumTransaction, [][]byte, error) {
+	var txs []*types.QuantumTransaction
+	var keys [][]byte
+	if block.Number().Sign() > 0 {
+		parent, err := bc.getBlockByHash(block.ParentHash())
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load parent block: %w", err)
+		}
+		encrypted := parent.EncryptedTransactions()
+		if len(block.DecryptionKeys) != len(encrypted) {
+			return nil, nil, fmt.Errorf("block has %d decryption keys for %d encrypted transactions of its parent", len(block.DecryptionKeys), len(encrypted))
+		}
+		txs = append(txs, encrypted...)
+		keys = append(keys, block.DecryptionKeys...)
+	}
+	for _, tx := range block.Transactions {
+		if !tx.IsEncrypted() {
+			txs = append(txs, tx)
+			keys = append(keys, nil)
+		}
+	}
+	return txs, keys, nil
+}
+
 func (bc *Blockchain) executeTransactions(block *types.Block) ([]*Receipt, error) {
-	receipts := make([]*Receipt, 0, len(block.Transactions))
+	txs, keys, err := bc.executedTransactions(block)
+	if err != nil {
+		return nil, err
+	}
+	receipts := make([]*Receipt, 0, len(txs))
 	cumulativeGasUsed := uint64(0)
 
-	for i, tx := range block.Transactions {
-		receipt, err := bc.executeTransaction(tx, block, uint(i), cumulativeGasUsed)
+	for i, tx := range txs {
+		receipt, err := bc.executeTransaction(bc.stateDB, bc.evm, tx, keys[i], block, uint(i), cumulativeGasUsed)
 		if err != nil {
 			return nil, fmt.Errorf("failed to execute transaction %s: %w", tx.Hash().Hex(), err)
 		}
@@ -588,78 +711,236 @@ func (bc *Blockchain) executeTransactions(block *types.Block) ([]*Receipt, error
 	return receipts, nil
 }
 
-func (bc *Blockchain) executeTransaction(tx *types.QuantumTransaction, block *types.Block, txIndex uint, cumulativeGasUsed uint64) (*Receipt, error) {
-	from := tx.From()
+// BlockGasUsed executes the transactions of a block on top of its parent
+// state, without changing the chain, and returns the gas they use. Producers
+// set it in the header before signing, as AddBlock overwrites it.
+func (bc *Blockchain) BlockGasUsed(block *types.Block) (uint64, error) {
+	state, err := bc.parentState(block)
+	if err != nil {
+		return 0, err
+	}
+	defer state.Release()
+
+	txs, keys, err := bc.executedTransactions(block)
+	if err != nil {
+		return 0, err
+	}
+	executor := evm.NewSimpleEVM(state, big.NewInt(8888))
+	gasUsed := uint64(0)
+	for i, tx := range txs {
+		receipt, err := bc.executeTransaction(state, executor, tx, keys[i], block, uint(i), gasUsed)
+		if err != nil {
+			return 0, fmt.Errorf("failed to execute transaction %s: %w", tx.Hash().Hex(), err)
+		}
+		gasUsed += receipt.GasUsed
+	}
+	return gasUsed, nil
+}
+
+// executeTransaction executes a transaction of a block, decrypting an
+// encrypted one with its payload key
+func (bc *Blockchain) executeTransaction(state evm.StateInterface, executor *evm.SimpleEVM, tx *types.QuantumTransaction, key []byte, block *types.Block, txIndex uint, cumulativeGasUsed uint64) (*Receipt, error) {
+	msg := evm.TransactionToMessage(tx)
+	if tx.IsEncrypted() {
+		// The parent checked the transaction against its own state, it fails
+		// without effect if it no longer applies
+		if err := checkDeferredTransaction(state, tx, block.BaseFee()); err != nil {
+			return &Receipt{
+				TxHash:            tx.Hash(),
+				TxIndex:           txIndex,
+				BlockHash:         block.Hash(),
+				BlockNumber:       block.Number(),
+				From:              tx.From(),
+				CumulativeGasUsed: cumulativeGasUsed,
+				Status:            0,
+				FeePayer:          tx.FeePayer,
+			}, nil
+		}
+		msg = evm.DecryptMessage(tx, key)
+	} else if err := evm.CheckSigningKeys(tx, evm.KeyBindings(state)); err != nil {
+		// The signing keys must be bound to the sender and fee payer at this point of the block
+		return nil, err
+	}
+
+	result, err := bc.applyMessage(state, executor, msg, block)
+	if err != nil {
+		return nil, err
+	}
+
+	status := uint(1) // Success
+	if result.Err != nil {
+		status = 0 // Failure
+	}
+
+	return &Receipt{
+		TxHash:            tx.Hash(),
+		TxIndex:           txIndex,
+		BlockHash:         block.Hash(),
+		BlockNumber:       block.Number(),
+		From:              tx.From(),
+		To:                msg.To,
+		GasUsed:           result.GasUsed,
+		CumulativeGasUsed: cumulativeGasUsed + result.GasUsed,
+		ContractAddress:   result.ContractAddress,
+		Status:            status,
+		Logs:              result.Logs,
+		EffectiveGasPrice: result.EffectiveGasPrice,
+		CallResults:       result.CallResults,
+		FeePayer:          tx.FeePayer,
+	}, nil
+}
+
+// checkDeferredTransaction checks that an encrypted transaction ordered by
+// the parent block still applies to the state it executes on
+func checkDeferredTransaction(state evm.StateInterface, tx *types.QuantumTransaction, baseFee *big.Int) error {
+	if nonce := state.GetNonce(tx.From()); tx.GetNonce() != nonce {
+		return fmt.Errorf("invalid nonce: have %d, want %d", tx.GetNonce(), nonce)
+	}
+	if err := evm.CheckSigningKeys(tx, evm.KeyBindings(state)); err != nil {
+		return err
+	}
+	if baseFee != nil && tx.GetGasFeeCap().Cmp(baseFee) < 0 {
+		return types.ErrFeeCapTooLow
+	}
+	return tx.CheckBalances(state.GetBalance)
+}
+
+// messageResult is the outcome of applying a message to the state
+type messageResult struct {
+	GasUsed           uint64
+	EffectiveGasPrice *big.Int
+	ReturnData        []byte
+	ContractAddress   *types.Address
+	Logs              []*Log
+	CallResults       []*evm.CallResult
+	Err               error // Execution error, gas is still charged
+}
 
-	// Pre-execution validation
-	balance := bc.stateDB.GetBalance(from)
-	cost := new(big.Int).Mul(big.NewInt(int64(tx.GetGas())), tx.GetGasPrice())
-	cost.Add(cost, tx.GetValue())
+// applyMessage charges the gas payer for gas, executes the message, burns the
+// base fee and pays the tip to the block producer. An error is only returned
+// if the message cannot be applied at all, execution failures are reported in
+// the result.
+func (bc *Blockchain) applyMessage(state evm.StateInterface, executor *evm.SimpleEVM, msg *evm.Message, block *types.Block) (*messageResult, error) {
+	from := msg.From
+
+	// Legacy messages pay their gas price both as fee cap and as tip
+	feeCap, tipCap := msg.GasFeeCap, msg.GasTipCap
+	if feeCap == nil {
+		feeCap = msg.GasPrice
+	}
+	if tipCap == nil {
+		tipCap = msg.GasPrice
+	}
 
-	if balance.Cmp(cost) < 0 {
+	baseFee := block.BaseFee()
+	if msg.NoBaseFee && feeCap.Sign() == 0 && tipCap.Sign() == 0 {
+		baseFee = nil
+	}
+	tip, err := types.EffectiveGasTip(feeCap, tipCap, baseFee)
+	if err != nil {
+		return nil, fmt.Errorf("%w: address %s, max fee per gas %s, base fee %s", err, from.Hex(), feeCap, baseFee)
+	}
+	gasPrice := new(big.Int).Set(tip)
+	if baseFee != nil {
+		gasPrice.Add(gasPrice, baseFee)
+	}
+
+	applied := *msg
+	applied.GasPrice = gasPrice
+	msg = &applied
+
+	// The value of an encrypted payload is only known once it is decrypted, a
+	// sender that can not cover it fails the transaction instead of the block
+	if msg.Encrypted && msg.DecryptErr == nil {
+		needed := new(big.Int).Set(msg.Value)
+		if msg.GasPayer() == from {
+			needed.Add(needed, new(big.Int).Mul(new(big.Int).SetUint64(msg.Gas), feeCap))
+		}
+		if state.GetBalance(from).Cmp(needed) < 0 {
+			msg.Value = new(big.Int)
+			msg.DecryptErr = fmt.Errorf("insufficient balance for encrypted payload value")
+		}
+	}
+
+	tracer := executor.Tracer()
+	if tracer != nil {
+		var to types.Address
+		if msg.To != nil {
+			to = *msg.To
+		}
+		env := &evm.TraceEnv{State: state, Coinbase: block.Coinbase(), BlockNumber: block.Number()}
+		tracer.CaptureStart(env, from, to, msg.To == nil && !msg.IsBatch() && !msg.IsKeyRotation() && !msg.Unjail && msg.DecryptErr == nil, msg.Data, msg.Gas, msg.Value)
+	}
+
+	// Pre-execution validation, the gas payer must be able to pay the full fee
+	// cap and the sender the transferred value
+	payer := msg.GasPayer()
+	balance := state.GetBalance(payer)
+	maxCost := new(big.Int).Mul(new(big.Int).SetUint64(msg.Gas), feeCap)
+	if payer == from {
+		maxCost.Add(maxCost, msg.Value)
+	}
+
+	if balance.Cmp(maxCost) < 0 {
 		return nil, fmt.Errorf("insufficient balance for transaction")
 	}
+	if payer != from && state.GetBalance(from).Cmp(msg.Value) < 0 {
+		return nil, fmt.Errorf("insufficient balance for transaction")
+	}
+	gasCost := new(big.Int).Mul(new(big.Int).SetUint64(msg.Gas), msg.GasPrice)
 
-	// Deduct gas cost upfront
-	balance.Sub(balance, cost)
-	bc.stateDB.SetBalance(from, balance)
+	// Deduct gas cost upfront from the gas payer, the value is moved by the EVM
+	balance.Sub(balance, gasCost)
+	state.SetBalance(payer, balance)
 
 	// Increment nonce
-	nonce := bc.stateDB.GetNonce(from)
-	bc.stateDB.SetNonce(from, nonce+1)
-
-	// Execute transaction using EVM
-	result, err := bc.evm.ExecuteTransaction(tx, block, block.Header.GasLimit)
+	nonce := state.GetNonce(from)
+	state.SetNonce(from, nonce+1)
 
-	var (
-		gasUsed         uint64
-		contractAddress *types.Address
-		status          uint = 1 // Success
-		logs            []*Log
-	)
+	// Execute transaction using EVM, bounded by the gas the message pays for
+	result, err := executor.ExecuteMessage(msg, block, msg.Gas)
 
+	outcome := &messageResult{EffectiveGasPrice: gasPrice}
 	if err != nil {
 		// Transaction failed, but still consume gas
-		gasUsed = tx.GetGas() // Use all gas on failure
-		status = 0            // Failure
-		logs = []*Log{}
+		outcome.GasUsed = msg.Gas // Use all gas on failure
+		outcome.Logs = []*Log{}
+		outcome.Err = err
 	} else {
-		gasUsed = result.GasUsed
-		contractAddress = result.ContractAddress
-		logs = result.Logs
+		outcome.GasUsed = result.GasUsed
+		outcome.ContractAddress = result.ContractAddress
+		outcome.ReturnData = result.ReturnData
+		outcome.CallResults = result.CallResults
+		outcome.Err = result.Err
 
 		// Success - convert logs (simplified for now)
 		// In a real implementation, we would properly convert the log structure
-		logs = []*Log{} // Empty logs for now
+		outcome.Logs = []*Log{} // Empty logs for now
+	}
+	if outcome.GasUsed > msg.Gas {
+		outcome.GasUsed = msg.Gas
 	}
 
 	// Refund unused gas
-	if gasUsed < tx.GetGas() {
-		refund := new(big.Int).Mul(big.NewInt(int64(tx.GetGas()-gasUsed)), tx.GetGasPrice())
-		balance = bc.stateDB.GetBalance(from)
+	if outcome.GasUsed < msg.Gas {
+		refund := new(big.Int).Mul(new(big.Int).SetUint64(msg.Gas-outcome.GasUsed), msg.GasPrice)
+		balance = state.GetBalance(payer)
 		balance.Add(balance, refund)
-		bc.stateDB.SetBalance(from, balance)
+		state.SetBalance(payer, balance)
 	}
 
-	// Give gas fees to block producer (coinbase)
-	gasFees := new(big.Int).Mul(big.NewInt(int64(gasUsed)), tx.GetGasPrice())
-	producerBalance := bc.stateDB.GetBalance(block.Coinbase())
-	producerBalance.Add(producerBalance, gasFees)
-	bc.stateDB.SetBalance(block.Coinbase(), producerBalance)
+	// Only the tip goes to the block producer (coinbase), the base fee part
+	// of the charged gas is not credited to anyone and is thereby burned
+	tipFees := new(big.Int).Mul(new(big.Int).SetUint64(outcome.GasUsed), tip)
+	producerBalance := state.GetBalance(block.Coinbase())
+	producerBalance.Add(producerBalance, tipFees)
+	state.SetBalance(block.Coinbase(), producerBalance)
 
-	return &Receipt{
-		TxHash:            tx.Hash(),
-		TxIndex:           txIndex,
-		BlockHash:         block.Hash(),
-		BlockNumber:       block.Number(),
-		From:              from,
-		To:                tx.GetTo(),
-		GasUsed:           gasUsed,
-		CumulativeGasUsed: cumulativeGasUsed + gasUsed,
-		ContractAddress:   contractAddress,
-		Status:            status,
-		Logs:              logs,
-	}, nil
+	if tracer != nil {
+		tracer.CaptureEnd(outcome.ReturnData, outcome.GasUsed, outcome.Err)
+	}
+
+	return outcome, nil
 }
 
 func (bc *Blockchain) storeReceipts(blockHash types.Hash, receipts []*Receipt) error {
@@ -831,6 +1112,11 @@ func (bc *Blockchain) GetBalance(addr types.Address) *big.Int {
 	return bc.stateDB.GetBalance(addr)
 }
 
+// GetKeyBinding returns the key currently bound to a rotated account, or nil
+func (bc *Blockchain) GetKeyBinding(addr types.Address) *evm.KeyBinding {
+	return evm.KeyBindingAt(bc.stateDB, addr)
+}
+
 // GetNonce returns the nonce of an address
 func (bc *Blockchain) GetNonce(addr types.Address) uint64 {
 	return bc.stateDB.GetNonce(addr)
@@ -852,6 +1138,10 @@ func (bc *Blockchain) Close() error {
 	defer bc.mu.Unlock()
 
 	if bc.db != nil {
+		// Keep the pending reverse diff so history survives a restart
+		if err := bc.stateDB.commitJournal(bc.currentBlock.Number().Uint64()); err != nil {
+			fmt.Printf("Error committing state journal: %v\n", err)
+		}
 		return bc.db.Close()
 	}
 
@@ -0,0 +1,413 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"quantum-blockchain/chain/network"
+	"quantum-blockchain/chain/types"
+)
+
+const (
+	// shortIDLength is the size of the short transaction IDs of compact blocks
+	shortIDLength = 6
+
+	// maxCompactBlockTxs bounds the transactions a compact block may announce
+	maxCompactBlockTxs = 16384
+
+	// recentBlockCount is the number of relayed blocks kept to serve the
+	// transactions peers miss to rebuild them
+	recentBlockCount = 16
+
+	// seenBlockCacheSize is the number of block hashes remembered as handled
+	seenBlockCacheSize = 1024
+
+	// compactBlockTimeout is how long a block waits for its missing transactions
+	compactBlockTimeout = 5 * time.Second
+)
+
+// PrefilledTransaction is a transaction sent along a compact block because
+// the receiver is not known to have it
+type PrefilledTransaction struct {
+	Index uint32                    `json:"index"`
+	Tx    *types.QuantumTransaction `json:"tx"`
+}
+
+// CompactBlockData relays a block by its header and the short IDs of its
+// transactions, which the receiver looks up in its pool
+type CompactBlockData struct {
+	Header         *types.BlockHeader      `json:"header"`
+	ShortIDs       []byte                  `json:"shortIds"` // shortIDLength bytes per transaction, in block order
+	Prefilled      []*PrefilledTransaction `json:"prefilled,omitempty"`
+	DecryptionKeys [][]byte                `json:"decryptionKeys,omitempty"`
+	Evidence       [][]byte                `json:"evidence,omitempty"`
+	LastCommit     []*types.CommitSig      `json:"lastCommit,omitempty"`
+}
+
+// GetBlockTransactionsData requests the transactions missing to rebuild a block
+type GetBlockTransactionsData struct {
+	BlockHash types.Hash `json:"blockHash"`
+	Indexes   []uint32   `json:"indexes"`
+}
+
+// BlockTransactionsData answers a GetBlockTransactions request in the
+// order of the requested indexes
+type BlockTransactionsData struct {
+	BlockHash    types.Hash                  `json:"blockHash"`
+	Transactions []*types.QuantumTransaction `json:"transactions"`
+}
+
+// CompactBlockStats counts the compact block relay of the network
+type CompactBlockStats struct {
+	Sent          uint64 `json:"sent"`          // Compact blocks sent
+	Prefilled     uint64 `json:"prefilled"`     // Transactions sent along compact blocks
+	Reconstructed uint64 `json:"reconstructed"` // Blocks rebuilt from compact blocks
+	Requested     uint64 `json:"requested"`     // Missing transactions requested
+}
+
+// blockRelay rebuilds compact blocks from the transaction pool and keeps
+// the recent blocks peers may request transactions of
+type blockRelay struct {
+	pending func() []*types.QuantumTransaction
+	seen    *hashCache
+
+	mu          sync.Mutex
+	recent      map[types.Hash]*types.Block
+	recentOrder []types.Hash
+	partial     map[types.Hash]*partialBlock
+
+	sent, prefilled, reconstructed, requested atomic.Uint64
+}
+
+// partialBlock is a compact block waiting for its missing transactions
+type partialBlock struct {
+	compact  *CompactBlockData
+	txs      []*types.QuantumTransaction
+	missing  []uint32
+	peerID   string
+	fetchAll bool // Every transaction was requested after a short ID collision
+	started  time.Time
+}
+
+func newBlockRelay() *blockRelay {
+	return &blockRelay{
+		seen:    newHashCache(seenBlockCacheSize),
+		recent:  make(map[types.Hash]*types.Block),
+		partial: make(map[types.Hash]*partialBlock),
+	}
+}
+
+// SetPendingTransactions sets the lookup of the pooled transactions compact
+// blocks are rebuilt from
+func (p2p *P2PNetwork) SetPendingTransactions(pending func() []*types.QuantumTransaction) {
+	p2p.relay.pending = pending
+}
+
+// CompactBlockStats returns the counters of the compact block relay
+func (p2p *P2PNetwork) CompactBlockStats() *CompactBlockStats {
+	r := p2p.relay
+	return &CompactBlockStats{
+		Sent:          r.sent.Load(),
+		Prefilled:     r.prefilled.Load(),
+		Reconstructed: r.reconstructed.Load(),
+		Requested:     r.requested.Load(),
+	}
+}
+
+// BroadcastBlock relays a block to all peers as a compact block, prefilled
+// with the transactions each peer is not known to have
+func (p2p *P2PNetwork) BroadcastBlock(block *types.Block) {
+	hash := block.Hash()
+	p2p.relay.seen.Add(hash)
+	p2p.relay.remember(block)
+
+	shortIDs := make([]byte, 0, len(block.Transactions)*shortIDLength)
+	for _, tx := range block.Transactions {
+		shortIDs = append(shortIDs, shortTxID(hash, tx.Hash())...)
+	}
+
+	for _, peer := range p2p.GetPeers() {
+		compact := &CompactBlockData{
+			Header:         block.Header,
+			ShortIDs:       shortIDs,
+			DecryptionKeys: block.DecryptionKeys,
+			Evidence:       block.Evidence,
+			LastCommit:     block.LastCommit,
+		}
+		for i, tx := range block.Transactions {
+			if !peer.knownTxs.Add(tx.Hash()) {
+				continue
+			}
+			compact.Prefilled = append(compact.Prefilled, &PrefilledTransaction{Index: uint32(i), Tx: tx})
+		}
+		p2p.relay.sent.Add(1)
+		p2p.relay.prefilled.Add(uint64(len(compact.Prefilled)))
+
+		go func(p *Peer, msg *P2PMessage) {
+			if err := p.SendMessage(msg); err != nil {
+				log.Printf("Failed to send block to peer %s: %v", p.ID, err)
+			}
+		}(peer, p2p.newMessage(MsgTypeCompactBlock, compact))
+	}
+}
+
+// deliverBlock hands a block from a peer to the block handler, a block it
+// accepts is useful. Only accepted blocks are marked seen, so a bad relay of
+// a block does not shut out the block from honest peers.
+func (p2p *P2PNetwork) deliverBlock(peer *Peer, block *types.Block) error {
+	if p2p.onBlock != nil {
+		if err := p2p.onBlock(block); err != nil {
+			return err
+		}
+		p2p.scorer.Record(peer.ID, network.ScoreUsefulBlock)
+	}
+	p2p.relay.seen.Add(block.Hash())
+	return nil
+}
+
+func (p2p *P2PNetwork) handleCompactBlock(peer *Peer, data json.RawMessage) error {
+	var compact CompactBlockData
+	if err := json.Unmarshal(data, &compact); err != nil {
+		return fmt.Errorf("%w: failed to unmarshal compact block: %v", network.ErrInvalidMessage, err)
+	}
+	if compact.Header == nil || len(compact.ShortIDs)%shortIDLength != 0 {
+		return fmt.Errorf("%w: malformed compact block", network.ErrInvalidMessage)
+	}
+	if err := compact.Header.ValidateFields(); err != nil {
+		return fmt.Errorf("%w: %v", network.ErrInvalidMessage, err)
+	}
+	count := len(compact.ShortIDs) / shortIDLength
+	if count > maxCompactBlockTxs {
+		return fmt.Errorf("%w: compact block of %d transactions", network.ErrInvalidMessage, count)
+	}
+
+	hash := compact.Header.Hash()
+	r := p2p.relay
+	if r.seen.Contains(hash) {
+		return nil
+	}
+	r.mu.Lock()
+	r.expirePartial(time.Now())
+	_, building := r.partial[hash]
+	r.mu.Unlock()
+	if building {
+		return nil
+	}
+
+	partial := &partialBlock{
+		compact: &compact,
+		txs:     make([]*types.QuantumTransaction, count),
+		peerID:  peer.ID,
+		started: time.Now(),
+	}
+	for _, prefilled := range compact.Prefilled {
+		if prefilled == nil || prefilled.Tx == nil || int(prefilled.Index) >= count {
+			return fmt.Errorf("%w: invalid prefilled transaction", network.ErrInvalidMessage)
+		}
+		partial.txs[prefilled.Index] = prefilled.Tx
+		peer.knownTxs.Add(prefilled.Tx.Hash())
+	}
+
+	// Look up the other transactions in the pool by their short IDs
+	pooled := make(map[string]*types.QuantumTransaction)
+	if r.pending != nil && len(compact.Prefilled) < count {
+		for _, tx := range r.pending() {
+			pooled[string(shortTxID(hash, tx.Hash()))] = tx
+		}
+	}
+	for i := range partial.txs {
+		if partial.txs[i] != nil {
+			continue
+		}
+		if tx, ok := pooled[string(compact.ShortIDs[i*shortIDLength:(i+1)*shortIDLength])]; ok {
+			partial.txs[i] = tx
+		} else {
+			partial.missing = append(partial.missing, uint32(i))
+		}
+	}
+
+	if len(partial.missing) == 0 {
+		return p2p.completeBlock(peer, partial)
+	}
+	return p2p.requestBlockTransactions(peer, partial)
+}
+
+// requestBlockTransactions asks the peer relaying a block for the
+// transactions missing to rebuild it
+func (p2p *P2PNetwork) requestBlockTransactions(peer *Peer, partial *partialBlock) error {
+	hash := partial.compact.Header.Hash()
+	r := p2p.relay
+	r.mu.Lock()
+	r.partial[hash] = partial
+	r.mu.Unlock()
+	r.requested.Add(uint64(len(partial.missing)))
+
+	request := &GetBlockTransactionsData{BlockHash: hash, Indexes: partial.missing}
+	if err := peer.SendMessage(p2p.newMessage(MsgTypeGetBlockTransactions, request)); err != nil {
+		log.Printf("Failed to request block transactions from peer %s: %v", peer.ID, err)
+	}
+	return nil
+}
+
+// completeBlock checks a rebuilt block against the roots of its header and
+// delivers it. On a transaction root mismatch, which a short ID collision with
+// a pooled transaction can cause, every transaction is fetched from the peer.
+func (p2p *P2PNetwork) completeBlock(peer *Peer, partial *partialBlock) error {
+	compact := partial.compact
+	block := &types.Block{
+		Header:         compact.Header,
+		Transactions:   partial.txs,
+		DecryptionKeys: compact.DecryptionKeys,
+		Evidence:       compact.Evidence,
+		LastCommit:     compact.LastCommit,
+	}
+	hash := compact.Header.Hash()
+
+	// The rest of the body is sent in full, it must match the header as is
+	if err := validateBlockBody(block); err != nil {
+		p2p.relay.forget(hash)
+		return fmt.Errorf("%w: block #%d: %v", network.ErrInvalidBlock, compact.Header.Number, err)
+	}
+
+	if block.TxRoot() != compact.Header.TxHash {
+		if partial.fetchAll {
+			p2p.relay.forget(hash)
+			return fmt.Errorf("%w: transactions of block #%d do not match its root", network.ErrInvalidBlock, compact.Header.Number)
+		}
+		partial.fetchAll = true
+		partial.txs = make([]*types.QuantumTransaction, len(partial.txs))
+		partial.missing = make([]uint32, len(partial.txs))
+		for i := range partial.missing {
+			partial.missing[i] = uint32(i)
+		}
+		return p2p.requestBlockTransactions(peer, partial)
+	}
+
+	p2p.relay.forget(hash)
+	p2p.relay.reconstructed.Add(1)
+	for _, tx := range block.Transactions {
+		peer.knownTxs.Add(tx.Hash())
+	}
+	if err := p2p.deliverBlock(peer, block); err != nil {
+		return err
+	}
+	p2p.relay.remember(block)
+	return nil
+}
+
+// validateBlockBody checks the evidence, the commit votes and the decryption
+// keys of a block against the roots of its header
+func validateBlockBody(block *types.Block) error {
+	if err := block.ValidateEvidenceRoot(); err != nil {
+		return err
+	}
+	if err := block.ValidateLastCommitHash(); err != nil {
+		return err
+	}
+	return block.ValidateDecryptionRoot()
+}
+
+func (p2p *P2PNetwork) handleGetBlockTransactions(peer *Peer, data json.RawMessage) error {
+	var request GetBlockTransactionsData
+	if err := json.Unmarshal(data, &request); err != nil {
+		return fmt.Errorf("%w: failed to unmarshal block transactions request: %v", network.ErrInvalidMessage, err)
+	}
+
+	r := p2p.relay
+	r.mu.Lock()
+	block, ok := r.recent[request.BlockHash]
+	r.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("request of transactions of unknown block %s", request.BlockHash.Hex())
+	}
+
+	response := &BlockTransactionsData{BlockHash: request.BlockHash}
+	for _, index := range request.Indexes {
+		if int(index) >= len(block.Transactions) {
+			return fmt.Errorf("%w: request of transaction %d of a block of %d", network.ErrInvalidMessage, index, len(block.Transactions))
+		}
+		tx := block.Transactions[index]
+		peer.knownTxs.Add(tx.Hash())
+		response.Transactions = append(response.Transactions, tx)
+	}
+	if err := peer.SendMessage(p2p.newMessage(MsgTypeBlockTransactions, response)); err != nil {
+		log.Printf("Failed to send block transactions to peer %s: %v", peer.ID, err)
+	}
+	return nil
+}
+
+func (p2p *P2PNetwork) handleBlockTransactions(peer *Peer, data json.RawMessage) error {
+	var response BlockTransactionsData
+	if err := json.Unmarshal(data, &response); err != nil {
+		return fmt.Errorf("%w: failed to unmarshal block transactions: %v", network.ErrInvalidMessage, err)
+	}
+
+	r := p2p.relay
+	r.mu.Lock()
+	partial, ok := r.partial[response.BlockHash]
+	if ok && partial.peerID == peer.ID {
+		delete(r.partial, response.BlockHash)
+	}
+	r.mu.Unlock()
+	if !ok || partial.peerID != peer.ID {
+		return fmt.Errorf("unrequested transactions of block %s", response.BlockHash.Hex())
+	}
+
+	if len(response.Transactions) != len(partial.missing) {
+		return fmt.Errorf("%w: got %d of %d requested block transactions", network.ErrInvalidMessage,
+			len(response.Transactions), len(partial.missing))
+	}
+	for i, index := range partial.missing {
+		if response.Transactions[i] == nil {
+			return fmt.Errorf("%w: empty block transaction", network.ErrInvalidMessage)
+		}
+		partial.txs[index] = response.Transactions[i]
+	}
+	partial.missing = nil
+	return p2p.completeBlock(peer, partial)
+}
+
+// remember keeps a block to serve its transactions, dropping the oldest
+func (r *blockRelay) remember(block *types.Block) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hash := block.Hash()
+	if _, ok := r.recent[hash]; ok {
+		return
+	}
+	r.recent[hash] = block
+	r.recentOrder = append(r.recentOrder, hash)
+	if len(r.recentOrder) > recentBlockCount {
+		delete(r.recent, r.recentOrder[0])
+		r.recentOrder = r.recentOrder[1:]
+	}
+}
+
+// forget drops a block that is no longer being rebuilt
+func (r *blockRelay) forget(hash types.Hash) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.partial, hash)
+}
+
+// expirePartial drops blocks whose transactions did not arrive in time, the
+// caller holds the lock
+func (r *blockRelay) expirePartial(now time.Time) {
+	for hash, partial := range r.partial {
+		if now.Sub(partial.started) > compactBlockTimeout {
+			delete(r.partial, hash)
+		}
+	}
+}
+
+// shortTxID returns the short ID of a transaction in a block, keyed by the
+// block hash so colliding transactions can not be crafted in advance
+func shortTxID(blockHash, txHash types.Hash) []byte {
+	return types.Keccak256(append(blockHash.Bytes(), txHash.Bytes()...))[:shortIDLength]
+}
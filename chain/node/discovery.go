@@ -0,0 +1,529 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"quantum-blockchain/chain/network"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// DefaultMaxPeers is the number of peers the node connects to when not configured
+	DefaultMaxPeers = 25
+
+	// discoveryInterval is the time between table refreshing lookups
+	discoveryInterval = 30 * time.Second
+
+	// lookupAlpha is the number of nodes queried in parallel during a lookup
+	lookupAlpha = 3
+
+	// findNodeTimeout bounds the time a node has to answer a query
+	findNodeTimeout = 5 * time.Second
+
+	// maxDiscoveryQueries is the number of queries served on a discovery session
+	maxDiscoveryQueries = 8
+
+	// dialBackoff is the delay before redialing a node, multiplied by its failures
+	dialBackoff = 30 * time.Second
+)
+
+// DiscoveryConfig configures how the node finds peers beyond its bootstrap peers
+type DiscoveryConfig struct {
+	ChainID      uint64         // Chain the node record advertises
+	ForkID       network.ForkID // Fork the node record advertises, peers must match
+	ExternalAddr string         // Address other nodes dial, the listen address if empty
+	PeerDB       string         // Peer database file, kept in memory if empty
+	MaxPeers     int            // Connection limit, DefaultMaxPeers if 0
+}
+
+// DiscoveryMetrics receives the state of discovery, implemented by the metrics server
+type DiscoveryMetrics interface {
+	SetDiscoveryNodes(tableNodes, knownNodes int)
+	RecordDiscoveryLookup()
+}
+
+// DiscoveryInfo describes the discovery state in admin_nodeInfo
+type DiscoveryInfo struct {
+	Record     *network.NodeRecord `json:"record"`
+	TableNodes int                 `json:"tableNodes"`
+	Buckets    int                 `json:"buckets"`
+	KnownNodes int                 `json:"knownNodes"`
+	Lookups    uint64              `json:"lookups"`
+	MaxPeers   int                 `json:"maxPeers"`
+}
+
+// FindNodeData asks a node for the records closest to a target ID
+type FindNodeData struct {
+	RequestID uint64 `json:"requestId"`
+	Target    string `json:"target"`
+}
+
+// NeighborsData answers a FindNodeData request
+type NeighborsData struct {
+	RequestID uint64                `json:"requestId"`
+	Records   []*network.NodeRecord `json:"records"`
+}
+
+// discovery holds the Kademlia state of the P2P network
+type discovery struct {
+	config  DiscoveryConfig
+	table   *network.RoutingTable
+	db      *network.PeerDB
+	metrics DiscoveryMetrics
+
+	mu            sync.Mutex
+	record        *network.NodeRecord
+	pending       map[uint64]chan []*network.NodeRecord
+	nextRequestID uint64
+	dialing       map[string]bool
+	lookups       uint64
+
+	refresh chan struct{}
+}
+
+func newDiscovery(selfID string, config DiscoveryConfig) *discovery {
+	if config.MaxPeers == 0 {
+		config.MaxPeers = DefaultMaxPeers
+	}
+	db, _ := network.OpenPeerDB("") // An in-memory database can not fail
+	return &discovery{
+		config:  config,
+		table:   network.NewRoutingTable(selfID),
+		db:      db,
+		pending: make(map[uint64]chan []*network.NodeRecord),
+		dialing: make(map[string]bool),
+		refresh: make(chan struct{}, 1),
+	}
+}
+
+// ConfigureDiscovery sets up discovery before the network is started
+func (p2p *P2PNetwork) ConfigureDiscovery(config *DiscoveryConfig) error {
+	db, err := network.OpenPeerDB(config.PeerDB)
+	if err != nil {
+		return err
+	}
+
+	p2p.mu.Lock()
+	defer p2p.mu.Unlock()
+
+	metrics := p2p.discovery.metrics
+	p2p.discovery = newDiscovery(p2p.nodeID, *config)
+	p2p.discovery.db = db
+	p2p.discovery.metrics = metrics
+	return nil
+}
+
+// SetDiscoveryMetrics reports the discovery state to metrics
+func (p2p *P2PNetwork) SetDiscoveryMetrics(metrics DiscoveryMetrics) {
+	p2p.mu.Lock()
+	defer p2p.mu.Unlock()
+
+	p2p.discovery.metrics = metrics
+}
+
+// Record returns the signed record the node advertises, nil before it is started
+func (p2p *P2PNetwork) Record() *network.NodeRecord {
+	p2p.discovery.mu.Lock()
+	defer p2p.discovery.mu.Unlock()
+
+	return p2p.discovery.record
+}
+
+// DiscoveryInfo returns the state of discovery
+func (p2p *P2PNetwork) DiscoveryInfo() *DiscoveryInfo {
+	d := p2p.discovery
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return &DiscoveryInfo{
+		Record:     d.record,
+		TableNodes: d.table.Len(),
+		Buckets:    d.table.Buckets(),
+		KnownNodes: d.db.Len(),
+		Lookups:    d.lookups,
+		MaxPeers:   d.config.MaxPeers,
+	}
+}
+
+// KnownNodes returns the records of the nodes in the routing table
+func (p2p *P2PNetwork) KnownNodes() []*network.NodeRecord {
+	return p2p.discovery.table.Nodes()
+}
+
+// startDiscovery signs the node record once the listen address is known and
+// seeds the routing table from the peer database. The caller holds the lock.
+func (p2p *P2PNetwork) startDiscovery() error {
+	d := p2p.discovery
+	address := d.config.ExternalAddr
+	if address == "" {
+		address = p2p.listener.Addr().String()
+	}
+
+	record, err := network.NewNodeRecord(p2p.identity, uint64(time.Now().UnixMilli()), address, d.config.ChainID, d.config.ForkID)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	d.record = record
+	d.mu.Unlock()
+
+	for _, known := range d.db.Records() {
+		if p2p.checkRecord(known) == nil {
+			d.table.Add(known)
+		}
+	}
+	if host, _, err := net.SplitHostPort(address); err == nil && net.ParseIP(host).IsUnspecified() {
+		log.Printf("⚠️ Node record advertises unspecified address %s, other nodes can not dial it", address)
+	}
+
+	p2p.wg.Add(1)
+	go func() {
+		defer p2p.wg.Done()
+		p2p.runDiscovery()
+	}()
+	p2p.requestRefresh()
+	return nil
+}
+
+// checkRecord checks that a record is signed and follows our chain and fork
+func (p2p *P2PNetwork) checkRecord(record *network.NodeRecord) error {
+	if err := record.Verify(); err != nil {
+		return err
+	}
+	d := p2p.discovery
+	if record.ChainID != d.config.ChainID {
+		return fmt.Errorf("chain ID mismatch: expected %d, got %d", d.config.ChainID, record.ChainID)
+	}
+	if record.ForkID != d.config.ForkID {
+		return fmt.Errorf("fork ID mismatch: expected %s, got %s", d.config.ForkID, record.ForkID)
+	}
+	return nil
+}
+
+// addRecord stores a record learned from the network and reports whether it
+// is valid. A full bucket keeps the record as a replacement only.
+func (p2p *P2PNetwork) addRecord(record *network.NodeRecord) bool {
+	if record.ID() == p2p.nodeID || p2p.checkRecord(record) != nil {
+		return false
+	}
+	p2p.discovery.db.Update(record)
+	p2p.discovery.table.Add(record)
+	return true
+}
+
+// requestRefresh schedules a lookup, used when the node gains a new peer to ask
+func (p2p *P2PNetwork) requestRefresh() {
+	select {
+	case p2p.discovery.refresh <- struct{}{}:
+	default:
+	}
+}
+
+func (p2p *P2PNetwork) runDiscovery() {
+	ticker := time.NewTicker(discoveryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p2p.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-p2p.discovery.refresh:
+		}
+
+		// Look up ourselves to find our neighbors, then a random ID to fill
+		// the farther buckets
+		p2p.lookup(p2p.nodeID)
+		p2p.lookup(network.RandomNodeID())
+		p2p.fillPeers()
+
+		d := p2p.discovery
+		if err := d.db.Save(); err != nil {
+			log.Printf("⚠️ Failed to save peer database: %v", err)
+		}
+		if d.metrics != nil {
+			d.metrics.SetDiscoveryNodes(d.table.Len(), d.db.Len())
+		}
+	}
+}
+
+// lookup iteratively queries the nodes closest to target for closer nodes,
+// until the closest known nodes have all been asked
+func (p2p *P2PNetwork) lookup(target string) []*network.NodeRecord {
+	d := p2p.discovery
+	d.mu.Lock()
+	d.lookups++
+	d.mu.Unlock()
+	if d.metrics != nil {
+		d.metrics.RecordDiscoveryLookup()
+	}
+
+	closest := d.table.Closest(target, network.BucketSize)
+	asked := map[string]bool{p2p.nodeID: true}
+	for p2p.ctx.Err() == nil {
+		var batch []*network.NodeRecord
+		for _, record := range closest {
+			if !asked[record.ID()] && len(batch) < lookupAlpha {
+				asked[record.ID()] = true
+				batch = append(batch, record)
+			}
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		results := make(chan []*network.NodeRecord, len(batch))
+		for _, record := range batch {
+			go func(record *network.NodeRecord) {
+				found, err := p2p.findNode(record, target)
+				if err != nil {
+					if d.db.MarkFailed(record.ID()) >= network.MaxDialFailures {
+						d.table.Remove(record.ID())
+					}
+					results <- nil
+					return
+				}
+				d.db.MarkSeen(record.ID())
+				results <- found
+			}(record)
+		}
+
+		seen := make(map[string]bool, len(closest))
+		candidates := append([]*network.NodeRecord{}, closest...)
+		for _, record := range closest {
+			seen[record.ID()] = true
+		}
+		for range batch {
+			for _, record := range <-results {
+				if seen[record.ID()] || !p2p.addRecord(record) {
+					continue
+				}
+				seen[record.ID()] = true
+				candidates = append(candidates, record)
+			}
+		}
+		closest = network.ClosestRecords(target, candidates, network.BucketSize)
+	}
+	return closest
+}
+
+// findNode asks a node for its records closest to target, over the peer
+// connection if there is one or a short-lived discovery session otherwise
+func (p2p *P2PNetwork) findNode(record *network.NodeRecord, target string) ([]*network.NodeRecord, error) {
+	p2p.mu.RLock()
+	peer := p2p.peers[record.ID()]
+	p2p.mu.RUnlock()
+
+	d := p2p.discovery
+	d.mu.Lock()
+	d.nextRequestID++
+	request := &FindNodeData{RequestID: d.nextRequestID, Target: target}
+	d.mu.Unlock()
+
+	if peer == nil {
+		return p2p.findNodeSession(record, request)
+	}
+
+	response := make(chan []*network.NodeRecord, 1)
+	d.mu.Lock()
+	d.pending[request.RequestID] = response
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		delete(d.pending, request.RequestID)
+		d.mu.Unlock()
+	}()
+
+	if err := peer.SendMessage(p2p.newRequest(MsgTypeFindNode, request.RequestID, request)); err != nil {
+		return nil, err
+	}
+	select {
+	case records := <-response:
+		return records, nil
+	case <-time.After(findNodeTimeout):
+		return nil, errors.New("find node request timed out")
+	case <-p2p.ctx.Done():
+		return nil, p2p.ctx.Err()
+	}
+}
+
+// findNodeSession queries a node that is not a peer through a session that
+// only serves discovery queries
+func (p2p *P2PNetwork) findNodeSession(record *network.NodeRecord, request *FindNodeData) ([]*network.NodeRecord, error) {
+	p2p.discovery.db.MarkDialed(record.ID())
+
+	dialer := &websocket.Dialer{HandshakeTimeout: network.HandshakeTimeout}
+	conn, _, err := dialer.DialContext(p2p.ctx, "ws://"+record.Address, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetReadLimit(network.MaxWireMessageSize)
+
+	peer, err := p2p.secureHandshake(conn, record.Address, true, true)
+	if err != nil {
+		return nil, err
+	}
+	if peer.ID != record.ID() {
+		return nil, fmt.Errorf("expected node %s at %s, found %s", record.ID(), record.Address, peer.ID)
+	}
+
+	if err := peer.SendMessage(p2p.newRequest(MsgTypeFindNode, request.RequestID, request)); err != nil {
+		return nil, err
+	}
+	peer.Conn.SetReadDeadline(time.Now().Add(findNodeTimeout))
+	for {
+		msg, err := peer.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		if msg.Type != MsgTypeNeighbors {
+			continue
+		}
+		var response NeighborsData
+		if err := json.Unmarshal(msg.Data, &response); err != nil {
+			return nil, fmt.Errorf("invalid neighbors response: %w", err)
+		}
+		if response.RequestID == request.RequestID {
+			return response.Records, nil
+		}
+	}
+}
+
+// serveDiscovery answers the queries of a discovery session
+func (p2p *P2PNetwork) serveDiscovery(peer *Peer) {
+	for i := 0; i < maxDiscoveryQueries; i++ {
+		peer.Conn.SetReadDeadline(time.Now().Add(findNodeTimeout))
+		msg, err := peer.ReadMessage()
+		if err != nil {
+			return
+		}
+		if msg.Type == MsgTypeFindNode {
+			p2p.handleFindNode(peer, msg.Data)
+		}
+	}
+}
+
+func (p2p *P2PNetwork) handleFindNode(peer *Peer, data json.RawMessage) error {
+	var request FindNodeData
+	if err := json.Unmarshal(data, &request); err != nil {
+		return fmt.Errorf("%w: failed to unmarshal find node request: %v", network.ErrInvalidMessage, err)
+	}
+
+	records := p2p.discovery.table.Closest(request.Target, network.BucketSize)
+	response := &NeighborsData{RequestID: request.RequestID, Records: records}
+	if err := peer.SendMessage(p2p.newRequest(MsgTypeNeighbors, response.RequestID, response)); err != nil {
+		log.Printf("Failed to send neighbors to peer %s: %v", peer.ID, err)
+	}
+	return nil
+}
+
+func (p2p *P2PNetwork) handleNeighbors(peer *Peer, data json.RawMessage) error {
+	var response NeighborsData
+	if err := json.Unmarshal(data, &response); err != nil {
+		return fmt.Errorf("%w: failed to unmarshal neighbors: %v", network.ErrInvalidMessage, err)
+	}
+	if len(response.Records) > network.BucketSize {
+		response.Records = response.Records[:network.BucketSize]
+	}
+
+	// Records are relayed as signed by their nodes, a forged one is the
+	// fault of the peer relaying it
+	for _, record := range response.Records {
+		if record == nil {
+			return fmt.Errorf("%w: empty node record", network.ErrInvalidMessage)
+		}
+		if err := record.Verify(); err != nil {
+			return fmt.Errorf("%w: node record of %s: %v", network.ErrInvalidSignature, record.ID(), err)
+		}
+	}
+
+	d := p2p.discovery
+	d.mu.Lock()
+	pending, ok := d.pending[response.RequestID]
+	delete(d.pending, response.RequestID)
+	d.mu.Unlock()
+	if ok {
+		pending <- response.Records
+	}
+	return nil
+}
+
+// fillPeers dials nodes of the routing table until the peer limit is reached
+func (p2p *P2PNetwork) fillPeers() {
+	d := p2p.discovery
+	p2p.mu.RLock()
+	free := d.config.MaxPeers - len(p2p.peers)
+	connected := make(map[string]bool, len(p2p.peers))
+	for id := range p2p.peers {
+		connected[id] = true
+	}
+	p2p.mu.RUnlock()
+
+	for _, record := range d.table.Closest(p2p.nodeID, d.config.MaxPeers) {
+		if free <= 0 || p2p.ctx.Err() != nil {
+			return
+		}
+		id := record.ID()
+		if connected[id] || p2p.scorer.IsBanned(id) {
+			continue
+		}
+		if entry := d.db.Get(id); entry != nil && entry.Failures > 0 && time.Since(entry.LastDial) < time.Duration(entry.Failures)*dialBackoff {
+			continue
+		}
+
+		d.mu.Lock()
+		if d.dialing[id] {
+			d.mu.Unlock()
+			continue
+		}
+		d.dialing[id] = true
+		d.mu.Unlock()
+
+		free--
+		p2p.wg.Add(1)
+		go func(record *network.NodeRecord) {
+			defer p2p.wg.Done()
+			defer func() {
+				d.mu.Lock()
+				delete(d.dialing, record.ID())
+				d.mu.Unlock()
+			}()
+			d.db.MarkDialed(record.ID())
+			peer, err := p2p.dialPeer(record.Address, record.ID())
+			if err != nil {
+				if d.db.MarkFailed(record.ID()) >= network.MaxDialFailures {
+					d.table.Remove(record.ID())
+				}
+				return
+			}
+			p2p.runPeer(peer)
+		}(record)
+	}
+}
+
+// newMessage wraps data in a message from this node
+func (p2p *P2PNetwork) newMessage(msgType MessageType, data interface{}) *P2PMessage {
+	encoded, _ := json.Marshal(data) // Protocol messages always encode
+	return &P2PMessage{
+		Type:      msgType,
+		Data:      encoded,
+		Timestamp: time.Now().Unix(),
+		From:      p2p.nodeID,
+	}
+}
+
+// newRequest wraps data in a request or response message carrying the
+// request ID
+func (p2p *P2PNetwork) newRequest(msgType MessageType, requestID uint64, data interface{}) *P2PMessage {
+	msg := p2p.newMessage(msgType, data)
+	msg.RequestID = requestID
+	return msg
+}
@@ -0,0 +1,407 @@
+package node
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/evm"
+	"quantum-blockchain/chain/network"
+	"quantum-blockchain/chain/types"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// epochKeyDomain separates the epoch key seeds from other uses of the secret
+var epochKeyDomain = []byte("quantum-mempool-epoch-key")
+
+// EpochKeyring derives the Kyber keys of a validator for the encrypted
+// mempool, one per encryption epoch, from a secret of its own. Senders split
+// the key of a transaction into shares encrypted to the keys of the
+// validators, a threshold of which recovers it.
+type EpochKeyring struct {
+	secret []byte
+
+	mu   sync.Mutex
+	keys map[uint64]*crypto.KyberPrivateKey
+	pubs map[uint64]*crypto.KyberPublicKey
+}
+
+// NewEpochKeyring creates a keyring deriving its keys from secret
+func NewEpochKeyring(secret []byte) *EpochKeyring {
+	return &EpochKeyring{
+		secret: append([]byte{}, secret...),
+		keys:   make(map[uint64]*crypto.KyberPrivateKey),
+		pubs:   make(map[uint64]*crypto.KyberPublicKey),
+	}
+}
+
+// LoadMempoolSecret reads the hex encoded 32 byte secret seeding the epoch
+// keys of a validator, generating and storing a new one if the file does not
+// exist. The secret must stay with its validator.
+func LoadMempoolSecret(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		secret, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid mempool secret in %s: %w", path, err)
+		}
+		if len(secret) != 32 {
+			return nil, fmt.Errorf("invalid mempool secret in %s: expected 32 bytes, got %d", path, len(secret))
+		}
+		return secret, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read mempool secret: %w", err)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate mempool secret: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(secret)), 0600); err != nil {
+		return nil, fmt.Errorf("failed to store mempool secret: %w", err)
+	}
+	return secret, nil
+}
+
+// PublicKey returns the key the validator announces for an epoch
+func (k *EpochKeyring) PublicKey(epoch uint64) *crypto.KyberPublicKey {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.derive(epoch)
+	return k.pubs[epoch]
+}
+
+// PrivateKey returns the key opening the key shares of an epoch
+func (k *EpochKeyring) PrivateKey(epoch uint64) *crypto.KyberPrivateKey {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.derive(epoch)
+	return k.keys[epoch]
+}
+
+// ShareSecrets decapsulates the key shares a validator holds in the encrypted
+// transactions of a block, once the block is committed. The secrets follow
+// the block order and are empty where the validator holds no share or its
+// capsule does not decapsulate. It returns false if the validator holds none.
+func (k *EpochKeyring) ShareSecrets(block *types.Block, validator types.Address) ([][]byte, bool) {
+	var secrets [][]byte
+	held := false
+	for _, tx := range block.EncryptedTransactions() {
+		secret := []byte{}
+		for i, share := range tx.KeyShares {
+			if share.Validator != validator {
+				continue
+			}
+			if s, err := evm.KeyShareSecret(tx, i, k.PrivateKey(tx.EncryptionEpoch)); err == nil {
+				secret = s
+				held = true
+			}
+			break
+		}
+		secrets = append(secrets, secret)
+	}
+	return secrets, held
+}
+
+// derive computes the key pair of an epoch, the caller holds the lock
+func (k *EpochKeyring) derive(epoch uint64) {
+	if _, ok := k.keys[epoch]; ok {
+		return
+	}
+
+	seed := make([]byte, crypto.KyberSeedSize)
+	hash := sha3.NewShake256()
+	hash.Write(epochKeyDomain)
+	hash.Write(k.secret)
+	hash.Write(binary.BigEndian.AppendUint64(nil, epoch))
+	hash.Read(seed)
+
+	priv, pub, _ := crypto.KyberKeyPairFromSeed(seed) // The seed always has the right size
+	k.keys[epoch] = priv
+	k.pubs[epoch] = pub
+}
+
+// encryptionKeyInterval is how often a validator announces its encryption
+// keys for the current and the next epoch
+const encryptionKeyInterval = 30 * time.Second
+
+// encryptionKeyBook holds the encryption keys the validators announced, by
+// epoch. Keys of past epochs are dropped.
+type encryptionKeyBook struct {
+	mu          sync.Mutex
+	keys        map[uint64]map[types.Address]*crypto.KyberPublicKey
+	announcedAt time.Time // Last announcement of this validator
+}
+
+func newEncryptionKeyBook() *encryptionKeyBook {
+	return &encryptionKeyBook{
+		keys: make(map[uint64]map[types.Address]*crypto.KyberPublicKey),
+	}
+}
+
+// add stores the key of a validator for an epoch
+func (b *encryptionKeyBook) add(epoch uint64, validator types.Address, key *crypto.KyberPublicKey) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.keys[epoch] == nil {
+		b.keys[epoch] = make(map[types.Address]*crypto.KyberPublicKey)
+	}
+	b.keys[epoch][validator] = key
+}
+
+// get returns the key of a validator for an epoch
+func (b *encryptionKeyBook) get(epoch uint64, validator types.Address) (*crypto.KyberPublicKey, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key, ok := b.keys[epoch][validator]
+	return key, ok
+}
+
+// prune drops the keys of the epochs before an epoch
+func (b *encryptionKeyBook) prune(epoch uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for e := range b.keys {
+		if e < epoch {
+			delete(b.keys, e)
+		}
+	}
+}
+
+// sharePool holds the capsule secrets the validators released for the
+// encrypted transactions of committed blocks, until the next block reveals
+// the payload keys they recover
+type sharePool struct {
+	mu     sync.Mutex
+	blocks map[types.Hash]*releasedShares
+}
+
+// releasedShares are the secrets released for one block, by encrypted
+// transaction and key share
+type releasedShares struct {
+	height  uint64
+	secrets [][][]byte
+}
+
+func newSharePool() *sharePool {
+	return &sharePool{blocks: make(map[types.Hash]*releasedShares)}
+}
+
+// add stores the secrets a validator released for a block. Every non-empty
+// secret must open the share the validator holds in its transaction.
+func (p *sharePool) add(block *types.Block, validator types.Address, secrets [][]byte) error {
+	encrypted := block.EncryptedTransactions()
+	if len(secrets) != len(encrypted) {
+		return fmt.Errorf("%d key share secrets for %d encrypted transactions", len(secrets), len(encrypted))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	released, ok := p.blocks[block.Hash()]
+	if !ok {
+		released = &releasedShares{height: block.Number().Uint64(), secrets: make([][][]byte, len(encrypted))}
+		for i, tx := range encrypted {
+			released.secrets[i] = make([][]byte, len(tx.KeyShares))
+		}
+	}
+	for i, tx := range encrypted {
+		if len(secrets[i]) == 0 {
+			continue
+		}
+		index := slices.IndexFunc(tx.KeyShares, func(share *types.KeyShare) bool { return share.Validator == validator })
+		if index < 0 {
+			return fmt.Errorf("validator %s holds no key share of %s", validator.Hex(), tx.Hash().Hex())
+		}
+		if _, err := tx.OpenKeyShare(index, secrets[i]); err != nil {
+			return fmt.Errorf("key share secret of %s: %w", tx.Hash().Hex(), err)
+		}
+		released.secrets[i][index] = secrets[i]
+	}
+	p.blocks[block.Hash()] = released
+	return nil
+}
+
+// payloadKeys recovers the payload keys of the encrypted transactions of a
+// block from the released secrets, empty where too few were released. It
+// returns false if any key is missing.
+func (p *sharePool) payloadKeys(block *types.Block) ([][]byte, bool) {
+	encrypted := block.EncryptedTransactions()
+	if len(encrypted) == 0 {
+		return nil, true
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	released := p.blocks[block.Hash()]
+	keys := make([][]byte, len(encrypted))
+	complete := true
+	for i, tx := range encrypted {
+		keys[i] = []byte{}
+		if released == nil {
+			complete = false
+			continue
+		}
+		key, err := tx.RecoverPayloadKey(released.secrets[i])
+		if err != nil {
+			complete = false
+			continue
+		}
+		keys[i] = key
+	}
+	return keys, complete
+}
+
+// prune drops the secrets of the blocks below a height
+func (p *sharePool) prune(height uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for hash, released := range p.blocks {
+		if released.height < height {
+			delete(p.blocks, hash)
+		}
+	}
+}
+
+// announceEncryptionKeys signs and sends the encryption keys of this
+// validator for the current and the next epoch, so senders can split the
+// keys of their transactions to it, at most once per announcement interval
+func (n *Node) announceEncryptionKeys() {
+	if n.epochKeys == nil {
+		return
+	}
+
+	n.encryptionKeys.mu.Lock()
+	now := n.now()
+	if !n.encryptionKeys.announcedAt.IsZero() && now.Sub(n.encryptionKeys.announcedAt) < encryptionKeyInterval {
+		n.encryptionKeys.mu.Unlock()
+		return
+	}
+	n.encryptionKeys.announcedAt = now
+	n.encryptionKeys.mu.Unlock()
+
+	epoch := types.EncryptionEpoch(n.blockchain.GetCurrentBlock().Number().Uint64() + 1)
+	n.encryptionKeys.prune(epoch)
+	for _, e := range []uint64{epoch, epoch + 1} {
+		key := n.epochKeys.PublicKey(e)
+		n.encryptionKeys.add(e, n.validatorAddr, key)
+		if n.mesh == nil {
+			continue
+		}
+
+		data := &network.EncryptionKeyData{
+			Validator: n.validatorAddr,
+			Epoch:     e,
+			PublicKey: key.Bytes(),
+		}
+		hash := data.SigningHash()
+		signature, err := crypto.SignMessage(hash[:], n.validatorAlg, n.validatorPrivKey)
+		if err != nil {
+			log.Printf("Failed to sign encryption key: %v", err)
+			return
+		}
+		data.Signature = signature
+		if err := n.mesh.BroadcastEncryptionKey(data); err != nil {
+			log.Printf("Failed to announce encryption key: %v", err)
+		}
+	}
+}
+
+// handleEncryptionKey stores the encryption key a validator announced
+func (n *Node) handleEncryptionKey(data *network.EncryptionKeyData) error {
+	if !n.isKnownValidator(data.Validator) {
+		return fmt.Errorf("encryption key of unknown validator %s", data.Validator.Hex())
+	}
+	if data.Signature == nil || types.PublicKeyToAddress(data.Signature.PublicKey) != data.Validator {
+		return fmt.Errorf("%w: encryption key not signed by validator %s", network.ErrInvalidSignature, data.Validator.Hex())
+	}
+	hash := data.SigningHash()
+	if valid, err := crypto.VerifySignature(hash[:], data.Signature); err != nil || !valid {
+		return fmt.Errorf("%w: encryption key of validator %s", network.ErrInvalidSignature, data.Validator.Hex())
+	}
+	key, err := crypto.KyberPublicKeyFromBytes(data.PublicKey)
+	if err != nil {
+		return fmt.Errorf("%w: encryption key of validator %s: %v", network.ErrInvalidMessage, data.Validator.Hex(), err)
+	}
+
+	n.encryptionKeys.add(data.Epoch, data.Validator, key)
+	return nil
+}
+
+// EncryptionKeys returns the keys the validators announced for an epoch,
+// ordered by address
+func (n *Node) EncryptionKeys(epoch uint64) []*types.EncryptionKey {
+	var keys []*types.EncryptionKey
+	for _, validator := range n.multiConsensus.GetValidatorSet() {
+		if key, ok := n.encryptionKeys.get(epoch, validator.Address); ok {
+			keys = append(keys, &types.EncryptionKey{Validator: validator.Address, PublicKey: key})
+		} else if validator.Address == n.validatorAddr && n.epochKeys != nil {
+			keys = append(keys, &types.EncryptionKey{Validator: validator.Address, PublicKey: n.epochKeys.PublicKey(epoch)})
+		}
+	}
+	slices.SortFunc(keys, func(a, b *types.EncryptionKey) int { return bytes.Compare(a.Validator.Bytes(), b.Validator.Bytes()) })
+	return keys
+}
+
+// releaseDecryptionShares opens the key shares this validator holds in the
+// encrypted transactions of a committed block and sends their secrets to the
+// other validators. The block fixed the order of the transactions, so their
+// payloads may now be revealed.
+func (n *Node) releaseDecryptionShares(block *types.Block) {
+	if n.epochKeys == nil {
+		return
+	}
+	secrets, held := n.epochKeys.ShareSecrets(block, n.validatorAddr)
+	if !held {
+		return
+	}
+	if err := n.shares.add(block, n.validatorAddr, secrets); err != nil {
+		log.Printf("Failed to store key shares of block #%d: %v", block.Number(), err)
+		return
+	}
+	if n.mesh == nil {
+		return
+	}
+
+	data := &network.DecryptionSharesData{
+		Validator:   n.validatorAddr,
+		BlockHash:   block.Hash(),
+		BlockHeight: block.Number().Uint64(),
+		Secrets:     secrets,
+	}
+	if err := n.mesh.BroadcastDecryptionShares(data); err != nil {
+		log.Printf("Failed to release key shares of block #%d: %v", block.Number(), err)
+	}
+}
+
+// handleDecryptionShares stores the key share secrets a validator released
+// for a committed block. Secrets for a block this node has not committed are
+// dropped, the validator sends them again.
+func (n *Node) handleDecryptionShares(data *network.DecryptionSharesData) error {
+	block, err := n.blockchain.GetBlockByHash(data.BlockHash)
+	if err != nil || block.Number().Uint64() != data.BlockHeight {
+		return nil
+	}
+	if err := n.shares.add(block, data.Validator, data.Secrets); err != nil {
+		return fmt.Errorf("%w: decryption shares of validator %s: %v", network.ErrInvalidMessage, data.Validator.Hex(), err)
+	}
+	return nil
+}
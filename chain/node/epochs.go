@@ -0,0 +1,54 @@
+package node
+
+import (
+	"fmt"
+	"log"
+
+	"quantum-blockchain/chain/types"
+)
+
+// applyEpochTransition begins the next epoch once the last block of an epoch
+// is committed, applying the changes to the validators queued during it
+func (n *Node) applyEpochTransition(block *types.Block) {
+	next := block.Number().Uint64() + 1
+	if next%n.multiConsensus.EpochBlocks() != 0 {
+		return
+	}
+
+	set, err := n.multiConsensus.BeginEpoch(n.multiConsensus.EpochOf(next))
+	if err != nil {
+		log.Printf("Failed to begin epoch at block #%d: %v", next, err)
+		return
+	}
+	log.Printf("🗓️ Epoch %d begins at block #%d with %d validators, set %s",
+		set.Epoch, set.FirstBlock, len(set.Validators), set.Hash().Hex())
+}
+
+// epochValidatorsHash returns the hash of the validator set the block with
+// the given number commits to, zero unless it is the first block of an epoch
+func (n *Node) epochValidatorsHash(number uint64) (types.Hash, error) {
+	if number == 0 || number%n.multiConsensus.EpochBlocks() != 0 {
+		return types.ZeroHash, nil
+	}
+	epoch := n.multiConsensus.EpochOf(number)
+	set, ok := n.multiConsensus.GetEpochValidatorSet(epoch)
+	if !ok {
+		return types.ZeroHash, fmt.Errorf("validator set of epoch %d unknown", epoch)
+	}
+	return set.Hash(), nil
+}
+
+// validateValidatorsHash checks that the first block of an epoch commits to
+// the validator set this node began the epoch with, and that other blocks
+// commit to none
+func (n *Node) validateValidatorsHash(block *types.Block) error {
+	want, err := n.epochValidatorsHash(block.Number().Uint64())
+	if err != nil {
+		return err
+	}
+	if block.Header.ValidatorsHash != want {
+		return fmt.Errorf("invalid validators hash of block #%d: have %s, want %s",
+			block.Number(), block.Header.ValidatorsHash.Hex(), want.Hex())
+	}
+	return nil
+}
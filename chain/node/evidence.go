@@ -0,0 +1,153 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"quantum-blockchain/chain/consensus"
+	"quantum-blockchain/chain/economics"
+	"quantum-blockchain/chain/network"
+	"quantum-blockchain/chain/types"
+)
+
+// maxBlockEvidence is the most evidence a block includes
+const maxBlockEvidence = 16
+
+// reportEvidence keeps verified evidence of double signing until a block
+// includes it, and sends it on to the other validators when it is new
+func (n *Node) reportEvidence(ev *consensus.Evidence) error {
+	added, err := n.evidence.Add(ev)
+	if err != nil || !added {
+		return err
+	}
+	log.Printf("🚨 Validator %s signed conflicting %s at height %d", ev.Validator.Hex(), evidenceKind(ev), ev.Height)
+
+	if n.mesh != nil {
+		if err := n.mesh.BroadcastEvidence(ev); err != nil {
+			log.Printf("Failed to send evidence: %v", err)
+		}
+	}
+	return nil
+}
+
+// handleEvidence takes evidence relayed by a peer, which is at fault when it
+// proves nothing
+func (n *Node) handleEvidence(ev *consensus.Evidence) error {
+	if err := n.reportEvidence(ev); err != nil {
+		if errors.Is(err, consensus.ErrInvalidEvidence) {
+			return fmt.Errorf("%w: %v", network.ErrInvalidMessage, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// reportConflictingVote turns a vote conflicting with the vote its validator
+// cast before in the round at the height into evidence. A forged vote proves
+// nothing.
+func (n *Node) reportConflictingVote(vote *consensus.ConsensusVote) error {
+	existing, ok := n.multiConsensus.GetVote(vote.BlockHeight, vote.Round, vote.Validator)
+	if !ok || existing.BlockHash == vote.BlockHash {
+		return nil
+	}
+	if err := n.reportEvidence(consensus.NewDuplicateVoteEvidence(existing, vote)); err != nil {
+		if errors.Is(err, consensus.ErrInvalidEvidence) {
+			return fmt.Errorf("%w: %v", network.ErrInvalidSignature, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// reportConflictingProposal turns a signed block into evidence when its
+// proposer signed another block in the same round at the same height,
+// committed or proposed
+func (n *Node) reportConflictingProposal(block *types.Block) {
+	conflicting := n.proposals.conflicting(block)
+	if conflicting == nil {
+		committed, err := n.blockchain.GetBlockByNumber(block.Number())
+		if err != nil || committed.Hash() == block.Hash() ||
+			committed.Header.ValidatorAddr != block.Header.ValidatorAddr || committed.Header.Round != block.Header.Round {
+			return
+		}
+		conflicting = committed
+	}
+
+	if err := n.reportEvidence(consensus.NewDuplicateProposalEvidence(conflicting.Header, block.Header)); err != nil {
+		log.Printf("Failed to report conflicting block #%d: %v", block.Number(), err)
+	}
+}
+
+// pendingEvidence returns the encoded evidence the next block includes
+func (n *Node) pendingEvidence() [][]byte {
+	var encoded [][]byte
+	for _, ev := range n.evidence.Pending(maxBlockEvidence) {
+		data, err := ev.Encode()
+		if err != nil {
+			log.Printf("Failed to encode evidence: %v", err)
+			continue
+		}
+		encoded = append(encoded, data)
+	}
+	return encoded
+}
+
+// validateBlockEvidence checks that every evidence of a block proves an
+// offence that no block punished before
+func (n *Node) validateBlockEvidence(block *types.Block) error {
+	if len(block.Evidence) > maxBlockEvidence {
+		return fmt.Errorf("block #%d includes %d evidence, limit %d", block.Number(), len(block.Evidence), maxBlockEvidence)
+	}
+
+	included := make(map[types.Hash]bool, len(block.Evidence))
+	for _, data := range block.Evidence {
+		ev, err := consensus.DecodeEvidence(data)
+		if err != nil {
+			return err
+		}
+		id := ev.ID()
+		if included[id] || n.evidence.IsCommitted(id) {
+			return fmt.Errorf("%w: validator %s already punished for height %d", consensus.ErrInvalidEvidence, ev.Validator.Hex(), ev.Height)
+		}
+		included[id] = true
+
+		if err := n.multiConsensus.VerifyEvidence(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyEvidence slashes and jails the validators a committed block proves
+// to have double signed. The penalty depends on the stake and the jail term
+// on the block time, so every node punishes alike.
+func (n *Node) applyEvidence(block *types.Block) {
+	for _, data := range block.Evidence {
+		ev, err := consensus.DecodeEvidence(data)
+		if err != nil {
+			continue
+		}
+		n.evidence.MarkCommitted(ev.ID())
+
+		penalty := func(stake *big.Int) *big.Int {
+			return n.tokenomics.CalculateSlashingPenalty(stake, economics.SlashingDoubleSign, economics.SeverityNormal)
+		}
+		slashed, err := n.multiConsensus.SlashStake(ev.Validator, penalty, "double signing", time.Unix(int64(block.Time()), 0))
+		if err != nil {
+			log.Printf("Failed to slash validator %s: %v", ev.Validator.Hex(), err)
+			continue
+		}
+		log.Printf("⚔️ Slashed validator %s by %s QTM and jailed it for signing conflicting %s at height %d",
+			ev.Validator.Hex(), new(big.Int).Div(slashed, big.NewInt(1e18)), evidenceKind(ev), ev.Height)
+	}
+}
+
+func evidenceKind(ev *consensus.Evidence) string {
+	if ev.Type == consensus.EvidenceDuplicateProposal {
+		return "blocks"
+	}
+	return "votes"
+}
@@ -0,0 +1,56 @@
+package node
+
+import (
+	"log"
+	"math/big"
+	"time"
+
+	"quantum-blockchain/chain/economics"
+	"quantum-blockchain/chain/types"
+)
+
+// verifyLastCommit checks the commit votes a block includes for its parent
+// and returns the validators that signed the parent
+func (n *Node) verifyLastCommit(block *types.Block) ([]types.Address, error) {
+	if len(block.LastCommit) == 0 {
+		return nil, nil
+	}
+	return n.multiConsensus.VerifyCommit(block.Number().Uint64()-1, block.ParentHash(), block.LastCommit)
+}
+
+// applyLiveness counts the parent of a committed block in the signing window
+// of the validators, and slashes and jails those that signed too few blocks.
+// The penalty depends on the stake and the jail term on the block time, so
+// every node punishes alike. The parent of the first block of an epoch was
+// signed by the set of the epoch before and is not counted.
+func (n *Node) applyLiveness(block *types.Block, signers []types.Address) {
+	if block.Number().Uint64()%n.multiConsensus.EpochBlocks() == 0 {
+		return
+	}
+	penalty := func(stake *big.Int) *big.Int {
+		return n.tokenomics.CalculateSlashingPenalty(stake, economics.SlashingDowntime, economics.SeverityNormal)
+	}
+	for validator, slashed := range n.multiConsensus.RecordCommit(signers, penalty, time.Unix(int64(block.Time()), 0)) {
+		log.Printf("💤 Slashed validator %s by %s QTM and jailed it for missing too many blocks",
+			validator.Hex(), new(big.Int).Div(slashed, big.NewInt(1e18)))
+	}
+}
+
+// applyUnjail returns the senders of the unjail transactions of a committed
+// block to the validator set, if their jail term is over at the block time
+func (n *Node) applyUnjail(block *types.Block) {
+	for _, tx := range block.Transactions {
+		if !tx.IsUnjail() {
+			continue
+		}
+		receipt, err := n.blockchain.GetTransactionReceipt(tx.Hash())
+		if err != nil || receipt.Status == 0 {
+			continue
+		}
+		if err := n.multiConsensus.Unjail(tx.From(), time.Unix(int64(block.Time()), 0)); err != nil {
+			log.Printf("Failed to unjail validator %s: %v", tx.From().Hex(), err)
+			continue
+		}
+		log.Printf("🔓 Validator %s rejoined the validator set", tx.From().Hex())
+	}
+}
@@ -8,11 +8,14 @@ import (
 	"log"
 	"math/big"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
 	"quantum-blockchain/chain/consensus"
 	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/economics"
 	"quantum-blockchain/chain/governance"
 	"quantum-blockchain/chain/monitoring"
 	"quantum-blockchain/chain/network"
@@ -33,6 +36,32 @@ type Config struct {
 	Mining         bool     `json:"mining"`
 	GasLimit       uint64   `json:"gasLimit"`
 	GasPrice       *big.Int `json:"gasPrice"`
+	StateHistory   uint64   `json:"stateHistory"` // Blocks of historical state to retain, 0 keeps all
+
+	// Admin RPC endpoints serving the privileged admin, miner and debug namespaces
+	AdminSocket   string   `json:"adminSocket,omitempty"`   // Unix socket path, relative to DataDir unless absolute
+	AdminHTTPPort int      `json:"adminHttpPort,omitempty"` // Port of the localhost admin endpoint, 0 disables it
+	JWTSecret     string   `json:"jwtSecret,omitempty"`     // Hex secret file for the admin endpoint, created if missing
+	AdminKeys     []string `json:"adminKeys,omitempty"`     // Hex Dilithium public keys allowed to sign admin requests
+
+	// Secret the epoch keys of the encrypted mempool are derived from, shared by all validators.
+	// Required for encrypted transactions when the validator mesh is enabled.
+	MempoolSecret string `json:"mempoolSecret,omitempty"` // Hex secret file, relative to DataDir unless absolute
+
+	// Dilithium key the node proves in P2P handshakes, its peer ID is derived from it
+	NodeKey string `json:"nodeKey,omitempty"` // Hex key file, relative to DataDir unless absolute, ephemeral if empty
+
+	// Peer discovery
+	ExternalAddr string `json:"externalAddr,omitempty"` // Address advertised to other nodes, the listen address if empty
+	MaxPeers     int    `json:"maxPeers,omitempty"`     // Connection limit, DefaultMaxPeers if 0
+	PeerDB       string `json:"peerDb,omitempty"`       // Discovered nodes file, relative to DataDir unless absolute, in memory if empty
+
+	// Misbehaving peers are banned, their bans survive restarts
+	BanList string `json:"banList,omitempty"` // Ban list file, relative to DataDir unless absolute, in memory if empty
+
+	// Authenticated mesh of the validators exchanging proposals and votes
+	ValidatorListenAddr string   `json:"validatorListenAddr,omitempty"` // Mesh listen address, empty disables the mesh
+	ValidatorPeers      []string `json:"validatorPeers,omitempty"`      // Mesh addresses of other validators
 }
 
 // DefaultConfig returns default node configuration
@@ -47,6 +76,14 @@ func DefaultConfig() *Config {
 		Mining:         true,                // Enable mining by default for fast block production
 		GasLimit:       50000000,            // Increased for high throughput
 		GasPrice:       big.NewInt(1000000), // Lower gas price for cheap transactions
+		StateHistory:   DefaultStateHistory,
+		AdminSocket:    "admin.ipc",
+		JWTSecret:      "jwtsecret",
+		NodeKey:        "nodekey",
+		PeerDB:         "peers.json",
+		BanList:        "bans.json",
+
+		ValidatorListenAddr: "0.0.0.0:30304",
 	}
 }
 
@@ -57,19 +94,40 @@ type Node struct {
 	blockchain     *Blockchain
 	txPool         *TxPool
 	p2p            *P2PNetwork
-	enhancedP2P    *network.EnhancedP2PNetwork // Enhanced P2P networking
+	enhancedP2P    *network.EnhancedP2PNetwork // Validator mesh carrying proposals and votes, nil if disabled
+	mesh           validatorTransport          // Transport of the validator mesh, nil if disabled
 	rpc            *RPCServer
 	tokenSupply    *types.TokenSupply           // Native QTM token management
 	gasPricing     *types.GasPriceCalculator    // Dynamic gas pricing
 	governance     *governance.GovernanceSystem // On-chain governance
+	tokenomics     *economics.TokenomicsEngine  // Slashing penalties
+	evidence       *consensus.EvidencePool      // Evidence of double signing awaiting inclusion
 	monitoring     *monitoring.MetricsServer    // Monitoring and metrics
 
 	// Validator info
 	validatorPrivKey []byte
 	validatorAlg     crypto.SignatureAlgorithm
 	validatorAddr    types.Address
+	epochKeys        *EpochKeyring      // Keys of this validator for the encrypted mempool
+	encryptionKeys   *encryptionKeyBook // Encryption keys announced by the validators
+	shares           *sharePool         // Key share secrets released for committed blocks
+	proposals        *proposalPool      // Proposed blocks awaiting a quorum of votes
+
+	// Catching up with the other validators
+	syncMu     sync.Mutex
+	lastSync   time.Time // Last block request
+	importedAt time.Time // Last block import
+	syncTurn   int       // Validator asked next when none is known to be ahead
+
+	// Consensus round at the next height
+	roundMu     sync.Mutex
+	roundHeight uint64
+	round       uint64
+	roundStart  time.Time
+	roundVote   *consensus.ConsensusVote // Last round change vote of this validator
 
 	// Control
+	now    func() time.Time // Clock of block production, the simulator replaces it
 	ctx    context.Context
 	cancel context.CancelFunc
 	wg     sync.WaitGroup
@@ -91,11 +149,16 @@ func NewNode(config *Config) (*Node, error) {
 	gasPricing := types.NewGasPriceCalculator()
 
 	node := &Node{
-		config:      config,
-		ctx:         ctx,
-		cancel:      cancel,
-		tokenSupply: tokenSupply,
-		gasPricing:  gasPricing,
+		config:         config,
+		ctx:            ctx,
+		cancel:         cancel,
+		tokenSupply:    tokenSupply,
+		gasPricing:     gasPricing,
+		proposals:      newProposalPool(),
+		encryptionKeys: newEncryptionKeyBook(),
+		shares:         newSharePool(),
+		now:            time.Now,
+		importedAt:     time.Now(),
 	}
 
 	// Initialize validator if configured
@@ -113,18 +176,30 @@ func NewNode(config *Config) (*Node, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize blockchain: %w", err)
 	}
+	blockchain.SetStateHistory(config.StateHistory)
 	node.blockchain = blockchain
 
+	// Validators hold key shares of the encrypted mempool
+	if node.validatorPrivKey != nil {
+		if err := node.initEpochKeys(); err != nil {
+			return nil, fmt.Errorf("failed to initialize mempool encryption: %w", err)
+		}
+	}
+
 	// Connect TokenSupply to StateDB for balance synchronization
 	stateDBAdapter := NewStateDBAdapter(blockchain.stateDB)
 	tokenSupply.SetStateDB(stateDBAdapter)
 
 	// Initialize transaction pool with larger capacity for higher throughput
 	node.txPool = NewTxPool(5000) // Max 5000 pending transactions for fast blocks
+	node.txPool.SetBalanceSource(blockchain.GetBalance)
+	node.txPool.SetKeySource(blockchain.GetKeyBinding)
 
 	// Initialize multi-validator consensus system
 	chainID := big.NewInt(int64(config.NetworkID))
 	node.multiConsensus = consensus.NewMultiValidatorConsensus(chainID)
+	node.evidence = consensus.NewEvidencePool(node.multiConsensus)
+	node.tokenomics = economics.NewTokenomicsEngine()
 
 	// Initialize governance system (will connect validator set later)
 	node.governance = governance.NewGovernanceSystem(chainID, nil)
@@ -136,17 +211,30 @@ func NewNode(config *Config) (*Node, error) {
 		HealthPath:  "/health",
 	})
 
+	// Every node knows the genesis validators and the keys they vote with
+	genesisValidators, err := node.registerGenesisValidators()
+	if err != nil {
+		return nil, fmt.Errorf("failed to register genesis validators: %w", err)
+	}
+
 	// Register validator if configured
 	if node.validatorPrivKey != nil {
 		log.Printf("🔑 Registering validator: %s", node.validatorAddr.Hex())
 
-		// Initialize validator with significant stake (minimum 100K QTM)
+		// Initialize validator with significant stake (minimum 100K QTM),
+		// genesis validators with their genesis stake
 		initialStake := new(big.Int)
 		initialStake.SetString("100000000000000000000000", 10) // 100K QTM with 18 decimals
+		if genesisStake := genesisValidators[node.validatorAddr]; genesisStake != nil {
+			initialStake.Set(genesisStake.Stake)
+		}
 
-		// Set initial balance in BOTH TokenSupply AND StateDB for proper synchronization
+		// Set initial balance in BOTH TokenSupply AND StateDB for proper synchronization,
+		// blocks commit to the state so a restart leaves the chain's balance alone
 		tokenSupply.SetBalance(node.validatorAddr, initialStake)
-		blockchain.stateDB.SetBalance(node.validatorAddr, initialStake)
+		if blockchain.GetCurrentBlock().Number().Sign() == 0 {
+			blockchain.stateDB.SetBalance(node.validatorAddr, initialStake)
+		}
 
 		// Initialize nonce to 0 if it's a new validator
 		if blockchain.stateDB.GetNonce(node.validatorAddr) == 0 {
@@ -180,22 +268,123 @@ func NewNode(config *Config) (*Node, error) {
 		log.Printf("⚠️ No validator private key found - validator mode disabled")
 	}
 
-	// Initialize enhanced P2P network with security features
-	node.enhancedP2P = network.NewEnhancedP2PNetwork(&network.NetworkConfig{
-		ListenAddr: config.ListenAddr,
-		MaxPeers:   50,
-		NetworkID:  uint64(config.NetworkID),
-	})
+	// The validators registered so far make up the set of the epoch of the
+	// head, later changes to the validators wait for the next epoch
+	node.multiConsensus.StartEpochs(blockchain.GetCurrentBlock().Number().Uint64())
+
+	// Both networks authenticate peers with the node identity
+	identity, err := node.loadNodeIdentity()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load node key: %w", err)
+	}
+	log.Printf("🔑 Node ID: %s", identity.ID())
+
+	// Both networks share the reputation of peers
+	scorer, err := node.loadPeerScorer()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ban list: %w", err)
+	}
+
+	// Validators exchange proposals and votes over an authenticated mesh
+	if node.validatorPrivKey != nil && config.ValidatorListenAddr != "" {
+		node.enhancedP2P = network.NewEnhancedP2PNetwork(&network.NetworkConfig{
+			ChainID:        chainID,
+			ListenAddr:     config.ValidatorListenAddr,
+			BootstrapPeers: config.ValidatorPeers,
+			MaxPeers:       50,
+			NetworkID:      uint64(config.NetworkID),
+			Permissioned:   true,
+			Identity:       identity,
+			Scorer:         scorer,
+		})
+		node.enhancedP2P.SetValidator(node.validatorAddr, node.validatorPrivKey, node.validatorAlg)
+		node.enhancedP2P.SetConsensusEngine(node.multiConsensus)
+		node.enhancedP2P.SetTransactionHandler(node.handlePeerTransaction)
+		node.attachValidatorTransport(node.enhancedP2P)
+	}
 
 	// Initialize legacy P2P for compatibility
-	node.p2p = NewP2PNetwork(config.ListenAddr, config.BootstrapPeers)
+	node.p2p = NewP2PNetwork(config.ListenAddr, config.BootstrapPeers, identity)
+	node.p2p.SetPeerScorer(scorer)
+	node.p2p.SetBlockHandler(node.handlePeerBlock)
+	node.p2p.SetTransactionHandler(node.handlePeerTransaction)
+	node.p2p.SetTransactionSource(func(hash types.Hash) *types.QuantumTransaction {
+		tx, _ := node.txPool.GetTransaction(hash)
+		return tx
+	})
+	node.p2p.SetPendingTransactions(func() []*types.QuantumTransaction {
+		return node.txPool.GetPendingTransactions(node.txPool.Size())
+	})
+	if err := node.configureDiscovery(); err != nil {
+		return nil, fmt.Errorf("failed to configure discovery: %w", err)
+	}
 
 	// Initialize RPC server
 	node.rpc = NewRPCServer(node, config.HTTPPort, config.WSPort)
+	if err := node.addAdminEndpoints(); err != nil {
+		return nil, fmt.Errorf("failed to configure admin RPC: %w", err)
+	}
 
 	return node, nil
 }
 
+// addAdminEndpoints registers the configured admin RPC listeners
+func (n *Node) addAdminEndpoints() error {
+	dataPath := func(path string) string {
+		if filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(n.config.DataDir, path)
+	}
+
+	if n.config.AdminSocket != "" {
+		err := n.rpc.AddEndpoint(&RPCEndpoint{
+			Name:       "admin-ipc",
+			Network:    "unix",
+			Address:    dataPath(n.config.AdminSocket),
+			Namespaces: AdminNamespaces,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if n.config.AdminHTTPPort == 0 {
+		return nil
+	}
+
+	var auth MultiAuth
+	if n.config.JWTSecret != "" {
+		secret, err := LoadJWTSecret(dataPath(n.config.JWTSecret))
+		if err != nil {
+			return err
+		}
+		auth = append(auth, NewJWTAuth(secret))
+	}
+	if len(n.config.AdminKeys) > 0 {
+		keys := make([][]byte, 0, len(n.config.AdminKeys))
+		for _, keyHex := range n.config.AdminKeys {
+			key, err := hex.DecodeString(strings.TrimPrefix(keyHex, "0x"))
+			if err != nil {
+				return fmt.Errorf("invalid admin key %q: %w", keyHex, err)
+			}
+			keys = append(keys, key)
+		}
+		auth = append(auth, NewDilithiumAuth(keys...))
+	}
+	if len(auth) == 0 {
+		return fmt.Errorf("admin HTTP endpoint needs a JWT secret or admin keys")
+	}
+
+	return n.rpc.AddEndpoint(&RPCEndpoint{
+		Name:       "admin-http",
+		Network:    "tcp",
+		Address:    fmt.Sprintf("127.0.0.1:%d", n.config.AdminHTTPPort),
+		Namespaces: AdminNamespaces,
+		Auth:       auth,
+	})
+}
+
 func (n *Node) initValidator() error {
 	if n.config.ValidatorKey == "auto" {
 		// Auto-generate validator key and persist it
@@ -250,6 +439,65 @@ func (n *Node) generateAndSaveValidator() error {
 	return nil
 }
 
+// loadNodeIdentity loads the configured node key, or generates an ephemeral
+// identity when none is configured
+func (n *Node) loadNodeIdentity() (*network.NodeIdentity, error) {
+	path := n.config.NodeKey
+	if path == "" {
+		return network.GenerateNodeIdentity()
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(n.config.DataDir, path)
+	}
+	return network.LoadNodeIdentity(path)
+}
+
+// loadPeerScorer loads the scorer of peers with the configured ban list
+func (n *Node) loadPeerScorer() (*network.PeerScorer, error) {
+	path := n.config.BanList
+	if path != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(n.config.DataDir, path)
+	}
+	return network.NewPeerScorer(path)
+}
+
+// configureDiscovery sets up the discovery of peers following the same chain
+func (n *Node) configureDiscovery() error {
+	peerDB := n.config.PeerDB
+	if peerDB != "" && !filepath.IsAbs(peerDB) {
+		peerDB = filepath.Join(n.config.DataDir, peerDB)
+	}
+
+	n.p2p.SetDiscoveryMetrics(n.monitoring)
+	return n.p2p.ConfigureDiscovery(&DiscoveryConfig{
+		ChainID:      n.config.NetworkID,
+		ForkID:       network.NewForkID(n.blockchain.genesis.Hash()),
+		ExternalAddr: n.config.ExternalAddr,
+		PeerDB:       peerDB,
+		MaxPeers:     n.config.MaxPeers,
+	})
+}
+
+// initEpochKeys sets up the epoch keys this validator receives key shares of
+// encrypted transactions with, from the configured secret or else derived
+// from the validator key. A threshold of the validators must release their
+// shares to reveal a transaction, which they do once its block is committed.
+func (n *Node) initEpochKeys() error {
+	secret := types.Keccak256(append([]byte("quantum-mempool-secret"), n.validatorPrivKey...))
+	if path := n.config.MempoolSecret; path != "" {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(n.config.DataDir, path)
+		}
+		var err error
+		if secret, err = LoadMempoolSecret(path); err != nil {
+			return err
+		}
+	}
+
+	n.epochKeys = NewEpochKeyring(secret)
+	return nil
+}
+
 func (n *Node) loadValidator(keyHex string) error {
 	// Load validator from hex string
 	keyBytes, err := hex.DecodeString(keyHex)
@@ -308,8 +556,11 @@ func (n *Node) saveValidatorToFile(keyPath string, keyBytes []byte) error {
 func (n *Node) getPublicKey() []byte {
 	if n.validatorAlg == crypto.SigAlgDilithium {
 		// Derive public key from private key
-		privKey, _ := crypto.DilithiumPrivateKeyFromBytes(n.validatorPrivKey)
-		return privKey.Bytes()[:crypto.DilithiumPublicKeySize] // Extract public portion
+		privKey, err := crypto.DilithiumPrivateKeyFromBytes(n.validatorPrivKey)
+		if err != nil {
+			return nil
+		}
+		return privKey.Public().Bytes()
 	}
 	return nil
 }
@@ -327,11 +578,12 @@ func (n *Node) Start() error {
 	log.Printf("Network ID: %d", n.config.NetworkID)
 	log.Printf("Listen Address: %s", n.config.ListenAddr)
 
-	// Start enhanced P2P network with security features (temporarily disabled to avoid port conflicts)
-	// TODO: Configure enhanced P2P to use different port than legacy P2P
-	// if err := n.enhancedP2P.Start(); err != nil {
-	//	return fmt.Errorf("failed to start enhanced P2P network: %w", err)
-	// }
+	// Start the validator mesh
+	if n.enhancedP2P != nil {
+		if err := n.enhancedP2P.Start(); err != nil {
+			return fmt.Errorf("failed to start validator mesh: %w", err)
+		}
+	}
 
 	// Start legacy P2P for compatibility
 	if err := n.p2p.Start(n.ctx); err != nil {
@@ -385,7 +637,12 @@ func (n *Node) Stop() {
 	log.Printf("Stopping node...")
 
 	n.cancel()
+	n.running = false
+
+	// Block production takes the lock, wait for it without holding it
+	n.mu.Unlock()
 	n.wg.Wait()
+	n.mu.Lock()
 
 	if n.rpc != nil {
 		n.rpc.Stop()
@@ -395,29 +652,98 @@ func (n *Node) Stop() {
 		n.p2p.Stop()
 	}
 
+	if n.enhancedP2P != nil {
+		n.enhancedP2P.Stop()
+	}
+
 	if n.blockchain != nil {
 		n.blockchain.Close()
 	}
 
-	n.running = false
 	log.Printf("Node stopped")
 }
 
 // AddTransaction adds a transaction to the pool
 func (n *Node) AddTransaction(tx *types.QuantumTransaction) error {
 	// Validate transaction
-	valid, err := tx.VerifySignature()
-	if err != nil {
-		return fmt.Errorf("transaction verification failed: %w", err)
+	if err := n.txPool.ValidateTransaction(tx); err != nil {
+		return fmt.Errorf("transaction validation failed: %w", err)
 	}
-	if !valid {
-		return fmt.Errorf("invalid transaction signature")
+	if err := tx.ValidateFees(); err != nil {
+		return err
 	}
 
 	// Add to pool
 	return n.txPool.AddTransaction(tx)
 }
 
+// handlePeerTransaction adds a transaction received from a peer to the pool.
+// An invalid signature is the fault of the peer, other rejections such as a
+// known or outdated transaction are not.
+func (n *Node) handlePeerTransaction(tx *types.QuantumTransaction) error {
+	if _, known := n.txPool.GetTransaction(tx.Hash()); known {
+		return fmt.Errorf("transaction %s already known", tx.Hash().Hex())
+	}
+	return n.AddTransaction(tx)
+}
+
+// handlePeerBlock imports a block received from a peer when it extends the
+// head and is signed by a known validator. A block with a forged signature,
+// or failing validation on top of its parent, is the fault of the peer.
+func (n *Node) handlePeerBlock(block *types.Block) error {
+	if _, err := n.blockchain.GetBlockByHash(block.Hash()); err == nil {
+		return fmt.Errorf("block %s already known", block.Hash().Hex())
+	}
+
+	header := block.Header
+	valid, err := header.VerifyValidatorSignature()
+	if err != nil || !valid {
+		return fmt.Errorf("%w: block #%d is not signed by its validator", network.ErrInvalidSignature, block.Number())
+	}
+	if types.PublicKeyToAddress(header.ValidatorSig.PublicKey) != header.ValidatorAddr {
+		return fmt.Errorf("%w: block #%d is signed by another key than its validator's", network.ErrInvalidSignature, block.Number())
+	}
+	n.reportConflictingProposal(block)
+
+	head := n.blockchain.GetCurrentBlock()
+	if block.Number().Uint64() > head.Number().Uint64()+1 {
+		n.requestSync(header.ValidatorAddr)
+	}
+	if block.Number().Uint64() != head.Number().Uint64()+1 {
+		return fmt.Errorf("block #%d does not extend head #%d", block.Number(), head.Number())
+	}
+	if !n.isKnownValidator(header.ValidatorAddr) {
+		return fmt.Errorf("block #%d proposed by unknown validator %s", block.Number(), header.ValidatorAddr.Hex())
+	}
+	if err := n.validateRoundTime(block, head); err != nil {
+		return fmt.Errorf("%w: %v", network.ErrInvalidBlock, err)
+	}
+
+	if err := n.importBlock(block); err != nil {
+		// The head may have moved on while the block was checked
+		if n.blockchain.GetCurrentBlock().Number().Cmp(block.Number()) >= 0 {
+			return fmt.Errorf("block #%d is outdated: %v", block.Number(), err)
+		}
+		return fmt.Errorf("%w: %v", network.ErrInvalidBlock, err)
+	}
+
+	log.Printf("📥 Imported block #%d from validator %s", block.Number(), header.ValidatorAddr.Hex())
+	return nil
+}
+
+// isKnownValidator reports whether an address is in the validator set
+func (n *Node) isKnownValidator(addr types.Address) bool {
+	if n.multiConsensus == nil {
+		return false
+	}
+	for _, validator := range n.multiConsensus.GetValidatorSet() {
+		if validator.Address == addr {
+			return true
+		}
+	}
+	return false
+}
+
 // GetBlockchain returns the blockchain
 func (n *Node) GetBlockchain() *Blockchain {
 	return n.blockchain
@@ -467,7 +793,7 @@ func (n *Node) startMultiValidatorConsensus() {
 			case <-n.ctx.Done():
 				return
 			case <-ticker.C:
-				n.produceConsensusBlock()
+				n.consensusStep()
 			}
 		}
 	}()
@@ -503,12 +829,25 @@ func (n *Node) produceFastBlock() {
 	networkLoad := float64(pendingCount) / 5000.0 // 5000 is max pool size
 	n.gasPricing.UpdateNetworkLoad(networkLoad)
 
+	// This validator alone holds the key shares of the parent's encrypted transactions
+	n.shares.prune(currentBlock.Number().Uint64())
+	n.releaseDecryptionShares(currentBlock)
+	keys, _ := n.shares.payloadKeys(currentBlock)
+
 	// Get pending transactions with higher limit for throughput
-	transactions := n.txPool.GetPendingTransactions(500) // Up to 500 tx per 2-second block!
+	baseFee := types.CalcBaseFee(currentBlock.Header)
+	transactions := n.executableTransactions(blockHeight.Uint64(), baseFee, 500) // Up to 500 tx per 2-second block!
 	if len(transactions) > 0 {
 		log.Printf("📦 Including %d transactions in block", len(transactions))
 	}
 
+	// Every block commits to the state its parent left
+	stateRoot, err := n.blockchain.StateRoot(currentBlock.Number().Uint64())
+	if err != nil {
+		log.Printf("Failed to calculate state root: %v", err)
+		return
+	}
+
 	// Create block with optimized gas limit
 	blockGasLimit := uint64(types.DefaultBlockGasLimit) // 50M gas for high throughput
 
@@ -516,20 +855,29 @@ func (n *Node) produceFastBlock() {
 		ParentHash:  currentBlock.Hash(),
 		UncleHash:   types.ZeroHash,    // No uncles in quantum blockchain
 		Coinbase:    n.validatorAddr,   // Set validator as coinbase
-		Root:        types.ZeroHash,    // State root - simplified for now
+		Root:        stateRoot,         // State the parent left
 		TxHash:      types.ZeroHash,    // Transaction root - will be calculated
 		ReceiptHash: types.ZeroHash,    // Receipt root - simplified for now
 		Bloom:       make([]byte, 256), // Empty bloom filter
 		Difficulty:  big.NewInt(1),     // Fixed difficulty for PoS
 		Number:      blockHeight,
 		GasLimit:    blockGasLimit,
-		GasUsed:     n.calculateGasUsed(transactions),
 		Time:        uint64(time.Now().Unix()), // Add current timestamp
-		Extra:       []byte("Quantum-Fast"),    // Extra data
-		MixDigest:   types.ZeroHash,            // Not used in PoS
-		Nonce:       0,                         // Not used in PoS
+		BaseFee:     baseFee,
+		Extra:       []byte("Quantum-Fast"), // Extra data
+		MixDigest:   types.ZeroHash,         // Not used in PoS
+		Nonce:       0,                      // Not used in PoS
 	}, transactions, nil)
 
+	// The parent fixed the order of its encrypted transactions, reveal their keys
+	block.SetDecryptionKeys(keys)
+
+	// The signature covers the gas used, execute before signing
+	if block.Header.GasUsed, err = n.blockchain.BlockGasUsed(block); err != nil {
+		log.Printf("Failed to execute block: %v", err)
+		return
+	}
+
 	// Sign the block with validator signature
 	err = block.Header.SignBlock(n.validatorPrivKey, n.validatorAlg, n.validatorAddr)
 	if err != nil {
@@ -561,12 +909,7 @@ func (n *Node) produceFastBlock() {
 		n.txPool.RemoveTransaction(tx.Hash())
 	}
 
-	// Calculate transaction fees from included transactions
-	transactionFees := big.NewInt(0)
-	for _, tx := range transactions {
-		fee := new(big.Int).Mul(tx.GasPrice, big.NewInt(int64(tx.Gas)))
-		transactionFees.Add(transactionFees, fee)
-	}
+	transactionFees := n.settleBlockFees(block)
 
 	// Calculate block reward using tokenomics engine
 	blockReward := new(big.Int)
@@ -578,6 +921,11 @@ func (n *Node) produceFastBlock() {
 		log.Printf("Failed to distribute block reward: %v", err)
 	}
 
+	// The state after the block is final, the next block commits to its root
+	if err := n.blockchain.CacheStateRoot(block); err != nil {
+		log.Printf("Failed to calculate state root of block #%d: %v", block.Number(), err)
+	}
+
 	log.Printf("🚀 Fast block #%d: %d tx, %.1f%% load, proposer: %s, reward: %s QTM (+ fees: %s QTM)",
 		blockHeight.Uint64(), len(transactions), networkLoad*100,
 		nextProposer.Hex()[:10]+"...",
@@ -601,8 +949,9 @@ func (n *Node) produceConsensusBlock() {
 	currentBlock := n.blockchain.GetCurrentBlock()
 	blockHeight := new(big.Int).Add(currentBlock.Number(), big.NewInt(1))
 
-	// Check if this validator should propose next block using multi-validator consensus
-	nextProposer, err := n.multiConsensus.GetNextProposer(blockHeight.Uint64())
+	// Check if this validator should propose next block in the current round
+	round, _ := n.currentRound(blockHeight.Uint64())
+	nextProposer, err := n.multiConsensus.GetProposer(blockHeight.Uint64(), round)
 	if err != nil {
 		log.Printf("Failed to get next proposer: %v", err)
 		return
@@ -613,6 +962,44 @@ func (n *Node) produceConsensusBlock() {
 		return
 	}
 
+	// Our proposal for this height is still collecting votes
+	if n.proposals.hasVoted(blockHeight.Uint64(), round) {
+		return
+	}
+
+	// Blocks are at least a second apart, the head may just have been committed
+	if uint64(n.now().Unix()) <= currentBlock.Time() {
+		return
+	}
+
+	// Later rounds start no earlier than the timeouts of the rounds before
+	timeout := uint64(n.multiConsensus.ProposalTimeout() / time.Second)
+	if uint64(n.now().Unix()) < currentBlock.Time()+round*timeout {
+		return
+	}
+
+	// The validators release their key shares once the parent is committed,
+	// give them half the round to recover the keys of its encrypted
+	// transactions, which fail without them
+	keys, complete := n.shares.payloadKeys(currentBlock)
+	if !complete && n.now().Sub(n.lastImport()) < n.multiConsensus.ProposalTimeout()/2 {
+		return
+	}
+
+	// The first block of an epoch commits to its validator set
+	validatorsHash, err := n.epochValidatorsHash(blockHeight.Uint64())
+	if err != nil {
+		log.Printf("Failed to get validator set: %v", err)
+		return
+	}
+
+	// Every block commits to the state its parent left
+	stateRoot, err := n.blockchain.StateRoot(currentBlock.Number().Uint64())
+	if err != nil {
+		log.Printf("Failed to calculate state root: %v", err)
+		return
+	}
+
 	// Update metrics
 	// Monitor block proposal (metrics implementation pending)
 	log.Printf("📊 Block proposed by validator: %s", n.validatorAddr.Hex())
@@ -623,7 +1010,8 @@ func (n *Node) produceConsensusBlock() {
 	n.gasPricing.UpdateNetworkLoad(networkLoad)
 
 	// Get pending transactions with higher limit for throughput
-	transactions := n.txPool.GetPendingTransactions(500) // Up to 500 tx per 2-second block!
+	baseFee := types.CalcBaseFee(currentBlock.Header)
+	transactions := n.executableTransactions(blockHeight.Uint64(), baseFee, 500) // Up to 500 tx per 2-second block!
 	if len(transactions) > 0 {
 		log.Printf("📦 Including %d transactions in block", len(transactions))
 	}
@@ -635,109 +1023,113 @@ func (n *Node) produceConsensusBlock() {
 		ParentHash:  currentBlock.Hash(),
 		UncleHash:   types.ZeroHash,    // No uncles in quantum blockchain
 		Coinbase:    n.validatorAddr,   // Set validator as coinbase
-		Root:        types.ZeroHash,    // State root - simplified for now
+		Root:        stateRoot,         // State the parent left
 		TxHash:      types.ZeroHash,    // Transaction root - will be calculated
 		ReceiptHash: types.ZeroHash,    // Receipt root - simplified for now
 		Bloom:       make([]byte, 256), // Empty bloom filter
 		Difficulty:  big.NewInt(1),     // Fixed difficulty for PoS
 		Number:      blockHeight,
 		GasLimit:    blockGasLimit,
-		GasUsed:     n.calculateGasUsed(transactions),
-		Time:        uint64(time.Now().Unix()), // Add current timestamp
-		Extra:       []byte("Quantum-Multi"),   // Extra data
-		MixDigest:   types.ZeroHash,            // Not used in PoS
-		Nonce:       0,                         // Not used in PoS
+		Time:        uint64(n.now().Unix()), // Add current timestamp
+		BaseFee:     baseFee,
+		Extra:       []byte("Quantum-Multi"), // Extra data
+		MixDigest:   types.ZeroHash,          // Not used in PoS
+		Nonce:       0,                       // Not used in PoS
+		Round:       round,                   // Rounds past 0 skipped offline proposers
+
+		ValidatorsHash: validatorsHash,
 	}, transactions, nil)
 
-	// Sign block with validator's quantum-resistant key
-	blockHash := block.Hash()
-	signature, err := crypto.SignMessage(blockHash.Bytes(), n.validatorAlg, n.validatorPrivKey)
-	if err != nil {
-		log.Printf("Failed to sign block: %v", err)
-		return
-	}
+	// The parent fixed the order of its encrypted transactions, reveal their keys
+	block.SetDecryptionKeys(keys)
 
-	// Set signature in block
-	// TODO: Implement block signature storage in Block type
-	// block.SetSignature(signature, n.getPublicKey(), n.validatorAlg)
-	log.Printf("Block signed with quantum signature (len: %d bytes)", len(signature.Signature))
+	// Validators caught signing conflicting blocks or votes are punished
+	block.SetEvidence(n.pendingEvidence())
 
-	// Add block to blockchain
-	err = n.blockchain.AddBlock(block)
-	if err != nil {
-		log.Printf("Failed to add block: %v", err)
-		return
-	}
+	// The commit votes for the parent show which validators are live
+	block.SetLastCommit(n.multiConsensus.CommitSigs(currentBlock.Number().Uint64(), currentBlock.Header.Round, currentBlock.Hash()))
 
-	// Calculate transaction fees from included transactions
-	transactionFees := big.NewInt(0)
-	for _, tx := range transactions {
-		fee := new(big.Int).Mul(tx.GasPrice, big.NewInt(int64(tx.Gas)))
-		transactionFees.Add(transactionFees, fee)
-	}
-
-	// Calculate block reward using standard tokenomics
-	blockReward := big.NewInt(1000000000000000000) // 1 QTM reward per block
-
-	// Distribute rewards to the actual block proposer (determined by consensus)
-	err = n.multiConsensus.DistributeBlockReward(nextProposer, blockReward, transactionFees, n.tokenSupply)
+	// The signature covers the gas used, execute before signing
+	gasUsed, err := n.blockchain.BlockGasUsed(block)
 	if err != nil {
-		log.Printf("Failed to distribute block reward: %v", err)
+		log.Printf("Failed to execute block: %v", err)
+		return
 	}
+	block.Header.GasUsed = gasUsed
 
-	// Remove included transactions from pool (method name may differ)
-	for _, tx := range transactions {
-		n.txPool.RemoveTransaction(tx.Hash())
+	// Sign block with validator's quantum-resistant key
+	if err := block.Header.SignBlock(n.validatorPrivKey, n.validatorAlg, n.validatorAddr); err != nil {
+		log.Printf("Failed to sign block: %v", err)
+		return
 	}
 
-	// Update monitoring metrics (metrics implementation pending)
-	log.Printf("📊 Block accepted with %d transactions", len(transactions))
-
-	log.Printf("🏛️ Multi-validator block #%d: %d tx, %.1f%% load, proposer: %s, reward: %s QTM (+ fees: %s QTM)",
-		blockHeight.Uint64(), len(transactions), networkLoad*100,
-		nextProposer.Hex()[:10]+"...",
-		new(big.Int).Div(blockReward, big.NewInt(1e18)).String(),
-		new(big.Int).Div(transactionFees, big.NewInt(1e18)).String())
-
-	// Broadcast block to enhanced P2P network
-	// TODO: Implement BroadcastBlock method in EnhancedP2PNetwork
-	// n.enhancedP2P.BroadcastBlock(block)
-	log.Printf("🌐 Block broadcast via P2P network (enhanced implementation pending)")
-
-	// Also broadcast to legacy P2P for compatibility
-	n.p2p.BroadcastBlock(block)
+	// The block is committed once a quorum of the validators votes for it
+	n.proposeBlock(block)
 }
 
-// calculateGasUsed calculates total gas used by transactions with optimized quantum costs
-func (n *Node) calculateGasUsed(transactions []*types.QuantumTransaction) uint64 {
-	totalGas := uint64(0)
-	networkLoad := n.gasPricing.CurrentLoad
-
-	for _, tx := range transactions {
-		// Base transaction cost (much lower than Ethereum's 21000)
-		gasUsed := uint64(5000) // Reduced base cost
-
-		// Add data cost (reduced rate)
-		gasUsed += uint64(len(tx.Data)) * 2 // 2 gas per byte vs Ethereum's 16
-
-		// Add quantum signature verification cost (heavily optimized)
-		switch tx.SigAlg {
-		case crypto.SigAlgDilithium:
-			gasUsed += 800 // Reduced from 50000!
-		case crypto.SigAlgFalcon:
-			gasUsed += 600 // Reduced from 30000!
-		default:
-			gasUsed += 800
+// blockHeaderReserve is the part of the block size kept free for the header,
+// the validator signature and the commit votes for the parent when selecting
+// transactions
+const blockHeaderReserve = 64 * 1024
+
+// executableTransactions returns up to limit pending transactions for the
+// block with the given number whose fee cap covers the base fee, that fit into
+// the block size, that are signed by the key bound to their sender and, if
+// encrypted, are encrypted for the epoch of the block. Once a transaction
+// of a sender is skipped its later nonces are skipped too, they could not
+// execute without it.
+//
+// Encrypted transactions execute in the next block, after the transactions
+// of that block are ordered, so their senders send nothing else until then.
+func (n *Node) executableTransactions(number uint64, baseFee *big.Int, limit int) []*types.QuantumTransaction {
+	pending := n.txPool.GetPendingTransactions(limit)
+	transactions := make([]*types.QuantumTransaction, 0, len(pending))
+	skipped := make(map[types.Address]bool)
+	rotated := make(map[types.Address]bool)
+	size := uint64(blockHeaderReserve)
+
+	// The block reveals and executes the encrypted transactions of its parent
+	for _, tx := range n.blockchain.GetCurrentBlock().EncryptedTransactions() {
+		skipped[tx.From()] = true
+		size += crypto.KyberSharedSecretSize // Revealed payload key
+	}
+	for _, tx := range pending {
+		from := tx.From()
+		if skipped[from] {
+			continue
 		}
+		// A fee payer that rotated earlier in the block no longer signs with the pooled key
+		if tx.IsSponsored() && rotated[*tx.FeePayer] {
+			skipped[from] = true
+			continue
+		}
+		if tx.GetGasFeeCap().Cmp(baseFee) < 0 || size+tx.Size() > types.MaxBlockSize {
+			skipped[from] = true
+			continue
+		}
+		if n.txPool.ValidateSenderKey(tx) != nil {
+			skipped[from] = true
+			continue
+		}
+		if tx.IsEncrypted() && tx.CheckEncryptionEpoch(number) != nil {
+			skipped[from] = true
+			continue
+		}
+		size += tx.Size()
+		transactions = append(transactions, tx)
 
-		// Dynamic adjustment based on network load (minimal impact)
-		loadMultiplier := 1.0 + (networkLoad * 0.2) // Max 1.2x increase
-		gasUsed = uint64(float64(gasUsed) * loadMultiplier)
+		// Later transactions of the sender wait for the encrypted one to execute
+		if tx.IsEncrypted() {
+			skipped[from] = true
+		}
 
-		totalGas += gasUsed
+		// Later transactions of the sender are signed with the rotated key
+		if tx.IsKeyRotation() {
+			skipped[from] = true
+			rotated[from] = true
+		}
 	}
-
-	return totalGas
+	return transactions
 }
 
 // SetMining starts or stops mining
@@ -767,6 +1159,17 @@ func (n *Node) GetValidatorAddress() types.Address {
 }
 
 // GetConfig returns the node configuration
+// GetValidatorMesh returns the network connecting the validators, nil if
+// the mesh is disabled
+func (n *Node) GetValidatorMesh() *network.EnhancedP2PNetwork {
+	return n.enhancedP2P
+}
+
+// GetEpochKeyring returns the encrypted mempool keys of this validator, nil unless the node is a validator
+func (n *Node) GetEpochKeyring() *EpochKeyring {
+	return n.epochKeys
+}
+
 func (n *Node) GetConfig() *Config {
 	return n.config
 }
@@ -3,6 +3,7 @@ package node
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -10,6 +11,7 @@ import (
 	"sync"
 	"time"
 
+	"quantum-blockchain/chain/network"
 	"quantum-blockchain/chain/types"
 
 	"github.com/gorilla/websocket"
@@ -26,31 +28,56 @@ const (
 	MsgTypePong
 	MsgTypeGetBlocks
 	MsgTypeBlocks
+	MsgTypeFindNode
+	MsgTypeNeighbors
+	MsgTypeNewPooledTransactionHashes
+	MsgTypeGetPooledTransactions
+	MsgTypePooledTransactions
+	MsgTypeCompactBlock
+	MsgTypeGetBlockTransactions
+	MsgTypeBlockTransactions
 )
 
-// P2PMessage represents a P2P network message
+const (
+	// peerMessageBurst and peerMessageRate bound the messages a peer may
+	// send, messages beyond are dropped and lower the peer score
+	peerMessageBurst = 500
+	peerMessageRate  = 100
+)
+
+// P2PMessage represents a P2P network message. Peers on the framed protocol
+// version exchange it as a binary frame carrying the type, request ID and
+// compressed data, older peers as JSON.
 type P2PMessage struct {
 	Type      MessageType     `json:"type"`
 	Data      json.RawMessage `json:"data"`
 	Timestamp int64           `json:"timestamp"`
 	From      string          `json:"from"`
+	RequestID uint64          `json:"requestId,omitempty"` // Pairs responses with requests
 }
 
 // HandshakeData represents handshake information
 type HandshakeData struct {
-	Version   uint32 `json:"version"`
-	NetworkID uint64 `json:"networkId"`
-	NodeID    string `json:"nodeId"`
-	Height    uint64 `json:"height"`
+	Version   uint32              `json:"version"` // Highest protocol version spoken`
+	NetworkID uint64              `json:"networkId"`
+	NodeID    string              `json:"nodeId"`
+	Height    uint64              `json:"height"`
+	Record    *network.NodeRecord `json:"record,omitempty"`
+	Discovery bool                `json:"discovery,omitempty"` // The session only serves discovery queries
 }
 
-// Peer represents a connected peer
+// Peer represents a connected peer. Its ID is derived from the identity key
+// it proved in the secure handshake.
 type Peer struct {
-	ID       string          `json:"id"`
-	Address  string          `json:"address"`
-	Conn     *websocket.Conn `json:"-"`
-	NodeInfo *HandshakeData  `json:"nodeInfo"`
-	LastSeen time.Time       `json:"lastSeen"`
+	ID       string              `json:"id"`
+	Address  string              `json:"address"`
+	Conn     *network.SecureConn `json:"-"`
+	NodeInfo *HandshakeData      `json:"nodeInfo"`
+	Inbound  bool                `json:"inbound"`
+	LastSeen time.Time           `json:"lastSeen"`
+	Protocol uint32              `json:"protocol"` // Negotiated protocol version
+	limiter  *network.TokenBucket
+	knownTxs *hashCache // Transactions the peer is known to have
 	mu       sync.Mutex
 }
 
@@ -59,7 +86,42 @@ func (p *Peer) SendMessage(msg *P2PMessage) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	return p.Conn.WriteJSON(msg)
+	if p.Protocol < network.FramedProtocolVersion {
+		return p.Conn.WriteJSON(msg)
+	}
+	_, err := p.Conn.WriteMessageFrame(&network.Frame{
+		Version:   uint8(p.Protocol),
+		Type:      uint8(msg.Type),
+		RequestID: msg.RequestID,
+		Payload:   msg.Data,
+	})
+	return err
+}
+
+// ReadMessage receives the next message from the peer
+func (p *Peer) ReadMessage() (*P2PMessage, error) {
+	if p.Protocol < network.FramedProtocolVersion {
+		var msg P2PMessage
+		if err := p.Conn.ReadJSON(&msg); err != nil {
+			return nil, err
+		}
+		return &msg, nil
+	}
+
+	frame, _, err := p.Conn.ReadMessageFrame()
+	if err != nil {
+		return nil, err
+	}
+	if uint32(frame.Version) != p.Protocol {
+		return nil, fmt.Errorf("%w: version %d on a version %d session", network.ErrInvalidFrame, frame.Version, p.Protocol)
+	}
+	return &P2PMessage{
+		Type:      MessageType(frame.Type),
+		Data:      frame.Payload,
+		Timestamp: time.Now().Unix(),
+		From:      p.ID,
+		RequestID: frame.RequestID,
+	}, nil
 }
 
 // P2PNetwork manages peer-to-peer networking
@@ -67,38 +129,57 @@ type P2PNetwork struct {
 	listenAddr     string
 	bootstrapPeers []string
 	peers          map[string]*Peer
+	identity       *network.NodeIdentity
 	nodeID         string
 	networkID      uint64
 
-	// Message handlers
-	messageHandlers map[MessageType]func(*Peer, json.RawMessage)
+	// Message handlers, an error wrapping one of the network errors of
+	// misbehavior penalizes the sending peer
+	messageHandlers map[MessageType]func(*Peer, json.RawMessage) error
+
+	// Peer discovery
+	discovery *discovery
+
+	// Peer reputation and bans
+	scorer *network.PeerScorer
+
+	// Transaction propagation and compact block relay
+	gossip *txGossip
+	relay  *blockRelay
 
 	// Control
 	listener net.Listener
+	server   *http.Server
 	ctx      context.Context
 	cancel   context.CancelFunc
 	wg       sync.WaitGroup
 	mu       sync.RWMutex
 
 	// Callbacks
-	onBlock       func(*types.Block)
-	onTransaction func(*types.QuantumTransaction)
+	onBlock       func(*types.Block) error
+	onTransaction func(*types.QuantumTransaction) error
 }
 
-// NewP2PNetwork creates a new P2P network
-func NewP2PNetwork(listenAddr string, bootstrapPeers []string) *P2PNetwork {
+// NewP2PNetwork creates a new P2P network authenticating as identity
+func NewP2PNetwork(listenAddr string, bootstrapPeers []string, identity *network.NodeIdentity) *P2PNetwork {
 	ctx, cancel := context.WithCancel(context.Background())
+	scorer, _ := network.NewPeerScorer("")
 
 	p2p := &P2PNetwork{
 		listenAddr:      listenAddr,
 		bootstrapPeers:  bootstrapPeers,
 		peers:           make(map[string]*Peer),
-		nodeID:          generateNodeID(),
+		identity:        identity,
+		nodeID:          identity.ID(),
 		networkID:       8888, // Quantum chain network ID
-		messageHandlers: make(map[MessageType]func(*Peer, json.RawMessage)),
+		messageHandlers: make(map[MessageType]func(*Peer, json.RawMessage) error),
+		discovery:       newDiscovery(identity.ID(), DiscoveryConfig{ChainID: 8888}),
+		gossip:          newTxGossip(),
+		relay:           newBlockRelay(),
 		ctx:             ctx,
 		cancel:          cancel,
 	}
+	p2p.SetPeerScorer(scorer)
 
 	// Register message handlers
 	p2p.registerMessageHandlers()
@@ -106,10 +187,6 @@ func NewP2PNetwork(listenAddr string, bootstrapPeers []string) *P2PNetwork {
 	return p2p
 }
 
-func generateNodeID() string {
-	return fmt.Sprintf("quantum-node-%d", time.Now().UnixNano())
-}
-
 // Start starts the P2P network
 func (p2p *P2PNetwork) Start(ctx context.Context) error {
 	p2p.mu.Lock()
@@ -124,11 +201,20 @@ func (p2p *P2PNetwork) Start(ctx context.Context) error {
 	p2p.listener = listener
 	log.Printf("P2P network listening on %s", p2p.listenAddr)
 
+	if err := p2p.startDiscovery(); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to start discovery: %w", err)
+	}
+
 	// Start accepting connections
+	p2p.server = &http.Server{
+		Handler:           http.HandlerFunc(p2p.serveWebSocket),
+		ReadHeaderTimeout: network.HandshakeTimeout,
+	}
 	p2p.wg.Add(1)
 	go func() {
 		defer p2p.wg.Done()
-		p2p.acceptConnections()
+		p2p.acceptConnections(listener)
 	}()
 
 	// Connect to bootstrap peers
@@ -153,201 +239,224 @@ func (p2p *P2PNetwork) Start(ctx context.Context) error {
 // Stop stops the P2P network
 func (p2p *P2PNetwork) Stop() {
 	p2p.mu.Lock()
-	defer p2p.mu.Unlock()
-
 	p2p.cancel()
 
-	if p2p.listener != nil {
-		p2p.listener.Close()
+	if p2p.server != nil {
+		p2p.server.Close()
 	}
 
 	// Close all peer connections
 	for _, peer := range p2p.peers {
 		peer.Conn.Close()
 	}
+	p2p.mu.Unlock()
 
+	// Peer goroutines take the lock to unregister themselves
 	p2p.wg.Wait()
+	if err := p2p.discovery.db.Save(); err != nil {
+		log.Printf("⚠️ Failed to save peer database: %v", err)
+	}
 	log.Printf("P2P network stopped")
 }
 
-func (p2p *P2PNetwork) acceptConnections() {
-	for {
-		select {
-		case <-p2p.ctx.Done():
-			return
-		default:
-		}
-
-		conn, err := p2p.listener.Accept()
-		if err != nil {
-			if p2p.ctx.Err() != nil {
-				return // Shutting down
-			}
-			log.Printf("Failed to accept connection: %v", err)
-			continue
-		}
+func (p2p *P2PNetwork) acceptConnections(listener net.Listener) {
+	err := p2p.server.Serve(listener)
+	if err != nil && err != http.ErrServerClosed {
+		log.Printf("Failed to accept connections: %v", err)
+	}
+}
 
-		// Upgrade to WebSocket
-		upgrader := websocket.Upgrader{}
-		wsConn, err := upgrader.Upgrade(&httpResponseWriter{conn}, &http.Request{}, nil)
-		if err != nil {
-			log.Printf("Failed to upgrade connection: %v", err)
-			conn.Close()
-			continue
-		}
+// serveWebSocket upgrades an incoming HTTP request to a peer connection
+func (p2p *P2PNetwork) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	if p2p.ctx.Err() != nil {
+		http.Error(w, "P2P network is stopped", http.StatusServiceUnavailable)
+		return
+	}
 
-		p2p.wg.Add(1)
-		go func() {
-			defer p2p.wg.Done()
-			p2p.handleIncomingConnection(wsConn)
-		}()
+	upgrader := websocket.Upgrader{HandshakeTimeout: network.HandshakeTimeout}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Failed to upgrade connection: %v", err)
+		return
 	}
+	conn.SetReadLimit(network.MaxWireMessageSize)
+
+	p2p.wg.Add(1)
+	defer p2p.wg.Done()
+	p2p.handleIncomingConnection(conn)
 }
 
 func (p2p *P2PNetwork) handleIncomingConnection(conn *websocket.Conn) {
 	defer conn.Close()
 
-	// Wait for handshake
-	var msg P2PMessage
-	err := conn.ReadJSON(&msg)
+	peer, err := p2p.secureHandshake(conn, conn.RemoteAddr().String(), false, false)
 	if err != nil {
-		log.Printf("Failed to read handshake: %v", err)
+		log.Printf("Handshake with %s failed: %v", conn.RemoteAddr(), err)
 		return
 	}
+	peer.Inbound = true
 
-	if msg.Type != MsgTypeHandshake {
-		log.Printf("Expected handshake message, got %v", msg.Type)
+	if peer.NodeInfo.Discovery {
+		p2p.serveDiscovery(peer)
 		return
 	}
 
-	var handshake HandshakeData
-	err = json.Unmarshal(msg.Data, &handshake)
-	if err != nil {
-		log.Printf("Failed to unmarshal handshake: %v", err)
+	if !p2p.registerPeer(peer) {
 		return
 	}
+	log.Printf("New peer connected: %s", peer.ID)
 
-	// Validate handshake
-	if handshake.NetworkID != p2p.networkID {
-		log.Printf("Network ID mismatch: expected %d, got %d", p2p.networkID, handshake.NetworkID)
+	// Handle messages from this peer
+	p2p.handlePeerMessages(peer)
+}
+
+func (p2p *P2PNetwork) connectToPeer(address string) {
+	peer, err := p2p.dialPeer(address, "")
+	if err != nil {
+		log.Printf("Failed to connect to peer %s: %v", address, err)
 		return
 	}
+	p2p.runPeer(peer)
+}
 
-	// Create peer
-	peer := &Peer{
-		ID:       handshake.NodeID,
-		Address:  conn.RemoteAddr().String(),
-		Conn:     conn,
-		NodeInfo: &handshake,
-		LastSeen: time.Now(),
+// dialPeer connects and authenticates to the node at address, which must
+// prove the expected ID unless it is empty
+func (p2p *P2PNetwork) dialPeer(address, expectedID string) (*Peer, error) {
+	dialer := &websocket.Dialer{HandshakeTimeout: network.HandshakeTimeout}
+	conn, _, err := dialer.DialContext(p2p.ctx, "ws://"+address, nil)
+	if err != nil {
+		return nil, err
 	}
+	conn.SetReadLimit(network.MaxWireMessageSize)
 
-	// Add to peers
-	p2p.mu.Lock()
-	p2p.peers[peer.ID] = peer
-	p2p.mu.Unlock()
-
-	log.Printf("New peer connected: %s", peer.ID)
-
-	// Send our handshake
-	ourHandshake := HandshakeData{
-		Version:   1,
-		NetworkID: p2p.networkID,
-		NodeID:    p2p.nodeID,
-		Height:    0, // Would get from blockchain
+	peer, err := p2p.secureHandshake(conn, address, true, false)
+	if err == nil && expectedID != "" && peer.ID != expectedID {
+		err = fmt.Errorf("expected node %s, found %s", expectedID, peer.ID)
 	}
-
-	handshakeData, _ := json.Marshal(ourHandshake)
-	responseMsg := &P2PMessage{
-		Type:      MsgTypeHandshake,
-		Data:      handshakeData,
-		Timestamp: time.Now().Unix(),
-		From:      p2p.nodeID,
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("handshake failed: %w", err)
 	}
-
-	peer.SendMessage(responseMsg)
-
-	// Handle messages from this peer
-	p2p.handlePeerMessages(peer)
+	return peer, nil
 }
 
-func (p2p *P2PNetwork) connectToPeer(address string) {
-	dialer := websocket.DefaultDialer
-	conn, _, err := dialer.Dial("ws://"+address, nil)
-	if err != nil {
-		log.Printf("Failed to connect to peer %s: %v", address, err)
+// runPeer registers an outbound peer and handles its messages until it disconnects
+func (p2p *P2PNetwork) runPeer(peer *Peer) {
+	defer peer.Conn.Close()
+
+	if !p2p.registerPeer(peer) {
 		return
 	}
+	log.Printf("Connected to peer: %s", peer.ID)
 
-	defer conn.Close()
+	// Handle messages from this peer
+	p2p.handlePeerMessages(peer)
+}
 
-	// Send handshake
+// secureHandshake establishes an encrypted session with a peer, exchanging
+// the handshake data authenticated by the identity keys of both nodes
+func (p2p *P2PNetwork) secureHandshake(conn *websocket.Conn, address string, initiator, discoveryOnly bool) (*Peer, error) {
 	handshake := HandshakeData{
-		Version:   1,
+		Version:   network.ProtocolVersion,
 		NetworkID: p2p.networkID,
 		NodeID:    p2p.nodeID,
 		Height:    0, // Would get from blockchain
+		Record:    p2p.Record(),
+		Discovery: discoveryOnly,
 	}
-
-	handshakeData, _ := json.Marshal(handshake)
-	msg := &P2PMessage{
-		Type:      MsgTypeHandshake,
-		Data:      handshakeData,
-		Timestamp: time.Now().Unix(),
-		From:      p2p.nodeID,
-	}
-
-	err = conn.WriteJSON(msg)
+	handshakeData, err := json.Marshal(handshake)
 	if err != nil {
-		log.Printf("Failed to send handshake to %s: %v", address, err)
-		return
+		return nil, fmt.Errorf("failed to marshal handshake: %w", err)
 	}
 
-	// Wait for handshake response
-	var responseMsg P2PMessage
-	err = conn.ReadJSON(&responseMsg)
+	secureConn, err := network.Handshake(conn, p2p.identity, initiator, handshakeData)
 	if err != nil {
-		log.Printf("Failed to read handshake response from %s: %v", address, err)
-		return
-	}
-
-	if responseMsg.Type != MsgTypeHandshake {
-		log.Printf("Expected handshake response from %s", address)
-		return
+		return nil, err
 	}
 
 	var peerHandshake HandshakeData
-	err = json.Unmarshal(responseMsg.Data, &peerHandshake)
+	if err := json.Unmarshal(secureConn.RemotePayload(), &peerHandshake); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal handshake: %w", err)
+	}
+	if peerHandshake.NetworkID != p2p.networkID {
+		return nil, fmt.Errorf("network ID mismatch: expected %d, got %d", p2p.networkID, peerHandshake.NetworkID)
+	}
+	if peerHandshake.NodeID != secureConn.RemoteID() {
+		return nil, fmt.Errorf("peer announced node ID %s but proved %s", peerHandshake.NodeID, secureConn.RemoteID())
+	}
+	if p2p.scorer.IsBanned(secureConn.RemoteID()) {
+		return nil, fmt.Errorf("peer %s is banned", secureConn.RemoteID())
+	}
+	protocol, err := network.NegotiateProtocolVersion(peerHandshake.Version)
 	if err != nil {
-		log.Printf("Failed to unmarshal handshake from %s: %v", address, err)
-		return
+		return nil, err
+	}
+
+	// The record tells how to reach the peer again, and which fork it follows
+	if record := peerHandshake.Record; record != nil {
+		if record.ID() != secureConn.RemoteID() {
+			return nil, fmt.Errorf("peer sent the node record of %s", record.ID())
+		}
+		if err := p2p.checkRecord(record); err != nil {
+			return nil, fmt.Errorf("invalid node record: %w", err)
+		}
+		p2p.discovery.db.Update(record)
+		p2p.discovery.table.Add(record)
+		p2p.discovery.db.MarkSeen(record.ID())
 	}
 
-	// Create peer
-	peer := &Peer{
-		ID:       peerHandshake.NodeID,
+	return &Peer{
+		ID:       secureConn.RemoteID(),
 		Address:  address,
-		Conn:     conn,
+		Conn:     secureConn,
 		NodeInfo: &peerHandshake,
 		LastSeen: time.Now(),
-	}
+		Protocol: protocol,
+		limiter:  network.NewTokenBucket(peerMessageBurst, peerMessageRate),
+		knownTxs: newHashCache(peerKnownTxs),
+	}, nil
+}
 
-	// Add to peers
+// registerPeer adds an authenticated peer, refusing connections beyond the
+// peer limit and connections completing after shutdown. When two nodes dial
+// each other at once, both keep the connection dialed by the lower node ID.
+func (p2p *P2PNetwork) registerPeer(peer *Peer) bool {
 	p2p.mu.Lock()
-	p2p.peers[peer.ID] = peer
-	p2p.mu.Unlock()
-
-	log.Printf("Connected to peer: %s", peer.ID)
+	defer p2p.mu.Unlock()
 
-	// Handle messages from this peer
-	p2p.handlePeerMessages(peer)
+	if p2p.ctx.Err() != nil {
+		return false
+	}
+	if existing, exists := p2p.peers[peer.ID]; exists {
+		dialer := p2p.nodeID
+		if peer.Inbound {
+			dialer = peer.ID
+		}
+		existingDialer := p2p.nodeID
+		if existing.Inbound {
+			existingDialer = existing.ID
+		}
+		if existing.Inbound == peer.Inbound || existingDialer < dialer {
+			log.Printf("Already connected to peer %s, dropping duplicate connection", peer.ID)
+			return false
+		}
+		existing.Conn.Close()
+	} else if len(p2p.peers) >= p2p.discovery.config.MaxPeers {
+		log.Printf("Peer limit of %d reached, dropping peer %s", p2p.discovery.config.MaxPeers, peer.ID)
+		return false
+	}
+	p2p.peers[peer.ID] = peer
+	p2p.requestRefresh()
+	return true
 }
 
 func (p2p *P2PNetwork) handlePeerMessages(peer *Peer) {
 	defer func() {
 		// Remove peer on disconnect
 		p2p.mu.Lock()
-		delete(p2p.peers, peer.ID)
+		if p2p.peers[peer.ID] == peer {
+			delete(p2p.peers, peer.ID)
+		}
 		p2p.mu.Unlock()
 
 		log.Printf("Peer disconnected: %s", peer.ID)
@@ -360,34 +469,67 @@ func (p2p *P2PNetwork) handlePeerMessages(peer *Peer) {
 		default:
 		}
 
-		var msg P2PMessage
-		err := peer.Conn.ReadJSON(&msg)
+		msg, err := peer.ReadMessage()
 		if err != nil {
 			log.Printf("Failed to read message from peer %s: %v", peer.ID, err)
+			if errors.Is(err, network.ErrInvalidFrame) {
+				p2p.scorer.Record(peer.ID, network.ScoreMalformedMessage)
+			}
 			return
 		}
 
 		peer.LastSeen = time.Now()
 
+		if !peer.limiter.Consume(1) {
+			if p2p.scorer.Record(peer.ID, network.ScoreRateLimited) {
+				return
+			}
+			continue
+		}
+
 		// Handle message
 		p2p.mu.RLock()
 		handler, exists := p2p.messageHandlers[msg.Type]
 		p2p.mu.RUnlock()
 
-		if exists {
-			handler(peer, msg.Data)
+		if !exists {
+			continue
+		}
+		if err := handler(peer, msg.Data); err != nil && p2p.penalize(peer, err) {
+			return
 		}
 	}
 }
 
+// penalize lowers the score of a peer that sent a message failing with err,
+// and reports whether the peer got banned. Errors that are no fault of the
+// peer are only logged.
+func (p2p *P2PNetwork) penalize(peer *Peer, err error) bool {
+	event, misbehaved := network.ScoreEventForError(err)
+	if !misbehaved {
+		log.Printf("Ignored message from peer %s: %v", peer.ID, err)
+		return false
+	}
+	log.Printf("⚠️ Peer %s misbehaved: %v", peer.ID, err)
+	return p2p.scorer.Record(peer.ID, event)
+}
+
 func (p2p *P2PNetwork) registerMessageHandlers() {
 	p2p.messageHandlers[MsgTypePing] = p2p.handlePing
 	p2p.messageHandlers[MsgTypePong] = p2p.handlePong
 	p2p.messageHandlers[MsgTypeBlock] = p2p.handleBlock
 	p2p.messageHandlers[MsgTypeTransaction] = p2p.handleTransaction
+	p2p.messageHandlers[MsgTypeFindNode] = p2p.handleFindNode
+	p2p.messageHandlers[MsgTypeNeighbors] = p2p.handleNeighbors
+	p2p.messageHandlers[MsgTypeNewPooledTransactionHashes] = p2p.handleNewPooledTransactionHashes
+	p2p.messageHandlers[MsgTypeGetPooledTransactions] = p2p.handleGetPooledTransactions
+	p2p.messageHandlers[MsgTypePooledTransactions] = p2p.handlePooledTransactions
+	p2p.messageHandlers[MsgTypeCompactBlock] = p2p.handleCompactBlock
+	p2p.messageHandlers[MsgTypeGetBlockTransactions] = p2p.handleGetBlockTransactions
+	p2p.messageHandlers[MsgTypeBlockTransactions] = p2p.handleBlockTransactions
 }
 
-func (p2p *P2PNetwork) handlePing(peer *Peer, data json.RawMessage) {
+func (p2p *P2PNetwork) handlePing(peer *Peer, data json.RawMessage) error {
 	// Respond with pong
 	pongMsg := &P2PMessage{
 		Type:      MsgTypePong,
@@ -397,38 +539,41 @@ func (p2p *P2PNetwork) handlePing(peer *Peer, data json.RawMessage) {
 	}
 
 	peer.SendMessage(pongMsg)
+	return nil
 }
 
-func (p2p *P2PNetwork) handlePong(peer *Peer, data json.RawMessage) {
+func (p2p *P2PNetwork) handlePong(peer *Peer, data json.RawMessage) error {
 	// Just update last seen time (already done)
+	return nil
 }
 
-func (p2p *P2PNetwork) handleBlock(peer *Peer, data json.RawMessage) {
+func (p2p *P2PNetwork) handleBlock(peer *Peer, data json.RawMessage) error {
 	var block types.Block
 	err := json.Unmarshal(data, &block)
-	if err != nil {
-		log.Printf("Failed to unmarshal block from peer %s: %v", peer.ID, err)
-		return
+	if err != nil || block.Header == nil {
+		return fmt.Errorf("%w: failed to unmarshal block: %v", network.ErrInvalidMessage, err)
+	}
+	if err := block.Header.ValidateFields(); err != nil {
+		return fmt.Errorf("%w: %v", network.ErrInvalidMessage, err)
 	}
 
-	// Forward to block handler if set
-	if p2p.onBlock != nil {
-		p2p.onBlock(&block)
+	if p2p.relay.seen.Contains(block.Hash()) {
+		return nil
 	}
+
+	// Forward to block handler if set
+	return p2p.deliverBlock(peer, &block)
 }
 
-func (p2p *P2PNetwork) handleTransaction(peer *Peer, data json.RawMessage) {
+func (p2p *P2PNetwork) handleTransaction(peer *Peer, data json.RawMessage) error {
 	var tx types.QuantumTransaction
 	err := json.Unmarshal(data, &tx)
 	if err != nil {
-		log.Printf("Failed to unmarshal transaction from peer %s: %v", peer.ID, err)
-		return
+		return fmt.Errorf("%w: failed to unmarshal transaction: %v", network.ErrInvalidMessage, err)
 	}
 
-	// Forward to transaction handler if set
-	if p2p.onTransaction != nil {
-		p2p.onTransaction(&tx)
-	}
+	// Forward to transaction handler if set, a transaction it accepts is useful
+	return p2p.receiveTransaction(peer, &tx)
 }
 
 func (p2p *P2PNetwork) maintainPeers() {
@@ -465,68 +610,31 @@ func (p2p *P2PNetwork) sendPings() {
 	}
 }
 
-// BroadcastBlock broadcasts a block to all peers
-func (p2p *P2PNetwork) BroadcastBlock(block *types.Block) {
-	blockData, err := json.Marshal(block)
-	if err != nil {
-		log.Printf("Failed to marshal block for broadcast: %v", err)
-		return
-	}
-
-	msg := &P2PMessage{
-		Type:      MsgTypeBlock,
-		Data:      blockData,
-		Timestamp: time.Now().Unix(),
-		From:      p2p.nodeID,
-	}
-
-	p2p.broadcast(msg)
-}
-
-// BroadcastTransaction broadcasts a transaction to all peers
-func (p2p *P2PNetwork) BroadcastTransaction(tx *types.QuantumTransaction) {
-	txData, err := json.Marshal(tx)
-	if err != nil {
-		log.Printf("Failed to marshal transaction for broadcast: %v", err)
-		return
-	}
-
-	msg := &P2PMessage{
-		Type:      MsgTypeTransaction,
-		Data:      txData,
-		Timestamp: time.Now().Unix(),
-		From:      p2p.nodeID,
-	}
-
-	p2p.broadcast(msg)
+// SetBlockHandler sets the block message handler. A handler error wrapping
+// network.ErrInvalidSignature or network.ErrInvalidBlock penalizes the peer
+// that sent the block, other errors mean it is known or outdated.
+func (p2p *P2PNetwork) SetBlockHandler(handler func(*types.Block) error) {
+	p2p.onBlock = handler
 }
 
-func (p2p *P2PNetwork) broadcast(msg *P2PMessage) {
-	p2p.mu.RLock()
-	peers := make([]*Peer, 0, len(p2p.peers))
-	for _, peer := range p2p.peers {
-		peers = append(peers, peer)
-	}
-	p2p.mu.RUnlock()
-
-	for _, peer := range peers {
-		go func(p *Peer) {
-			err := p.SendMessage(msg)
-			if err != nil {
-				log.Printf("Failed to send message to peer %s: %v", p.ID, err)
-			}
-		}(peer)
-	}
+// SetTransactionHandler sets the transaction message handler, its errors
+// are scored like those of the block handler
+func (p2p *P2PNetwork) SetTransactionHandler(handler func(*types.QuantumTransaction) error) {
+	p2p.onTransaction = handler
 }
 
-// SetBlockHandler sets the block message handler
-func (p2p *P2PNetwork) SetBlockHandler(handler func(*types.Block)) {
-	p2p.onBlock = handler
+// SetPeerScorer replaces the scorer keeping the reputation of peers, which
+// may be shared with other networks. Peers it bans are disconnected.
+func (p2p *P2PNetwork) SetPeerScorer(scorer *network.PeerScorer) {
+	p2p.scorer = scorer
+	scorer.OnBan(func(ban *network.Ban) {
+		p2p.RemovePeer(ban.PeerID)
+	})
 }
 
-// SetTransactionHandler sets the transaction message handler
-func (p2p *P2PNetwork) SetTransactionHandler(handler func(*types.QuantumTransaction)) {
-	p2p.onTransaction = handler
+// PeerScorer returns the scorer keeping the reputation of peers
+func (p2p *P2PNetwork) PeerScorer() *network.PeerScorer {
+	return p2p.scorer
 }
 
 // GetPeers returns connected peers
@@ -542,19 +650,59 @@ func (p2p *P2PNetwork) GetPeers() []*Peer {
 	return peers
 }
 
-// Simple HTTP response writer for WebSocket upgrade
-type httpResponseWriter struct {
-	conn net.Conn
+// NodeID returns the identifier this node announces in handshakes
+func (p2p *P2PNetwork) NodeID() string {
+	return p2p.nodeID
 }
 
-func (w *httpResponseWriter) Header() http.Header {
-	return make(http.Header)
+// ListenAddr returns the address the network listens on
+func (p2p *P2PNetwork) ListenAddr() string {
+	p2p.mu.RLock()
+	defer p2p.mu.RUnlock()
+
+	if p2p.listener != nil {
+		return p2p.listener.Addr().String()
+	}
+	return p2p.listenAddr
 }
 
-func (w *httpResponseWriter) Write(data []byte) (int, error) {
-	return w.conn.Write(data)
+// AddPeer connects to a peer in the background
+func (p2p *P2PNetwork) AddPeer(address string) error {
+	if p2p.ctx.Err() != nil {
+		return fmt.Errorf("P2P network is stopped")
+	}
+
+	p2p.mu.RLock()
+	for _, peer := range p2p.peers {
+		if peer.Address == address {
+			p2p.mu.RUnlock()
+			return fmt.Errorf("already connected to %s", address)
+		}
+	}
+	p2p.mu.RUnlock()
+
+	p2p.wg.Add(1)
+	go func() {
+		defer p2p.wg.Done()
+		p2p.connectToPeer(address)
+	}()
+
+	return nil
 }
 
-func (w *httpResponseWriter) WriteHeader(statusCode int) {
-	// No-op for WebSocket upgrade
+// RemovePeer disconnects the peer with the given ID or address and reports
+// whether it was connected
+func (p2p *P2PNetwork) RemovePeer(idOrAddress string) bool {
+	p2p.mu.Lock()
+	defer p2p.mu.Unlock()
+
+	for id, peer := range p2p.peers {
+		if id == idOrAddress || peer.Address == idOrAddress {
+			delete(p2p.peers, id)
+			peer.Conn.Close()
+			log.Printf("Removed peer: %s", id)
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,140 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"quantum-blockchain/chain/consensus"
+	"quantum-blockchain/chain/network"
+	"quantum-blockchain/chain/types"
+)
+
+// maxClockDrift is how far ahead of the local clock a proposal may be
+// timestamped, later proposals could skip the timeouts of the rounds before
+const maxClockDrift = 5 * time.Second
+
+// currentRound returns the round this validator is in at a height and when
+// it started. A new height starts at round 0 when its parent was imported.
+func (n *Node) currentRound(height uint64) (uint64, time.Time) {
+	importedAt := n.lastImport()
+
+	n.roundMu.Lock()
+	defer n.roundMu.Unlock()
+
+	if n.roundHeight != height {
+		n.roundHeight = height
+		n.round = 0
+		n.roundStart = importedAt
+		n.roundVote = nil
+	}
+	return n.round, n.roundStart
+}
+
+// timeoutRound votes to move on to the next round once the current round at
+// the next height went a proposal timeout without a commit, and resends the
+// last round change vote of this validator. Validators that voted for a
+// proposal take part too: when the proposal only reached some of them, the
+// others could not form a quorum on their own. Once a quorum moves on, they
+// may vote for a proposal of the later round, so votes split across rounds
+// do not halt the height.
+func (n *Node) timeoutRound() {
+	if n.validatorPrivKey == nil || !n.isKnownValidator(n.validatorAddr) {
+		return
+	}
+	height := n.blockchain.GetCurrentBlock().Number().Uint64() + 1
+	round, start := n.currentRound(height)
+
+	if n.now().Sub(start) >= n.multiConsensus.ProposalTimeout() {
+		n.roundMu.Lock()
+		voted := n.roundVote != nil && n.roundVote.Round > round
+		n.roundMu.Unlock()
+
+		if !voted {
+			vote, err := n.multiConsensus.SubmitRoundChange(n.validatorAddr, height, round+1, n.validatorPrivKey)
+			if err != nil {
+				log.Printf("Failed to vote for round %d at height %d: %v", round+1, height, err)
+				return
+			}
+			log.Printf("⏰ No commit in round %d at height %d, voting for round %d", round, height, round+1)
+
+			n.roundMu.Lock()
+			if n.roundHeight == height {
+				n.roundVote = vote
+			}
+			n.roundMu.Unlock()
+		}
+	}
+
+	n.roundMu.Lock()
+	vote := n.roundVote
+	n.roundMu.Unlock()
+	if vote != nil && vote.BlockHeight == height {
+		n.broadcastVote(vote)
+	}
+	n.advanceRound(height)
+}
+
+// advanceRound moves on to the highest round at the next height that a
+// quorum of the validators voted for, if it is past the current round
+func (n *Node) advanceRound(height uint64) {
+	quorum := n.multiConsensus.RoundChangeQuorum(height)
+	if round, _ := n.currentRound(height); quorum <= round {
+		return
+	}
+
+	n.roundMu.Lock()
+	defer n.roundMu.Unlock()
+
+	if n.roundHeight != height || quorum <= n.round {
+		return
+	}
+	n.round = quorum
+	n.roundStart = n.now()
+	log.Printf("🔄 Moved to round %d at height %d", quorum, height)
+}
+
+// handleRoundChange records a round change vote of another validator and
+// moves on to the round a quorum of the validators voted for
+func (n *Node) handleRoundChange(msg *network.ConsensusMessage) error {
+	vote := &consensus.ConsensusVote{
+		Validator:    msg.Validator,
+		BlockHash:    msg.BlockHash,
+		BlockHeight:  msg.BlockHeight,
+		Round:        msg.Round,
+		VoteType:     msg.Type,
+		Timestamp:    msg.Timestamp,
+		Signature:    msg.Signature,
+		PublicKey:    msg.PublicKey,
+		SigAlgorithm: msg.SigAlgorithm,
+	}
+	err := n.multiConsensus.AddRoundChange(vote)
+	if errors.Is(err, consensus.ErrInvalidVote) {
+		return fmt.Errorf("%w: %v", network.ErrInvalidSignature, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	height := n.blockchain.GetCurrentBlock().Number().Uint64() + 1
+	if msg.BlockHeight > height {
+		n.requestSync(msg.Validator)
+	}
+	if msg.BlockHeight == height {
+		n.advanceRound(height)
+	}
+	return nil
+}
+
+// validateRoundTime checks that a block proposed in a later round is
+// timestamped at least the proposal timeouts of the rounds before after its
+// parent, which every node can verify from the headers
+func (n *Node) validateRoundTime(block, parent *types.Block) error {
+	timeout := uint64(n.multiConsensus.ProposalTimeout() / time.Second)
+	if earliest := parent.Time() + block.Header.Round*timeout; block.Time() < earliest {
+		return fmt.Errorf("block #%d of round %d is timestamped %d, before the round could start at %d",
+			block.Number(), block.Header.Round, block.Time(), earliest)
+	}
+	return nil
+}
@@ -5,10 +5,12 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"math/big"
+	"net"
 	"net/http"
-	"strconv"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -59,12 +61,17 @@ type ClientBucket struct {
 // RPCServer handles JSON-RPC requests
 type RPCServer struct {
 	node        *Node
-	httpServer  *http.Server
+	endpoints   []*RPCEndpoint
+	servers     []*http.Server
 	wsUpgrader  websocket.Upgrader
 	rateLimiter *RateLimiter
 	httpPort    int
 	wsPort      int
 
+	// Batch limits
+	maxBatchSize     int // Maximum number of requests in a single batch
+	batchConcurrency int // Maximum number of batch items executed in parallel
+
 	// Method handlers
 	methods map[string]func(json.RawMessage) (interface{}, error)
 }
@@ -75,6 +82,12 @@ func NewRPCServer(node *Node, httpPort, wsPort int) *RPCServer {
 		node:     node,
 		httpPort: httpPort,
 		wsPort:   wsPort,
+		endpoints: []*RPCEndpoint{{
+			Name:       "http",
+			Network:    "tcp",
+			Address:    fmt.Sprintf(":%d", httpPort),
+			Namespaces: PublicNamespaces,
+		}},
 		wsUpgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 				return true // TODO: Implement proper CORS in production
@@ -85,7 +98,9 @@ func NewRPCServer(node *Node, httpPort, wsPort int) *RPCServer {
 			limit:    100, // 100 requests per minute
 			window:   time.Minute,
 		},
-		methods: make(map[string]func(json.RawMessage) (interface{}, error)),
+		maxBatchSize:     50, // Half the rate limit, every item counts against it
+		batchConcurrency: 16,
+		methods:          make(map[string]func(json.RawMessage) (interface{}, error)),
 	}
 
 	server.registerMethods()
@@ -133,6 +148,33 @@ func (rl *RateLimiter) IsAllowed(clientID string) bool {
 	return false
 }
 
+// AllowN checks if n requests from the client are allowed, consuming all of them on success
+func (rl *RateLimiter) AllowN(clientID string, n int) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	bucket, exists := rl.requests[clientID]
+
+	if !exists || now.After(bucket.resetTime) {
+		if n > rl.limit {
+			return false
+		}
+		rl.requests[clientID] = &ClientBucket{
+			count:     n,
+			resetTime: now.Add(rl.window),
+		}
+		return true
+	}
+
+	if bucket.count+n <= rl.limit {
+		bucket.count += n
+		return true
+	}
+
+	return false
+}
+
 // Clean removes expired entries to prevent memory leaks
 func (rl *RateLimiter) Clean() {
 	rl.mu.Lock()
@@ -146,19 +188,23 @@ func (rl *RateLimiter) Clean() {
 	}
 }
 
+// AddEndpoint registers an additional listener, for example a local admin
+// endpoint. It must be called before Start.
+func (s *RPCServer) AddEndpoint(ep *RPCEndpoint) error {
+	if err := ep.validate(); err != nil {
+		return err
+	}
+	s.endpoints = append(s.endpoints, ep)
+	return nil
+}
+
 // Start starts the RPC server
 func (s *RPCServer) Start() error {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", s.handleHTTP)
-	mux.HandleFunc("/ws", s.handleWebSocket)
-
-	s.httpServer = &http.Server{
-		Addr:    fmt.Sprintf(":%d", s.httpPort),
-		Handler: mux,
-		// Security settings
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
-		IdleTimeout:  120 * time.Second,
+	for _, ep := range s.endpoints {
+		if err := s.startEndpoint(ep); err != nil {
+			s.Stop()
+			return err
+		}
 	}
 
 	// Start rate limiter cleanup routine
@@ -174,9 +220,43 @@ func (s *RPCServer) Start() error {
 		}
 	}()
 
-	log.Printf("🔧 Starting RPC server on port %d", s.httpPort)
+	return nil
+}
+
+// startEndpoint starts serving a single endpoint
+func (s *RPCServer) startEndpoint(ep *RPCEndpoint) error {
+	if ep.Network == "unix" {
+		// Remove a socket left behind by an unclean shutdown
+		os.Remove(ep.Address)
+	}
+
+	listener, err := net.Listen(ep.Network, ep.Address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s endpoint %s: %w", ep.Name, ep.Address, err)
+	}
+	if ep.Network == "unix" {
+		if err := os.Chmod(ep.Address, 0600); err != nil {
+			listener.Close()
+			return fmt.Errorf("failed to restrict %s endpoint permissions: %w", ep.Name, err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { s.handleHTTP(ep, w, r) })
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) { s.handleWebSocket(ep, w, r) })
+
+	server := &http.Server{
+		Handler: mux,
+		// Security settings
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		IdleTimeout:  120 * time.Second,
+	}
+	s.servers = append(s.servers, server)
+
+	log.Printf("🔧 Starting RPC %s endpoint on %s (%s)", ep.Name, ep.Address, strings.Join(ep.Namespaces, ", "))
 	go func() {
-		if err := s.httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		if err := server.Serve(listener); err != http.ErrServerClosed {
 			log.Printf("❌ RPC server error: %v", err)
 		}
 	}()
@@ -186,9 +266,10 @@ func (s *RPCServer) Start() error {
 
 // Stop stops the RPC server
 func (s *RPCServer) Stop() {
-	if s.httpServer != nil {
-		s.httpServer.Shutdown(context.Background())
+	for _, server := range s.servers {
+		server.Shutdown(context.Background())
 	}
+	s.servers = nil
 }
 
 func (s *RPCServer) registerMethods() {
@@ -203,6 +284,8 @@ func (s *RPCServer) registerMethods() {
 	s.methods["eth_getTransactionReceipt"] = s.ethGetTransactionReceipt
 	s.methods["eth_sendRawTransaction"] = s.ethSendRawTransaction
 	s.methods["eth_gasPrice"] = s.ethGasPrice
+	s.methods["eth_maxPriorityFeePerGas"] = s.ethMaxPriorityFeePerGas
+	s.methods["eth_feeHistory"] = s.ethFeeHistory
 	s.methods["eth_estimateGas"] = s.ethEstimateGas
 	s.methods["eth_call"] = s.ethCall
 	s.methods["eth_getCode"] = s.ethGetCode
@@ -215,21 +298,43 @@ func (s *RPCServer) registerMethods() {
 	s.methods["quantum_getSupportedAlgorithms"] = s.quantumGetSupportedAlgorithms
 	s.methods["quantum_validateSignature"] = s.quantumValidateSignature
 	s.methods["quantum_getValidatorSet"] = s.quantumGetValidatorSet
+	s.methods["quantum_getLightBlock"] = s.quantumGetLightBlock
+	s.methods["quantum_getAccountProof"] = s.quantumGetAccountProof
 	s.methods["quantum_sendRawTransaction"] = s.quantumSendRawTransaction
+	s.methods["quantum_getKeyHistory"] = s.quantumGetKeyHistory
+	s.methods["quantum_getEncryptionKey"] = s.quantumGetEncryptionKey
 
 	// Mining methods
 	s.methods["miner_start"] = s.minerStart
 	s.methods["miner_stop"] = s.minerStop
 	s.methods["miner_setEtherbase"] = s.minerSetEtherbase
 
+	// Admin methods
+	s.methods["admin_peers"] = s.adminPeers
+	s.methods["admin_addPeer"] = s.adminAddPeer
+	s.methods["admin_removePeer"] = s.adminRemovePeer
+	s.methods["admin_bans"] = s.adminBans
+	s.methods["admin_banPeer"] = s.adminBanPeer
+	s.methods["admin_unbanPeer"] = s.adminUnbanPeer
+	s.methods["admin_nodeInfo"] = s.adminNodeInfo
+
+	// Debug methods
+	s.methods["debug_traceTransaction"] = s.debugTraceTransaction
+	s.methods["debug_traceBlock"] = s.debugTraceBlock
+	s.methods["debug_traceBlockByNumber"] = s.debugTraceBlockByNumber
+	s.methods["debug_traceBlockByHash"] = s.debugTraceBlockByHash
+
 	// Test methods (removed insecure methods that exposed private keys)
 }
 
-func (s *RPCServer) handleHTTP(w http.ResponseWriter, r *http.Request) {
+func (s *RPCServer) handleHTTP(ep *RPCEndpoint, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*") // TODO: Restrict in production
-	w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	// Browsers may only reach endpoints that can not control the node
+	if !ep.hasPrivileged() {
+		w.Header().Set("Access-Control-Allow-Origin", "*") // TODO: Restrict in production
+		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	}
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
@@ -241,46 +346,196 @@ func (s *RPCServer) handleHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Rate limiting
-	clientIP := s.getClientIP(r)
-	if !s.rateLimiter.IsAllowed(clientIP) {
-		s.writeError(w, &RPCError{
-			Code:    -32005,
-			Message: "Rate limit exceeded",
-		}, nil)
-		return
-	}
-
 	// Input size validation
-	if r.ContentLength > 1024*1024 { // 1MB limit
+	if r.ContentLength > maxRequestSize {
 		s.writeError(w, &RPCError{
-			Code:    -32006,
+			Code:    ErrCodeRequestTooLarge,
 			Message: "Request too large",
 		}, nil)
 		return
 	}
 
-	var req JSONRPCRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize+1))
 	if err != nil {
 		s.writeError(w, &RPCError{
-			Code:    -32700,
+			Code:    ErrCodeParse,
 			Message: "Parse error: " + err.Error(),
 		}, nil)
 		return
 	}
+	if len(body) > maxRequestSize {
+		s.writeError(w, &RPCError{
+			Code:    ErrCodeRequestTooLarge,
+			Message: "Request too large",
+		}, nil)
+		return
+	}
 
-	// Basic request validation
-	if err := s.validateRequest(&req); err != nil {
+	// Rate limiting - every item in a batch counts as a request
+	clientIP := s.getClientIP(r)
+	if !s.rateLimiter.AllowN(clientIP, countRequests(body)) {
 		s.writeError(w, &RPCError{
-			Code:    -32600,
-			Message: "Invalid Request: " + err.Error(),
-		}, req.ID)
+			Code:    ErrCodeLimitExceeded,
+			Message: "Rate limit exceeded",
+		}, nil)
 		return
 	}
 
-	response := s.handleRequest(&req)
-	json.NewEncoder(w).Encode(response)
+	// Notifications have nothing to respond with
+	if response := s.handleMessage(s.scopeFor(ep, r, body), body); response != nil {
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// scopeFor authenticates a request against the endpoint's authenticator
+func (s *RPCServer) scopeFor(ep *RPCEndpoint, r *http.Request, body []byte) *rpcScope {
+	var authErr error
+	if ep.Auth != nil {
+		authErr = ep.Auth.Authenticate(r, body)
+	}
+	return newRPCScope(ep, authErr)
+}
+
+// maxRequestSize is the maximum accepted size of a request body (1MB)
+const maxRequestSize = 1024 * 1024
+
+// isBatch reports whether the raw message is a JSON array
+func isBatch(msg []byte) bool {
+	for _, c := range msg {
+		switch c {
+		case ' ', '\t', '\n', '\r':
+			continue
+		case '[':
+			return true
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// countRequests returns the number of requests contained in a raw message
+func countRequests(msg []byte) int {
+	if !isBatch(msg) {
+		return 1
+	}
+	var batch []json.RawMessage
+	if err := json.Unmarshal(msg, &batch); err != nil || len(batch) == 0 {
+		return 1
+	}
+	return len(batch)
+}
+
+// handleMessage decodes a single request or a batch and returns the
+// response(s), nil when there is nothing to respond to
+func (s *RPCServer) handleMessage(scope *rpcScope, msg []byte) interface{} {
+	if !isBatch(msg) {
+		var req JSONRPCRequest
+		if err := json.Unmarshal(msg, &req); err != nil {
+			return &JSONRPCResponse{
+				JSONRPC: "2.0",
+				Error:   &RPCError{Code: ErrCodeParse, Message: "Parse error: " + err.Error()},
+			}
+		}
+		response := s.handleSingle(scope, &req)
+		if isNotification(msg) {
+			return nil
+		}
+		return response
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(msg, &batch); err != nil {
+		return &JSONRPCResponse{
+			JSONRPC: "2.0",
+			Error:   &RPCError{Code: ErrCodeParse, Message: "Parse error: " + err.Error()},
+		}
+	}
+
+	if len(batch) == 0 {
+		return &JSONRPCResponse{
+			JSONRPC: "2.0",
+			Error:   &RPCError{Code: ErrCodeInvalidRequest, Message: "Invalid Request: empty batch"},
+		}
+	}
+
+	if len(batch) > s.maxBatchSize {
+		return &JSONRPCResponse{
+			JSONRPC: "2.0",
+			Error: &RPCError{
+				Code:    ErrCodeLimitExceeded,
+				Message: fmt.Sprintf("batch too large: %d requests, maximum is %d", len(batch), s.maxBatchSize),
+			},
+		}
+	}
+
+	responses := s.handleBatch(scope, batch)
+	if len(responses) == 0 {
+		return nil
+	}
+	return responses
+}
+
+// isNotification reports whether a raw request has no "id" member. A null id
+// still identifies a request.
+func isNotification(raw json.RawMessage) bool {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &members); err != nil {
+		return false
+	}
+	_, hasID := members["id"]
+	return !hasID
+}
+
+// handleBatch executes batch items concurrently and returns responses in
+// request order. Notifications are executed but get no response.
+func (s *RPCServer) handleBatch(scope *rpcScope, batch []json.RawMessage) []*JSONRPCResponse {
+	responses := make([]*JSONRPCResponse, len(batch))
+	notifications := make([]bool, len(batch))
+	sem := make(chan struct{}, s.batchConcurrency)
+
+	var wg sync.WaitGroup
+	for i, raw := range batch {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, raw json.RawMessage) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			var req JSONRPCRequest
+			if err := json.Unmarshal(raw, &req); err != nil {
+				responses[i] = &JSONRPCResponse{
+					JSONRPC: "2.0",
+					Error:   &RPCError{Code: ErrCodeInvalidRequest, Message: "Invalid Request: " + err.Error()},
+				}
+				return
+			}
+			responses[i] = s.handleSingle(scope, &req)
+			notifications[i] = isNotification(raw)
+		}(i, raw)
+	}
+	wg.Wait()
+
+	replies := responses[:0]
+	for i, response := range responses {
+		if !notifications[i] {
+			replies = append(replies, response)
+		}
+	}
+	return replies
+}
+
+// handleSingle validates and executes a single decoded request
+func (s *RPCServer) handleSingle(scope *rpcScope, req *JSONRPCRequest) *JSONRPCResponse {
+	if err := s.validateRequest(req); err != nil {
+		return &JSONRPCResponse{
+			JSONRPC: "2.0",
+			Error:   &RPCError{Code: ErrCodeInvalidRequest, Message: "Invalid Request: " + err.Error()},
+			ID:      req.ID,
+		}
+	}
+
+	return s.handleRequest(scope, req)
 }
 
 // getClientIP extracts the real client IP from the request
@@ -329,7 +584,16 @@ func (s *RPCServer) validateRequest(req *JSONRPCRequest) error {
 	return nil
 }
 
-func (s *RPCServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+func (s *RPCServer) handleWebSocket(ep *RPCEndpoint, w http.ResponseWriter, r *http.Request) {
+	// Web pages must not be able to drive privileged endpoints
+	if ep.hasPrivileged() && r.Header.Get("Origin") != "" {
+		http.Error(w, "cross-origin WebSocket connections are not allowed", http.StatusForbidden)
+		return
+	}
+
+	// Credentials are checked once when the connection is upgraded
+	scope := s.scopeFor(ep, r, nil)
+
 	conn, err := s.wsUpgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade error: %v", err)
@@ -337,15 +601,26 @@ func (s *RPCServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.Close()
 
+	conn.SetReadLimit(maxRequestSize)
+	clientIP := s.getClientIP(r)
+
 	for {
-		var req JSONRPCRequest
-		err := conn.ReadJSON(&req)
+		_, msg, err := conn.ReadMessage()
 		if err != nil {
 			log.Printf("WebSocket read error: %v", err)
 			break
 		}
 
-		response := s.handleRequest(&req)
+		var response interface{}
+		if !s.rateLimiter.AllowN(clientIP, countRequests(msg)) {
+			response = &JSONRPCResponse{
+				JSONRPC: "2.0",
+				Error:   &RPCError{Code: ErrCodeLimitExceeded, Message: "Rate limit exceeded"},
+			}
+		} else if response = s.handleMessage(scope, msg); response == nil {
+			continue
+		}
+
 		err = conn.WriteJSON(response)
 		if err != nil {
 			log.Printf("WebSocket write error: %v", err)
@@ -354,13 +629,22 @@ func (s *RPCServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (s *RPCServer) handleRequest(req *JSONRPCRequest) *JSONRPCResponse {
+func (s *RPCServer) handleRequest(scope *rpcScope, req *JSONRPCRequest) *JSONRPCResponse {
 	method, exists := s.methods[req.Method]
-	if !exists {
+	if !exists || !scope.exposes(req.Method) {
 		log.Printf("⚠️ Unknown method requested: %s", req.Method)
 		return &JSONRPCResponse{
 			JSONRPC: "2.0",
-			Error:   &RPCError{Code: -32601, Message: "Method not found"},
+			Error:   &RPCError{Code: ErrCodeMethodNotFound, Message: "Method not found"},
+			ID:      req.ID,
+		}
+	}
+
+	if err := scope.authorize(req.Method); err != nil {
+		log.Printf("🚫 Unauthorized RPC call: %s", req.Method)
+		return &JSONRPCResponse{
+			JSONRPC: "2.0",
+			Error:   toRPCError(err),
 			ID:      req.ID,
 		}
 	}
@@ -373,7 +657,7 @@ func (s *RPCServer) handleRequest(req *JSONRPCRequest) *JSONRPCResponse {
 		log.Printf("❌ RPC method %s failed: %v", req.Method, err)
 		return &JSONRPCResponse{
 			JSONRPC: "2.0",
-			Error:   &RPCError{Code: -32000, Message: err.Error()},
+			Error:   toRPCError(err),
 			ID:      req.ID,
 		}
 	}
@@ -409,71 +693,87 @@ func (s *RPCServer) ethGetBalance(params json.RawMessage) (interface{}, error) {
 	var p []interface{}
 	err := json.Unmarshal(params, &p)
 	if err != nil || len(p) < 1 {
-		return nil, fmt.Errorf("invalid parameters")
+		return nil, invalidParams("invalid parameters")
 	}
 
 	addrStr, ok := p[0].(string)
 	if !ok {
-		return nil, fmt.Errorf("invalid address")
+		return nil, invalidParams("invalid address")
 	}
 
 	addr, err := types.HexToAddress(addrStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid address format: %w", err)
+		return nil, invalidParams("invalid address format: %v", err)
 	}
 
-	balance := s.node.blockchain.GetBalance(addr)
-	return fmt.Sprintf("0x%x", balance), nil
+	param, err := parseBlockParam(p, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	state, _, err := s.stateAt(param)
+	if err != nil {
+		return nil, err
+	}
+	defer state.Release()
+
+	return fmt.Sprintf("0x%x", state.GetBalance(addr)), nil
 }
 
 func (s *RPCServer) ethGetTransactionCount(params json.RawMessage) (interface{}, error) {
 	var p []interface{}
 	err := json.Unmarshal(params, &p)
 	if err != nil || len(p) < 1 {
-		return nil, fmt.Errorf("invalid parameters")
+		return nil, invalidParams("invalid parameters")
 	}
 
 	addrStr, ok := p[0].(string)
 	if !ok {
-		return nil, fmt.Errorf("invalid address")
+		return nil, invalidParams("invalid address")
 	}
 
 	addr, err := types.HexToAddress(addrStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid address format: %w", err)
+		return nil, invalidParams("invalid address format: %v", err)
+	}
+
+	param, err := parseBlockParam(p, 1)
+	if err != nil {
+		return nil, err
 	}
 
-	nonce := s.node.blockchain.GetNonce(addr)
-	return fmt.Sprintf("0x%x", nonce), nil
+	// The pending nonce counts pooled transactions even if they would fail
+	// to execute, so clients can queue further transactions behind them
+	if param.IsPending() {
+		nonce := s.node.blockchain.GetNonce(addr)
+		if s.node.txPool != nil {
+			nonce = s.node.txPool.GetPendingNonce(addr, nonce)
+		}
+		return fmt.Sprintf("0x%x", nonce), nil
+	}
+
+	state, _, err := s.stateAt(param)
+	if err != nil {
+		return nil, err
+	}
+	defer state.Release()
+
+	return fmt.Sprintf("0x%x", state.GetNonce(addr)), nil
 }
 
 func (s *RPCServer) ethGetBlockByNumber(params json.RawMessage) (interface{}, error) {
 	var p []interface{}
 	err := json.Unmarshal(params, &p)
 	if err != nil || len(p) < 1 {
-		return nil, fmt.Errorf("invalid parameters")
+		return nil, invalidParams("invalid parameters")
 	}
 
-	blockNumStr, ok := p[0].(string)
-	if !ok {
-		return nil, fmt.Errorf("invalid block number")
-	}
-
-	var blockNum *big.Int
-	if blockNumStr == "latest" {
-		blockNum = s.node.blockchain.GetCurrentBlock().Number()
-	} else {
-		if strings.HasPrefix(blockNumStr, "0x") {
-			blockNumStr = blockNumStr[2:]
-		}
-		num, err := strconv.ParseUint(blockNumStr, 16, 64)
-		if err != nil {
-			return nil, fmt.Errorf("invalid block number format: %w", err)
-		}
-		blockNum = big.NewInt(int64(num))
+	param, err := parseBlockParam(p, 0)
+	if err != nil {
+		return nil, err
 	}
 
-	block, err := s.node.blockchain.GetBlockByNumber(blockNum)
+	block, err := s.resolveBlock(param)
 	if err != nil {
 		return nil, err
 	}
@@ -485,17 +785,17 @@ func (s *RPCServer) ethGetBlockByHash(params json.RawMessage) (interface{}, erro
 	var p []interface{}
 	err := json.Unmarshal(params, &p)
 	if err != nil || len(p) < 1 {
-		return nil, fmt.Errorf("invalid parameters")
+		return nil, invalidParams("invalid parameters")
 	}
 
 	hashStr, ok := p[0].(string)
 	if !ok {
-		return nil, fmt.Errorf("invalid hash")
+		return nil, invalidParams("invalid hash")
 	}
 
 	hash, err := types.HexToHash(hashStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid hash format: %w", err)
+		return nil, invalidParams("invalid hash format: %v", err)
 	}
 
 	block, err := s.node.blockchain.GetBlockByHash(hash)
@@ -510,17 +810,17 @@ func (s *RPCServer) ethGetTransactionByHash(params json.RawMessage) (interface{}
 	var p []interface{}
 	err := json.Unmarshal(params, &p)
 	if err != nil || len(p) < 1 {
-		return nil, fmt.Errorf("invalid parameters")
+		return nil, invalidParams("invalid parameters")
 	}
 
 	hashStr, ok := p[0].(string)
 	if !ok {
-		return nil, fmt.Errorf("invalid hash")
+		return nil, invalidParams("invalid hash")
 	}
 
 	hash, err := types.HexToHash(hashStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid hash format: %w", err)
+		return nil, invalidParams("invalid hash format: %v", err)
 	}
 
 	// Check transaction pool first
@@ -537,17 +837,17 @@ func (s *RPCServer) ethGetTransactionReceipt(params json.RawMessage) (interface{
 	var p []interface{}
 	err := json.Unmarshal(params, &p)
 	if err != nil || len(p) < 1 {
-		return nil, fmt.Errorf("invalid parameters")
+		return nil, invalidParams("invalid parameters")
 	}
 
 	hashStr, ok := p[0].(string)
 	if !ok {
-		return nil, fmt.Errorf("invalid hash")
+		return nil, invalidParams("invalid hash")
 	}
 
 	hash, err := types.HexToHash(hashStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid hash format: %w", err)
+		return nil, invalidParams("invalid hash format: %v", err)
 	}
 
 	receipt, err := s.node.blockchain.GetTransactionReceipt(hash)
@@ -562,7 +862,7 @@ func (s *RPCServer) ethSendRawTransaction(params json.RawMessage) (interface{},
 	var p []string
 	err := json.Unmarshal(params, &p)
 	if err != nil || len(p) < 1 {
-		return nil, fmt.Errorf("invalid parameters")
+		return nil, invalidParams("invalid parameters")
 	}
 
 	// Decode the raw transaction
@@ -574,11 +874,11 @@ func (s *RPCServer) ethSendRawTransaction(params json.RawMessage) (interface{},
 	// Decode hex to bytes
 	txBytes, err := hex.DecodeString(rawTx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode hex transaction: %w", err)
+		return nil, invalidParams("failed to decode hex transaction: %v", err)
 	}
 	tx, err := types.DecodeRLPTransaction(txBytes)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode transaction: %w", err)
+		return nil, invalidParams("failed to decode transaction: %v", err)
 	}
 
 	// Validate the transaction
@@ -592,6 +892,7 @@ func (s *RPCServer) ethSendRawTransaction(params json.RawMessage) (interface{},
 			return nil, fmt.Errorf("failed to add transaction to pool: %w", err)
 		}
 		log.Printf("✅ Transaction added to pool: %s from %s", tx.Hash().Hex(), tx.From().Hex())
+		s.node.p2p.BroadcastTransaction(tx)
 	} else {
 		log.Printf("⚠️ Cannot add transaction - txPool is nil")
 	}
@@ -602,15 +903,21 @@ func (s *RPCServer) ethSendRawTransaction(params json.RawMessage) (interface{},
 
 // validateQuantumTransaction validates a quantum-resistant transaction
 func (s *RPCServer) validateQuantumTransaction(tx *types.QuantumTransaction) error {
-	// Verify quantum-resistant signature using the signing hash
-	sigHash := tx.SigningHash()
-	qrSig := &crypto.QRSignature{
-		Algorithm: tx.SigAlg,
-		Signature: tx.Signature,
-		PublicKey: tx.PublicKey,
+	// Verify quantum-resistant signature using the signing hash, multisig
+	// senders are verified against their policy instead
+	var valid bool
+	var err error
+	if tx.IsMultisig() {
+		valid, err = tx.VerifyMultisig()
+	} else {
+		sigHash := tx.SigningHash()
+		qrSig := &crypto.QRSignature{
+			Algorithm: tx.SigAlg,
+			Signature: tx.Signature,
+			PublicKey: tx.PublicKey,
+		}
+		valid, err = crypto.VerifySignature(sigHash[:], qrSig)
 	}
-
-	valid, err := crypto.VerifySignature(sigHash[:], qrSig)
 	if err != nil {
 		return fmt.Errorf("signature verification failed: %w", err)
 	}
@@ -631,44 +938,58 @@ func (s *RPCServer) validateQuantumTransaction(tx *types.QuantumTransaction) err
 		return fmt.Errorf("invalid gas limit")
 	}
 
-	// Validate signature algorithm
-	switch tx.SigAlg {
-	case crypto.SigAlgDilithium, crypto.SigAlgFalcon:
-		// Valid
-	default:
-		return fmt.Errorf("unsupported signature algorithm: %v", tx.SigAlg)
+	if err := checkTransactionLimits(tx); err != nil {
+		return err
 	}
 
-	return nil
-}
-
-func (s *RPCServer) ethGasPrice(params json.RawMessage) (interface{}, error) {
-	return "0x3b9aca00", nil // 1 Gwei
-}
-
-func (s *RPCServer) ethEstimateGas(params json.RawMessage) (interface{}, error) {
-	var p []interface{}
-	err := json.Unmarshal(params, &p)
-	if err != nil || len(p) < 1 {
-		return "0x5208", nil // Default 21000 gas
+	// Sponsored transactions also need a valid fee payer signature
+	if tx.IsSponsored() {
+		valid, err := tx.VerifyFeePayerSignature()
+		if err != nil {
+			return fmt.Errorf("fee payer signature verification failed: %w", err)
+		}
+		if !valid {
+			return fmt.Errorf("invalid fee payer signature")
+		}
 	}
-
-	txMap, ok := p[0].(map[string]interface{})
-	if !ok {
-		return "0x5208", nil // Default 21000 gas
+	if s.node != nil && s.node.blockchain != nil {
+		next := s.node.blockchain.GetCurrentBlock().Number().Uint64() + 1
+		if err := tx.CheckEncryptionEpoch(next); err != nil {
+			return err
+		}
+	}
+	if s.node != nil && s.node.txPool != nil {
+		if err := s.node.txPool.ValidateSenderKey(tx); err != nil {
+			return err
+		}
+		if err := s.node.txPool.ValidateBalances(tx); err != nil {
+			return err
+		}
 	}
 
-	// Check if it's a contract deployment (no to address)
-	if txMap["to"] == nil {
-		return "0x1e8480", nil // 2,000,000 gas for contract deployment
+	// Validate signature algorithm, multisig keys are checked by their policy
+	if !tx.IsMultisig() {
+		switch tx.SigAlg {
+		case crypto.SigAlgDilithium, crypto.SigAlgFalcon:
+			// Valid
+		default:
+			return fmt.Errorf("unsupported signature algorithm: %v", tx.SigAlg)
+		}
 	}
 
-	// Check if there's data (contract interaction)
-	if data, ok := txMap["data"].(string); ok && len(data) > 2 {
-		return "0xc350", nil // 50,000 gas for contract interaction
+	return nil
+}
+
+// ethGasPrice suggests a legacy gas price: the next base fee plus the suggested tip
+func (s *RPCServer) ethGasPrice(params json.RawMessage) (interface{}, error) {
+	tip, err := s.suggestGasTipCap()
+	if err != nil {
+		return nil, err
 	}
 
-	return "0x5208", nil // 21000 gas for simple transfer
+	head := s.node.blockchain.GetCurrentBlock()
+	price := new(big.Int).Add(types.CalcBaseFee(head.Header), tip)
+	return fmt.Sprintf("0x%x", price), nil
 }
 
 func (s *RPCServer) netVersion(params json.RawMessage) (interface{}, error) {
@@ -694,7 +1015,7 @@ func (s *RPCServer) quantumValidateSignature(params json.RawMessage) (interface{
 	var p map[string]interface{}
 	err := json.Unmarshal(params, &p)
 	if err != nil {
-		return nil, fmt.Errorf("invalid parameters")
+		return nil, invalidParams("invalid parameters")
 	}
 
 	// This would validate a quantum signature
@@ -702,24 +1023,11 @@ func (s *RPCServer) quantumValidateSignature(params json.RawMessage) (interface{
 	return map[string]bool{"valid": true}, nil
 }
 
-func (s *RPCServer) quantumGetValidatorSet(params json.RawMessage) (interface{}, error) {
-	if s.node.multiConsensus == nil {
-		return nil, fmt.Errorf("consensus engine not initialized")
-	}
-
-	validatorSet := s.node.multiConsensus.GetValidatorSet()
-	if validatorSet == nil {
-		return nil, fmt.Errorf("validator set not available")
-	}
-
-	return validatorSet, nil
-}
-
 func (s *RPCServer) quantumSendRawTransaction(params json.RawMessage) (interface{}, error) {
 	var p []string
 	err := json.Unmarshal(params, &p)
 	if err != nil || len(p) < 1 {
-		return nil, fmt.Errorf("invalid parameters")
+		return nil, invalidParams("invalid parameters")
 	}
 
 	// Decode the raw transaction hex
@@ -730,13 +1038,13 @@ func (s *RPCServer) quantumSendRawTransaction(params json.RawMessage) (interface
 
 	rawTxBytes, err := hex.DecodeString(rawTxHex)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode hex transaction: %w", err)
+		return nil, invalidParams("failed to decode hex transaction: %v", err)
 	}
 
 	// Decode the RLP transaction
 	tx, err := types.DecodeRLPTransaction(rawTxBytes)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode RLP transaction: %w", err)
+		return nil, invalidParams("failed to decode RLP transaction: %v", err)
 	}
 
 	// Validate the quantum transaction
@@ -750,6 +1058,7 @@ func (s *RPCServer) quantumSendRawTransaction(params json.RawMessage) (interface
 			return nil, fmt.Errorf("failed to add transaction to pool: %w", err)
 		}
 		log.Printf("✅ Transaction added to pool: %s from %s", tx.Hash().Hex(), tx.From().Hex())
+		s.node.p2p.BroadcastTransaction(tx)
 	} else {
 		log.Printf("⚠️ Cannot add transaction - txPool is nil")
 	}
@@ -779,58 +1088,35 @@ func (s *RPCServer) minerSetEtherbase(params json.RawMessage) (interface{}, erro
 
 // Critical EVM methods for production networks
 
-func (s *RPCServer) ethCall(params json.RawMessage) (interface{}, error) {
-	var p []interface{}
-	err := json.Unmarshal(params, &p)
-	if err != nil || len(p) < 2 {
-		return nil, fmt.Errorf("invalid parameters")
-	}
-
-	txMap, ok := p[0].(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("invalid transaction object")
-	}
-
-	// Execute the call (read-only)
-	to, _ := txMap["to"].(string)
-	data, _ := txMap["data"].(string)
-
-	// For now, return a simple result for testing
-	// In production, this would execute the EVM call
-	if to == "0x000000000000000000000000000000000000000a" {
-		// Dilithium precompile
-		return "0x0000000000000000000000000000000000000000000000000000000000000001", nil
-	}
-
-	// For contract calls, check if there's actual code to execute
-	if data != "" && data != "0x" {
-		// This would normally execute the contract bytecode
-		// For now, return empty result
-		return "0x", nil
-	}
-
-	return "0x", nil
-}
-
 func (s *RPCServer) ethGetCode(params json.RawMessage) (interface{}, error) {
 	var p []interface{}
 	err := json.Unmarshal(params, &p)
 	if err != nil || len(p) < 1 {
-		return nil, fmt.Errorf("invalid parameters")
+		return nil, invalidParams("invalid parameters")
 	}
 
 	addrStr, ok := p[0].(string)
 	if !ok {
-		return nil, fmt.Errorf("invalid address")
+		return nil, invalidParams("invalid address")
 	}
 
 	addr, err := types.HexToAddress(addrStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid address format: %w", err)
+		return nil, invalidParams("invalid address format: %v", err)
 	}
 
-	// Get contract code from blockchain state
-	code := s.node.blockchain.GetCode(addr)
+	param, err := parseBlockParam(p, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	state, _, err := s.stateAt(param)
+	if err != nil {
+		return nil, err
+	}
+	defer state.Release()
+
+	code := state.GetCode(addr)
 	if len(code) == 0 {
 		return "0x", nil
 	}
@@ -848,31 +1134,39 @@ func (s *RPCServer) ethGetStorageAt(params json.RawMessage) (interface{}, error)
 	var p []interface{}
 	err := json.Unmarshal(params, &p)
 	if err != nil || len(p) < 2 {
-		return nil, fmt.Errorf("invalid parameters")
+		return nil, invalidParams("invalid parameters")
 	}
 
 	addrStr, ok := p[0].(string)
 	if !ok {
-		return nil, fmt.Errorf("invalid address")
+		return nil, invalidParams("invalid address")
 	}
 
 	posStr, ok := p[1].(string)
 	if !ok {
-		return nil, fmt.Errorf("invalid position")
+		return nil, invalidParams("invalid position")
 	}
 
 	addr, err := types.HexToAddress(addrStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid address format: %w", err)
+		return nil, invalidParams("invalid address format: %v", err)
 	}
 
 	pos, err := types.HexToHash(posStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid position format: %w", err)
+		return nil, invalidParams("invalid position format: %v", err)
 	}
 
-	// Get storage value from blockchain state
-	value := s.node.blockchain.GetState(addr, pos)
+	param, err := parseBlockParam(p, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	state, _, err := s.stateAt(param)
+	if err != nil {
+		return nil, err
+	}
+	defer state.Release()
 
-	return value.Hex(), nil
+	return state.GetState(addr, pos).Hex(), nil
 }
@@ -0,0 +1,175 @@
+package node
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"quantum-blockchain/chain/network"
+)
+
+// PeerInfo describes a connected peer in admin_peers
+type PeerInfo struct {
+	ID        string    `json:"id"`
+	Address   string    `json:"address"`
+	Inbound   bool      `json:"inbound"`
+	Version   uint32    `json:"version"`  // Highest protocol version of the peer
+	Protocol  uint32    `json:"protocol"` // Protocol version spoken with the peer
+	NetworkID uint64    `json:"networkId"`
+	Height    uint64    `json:"height"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Score     float64   `json:"score"` // Reputation, the peer is banned at network.BanThreshold
+
+	// Discovery state of the peer
+	RecordAddress string `json:"recordAddress,omitempty"` // Address the peer advertises
+	ForkID        string `json:"forkId,omitempty"`
+	Distance      int    `json:"distance"` // Log distance to the local node ID
+	InTable       bool   `json:"inTable"`  // The peer is in the routing table
+}
+
+// EndpointInfo describes an RPC endpoint in admin_nodeInfo
+type EndpointInfo struct {
+	Name       string   `json:"name"`
+	Address    string   `json:"address"`
+	Namespaces []string `json:"namespaces"`
+}
+
+// NodeInfo describes the local node in admin_nodeInfo
+type NodeInfo struct {
+	ID          string          `json:"id"`
+	ListenAddr  string          `json:"listenAddr"`
+	NetworkID   uint64          `json:"networkId"`
+	Validator   string          `json:"validator,omitempty"`
+	Mining      bool            `json:"mining"`
+	HeadNumber  string          `json:"headNumber"`
+	HeadHash    string          `json:"headHash"`
+	GenesisHash string          `json:"genesisHash"`
+	Endpoints   []*EndpointInfo `json:"endpoints"`
+	Discovery   *DiscoveryInfo  `json:"discovery"`
+}
+
+// parsePeerParam decodes the single string parameter of the peer methods
+func parsePeerParam(params json.RawMessage) (string, error) {
+	var p []string
+	if err := json.Unmarshal(params, &p); err != nil || len(p) < 1 || p[0] == "" {
+		return "", invalidParams("expected a peer address or ID")
+	}
+	return p[0], nil
+}
+
+func (s *RPCServer) adminPeers(params json.RawMessage) (interface{}, error) {
+	peers := s.node.p2p.GetPeers()
+	infos := make([]*PeerInfo, 0, len(peers))
+	for _, peer := range peers {
+		info := &PeerInfo{
+			ID:       peer.ID,
+			Address:  peer.Address,
+			Inbound:  peer.Inbound,
+			LastSeen: peer.LastSeen,
+			Protocol: peer.Protocol,
+			Score:    s.node.p2p.PeerScorer().Score(peer.ID),
+			Distance: network.LogDistance(s.node.p2p.NodeID(), peer.ID),
+			InTable:  s.node.p2p.discovery.table.Get(peer.ID) != nil,
+		}
+		if peer.NodeInfo != nil {
+			info.Version = peer.NodeInfo.Version
+			info.NetworkID = peer.NodeInfo.NetworkID
+			info.Height = peer.NodeInfo.Height
+			if record := peer.NodeInfo.Record; record != nil {
+				info.RecordAddress = record.Address
+				info.ForkID = record.ForkID.String()
+			}
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (s *RPCServer) adminAddPeer(params json.RawMessage) (interface{}, error) {
+	address, err := parsePeerParam(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.node.p2p.AddPeer(address); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func (s *RPCServer) adminRemovePeer(params json.RawMessage) (interface{}, error) {
+	peer, err := parsePeerParam(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.node.p2p.RemovePeer(peer), nil
+}
+
+func (s *RPCServer) adminBans(params json.RawMessage) (interface{}, error) {
+	return s.node.p2p.PeerScorer().Bans(), nil
+}
+
+// adminBanPeer bans a peer given by node ID, or by the address of a connected
+// peer, for an optional duration such as "30m"
+func (s *RPCServer) adminBanPeer(params json.RawMessage) (interface{}, error) {
+	var p []string
+	if err := json.Unmarshal(params, &p); err != nil || len(p) < 1 || p[0] == "" {
+		return nil, invalidParams("expected a peer address or ID and an optional duration")
+	}
+
+	var duration time.Duration
+	if len(p) > 1 {
+		var err error
+		if duration, err = time.ParseDuration(p[1]); err != nil || duration <= 0 {
+			return nil, invalidParams("invalid ban duration %q", p[1])
+		}
+	}
+
+	peerID := p[0]
+	for _, peer := range s.node.p2p.GetPeers() {
+		if peer.Address == p[0] {
+			peerID = peer.ID
+		}
+	}
+	if id, err := hex.DecodeString(peerID); err != nil || len(id) != 32 {
+		return nil, invalidParams("unknown peer %s", p[0])
+	}
+
+	return s.node.p2p.PeerScorer().Ban(peerID, "banned by admin", duration), nil
+}
+
+func (s *RPCServer) adminUnbanPeer(params json.RawMessage) (interface{}, error) {
+	peerID, err := parsePeerParam(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.node.p2p.PeerScorer().Unban(peerID), nil
+}
+
+func (s *RPCServer) adminNodeInfo(params json.RawMessage) (interface{}, error) {
+	head := s.node.blockchain.GetCurrentBlock()
+	info := &NodeInfo{
+		ID:          s.node.p2p.NodeID(),
+		ListenAddr:  s.node.p2p.ListenAddr(),
+		NetworkID:   s.node.config.NetworkID,
+		Mining:      s.node.IsMining(),
+		HeadNumber:  fmt.Sprintf("0x%x", head.Number()),
+		HeadHash:    head.Hash().Hex(),
+		GenesisHash: s.node.blockchain.genesis.Hash().Hex(),
+		Discovery:   s.node.p2p.DiscoveryInfo(),
+	}
+	if s.node.validatorPrivKey != nil {
+		info.Validator = s.node.validatorAddr.Hex()
+	}
+	for _, ep := range s.endpoints {
+		info.Endpoints = append(info.Endpoints, &EndpointInfo{
+			Name:       ep.Name,
+			Address:    ep.Address,
+			Namespaces: ep.Namespaces,
+		})
+	}
+	return info, nil
+}
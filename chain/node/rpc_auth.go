@@ -0,0 +1,293 @@
+package node
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/types"
+)
+
+// Headers carrying a Dilithium signed request
+const (
+	HeaderAuthPublicKey = "X-Quantum-Auth-Key"
+	HeaderAuthTimestamp = "X-Quantum-Auth-Timestamp"
+	HeaderAuthNonce     = "X-Quantum-Auth-Nonce"
+	HeaderAuthSignature = "X-Quantum-Auth-Signature"
+)
+
+// authNonceLength is the length in bytes of a Dilithium request nonce
+const authNonceLength = 16
+
+// authMaxClockSkew is how far a token or signature timestamp may be from the
+// local clock. It bounds the window in which a captured request can be replayed.
+const authMaxClockSkew = 60 * time.Second
+
+// errNoCredentials is returned by an authenticator when the request does not
+// carry its kind of credentials at all
+var errNoCredentials = errors.New("no credentials provided")
+
+// RPCAuthenticator verifies the credentials of an HTTP request. The body is
+// nil for WebSocket upgrades.
+type RPCAuthenticator interface {
+	Authenticate(r *http.Request, body []byte) error
+}
+
+// JWTAuth authenticates requests carrying an HS256 JWT bearer token signed
+// with a shared secret. The only claim checked is "iat", which must be close
+// to the local time.
+type JWTAuth struct {
+	secret []byte
+}
+
+// NewJWTAuth creates a JWT authenticator for the given shared secret
+func NewJWTAuth(secret []byte) *JWTAuth {
+	return &JWTAuth{secret: secret}
+}
+
+// LoadJWTSecret reads a hex encoded 32 byte secret, generating and storing a
+// new one if the file does not exist
+func LoadJWTSecret(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		secret, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT secret in %s: %w", path, err)
+		}
+		if len(secret) != 32 {
+			return nil, fmt.Errorf("invalid JWT secret in %s: expected 32 bytes, got %d", path, len(secret))
+		}
+		return secret, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read JWT secret: %w", err)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate JWT secret: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(secret)), 0600); err != nil {
+		return nil, fmt.Errorf("failed to store JWT secret: %w", err)
+	}
+	return secret, nil
+}
+
+// NewJWTToken creates an HS256 token issued at the given time
+func NewJWTToken(secret []byte, issuedAt time.Time) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	claims := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"iat":%d}`, issuedAt.Unix())))
+	signingInput := header + "." + claims
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(hmacSHA256(secret, signingInput))
+}
+
+func hmacSHA256(secret []byte, input string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(input))
+	return mac.Sum(nil)
+}
+
+// Authenticate verifies the bearer token of the request
+func (a *JWTAuth) Authenticate(r *http.Request, body []byte) error {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return errNoCredentials
+	}
+	token, ok := strings.CutPrefix(authHeader, "Bearer ")
+	if !ok {
+		return errors.New("authorization header is not a bearer token")
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("malformed JWT")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return fmt.Errorf("invalid JWT header: %w", err)
+	}
+	if header.Alg != "HS256" {
+		return fmt.Errorf("unsupported JWT algorithm %q", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("invalid JWT signature encoding: %w", err)
+	}
+	if !hmac.Equal(signature, hmacSHA256(a.secret, parts[0]+"."+parts[1])) {
+		return errors.New("invalid JWT signature")
+	}
+
+	var claims struct {
+		IssuedAt *int64 `json:"iat"`
+	}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return fmt.Errorf("invalid JWT claims: %w", err)
+	}
+	if claims.IssuedAt == nil {
+		return errors.New("JWT is missing the iat claim")
+	}
+	return checkAuthTimestamp(*claims.IssuedAt)
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// checkAuthTimestamp rejects timestamps outside the allowed clock skew
+func checkAuthTimestamp(unix int64) error {
+	skew := time.Since(time.Unix(unix, 0))
+	if skew > authMaxClockSkew || skew < -authMaxClockSkew {
+		return fmt.Errorf("credentials issued %s from local time, maximum is %s", skew.Round(time.Second), authMaxClockSkew)
+	}
+	return nil
+}
+
+// DilithiumAuth authenticates requests signed by one of a set of authorized
+// Dilithium keys. The signature covers the method, path, timestamp, a random
+// nonce and the body, and every nonce is accepted once while its timestamp is
+// within the allowed clock skew.
+type DilithiumAuth struct {
+	keys map[string]bool // Hex encoded authorized public keys
+
+	mu     sync.Mutex
+	nonces map[string]time.Time // Seen nonces by key and nonce, with their expiry
+}
+
+// NewDilithiumAuth creates an authenticator accepting the given public keys
+func NewDilithiumAuth(publicKeys ...[]byte) *DilithiumAuth {
+	auth := &DilithiumAuth{
+		keys:   make(map[string]bool),
+		nonces: make(map[string]time.Time),
+	}
+	for _, key := range publicKeys {
+		auth.keys[hex.EncodeToString(key)] = true
+	}
+	return auth
+}
+
+// dilithiumAuthMessage is the message signed for a request. Method, path,
+// timestamp and nonce can not contain newlines, so the encoding is unambiguous.
+func dilithiumAuthMessage(method, path, timestamp, nonce string, body []byte) []byte {
+	header := strings.Join([]string{method, path, timestamp, nonce}, "\n") + "\n"
+	return types.Keccak256(append([]byte(header), body...))
+}
+
+// authRequestPath returns the path a request is signed for. Clients may send
+// an empty path, which servers receive as the root.
+func authRequestPath(r *http.Request) string {
+	if r.URL.Path == "" {
+		return "/"
+	}
+	return r.URL.Path
+}
+
+// SignRequest adds Dilithium authentication headers for body to the request
+func SignRequest(r *http.Request, body []byte, privKey *crypto.DilithiumPrivateKey) error {
+	nonceBytes := make([]byte, authNonceLength)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return fmt.Errorf("failed to generate request nonce: %w", err)
+	}
+	nonce := hex.EncodeToString(nonceBytes)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	signature, err := privKey.Sign(dilithiumAuthMessage(r.Method, authRequestPath(r), timestamp, nonce, body))
+	if err != nil {
+		return fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	r.Header.Set(HeaderAuthPublicKey, hex.EncodeToString(privKey.Public().Bytes()))
+	r.Header.Set(HeaderAuthTimestamp, timestamp)
+	r.Header.Set(HeaderAuthNonce, nonce)
+	r.Header.Set(HeaderAuthSignature, hex.EncodeToString(signature))
+	return nil
+}
+
+// Authenticate verifies the Dilithium signature headers of the request
+func (a *DilithiumAuth) Authenticate(r *http.Request, body []byte) error {
+	keyHex := r.Header.Get(HeaderAuthPublicKey)
+	if keyHex == "" {
+		return errNoCredentials
+	}
+	keyHex = strings.ToLower(keyHex)
+	if !a.keys[keyHex] {
+		return errors.New("public key is not authorized")
+	}
+
+	timestamp := r.Header.Get(HeaderAuthTimestamp)
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid auth timestamp: %w", err)
+	}
+	if err := checkAuthTimestamp(unix); err != nil {
+		return err
+	}
+
+	nonce := strings.ToLower(r.Header.Get(HeaderAuthNonce))
+	if nonceBytes, err := hex.DecodeString(nonce); err != nil || len(nonceBytes) != authNonceLength {
+		return fmt.Errorf("auth nonce must be %d hex encoded bytes", authNonceLength)
+	}
+
+	publicKey, _ := hex.DecodeString(keyHex)
+	signature, err := hex.DecodeString(r.Header.Get(HeaderAuthSignature))
+	if err != nil {
+		return fmt.Errorf("invalid auth signature encoding: %w", err)
+	}
+	if !crypto.VerifyDilithium(dilithiumAuthMessage(r.Method, authRequestPath(r), timestamp, nonce, body), signature, publicKey) {
+		return errors.New("invalid request signature")
+	}
+
+	// The nonce only needs to be remembered until its timestamp is rejected anyway
+	return a.useNonce(keyHex+":"+nonce, time.Unix(unix, 0).Add(authMaxClockSkew))
+}
+
+// useNonce records a nonce, failing if it was already seen and has not expired
+func (a *DilithiumAuth) useNonce(nonce string, expiry time.Time) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	for seen, seenExpiry := range a.nonces {
+		if now.After(seenExpiry) {
+			delete(a.nonces, seen)
+		}
+	}
+
+	if _, seen := a.nonces[nonce]; seen {
+		return errors.New("request nonce has already been used")
+	}
+	a.nonces[nonce] = expiry
+	return nil
+}
+
+// MultiAuth accepts a request if any of its authenticators does
+type MultiAuth []RPCAuthenticator
+
+// Authenticate tries every authenticator whose credentials are present
+func (m MultiAuth) Authenticate(r *http.Request, body []byte) error {
+	for _, auth := range m {
+		if err := auth.Authenticate(r, body); err != errNoCredentials {
+			return err
+		}
+	}
+	return errNoCredentials
+}
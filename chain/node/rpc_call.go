@@ -0,0 +1,326 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/evm"
+	"quantum-blockchain/chain/types"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// CallArgs are the transaction fields accepted by eth_call and eth_estimateGas
+type CallArgs struct {
+	From     *common.Address `json:"from"`
+	To       *common.Address `json:"to"`
+	Gas      *hexutil.Uint64 `json:"gas"`
+	GasPrice *hexutil.Big    `json:"gasPrice"`
+	Value    *hexutil.Big    `json:"value"`
+	Nonce    *hexutil.Uint64 `json:"nonce"`
+	Data     *hexutil.Bytes  `json:"data"`
+	Input    *hexutil.Bytes  `json:"input"`
+	SigAlg   *uint8          `json:"sigAlg"` // Algorithm the transaction will be signed with
+
+	MaxFeePerGas         *hexutil.Big `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big `json:"maxPriorityFeePerGas"`
+
+	// Calls of a batch transaction, executed instead of To and Data
+	Calls     []*types.BatchCall `json:"calls"`
+	BatchMode *hexutil.Uint64    `json:"batchMode"`
+}
+
+// toMessage converts the call arguments into a message executed on state
+func (args *CallArgs) toMessage(state evm.StateInterface, gasCap uint64) *evm.Message {
+	msg := &evm.Message{
+		Gas:      gasCap,
+		GasPrice: new(big.Int),
+		Value:    new(big.Int),
+	}
+
+	if args.From != nil {
+		msg.From = types.BytesToAddress(args.From.Bytes())
+	}
+	if args.To != nil {
+		to := types.BytesToAddress(args.To.Bytes())
+		msg.To = &to
+	}
+	if args.Gas != nil && uint64(*args.Gas) < gasCap {
+		msg.Gas = uint64(*args.Gas)
+	}
+	// Calls without any price are executed without charging the base fee
+	switch {
+	case args.GasPrice != nil:
+		msg.GasPrice = args.GasPrice.ToInt()
+	case args.MaxFeePerGas != nil || args.MaxPriorityFeePerGas != nil:
+		msg.GasFeeCap, msg.GasTipCap = new(big.Int), new(big.Int)
+		if args.MaxFeePerGas != nil {
+			msg.GasFeeCap = args.MaxFeePerGas.ToInt()
+		}
+		if args.MaxPriorityFeePerGas != nil {
+			msg.GasTipCap = args.MaxPriorityFeePerGas.ToInt()
+		}
+		msg.GasPrice = msg.GasFeeCap
+	default:
+		msg.NoBaseFee = true
+	}
+	if args.Value != nil {
+		msg.Value = args.Value.ToInt()
+	}
+	if args.Nonce != nil {
+		msg.Nonce = uint64(*args.Nonce)
+	} else {
+		msg.Nonce = state.GetNonce(msg.From)
+	}
+	if args.Input != nil {
+		msg.Data = *args.Input
+	} else if args.Data != nil {
+		msg.Data = *args.Data
+	}
+
+	if args.Calls != nil {
+		msg.Calls = args.Calls
+		if args.BatchMode != nil {
+			msg.BatchMode = types.BatchMode(*args.BatchMode)
+		}
+		msg.Value = new(big.Int)
+		for _, call := range args.Calls {
+			msg.Value.Add(msg.Value, call.Value)
+		}
+	}
+
+	// Price the post-quantum signature the transaction will carry
+	msg.SigAlg = crypto.SigAlgDilithium
+	if args.SigAlg != nil {
+		msg.SigAlg = crypto.SignatureAlgorithm(*args.SigAlg)
+	}
+	msg.SignatureSize, msg.PublicKeySize = evm.SignatureSizes(msg.SigAlg)
+
+	return msg
+}
+
+// OverrideAccount replaces parts of an account's state for a single call
+type OverrideAccount struct {
+	Nonce     *hexutil.Uint64             `json:"nonce"`
+	Code      *hexutil.Bytes              `json:"code"`
+	Balance   *hexutil.Big                `json:"balance"`
+	State     map[common.Hash]common.Hash `json:"state"`
+	StateDiff map[common.Hash]common.Hash `json:"stateDiff"`
+}
+
+// StateOverride is the set of account overrides applied before a call
+type StateOverride map[common.Address]OverrideAccount
+
+// Apply writes the overrides into the state overlay
+func (diff StateOverride) Apply(state *StateOverlay) error {
+	for address, account := range diff {
+		addr := types.BytesToAddress(address.Bytes())
+
+		if account.State != nil && account.StateDiff != nil {
+			return invalidParams("account %s has both 'state' and 'stateDiff'", address.Hex())
+		}
+
+		if account.Nonce != nil {
+			state.SetNonce(addr, uint64(*account.Nonce))
+		}
+		if account.Code != nil {
+			state.SetCode(addr, *account.Code)
+		}
+		if account.Balance != nil {
+			state.SetBalance(addr, account.Balance.ToInt())
+		}
+		if account.State != nil {
+			state.ClearStorage(addr)
+			for key, value := range account.State {
+				state.SetState(addr, types.BytesToHash(key.Bytes()), types.BytesToHash(value.Bytes()))
+			}
+		}
+		for key, value := range account.StateDiff {
+			state.SetState(addr, types.BytesToHash(key.Bytes()), types.BytesToHash(value.Bytes()))
+		}
+	}
+	return nil
+}
+
+// applyPendingTransactions executes pool transactions on top of the head state
+// and returns the pending block they were executed in
+func (s *RPCServer) applyPendingTransactions(state *StateOverlay, head *types.Block) *types.Block {
+	header := types.NewBlockHeader(head.Hash(), s.node.validatorAddr, types.ZeroHash,
+		new(big.Int).Add(head.Number(), big.NewInt(1)), types.DefaultBlockGasLimit, head.Time()+1)
+	header.BaseFee = types.CalcBaseFee(head.Header)
+	block := types.NewBlock(header, nil, nil)
+
+	if s.node.txPool == nil {
+		return block
+	}
+
+	executor := evm.NewSimpleEVM(state, big.NewInt(8888))
+	for _, tx := range s.node.txPool.GetPendingTransactions(500) {
+		// Skip transactions that cannot be applied in order
+		if tx.GetNonce() != state.GetNonce(tx.From()) {
+			continue
+		}
+		if evm.CheckSigningKeys(tx, evm.KeyBindings(state)) != nil {
+			continue
+		}
+		if _, err := s.node.blockchain.applyMessage(state, executor, evm.TransactionToMessage(tx), block); err != nil {
+			continue
+		}
+		block.Transactions = append(block.Transactions, tx)
+	}
+
+	return block
+}
+
+// parseCallParams decodes [callArgs, block, stateOverride] parameters
+func parseCallParams(params json.RawMessage) (*CallArgs, BlockParam, StateOverride, error) {
+	var p []json.RawMessage
+	if err := json.Unmarshal(params, &p); err != nil || len(p) < 1 {
+		return nil, BlockParam{}, nil, invalidParams("invalid parameters")
+	}
+
+	var args CallArgs
+	if err := json.Unmarshal(p[0], &args); err != nil {
+		return nil, BlockParam{}, nil, invalidParams("invalid transaction object: %v", err)
+	}
+	if args.Calls != nil {
+		batch := &types.QuantumTransaction{Type: types.TxTypeBatch, Calls: args.Calls}
+		if args.BatchMode != nil {
+			batch.BatchMode = types.BatchMode(*args.BatchMode)
+		}
+		if err := batch.ValidateBatch(); err != nil {
+			return nil, BlockParam{}, nil, invalidParams("invalid batch: %v", err)
+		}
+	}
+
+	block := LatestBlock
+	if len(p) > 1 && string(p[1]) != "null" {
+		if err := json.Unmarshal(p[1], &block); err != nil {
+			return nil, BlockParam{}, nil, err
+		}
+	}
+
+	var overrides StateOverride
+	if len(p) > 2 && string(p[2]) != "null" {
+		if err := json.Unmarshal(p[2], &overrides); err != nil {
+			return nil, BlockParam{}, nil, invalidParams("invalid state override: %v", err)
+		}
+	}
+
+	return &args, block, overrides, nil
+}
+
+// executionError converts a failed execution into the error returned to callers
+func executionError(result *messageResult) error {
+	if errors.Is(result.Err, evm.ErrExecutionReverted) {
+		reason, _ := evm.DecodeRevertReason(result.ReturnData)
+		return &RevertError{Reason: reason, Data: result.ReturnData}
+	}
+	return result.Err
+}
+
+// doCall executes a message on a state overlay and returns the outcome
+func (s *RPCServer) doCall(state *StateOverlay, block *types.Block, msg *evm.Message) (*messageResult, error) {
+	executor := evm.NewSimpleEVM(state, big.NewInt(8888))
+	return s.node.blockchain.applyMessage(state, executor, msg, block)
+}
+
+func (s *RPCServer) ethCall(params json.RawMessage) (interface{}, error) {
+	args, param, overrides, err := parseCallParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	state, block, err := s.stateAt(param)
+	if err != nil {
+		return nil, err
+	}
+	defer state.Release()
+
+	if err := overrides.Apply(state); err != nil {
+		return nil, err
+	}
+
+	result, err := s.doCall(state, block, args.toMessage(state, types.DefaultBlockGasLimit))
+	if err != nil {
+		return nil, err
+	}
+	if result.Err != nil {
+		return nil, executionError(result)
+	}
+
+	return fmt.Sprintf("0x%x", result.ReturnData), nil
+}
+
+func (s *RPCServer) ethEstimateGas(params json.RawMessage) (interface{}, error) {
+	args, param, overrides, err := parseCallParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	state, block, err := s.stateAt(param)
+	if err != nil {
+		return nil, err
+	}
+	defer state.Release()
+
+	if err := overrides.Apply(state); err != nil {
+		return nil, err
+	}
+
+	msg := args.toMessage(state, types.DefaultBlockGasLimit)
+
+	// The sender can not pay for more gas than its balance allows
+	if msg.GasPrice.Sign() > 0 {
+		available := new(big.Int).Sub(state.GetBalance(msg.From), msg.Value)
+		if available.Sign() <= 0 {
+			return nil, fmt.Errorf("insufficient funds for transfer")
+		}
+		allowance := new(big.Int).Div(available, msg.GasPrice)
+		if allowance.IsUint64() && allowance.Uint64() < msg.Gas {
+			msg.Gas = allowance.Uint64()
+		}
+	}
+
+	// execute runs the message with the given gas on a fresh copy of the state
+	execute := func(gas uint64) (*messageResult, error) {
+		trial := *msg
+		trial.Gas = gas
+		return s.doCall(state.Copy(), block, &trial)
+	}
+
+	// The message must succeed with the maximum gas, otherwise report why
+	hi := msg.Gas
+	result, err := execute(hi)
+	if err != nil {
+		return nil, err
+	}
+	if result.Err != nil {
+		return nil, executionError(result)
+	}
+
+	// Execution usually needs exactly the gas it used, try that first
+	lo := result.GasUsed - 1
+	if result.GasUsed < hi {
+		if optimistic, err := execute(result.GasUsed); err == nil && optimistic.Err == nil {
+			hi = result.GasUsed
+		}
+	}
+
+	// Binary search the lowest gas limit that still succeeds
+	for lo+1 < hi {
+		mid := lo + (hi-lo)/2
+		result, err := execute(mid)
+		if err != nil || result.Err != nil {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+
+	return hexutil.Uint64(hi), nil
+}
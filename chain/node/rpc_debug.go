@@ -0,0 +1,100 @@
+package node
+
+import (
+	"encoding/json"
+
+	"quantum-blockchain/chain/types"
+)
+
+// TraceConfig selects the tracer used by the debug_trace* methods
+type TraceConfig struct {
+	Tracer string `json:"tracer"`
+}
+
+// parseTraceParams decodes [target, {tracer}] style parameters
+func parseTraceParams(params json.RawMessage) (string, *TraceConfig, error) {
+	var p []json.RawMessage
+	if err := json.Unmarshal(params, &p); err != nil || len(p) < 1 {
+		return "", nil, invalidParams("invalid parameters")
+	}
+
+	var target string
+	if err := json.Unmarshal(p[0], &target); err != nil {
+		return "", nil, invalidParams("invalid trace target: %v", err)
+	}
+
+	config := &TraceConfig{}
+	if len(p) > 1 && string(p[1]) != "null" {
+		if err := json.Unmarshal(p[1], config); err != nil {
+			return "", nil, invalidParams("invalid trace config: %v", err)
+		}
+	}
+
+	return target, config, nil
+}
+
+func (s *RPCServer) debugTraceTransaction(params json.RawMessage) (interface{}, error) {
+	hashStr, config, err := parseTraceParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := types.HexToHash(hashStr)
+	if err != nil {
+		return nil, invalidParams("invalid hash format: %v", err)
+	}
+
+	return s.node.blockchain.TraceTransaction(hash, config.Tracer)
+}
+
+func (s *RPCServer) debugTraceBlockByNumber(params json.RawMessage) (interface{}, error) {
+	blockNumStr, config, err := parseTraceParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	param, err := parseBlockParam([]interface{}{blockNumStr}, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := s.resolveBlock(param)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.node.blockchain.TraceBlock(block, config.Tracer)
+}
+
+func (s *RPCServer) debugTraceBlockByHash(params json.RawMessage) (interface{}, error) {
+	hashStr, config, err := parseTraceParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := types.HexToHash(hashStr)
+	if err != nil {
+		return nil, invalidParams("invalid hash format: %v", err)
+	}
+
+	block, err := s.node.blockchain.GetBlockByHash(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.node.blockchain.TraceBlock(block, config.Tracer)
+}
+
+// debugTraceBlock accepts either a block hash or a block number
+func (s *RPCServer) debugTraceBlock(params json.RawMessage) (interface{}, error) {
+	target, _, err := parseTraceParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// A 32 byte hash is 66 characters including the 0x prefix
+	if len(target) == 66 {
+		return s.debugTraceBlockByHash(params)
+	}
+	return s.debugTraceBlockByNumber(params)
+}
@@ -0,0 +1,116 @@
+package node
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// PublicNamespaces are the method namespaces safe to expose to anyone
+var PublicNamespaces = []string{"eth", "net", "quantum"}
+
+// AdminNamespaces are every namespace, exposed on local admin endpoints
+var AdminNamespaces = []string{"eth", "net", "quantum", "admin", "miner", "debug"}
+
+// privilegedNamespaces control the node or are expensive to serve. Calls to
+// them need authentication unless they arrive over a unix socket.
+var privilegedNamespaces = map[string]bool{
+	"admin": true,
+	"miner": true,
+	"debug": true,
+}
+
+// RPCEndpoint is a listener of the RPC server and the namespaces it serves
+type RPCEndpoint struct {
+	Name       string           // Used in logs
+	Network    string           // "tcp" or "unix"
+	Address    string           // host:port or socket path
+	Namespaces []string         // Method namespaces served, e.g. "eth" or "admin"
+	Auth       RPCAuthenticator // Authenticates privileged calls on TCP endpoints
+}
+
+// hasPrivileged reports whether the endpoint serves any privileged namespace
+func (ep *RPCEndpoint) hasPrivileged() bool {
+	for _, ns := range ep.Namespaces {
+		if privilegedNamespaces[ns] {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks that privileged namespaces are only reachable locally and
+// with authentication
+func (ep *RPCEndpoint) validate() error {
+	switch ep.Network {
+	case "unix":
+		return nil
+	case "tcp":
+	default:
+		return fmt.Errorf("endpoint %s: unsupported network %q", ep.Name, ep.Network)
+	}
+
+	if !ep.hasPrivileged() {
+		return nil
+	}
+	if ep.Auth == nil {
+		return fmt.Errorf("endpoint %s: privileged namespaces over TCP require authentication", ep.Name)
+	}
+
+	host, _, err := net.SplitHostPort(ep.Address)
+	if err != nil {
+		return fmt.Errorf("endpoint %s: invalid address: %w", ep.Name, err)
+	}
+	if host != "localhost" {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			return fmt.Errorf("endpoint %s: privileged namespaces must listen on a loopback address, not %q", ep.Name, host)
+		}
+	}
+	return nil
+}
+
+// rpcScope is what the sender of a message may call on an endpoint
+type rpcScope struct {
+	namespaces    map[string]bool
+	authenticated bool
+	authErr       error // Why authentication failed, reported on privileged calls
+}
+
+// newRPCScope creates the scope of an endpoint. authErr is the outcome of
+// authenticating the request and is ignored on unix sockets, whose file
+// permissions already restrict access.
+func newRPCScope(ep *RPCEndpoint, authErr error) *rpcScope {
+	scope := &rpcScope{
+		namespaces: make(map[string]bool, len(ep.Namespaces)),
+	}
+	for _, ns := range ep.Namespaces {
+		scope.namespaces[ns] = true
+	}
+
+	switch {
+	case ep.Network == "unix":
+		scope.authenticated = true
+	case ep.Auth == nil:
+		scope.authErr = fmt.Errorf("endpoint has no authentication configured")
+	default:
+		scope.authenticated = authErr == nil
+		scope.authErr = authErr
+	}
+	return scope
+}
+
+// exposes reports whether the method's namespace is served
+func (sc *rpcScope) exposes(method string) bool {
+	ns, _, _ := strings.Cut(method, "_")
+	return sc.namespaces[ns]
+}
+
+// authorize returns an error if the method is privileged and the sender is
+// not authenticated
+func (sc *rpcScope) authorize(method string) error {
+	ns, _, _ := strings.Cut(method, "_")
+	if privilegedNamespaces[ns] && !sc.authenticated {
+		return &UnauthorizedError{Method: method, Reason: sc.authErr.Error()}
+	}
+	return nil
+}
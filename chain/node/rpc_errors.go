@@ -0,0 +1,100 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Standard JSON-RPC 2.0 error codes plus the server-defined range used by
+// Ethereum clients (ethers.js and web3.py switch on these values)
+const (
+	ErrCodeParse           = -32700 // Invalid JSON was received
+	ErrCodeInvalidRequest  = -32600 // The JSON sent is not a valid request object
+	ErrCodeMethodNotFound  = -32601 // The method does not exist or is not available
+	ErrCodeInvalidParams   = -32602 // Invalid method parameters
+	ErrCodeInternal        = -32603 // Internal JSON-RPC error
+	ErrCodeServer          = -32000 // Generic server error, also used for execution reverted
+	ErrCodeUnauthorized    = -32001 // Privileged method called without valid authentication
+	ErrCodeLimitExceeded   = -32005 // Rate limit or batch size exceeded
+	ErrCodeRequestTooLarge = -32006 // Request body exceeds the size limit
+)
+
+// rpcErrorCoder is implemented by errors that map to a specific JSON-RPC code
+type rpcErrorCoder interface {
+	ErrorCode() int
+}
+
+// rpcErrorDataProvider is implemented by errors that carry extra error data
+type rpcErrorDataProvider interface {
+	ErrorData() interface{}
+}
+
+// InvalidParamsError is returned when a method receives malformed parameters
+type InvalidParamsError struct {
+	Message string
+}
+
+func (e *InvalidParamsError) Error() string { return e.Message }
+
+// ErrorCode returns the JSON-RPC error code
+func (e *InvalidParamsError) ErrorCode() int { return ErrCodeInvalidParams }
+
+// invalidParams creates an InvalidParamsError with a formatted message
+func invalidParams(format string, args ...interface{}) error {
+	return &InvalidParamsError{Message: fmt.Sprintf(format, args...)}
+}
+
+// RevertError is returned when a call or transaction reverts during execution
+type RevertError struct {
+	Reason string
+	Data   []byte // Raw revert data returned by the contract
+}
+
+func (e *RevertError) Error() string {
+	if e.Reason == "" {
+		return "execution reverted"
+	}
+	return "execution reverted: " + e.Reason
+}
+
+// ErrorCode returns the JSON-RPC error code
+func (e *RevertError) ErrorCode() int { return ErrCodeServer }
+
+// ErrorData returns the hex encoded revert data
+func (e *RevertError) ErrorData() interface{} {
+	if len(e.Data) == 0 {
+		return nil
+	}
+	return fmt.Sprintf("0x%x", e.Data)
+}
+
+// UnauthorizedError is returned when a privileged method is called without
+// valid credentials
+type UnauthorizedError struct {
+	Method string
+	Reason string
+}
+
+func (e *UnauthorizedError) Error() string {
+	return fmt.Sprintf("unauthorized: %s requires authentication (%s)", e.Method, e.Reason)
+}
+
+// ErrorCode returns the JSON-RPC error code
+func (e *UnauthorizedError) ErrorCode() int { return ErrCodeUnauthorized }
+
+// toRPCError converts a method handler error into a JSON-RPC error object
+func toRPCError(err error) *RPCError {
+	rpcErr := &RPCError{Code: ErrCodeServer, Message: err.Error()}
+
+	var coder rpcErrorCoder
+	if errors.As(err, &coder) {
+		rpcErr.Code = coder.ErrorCode()
+	}
+
+	var dataProvider rpcErrorDataProvider
+	if errors.As(err, &dataProvider) {
+		rpcErr.Data = dataProvider.ErrorData()
+	}
+
+	return rpcErr
+}
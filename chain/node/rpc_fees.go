@@ -0,0 +1,219 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"quantum-blockchain/chain/types"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	// maxFeeHistory is the maximum number of blocks eth_feeHistory returns
+	maxFeeHistory = 1024
+
+	// tipSampleBlocks is the number of recent blocks the tip suggestion samples
+	tipSampleBlocks = 20
+
+	// tipPercentile is the percentile of recent tips suggested to clients
+	tipPercentile = 60
+)
+
+// FeeHistory is the result of eth_feeHistory
+type FeeHistory struct {
+	OldestBlock  *hexutil.Big     `json:"oldestBlock"`
+	BaseFee      []*hexutil.Big   `json:"baseFeePerGas"`
+	GasUsedRatio []float64        `json:"gasUsedRatio"`
+	Reward       [][]*hexutil.Big `json:"reward,omitempty"`
+}
+
+// txTip is the tip paid by a transaction and the gas it was paid for
+type txTip struct {
+	tip     *big.Int
+	gasUsed uint64
+}
+
+// blockBaseFee returns the base fee of a block, zero for blocks before base fees
+func blockBaseFee(block *types.Block) *big.Int {
+	if block.BaseFee() == nil {
+		return new(big.Int)
+	}
+	return block.BaseFee()
+}
+
+// blockTips returns the tips paid in a block sorted ascending
+func (s *RPCServer) blockTips(block *types.Block) ([]txTip, error) {
+	if len(block.Transactions) == 0 {
+		return nil, nil
+	}
+
+	tips := make([]txTip, 0, len(block.Transactions))
+	for _, tx := range block.Transactions {
+		tip, err := tx.EffectiveGasTip(block.BaseFee())
+		if err != nil {
+			continue
+		}
+		receipt, err := s.node.blockchain.GetTransactionReceipt(tx.Hash())
+		if err != nil {
+			return nil, fmt.Errorf("failed to load receipt of %s: %w", tx.Hash().Hex(), err)
+		}
+		tips = append(tips, txTip{tip: tip, gasUsed: receipt.GasUsed})
+	}
+	sort.Slice(tips, func(i, j int) bool { return tips[i].tip.Cmp(tips[j].tip) < 0 })
+	return tips, nil
+}
+
+// tipPercentiles returns the tips at the given percentiles of gas used
+func tipPercentiles(tips []txTip, percentiles []float64) []*hexutil.Big {
+	rewards := make([]*hexutil.Big, len(percentiles))
+	if len(tips) == 0 {
+		for i := range rewards {
+			rewards[i] = (*hexutil.Big)(new(big.Int))
+		}
+		return rewards
+	}
+
+	var total uint64
+	for _, t := range tips {
+		total += t.gasUsed
+	}
+
+	idx := 0
+	sum := tips[0].gasUsed
+	for i, p := range percentiles {
+		threshold := uint64(float64(total) * p / 100)
+		for sum < threshold && idx < len(tips)-1 {
+			idx++
+			sum += tips[idx].gasUsed
+		}
+		rewards[i] = (*hexutil.Big)(new(big.Int).Set(tips[idx].tip))
+	}
+	return rewards
+}
+
+// parseFeeHistoryParams decodes the block count, newest block and reward percentiles
+func parseFeeHistoryParams(params json.RawMessage) (uint64, BlockParam, []float64, error) {
+	var p []json.RawMessage
+	if err := json.Unmarshal(params, &p); err != nil || len(p) < 2 {
+		return 0, BlockParam{}, nil, invalidParams("expected block count, newest block and optional reward percentiles")
+	}
+
+	var count uint64
+	var countHex hexutil.Uint64
+	if err := json.Unmarshal(p[0], &countHex); err == nil {
+		count = uint64(countHex)
+	} else if err := json.Unmarshal(p[0], &count); err != nil {
+		return 0, BlockParam{}, nil, invalidParams("invalid block count")
+	}
+
+	var newest BlockParam
+	if err := json.Unmarshal(p[1], &newest); err != nil {
+		return 0, BlockParam{}, nil, invalidParams("invalid block parameter: %v", err)
+	}
+
+	var percentiles []float64
+	if len(p) > 2 && string(p[2]) != "null" {
+		if err := json.Unmarshal(p[2], &percentiles); err != nil {
+			return 0, BlockParam{}, nil, invalidParams("invalid reward percentiles")
+		}
+		for i, pct := range percentiles {
+			if pct < 0 || pct > 100 {
+				return 0, BlockParam{}, nil, invalidParams("reward percentile %v out of range", pct)
+			}
+			if i > 0 && pct < percentiles[i-1] {
+				return 0, BlockParam{}, nil, invalidParams("reward percentiles must be increasing")
+			}
+		}
+	}
+	return count, newest, percentiles, nil
+}
+
+func (s *RPCServer) ethFeeHistory(params json.RawMessage) (interface{}, error) {
+	count, newestParam, percentiles, err := parseFeeHistoryParams(params)
+	if err != nil {
+		return nil, err
+	}
+	if count > maxFeeHistory {
+		count = maxFeeHistory
+	}
+
+	newest, err := s.resolveBlock(newestParam)
+	if err != nil {
+		return nil, err
+	}
+	if count > newest.Number().Uint64()+1 {
+		count = newest.Number().Uint64() + 1
+	}
+
+	oldest := newest.Number().Uint64() + 1 - count
+	history := &FeeHistory{
+		OldestBlock:  (*hexutil.Big)(new(big.Int).SetUint64(oldest)),
+		BaseFee:      make([]*hexutil.Big, 0, count+1),
+		GasUsedRatio: make([]float64, 0, count),
+	}
+	if count == 0 {
+		return history, nil
+	}
+
+	for number := oldest; number <= newest.Number().Uint64(); number++ {
+		block, err := s.node.blockchain.GetBlockByNumber(new(big.Int).SetUint64(number))
+		if err != nil {
+			return nil, err
+		}
+
+		history.BaseFee = append(history.BaseFee, (*hexutil.Big)(blockBaseFee(block)))
+		ratio := 0.0
+		if block.Header.GasLimit > 0 {
+			ratio = float64(block.Header.GasUsed) / float64(block.Header.GasLimit)
+		}
+		history.GasUsedRatio = append(history.GasUsedRatio, ratio)
+
+		if percentiles != nil {
+			tips, err := s.blockTips(block)
+			if err != nil {
+				return nil, err
+			}
+			history.Reward = append(history.Reward, tipPercentiles(tips, percentiles))
+		}
+	}
+
+	// The base fee of the block after the newest is already known
+	history.BaseFee = append(history.BaseFee, (*hexutil.Big)(types.CalcBaseFee(newest.Header)))
+	return history, nil
+}
+
+// suggestGasTipCap returns the tip at tipPercentile of the transactions in
+// recent blocks, or the minimum gas price if they contain none
+func (s *RPCServer) suggestGasTipCap() (*big.Int, error) {
+	head := s.node.blockchain.GetCurrentBlock()
+
+	var tips []*big.Int
+	for i := uint64(0); i < tipSampleBlocks && i <= head.Number().Uint64(); i++ {
+		block, err := s.node.blockchain.GetBlockByNumber(new(big.Int).SetUint64(head.Number().Uint64() - i))
+		if err != nil {
+			return nil, err
+		}
+		for _, tx := range block.Transactions {
+			if tip, err := tx.EffectiveGasTip(block.BaseFee()); err == nil {
+				tips = append(tips, tip)
+			}
+		}
+	}
+
+	if len(tips) == 0 {
+		return big.NewInt(types.MinGasPrice), nil
+	}
+	sort.Slice(tips, func(i, j int) bool { return tips[i].Cmp(tips[j]) < 0 })
+	return tips[(len(tips)-1)*tipPercentile/100], nil
+}
+
+func (s *RPCServer) ethMaxPriorityFeePerGas(params json.RawMessage) (interface{}, error) {
+	tip, err := s.suggestGasTipCap()
+	if err != nil {
+		return nil, err
+	}
+	return (*hexutil.Big)(tip), nil
+}
@@ -0,0 +1,72 @@
+package node
+
+import (
+	"encoding/json"
+
+	"quantum-blockchain/chain/evm"
+	"quantum-blockchain/chain/types"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// KeyBindingResult is a key bound to an account as returned over RPC
+type KeyBindingResult struct {
+	SigAlg      uint8          `json:"sigAlg"`
+	Algorithm   string         `json:"algorithm"`
+	PublicKey   hexutil.Bytes  `json:"publicKey"`
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+}
+
+// KeyHistoryResult is the rotation history of an account
+type KeyHistoryResult struct {
+	Address string              `json:"address"`
+	Current *KeyBindingResult   `json:"current"` // Nil while the key still derives the address
+	History []*KeyBindingResult `json:"history"` // Oldest first
+}
+
+func newKeyBindingResult(binding *evm.KeyBinding) *KeyBindingResult {
+	return &KeyBindingResult{
+		SigAlg:      uint8(binding.Algorithm),
+		Algorithm:   binding.Algorithm.String(),
+		PublicKey:   binding.PublicKey,
+		BlockNumber: hexutil.Uint64(binding.BlockNumber),
+	}
+}
+
+// quantumGetKeyHistory returns the keys bound to an account by key rotations
+// at a block, parameters are [address, block]
+func (s *RPCServer) quantumGetKeyHistory(params json.RawMessage) (interface{}, error) {
+	var p []interface{}
+	if err := json.Unmarshal(params, &p); err != nil || len(p) < 1 {
+		return nil, invalidParams("invalid parameters")
+	}
+
+	addrStr, ok := p[0].(string)
+	if !ok {
+		return nil, invalidParams("invalid address")
+	}
+	addr, err := types.HexToAddress(addrStr)
+	if err != nil {
+		return nil, invalidParams("invalid address format: %v", err)
+	}
+
+	param, err := parseBlockParam(p, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	state, _, err := s.stateAt(param)
+	if err != nil {
+		return nil, err
+	}
+	defer state.Release()
+
+	result := &KeyHistoryResult{Address: addr.Hex(), History: []*KeyBindingResult{}}
+	for _, binding := range evm.KeyHistory(state, addr) {
+		result.History = append(result.History, newKeyBindingResult(binding))
+	}
+	if len(result.History) > 0 {
+		result.Current = result.History[len(result.History)-1]
+	}
+	return result, nil
+}
@@ -0,0 +1,85 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"quantum-blockchain/chain/types"
+)
+
+// LightBlockResult is a header with the commit votes for it, which light
+// clients verify against the validator set of its epoch
+type LightBlockResult struct {
+	Header *types.BlockHeader `json:"header"`
+	Hash   string             `json:"hash"`
+	Commit []*types.CommitSig `json:"commit"` // Empty until the next block includes the votes
+}
+
+// quantumGetLightBlock returns the header of a block and the commit votes the
+// next block includes for it, parameters are [block] and default to latest
+func (s *RPCServer) quantumGetLightBlock(params json.RawMessage) (interface{}, error) {
+	var p []interface{}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, invalidParams("invalid parameters")
+		}
+	}
+	param, err := parseBlockParam(p, 0)
+	if err != nil {
+		return nil, err
+	}
+	if param.IsPending() {
+		return nil, invalidParams("pending block has no header")
+	}
+	block, err := s.resolveBlock(param)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &LightBlockResult{
+		Header: block.Header,
+		Hash:   block.Hash().Hex(),
+		Commit: []*types.CommitSig{},
+	}
+	next, err := s.node.blockchain.GetBlockByNumber(new(big.Int).Add(block.Number(), big.NewInt(1)))
+	if err == nil && next.ParentHash() == block.Hash() && next.LastCommit != nil {
+		result.Commit = next.LastCommit
+	}
+	return result, nil
+}
+
+// quantumGetAccountProof proves the state of an account against the state
+// root of a block, which commits to the state its parent left. Parameters are
+// [address, block] and default to the latest block.
+func (s *RPCServer) quantumGetAccountProof(params json.RawMessage) (interface{}, error) {
+	var p []interface{}
+	if err := json.Unmarshal(params, &p); err != nil || len(p) < 1 {
+		return nil, invalidParams("invalid parameters")
+	}
+	addrStr, ok := p[0].(string)
+	if !ok {
+		return nil, invalidParams("invalid address")
+	}
+	addr, err := types.HexToAddress(addrStr)
+	if err != nil {
+		return nil, invalidParams("invalid address format: %v", err)
+	}
+	param, err := parseBlockParam(p, 1)
+	if err != nil {
+		return nil, err
+	}
+	if param.IsPending() {
+		return nil, invalidParams("pending block has no state root")
+	}
+	block, err := s.resolveBlock(param)
+	if err != nil {
+		return nil, err
+	}
+
+	number := block.Number().Uint64()
+	if number == 0 {
+		return nil, fmt.Errorf("genesis block commits to no state")
+	}
+	return s.node.blockchain.AccountProof(addr, number-1)
+}
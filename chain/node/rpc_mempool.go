@@ -0,0 +1,59 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"quantum-blockchain/chain/types"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// EncryptionKeyResult lists the keys the key shares of transactions of an
+// epoch are encrypted to and the threshold of shares revealing them
+type EncryptionKeyResult struct {
+	Epoch      hexutil.Uint64            `json:"epoch"`
+	Threshold  hexutil.Uint64            `json:"threshold"`
+	Keys       []*ValidatorEncryptionKey `json:"keys"`
+	FirstBlock hexutil.Uint64            `json:"firstBlock"`
+	LastBlock  hexutil.Uint64            `json:"lastBlock"`
+}
+
+// ValidatorEncryptionKey is the key a validator announced for an epoch
+type ValidatorEncryptionKey struct {
+	Validator types.Address `json:"validator"`
+	PublicKey hexutil.Bytes `json:"publicKey"`
+}
+
+// quantumGetEncryptionKey returns the Kyber keys of the validators for an
+// encryption epoch, parameters are [epoch] and default to the epoch of the
+// next block. More than a third of the validators must release their shares
+// to reveal a transaction, so fewer can not decrypt it before its block is
+// committed.
+func (s *RPCServer) quantumGetEncryptionKey(params json.RawMessage) (interface{}, error) {
+	epoch, err := parseEpochParam(params, types.EncryptionEpoch(s.node.blockchain.GetCurrentBlock().Number().Uint64()+1))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := s.node.EncryptionKeys(epoch)
+	if len(keys) == 0 {
+		return nil, errors.New("encrypted mempool is not available on this node")
+	}
+	threshold := (len(s.node.multiConsensus.GetValidatorSet())-1)/3 + 1
+	if len(keys) < threshold {
+		return nil, fmt.Errorf("only %d validators announced keys for epoch %d, %d needed", len(keys), epoch, threshold)
+	}
+
+	result := &EncryptionKeyResult{
+		Epoch:      hexutil.Uint64(epoch),
+		Threshold:  hexutil.Uint64(threshold),
+		FirstBlock: hexutil.Uint64(epoch * types.EncryptionEpochLength),
+		LastBlock:  hexutil.Uint64((epoch+1)*types.EncryptionEpochLength - 1),
+	}
+	for _, key := range keys {
+		result.Keys = append(result.Keys, &ValidatorEncryptionKey{Validator: key.Validator, PublicKey: key.PublicKey.Bytes()})
+	}
+	return result, nil
+}
@@ -0,0 +1,89 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// ValidatorSetMemberResult is a member of the validator set of an epoch
+type ValidatorSetMemberResult struct {
+	Address     string        `json:"address"`
+	SigAlg      uint8         `json:"sigAlg"`
+	PublicKey   hexutil.Bytes `json:"publicKey"`
+	VotingPower *hexutil.Big  `json:"votingPower"`
+}
+
+// ValidatorSetResult is the validator set of an epoch, the first block of the
+// epoch commits to its hash
+type ValidatorSetResult struct {
+	Epoch      hexutil.Uint64              `json:"epoch"`
+	FirstBlock hexutil.Uint64              `json:"firstBlock"`
+	LastBlock  hexutil.Uint64              `json:"lastBlock"`
+	Hash       string                      `json:"hash"`
+	Validators []*ValidatorSetMemberResult `json:"validators"`
+}
+
+// quantumGetValidatorSet returns the validator set of an epoch, parameters
+// are [epoch] and default to the current epoch
+func (s *RPCServer) quantumGetValidatorSet(params json.RawMessage) (interface{}, error) {
+	if s.node.multiConsensus == nil {
+		return nil, errors.New("consensus engine not initialized")
+	}
+
+	epoch, err := parseEpochParam(params, s.node.multiConsensus.CurrentEpoch())
+	if err != nil {
+		return nil, err
+	}
+	set, ok := s.node.multiConsensus.GetEpochValidatorSet(epoch)
+	if !ok {
+		return nil, fmt.Errorf("validator set of epoch %d not available", epoch)
+	}
+
+	epochBlocks := s.node.multiConsensus.EpochBlocks()
+	result := &ValidatorSetResult{
+		Epoch:      hexutil.Uint64(set.Epoch),
+		FirstBlock: hexutil.Uint64(set.FirstBlock),
+		LastBlock:  hexutil.Uint64((set.Epoch+1)*epochBlocks - 1),
+		Hash:       set.Hash().Hex(),
+		Validators: make([]*ValidatorSetMemberResult, 0, len(set.Validators)),
+	}
+	for _, validator := range set.Validators {
+		result.Validators = append(result.Validators, &ValidatorSetMemberResult{
+			Address:     validator.Address.Hex(),
+			SigAlg:      uint8(validator.SigAlgorithm),
+			PublicKey:   validator.PublicKey,
+			VotingPower: (*hexutil.Big)(validator.VotingPower),
+		})
+	}
+	return result, nil
+}
+
+// parseEpochParam reads the optional epoch of the parameters [epoch], given
+// as a hex quantity or a number
+func parseEpochParam(params json.RawMessage, epoch uint64) (uint64, error) {
+	var p []interface{}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return 0, invalidParams("invalid parameters")
+		}
+	}
+	if len(p) == 0 || p[0] == nil {
+		return epoch, nil
+	}
+
+	switch v := p[0].(type) {
+	case string:
+		n, err := hexutil.DecodeUint64(v)
+		if err != nil {
+			return 0, invalidParams("invalid epoch: %v", err)
+		}
+		return n, nil
+	case float64:
+		return uint64(v), nil
+	default:
+		return 0, invalidParams("invalid epoch")
+	}
+}
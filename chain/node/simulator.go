@@ -0,0 +1,694 @@
+package node
+
+import (
+	"container/heap"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	"quantum-blockchain/chain/config"
+	"quantum-blockchain/chain/consensus"
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/evm"
+	"quantum-blockchain/chain/network"
+	"quantum-blockchain/chain/types"
+)
+
+// simulationStake is the genesis stake of every simulated validator, twice
+// the minimum so that validators slashed for downtime can rejoin
+var simulationStake, _ = new(big.Int).SetString("200000000000000000000000", 10) // 200K QTM
+
+// SimulationConfig describes a simulated validator network
+type SimulationConfig struct {
+	Validators    int                        // Number of validator nodes
+	DataDir       string                     // Directory holding the node databases
+	Seed          int64                      // Seed of message delays and losses, runs with the same seed deliver alike
+	BlockInterval time.Duration              // Time between the consensus steps of a node, 2s if 0
+	Latency       time.Duration              // Least delay of a message
+	Jitter        time.Duration              // Random delay added to the latency
+	Loss          float64                    // Probability of a message getting lost
+	Accounts      map[types.Address]*big.Int // Genesis balances besides the validator stakes
+
+	// Liveness tracking of the validators, the consensus defaults if the
+	// window is 0
+	SignedBlocksWindow uint64
+	MinSignedRatio     float64
+	DowntimeJail       time.Duration
+
+	// Blocks of an epoch, changes to the validator set wait for the next
+	// epoch; the consensus default if 0
+	EpochBlocks uint64
+}
+
+// Simulator runs validator nodes in one process over an in-memory network.
+// Time is simulated: messages and consensus steps are events run one at a
+// time in the order of their simulated time, so the network can be delayed,
+// lossy, partitioned or have crashed validators without real sleeps.
+type Simulator struct {
+	config *SimulationConfig
+	nodes  []*SimNode
+	rng    *rand.Rand
+
+	now    time.Time
+	events simEventQueue
+	seq    uint64
+
+	accounts map[types.Address]bool // Accounts whose balances make up the supply
+	supply   *big.Int               // Genesis supply of the accounts
+
+	filter func(from, to int, msgType network.MessageType) bool // Messages delivered, all if nil
+}
+
+// SimNode is a node of the simulated network, its transport delivers the
+// validator messages through the simulator
+type SimNode struct {
+	*Node
+	sim     *Simulator
+	index   int
+	group   int           // Partition, nodes of different groups can not reach each other
+	latency time.Duration // Delay added to the messages it sends and receives
+	crashed bool
+
+	onProposal  func(*types.Block) error
+	onVote      func(*network.ConsensusMessage) error
+	onBlock     func(*types.Block) error
+	onEvidence  func(*consensus.Evidence) error
+	onKey       func(*network.EncryptionKeyData) error
+	onShares    func(*network.DecryptionSharesData) error
+	blockSource func(uint64) *types.Block
+
+	Delivered uint64 // Messages handed to the node
+	Rejected  uint64 // Delivered messages its handlers rejected as misbehavior
+}
+
+type simEvent struct {
+	at  time.Time
+	seq uint64 // Orders events at the same time by scheduling
+	run func()
+}
+
+type simEventQueue []*simEvent
+
+func (q simEventQueue) Len() int { return len(q) }
+func (q simEventQueue) Less(i, j int) bool {
+	if q[i].at.Equal(q[j].at) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].at.Before(q[j].at)
+}
+func (q simEventQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *simEventQueue) Push(x interface{}) { *q = append(*q, x.(*simEvent)) }
+func (q *simEventQueue) Pop() interface{} {
+	old := *q
+	event := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return event
+}
+
+// NewSimulator creates the genesis validators and their nodes. The nodes are
+// not started, the simulator drives their consensus.
+func NewSimulator(cfg *SimulationConfig) (*Simulator, error) {
+	if cfg.Validators < 1 {
+		return nil, fmt.Errorf("simulation needs at least one validator")
+	}
+	if cfg.BlockInterval == 0 {
+		cfg.BlockInterval = 2 * time.Second
+	}
+
+	s := &Simulator{
+		config:   cfg,
+		rng:      rand.New(rand.NewSource(cfg.Seed)),
+		now:      time.Now().Truncate(time.Second),
+		accounts: make(map[types.Address]bool),
+		supply:   big.NewInt(0),
+	}
+
+	genesis := config.DefaultGenesisConfig()
+	genesis.Timestamp = uint64(s.now.Unix())
+	genesis.Alloc = make(map[string]*config.GenesisAccount)
+	for addr, balance := range cfg.Accounts {
+		genesis.Alloc[addr.Hex()] = &config.GenesisAccount{Balance: balance.String()}
+		s.accounts[addr] = true
+	}
+	keys := make([]string, cfg.Validators)
+	for i := range keys {
+		priv, pub, err := crypto.GenerateDilithiumKeyPair()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate validator key: %w", err)
+		}
+		addr := types.PublicKeyToAddress(pub.Bytes())
+		keys[i] = hex.EncodeToString(priv.Bytes())
+		genesis.Validators = append(genesis.Validators, config.GenesisValidator{
+			Address:   addr.Hex(),
+			Stake:     simulationStake.String(),
+			PublicKey: hex.EncodeToString(pub.Bytes()),
+		})
+		s.accounts[addr] = true
+	}
+
+	if err := os.MkdirAll(cfg.DataDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	genesisPath := filepath.Join(cfg.DataDir, "genesis.json")
+	data, err := json.Marshal(genesis)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal genesis: %w", err)
+	}
+	if err := os.WriteFile(genesisPath, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write genesis: %w", err)
+	}
+
+	for i, key := range keys {
+		n, err := NewNode(&Config{
+			DataDir:       filepath.Join(cfg.DataDir, fmt.Sprintf("node%d", i)),
+			NetworkID:     8888,
+			ListenAddr:    "127.0.0.1:0",
+			ValidatorKey:  key,
+			GenesisConfig: genesisPath,
+			Mining:        true,
+			GasLimit:      15000000,
+			GasPrice:      big.NewInt(1000000000),
+		})
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("failed to create node %d: %w", i, err)
+		}
+
+		sn := &SimNode{Node: n, sim: s, index: i}
+		n.now = s.Now
+		n.importedAt = s.now
+		n.mining = true
+		n.multiConsensus.SetClock(s.Now)
+		if cfg.SignedBlocksWindow > 0 {
+			if err := n.multiConsensus.SetLivenessParams(cfg.SignedBlocksWindow, cfg.MinSignedRatio, cfg.DowntimeJail); err != nil {
+				s.Close()
+				return nil, err
+			}
+		}
+		if cfg.EpochBlocks > 0 {
+			if err := n.multiConsensus.SetEpochBlocks(cfg.EpochBlocks); err != nil {
+				s.Close()
+				return nil, err
+			}
+		}
+		n.attachValidatorTransport(sn)
+		s.nodes = append(s.nodes, sn)
+
+		// Nodes step at their own offset within the block interval
+		offset := time.Duration(s.rng.Int63n(int64(cfg.BlockInterval)))
+		s.scheduleStep(sn, offset)
+	}
+
+	s.supply = s.balances(s.nodes[0])
+	return s, nil
+}
+
+// Now returns the simulated time
+func (s *Simulator) Now() time.Time {
+	return s.now
+}
+
+// Nodes returns the simulated nodes
+func (s *Simulator) Nodes() []*SimNode {
+	return s.nodes
+}
+
+// Run processes the events of the given simulated duration
+func (s *Simulator) Run(d time.Duration) {
+	end := s.now.Add(d)
+	for s.events.Len() > 0 && !s.events[0].at.After(end) {
+		event := heap.Pop(&s.events).(*simEvent)
+		s.now = event.at
+		event.run()
+	}
+	s.now = end
+}
+
+// RunUntil processes events until the condition holds or the simulated
+// timeout passes, and reports whether the condition holds
+func (s *Simulator) RunUntil(timeout time.Duration, condition func() bool) bool {
+	end := s.now.Add(timeout)
+	for !condition() {
+		if s.events.Len() == 0 || s.events[0].at.After(end) {
+			s.now = end
+			return false
+		}
+		event := heap.Pop(&s.events).(*simEvent)
+		s.now = event.at
+		event.run()
+	}
+	return true
+}
+
+// Close closes the node databases
+func (s *Simulator) Close() {
+	for _, sn := range s.nodes {
+		sn.blockchain.Close()
+	}
+}
+
+// SetLatency sets the delay of messages sent from now on
+func (s *Simulator) SetLatency(latency, jitter time.Duration) {
+	s.config.Latency = latency
+	s.config.Jitter = jitter
+}
+
+// SetNodeLatency sets the delay added to the messages a node sends and
+// receives from now on, making it a slow validator
+func (s *Simulator) SetNodeLatency(index int, latency time.Duration) {
+	s.nodes[index].latency = latency
+}
+
+// SetLoss sets the probability of messages sent from now on getting lost
+func (s *Simulator) SetLoss(loss float64) {
+	s.config.Loss = loss
+}
+
+// Partition splits the network into groups of node indexes that can only
+// reach nodes of their own group. Nodes not listed form another group.
+func (s *Simulator) Partition(groups ...[]int) {
+	for _, sn := range s.nodes {
+		sn.group = 0
+	}
+	for i, group := range groups {
+		for _, index := range group {
+			s.nodes[index].group = i + 1
+		}
+	}
+}
+
+// Heal ends the partition
+func (s *Simulator) Heal() {
+	s.Partition()
+}
+
+// SetFilter sets which messages sent from now on are delivered, by the
+// indexes of their sender and receiver and their type. A nil filter delivers
+// them all.
+func (s *Simulator) SetFilter(filter func(from, to int, msgType network.MessageType) bool) {
+	s.filter = filter
+}
+
+// Crash stops a node from stepping, sending and receiving until it recovers
+func (s *Simulator) Crash(index int) {
+	s.nodes[index].crashed = true
+}
+
+// Recover resumes a crashed node with the state it had when it crashed
+func (s *Simulator) Recover(index int) {
+	s.nodes[index].crashed = false
+}
+
+// DoubleSign makes a validator vote for a made up block at the next height
+// besides the block it votes for, as a faulty or malicious validator would
+func (s *Simulator) DoubleSign(index int) error {
+	sn := s.nodes[index]
+	vote := &consensus.ConsensusVote{
+		Validator:    sn.validatorAddr,
+		BlockHash:    types.Keccak256Hash([]byte(fmt.Sprintf("conflicting block %d", s.seq))),
+		BlockHeight:  sn.blockchain.GetCurrentBlock().Number().Uint64() + 1,
+		VoteType:     consensus.VoteCommit,
+		Timestamp:    s.now,
+		PublicKey:    sn.getPublicKey(),
+		SigAlgorithm: sn.validatorAlg,
+	}
+	signature, err := crypto.SignMessage(vote.SigningData(), sn.validatorAlg, sn.validatorPrivKey)
+	if err != nil {
+		return fmt.Errorf("failed to sign vote: %w", err)
+	}
+	vote.Signature = signature.Signature
+
+	sn.broadcastVote(vote)
+	return nil
+}
+
+// Unjail makes a validator send an unjail transaction, as validator-cli
+// does once its jail term is over
+func (s *Simulator) Unjail(index int) error {
+	sn := s.nodes[index]
+	sigSize, pubKeySize := evm.SignatureSizes(sn.validatorAlg)
+	gasLimit := evm.IntrinsicGas(sn.validatorAlg, sigSize, pubKeySize) + evm.UnjailGas
+
+	tx := types.NewUnjailTransaction(big.NewInt(8888), sn.blockchain.GetNonce(sn.validatorAddr), gasLimit, big.NewInt(1000000000))
+	if err := tx.SignTransaction(sn.validatorPrivKey, sn.validatorAlg); err != nil {
+		return fmt.Errorf("failed to sign transaction: %w", err)
+	}
+	return s.SubmitTransaction(tx)
+}
+
+// SubmitTransaction adds a transaction to the pools of the running nodes,
+// as the public network would spread it
+func (s *Simulator) SubmitTransaction(tx *types.QuantumTransaction) error {
+	s.accounts[tx.From()] = true
+	if tx.To != nil {
+		s.accounts[*tx.To] = true
+	}
+
+	var added bool
+	var failed error
+	for _, sn := range s.nodes {
+		if sn.crashed {
+			continue
+		}
+		if err := sn.AddTransaction(tx); err != nil {
+			failed = err
+			continue
+		}
+		added = true
+	}
+	if !added {
+		return fmt.Errorf("no node accepted the transaction: %w", failed)
+	}
+	return nil
+}
+
+// CheckSafety checks that no two nodes committed different blocks at the
+// same height
+func (s *Simulator) CheckSafety() error {
+	committed := make(map[uint64]types.Hash)
+	for _, sn := range s.nodes {
+		head := sn.blockchain.GetCurrentBlock().Number().Uint64()
+		for number := uint64(1); number <= head; number++ {
+			block, err := sn.blockchain.GetBlockByNumber(new(big.Int).SetUint64(number))
+			if err != nil {
+				return fmt.Errorf("node %d misses block #%d: %w", sn.index, number, err)
+			}
+			if hash, ok := committed[number]; ok && hash != block.Hash() {
+				return fmt.Errorf("node %d committed block #%d %s conflicting with %s", sn.index, number, block.Hash().Hex(), hash.Hex())
+			}
+			committed[number] = block.Hash()
+		}
+	}
+	return nil
+}
+
+// CheckConvergence checks that the running nodes share the same head
+func (s *Simulator) CheckConvergence() error {
+	var head *types.Block
+	for _, sn := range s.nodes {
+		if sn.crashed {
+			continue
+		}
+		block := sn.blockchain.GetCurrentBlock()
+		if head == nil {
+			head = block
+			continue
+		}
+		if block.Hash() != head.Hash() {
+			return fmt.Errorf("node %d is at block #%d %s, others at #%d %s",
+				sn.index, block.Number(), block.Hash().Hex(), head.Number(), head.Hash().Hex())
+		}
+	}
+	return nil
+}
+
+// CheckBalances checks that on every node the balances add up to the
+// genesis supply, plus the rewards minted for its blocks, minus the base
+// fees they burned
+func (s *Simulator) CheckBalances() error {
+	for _, sn := range s.nodes {
+		expected := new(big.Int).Set(s.supply)
+		head := sn.blockchain.GetCurrentBlock().Number().Uint64()
+		for number := uint64(1); number <= head; number++ {
+			block, err := sn.blockchain.GetBlockByNumber(new(big.Int).SetUint64(number))
+			if err != nil {
+				return fmt.Errorf("node %d misses block #%d: %w", sn.index, number, err)
+			}
+			expected.Add(expected, consensusBlockReward)
+
+			// Encrypted transactions are charged in the block executing them
+			receipts, err := sn.blockchain.getReceiptsByBlockHash(block.Hash())
+			if err != nil {
+				return fmt.Errorf("node %d misses the receipts of block #%d: %w", sn.index, number, err)
+			}
+			for _, receipt := range receipts {
+				burned := new(big.Int).Mul(block.Header.BaseFee, new(big.Int).SetUint64(receipt.GasUsed))
+				expected.Sub(expected, burned)
+			}
+		}
+		if total := s.balances(sn); total.Cmp(expected) != 0 {
+			return fmt.Errorf("node %d holds %s in balances, expected %s at block #%d", sn.index, total, expected, head)
+		}
+	}
+	return nil
+}
+
+// CheckStateRoots checks that on every node the state root of the head,
+// updated from the accounts each block changed, matches the root of every
+// account of the state
+func (s *Simulator) CheckStateRoots() error {
+	for _, sn := range s.nodes {
+		head := sn.blockchain.GetCurrentBlock().Number().Uint64()
+		root, err := sn.blockchain.StateRoot(head)
+		if err != nil {
+			return fmt.Errorf("node %d has no state root at block #%d: %w", sn.index, head, err)
+		}
+		tree, err := sn.blockchain.buildStateTree(head)
+		if err != nil {
+			return fmt.Errorf("node %d can not build its state tree at block #%d: %w", sn.index, head, err)
+		}
+		if tree.Root() != root {
+			return fmt.Errorf("node %d has state root %s at block #%d, its state has %s", sn.index, root.Hex(), head, tree.Root().Hex())
+		}
+	}
+	return nil
+}
+
+// CheckInvariants checks safety, balances and state roots, which hold at all
+// times
+func (s *Simulator) CheckInvariants() error {
+	if err := s.CheckSafety(); err != nil {
+		return err
+	}
+	if err := s.CheckBalances(); err != nil {
+		return err
+	}
+	return s.CheckStateRoots()
+}
+
+// balances sums the balances of the tracked accounts on a node
+func (s *Simulator) balances(sn *SimNode) *big.Int {
+	total := big.NewInt(0)
+	for addr := range s.accounts {
+		total.Add(total, sn.blockchain.GetBalance(addr))
+	}
+	return total
+}
+
+// scheduleStep runs the consensus step of a node after a delay and at every
+// block interval from then on
+func (s *Simulator) scheduleStep(sn *SimNode, delay time.Duration) {
+	s.schedule(delay, func() {
+		if !sn.crashed {
+			sn.consensusStep()
+		}
+		s.scheduleStep(sn, s.config.BlockInterval)
+	})
+}
+
+func (s *Simulator) schedule(delay time.Duration, run func()) {
+	s.seq++
+	heap.Push(&s.events, &simEvent{at: s.now.Add(delay), seq: s.seq, run: run})
+}
+
+// send delivers a message from one node to another after the latency,
+// unless it is lost, filtered out or either node is crashed or cut off
+func (s *Simulator) send(from, to *SimNode, msgType network.MessageType, deliver func() error) {
+	if from.crashed || from.group != to.group || s.rng.Float64() < s.config.Loss {
+		return
+	}
+	if s.filter != nil && !s.filter(from.index, to.index, msgType) {
+		return
+	}
+	delay := s.config.Latency + from.latency + to.latency
+	if s.config.Jitter > 0 {
+		delay += time.Duration(s.rng.Int63n(int64(s.config.Jitter)))
+	}
+	s.schedule(delay, func() {
+		if to.crashed || from.group != to.group {
+			return
+		}
+		to.Delivered++
+		if err := deliver(); err != nil {
+			if _, misbehavior := network.ScoreEventForError(err); misbehavior {
+				to.Rejected++
+			}
+		}
+	})
+}
+
+// broadcast sends a message to every other node, each receiving its own copy
+func (sn *SimNode) broadcast(v interface{}, msgType network.MessageType, deliver func(to *SimNode, data []byte) error) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	for _, to := range sn.sim.nodes {
+		if to == sn {
+			continue
+		}
+		to := to
+		sn.sim.send(sn, to, msgType, func() error { return deliver(to, data) })
+	}
+	return nil
+}
+
+// BroadcastProposal sends a proposal to the other validators
+func (sn *SimNode) BroadcastProposal(block *types.Block) error {
+	return sn.broadcast(block, network.MsgConsensusProposal, func(to *SimNode, data []byte) error {
+		var proposal types.Block
+		if err := json.Unmarshal(data, &proposal); err != nil {
+			return err
+		}
+		return to.onProposal(&proposal)
+	})
+}
+
+// BroadcastConsensusMessage sends a vote to the other validators
+func (sn *SimNode) BroadcastConsensusMessage(msg *network.ConsensusMessage) error {
+	return sn.broadcast(msg, network.MsgConsensusVote, func(to *SimNode, data []byte) error {
+		var vote network.ConsensusMessage
+		if err := json.Unmarshal(data, &vote); err != nil {
+			return err
+		}
+		return to.onVote(&vote)
+	})
+}
+
+// BroadcastBlock sends a committed block to the other validators
+func (sn *SimNode) BroadcastBlock(block *types.Block) error {
+	return sn.broadcast(block, network.MsgBlock, func(to *SimNode, data []byte) error {
+		var committed types.Block
+		if err := json.Unmarshal(data, &committed); err != nil {
+			return err
+		}
+		return to.onBlock(&committed)
+	})
+}
+
+// BroadcastEvidence sends evidence of double signing to the other validators
+func (sn *SimNode) BroadcastEvidence(ev *consensus.Evidence) error {
+	return sn.broadcast(ev, network.MsgEvidence, func(to *SimNode, data []byte) error {
+		var evidence consensus.Evidence
+		if err := json.Unmarshal(data, &evidence); err != nil {
+			return err
+		}
+		return to.onEvidence(&evidence)
+	})
+}
+
+// BroadcastEncryptionKey sends an encryption key of the node to the other validators
+func (sn *SimNode) BroadcastEncryptionKey(key *network.EncryptionKeyData) error {
+	return sn.broadcast(key, network.MsgEncryptionKey, func(to *SimNode, data []byte) error {
+		var announced network.EncryptionKeyData
+		if err := json.Unmarshal(data, &announced); err != nil {
+			return err
+		}
+		return to.onKey(&announced)
+	})
+}
+
+// BroadcastDecryptionShares sends the key share secrets of the node to the other validators
+func (sn *SimNode) BroadcastDecryptionShares(shares *network.DecryptionSharesData) error {
+	return sn.broadcast(shares, network.MsgDecryptionShares, func(to *SimNode, data []byte) error {
+		var released network.DecryptionSharesData
+		if err := json.Unmarshal(data, &released); err != nil {
+			return err
+		}
+		return to.onShares(&released)
+	})
+}
+
+// RequestBlocks asks a validator for the blocks from a number on, its
+// response hands them to the block handler in order
+func (sn *SimNode) RequestBlocks(validator types.Address, from uint64) error {
+	var target *SimNode
+	for _, other := range sn.sim.nodes {
+		if other.validatorAddr == validator {
+			target = other
+		}
+	}
+	if target == nil || target == sn {
+		return fmt.Errorf("validator %s is not simulated", validator.Hex())
+	}
+
+	sn.sim.send(sn, target, network.MsgBlockRequest, func() error {
+		response := &network.BlockResponseData{Blocks: []*types.Block{}}
+		for number := from; len(response.Blocks) < 64; number++ {
+			block := target.blockSource(number)
+			if block == nil {
+				break
+			}
+			response.Blocks = append(response.Blocks, block)
+		}
+		data, err := json.Marshal(response)
+		if err != nil {
+			return err
+		}
+
+		sn.sim.send(target, sn, network.MsgBlockResponse, func() error {
+			var blocks network.BlockResponseData
+			if err := json.Unmarshal(data, &blocks); err != nil {
+				return err
+			}
+			for _, block := range blocks.Blocks {
+				if err := sn.onBlock(block); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		return nil
+	})
+	return nil
+}
+
+// SetProposalHandler sets the handler of proposals delivered to the node
+func (sn *SimNode) SetProposalHandler(handler func(*types.Block) error) {
+	sn.onProposal = handler
+}
+
+// SetConsensusHandler sets the handler of votes delivered to the node
+func (sn *SimNode) SetConsensusHandler(handler func(*network.ConsensusMessage) error) {
+	sn.onVote = handler
+}
+
+// SetBlockHandler sets the handler of blocks delivered to the node
+func (sn *SimNode) SetBlockHandler(handler func(*types.Block) error) {
+	sn.onBlock = handler
+}
+
+// SetEvidenceHandler sets the handler of evidence delivered to the node
+func (sn *SimNode) SetEvidenceHandler(handler func(*consensus.Evidence) error) {
+	sn.onEvidence = handler
+}
+
+// SetEncryptionKeyHandler sets the handler of encryption keys delivered to the node
+func (sn *SimNode) SetEncryptionKeyHandler(handler func(*network.EncryptionKeyData) error) {
+	sn.onKey = handler
+}
+
+// SetDecryptionSharesHandler sets the handler of key share secrets delivered to the node
+func (sn *SimNode) SetDecryptionSharesHandler(handler func(*network.DecryptionSharesData) error) {
+	sn.onShares = handler
+}
+
+// SetBlockSource sets the lookup of the blocks the node serves
+func (sn *SimNode) SetBlockSource(source func(uint64) *types.Block) {
+	sn.blockSource = source
+}
+
+// Index returns the position of the node in the simulation
+func (sn *SimNode) Index() int {
+	return sn.index
+}
+
+// Crashed reports whether the node is crashed
+func (sn *SimNode) Crashed() bool {
+	return sn.crashed
+}
@@ -0,0 +1,400 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"quantum-blockchain/chain/types"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// ErrStateUnavailable is returned when the state of a historical block can no
+// longer be reconstructed
+var ErrStateUnavailable = errors.New("historical state not available")
+
+// DefaultStateHistory is the number of recent blocks whose state is retained
+const DefaultStateHistory = 8192
+
+// journalEntry is the value a state key held before it was first modified
+type journalEntry struct {
+	Key     []byte `json:"key"`
+	Value   []byte `json:"value,omitempty"`
+	Existed bool   `json:"existed"`
+}
+
+// stateDiffPrefix prefixes the database keys of reverse state diffs
+var stateDiffPrefix = []byte("statediff-")
+
+// stateDiffKey returns the database key of the reverse state diff of a block
+func stateDiffKey(number uint64) []byte {
+	return append(append([]byte(nil), stateDiffPrefix...), new(big.Int).SetUint64(number).Bytes()...)
+}
+
+// recordPreimage remembers the current value of key before it is overwritten.
+// Callers must hold s.mu.
+func (s *StateDB) recordPreimage(key []byte) {
+	s.changed[string(key)] = true
+	if _, recorded := s.journal[string(key)]; recorded {
+		return
+	}
+
+	entry := &journalEntry{Key: append([]byte(nil), key...)}
+	if value, err := s.db.Get(key, nil); err == nil {
+		entry.Value = value
+		entry.Existed = true
+	}
+	s.journal[string(key)] = entry
+}
+
+// commitJournal persists the pre-images recorded since the last commit as the
+// reverse diff of the given block. Entries already stored for the block are
+// older and therefore take precedence.
+func (s *StateDB) commitJournal(number uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.journal) == 0 {
+		return nil
+	}
+
+	key := stateDiffKey(number)
+	merged := make(map[string]*journalEntry, len(s.journal))
+	for k, entry := range s.journal {
+		merged[k] = entry
+	}
+
+	if data, err := s.db.Get(key, nil); err == nil {
+		var existing []*journalEntry
+		if err := json.Unmarshal(data, &existing); err != nil {
+			return fmt.Errorf("failed to decode state diff for block %d: %w", number, err)
+		}
+		for _, entry := range existing {
+			merged[string(entry.Key)] = entry
+		}
+	}
+
+	entries := make([]*journalEntry, 0, len(merged))
+	for _, entry := range merged {
+		entries = append(entries, entry)
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode state diff for block %d: %w", number, err)
+	}
+	if err := s.db.Put(key, data, nil); err != nil {
+		return fmt.Errorf("failed to store state diff for block %d: %w", number, err)
+	}
+
+	s.journal = make(map[string]*journalEntry)
+	return nil
+}
+
+// takeChanged returns the keys written since the last call and forgets them
+func (s *StateDB) takeChanged() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.changed))
+	for key := range s.changed {
+		keys = append(keys, key)
+	}
+	s.changed = make(map[string]bool)
+	return keys
+}
+
+// pendingJournal returns a copy of the pre-images recorded since the last commit
+func (s *StateDB) pendingJournal() []*journalEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := make([]*journalEntry, 0, len(s.journal))
+	for _, entry := range s.journal {
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// SetStateHistory sets how many recent blocks keep their reverse state diffs.
+// Older state can no longer be queried. Zero retains the full history.
+func (bc *Blockchain) SetStateHistory(blocks uint64) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	bc.stateHistory = blocks
+}
+
+// pruneStateHistory deletes the reverse diffs that fell out of the retention
+// window after the head advanced. Callers must hold bc.mu.
+func (bc *Blockchain) pruneStateHistory() error {
+	head := bc.currentBlock.Number().Uint64()
+	if bc.stateHistory == 0 || head < bc.stateHistory {
+		return nil
+	}
+
+	// Restoring block n needs the diffs of n+1 to the head, so no retained
+	// block depends on the diffs at or below head-retention
+	cutoff := head - bc.stateHistory
+	if bc.historyPruned && cutoff < bc.historyTail {
+		return nil
+	}
+
+	batch := new(leveldb.Batch)
+	if bc.historyPruned {
+		for number := bc.historyTail; number <= cutoff; number++ {
+			batch.Delete(stateDiffKey(number))
+		}
+	} else {
+		// The window may have shrunk since the diffs were written, so the
+		// first prune after startup looks at every stored diff
+		iter := bc.db.NewIterator(util.BytesPrefix(stateDiffPrefix), nil)
+		for iter.Next() {
+			number := new(big.Int).SetBytes(iter.Key()[len(stateDiffPrefix):])
+			if number.IsUint64() && number.Uint64() <= cutoff {
+				batch.Delete(append([]byte(nil), iter.Key()...))
+			}
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return fmt.Errorf("failed to scan state diffs: %w", err)
+		}
+	}
+
+	if err := bc.db.Write(batch, nil); err != nil {
+		return fmt.Errorf("failed to delete state diffs up to block %d: %w", cutoff, err)
+	}
+	bc.historyPruned = true
+	bc.historyTail = cutoff + 1
+	return nil
+}
+
+// StateOverlay is a writable view of the state at a given block. Reads fall
+// through to the historical pre-images and then to a database snapshot, while
+// writes are kept in memory and never reach the database.
+type StateOverlay struct {
+	snapshot *leveldb.Snapshot
+	history  map[string]*journalEntry
+	dirty    map[string][]byte
+	cleared  map[types.Address]bool // Accounts whose storage was replaced by an override
+	number   uint64
+	released *bool // Shared between copies so the snapshot is released once
+	mu       sync.RWMutex
+}
+
+// StateAt returns a state overlay reflecting the state after the given block
+// was applied. The overlay must be released by the caller.
+func (bc *Blockchain) StateAt(number uint64) (*StateOverlay, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	head := bc.currentBlock.Number().Uint64()
+	if number > head {
+		return nil, fmt.Errorf("block %d is beyond the current head %d", number, head)
+	}
+	if bc.stateHistory > 0 && head-number > bc.stateHistory {
+		return nil, fmt.Errorf("%w: state of block %d has been pruned (retaining the last %d blocks)",
+			ErrStateUnavailable, number, bc.stateHistory)
+	}
+
+	snapshot, err := bc.db.GetSnapshot()
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot state: %w", err)
+	}
+
+	overlay := &StateOverlay{
+		snapshot: snapshot,
+		history:  make(map[string]*journalEntry),
+		dirty:    make(map[string][]byte),
+		cleared:  make(map[types.Address]bool),
+		number:   number,
+		released: new(bool),
+	}
+
+	if number == head {
+		return overlay, nil
+	}
+
+	// Undo blocks from the head down to number+1. Older pre-images overwrite
+	// newer ones so each key ends up with its value as of the target block.
+	overlay.applyDiff(bc.stateDB.pendingJournal())
+	for n := head - 1; n > number; n-- {
+		data, err := snapshot.Get(stateDiffKey(n), nil)
+		if err != nil {
+			snapshot.Release()
+			return nil, fmt.Errorf("%w: state diff for block %d is missing", ErrStateUnavailable, n)
+		}
+
+		var entries []*journalEntry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			snapshot.Release()
+			return nil, fmt.Errorf("failed to decode state diff for block %d: %w", n, err)
+		}
+		overlay.applyDiff(entries)
+	}
+
+	return overlay, nil
+}
+
+func (o *StateOverlay) applyDiff(entries []*journalEntry) {
+	for _, entry := range entries {
+		o.history[string(entry.Key)] = entry
+	}
+}
+
+// Number returns the block number the overlay was created at
+func (o *StateOverlay) Number() uint64 {
+	return o.number
+}
+
+// Release frees the underlying database snapshot. Copies share the snapshot,
+// so releasing any of them invalidates all.
+func (o *StateOverlay) Release() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if !*o.released {
+		*o.released = true
+		o.snapshot.Release()
+	}
+}
+
+// Copy returns an independent overlay with the same pending writes, used to
+// run several executions on the same starting state
+func (o *StateOverlay) Copy() *StateOverlay {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	cpy := &StateOverlay{
+		snapshot: o.snapshot,
+		history:  o.history,
+		dirty:    make(map[string][]byte, len(o.dirty)),
+		cleared:  make(map[types.Address]bool, len(o.cleared)),
+		number:   o.number,
+		released: o.released,
+	}
+	for k, v := range o.dirty {
+		cpy.dirty[k] = v
+	}
+	for addr := range o.cleared {
+		cpy.cleared[addr] = true
+	}
+	return cpy
+}
+
+// ClearStorage drops all storage of an account, slots written afterwards are kept
+func (o *StateOverlay) ClearStorage(addr types.Address) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	prefix := string(append([]byte("storage-"), addr.Bytes()...))
+	for key := range o.dirty {
+		if strings.HasPrefix(key, prefix) {
+			delete(o.dirty, key)
+		}
+	}
+	o.cleared[addr] = true
+}
+
+func (o *StateOverlay) get(key []byte) ([]byte, bool) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	if value, ok := o.dirty[string(key)]; ok {
+		return value, true
+	}
+	if entry, ok := o.history[string(key)]; ok {
+		return entry.Value, entry.Existed
+	}
+	value, err := o.snapshot.Get(key, nil)
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+func (o *StateOverlay) put(key []byte, value []byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.dirty[string(key)] = value
+}
+
+// GetBalance returns the balance of an address
+func (o *StateOverlay) GetBalance(addr types.Address) *big.Int {
+	data, _ := o.get(append([]byte("balance-"), addr.Bytes()...))
+	return new(big.Int).SetBytes(data)
+}
+
+// SetBalance sets the balance of an address
+func (o *StateOverlay) SetBalance(addr types.Address, balance *big.Int) {
+	o.put(append([]byte("balance-"), addr.Bytes()...), balance.Bytes())
+}
+
+// GetNonce returns the nonce of an address
+func (o *StateOverlay) GetNonce(addr types.Address) uint64 {
+	data, _ := o.get(append([]byte("nonce-"), addr.Bytes()...))
+	return new(big.Int).SetBytes(data).Uint64()
+}
+
+// SetNonce sets the nonce of an address
+func (o *StateOverlay) SetNonce(addr types.Address, nonce uint64) {
+	o.put(append([]byte("nonce-"), addr.Bytes()...), new(big.Int).SetUint64(nonce).Bytes())
+}
+
+// GetCode returns contract code
+func (o *StateOverlay) GetCode(addr types.Address) []byte {
+	data, _ := o.get(append([]byte("code-"), addr.Bytes()...))
+	return data
+}
+
+// SetCode sets contract code
+func (o *StateOverlay) SetCode(addr types.Address, code []byte) {
+	o.put(append([]byte("code-"), addr.Bytes()...), code)
+	o.put(append([]byte("codehash-"), addr.Bytes()...), types.Keccak256Hash(code).Bytes())
+}
+
+// GetState returns contract storage value
+func (o *StateOverlay) GetState(addr types.Address, hash types.Hash) types.Hash {
+	key := append(append([]byte("storage-"), addr.Bytes()...), hash.Bytes()...)
+
+	o.mu.RLock()
+	value, written := o.dirty[string(key)]
+	cleared := o.cleared[addr]
+	o.mu.RUnlock()
+
+	if written {
+		return types.BytesToHash(value)
+	}
+	if cleared {
+		return types.Hash{}
+	}
+
+	data, _ := o.get(key)
+	return types.BytesToHash(data)
+}
+
+// SetState sets contract storage value
+func (o *StateOverlay) SetState(addr types.Address, hash types.Hash, value types.Hash) {
+	o.put(append(append([]byte("storage-"), addr.Bytes()...), hash.Bytes()...), value.Bytes())
+}
+
+// Exist checks if account exists
+func (o *StateOverlay) Exist(addr types.Address) bool {
+	for _, prefix := range []string{"balance-", "nonce-", "code-"} {
+		if _, ok := o.get(append([]byte(prefix), addr.Bytes()...)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Empty checks if account is empty (no balance, nonce, or code)
+func (o *StateOverlay) Empty(addr types.Address) bool {
+	return o.GetBalance(addr).Sign() == 0 && o.GetNonce(addr) == 0 && len(o.GetCode(addr)) == 0
+}
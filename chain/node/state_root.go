@@ -0,0 +1,293 @@
+package node
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"quantum-blockchain/chain/types"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// stateTreeCacheSize is the number of recent blocks whose state trees are
+// kept. The next blocks and the votes for them check against their roots and
+// light clients get proofs from them. The trees share the nodes the blocks
+// after them left unchanged.
+const stateTreeCacheSize = 64
+
+// StateRoot returns the root of the state after the given block was applied.
+// The header of the next block commits to it.
+func (bc *Blockchain) StateRoot(number uint64) (types.Hash, error) {
+	tree, err := bc.stateTree(number)
+	if err != nil {
+		return types.ZeroHash, err
+	}
+	return tree.Root(), nil
+}
+
+// AccountProof proves the state of an account after the given block was
+// applied, against the state root of the next block
+func (bc *Blockchain) AccountProof(addr types.Address, number uint64) (*types.AccountProof, error) {
+	tree, err := bc.stateTree(number)
+	if err != nil {
+		return nil, err
+	}
+	return tree.Prove(addr), nil
+}
+
+// stateTree returns the state tree after the given block was applied, built
+// from every account of the state for a block whose tree is no longer kept
+func (bc *Blockchain) stateTree(number uint64) (*types.StateTree, error) {
+	if block, err := bc.GetBlockByNumber(new(big.Int).SetUint64(number)); err == nil {
+		if tree, ok := bc.stateTrees.get(block.Hash()); ok {
+			return tree, nil
+		}
+	}
+	return bc.buildStateTree(number)
+}
+
+// buildStateTree builds the state tree after the given block was applied
+// from every account of the state
+func (bc *Blockchain) buildStateTree(number uint64) (*types.StateTree, error) {
+	state, err := bc.StateAt(number)
+	if err != nil {
+		return nil, err
+	}
+	defer state.Release()
+
+	tree := types.NewStateTree()
+	for _, account := range state.accounts(state.storageTrees()) {
+		tree = tree.Update(account)
+	}
+	return tree, nil
+}
+
+// CacheStateRoot updates the state tree with the accounts the head block
+// changed once everything the block changes is applied, so the blocks and
+// votes that follow check against its root without scanning the state. Only
+// without the tree of its parent, after a restart or when the head moved on,
+// the tree is built from every account of the state.
+func (bc *Blockchain) CacheStateRoot(block *types.Block) error {
+	if bc.GetCurrentBlock().Hash() != block.Hash() {
+		return nil // The state moved on
+	}
+
+	c := bc.stateTrees
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The keys are taken before the state is read, a later write is taken
+	// again by the next block
+	changed := bc.stateDB.takeChanged()
+	tree, ok := c.trees[block.ParentHash()]
+	if !ok || c.head != block.ParentHash() {
+		state, err := bc.StateAt(block.Number().Uint64())
+		if err != nil {
+			return err
+		}
+		defer state.Release()
+
+		c.storage = state.storageTrees()
+		tree = types.NewStateTree()
+		for _, account := range state.accounts(c.storage) {
+			tree = tree.Update(account)
+		}
+		c.add(block.Hash(), tree)
+		return nil
+	}
+
+	addresses := make(map[types.Address]bool)
+	for _, key := range changed {
+		addr, slot, isStorage, ok := parseStateKey(key)
+		if !ok {
+			continue
+		}
+		addresses[addr] = true
+		if isStorage {
+			storage := c.storage[addr]
+			if storage == nil {
+				storage = types.NewStorageTree()
+			}
+			c.storage[addr] = storage.Update(slot, bc.stateDB.GetState(addr, slot))
+		}
+	}
+	for addr := range addresses {
+		account := &types.StateAccount{
+			Address:  addr,
+			Balance:  bc.stateDB.GetBalance(addr),
+			Nonce:    bc.stateDB.GetNonce(addr),
+			CodeHash: bc.stateDB.GetCodeHash(addr),
+		}
+		if storage := c.storage[addr]; storage != nil {
+			account.StorageRoot = storage.Root()
+		}
+		tree = tree.Update(account)
+	}
+	c.add(block.Hash(), tree)
+	return nil
+}
+
+// stateKeyPrefixes are the prefixes of the database keys of account fields
+// the state root commits to
+var stateKeyPrefixes = []string{"balance-", "nonce-", "codehash-"}
+
+// parseStateKey returns the account of a state key and the slot of a storage
+// key, ok is false for a key the state root does not commit to
+func parseStateKey(key string) (addr types.Address, slot types.Hash, isStorage, ok bool) {
+	if strings.HasPrefix(key, "storage-") && len(key) == len("storage-")+types.AddressLength+types.HashLength {
+		key = key[len("storage-"):]
+		return types.BytesToAddress([]byte(key[:types.AddressLength])), types.BytesToHash([]byte(key[types.AddressLength:])), true, true
+	}
+	for _, prefix := range stateKeyPrefixes {
+		if strings.HasPrefix(key, prefix) && len(key) == len(prefix)+types.AddressLength {
+			return types.BytesToAddress([]byte(key[len(prefix):])), types.ZeroHash, false, true
+		}
+	}
+	return types.Address{}, types.ZeroHash, false, false
+}
+
+// storageTrees returns the storage trees of the contracts of the overlay
+func (o *StateOverlay) storageTrees() map[types.Address]*types.StorageTree {
+	trees := make(map[types.Address]*types.StorageTree)
+	o.scan("storage-", types.AddressLength+types.HashLength, func(key, value []byte) {
+		addr := types.BytesToAddress(key[len("storage-") : len("storage-")+types.AddressLength])
+		if trees[addr] == nil {
+			trees[addr] = types.NewStorageTree()
+		}
+		slot := types.BytesToHash(key[len("storage-")+types.AddressLength:])
+		trees[addr] = trees[addr].Update(slot, types.BytesToHash(value))
+	})
+	return trees
+}
+
+// accounts returns the accounts of the overlay with the roots of their
+// storage trees
+func (o *StateOverlay) accounts(storage map[types.Address]*types.StorageTree) []*types.StateAccount {
+	accounts := make(map[types.Address]*types.StateAccount)
+	account := func(addr types.Address) *types.StateAccount {
+		if accounts[addr] == nil {
+			accounts[addr] = &types.StateAccount{Address: addr, Balance: new(big.Int)}
+		}
+		return accounts[addr]
+	}
+	address := func(key []byte, prefix string) types.Address {
+		return types.BytesToAddress(key[len(prefix) : len(prefix)+types.AddressLength])
+	}
+
+	o.scan("balance-", types.AddressLength, func(key, value []byte) {
+		account(address(key, "balance-")).Balance.SetBytes(value)
+	})
+	o.scan("nonce-", types.AddressLength, func(key, value []byte) {
+		account(address(key, "nonce-")).Nonce = new(big.Int).SetBytes(value).Uint64()
+	})
+	o.scan("codehash-", types.AddressLength, func(key, value []byte) {
+		account(address(key, "codehash-")).CodeHash = types.BytesToHash(value)
+	})
+	for addr, tree := range storage {
+		account(addr).StorageRoot = tree.Root()
+	}
+
+	list := make([]*types.StateAccount, 0, len(accounts))
+	for _, account := range accounts {
+		list = append(list, account)
+	}
+	return list
+}
+
+// scan calls fn with the keys of a prefix followed by size bytes and their
+// values in the state of the overlay
+func (o *StateOverlay) scan(prefix string, size int, fn func(key, value []byte)) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	values := make(map[string][]byte)
+	iter := o.snapshot.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+	for iter.Next() {
+		values[string(iter.Key())] = append([]byte(nil), iter.Value()...)
+	}
+	iter.Release()
+
+	for key, entry := range o.history {
+		if strings.HasPrefix(key, prefix) {
+			if entry.Existed {
+				values[key] = entry.Value
+			} else {
+				delete(values, key)
+			}
+		}
+	}
+	if prefix == "storage-" {
+		for key := range values {
+			if len(key) >= len(prefix)+types.AddressLength && o.cleared[types.BytesToAddress([]byte(key[len(prefix):len(prefix)+types.AddressLength]))] {
+				delete(values, key)
+			}
+		}
+	}
+	for key, value := range o.dirty {
+		if strings.HasPrefix(key, prefix) {
+			values[key] = value
+		}
+	}
+
+	for key, value := range values {
+		if len(key) == len(prefix)+size {
+			fn([]byte(key), value)
+		}
+	}
+}
+
+// stateTreeCache keeps the state trees of the latest blocks and the storage
+// trees of the block it updated last
+type stateTreeCache struct {
+	mu      sync.Mutex
+	trees   map[types.Hash]*types.StateTree
+	order   []types.Hash
+	head    types.Hash // Block the storage trees are at
+	storage map[types.Address]*types.StorageTree
+}
+
+func newStateTreeCache() *stateTreeCache {
+	return &stateTreeCache{trees: make(map[types.Hash]*types.StateTree)}
+}
+
+func (c *stateTreeCache) get(hash types.Hash) (*types.StateTree, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tree, ok := c.trees[hash]
+	return tree, ok
+}
+
+// add keeps the tree of a block whose state the storage trees are at.
+// Callers must hold c.mu.
+func (c *stateTreeCache) add(hash types.Hash, tree *types.StateTree) {
+	if _, ok := c.trees[hash]; !ok {
+		c.order = append(c.order, hash)
+	}
+	c.trees[hash] = tree
+	c.head = hash
+	for len(c.order) > stateTreeCacheSize {
+		delete(c.trees, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// validateStateRoot checks that a block commits to the state its parent left,
+// which this node is at when the block is imported or voted for
+func (n *Node) validateStateRoot(block *types.Block) error {
+	head := n.blockchain.GetCurrentBlock()
+	if block.ParentHash() != head.Hash() {
+		return nil // Not on top of the head, the chain rejects it
+	}
+	root, err := n.blockchain.StateRoot(head.Number().Uint64())
+	if err != nil {
+		return fmt.Errorf("failed to calculate state root: %w", err)
+	}
+	if block.Header.Root != root {
+		return fmt.Errorf("invalid state root of block #%d: have %s, want %s",
+			block.Number(), block.Header.Root.Hex(), root.Hex())
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"quantum-blockchain/chain/evm"
+	"quantum-blockchain/chain/types"
+)
+
+// TxTraceResult is the trace of a single transaction within a block trace
+type TxTraceResult struct {
+	TxHash string          `json:"txHash"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// parentState returns an overlay of the state the given block was executed on
+func (bc *Blockchain) parentState(block *types.Block) (*StateOverlay, error) {
+	if block.Number().Sign() == 0 {
+		return nil, fmt.Errorf("genesis block has no parent state")
+	}
+	return bc.StateAt(block.Number().Uint64() - 1)
+}
+
+// TraceTransaction re-executes a transaction in the block that executed it
+// and returns the result of the named tracer
+func (bc *Blockchain) TraceTransaction(txHash types.Hash, tracerName string) (json.RawMessage, error) {
+	receipt, err := bc.GetTransactionReceipt(txHash)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := bc.GetBlockByHash(receipt.BlockHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load block of transaction: %w", err)
+	}
+
+	state, err := bc.parentState(block)
+	if err != nil {
+		return nil, err
+	}
+	defer state.Release()
+
+	txs, keys, err := bc.executedTransactions(block)
+	if err != nil {
+		return nil, err
+	}
+	executor := evm.NewSimpleEVM(state, big.NewInt(8888))
+	gasUsed := uint64(0)
+	for i, tx := range txs {
+		if !tx.Hash().Equal(txHash) {
+			// Replay preceding transactions untraced to reach the right state
+			replayed, err := bc.executeTransaction(state, executor, tx, keys[i], block, uint(i), gasUsed)
+			if err != nil {
+				return nil, fmt.Errorf("failed to replay transaction %s: %w", tx.Hash().Hex(), err)
+			}
+			gasUsed += replayed.GasUsed
+			continue
+		}
+
+		tracer, err := evm.NewTracer(tracerName)
+		if err != nil {
+			return nil, invalidParams("%v", err)
+		}
+		executor.SetTracer(tracer)
+		if _, err := bc.executeTransaction(state, executor, tx, keys[i], block, uint(i), gasUsed); err != nil {
+			return nil, fmt.Errorf("failed to trace transaction: %w", err)
+		}
+		return tracer.GetResult()
+	}
+
+	return nil, fmt.Errorf("transaction %s not found in block %s", txHash.Hex(), block.Hash().Hex())
+}
+
+// TraceBlock re-executes every transaction of a block on top of its parent
+// block state and returns the result of the named tracer for each of them
+func (bc *Blockchain) TraceBlock(block *types.Block, tracerName string) ([]*TxTraceResult, error) {
+	if _, err := evm.NewTracer(tracerName); err != nil {
+		return nil, invalidParams("%v", err)
+	}
+
+	state, err := bc.parentState(block)
+	if err != nil {
+		return nil, err
+	}
+	defer state.Release()
+
+	txs, keys, err := bc.executedTransactions(block)
+	if err != nil {
+		return nil, err
+	}
+	executor := evm.NewSimpleEVM(state, big.NewInt(8888))
+	results := make([]*TxTraceResult, 0, len(txs))
+	gasUsed := uint64(0)
+	for i, tx := range txs {
+		tracer, _ := evm.NewTracer(tracerName)
+		executor.SetTracer(tracer)
+
+		result := &TxTraceResult{TxHash: tx.Hash().Hex()}
+		receipt, err := bc.executeTransaction(state, executor, tx, keys[i], block, uint(i), gasUsed)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			gasUsed += receipt.GasUsed
+			if result.Result, err = tracer.GetResult(); err != nil {
+				result.Error = err.Error()
+			}
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
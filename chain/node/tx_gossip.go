@@ -0,0 +1,345 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"quantum-blockchain/chain/network"
+	"quantum-blockchain/chain/types"
+)
+
+const (
+	// maxTxAnnounce is the number of hashes a single announcement may carry
+	maxTxAnnounce = 4096
+
+	// maxTxRequest is the number of transactions requested at once
+	maxTxRequest = 256
+
+	// seenTxCacheSize is the number of transaction hashes remembered to drop
+	// transactions received again
+	seenTxCacheSize = 65536
+
+	// peerKnownTxs is the number of hashes remembered per peer as known to it
+	peerKnownTxs = 8192
+
+	// txFetchTimeout is how long an announced hash waits for its transaction
+	// before another announcement of it is requested
+	txFetchTimeout = 5 * time.Second
+)
+
+// NewPooledTransactionHashesData announces transactions by hash
+type NewPooledTransactionHashesData struct {
+	Hashes []types.Hash `json:"hashes"`
+}
+
+// GetPooledTransactionsData requests announced transactions
+type GetPooledTransactionsData struct {
+	RequestID uint64       `json:"requestId"`
+	Hashes    []types.Hash `json:"hashes"`
+}
+
+// PooledTransactionsData answers a GetPooledTransactions request with the
+// requested transactions still in the pool
+type PooledTransactionsData struct {
+	RequestID    uint64                      `json:"requestId"`
+	Transactions []*types.QuantumTransaction `json:"transactions"`
+}
+
+// TxGossipStats counts the transaction gossip of the network
+type TxGossipStats struct {
+	Sent       uint64 `json:"sent"`       // Transactions pushed to peers in full
+	Announced  uint64 `json:"announced"`  // Hashes announced to peers
+	Requested  uint64 `json:"requested"`  // Announced hashes requested from peers
+	Fetched    uint64 `json:"fetched"`    // Requested transactions received
+	Duplicates uint64 `json:"duplicates"` // Transactions received again
+}
+
+// txGossip propagates transactions by pushing them in full to the square
+// root of the peers and announcing their hashes to the others, which fetch
+// the ones they do not know
+type txGossip struct {
+	seen   *hashCache
+	source func(types.Hash) *types.QuantumTransaction
+
+	mu            sync.Mutex
+	inflight      map[types.Hash]time.Time // Requested hashes
+	requests      map[uint64]*txRequest
+	nextRequestID uint64
+
+	sent, announced, requested, fetched, duplicates atomic.Uint64
+}
+
+type txRequest struct {
+	peerID string
+	hashes map[types.Hash]bool
+	sent   time.Time
+}
+
+func newTxGossip() *txGossip {
+	return &txGossip{
+		seen:     newHashCache(seenTxCacheSize),
+		inflight: make(map[types.Hash]time.Time),
+		requests: make(map[uint64]*txRequest),
+	}
+}
+
+// SetTransactionSource sets the lookup of pooled transactions served to
+// peers fetching announced hashes
+func (p2p *P2PNetwork) SetTransactionSource(source func(types.Hash) *types.QuantumTransaction) {
+	p2p.gossip.source = source
+}
+
+// TxGossipStats returns the counters of the transaction gossip
+func (p2p *P2PNetwork) TxGossipStats() *TxGossipStats {
+	g := p2p.gossip
+	return &TxGossipStats{
+		Sent:       g.sent.Load(),
+		Announced:  g.announced.Load(),
+		Requested:  g.requested.Load(),
+		Fetched:    g.fetched.Load(),
+		Duplicates: g.duplicates.Load(),
+	}
+}
+
+// BroadcastTransaction propagates a local transaction to the peers
+func (p2p *P2PNetwork) BroadcastTransaction(tx *types.QuantumTransaction) {
+	p2p.gossip.seen.Add(tx.Hash())
+	p2p.propagateTransaction(tx, "")
+}
+
+// propagateTransaction sends a transaction in full to the square root of the
+// peers not known to have it and announces its hash to the rest, skipping
+// the peer it came from
+func (p2p *P2PNetwork) propagateTransaction(tx *types.QuantumTransaction, from string) {
+	hash := tx.Hash()
+
+	p2p.mu.RLock()
+	total := len(p2p.peers)
+	peers := make([]*Peer, 0, total)
+	for id, peer := range p2p.peers {
+		if id != from && !peer.knownTxs.Contains(hash) {
+			peers = append(peers, peer)
+		}
+	}
+	p2p.mu.RUnlock()
+	if len(peers) == 0 {
+		return
+	}
+
+	full := p2p.newMessage(MsgTypeTransaction, tx)
+	announcement := p2p.newMessage(MsgTypeNewPooledTransactionHashes, &NewPooledTransactionHashesData{Hashes: []types.Hash{hash}})
+
+	direct := int(math.Ceil(math.Sqrt(float64(total))))
+	rand.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+	for i, peer := range peers {
+		peer.knownTxs.Add(hash)
+		msg := announcement
+		if i < direct {
+			msg = full
+			p2p.gossip.sent.Add(1)
+		} else {
+			p2p.gossip.announced.Add(1)
+		}
+		go func(p *Peer, msg *P2PMessage) {
+			if err := p.SendMessage(msg); err != nil {
+				log.Printf("Failed to send transaction to peer %s: %v", p.ID, err)
+			}
+		}(peer, msg)
+	}
+}
+
+// receiveTransaction hands a transaction from a peer to the transaction
+// handler once, and propagates it further when the handler accepts it
+func (p2p *P2PNetwork) receiveTransaction(peer *Peer, tx *types.QuantumTransaction) error {
+	hash := tx.Hash()
+	peer.knownTxs.Add(hash)
+
+	g := p2p.gossip
+	g.mu.Lock()
+	delete(g.inflight, hash)
+	g.mu.Unlock()
+
+	if !g.seen.Add(hash) {
+		g.duplicates.Add(1)
+		return nil
+	}
+
+	if p2p.onTransaction != nil {
+		if err := p2p.onTransaction(tx); err != nil {
+			return err
+		}
+		p2p.scorer.Record(peer.ID, network.ScoreUsefulTransaction)
+	}
+	p2p.propagateTransaction(tx, peer.ID)
+	return nil
+}
+
+func (p2p *P2PNetwork) handleNewPooledTransactionHashes(peer *Peer, data json.RawMessage) error {
+	var announcement NewPooledTransactionHashesData
+	if err := json.Unmarshal(data, &announcement); err != nil {
+		return fmt.Errorf("%w: failed to unmarshal transaction announcement: %v", network.ErrInvalidMessage, err)
+	}
+	if len(announcement.Hashes) > maxTxAnnounce {
+		return fmt.Errorf("%w: announcement of %d transactions", network.ErrInvalidMessage, len(announcement.Hashes))
+	}
+
+	// Request the hashes neither seen nor already requested from another peer
+	g := p2p.gossip
+	now := time.Now()
+	var unknown []types.Hash
+	g.mu.Lock()
+	g.expireRequests(now)
+	for _, hash := range announcement.Hashes {
+		peer.knownTxs.Add(hash)
+		if g.seen.Contains(hash) {
+			continue
+		}
+		if _, requested := g.inflight[hash]; requested {
+			continue
+		}
+		g.inflight[hash] = now
+		unknown = append(unknown, hash)
+	}
+
+	var requests []*GetPooledTransactionsData
+	for start := 0; start < len(unknown); start += maxTxRequest {
+		hashes := unknown[start:min(start+maxTxRequest, len(unknown))]
+		g.nextRequestID++
+		request := &txRequest{peerID: peer.ID, hashes: make(map[types.Hash]bool, len(hashes)), sent: now}
+		for _, hash := range hashes {
+			request.hashes[hash] = true
+		}
+		g.requests[g.nextRequestID] = request
+		requests = append(requests, &GetPooledTransactionsData{RequestID: g.nextRequestID, Hashes: hashes})
+	}
+	g.mu.Unlock()
+
+	for _, request := range requests {
+		g.requested.Add(uint64(len(request.Hashes)))
+		if err := peer.SendMessage(p2p.newRequest(MsgTypeGetPooledTransactions, request.RequestID, request)); err != nil {
+			log.Printf("Failed to request transactions from peer %s: %v", peer.ID, err)
+		}
+	}
+	return nil
+}
+
+func (p2p *P2PNetwork) handleGetPooledTransactions(peer *Peer, data json.RawMessage) error {
+	var request GetPooledTransactionsData
+	if err := json.Unmarshal(data, &request); err != nil {
+		return fmt.Errorf("%w: failed to unmarshal transaction request: %v", network.ErrInvalidMessage, err)
+	}
+	if len(request.Hashes) > maxTxRequest {
+		return fmt.Errorf("%w: request of %d transactions", network.ErrInvalidMessage, len(request.Hashes))
+	}
+
+	response := &PooledTransactionsData{RequestID: request.RequestID, Transactions: []*types.QuantumTransaction{}}
+	if source := p2p.gossip.source; source != nil {
+		for _, hash := range request.Hashes {
+			if tx := source(hash); tx != nil {
+				peer.knownTxs.Add(hash)
+				response.Transactions = append(response.Transactions, tx)
+			}
+		}
+	}
+	if err := peer.SendMessage(p2p.newRequest(MsgTypePooledTransactions, response.RequestID, response)); err != nil {
+		log.Printf("Failed to send transactions to peer %s: %v", peer.ID, err)
+	}
+	return nil
+}
+
+func (p2p *P2PNetwork) handlePooledTransactions(peer *Peer, data json.RawMessage) error {
+	var response PooledTransactionsData
+	if err := json.Unmarshal(data, &response); err != nil {
+		return fmt.Errorf("%w: failed to unmarshal pooled transactions: %v", network.ErrInvalidMessage, err)
+	}
+
+	g := p2p.gossip
+	g.mu.Lock()
+	request, ok := g.requests[response.RequestID]
+	if ok && request.peerID == peer.ID {
+		delete(g.requests, response.RequestID)
+		// Hashes left unanswered may be fetched from another peer
+		for hash := range request.hashes {
+			delete(g.inflight, hash)
+		}
+	}
+	g.mu.Unlock()
+	if !ok || request.peerID != peer.ID {
+		return fmt.Errorf("response to unknown transaction request %d", response.RequestID)
+	}
+
+	var failed error
+	for _, tx := range response.Transactions {
+		if tx == nil || !request.hashes[tx.Hash()] {
+			return fmt.Errorf("%w: unrequested transaction in response", network.ErrInvalidMessage)
+		}
+		delete(request.hashes, tx.Hash())
+		g.fetched.Add(1)
+		if err := p2p.receiveTransaction(peer, tx); err != nil && failed == nil {
+			failed = err
+		}
+	}
+	return failed
+}
+
+// expireRequests forgets requests that timed out, the caller holds the lock
+func (g *txGossip) expireRequests(now time.Time) {
+	for id, request := range g.requests {
+		if now.Sub(request.sent) < txFetchTimeout {
+			continue
+		}
+		delete(g.requests, id)
+		for hash := range request.hashes {
+			delete(g.inflight, hash)
+		}
+	}
+}
+
+// hashCache is a set of hashes bounded in size, forgetting the oldest first
+type hashCache struct {
+	mu    sync.Mutex
+	set   map[types.Hash]struct{}
+	order []types.Hash
+	next  int
+}
+
+func newHashCache(size int) *hashCache {
+	return &hashCache{
+		set:   make(map[types.Hash]struct{}, size),
+		order: make([]types.Hash, 0, size),
+	}
+}
+
+// Add inserts a hash and reports whether it was new
+func (c *hashCache) Add(hash types.Hash) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.set[hash]; ok {
+		return false
+	}
+	if len(c.order) < cap(c.order) {
+		c.order = append(c.order, hash)
+	} else {
+		delete(c.set, c.order[c.next])
+		c.order[c.next] = hash
+		c.next = (c.next + 1) % len(c.order)
+	}
+	c.set[hash] = struct{}{}
+	return true
+}
+
+// Contains reports whether the hash is in the cache
+func (c *hashCache) Contains(hash types.Hash) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.set[hash]
+	return ok
+}
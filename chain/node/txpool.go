@@ -2,11 +2,14 @@ package node
 
 import (
 	"errors"
+	"fmt"
 	"math/big"
 	"sort"
 	"sync"
 	"time"
 
+	"quantum-blockchain/chain/evm"
+	"quantum-blockchain/chain/network"
 	"quantum-blockchain/chain/types"
 )
 
@@ -15,6 +18,8 @@ type TxPool struct {
 	transactions map[types.Hash]*types.QuantumTransaction
 	byNonce      map[types.Address][]*types.QuantumTransaction
 	maxSize      int
+	balanceOf    func(types.Address) *big.Int        // Current account balances, nil skips balance checks
+	keyOf        func(types.Address) *evm.KeyBinding // Current key bindings, nil treats every key as never rotated
 	mu           sync.RWMutex
 }
 
@@ -27,6 +32,24 @@ func NewTxPool(maxSize int) *TxPool {
 	}
 }
 
+// SetBalanceSource sets where the pool reads account balances from when
+// validating transactions
+func (pool *TxPool) SetBalanceSource(balanceOf func(types.Address) *big.Int) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.balanceOf = balanceOf
+}
+
+// SetKeySource sets where the pool reads the key bindings of rotated accounts
+// from when validating transactions
+func (pool *TxPool) SetKeySource(keyOf func(types.Address) *evm.KeyBinding) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.keyOf = keyOf
+}
+
 // AddTransaction adds a transaction to the pool
 func (pool *TxPool) AddTransaction(tx *types.QuantumTransaction) error {
 	pool.mu.Lock()
@@ -152,6 +175,26 @@ func (pool *TxPool) GetNextNonceForAddress(addr types.Address) uint64 {
 	return highestNonce + 1
 }
 
+// GetPendingNonce returns the nonce an address will have once its pooled
+// transactions are mined. Only transactions that continue the state nonce
+// without gaps are counted.
+func (pool *TxPool) GetPendingNonce(addr types.Address, stateNonce uint64) uint64 {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	nonce := stateNonce
+	for _, tx := range pool.byNonce[addr] {
+		if tx.GetNonce() < nonce {
+			continue
+		}
+		if tx.GetNonce() != nonce {
+			break
+		}
+		nonce++
+	}
+	return nonce
+}
+
 // Size returns the number of transactions in the pool
 func (pool *TxPool) Size() int {
 	pool.mu.RLock()
@@ -171,18 +214,17 @@ func (pool *TxPool) Clear() {
 
 // ValidateTransaction validates a transaction before adding to pool
 func (pool *TxPool) ValidateTransaction(tx *types.QuantumTransaction) error {
-	// Verify signature
+	// Verify signature, and the fee payer signature of sponsored transactions
 	valid, err := tx.VerifySignature()
 	if err != nil {
-		return err
+		return &signatureError{err}
 	}
 	if !valid {
-		return errors.New("invalid signature")
+		return network.ErrInvalidSignature
 	}
 
-	// Check transaction size
-	if tx.Size() > 32*1024 { // Max 32KB transaction
-		return errors.New("transaction too large")
+	if err := checkTransactionLimits(tx); err != nil {
+		return err
 	}
 
 	// Check gas limit
@@ -195,6 +237,73 @@ func (pool *TxPool) ValidateTransaction(tx *types.QuantumTransaction) error {
 		return errors.New("gas price too low")
 	}
 
+	if err := pool.ValidateSenderKey(tx); err != nil {
+		return err
+	}
+	return pool.ValidateBalances(tx)
+}
+
+// signatureError keeps the message of a malformed signature while matching
+// network.ErrInvalidSignature, which penalizes the peer relaying it
+type signatureError struct {
+	err error
+}
+
+func (e *signatureError) Error() string {
+	return e.err.Error()
+}
+
+func (e *signatureError) Unwrap() []error {
+	return []error{network.ErrInvalidSignature, e.err}
+}
+
+// ValidateSenderKey checks that a transaction is signed by the keys currently
+// bound to its sender and, if sponsored, to its fee payer
+func (pool *TxPool) ValidateSenderKey(tx *types.QuantumTransaction) error {
+	pool.mu.RLock()
+	keyOf := pool.keyOf
+	pool.mu.RUnlock()
+
+	if keyOf == nil {
+		keyOf = func(types.Address) *evm.KeyBinding { return nil }
+	}
+	return evm.CheckSigningKeys(tx, keyOf)
+}
+
+// ValidateBalances checks that the gas payer of a transaction can pay for gas
+// and its sender for the transferred value
+func (pool *TxPool) ValidateBalances(tx *types.QuantumTransaction) error {
+	pool.mu.RLock()
+	balanceOf := pool.balanceOf
+	pool.mu.RUnlock()
+
+	if balanceOf == nil {
+		return nil
+	}
+	return tx.CheckBalances(balanceOf)
+}
+
+// checkTransactionLimits checks that a transaction fits the size and batch
+// caps and provides at least its intrinsic gas
+func checkTransactionLimits(tx *types.QuantumTransaction) error {
+	if err := tx.ValidateBatch(); err != nil {
+		return err
+	}
+	if err := tx.ValidateKeyRotation(); err != nil {
+		return err
+	}
+	if err := tx.ValidateEncrypted(); err != nil {
+		return err
+	}
+	if err := tx.ValidateUnjail(); err != nil {
+		return err
+	}
+	if tx.Size() > types.MaxTransactionSize {
+		return fmt.Errorf("transaction too large: %d bytes, limit %d", tx.Size(), types.MaxTransactionSize)
+	}
+	if intrinsic := evm.TransactionIntrinsicGas(tx); tx.GetGas() < intrinsic {
+		return fmt.Errorf("intrinsic gas too low: have %d, want %d", tx.GetGas(), intrinsic)
+	}
 	return nil
 }
 
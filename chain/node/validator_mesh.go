@@ -0,0 +1,602 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"quantum-blockchain/chain/config"
+	"quantum-blockchain/chain/consensus"
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/network"
+	"quantum-blockchain/chain/types"
+)
+
+const (
+	// syncInterval is the least time between two block requests
+	syncInterval = 2 * time.Second
+
+	// syncTimeout is how long a validator waits for a block before it asks
+	// the other validators for the blocks it missed
+	syncTimeout = 3 * syncInterval
+)
+
+// consensusBlockReward is minted to the proposer of every committed block
+var consensusBlockReward = big.NewInt(1000000000000000000) // 1 QTM
+
+// validatorTransport carries the proposals, votes, blocks, encryption keys
+// and key shares between the validators. The enhanced P2P network implements it, the simulator replaces
+// it with an in-memory network.
+type validatorTransport interface {
+	BroadcastProposal(block *types.Block) error
+	BroadcastConsensusMessage(msg *network.ConsensusMessage) error
+	BroadcastBlock(block *types.Block) error
+	BroadcastEvidence(ev *consensus.Evidence) error
+	BroadcastEncryptionKey(key *network.EncryptionKeyData) error
+	BroadcastDecryptionShares(shares *network.DecryptionSharesData) error
+	RequestBlocks(validator types.Address, from uint64) error
+	SetProposalHandler(handler func(*types.Block) error)
+	SetConsensusHandler(handler func(*network.ConsensusMessage) error)
+	SetBlockHandler(handler func(*types.Block) error)
+	SetEvidenceHandler(handler func(*consensus.Evidence) error)
+	SetEncryptionKeyHandler(handler func(*network.EncryptionKeyData) error)
+	SetDecryptionSharesHandler(handler func(*network.DecryptionSharesData) error)
+	SetBlockSource(source func(uint64) *types.Block)
+}
+
+// proposalPool holds the blocks proposed to the validators until a quorum of
+// them votes for one, and the block this validator voted for in each round
+// at each height
+type proposalPool struct {
+	mu     sync.Mutex
+	blocks map[types.Hash]*types.Block
+	voted  map[uint64]map[uint64]types.Hash // Block voted for by height and round
+}
+
+func newProposalPool() *proposalPool {
+	return &proposalPool{
+		blocks: make(map[types.Hash]*types.Block),
+		voted:  make(map[uint64]map[uint64]types.Hash),
+	}
+}
+
+// hasVoted reports whether this validator voted in the round at the height
+func (p *proposalPool) hasVoted(height, round uint64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, ok := p.voted[height][round]
+	return ok
+}
+
+// lastVote returns the block this validator voted for in its latest round at
+// the height
+func (p *proposalPool) lastVote(height uint64) (*types.Block, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var block *types.Block
+	latest, found := uint64(0), false
+	for round, hash := range p.voted[height] {
+		if !found || round > latest {
+			latest, found = round, true
+			block = p.blocks[hash]
+		}
+	}
+	return block, block != nil
+}
+
+// add stores a proposal and reports whether this validator should vote for
+// it, which it does for the first proposal it sees in a round unless it voted
+// in a later round. A validator only reaches a later round once a quorum of
+// the validators voted to move on, which releases its vote of the rounds
+// before, see advanceRound.
+func (p *proposalPool) add(block *types.Block) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	hash := block.Hash()
+	if _, ok := p.blocks[hash]; ok {
+		return false
+	}
+	p.blocks[hash] = block
+
+	height, round := block.Number().Uint64(), block.Header.Round
+	for voted := range p.voted[height] {
+		if voted >= round {
+			return false
+		}
+	}
+	if p.voted[height] == nil {
+		p.voted[height] = make(map[uint64]types.Hash)
+	}
+	p.voted[height][round] = hash
+	return true
+}
+
+// contains reports whether the block is a pending proposal
+func (p *proposalPool) contains(hash types.Hash) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, ok := p.blocks[hash]
+	return ok
+}
+
+// conflicting returns another pending proposal signed by the proposer of the
+// block in its round at its height, nil if there is none
+func (p *proposalPool) conflicting(block *types.Block) *types.Block {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	hash := block.Hash()
+	for other, proposal := range p.blocks {
+		if other != hash && proposal.Number().Cmp(block.Number()) == 0 &&
+			proposal.Header.Round == block.Header.Round && proposal.Header.ValidatorAddr == block.Header.ValidatorAddr {
+			return proposal
+		}
+	}
+	return nil
+}
+
+// prune forgets the proposals and votes up to the committed height
+func (p *proposalPool) prune(height uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for hash, block := range p.blocks {
+		if block.Number().Uint64() <= height {
+			delete(p.blocks, hash)
+		}
+	}
+	for h := range p.voted {
+		if h <= height {
+			delete(p.voted, h)
+		}
+	}
+}
+
+// registerGenesisValidators registers the genesis validators announcing
+// their public key, except this node which registers itself, and returns the
+// genesis validators by address
+func (n *Node) registerGenesisValidators() (map[types.Address]*config.ValidatorInfo, error) {
+	validators, err := n.blockchain.genesisConfig.GetValidators()
+	if err != nil {
+		return nil, err
+	}
+
+	byAddr := make(map[types.Address]*config.ValidatorInfo, len(validators))
+	for i := range validators {
+		validator := &validators[i]
+		byAddr[validator.Address] = validator
+		if validator.PublicKey == nil || (n.validatorPrivKey != nil && validator.Address == n.validatorAddr) {
+			continue
+		}
+
+		err := n.multiConsensus.RegisterValidator(
+			validator.Address,
+			validator.PublicKey,
+			validator.Stake,
+			crypto.SigAlgDilithium,
+			0.05, // 5% commission
+		)
+		if err != nil {
+			return nil, fmt.Errorf("validator %s: %w", validator.Address.Hex(), err)
+		}
+		log.Printf("🏛️ Registered genesis validator %s", validator.Address.Hex())
+	}
+	return byAddr, nil
+}
+
+// attachValidatorTransport routes the proposals, votes and blocks of the
+// validators through a transport
+func (n *Node) attachValidatorTransport(transport validatorTransport) {
+	n.mesh = transport
+	transport.SetProposalHandler(n.handleProposal)
+	transport.SetConsensusHandler(n.handleVote)
+	transport.SetBlockHandler(n.handlePeerBlock)
+	transport.SetEvidenceHandler(n.handleEvidence)
+	transport.SetEncryptionKeyHandler(n.handleEncryptionKey)
+	transport.SetDecryptionSharesHandler(n.handleDecryptionShares)
+	transport.SetBlockSource(func(number uint64) *types.Block {
+		block, err := n.blockchain.GetBlockByNumber(new(big.Int).SetUint64(number))
+		if err != nil {
+			return nil
+		}
+		return block
+	})
+}
+
+// consensusStep runs at every block interval: it resends the pending
+// proposal and vote of this validator and its key shares for the head, which
+// may have been lost, announces its encryption keys, catches up when no block
+// was imported for a while, votes to move on to the next round when the
+// proposer of the current one timed out and proposes the next block when it
+// is this validator's turn
+func (n *Node) consensusStep() {
+	n.resendPendingVote()
+	n.releaseDecryptionShares(n.blockchain.GetCurrentBlock())
+	n.announceEncryptionKeys()
+	if n.now().Sub(n.lastImport()) > syncTimeout {
+		n.requestSync(types.Address{})
+	}
+	n.timeoutRound()
+	n.produceConsensusBlock()
+}
+
+// resendPendingVote sends the vote of this validator in its latest round at
+// the next height again, along with the proposal it voted for. Relaying
+// proposals of others lets the validators that missed a proposal of an
+// offline proposer vote for it too.
+func (n *Node) resendPendingVote() {
+	if n.mesh == nil {
+		return
+	}
+	height := n.blockchain.GetCurrentBlock().Number().Uint64() + 1
+
+	block, ok := n.proposals.lastVote(height)
+	if !ok {
+		return
+	}
+	vote, voted := n.multiConsensus.GetVote(height, block.Header.Round, n.validatorAddr)
+	if !voted {
+		return
+	}
+
+	if err := n.mesh.BroadcastProposal(block); err != nil {
+		log.Printf("Failed to resend proposal: %v", err)
+	}
+	n.broadcastVote(vote)
+}
+
+// requestSync asks a validator for the blocks following the head, at most
+// once per sync interval. Without a validator known to be ahead, the
+// validators are asked in turn.
+func (n *Node) requestSync(validator types.Address) {
+	if n.mesh == nil {
+		return
+	}
+
+	n.syncMu.Lock()
+	now := n.now()
+	if now.Sub(n.lastSync) < syncInterval {
+		n.syncMu.Unlock()
+		return
+	}
+	n.lastSync = now
+	if validator.IsZero() {
+		validators := n.multiConsensus.GetValidatorSet()
+		for range validators {
+			n.syncTurn++
+			candidate := validators[n.syncTurn%len(validators)].Address
+			if candidate != n.validatorAddr {
+				validator = candidate
+				break
+			}
+		}
+	}
+	n.syncMu.Unlock()
+	if validator.IsZero() {
+		return
+	}
+
+	from := n.blockchain.GetCurrentBlock().Number().Uint64() + 1
+	if err := n.mesh.RequestBlocks(validator, from); err != nil {
+		log.Printf("Failed to request blocks from #%d: %v", from, err)
+	}
+}
+
+// lastImport returns when the node last imported a block
+func (n *Node) lastImport() time.Time {
+	n.syncMu.Lock()
+	defer n.syncMu.Unlock()
+
+	return n.importedAt
+}
+
+// proposeBlock votes for a block this validator proposes and sends both to
+// the other validators
+func (n *Node) proposeBlock(block *types.Block) {
+	if !n.proposals.add(block) {
+		return
+	}
+	log.Printf("📤 Proposed block #%d %s", block.Number(), block.Hash().Hex())
+
+	if n.mesh != nil {
+		if err := n.mesh.BroadcastProposal(block); err != nil && len(n.multiConsensus.GetValidatorSet()) > 1 {
+			log.Printf("Failed to send proposal: %v", err)
+		}
+	}
+	n.voteForBlock(block)
+}
+
+// voteForBlock signs a commit vote for a block in the round it was proposed
+// in, sends it to the other validators and commits the block if the vote
+// completes a quorum
+func (n *Node) voteForBlock(block *types.Block) {
+	vote, err := n.multiConsensus.SubmitConsensusVote(
+		n.validatorAddr,
+		block.Hash(),
+		block.Number().Uint64(),
+		block.Header.Round,
+		consensus.VoteCommit,
+		n.validatorPrivKey,
+	)
+	if err != nil {
+		log.Printf("Failed to vote for block #%d: %v", block.Number(), err)
+		return
+	}
+
+	n.broadcastVote(vote)
+	n.tryCommit(block.Hash(), block.Number().Uint64())
+}
+
+// broadcastVote sends a vote of this validator to the other validators
+func (n *Node) broadcastVote(vote *consensus.ConsensusVote) {
+	if n.mesh == nil {
+		return
+	}
+	err := n.mesh.BroadcastConsensusMessage(&network.ConsensusMessage{
+		Type:         vote.VoteType,
+		BlockHash:    vote.BlockHash,
+		BlockHeight:  vote.BlockHeight,
+		Round:        vote.Round,
+		Validator:    vote.Validator,
+		Signature:    vote.Signature,
+		PublicKey:    vote.PublicKey,
+		Timestamp:    vote.Timestamp,
+		SigAlgorithm: vote.SigAlgorithm,
+	})
+	if err != nil && len(n.multiConsensus.GetValidatorSet()) > 1 {
+		log.Printf("Failed to send vote: %v", err)
+	}
+}
+
+// handleProposal votes for a block proposed by the expected proposer of its
+// round on top of the head, for a round this validator reached. A forged
+// signature or a block not matching its header is the fault of the peer, a
+// proposal for another head or a later round is not.
+func (n *Node) handleProposal(block *types.Block) error {
+	hash := block.Hash()
+	if n.proposals.contains(hash) {
+		return fmt.Errorf("proposal %s already known", hash.Hex())
+	}
+	if _, err := n.blockchain.GetBlockByHash(hash); err == nil {
+		return fmt.Errorf("proposal %s already committed", hash.Hex())
+	}
+
+	header := block.Header
+	valid, err := header.VerifyValidatorSignature()
+	if err != nil || !valid {
+		return fmt.Errorf("%w: proposal #%d is not signed by its validator", network.ErrInvalidSignature, block.Number())
+	}
+	if types.PublicKeyToAddress(header.ValidatorSig.PublicKey) != header.ValidatorAddr {
+		return fmt.Errorf("%w: proposal #%d is signed by another key than its validator's", network.ErrInvalidSignature, block.Number())
+	}
+	n.reportConflictingProposal(block)
+
+	head := n.blockchain.GetCurrentBlock()
+	if block.Number().Uint64() > head.Number().Uint64()+1 {
+		n.requestSync(header.ValidatorAddr)
+	}
+	if block.Number().Uint64() != head.Number().Uint64()+1 || header.ParentHash != head.Hash() {
+		return fmt.Errorf("proposal #%d does not extend head #%d", block.Number(), head.Number())
+	}
+	if round, _ := n.currentRound(block.Number().Uint64()); header.Round > round {
+		return fmt.Errorf("proposal #%d is for round %d, this validator is in round %d", block.Number(), header.Round, round)
+	}
+	proposer, err := n.multiConsensus.GetProposer(block.Number().Uint64(), header.Round)
+	if err != nil || proposer != header.ValidatorAddr {
+		return fmt.Errorf("proposal #%d by %s who is not the proposer of round %d", block.Number(), header.ValidatorAddr.Hex(), header.Round)
+	}
+	if block.Time() > uint64(n.now().Add(maxClockDrift).Unix()) {
+		return fmt.Errorf("proposal #%d is timestamped ahead of the clock", block.Number())
+	}
+	if err := n.validateRoundTime(block, head); err != nil {
+		return fmt.Errorf("%w: %v", network.ErrInvalidBlock, err)
+	}
+	if block.TxRoot() != header.TxHash {
+		return fmt.Errorf("%w: transactions of proposal #%d do not match its header", network.ErrInvalidBlock, block.Number())
+	}
+	if err := n.blockchain.ValidateBlock(block); err != nil {
+		// The head may have moved on while the proposal was checked
+		if n.blockchain.GetCurrentBlock().Number().Cmp(block.Number()) >= 0 {
+			return fmt.Errorf("proposal #%d is outdated: %v", block.Number(), err)
+		}
+		return fmt.Errorf("%w: %v", network.ErrInvalidBlock, err)
+	}
+	if err := n.validateValidatorsHash(block); err != nil {
+		return fmt.Errorf("%w: %v", network.ErrInvalidBlock, err)
+	}
+	if err := n.validateStateRoot(block); err != nil {
+		return fmt.Errorf("%w: %v", network.ErrInvalidBlock, err)
+	}
+	if err := n.validateBlockEvidence(block); err != nil {
+		return fmt.Errorf("%w: %v", network.ErrInvalidBlock, err)
+	}
+	if _, err := n.verifyLastCommit(block); err != nil {
+		return fmt.Errorf("%w: %v", network.ErrInvalidBlock, err)
+	}
+
+	if n.proposals.add(block) && n.validatorPrivKey != nil {
+		n.voteForBlock(block)
+		return nil
+	}
+	n.tryCommit(hash, block.Number().Uint64())
+	return nil
+}
+
+// handleVote records a commit vote of another validator and commits the
+// block it votes for once a quorum is reached. Votes beyond the next height
+// show that the validator is ahead.
+func (n *Node) handleVote(msg *network.ConsensusMessage) error {
+	if msg.Type == consensus.VoteRoundChange {
+		return n.handleRoundChange(msg)
+	}
+	if msg.Type != consensus.VoteCommit {
+		return nil
+	}
+
+	vote := &consensus.ConsensusVote{
+		Validator:    msg.Validator,
+		BlockHash:    msg.BlockHash,
+		BlockHeight:  msg.BlockHeight,
+		Round:        msg.Round,
+		VoteType:     msg.Type,
+		Timestamp:    msg.Timestamp,
+		Signature:    msg.Signature,
+		PublicKey:    msg.PublicKey,
+		SigAlgorithm: msg.SigAlgorithm,
+	}
+	err := n.multiConsensus.AddVote(vote)
+	if errors.Is(err, consensus.ErrInvalidVote) {
+		return fmt.Errorf("%w: %v", network.ErrInvalidSignature, err)
+	}
+	if errors.Is(err, consensus.ErrConflictingVote) {
+		return n.reportConflictingVote(vote)
+	}
+	if err != nil {
+		return err
+	}
+
+	if msg.BlockHeight > n.blockchain.GetCurrentBlock().Number().Uint64()+1 {
+		n.requestSync(msg.Validator)
+	}
+	n.tryCommit(msg.BlockHash, msg.BlockHeight)
+	return nil
+}
+
+// tryCommit commits a proposed block once a quorum of the validators voted
+// for it in its round. The proposal leaves the pool, so a block is committed
+// once.
+func (n *Node) tryCommit(hash types.Hash, height uint64) {
+	n.proposals.mu.Lock()
+	block, ok := n.proposals.blocks[hash]
+	if !ok {
+		n.proposals.mu.Unlock()
+		return
+	}
+	votes, quorum := n.multiConsensus.QuorumVotes(height, block.Header.Round, hash)
+	if !quorum {
+		n.proposals.mu.Unlock()
+		return
+	}
+	delete(n.proposals.blocks, hash)
+	n.proposals.mu.Unlock()
+
+	n.commitBlock(block, len(votes))
+}
+
+// commitBlock imports a block a quorum of the validators voted for, unless
+// it was imported from a peer already
+func (n *Node) commitBlock(block *types.Block, votes int) {
+	if _, err := n.blockchain.GetBlockByHash(block.Hash()); err != nil {
+		if err := n.importBlock(block); err != nil {
+			log.Printf("Failed to add block #%d: %v", block.Number(), err)
+			return
+		}
+	}
+
+	proposer := block.Header.ValidatorAddr
+	log.Printf("🏛️ Multi-validator block #%d: %d tx, %d votes, proposer: %s",
+		block.Number(), len(block.Transactions), votes, proposer.Hex()[:10]+"...")
+
+	// Validators that missed the proposal receive the block over the mesh,
+	// other nodes over the public network
+	if n.mesh != nil && proposer == n.validatorAddr {
+		if err := n.mesh.BroadcastBlock(block); err != nil {
+			log.Printf("Failed to send block to validators: %v", err)
+		}
+	}
+	n.p2p.BroadcastBlock(block)
+}
+
+// settleBlockFees returns the tips the transactions of a block paid for the
+// gas they used, and records the base fees they burned in the token supply
+func (n *Node) settleBlockFees(block *types.Block) *big.Int {
+	fees := big.NewInt(0)
+	receipts, err := n.blockchain.getReceiptsByBlockHash(block.Hash())
+	if err != nil {
+		return fees
+	}
+
+	burned := big.NewInt(0)
+	baseFee := block.BaseFee()
+	for _, receipt := range receipts {
+		if receipt.EffectiveGasPrice == nil {
+			continue
+		}
+		gasUsed := new(big.Int).SetUint64(receipt.GasUsed)
+		tip := new(big.Int).Set(receipt.EffectiveGasPrice)
+		if baseFee != nil {
+			tip.Sub(tip, baseFee)
+			burned.Add(burned, new(big.Int).Mul(baseFee, gasUsed))
+		}
+		fees.Add(fees, tip.Mul(tip, gasUsed))
+	}
+
+	if burned.Sign() > 0 {
+		n.tokenSupply.RecordBurn(burned)
+		n.tokenomics.RecordBaseFeeBurn(burned)
+	}
+	return fees
+}
+
+// importBlock adds a committed block to the chain, mints the reward of its
+// proposer, tracks the liveness of the validators, punishes the double
+// signing it proves, unjails validators and begins the next epoch after its
+// last block, which every node does alike
+func (n *Node) importBlock(block *types.Block) error {
+	if err := n.validateValidatorsHash(block); err != nil {
+		return err
+	}
+	if err := n.validateBlockEvidence(block); err != nil {
+		return err
+	}
+	signers, err := n.verifyLastCommit(block)
+	if err != nil {
+		return err
+	}
+	if err := n.validateStateRoot(block); err != nil {
+		return err
+	}
+	if err := n.blockchain.AddBlock(block); err != nil {
+		return err
+	}
+
+	transactionFees := n.settleBlockFees(block)
+	proposer := block.Header.ValidatorAddr
+	if err := n.multiConsensus.DistributeBlockReward(proposer, new(big.Int).Set(consensusBlockReward), transactionFees, n.tokenSupply); err != nil {
+		log.Printf("Failed to distribute block reward: %v", err)
+	}
+
+	n.applyLiveness(block, signers)
+	n.applyEvidence(block)
+	n.applyUnjail(block)
+	n.applyEpochTransition(block)
+
+	// The state after the block is final, the next block commits to its root
+	if err := n.blockchain.CacheStateRoot(block); err != nil {
+		log.Printf("Failed to calculate state root of block #%d: %v", block.Number(), err)
+	}
+
+	for _, tx := range block.Transactions {
+		n.txPool.RemoveTransaction(tx.Hash())
+	}
+
+	// The order of the encrypted transactions is committed, reveal them
+	height := block.Number().Uint64()
+	n.shares.prune(height)
+	n.releaseDecryptionShares(block)
+
+	n.multiConsensus.PruneVotes(height)
+	n.proposals.prune(height)
+
+	n.syncMu.Lock()
+	n.importedAt = n.now()
+	n.syncMu.Unlock()
+	return nil
+}
@@ -0,0 +1,178 @@
+package types
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// MaxBatchCalls is the maximum number of calls a batch transaction may carry
+const MaxBatchCalls = 256
+
+// BatchMode selects how a batch transaction handles failing calls
+type BatchMode uint8
+
+const (
+	// BatchAtomic reverts every call of the batch if one of them fails
+	BatchAtomic BatchMode = iota
+
+	// BatchBestEffort keeps the effects of successful calls and skips failing ones
+	BatchBestEffort
+)
+
+// String returns the string representation of the batch mode
+func (mode BatchMode) String() string {
+	switch mode {
+	case BatchAtomic:
+		return "atomic"
+	case BatchBestEffort:
+		return "best-effort"
+	default:
+		return "unknown"
+	}
+}
+
+// BatchCall is a single call of a batch transaction
+type BatchCall struct {
+	To    Address  `json:"to"`
+	Value *big.Int `json:"value"`
+	Data  []byte   `json:"input"`
+}
+
+// NewBatchTransaction creates a transaction that executes calls in order
+// under a single signature and nonce
+func NewBatchTransaction(chainID *big.Int, nonce uint64, calls []*BatchCall, mode BatchMode, gasLimit uint64, gasPrice *big.Int) *QuantumTransaction {
+	return &QuantumTransaction{
+		Type:      TxTypeBatch,
+		ChainID:   chainID,
+		Nonce:     nonce,
+		GasPrice:  gasPrice,
+		Gas:       gasLimit,
+		Value:     new(big.Int),
+		Calls:     calls,
+		BatchMode: mode,
+	}
+}
+
+// IsBatch returns true if the transaction carries a list of calls
+func (tx *QuantumTransaction) IsBatch() bool {
+	return tx.Type == TxTypeBatch
+}
+
+// ValidateBatch checks that the calls of a batch transaction are well formed
+func (tx *QuantumTransaction) ValidateBatch() error {
+	if !tx.IsBatch() {
+		return nil
+	}
+	if len(tx.Calls) == 0 {
+		return errors.New("batch transaction has no calls")
+	}
+	if len(tx.Calls) > MaxBatchCalls {
+		return fmt.Errorf("batch transaction has %d calls, limit %d", len(tx.Calls), MaxBatchCalls)
+	}
+	if tx.BatchMode != BatchAtomic && tx.BatchMode != BatchBestEffort {
+		return fmt.Errorf("unknown batch mode %d", tx.BatchMode)
+	}
+	for i, call := range tx.Calls {
+		if call == nil || call.Value == nil {
+			return fmt.Errorf("batch call %d is incomplete", i)
+		}
+		if call.Value.Sign() < 0 {
+			return fmt.Errorf("batch call %d has a negative value", i)
+		}
+	}
+	return nil
+}
+
+// batchValue returns the total value transferred by the calls of a batch
+func (tx *QuantumTransaction) batchValue() *big.Int {
+	total := new(big.Int)
+	for _, call := range tx.Calls {
+		if call != nil && call.Value != nil {
+			total.Add(total, call.Value)
+		}
+	}
+	return total
+}
+
+// batchSigningData returns the mode and calls of a batch for the signing hash
+func (tx *QuantumTransaction) batchSigningData() []byte {
+	data := []byte{byte(tx.Type), byte(tx.BatchMode)}
+	data = append(data, uint64ToBytes(uint64(len(tx.Calls)))...)
+	for _, call := range tx.Calls {
+		// Malformed calls are rejected by ValidateBatch, hash them as empty
+		if call == nil {
+			call = &BatchCall{}
+		}
+		data = append(data, call.To.Bytes()...)
+		if call.Value != nil {
+			data = append(data, call.Value.Bytes()...)
+		}
+		// Length prefix the input so calls can not be shifted into each other
+		data = append(data, uint64ToBytes(uint64(len(call.Data)))...)
+		data = append(data, call.Data...)
+	}
+	return data
+}
+
+// batchSize returns the encoded size of the mode and calls of a batch
+func (tx *QuantumTransaction) batchSize() uint64 {
+	size := uint64(2) // Type and mode
+	for _, call := range tx.Calls {
+		size += 20 + 32 // To and Value
+		if call != nil {
+			size += uint64(len(call.Data))
+		}
+	}
+	return size
+}
+
+// MarshalJSON marshals a batch call to JSON
+func (call *BatchCall) MarshalJSON() ([]byte, error) {
+	value := "0x0"
+	if call.Value != nil {
+		value = fmt.Sprintf("0x%x", call.Value)
+	}
+	return json.Marshal(map[string]string{
+		"to":    call.To.Hex(),
+		"value": value,
+		"input": "0x" + hex.EncodeToString(call.Data),
+	})
+}
+
+// UnmarshalJSON unmarshals a batch call from JSON
+func (call *BatchCall) UnmarshalJSON(data []byte) error {
+	var callData struct {
+		To    string `json:"to"`
+		Value string `json:"value"`
+		Data  string `json:"input"`
+	}
+	if err := json.Unmarshal(data, &callData); err != nil {
+		return err
+	}
+
+	to, err := HexToAddress(callData.To)
+	if err != nil {
+		return fmt.Errorf("invalid batch call recipient: %w", err)
+	}
+	call.To = to
+
+	call.Value = new(big.Int)
+	if callData.Value != "" {
+		if _, ok := call.Value.SetString(strings.TrimPrefix(callData.Value, "0x"), 16); !ok {
+			return fmt.Errorf("invalid batch call value %q", callData.Value)
+		}
+	}
+
+	if callData.Data != "" {
+		input, err := hex.DecodeString(strings.TrimPrefix(callData.Data, "0x"))
+		if err != nil {
+			return fmt.Errorf("invalid batch call input: %w", err)
+		}
+		call.Data = input
+	}
+	return nil
+}
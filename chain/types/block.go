@@ -2,6 +2,7 @@ package types
 
 import (
 	"encoding/json"
+	"errors"
 	"math/big"
 	"time"
 
@@ -25,6 +26,24 @@ type BlockHeader struct {
 	Extra       []byte   `json:"extraData"`
 	MixDigest   Hash     `json:"mixHash"`
 	Nonce       uint64   `json:"nonce"`
+	BaseFee     *big.Int `json:"baseFeePerGas,omitempty"` // Burned per unit of gas, nil before dynamic fees
+
+	// Root of the keys decrypting the encrypted transactions, zero without any
+	DecryptionRoot Hash `json:"decryptionKeysRoot"`
+
+	// Root of the misbehavior evidence included in the block, zero without any
+	EvidenceRoot Hash `json:"evidenceRoot"`
+
+	// Hash of the commit votes for the parent, zero without any
+	LastCommitHash Hash `json:"lastCommitHash"`
+
+	// Consensus round the block was proposed in, 0 unless the scheduled
+	// proposers of the earlier rounds timed out
+	Round uint64 `json:"round"`
+
+	// Hash of the validator set of the epoch the block starts, zero in the
+	// other blocks
+	ValidatorsHash Hash `json:"validatorsHash"`
 
 	// Quantum-specific fields
 	ValidatorSig  *crypto.QRSignature `json:"validatorSignature"`
@@ -40,6 +59,16 @@ type Block struct {
 	Transactions []*QuantumTransaction `json:"transactions"`
 	Uncles       []*BlockHeader        `json:"uncles"`
 
+	// Shared secrets of the encrypted transactions in block order, revealed
+	// by the proposer once the order is fixed
+	DecryptionKeys [][]byte `json:"decryptionKeys,omitempty"`
+
+	// Encoded evidence of validators signing conflicting blocks or votes
+	Evidence [][]byte `json:"evidence,omitempty"`
+
+	// Commit votes of the validators for the parent block
+	LastCommit []*CommitSig `json:"lastCommit,omitempty"`
+
 	// Computed fields
 	size uint64 // Internal field, not exposed in JSON
 	hash Hash   // Internal field, not exposed in JSON
@@ -97,31 +126,32 @@ func (h *BlockHeader) Hash() Hash {
 		return h.hash
 	}
 
-	// Create hash data
-	data := []byte{}
-	data = append(data, h.ParentHash.Bytes()...)
-	data = append(data, h.UncleHash.Bytes()...)
-	data = append(data, h.Coinbase.Bytes()...)
-	data = append(data, h.Root.Bytes()...)
-	data = append(data, h.TxHash.Bytes()...)
-	data = append(data, h.ReceiptHash.Bytes()...)
-	data = append(data, h.Bloom...)
-	data = append(data, h.Difficulty.Bytes()...)
-	data = append(data, h.Number.Bytes()...)
-	data = append(data, uint64ToBytes(h.GasLimit)...)
-	data = append(data, uint64ToBytes(h.GasUsed)...)
-	data = append(data, uint64ToBytes(h.Time)...)
-	data = append(data, h.Extra...)
-	data = append(data, h.MixDigest.Bytes()...)
-	data = append(data, uint64ToBytes(h.Nonce)...)
-
-	h.hash = BytesToHash(Keccak256(data))
+	h.hash = BytesToHash(Keccak256(h.hashingData()))
 	return h.hash
 }
 
+// ValidateFields checks that a header decoded from a peer has the fields the
+// hashes encode, BaseFee stays optional
+func (h *BlockHeader) ValidateFields() error {
+	if h.Number == nil || h.Difficulty == nil {
+		return errors.New("header without number or difficulty")
+	}
+	if h.Number.Sign() < 0 || h.Difficulty.Sign() < 0 || (h.BaseFee != nil && h.BaseFee.Sign() < 0) {
+		return errors.New("header with negative number, difficulty or base fee")
+	}
+	return nil
+}
+
 // SigningHash returns the hash used for validator signing
 func (h *BlockHeader) SigningHash() Hash {
 	// Don't include validator signature in signing hash
+	return BytesToHash(Keccak256(h.hashingData()))
+}
+
+// hashingData encodes the header without the validator signature. Every
+// field is encoded, the variable ones with their length, so no two headers
+// share an encoding.
+func (h *BlockHeader) hashingData() []byte {
 	data := []byte{}
 	data = append(data, h.ParentHash.Bytes()...)
 	data = append(data, h.UncleHash.Bytes()...)
@@ -129,17 +159,41 @@ func (h *BlockHeader) SigningHash() Hash {
 	data = append(data, h.Root.Bytes()...)
 	data = append(data, h.TxHash.Bytes()...)
 	data = append(data, h.ReceiptHash.Bytes()...)
-	data = append(data, h.Bloom...)
-	data = append(data, h.Difficulty.Bytes()...)
-	data = append(data, h.Number.Bytes()...)
+	data = appendHashingBytes(data, h.Bloom)
+	data = appendHashingBytes(data, bigBytes(h.Difficulty))
+	data = appendHashingBytes(data, bigBytes(h.Number))
 	data = append(data, uint64ToBytes(h.GasLimit)...)
 	data = append(data, uint64ToBytes(h.GasUsed)...)
 	data = append(data, uint64ToBytes(h.Time)...)
-	data = append(data, h.Extra...)
+	data = appendHashingBytes(data, h.Extra)
 	data = append(data, h.MixDigest.Bytes()...)
 	data = append(data, uint64ToBytes(h.Nonce)...)
+	if h.BaseFee != nil {
+		data = append(data, 1)
+		data = appendHashingBytes(data, h.BaseFee.Bytes())
+	} else {
+		data = append(data, 0)
+	}
+	data = append(data, h.DecryptionRoot.Bytes()...)
+	data = append(data, h.EvidenceRoot.Bytes()...)
+	data = append(data, h.LastCommitHash.Bytes()...)
+	data = append(data, uint64ToBytes(h.Round)...)
+	data = append(data, h.ValidatorsHash.Bytes()...)
+	return data
+}
 
-	return BytesToHash(Keccak256(data))
+// appendHashingBytes appends variable length data preceded by its length
+func appendHashingBytes(data, value []byte) []byte {
+	data = append(data, uint64ToBytes(uint64(len(value)))...)
+	return append(data, value...)
+}
+
+// bigBytes returns the bytes of a number, none for nil
+func bigBytes(n *big.Int) []byte {
+	if n == nil {
+		return nil
+	}
+	return n.Bytes()
 }
 
 // SignBlock signs the block with the validator's private key
@@ -195,6 +249,14 @@ func (b *Block) Coinbase() Address {
 	return b.Header.Coinbase
 }
 
+// BaseFee returns the base fee per gas, nil if the block has none
+func (b *Block) BaseFee() *big.Int {
+	if b.Header.BaseFee == nil {
+		return nil
+	}
+	return new(big.Int).Set(b.Header.BaseFee)
+}
+
 // ParentHash returns the parent hash
 func (b *Block) ParentHash() Hash {
 	return b.Header.ParentHash
@@ -215,7 +277,7 @@ func (b *Block) calculateSize() uint64 {
 	size += 32 * 8 // Hashes
 	size += 20 * 2 // Addresses
 	size += 256    // Bloom filter
-	size += 32 * 2 // Big ints
+	size += 32 * 3 // Big ints
 	size += 8 * 5  // Uint64s
 	size += uint64(len(b.Header.Extra))
 
@@ -229,6 +291,17 @@ func (b *Block) calculateSize() uint64 {
 	for _, tx := range b.Transactions {
 		size += tx.Size()
 	}
+	for _, key := range b.DecryptionKeys {
+		size += uint64(len(key))
+	}
+	for _, evidence := range b.Evidence {
+		size += uint64(len(evidence))
+	}
+	for _, sig := range b.LastCommit {
+		if sig != nil {
+			size += AddressLength + 8 + uint64(len(sig.Signature))
+		}
+	}
 
 	// Uncle headers (should be empty in PoS)
 	for _, uncle := range b.Uncles {
@@ -239,6 +312,12 @@ func (b *Block) calculateSize() uint64 {
 	return size
 }
 
+// TxRoot returns the root of the block transactions, the TxHash of its
+// header when the block is well formed
+func (b *Block) TxRoot() Hash {
+	return b.calculateTxRoot()
+}
+
 func (b *Block) calculateTxRoot() Hash {
 	if len(b.Transactions) == 0 {
 		return ZeroHash
@@ -253,6 +332,16 @@ func (b *Block) calculateTxRoot() Hash {
 	return calculateMerkleRoot(hashes)
 }
 
+// calculateDataRoot calculates the Merkle root of the hashes of encoded items,
+// such as the evidence or the decryption keys of a block
+func calculateDataRoot(items [][]byte) Hash {
+	hashes := make([]Hash, len(items))
+	for i, item := range items {
+		hashes[i] = Keccak256Hash(item)
+	}
+	return calculateMerkleRoot(hashes)
+}
+
 // calculateMerkleRoot calculates the Merkle root of a list of hashes
 func calculateMerkleRoot(hashes []Hash) Hash {
 	if len(hashes) == 0 {
@@ -287,6 +376,10 @@ func (b *Block) MarshalJSON() ([]byte, error) {
 		Uncles       []*BlockHeader        `json:"uncles"`
 		Hash         string                `json:"hash"`
 		Size         uint64                `json:"size"`
+
+		DecryptionKeys [][]byte     `json:"decryptionKeys,omitempty"`
+		Evidence       [][]byte     `json:"evidence,omitempty"`
+		LastCommit     []*CommitSig `json:"lastCommit,omitempty"`
 	}
 
 	return json.Marshal(&blockJSON{
@@ -295,6 +388,10 @@ func (b *Block) MarshalJSON() ([]byte, error) {
 		Uncles:       b.Uncles,
 		Hash:         b.Hash().Hex(),
 		Size:         b.Size(),
+
+		DecryptionKeys: b.DecryptionKeys,
+		Evidence:       b.Evidence,
+		LastCommit:     b.LastCommit,
 	})
 }
 
@@ -0,0 +1,53 @@
+package types
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// CommitSig is the commit vote of a validator for the parent of the block
+// including it. The vote signs the parent hash and height, so only the
+// signer, the round, the vote time and the signature are carried.
+type CommitSig struct {
+	Validator Address `json:"validator"`
+	Round     uint64  `json:"round,omitempty"`
+	Timestamp int64   `json:"timestamp"`
+	Signature []byte  `json:"signature"`
+}
+
+// SetLastCommit includes the commit votes for the parent in the block. It is
+// called before the block is signed.
+func (b *Block) SetLastCommit(commit []*CommitSig) {
+	b.LastCommit = commit
+	b.Header.LastCommitHash = calculateLastCommitHash(commit)
+	b.Header.hash = ZeroHash
+	b.hash = ZeroHash
+	b.size = 0
+}
+
+// ValidateLastCommitHash checks that the header commits to the votes for the
+// parent the block includes
+func (b *Block) ValidateLastCommitHash() error {
+	if root := calculateLastCommitHash(b.LastCommit); root != b.Header.LastCommitHash {
+		return fmt.Errorf("invalid last commit hash: have %s, want %s", b.Header.LastCommitHash.Hex(), root.Hex())
+	}
+	return nil
+}
+
+func calculateLastCommitHash(commit []*CommitSig) Hash {
+	hashes := make([]Hash, len(commit))
+	for i, sig := range commit {
+		if sig == nil {
+			continue
+		}
+		data := make([]byte, 0, AddressLength+16+len(sig.Signature))
+		data = append(data, sig.Validator.Bytes()...)
+		data = binary.BigEndian.AppendUint64(data, uint64(sig.Timestamp))
+		data = append(data, sig.Signature...)
+		if sig.Round > 0 {
+			data = binary.BigEndian.AppendUint64(data, sig.Round)
+		}
+		hashes[i] = Keccak256Hash(data)
+	}
+	return calculateMerkleRoot(hashes)
+}
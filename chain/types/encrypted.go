@@ -0,0 +1,418 @@
+package types
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"quantum-blockchain/chain/crypto"
+)
+
+// EncryptionEpochLength is the number of blocks an epoch encryption key is used for
+const EncryptionEpochLength = uint64(1000)
+
+// MaxKeyShares is the maximum number of validators an encrypted transaction
+// shares its payload key with
+const MaxKeyShares = 32
+
+// sealedShareSize is the size of a sealed key share: the AEAD nonce, the
+// share of the 32 byte payload key and the AEAD tag
+const sealedShareSize = 12 + 32 + 16
+
+// KeyShareSize is the encoded size of one key share of an encrypted transaction
+const KeyShareSize = AddressLength + crypto.KyberCiphertextSize + sealedShareSize
+
+var (
+	// ErrUndecryptable is returned when the payload of an encrypted transaction can not be decrypted
+	ErrUndecryptable = errors.New("encrypted payload can not be decrypted")
+
+	// ErrEncryptionEpoch is returned when a transaction is encrypted to a key that is not active
+	ErrEncryptionEpoch = errors.New("encryption epoch is not active")
+)
+
+// encryptionDomain separates the payload key from other uses of the shared secret
+var encryptionDomain = []byte("quantum-encrypted-mempool")
+
+// EncryptionEpoch returns the epoch whose key encrypts transactions for a block
+func EncryptionEpoch(blockNumber uint64) uint64 {
+	return blockNumber / EncryptionEpochLength
+}
+
+// EncryptionKey is the Kyber key a validator receives key shares with in an epoch
+type EncryptionKey struct {
+	Validator Address
+	PublicKey *crypto.KyberPublicKey
+}
+
+// KeyShare is the share of the payload key of an encrypted transaction for
+// one validator, sealed with the secret of a KEM capsule to its epoch key
+type KeyShare struct {
+	Validator Address
+	Capsule   []byte
+	Share     []byte
+}
+
+// EncryptedPayload is the part of an encrypted transaction hidden until the
+// block ordering is fixed
+type EncryptedPayload struct {
+	To    *Address
+	Value *big.Int
+	Data  []byte
+}
+
+// NewEncryptedTransaction creates a transaction whose recipient, value and
+// data are encrypted with a fresh payload key. The key is split into one
+// share per validator key, any threshold of which recover it, and every share
+// is sealed to its validator, so no validator can read the payload alone. The
+// nonce, gas and fees stay visible so the transaction can be ordered and paid for.
+func NewEncryptedTransaction(chainID *big.Int, nonce uint64, epoch uint64, keys []*EncryptionKey, threshold uint8, payload *EncryptedPayload, gasLimit uint64, gasPrice *big.Int) (*QuantumTransaction, error) {
+	if payload.Value != nil && (payload.Value.Sign() < 0 || payload.Value.BitLen() > 256) {
+		return nil, fmt.Errorf("invalid payload value: %s", payload.Value)
+	}
+	if len(keys) > MaxKeyShares {
+		return nil, fmt.Errorf("%d validator keys, at most %d", len(keys), MaxKeyShares)
+	}
+
+	payloadKey := make([]byte, crypto.KyberSharedSecretSize)
+	if _, err := rand.Read(payloadKey); err != nil {
+		return nil, fmt.Errorf("failed to generate payload key: %w", err)
+	}
+	shares, err := crypto.SplitSecret(payloadKey, int(threshold), len(keys))
+	if err != nil {
+		return nil, err
+	}
+
+	keyShares := make([]*KeyShare, len(keys))
+	for i, key := range keys {
+		capsule, secret, err := key.PublicKey.Encapsulate()
+		if err != nil {
+			return nil, fmt.Errorf("failed to encapsulate key share: %w", err)
+		}
+		sealed, err := seal(secret, shares[i], key.Validator.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		keyShares[i] = &KeyShare{Validator: key.Validator, Capsule: capsule, Share: sealed}
+	}
+
+	data, err := seal(payloadKey, payload.encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &QuantumTransaction{
+		Type:            TxTypeEncrypted,
+		ChainID:         chainID,
+		Nonce:           nonce,
+		GasPrice:        gasPrice,
+		Gas:             gasLimit,
+		Value:           new(big.Int),
+		Data:            data,
+		EncryptionEpoch: epoch,
+		KeyThreshold:    threshold,
+		KeyShares:       keyShares,
+	}, nil
+}
+
+// IsEncrypted returns true if the payload of the transaction is encrypted
+func (tx *QuantumTransaction) IsEncrypted() bool {
+	return tx.Type == TxTypeEncrypted
+}
+
+// OpenKeyShare opens the key share at index with the secret of its capsule,
+// which its validator reveals once the transaction is ordered
+func (tx *QuantumTransaction) OpenKeyShare(index int, secret []byte) ([]byte, error) {
+	if index < 0 || index >= len(tx.KeyShares) {
+		return nil, fmt.Errorf("no key share %d", index)
+	}
+	share := tx.KeyShares[index]
+	return open(secret, share.Share, share.Validator.Bytes())
+}
+
+// RecoverPayloadKey combines the key shares opened by the revealed capsule
+// secrets, one per key share and nil where missing, into the payload key.
+// Secrets that do not open their share are ignored.
+func (tx *QuantumTransaction) RecoverPayloadKey(secrets [][]byte) ([]byte, error) {
+	shares := make(map[byte][]byte)
+	for i, secret := range secrets {
+		if len(shares) == int(tx.KeyThreshold) {
+			break
+		}
+		if len(secret) == 0 {
+			continue
+		}
+		if share, err := tx.OpenKeyShare(i, secret); err == nil {
+			shares[byte(i+1)] = share
+		}
+	}
+	if tx.KeyThreshold == 0 || len(shares) < int(tx.KeyThreshold) {
+		return nil, fmt.Errorf("%w: %d of %d key shares", ErrUndecryptable, len(shares), tx.KeyThreshold)
+	}
+
+	key, err := crypto.CombineShares(shares)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUndecryptable, err)
+	}
+	if _, err := tx.DecryptPayload(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// DecryptPayload decrypts the payload with the payload key, revealed by the
+// block after the one ordering the transaction
+func (tx *QuantumTransaction) DecryptPayload(key []byte) (*EncryptedPayload, error) {
+	if !tx.IsEncrypted() {
+		return nil, errors.New("transaction is not encrypted")
+	}
+	plaintext, err := open(key, tx.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUndecryptable, err)
+	}
+	return decodeEncryptedPayload(plaintext)
+}
+
+// ValidateEncrypted checks that an encrypted transaction is well formed
+func (tx *QuantumTransaction) ValidateEncrypted() error {
+	if !tx.IsEncrypted() {
+		return nil
+	}
+	if len(tx.KemCapsule) != 0 {
+		return errors.New("encrypted transaction carries its capsules in its key shares")
+	}
+	if len(tx.KeyShares) == 0 || len(tx.KeyShares) > MaxKeyShares {
+		return fmt.Errorf("encrypted transaction has %d key shares, want 1 to %d", len(tx.KeyShares), MaxKeyShares)
+	}
+	if tx.KeyThreshold == 0 || int(tx.KeyThreshold) > len(tx.KeyShares) {
+		return fmt.Errorf("invalid key threshold %d of %d shares", tx.KeyThreshold, len(tx.KeyShares))
+	}
+	validators := make(map[Address]bool, len(tx.KeyShares))
+	for i, share := range tx.KeyShares {
+		if share == nil {
+			return fmt.Errorf("key share %d is missing", i)
+		}
+		if len(share.Capsule) != crypto.KyberCiphertextSize || len(share.Share) != sealedShareSize {
+			return fmt.Errorf("invalid key share %d: %d byte capsule and %d byte share", i, len(share.Capsule), len(share.Share))
+		}
+		if validators[share.Validator] {
+			return fmt.Errorf("duplicate key share of validator %s", share.Validator.Hex())
+		}
+		validators[share.Validator] = true
+	}
+	if tx.To != nil || tx.GetValue().Sign() != 0 {
+		return errors.New("encrypted transaction can only carry its recipient and value in the payload")
+	}
+	if len(tx.Data) == 0 {
+		return errors.New("encrypted transaction has no payload")
+	}
+	return nil
+}
+
+// KeySharesSize returns the encoded size of the key threshold and shares
+func (tx *QuantumTransaction) KeySharesSize() int {
+	return 1 + len(tx.KeyShares)*KeyShareSize
+}
+
+// CheckEncryptionEpoch checks that a transaction included in the block with
+// the given number is encrypted to the keys of its epoch or the one before,
+// which keeps transactions sent at the end of an epoch valid
+func (tx *QuantumTransaction) CheckEncryptionEpoch(blockNumber uint64) error {
+	if !tx.IsEncrypted() {
+		return nil
+	}
+	epoch := EncryptionEpoch(blockNumber)
+	if tx.EncryptionEpoch > epoch || tx.EncryptionEpoch+1 < epoch {
+		return fmt.Errorf("%w: encrypted to epoch %d, block %d is in epoch %d", ErrEncryptionEpoch, tx.EncryptionEpoch, blockNumber, epoch)
+	}
+	return nil
+}
+
+// encryptedSigningData returns the epoch, threshold and key shares of the
+// payload key for the signing hash
+func (tx *QuantumTransaction) encryptedSigningData() []byte {
+	data := append([]byte{byte(tx.Type)}, uint64ToBytes(tx.EncryptionEpoch)...)
+	data = append(data, tx.KeyThreshold)
+	for _, share := range tx.KeyShares {
+		if share == nil {
+			continue
+		}
+		data = append(data, share.Validator.Bytes()...)
+		data = append(data, share.Capsule...)
+		data = append(data, share.Share...)
+	}
+	return data
+}
+
+// payloadCipher returns the AEAD keyed by a payload key or capsule secret
+func payloadCipher(secret []byte) (cipher.AEAD, error) {
+	if len(secret) != crypto.KyberSharedSecretSize {
+		return nil, fmt.Errorf("invalid shared secret size: %d", len(secret))
+	}
+	key := Keccak256(append(append([]byte{}, encryptionDomain...), secret...))
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext under secret as [nonce][ciphertext]
+func seal(secret, plaintext, additional []byte) ([]byte, error) {
+	aead, err := payloadCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+// open decrypts data sealed under secret
+func open(secret, data, additional []byte) ([]byte, error) {
+	aead, err := payloadCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("sealed data is truncated")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], additional)
+}
+
+// encode serializes the payload as [has recipient][recipient][value][data]
+func (p *EncryptedPayload) encode() []byte {
+	data := []byte{0}
+	if p.To != nil {
+		data[0] = 1
+		data = append(data, p.To.Bytes()...)
+	}
+	value := make([]byte, 32)
+	if p.Value != nil {
+		p.Value.FillBytes(value)
+	}
+	data = append(data, value...)
+	return append(data, p.Data...)
+}
+
+func decodeEncryptedPayload(data []byte) (*EncryptedPayload, error) {
+	if len(data) < 1 {
+		return nil, fmt.Errorf("%w: empty payload", ErrUndecryptable)
+	}
+	payload := &EncryptedPayload{}
+	offset := 1
+	if data[0] == 1 {
+		if len(data) < offset+20 {
+			return nil, fmt.Errorf("%w: truncated recipient", ErrUndecryptable)
+		}
+		to := BytesToAddress(data[offset : offset+20])
+		payload.To = &to
+		offset += 20
+	}
+	if len(data) < offset+32 {
+		return nil, fmt.Errorf("%w: truncated value", ErrUndecryptable)
+	}
+	payload.Value = new(big.Int).SetBytes(data[offset : offset+32])
+	payload.Data = append([]byte{}, data[offset+32:]...)
+	return payload, nil
+}
+
+// EncryptedTransactions returns the encrypted transactions of the block in
+// order, they execute in the next block
+func (b *Block) EncryptedTransactions() []*QuantumTransaction {
+	var encrypted []*QuantumTransaction
+	for _, tx := range b.Transactions {
+		if tx.IsEncrypted() {
+			encrypted = append(encrypted, tx)
+		}
+	}
+	return encrypted
+}
+
+// SetDecryptionKeys reveals the payload keys of the encrypted transactions
+// the parent ordered, one per transaction in parent order and empty where the
+// validators did not release enough shares. It is called before the block is
+// signed.
+func (b *Block) SetDecryptionKeys(keys [][]byte) {
+	b.DecryptionKeys = keys
+	b.Header.DecryptionRoot = calculateDataRoot(keys)
+	b.Header.hash = ZeroHash
+	b.hash = ZeroHash
+	b.size = 0
+}
+
+// ValidateDecryptionRoot checks that the header commits to the revealed keys
+func (b *Block) ValidateDecryptionRoot() error {
+	if root := calculateDataRoot(b.DecryptionKeys); root != b.Header.DecryptionRoot {
+		return fmt.Errorf("invalid decryption keys root: have %s, want %s", b.Header.DecryptionRoot.Hex(), root.Hex())
+	}
+	return nil
+}
+
+// ValidateDecryptionKeys checks that the block reveals one key per encrypted
+// transaction of its parent, that the header commits to them and that every
+// revealed key decrypts its payload. An empty key fails its transaction.
+func (b *Block) ValidateDecryptionKeys(parent *Block) error {
+	encrypted := parent.EncryptedTransactions()
+	if len(b.DecryptionKeys) != len(encrypted) {
+		return fmt.Errorf("block has %d decryption keys for %d encrypted transactions of its parent", len(b.DecryptionKeys), len(encrypted))
+	}
+	if err := b.ValidateDecryptionRoot(); err != nil {
+		return err
+	}
+	for i, tx := range encrypted {
+		if len(b.DecryptionKeys[i]) == 0 {
+			continue
+		}
+		if _, err := tx.DecryptPayload(b.DecryptionKeys[i]); err != nil {
+			return fmt.Errorf("invalid decryption key for encrypted transaction %s: %w", tx.Hash().Hex(), err)
+		}
+	}
+	return nil
+}
+
+// MarshalJSON marshals a key share to JSON
+func (share *KeyShare) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&keyShareJSON{
+		Validator: share.Validator.Hex(),
+		Capsule:   "0x" + hex.EncodeToString(share.Capsule),
+		Share:     "0x" + hex.EncodeToString(share.Share),
+	})
+}
+
+// UnmarshalJSON unmarshals a key share from JSON
+func (share *KeyShare) UnmarshalJSON(data []byte) error {
+	var shareData keyShareJSON
+	if err := json.Unmarshal(data, &shareData); err != nil {
+		return err
+	}
+	validator, err := HexToAddress(shareData.Validator)
+	if err != nil {
+		return fmt.Errorf("invalid key share validator: %w", err)
+	}
+	capsule, err := hex.DecodeString(strings.TrimPrefix(shareData.Capsule, "0x"))
+	if err != nil {
+		return fmt.Errorf("invalid key share capsule: %w", err)
+	}
+	sealed, err := hex.DecodeString(strings.TrimPrefix(shareData.Share, "0x"))
+	if err != nil {
+		return fmt.Errorf("invalid key share: %w", err)
+	}
+	share.Validator = validator
+	share.Capsule = capsule
+	share.Share = sealed
+	return nil
+}
+
+type keyShareJSON struct {
+	Validator string `json:"validator"`
+	Capsule   string `json:"capsule"`
+	Share     string `json:"share"`
+}
@@ -0,0 +1,22 @@
+package types
+
+import "fmt"
+
+// SetEvidence includes encoded misbehavior evidence in the block. It is
+// called before the block is signed.
+func (b *Block) SetEvidence(evidence [][]byte) {
+	b.Evidence = evidence
+	b.Header.EvidenceRoot = calculateDataRoot(evidence)
+	b.Header.hash = ZeroHash
+	b.hash = ZeroHash
+	b.size = 0
+}
+
+// ValidateEvidenceRoot checks that the header commits to the evidence of the
+// block
+func (b *Block) ValidateEvidenceRoot() error {
+	if root := calculateDataRoot(b.Evidence); root != b.Header.EvidenceRoot {
+		return fmt.Errorf("invalid evidence root: have %s, want %s", b.Header.EvidenceRoot.Hex(), root.Hex())
+	}
+	return nil
+}
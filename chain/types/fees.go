@@ -0,0 +1,81 @@
+package types
+
+import (
+	"errors"
+	"math/big"
+)
+
+// Base fee parameters, following EIP-1559
+const (
+	// InitialBaseFee is the base fee of the first block after a parent without one
+	InitialBaseFee = BaseGasPrice
+
+	// MinBaseFee is the floor the base fee never drops below
+	MinBaseFee = MinGasPrice
+
+	// BaseFeeChangeDenominator bounds the base fee change between blocks to 1/8
+	BaseFeeChangeDenominator = 8
+
+	// ElasticityMultiplier is the ratio of the gas limit to the gas target
+	ElasticityMultiplier = 2
+)
+
+// ErrFeeCapTooLow is returned when a transaction's fee cap is below the base fee
+var ErrFeeCapTooLow = errors.New("max fee per gas less than block base fee")
+
+// CalcBaseFee returns the base fee of the block following parent. The base fee
+// rises when the parent used more than half of its gas limit and falls when it
+// used less, by at most 12.5% per block.
+func CalcBaseFee(parent *BlockHeader) *big.Int {
+	if parent.BaseFee == nil {
+		return big.NewInt(InitialBaseFee)
+	}
+
+	target := parent.GasLimit / ElasticityMultiplier
+	if target == 0 || parent.GasUsed == target {
+		return new(big.Int).Set(parent.BaseFee)
+	}
+
+	// delta = parentBaseFee * |gasUsed - target| / target / denominator
+	var used uint64
+	if parent.GasUsed > target {
+		used = parent.GasUsed - target
+	} else {
+		used = target - parent.GasUsed
+	}
+	delta := new(big.Int).Mul(parent.BaseFee, new(big.Int).SetUint64(used))
+	delta.Div(delta, new(big.Int).SetUint64(target))
+	delta.Div(delta, big.NewInt(BaseFeeChangeDenominator))
+
+	baseFee := new(big.Int).Set(parent.BaseFee)
+	if parent.GasUsed > target {
+		// Always move up by at least one wei so a full chain keeps getting pricier
+		if delta.Sign() == 0 {
+			delta.SetInt64(1)
+		}
+		return baseFee.Add(baseFee, delta)
+	}
+
+	baseFee.Sub(baseFee, delta)
+	if baseFee.Cmp(big.NewInt(MinBaseFee)) < 0 {
+		baseFee.SetInt64(MinBaseFee)
+	}
+	return baseFee
+}
+
+// EffectiveGasTip returns the tip per gas the block producer receives for a
+// fee cap and tip cap at the given base fee
+func EffectiveGasTip(gasFeeCap, gasTipCap, baseFee *big.Int) (*big.Int, error) {
+	if baseFee == nil {
+		return new(big.Int).Set(gasTipCap), nil
+	}
+	if gasFeeCap.Cmp(baseFee) < 0 {
+		return nil, ErrFeeCapTooLow
+	}
+
+	tip := new(big.Int).Sub(gasFeeCap, baseFee)
+	if tip.Cmp(gasTipCap) > 0 {
+		tip.Set(gasTipCap)
+	}
+	return tip, nil
+}
@@ -0,0 +1,389 @@
+package types
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"quantum-blockchain/chain/crypto"
+)
+
+// MaxMultisigKeys is the maximum number of keys of a multisig policy. A
+// policy of this many Falcon keys, the largest, signed by all of them still
+// fits in MaxTransactionSize.
+const MaxMultisigKeys = 8
+
+var (
+	// ErrMultisigThreshold is returned when a multisig transaction has fewer valid signatures than its threshold
+	ErrMultisigThreshold = errors.New("not enough multisig signatures")
+
+	// ErrNotMultisigSigner is returned when a signature does not belong to a key of the multisig policy
+	ErrNotMultisigSigner = errors.New("signer is not part of the multisig policy")
+)
+
+// multisigDomain separates multisig addresses and signing data from single key ones
+const multisigDomain = byte(0x4d)
+
+// MultisigKey is one post-quantum public key of a multisig policy
+type MultisigKey struct {
+	Algorithm crypto.SignatureAlgorithm
+	PublicKey []byte
+}
+
+// MultisigPolicy is an M-of-N multisignature account. Its address derives
+// from the threshold and the keys, so a transaction carrying the policy
+// proves it belongs to the sending account.
+type MultisigPolicy struct {
+	Threshold uint8
+	Keys      []*MultisigKey
+
+	address Address // Internal field, not exposed in JSON
+}
+
+// NewMultisigPolicy creates a policy requiring threshold signatures of the
+// given keys. Keys are sorted, the same key set always yields the same address.
+func NewMultisigPolicy(threshold uint8, keys []*MultisigKey) (*MultisigPolicy, error) {
+	sorted := make([]*MultisigKey, len(keys))
+	copy(sorted, keys)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Algorithm != sorted[j].Algorithm {
+			return sorted[i].Algorithm < sorted[j].Algorithm
+		}
+		return bytes.Compare(sorted[i].PublicKey, sorted[j].PublicKey) < 0
+	})
+
+	policy := &MultisigPolicy{Threshold: threshold, Keys: sorted}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// Validate checks the threshold, the number of keys and their algorithms
+func (p *MultisigPolicy) Validate() error {
+	if len(p.Keys) == 0 || len(p.Keys) > MaxMultisigKeys {
+		return fmt.Errorf("multisig policy has %d keys, want 1 to %d", len(p.Keys), MaxMultisigKeys)
+	}
+	if p.Threshold == 0 || int(p.Threshold) > len(p.Keys) {
+		return fmt.Errorf("invalid multisig threshold %d of %d keys", p.Threshold, len(p.Keys))
+	}
+	for i, key := range p.Keys {
+		if key == nil {
+			return fmt.Errorf("multisig key %d is missing", i)
+		}
+		size, err := crypto.GetPublicKeySize(key.Algorithm)
+		if err != nil {
+			return fmt.Errorf("multisig key %d: %w", i, err)
+		}
+		if len(key.PublicKey) != size {
+			return fmt.Errorf("multisig key %d has %d bytes, want %d", i, len(key.PublicKey), size)
+		}
+		if p.KeyIndex(key.PublicKey) != i {
+			return fmt.Errorf("duplicate multisig key %d", i)
+		}
+	}
+	return nil
+}
+
+// Address returns the account address of the policy
+func (p *MultisigPolicy) Address() Address {
+	if p.address.IsZero() {
+		data := []byte{multisigDomain, p.Threshold, byte(len(p.Keys))}
+		for _, key := range p.Keys {
+			data = append(data, byte(key.Algorithm))
+			data = append(data, uint64ToBytes(uint64(len(key.PublicKey)))...)
+			data = append(data, key.PublicKey...)
+		}
+		hash := Keccak256(data)
+		p.address = BytesToAddress(hash[12:])
+	}
+	return p.address
+}
+
+// KeyIndex returns the index of publicKey in the policy, or -1
+func (p *MultisigPolicy) KeyIndex(publicKey []byte) int {
+	for i, key := range p.Keys {
+		if key != nil && bytes.Equal(key.PublicKey, publicKey) {
+			return i
+		}
+	}
+	return -1
+}
+
+// size returns the encoded size of the policy
+func (p *MultisigPolicy) size() uint64 {
+	size := uint64(2) // Threshold and key count
+	for _, key := range p.Keys {
+		size += 1 + uint64(len(key.PublicKey))
+	}
+	return size
+}
+
+// IsMultisig returns true if the transaction is sent by a multisig account
+func (tx *QuantumTransaction) IsMultisig() bool {
+	return tx.Multisig != nil
+}
+
+// SetMultisig makes the transaction a multisig transaction sent by the policy account
+func (tx *QuantumTransaction) SetMultisig(policy *MultisigPolicy) {
+	tx.Multisig = policy
+	tx.MultisigSignatures = nil
+	tx.from = policy.Address()
+	tx.hash = Hash{}
+	tx.size = 0
+}
+
+// SignMultisig returns the partial signature of one policy key over the
+// transaction. Partial signatures can be collected offline and added with
+// AddMultisigSignature.
+func (tx *QuantumTransaction) SignMultisig(privateKey []byte, algorithm crypto.SignatureAlgorithm) (*crypto.QRSignature, error) {
+	if !tx.IsMultisig() {
+		return nil, errors.New("transaction has no multisig policy")
+	}
+
+	qrSig, err := crypto.SignMessage(tx.SigningHash().Bytes(), algorithm, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	if tx.Multisig.KeyIndex(qrSig.PublicKey) < 0 {
+		return nil, ErrNotMultisigSigner
+	}
+	return qrSig, nil
+}
+
+// AddMultisigSignature verifies a partial signature and adds it to the
+// transaction. A later signature of the same key replaces the earlier one.
+func (tx *QuantumTransaction) AddMultisigSignature(sig *crypto.QRSignature) error {
+	if !tx.IsMultisig() {
+		return errors.New("transaction has no multisig policy")
+	}
+	index := tx.Multisig.KeyIndex(sig.PublicKey)
+	if index < 0 || tx.Multisig.Keys[index].Algorithm != sig.Algorithm {
+		return ErrNotMultisigSigner
+	}
+
+	valid, err := crypto.VerifySignature(tx.SigningHash().Bytes(), sig)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return fmt.Errorf("invalid multisig signature of key %d", index)
+	}
+
+	signatures := make([]*crypto.QRSignature, 0, len(tx.MultisigSignatures)+1)
+	for _, existing := range tx.MultisigSignatures {
+		if !bytes.Equal(existing.PublicKey, sig.PublicKey) {
+			signatures = append(signatures, existing)
+		}
+	}
+	signatures = append(signatures, sig)
+
+	// Keep signatures in policy key order, the transaction hash depends on it
+	sort.Slice(signatures, func(i, j int) bool {
+		return tx.Multisig.KeyIndex(signatures[i].PublicKey) < tx.Multisig.KeyIndex(signatures[j].PublicKey)
+	})
+	tx.MultisigSignatures = signatures
+	tx.hash = Hash{}
+	tx.size = 0
+
+	return nil
+}
+
+// VerifyMultisig checks that at least threshold distinct policy keys signed
+// the transaction and that every carried signature is valid
+func (tx *QuantumTransaction) VerifyMultisig() (bool, error) {
+	if err := tx.Multisig.Validate(); err != nil {
+		return false, err
+	}
+
+	sigHash := tx.SigningHash()
+	signed := make(map[int]bool)
+	for _, sig := range tx.MultisigSignatures {
+		index := tx.Multisig.KeyIndex(sig.PublicKey)
+		if index < 0 || tx.Multisig.Keys[index].Algorithm != sig.Algorithm {
+			return false, ErrNotMultisigSigner
+		}
+		if signed[index] {
+			return false, fmt.Errorf("duplicate multisig signature of key %d", index)
+		}
+
+		valid, err := crypto.VerifySignature(sigHash.Bytes(), sig)
+		if err != nil || !valid {
+			return false, err
+		}
+		signed[index] = true
+	}
+
+	if len(signed) < int(tx.Multisig.Threshold) {
+		return false, fmt.Errorf("%w: have %d, need %d", ErrMultisigThreshold, len(signed), tx.Multisig.Threshold)
+	}
+	return true, nil
+}
+
+// multisigSigningData returns the policy address for the signing hash
+func (tx *QuantumTransaction) multisigSigningData() []byte {
+	return append([]byte{multisigDomain}, tx.Multisig.Address().Bytes()...)
+}
+
+// multisigSignatureData returns the carried signatures for the transaction hash
+func (tx *QuantumTransaction) multisigSignatureData() []byte {
+	var data []byte
+	for _, sig := range tx.MultisigSignatures {
+		data = append(data, byte(tx.Multisig.KeyIndex(sig.PublicKey)))
+		data = append(data, byte(sig.Algorithm))
+		data = append(data, uint64ToBytes(uint64(len(sig.Signature)))...)
+		data = append(data, sig.Signature...)
+	}
+	return data
+}
+
+// multisigSize returns the encoded size of the policy and the signatures.
+// Signatures name their key by index, the policy already carries the keys.
+func (tx *QuantumTransaction) multisigSize() uint64 {
+	size := tx.Multisig.size()
+	for _, sig := range tx.MultisigSignatures {
+		size += 1 + 1 + uint64(len(sig.Signature)) // Key index and SigAlg
+	}
+	return size
+}
+
+// MarshalJSON marshals a multisig key to JSON
+func (key *MultisigKey) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&qrKeyJSON{
+		SigAlg:    uint8(key.Algorithm),
+		PublicKey: "0x" + hex.EncodeToString(key.PublicKey),
+	})
+}
+
+// UnmarshalJSON unmarshals a multisig key from JSON
+func (key *MultisigKey) UnmarshalJSON(data []byte) error {
+	var keyData qrKeyJSON
+	if err := json.Unmarshal(data, &keyData); err != nil {
+		return err
+	}
+	publicKey, err := hex.DecodeString(strings.TrimPrefix(keyData.PublicKey, "0x"))
+	if err != nil {
+		return fmt.Errorf("invalid multisig public key: %w", err)
+	}
+	key.Algorithm = crypto.SignatureAlgorithm(keyData.SigAlg)
+	key.PublicKey = publicKey
+	return nil
+}
+
+// MarshalJSON marshals a multisig policy to JSON
+func (p *MultisigPolicy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&multisigPolicyJSON{
+		Address:   p.Address().Hex(),
+		Threshold: p.Threshold,
+		Keys:      p.Keys,
+	})
+}
+
+// UnmarshalJSON unmarshals a multisig policy from JSON, the address is derived
+func (p *MultisigPolicy) UnmarshalJSON(data []byte) error {
+	var policyData multisigPolicyJSON
+	if err := json.Unmarshal(data, &policyData); err != nil {
+		return err
+	}
+	for i, key := range policyData.Keys {
+		if key == nil {
+			return fmt.Errorf("multisig key %d is missing", i)
+		}
+	}
+	if policyData.Threshold == 0 || int(policyData.Threshold) > len(policyData.Keys) {
+		return fmt.Errorf("invalid multisig threshold %d of %d keys", policyData.Threshold, len(policyData.Keys))
+	}
+	p.Threshold = policyData.Threshold
+	p.Keys = policyData.Keys
+	p.address = Address{}
+	return nil
+}
+
+// EncodeQRSignature converts a signature into its JSON form
+func EncodeQRSignature(sig *crypto.QRSignature) ([]byte, error) {
+	return json.Marshal(toQRSignatureJSON(sig))
+}
+
+// DecodeQRSignature parses a signature from its JSON form
+func DecodeQRSignature(data []byte) (*crypto.QRSignature, error) {
+	var sigData qrSignatureJSON
+	if err := json.Unmarshal(data, &sigData); err != nil {
+		return nil, err
+	}
+	return sigData.toQRSignature()
+}
+
+type qrKeyJSON struct {
+	SigAlg    uint8  `json:"sigAlg"`
+	PublicKey string `json:"publicKey"`
+}
+
+type multisigPolicyJSON struct {
+	Address   string         `json:"address,omitempty"`
+	Threshold uint8          `json:"threshold"`
+	Keys      []*MultisigKey `json:"keys"`
+}
+
+type qrSignatureJSON struct {
+	SigAlg    uint8  `json:"sigAlg"`
+	PublicKey string `json:"publicKey"`
+	Signature string `json:"signature"`
+}
+
+type multisigSignatureJSON struct {
+	KeyIndex  uint8  `json:"keyIndex"`
+	SigAlg    uint8  `json:"sigAlg"`
+	Signature string `json:"signature"`
+}
+
+func (tx *QuantumTransaction) toMultisigSignatureJSON(sig *crypto.QRSignature) *multisigSignatureJSON {
+	return &multisigSignatureJSON{
+		KeyIndex:  uint8(tx.Multisig.KeyIndex(sig.PublicKey)),
+		SigAlg:    uint8(sig.Algorithm),
+		Signature: "0x" + hex.EncodeToString(sig.Signature),
+	}
+}
+
+// toQRSignature resolves the public key of the signature from the policy
+func (sigData *multisigSignatureJSON) toQRSignature(policy *MultisigPolicy) (*crypto.QRSignature, error) {
+	if int(sigData.KeyIndex) >= len(policy.Keys) {
+		return nil, fmt.Errorf("%w: key index %d of %d keys", ErrNotMultisigSigner, sigData.KeyIndex, len(policy.Keys))
+	}
+	signature, err := hex.DecodeString(strings.TrimPrefix(sigData.Signature, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	return &crypto.QRSignature{
+		Algorithm: crypto.SignatureAlgorithm(sigData.SigAlg),
+		Signature: signature,
+		PublicKey: policy.Keys[sigData.KeyIndex].PublicKey,
+	}, nil
+}
+
+func toQRSignatureJSON(sig *crypto.QRSignature) *qrSignatureJSON {
+	return &qrSignatureJSON{
+		SigAlg:    uint8(sig.Algorithm),
+		PublicKey: "0x" + hex.EncodeToString(sig.PublicKey),
+		Signature: "0x" + hex.EncodeToString(sig.Signature),
+	}
+}
+
+func (sigData *qrSignatureJSON) toQRSignature() (*crypto.QRSignature, error) {
+	publicKey, err := hex.DecodeString(strings.TrimPrefix(sigData.PublicKey, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature public key: %w", err)
+	}
+	signature, err := hex.DecodeString(strings.TrimPrefix(sigData.Signature, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	return &crypto.QRSignature{
+		Algorithm: crypto.SignatureAlgorithm(sigData.SigAlg),
+		Signature: signature,
+		PublicKey: publicKey,
+	}, nil
+}
@@ -0,0 +1,67 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"quantum-blockchain/chain/crypto"
+)
+
+// NewKeyRotationTransaction creates a transaction that binds a new public key
+// and algorithm to the address of its sender. It is signed by the current key.
+func NewKeyRotationTransaction(chainID *big.Int, nonce uint64, newSigAlg crypto.SignatureAlgorithm, newPublicKey []byte, gasLimit uint64, gasPrice *big.Int) *QuantumTransaction {
+	return &QuantumTransaction{
+		Type:         TxTypeKeyRotation,
+		ChainID:      chainID,
+		Nonce:        nonce,
+		GasPrice:     gasPrice,
+		Gas:          gasLimit,
+		Value:        new(big.Int),
+		NewSigAlg:    newSigAlg,
+		NewPublicKey: newPublicKey,
+	}
+}
+
+// IsKeyRotation returns true if the transaction rotates the key of its sender
+func (tx *QuantumTransaction) IsKeyRotation() bool {
+	return tx.Type == TxTypeKeyRotation
+}
+
+// SetSender sends the transaction from addr instead of the address derived
+// from the signing key. It is needed once the key of addr has been rotated
+// and must be called before signing.
+func (tx *QuantumTransaction) SetSender(addr Address) {
+	tx.Sender = &addr
+	tx.from = Address{}
+	tx.hash = Hash{}
+	tx.size = 0
+}
+
+// ValidateKeyRotation checks that a key rotation transaction is well formed
+func (tx *QuantumTransaction) ValidateKeyRotation() error {
+	if !tx.IsKeyRotation() {
+		return nil
+	}
+	if tx.IsMultisig() {
+		return errors.New("multisig accounts can not rotate keys")
+	}
+	if tx.To != nil || tx.GetValue().Sign() != 0 || len(tx.Data) != 0 {
+		return errors.New("key rotation can not call, transfer or carry data")
+	}
+	size, err := crypto.GetPublicKeySize(tx.NewSigAlg)
+	if err != nil {
+		return fmt.Errorf("invalid key rotation: %w", err)
+	}
+	if len(tx.NewPublicKey) != size {
+		return fmt.Errorf("invalid key rotation: public key has %d bytes, want %d", len(tx.NewPublicKey), size)
+	}
+	return nil
+}
+
+// keyRotationSigningData returns the new key for the signing hash
+func (tx *QuantumTransaction) keyRotationSigningData() []byte {
+	data := []byte{byte(tx.Type), byte(tx.NewSigAlg)}
+	data = append(data, uint64ToBytes(uint64(len(tx.NewPublicKey)))...)
+	return append(data, tx.NewPublicKey...)
+}
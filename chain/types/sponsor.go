@@ -0,0 +1,131 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"quantum-blockchain/chain/crypto"
+)
+
+var (
+	// ErrMissingFeePayerSignature is returned when a sponsored transaction has not been signed by its fee payer
+	ErrMissingFeePayerSignature = errors.New("missing fee payer signature")
+
+	// ErrFeePayerMismatch is returned when the fee payer public key does not derive the fee payer address
+	// of an account that never rotated its key
+	ErrFeePayerMismatch = errors.New("fee payer public key does not match fee payer address")
+)
+
+// feePayerDomain separates fee payer signatures from sender signatures
+const feePayerDomain = byte(0x50)
+
+// IsSponsored returns true if the gas of the transaction is paid by a fee payer
+func (tx *QuantumTransaction) IsSponsored() bool {
+	return tx.FeePayer != nil
+}
+
+// SetFeePayer names the account that pays the gas of the transaction. It must
+// be called before the sender signs, the sender signature commits to it.
+func (tx *QuantumTransaction) SetFeePayer(feePayer Address) {
+	tx.FeePayer = &feePayer
+	tx.hash = Hash{}
+	tx.size = 0
+}
+
+// GasPayer returns the account charged for gas, the fee payer of sponsored
+// transactions and the sender otherwise
+func (tx *QuantumTransaction) GasPayer() Address {
+	if tx.IsSponsored() {
+		return *tx.FeePayer
+	}
+	return tx.From()
+}
+
+// FeePayerSigningHash returns the hash signed by the fee payer. It covers the
+// sender-signed payload together with the sender signature, so the fee payer
+// only pays for the exact transaction the sender authorized.
+func (tx *QuantumTransaction) FeePayerSigningHash() Hash {
+	data := []byte{feePayerDomain}
+	data = append(data, tx.SigningHash().Bytes()...)
+	data = append(data, byte(tx.SigAlg))
+	data = append(data, tx.Signature...)
+	return BytesToHash(Keccak256(data))
+}
+
+// SignAsFeePayer adds the fee payer signature to a transaction already signed
+// by its sender. Whether the key is bound to the fee payer depends on its key
+// rotations and is checked against the state, see evm.CheckFeePayerKey.
+func (tx *QuantumTransaction) SignAsFeePayer(privateKey []byte, algorithm crypto.SignatureAlgorithm) error {
+	if !tx.IsSponsored() {
+		return errors.New("transaction has no fee payer")
+	}
+	if len(tx.Signature) == 0 {
+		return errors.New("transaction must be signed by its sender first")
+	}
+
+	qrSig, err := crypto.SignMessage(tx.FeePayerSigningHash().Bytes(), algorithm, privateKey)
+	if err != nil {
+		return err
+	}
+
+	tx.FeePayerSigAlg = qrSig.Algorithm
+	tx.FeePayerSignature = qrSig.Signature
+	tx.FeePayerPublicKey = qrSig.PublicKey
+
+	// The fee payer signature is part of the transaction hash
+	tx.hash = Hash{}
+	tx.size = 0
+	tx.hash = tx.Hash()
+
+	return nil
+}
+
+// VerifyFeePayerSignature verifies the fee payer signature of a sponsored
+// transaction against the public key it carries
+func (tx *QuantumTransaction) VerifyFeePayerSignature() (bool, error) {
+	if len(tx.FeePayerSignature) == 0 || len(tx.FeePayerPublicKey) == 0 {
+		return false, ErrMissingFeePayerSignature
+	}
+
+	qrSig := &crypto.QRSignature{
+		Algorithm: tx.FeePayerSigAlg,
+		Signature: tx.FeePayerSignature,
+		PublicKey: tx.FeePayerPublicKey,
+	}
+	return crypto.VerifySignature(tx.FeePayerSigningHash().Bytes(), qrSig)
+}
+
+// CheckBalances checks that the gas payer can pay for gas and the sender for
+// the transferred value. balanceOf returns the balance of an account.
+func (tx *QuantumTransaction) CheckBalances(balanceOf func(Address) *big.Int) error {
+	gasCost := new(big.Int).Mul(new(big.Int).SetUint64(tx.GetGas()), tx.GetGasPrice())
+	value := tx.GetValue()
+	from, payer := tx.From(), tx.GasPayer()
+
+	if payer == from {
+		cost := new(big.Int).Add(gasCost, value)
+		if balance := balanceOf(from); balance.Cmp(cost) < 0 {
+			return fmt.Errorf("%w for transaction from %s: balance=%s, cost=%s", ErrInsufficientBalance, from.Hex(), balance, cost)
+		}
+		return nil
+	}
+
+	if balance := balanceOf(payer); balance.Cmp(gasCost) < 0 {
+		return fmt.Errorf("%w of fee payer %s: balance=%s, gas cost=%s", ErrInsufficientBalance, payer.Hex(), balance, gasCost)
+	}
+	if balance := balanceOf(from); balance.Cmp(value) < 0 {
+		return fmt.Errorf("%w of sender %s: balance=%s, value=%s", ErrInsufficientBalance, from.Hex(), balance, value)
+	}
+	return nil
+}
+
+// feePayerSigningData returns the fee payer address for the sender signing hash
+func (tx *QuantumTransaction) feePayerSigningData() []byte {
+	return append([]byte{feePayerDomain}, tx.FeePayer.Bytes()...)
+}
+
+// feePayerSize returns the encoded size of the fee payer fields
+func (tx *QuantumTransaction) feePayerSize() uint64 {
+	return 20 + 1 + uint64(len(tx.FeePayerPublicKey)) + uint64(len(tx.FeePayerSignature))
+}
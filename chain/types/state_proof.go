@@ -0,0 +1,293 @@
+package types
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// ErrInvalidProof is returned when a state proof does not match the state
+// root it is checked against
+var ErrInvalidProof = errors.New("invalid state proof")
+
+// StateAccount is the state of an account the state root commits to
+type StateAccount struct {
+	Address     Address  `json:"address"`
+	Balance     *big.Int `json:"balance"`
+	Nonce       uint64   `json:"nonce"`
+	CodeHash    Hash     `json:"codeHash"`    // Zero without code
+	StorageRoot Hash     `json:"storageRoot"` // Zero without storage
+}
+
+// Empty reports whether the account has no balance, nonce, code or storage.
+// Empty accounts are left out of the state root.
+func (a *StateAccount) Empty() bool {
+	return (a.Balance == nil || a.Balance.Sign() == 0) && a.Nonce == 0 && a.CodeHash.IsZero() && a.StorageRoot.IsZero()
+}
+
+// Copy returns a copy of the account
+func (a *StateAccount) Copy() *StateAccount {
+	cpy := *a
+	cpy.Balance = new(big.Int)
+	if a.Balance != nil {
+		cpy.Balance.Set(a.Balance)
+	}
+	return &cpy
+}
+
+// Hash returns the leaf of the account in the state tree
+func (a *StateAccount) Hash() Hash {
+	balance := a.Balance
+	if balance == nil {
+		balance = new(big.Int)
+	}
+	data := make([]byte, 0, AddressLength+HashLength+8+2*HashLength)
+	data = append(data, a.Address.Bytes()...)
+	data = append(data, BytesToHash(balance.Bytes()).Bytes()...)
+	data = binary.BigEndian.AppendUint64(data, a.Nonce)
+	data = append(data, a.CodeHash.Bytes()...)
+	data = append(data, a.StorageRoot.Bytes()...)
+	return Keccak256Hash(data)
+}
+
+// stateTreeDepth is the depth of the state tree, whose leaves are at the
+// paths of the account addresses
+const stateTreeDepth = AddressLength * 8
+
+// storageTreeDepth is the depth of a storage tree, whose leaves are at the
+// paths of the storage slots
+const storageTreeDepth = HashLength * 8
+
+// StateTree is the tree of the accounts of a state the state root commits to.
+// It is a sparse Merkle tree by address, so an update only hashes the path to
+// its leaf again. Trees are not changed by updates, which return a new tree
+// sharing the unchanged nodes with the one before.
+type StateTree struct {
+	tree sparseTree
+}
+
+// NewStateTree returns the tree of a state of no accounts
+func NewStateTree() *StateTree {
+	return &StateTree{tree: sparseTree{depth: stateTreeDepth}}
+}
+
+// Update returns the tree with the state of an account, leaving the account
+// out when it is empty
+func (t *StateTree) Update(account *StateAccount) *StateTree {
+	var leaf *treeNode
+	if !account.Empty() {
+		leaf = &treeNode{hash: account.Hash(), account: account.Copy()}
+	}
+	return &StateTree{tree: t.tree.update(account.Address.Bytes(), leaf)}
+}
+
+// Root returns the state root, zero without accounts
+func (t *StateTree) Root() Hash {
+	return t.tree.root.Hash()
+}
+
+// Prove builds the proof of the state of an account in the tree
+func (t *StateTree) Prove(address Address) *AccountProof {
+	leaf, siblings := t.tree.branch(address.Bytes())
+	proof := &AccountProof{Address: address, Bitmap: make([]byte, stateTreeDepth/8), Siblings: []Hash{}}
+	if leaf != nil {
+		proof.Account = leaf.account.Copy()
+	}
+	for level, sibling := range siblings {
+		if !sibling.IsZero() {
+			proof.Bitmap[level/8] |= 1 << (level % 8)
+			proof.Siblings = append(proof.Siblings, sibling)
+		}
+	}
+	return proof
+}
+
+// StorageTree is the tree of the storage slots of a contract its storage root
+// commits to, a sparse Merkle tree by slot like StateTree
+type StorageTree struct {
+	tree sparseTree
+}
+
+// NewStorageTree returns the tree of a contract without storage
+func NewStorageTree() *StorageTree {
+	return &StorageTree{tree: sparseTree{depth: storageTreeDepth}}
+}
+
+// Update returns the tree with the value of a slot, leaving the slot out when
+// it is zero
+func (t *StorageTree) Update(slot, value Hash) *StorageTree {
+	var leaf *treeNode
+	if !value.IsZero() {
+		leaf = &treeNode{hash: Keccak256Hash(append(slot.Bytes(), value.Bytes()...))}
+	}
+	return &StorageTree{tree: t.tree.update(slot.Bytes(), leaf)}
+}
+
+// Root returns the storage root, zero without storage
+func (t *StorageTree) Root() Hash {
+	return t.tree.root.Hash()
+}
+
+// CalculateStateRoot returns the state root of the accounts, empty ones are
+// left out
+func CalculateStateRoot(accounts []*StateAccount) Hash {
+	return buildStateTree(accounts).Root()
+}
+
+// CalculateStorageRoot returns the root of the non-zero storage slots of a
+// contract, zero without any
+func CalculateStorageRoot(storage map[Hash]Hash) Hash {
+	tree := NewStorageTree()
+	for slot, value := range storage {
+		tree = tree.Update(slot, value)
+	}
+	return tree.Root()
+}
+
+func buildStateTree(accounts []*StateAccount) *StateTree {
+	tree := NewStateTree()
+	for _, account := range accounts {
+		tree = tree.Update(account)
+	}
+	return tree
+}
+
+// AccountProof proves the state of an account against a state root by the
+// branch from the leaf at its address to the root. An account missing from
+// the state is proven by an empty leaf.
+type AccountProof struct {
+	Address  Address       `json:"address"`
+	Account  *StateAccount `json:"account,omitempty"` // Nil if missing from the state
+	Bitmap   []byte        `json:"bitmap"`            // Bit i is set if the sibling i levels above the leaf is not zero
+	Siblings []Hash        `json:"siblings"`          // Siblings that are not zero, from the leaf up
+}
+
+// NewAccountProof builds the proof of an address from the accounts of a state
+func NewAccountProof(accounts []*StateAccount, address Address) *AccountProof {
+	return buildStateTree(accounts).Prove(address)
+}
+
+// Verify checks the proof against a state root and returns the state of the
+// account, empty if the proof shows it is missing from the state
+func (p *AccountProof) Verify(root Hash) (*StateAccount, error) {
+	leaf := ZeroHash
+	if p.Account != nil {
+		if p.Account.Address != p.Address {
+			return nil, fmt.Errorf("%w: proof of account %s for %s", ErrInvalidProof, p.Account.Address.Hex(), p.Address.Hex())
+		}
+		if p.Account.Empty() {
+			return nil, fmt.Errorf("%w: empty account %s in the state", ErrInvalidProof, p.Address.Hex())
+		}
+		leaf = p.Account.Hash()
+	}
+	if len(p.Bitmap) != stateTreeDepth/8 {
+		return nil, fmt.Errorf("%w: malformed bitmap", ErrInvalidProof)
+	}
+
+	node, siblings := leaf, p.Siblings
+	key := p.Address.Bytes()
+	for level := 0; level < stateTreeDepth; level++ {
+		sibling := ZeroHash
+		if p.Bitmap[level/8]&(1<<(level%8)) != 0 {
+			if len(siblings) == 0 {
+				return nil, fmt.Errorf("%w: missing sibling", ErrInvalidProof)
+			}
+			sibling, siblings = siblings[0], siblings[1:]
+		}
+		if keyBit(key, stateTreeDepth-1-level) {
+			node = hashChildren(sibling, node)
+		} else {
+			node = hashChildren(node, sibling)
+		}
+	}
+	if len(siblings) != 0 || node != root {
+		return nil, fmt.Errorf("%w: account %s does not match state root %s", ErrInvalidProof, p.Address.Hex(), root.Hex())
+	}
+
+	if p.Account == nil {
+		return &StateAccount{Address: p.Address, Balance: new(big.Int)}, nil
+	}
+	return p.Account, nil
+}
+
+// sparseTree is a Merkle tree of a fixed depth with a leaf at the path of
+// every key. Empty subtrees hash to zero and are left out, so the tree only
+// holds the paths to the leaves that are set.
+type sparseTree struct {
+	depth int
+	root  *treeNode
+}
+
+// treeNode is a node of a sparse tree, a leaf at the depth of the tree
+type treeNode struct {
+	hash        Hash
+	left, right *treeNode
+	account     *StateAccount // State of the account of a leaf of a state tree
+}
+
+// Hash returns the hash of the node, zero for an empty subtree
+func (n *treeNode) Hash() Hash {
+	if n == nil {
+		return ZeroHash
+	}
+	return n.hash
+}
+
+// update returns the tree with the leaf of a key set, a nil leaf removes it.
+// The nodes off the path to the leaf are shared with the tree before.
+func (t sparseTree) update(key []byte, leaf *treeNode) sparseTree {
+	return sparseTree{depth: t.depth, root: t.set(t.root, key, 0, leaf)}
+}
+
+func (t sparseTree) set(node *treeNode, key []byte, level int, leaf *treeNode) *treeNode {
+	if level == t.depth {
+		return leaf
+	}
+
+	var left, right *treeNode
+	if node != nil {
+		left, right = node.left, node.right
+	}
+	if keyBit(key, level) {
+		right = t.set(right, key, level+1, leaf)
+	} else {
+		left = t.set(left, key, level+1, leaf)
+	}
+	if left == nil && right == nil {
+		return nil
+	}
+	return &treeNode{hash: hashChildren(left.Hash(), right.Hash()), left: left, right: right}
+}
+
+// branch returns the leaf of a key, nil if it is not set, and its siblings
+// from the leaf up
+func (t sparseTree) branch(key []byte) (*treeNode, []Hash) {
+	siblings := make([]Hash, t.depth)
+	node := t.root
+	for level := 0; level < t.depth && node != nil; level++ {
+		if keyBit(key, level) {
+			siblings[t.depth-1-level] = node.left.Hash()
+			node = node.right
+		} else {
+			siblings[t.depth-1-level] = node.right.Hash()
+			node = node.left
+		}
+	}
+	return node, siblings
+}
+
+// keyBit reports whether the bit of a key at a level of the tree is set, the
+// highest bit branches at the root
+func keyBit(key []byte, level int) bool {
+	return key[level/8]>>(7-level%8)&1 == 1
+}
+
+// hashChildren returns the hash of a node from the hashes of its children,
+// zero for two empty subtrees
+func hashChildren(left, right Hash) Hash {
+	if left.IsZero() && right.IsZero() {
+		return ZeroHash
+	}
+	return Keccak256Hash(append(left.Bytes(), right.Bytes()...))
+}
@@ -144,6 +144,14 @@ func (ts *TokenSupply) Burn(addr Address, amount *big.Int) error {
 	return nil
 }
 
+// RecordBurn records tokens burned by being taken out of the state, such as
+// the base fee of transactions that is charged and credited to no one
+func (ts *TokenSupply) RecordBurn(amount *big.Int) {
+	ts.Burned.Add(ts.Burned, amount)
+	ts.Circulating.Sub(ts.Circulating, amount)
+	ts.LastUpdate = time.Now()
+}
+
 // StateDBInterface allows TokenSupply to update the persistent state
 type StateDBInterface interface {
 	GetBalance(addr Address) *big.Int
@@ -241,6 +249,12 @@ const (
 	// Block gas limit (higher for throughput)
 	DefaultBlockGasLimit = 50000000 // 50M gas per block
 
+	// Maximum encoded block size, room for about 500 Dilithium transfers
+	MaxBlockSize = 2 * 1024 * 1024 // 2 MiB per block
+
+	// Maximum encoded transaction size
+	MaxTransactionSize = 32 * 1024 // 32 KiB per transaction
+
 	// Block time target (fast like Flare)
 	TargetBlockTime = 2 * time.Second // 2-second blocks
 
@@ -3,7 +3,10 @@ package types
 import (
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"math/big"
+	"strconv"
 	"strings"
 
 	"quantum-blockchain/chain/crypto"
@@ -15,11 +18,17 @@ import (
 type TransactionType uint8
 
 const (
-	TxTypeQuantum TransactionType = 0x42 // Quantum-resistant transaction type
+	TxTypeQuantum     TransactionType = 0x42 // Quantum-resistant transaction type
+	TxTypeDynamicFee  TransactionType = 0x43 // Quantum-resistant transaction with EIP-1559 fee caps
+	TxTypeBatch       TransactionType = 0x44 // Quantum-resistant transaction carrying multiple calls
+	TxTypeKeyRotation TransactionType = 0x45 // Binds a new public key to the address of the sender
+	TxTypeEncrypted   TransactionType = 0x46 // Payload encrypted to the epoch key of the validators
+	TxTypeUnjail      TransactionType = 0x47 // Returns a jailed validator to the active set
 )
 
 // QuantumTransaction represents a quantum-resistant transaction
 type QuantumTransaction struct {
+	Type       TransactionType           `json:"type"`
 	ChainID    *big.Int                  `json:"chainId"`
 	Nonce      uint64                    `json:"nonce"`
 	GasPrice   *big.Int                  `json:"gasPrice"`
@@ -32,6 +41,37 @@ type QuantumTransaction struct {
 	Signature  []byte                    `json:"signature"`
 	KemCapsule []byte                    `json:"kemCapsule,omitempty"` // Optional KEM encapsulation
 
+	// Dynamic fee fields, only set for TxTypeDynamicFee
+	GasTipCap *big.Int `json:"maxPriorityFeePerGas,omitempty"`
+	GasFeeCap *big.Int `json:"maxFeePerGas,omitempty"`
+
+	// Batch fields, only set for TxTypeBatch
+	Calls     []*BatchCall `json:"calls,omitempty"`
+	BatchMode BatchMode    `json:"batchMode,omitempty"`
+
+	// Sponsorship fields, the fee payer pays for gas and signs after the sender
+	FeePayer          *Address                  `json:"feePayer,omitempty"`
+	FeePayerSigAlg    crypto.SignatureAlgorithm `json:"feePayerSigAlg,omitempty"`
+	FeePayerPublicKey []byte                    `json:"feePayerPublicKey,omitempty"`
+	FeePayerSignature []byte                    `json:"feePayerSignature,omitempty"`
+
+	// Multisig fields, set instead of the single signature for multisig senders
+	Multisig           *MultisigPolicy       `json:"multisig,omitempty"`
+	MultisigSignatures []*crypto.QRSignature `json:"multisigSignatures,omitempty"`
+
+	// Sending account, only set once its key no longer derives its address
+	Sender *Address `json:"sender,omitempty"`
+
+	// Key rotation fields, only set for TxTypeKeyRotation
+	NewSigAlg    crypto.SignatureAlgorithm `json:"newSigAlg,omitempty"`
+	NewPublicKey []byte                    `json:"newPublicKey,omitempty"`
+
+	// Epoch of the validator keys the payload key is shared to and its shares,
+	// any KeyThreshold of which recover it; only set for TxTypeEncrypted
+	EncryptionEpoch uint64      `json:"encryptionEpoch,omitempty"`
+	KeyThreshold    uint8       `json:"keyThreshold,omitempty"`
+	KeyShares       []*KeyShare `json:"keyShares,omitempty"`
+
 	// Computed fields
 	hash Hash    // Internal field, not exposed in JSON
 	size uint64  // Internal field, not exposed in JSON
@@ -51,6 +91,23 @@ func NewQuantumTransaction(chainID *big.Int, nonce uint64, to *Address, value *b
 	}
 }
 
+// NewDynamicFeeTransaction creates a transaction that pays the block base fee
+// plus a tip of at most gasTipCap, never more than gasFeeCap per gas in total
+func NewDynamicFeeTransaction(chainID *big.Int, nonce uint64, to *Address, value *big.Int, gasLimit uint64, gasTipCap, gasFeeCap *big.Int, data []byte) *QuantumTransaction {
+	return &QuantumTransaction{
+		Type:      TxTypeDynamicFee,
+		ChainID:   chainID,
+		Nonce:     nonce,
+		GasPrice:  new(big.Int).Set(gasFeeCap),
+		Gas:       gasLimit,
+		To:        to,
+		Value:     value,
+		Data:      data,
+		GasTipCap: gasTipCap,
+		GasFeeCap: gasFeeCap,
+	}
+}
+
 // SignTransaction signs a transaction with the given private key and algorithm
 func (tx *QuantumTransaction) SignTransaction(privateKey []byte, algorithm crypto.SignatureAlgorithm) error {
 	// Compute transaction hash for signing
@@ -67,7 +124,8 @@ func (tx *QuantumTransaction) SignTransaction(privateKey []byte, algorithm crypt
 	tx.PublicKey = qrSig.PublicKey
 
 	// Compute sender address
-	tx.from = PublicKeyToAddress(tx.PublicKey)
+	tx.from = Address{}
+	tx.From()
 
 	// Compute transaction hash
 	tx.hash = tx.Hash()
@@ -75,20 +133,32 @@ func (tx *QuantumTransaction) SignTransaction(privateKey []byte, algorithm crypt
 	return nil
 }
 
-// VerifySignature verifies the transaction signature
+// VerifySignature verifies the transaction signature, or the signatures of a
+// multisig sender against its policy, and the fee payer signature of
+// sponsored transactions
 func (tx *QuantumTransaction) VerifySignature() (bool, error) {
-	if len(tx.Signature) == 0 || len(tx.PublicKey) == 0 {
-		return false, nil
-	}
+	var valid bool
+	var err error
+	if tx.IsMultisig() {
+		valid, err = tx.VerifyMultisig()
+	} else {
+		if len(tx.Signature) == 0 || len(tx.PublicKey) == 0 {
+			return false, nil
+		}
 
-	qrSig := &crypto.QRSignature{
-		Algorithm: tx.SigAlg,
-		Signature: tx.Signature,
-		PublicKey: tx.PublicKey,
-	}
+		qrSig := &crypto.QRSignature{
+			Algorithm: tx.SigAlg,
+			Signature: tx.Signature,
+			PublicKey: tx.PublicKey,
+		}
 
-	sigHash := tx.SigningHash()
-	return crypto.VerifySignature(sigHash.Bytes(), qrSig)
+		sigHash := tx.SigningHash()
+		valid, err = crypto.VerifySignature(sigHash.Bytes(), qrSig)
+	}
+	if err != nil || !valid || !tx.IsSponsored() {
+		return valid, err
+	}
+	return tx.VerifyFeePayerSignature()
 }
 
 // SigningHash returns the hash used for signing
@@ -112,6 +182,48 @@ func (tx *QuantumTransaction) SigningHash() Hash {
 		data = append(data, tx.KemCapsule...)
 	}
 
+	// Dynamic fee transactions commit to their type and fee caps
+	if tx.IsDynamicFee() {
+		data = append(data, byte(tx.Type))
+		data = append(data, tx.GasTipCap.Bytes()...)
+		data = append(data, tx.GasFeeCap.Bytes()...)
+	}
+
+	// Batch transactions commit to their mode and every call
+	if tx.IsBatch() {
+		data = append(data, tx.batchSigningData()...)
+	}
+
+	// Sponsored transactions commit to the account paying for gas
+	if tx.IsSponsored() {
+		data = append(data, tx.feePayerSigningData()...)
+	}
+
+	// Multisig transactions commit to the policy of the sending account
+	if tx.IsMultisig() {
+		data = append(data, tx.multisigSigningData()...)
+	}
+
+	// Transactions of rotated accounts commit to the sending account
+	if tx.Sender != nil {
+		data = append(data, tx.Sender.Bytes()...)
+	}
+
+	// Key rotations commit to the new key
+	if tx.IsKeyRotation() {
+		data = append(data, tx.keyRotationSigningData()...)
+	}
+
+	// Encrypted transactions commit to the epoch key of their payload
+	if tx.IsEncrypted() {
+		data = append(data, tx.encryptedSigningData()...)
+	}
+
+	// Unjail transactions commit to their type
+	if tx.IsUnjail() {
+		data = append(data, byte(tx.Type))
+	}
+
 	return BytesToHash(Keccak256(data))
 }
 
@@ -126,6 +238,13 @@ func (tx *QuantumTransaction) Hash() Hash {
 	data = append(data, tx.SigningHash().Bytes()...)
 	data = append(data, byte(tx.SigAlg))
 	data = append(data, tx.Signature...)
+	if tx.IsMultisig() {
+		data = append(data, tx.multisigSignatureData()...)
+	}
+	if tx.IsSponsored() {
+		data = append(data, byte(tx.FeePayerSigAlg))
+		data = append(data, tx.FeePayerSignature...)
+	}
 
 	tx.hash = BytesToHash(Keccak256(data))
 	return tx.hash
@@ -133,8 +252,14 @@ func (tx *QuantumTransaction) Hash() Hash {
 
 // From returns the sender address
 func (tx *QuantumTransaction) From() Address {
-	if tx.from.IsZero() && len(tx.PublicKey) > 0 {
-		tx.from = PublicKeyToAddress(tx.PublicKey)
+	if tx.from.IsZero() {
+		if tx.Sender != nil {
+			tx.from = *tx.Sender
+		} else if tx.IsMultisig() {
+			tx.from = tx.Multisig.Address()
+		} else if len(tx.PublicKey) > 0 {
+			tx.from = PublicKeyToAddress(tx.PublicKey)
+		}
 	}
 	return tx.from
 }
@@ -165,21 +290,95 @@ func (tx *QuantumTransaction) calculateSize() uint64 {
 	size += uint64(len(tx.Signature))  // Signature
 	size += uint64(len(tx.KemCapsule)) // KemCapsule
 
+	if tx.IsDynamicFee() {
+		size += 1 + 32 + 32 // Type, GasTipCap and GasFeeCap
+	}
+	if tx.IsBatch() {
+		size += tx.batchSize()
+	}
+	if tx.IsSponsored() {
+		size += tx.feePayerSize()
+	}
+	if tx.IsMultisig() {
+		size += tx.multisigSize()
+	}
+	if tx.Sender != nil {
+		size += 20
+	}
+	if tx.IsKeyRotation() {
+		size += 1 + 1 + uint64(len(tx.NewPublicKey)) // Type, NewSigAlg and NewPublicKey
+	}
+	if tx.IsEncrypted() {
+		size += 1 + 8 + uint64(tx.KeySharesSize()) // Type, EncryptionEpoch, KeyThreshold and KeyShares
+	}
+	if tx.IsUnjail() {
+		size += 1 // Type
+	}
+
 	return size
 }
 
-// GasPrice returns the gas price
+// GasPrice returns the gas price, which is the fee cap for dynamic fee transactions
 func (tx *QuantumTransaction) GetGasPrice() *big.Int {
+	if tx.IsDynamicFee() {
+		return new(big.Int).Set(tx.GasFeeCap)
+	}
+	return new(big.Int).Set(tx.GasPrice)
+}
+
+// IsDynamicFee returns true if the transaction uses EIP-1559 fee caps
+func (tx *QuantumTransaction) IsDynamicFee() bool {
+	return tx.Type == TxTypeDynamicFee
+}
+
+// GetGasTipCap returns the maximum tip per gas, the gas price for legacy transactions
+func (tx *QuantumTransaction) GetGasTipCap() *big.Int {
+	if tx.IsDynamicFee() {
+		return new(big.Int).Set(tx.GasTipCap)
+	}
 	return new(big.Int).Set(tx.GasPrice)
 }
 
+// GetGasFeeCap returns the maximum fee per gas, the gas price for legacy transactions
+func (tx *QuantumTransaction) GetGasFeeCap() *big.Int {
+	if tx.IsDynamicFee() {
+		return new(big.Int).Set(tx.GasFeeCap)
+	}
+	return new(big.Int).Set(tx.GasPrice)
+}
+
+// EffectiveGasTip returns the tip per gas paid to the block producer at the given base fee
+func (tx *QuantumTransaction) EffectiveGasTip(baseFee *big.Int) (*big.Int, error) {
+	return EffectiveGasTip(tx.GetGasFeeCap(), tx.GetGasTipCap(), baseFee)
+}
+
+// ValidateFees checks that the fee fields of a transaction are consistent
+func (tx *QuantumTransaction) ValidateFees() error {
+	if !tx.IsDynamicFee() {
+		return nil
+	}
+	if tx.GasTipCap == nil || tx.GasFeeCap == nil {
+		return errors.New("dynamic fee transaction is missing its fee caps")
+	}
+	if tx.GasTipCap.Sign() < 0 || tx.GasFeeCap.Sign() < 0 {
+		return errors.New("fee caps must not be negative")
+	}
+	if tx.GasFeeCap.Cmp(tx.GasTipCap) < 0 {
+		return fmt.Errorf("max priority fee per gas %s higher than max fee per gas %s", tx.GasTipCap, tx.GasFeeCap)
+	}
+	return nil
+}
+
 // Gas returns the gas limit
 func (tx *QuantumTransaction) GetGas() uint64 {
 	return tx.Gas
 }
 
-// Value returns the transaction value
+// Value returns the transaction value, the total of all calls for batch transactions
 func (tx *QuantumTransaction) GetValue() *big.Int {
+	if tx.IsBatch() {
+		return tx.batchValue()
+	}
 	return new(big.Int).Set(tx.Value)
 }
 
@@ -205,13 +404,14 @@ func (tx *QuantumTransaction) GetChainID() *big.Int {
 
 // IsContractCreation returns true if the transaction creates a contract
 func (tx *QuantumTransaction) IsContractCreation() bool {
-	return tx.To == nil
+	return tx.To == nil && !tx.IsBatch() && !tx.IsKeyRotation() && !tx.IsEncrypted() && !tx.IsUnjail()
 }
 
 // MarshalJSON marshals the transaction to JSON
 func (tx *QuantumTransaction) MarshalJSON() ([]byte, error) {
 	type txJSON struct {
 		Hash       string `json:"hash"`
+		Type       string `json:"type,omitempty"`
 		ChainID    string `json:"chainId"`
 		Nonce      string `json:"nonce"`
 		GasPrice   string `json:"gasPrice"`
@@ -225,6 +425,28 @@ func (tx *QuantumTransaction) MarshalJSON() ([]byte, error) {
 		KemCapsule string `json:"kemCapsule,omitempty"`
 		From       string `json:"from"`
 		Size       string `json:"size"`
+
+		MaxPriorityFeePerGas string `json:"maxPriorityFeePerGas,omitempty"`
+		MaxFeePerGas         string `json:"maxFeePerGas,omitempty"`
+
+		Calls     []*BatchCall `json:"calls,omitempty"`
+		BatchMode string       `json:"batchMode,omitempty"`
+
+		FeePayer          string `json:"feePayer,omitempty"`
+		FeePayerSigAlg    uint8  `json:"feePayerSigAlg,omitempty"`
+		FeePayerPublicKey string `json:"feePayerPublicKey,omitempty"`
+		FeePayerSignature string `json:"feePayerSignature,omitempty"`
+
+		Multisig           *MultisigPolicy          `json:"multisig,omitempty"`
+		MultisigSignatures []*multisigSignatureJSON `json:"multisigSignatures,omitempty"`
+
+		Sender       string `json:"sender,omitempty"`
+		NewSigAlg    uint8  `json:"newSigAlg,omitempty"`
+		NewPublicKey string `json:"newPublicKey,omitempty"`
+
+		EncryptionEpoch string      `json:"encryptionEpoch,omitempty"`
+		KeyThreshold    uint8       `json:"keyThreshold,omitempty"`
+		KeyShares       []*KeyShare `json:"keyShares,omitempty"`
 	}
 
 	var toAddr string
@@ -243,6 +465,43 @@ func (tx *QuantumTransaction) MarshalJSON() ([]byte, error) {
 	value.SetFromBig(tx.Value)
 	size := uint256.NewInt(uint64(tx.Size()))
 
+	var txType, tipCap, feeCap, batchMode string
+	if tx.IsDynamicFee() {
+		txType = fmt.Sprintf("0x%x", uint8(tx.Type))
+		tipCap = fmt.Sprintf("0x%x", tx.GasTipCap)
+		feeCap = fmt.Sprintf("0x%x", tx.GasFeeCap)
+	}
+	if tx.IsBatch() {
+		txType = fmt.Sprintf("0x%x", uint8(tx.Type))
+		batchMode = fmt.Sprintf("0x%x", uint8(tx.BatchMode))
+	}
+	var sender, newPublicKey string
+	if tx.Sender != nil {
+		sender = tx.Sender.Hex()
+	}
+	if tx.IsKeyRotation() {
+		txType = fmt.Sprintf("0x%x", uint8(tx.Type))
+		newPublicKey = "0x" + hex.EncodeToString(tx.NewPublicKey)
+	}
+	var encryptionEpoch string
+	if tx.IsEncrypted() {
+		txType = fmt.Sprintf("0x%x", uint8(tx.Type))
+		encryptionEpoch = fmt.Sprintf("0x%x", tx.EncryptionEpoch)
+	}
+	if tx.IsUnjail() {
+		txType = fmt.Sprintf("0x%x", uint8(tx.Type))
+	}
+	var feePayer, feePayerPublicKey, feePayerSignature string
+	if tx.IsSponsored() {
+		feePayer = tx.FeePayer.Hex()
+		feePayerPublicKey = "0x" + hex.EncodeToString(tx.FeePayerPublicKey)
+		feePayerSignature = "0x" + hex.EncodeToString(tx.FeePayerSignature)
+	}
+	var multisigSignatures []*multisigSignatureJSON
+	for _, sig := range tx.MultisigSignatures {
+		multisigSignatures = append(multisigSignatures, tx.toMultisigSignatureJSON(sig))
+	}
+
 	return json.Marshal(&txJSON{
 		Hash:       tx.Hash().Hex(),
 		ChainID:    chainID.Hex(),
@@ -258,6 +517,29 @@ func (tx *QuantumTransaction) MarshalJSON() ([]byte, error) {
 		KemCapsule: "0x" + hex.EncodeToString(tx.KemCapsule),
 		From:       tx.From().Hex(),
 		Size:       size.Hex(),
+
+		Type:                 txType,
+		MaxPriorityFeePerGas: tipCap,
+		MaxFeePerGas:         feeCap,
+
+		Calls:     tx.Calls,
+		BatchMode: batchMode,
+
+		FeePayer:          feePayer,
+		FeePayerSigAlg:    uint8(tx.FeePayerSigAlg),
+		FeePayerPublicKey: feePayerPublicKey,
+		FeePayerSignature: feePayerSignature,
+
+		Multisig:           tx.Multisig,
+		MultisigSignatures: multisigSignatures,
+
+		Sender:       sender,
+		NewSigAlg:    uint8(tx.NewSigAlg),
+		NewPublicKey: newPublicKey,
+
+		EncryptionEpoch: encryptionEpoch,
+		KeyThreshold:    tx.KeyThreshold,
+		KeyShares:       tx.KeyShares,
 	})
 }
 
@@ -265,6 +547,7 @@ func (tx *QuantumTransaction) MarshalJSON() ([]byte, error) {
 func (tx *QuantumTransaction) UnmarshalJSON(data []byte) error {
 	type txJSON struct {
 		Hash       string `json:"hash"`
+		Type       string `json:"type,omitempty"`
 		ChainID    string `json:"chainId"`
 		Nonce      string `json:"nonce"`
 		GasPrice   string `json:"gasPrice"`
@@ -278,6 +561,28 @@ func (tx *QuantumTransaction) UnmarshalJSON(data []byte) error {
 		KemCapsule string `json:"kemCapsule,omitempty"`
 		From       string `json:"from"`
 		Size       string `json:"size"`
+
+		MaxPriorityFeePerGas string `json:"maxPriorityFeePerGas,omitempty"`
+		MaxFeePerGas         string `json:"maxFeePerGas,omitempty"`
+
+		Calls     []*BatchCall `json:"calls,omitempty"`
+		BatchMode string       `json:"batchMode,omitempty"`
+
+		FeePayer          string `json:"feePayer,omitempty"`
+		FeePayerSigAlg    uint8  `json:"feePayerSigAlg,omitempty"`
+		FeePayerPublicKey string `json:"feePayerPublicKey,omitempty"`
+		FeePayerSignature string `json:"feePayerSignature,omitempty"`
+
+		Multisig           *MultisigPolicy          `json:"multisig,omitempty"`
+		MultisigSignatures []*multisigSignatureJSON `json:"multisigSignatures,omitempty"`
+
+		Sender       string `json:"sender,omitempty"`
+		NewSigAlg    uint8  `json:"newSigAlg,omitempty"`
+		NewPublicKey string `json:"newPublicKey,omitempty"`
+
+		EncryptionEpoch string      `json:"encryptionEpoch,omitempty"`
+		KeyThreshold    uint8       `json:"keyThreshold,omitempty"`
+		KeyShares       []*KeyShare `json:"keyShares,omitempty"`
 	}
 
 	var txData txJSON
@@ -285,6 +590,96 @@ func (tx *QuantumTransaction) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
+	// Parse type and fee caps of dynamic fee transactions
+	if txData.Type != "" {
+		txType, err := strconv.ParseUint(strings.TrimPrefix(txData.Type, "0x"), 16, 8)
+		if err != nil {
+			return fmt.Errorf("invalid transaction type: %w", err)
+		}
+		tx.Type = TransactionType(txType)
+	}
+	if tx.IsDynamicFee() {
+		tx.GasTipCap = new(big.Int)
+		tx.GasTipCap.SetString(strings.TrimPrefix(txData.MaxPriorityFeePerGas, "0x"), 16)
+		tx.GasFeeCap = new(big.Int)
+		tx.GasFeeCap.SetString(strings.TrimPrefix(txData.MaxFeePerGas, "0x"), 16)
+	}
+	if tx.IsBatch() {
+		for i, call := range txData.Calls {
+			if call == nil {
+				return fmt.Errorf("batch call %d is empty", i)
+			}
+		}
+		tx.Calls = txData.Calls
+		if txData.BatchMode != "" {
+			mode, err := strconv.ParseUint(strings.TrimPrefix(txData.BatchMode, "0x"), 16, 8)
+			if err != nil {
+				return fmt.Errorf("invalid batch mode: %w", err)
+			}
+			tx.BatchMode = BatchMode(mode)
+		}
+	}
+
+	// Parse fee payer of sponsored transactions
+	if txData.FeePayer != "" {
+		feePayer, err := HexToAddress(txData.FeePayer)
+		if err != nil {
+			return fmt.Errorf("invalid fee payer: %w", err)
+		}
+		tx.FeePayer = &feePayer
+		tx.FeePayerSigAlg = crypto.SignatureAlgorithm(txData.FeePayerSigAlg)
+		if tx.FeePayerPublicKey, err = hex.DecodeString(strings.TrimPrefix(txData.FeePayerPublicKey, "0x")); err != nil {
+			return fmt.Errorf("invalid fee payer public key: %w", err)
+		}
+		if tx.FeePayerSignature, err = hex.DecodeString(strings.TrimPrefix(txData.FeePayerSignature, "0x")); err != nil {
+			return fmt.Errorf("invalid fee payer signature: %w", err)
+		}
+	}
+
+	// Parse sending account and new key of key rotations
+	if txData.Sender != "" {
+		sender, err := HexToAddress(txData.Sender)
+		if err != nil {
+			return fmt.Errorf("invalid sender: %w", err)
+		}
+		tx.Sender = &sender
+	}
+	if tx.IsKeyRotation() {
+		tx.NewSigAlg = crypto.SignatureAlgorithm(txData.NewSigAlg)
+		newPublicKey, err := hex.DecodeString(strings.TrimPrefix(txData.NewPublicKey, "0x"))
+		if err != nil {
+			return fmt.Errorf("invalid new public key: %w", err)
+		}
+		tx.NewPublicKey = newPublicKey
+	}
+	if tx.IsEncrypted() && txData.EncryptionEpoch != "" {
+		epoch, err := strconv.ParseUint(strings.TrimPrefix(txData.EncryptionEpoch, "0x"), 16, 64)
+		if err != nil {
+			return fmt.Errorf("invalid encryption epoch: %w", err)
+		}
+		tx.EncryptionEpoch = epoch
+	}
+	if tx.IsEncrypted() {
+		tx.KeyThreshold = txData.KeyThreshold
+		tx.KeyShares = txData.KeyShares
+	}
+
+	// Parse policy and signatures of multisig senders
+	if txData.Multisig != nil {
+		tx.Multisig = txData.Multisig
+		tx.MultisigSignatures = nil
+		for i, sigData := range txData.MultisigSignatures {
+			if sigData == nil {
+				return fmt.Errorf("multisig signature %d is missing", i)
+			}
+			sig, err := sigData.toQRSignature(tx.Multisig)
+			if err != nil {
+				return fmt.Errorf("invalid multisig signature: %w", err)
+			}
+			tx.MultisigSignatures = append(tx.MultisigSignatures, sig)
+		}
+	}
+
 	// Parse chain ID
 	chainID := new(big.Int)
 	if txData.ChainID != "" {
@@ -0,0 +1,38 @@
+package types
+
+import (
+	"errors"
+	"math/big"
+)
+
+// NewUnjailTransaction creates a transaction that returns its sender, a
+// validator whose jail term is over, to the active validator set
+func NewUnjailTransaction(chainID *big.Int, nonce uint64, gasLimit uint64, gasPrice *big.Int) *QuantumTransaction {
+	return &QuantumTransaction{
+		Type:     TxTypeUnjail,
+		ChainID:  chainID,
+		Nonce:    nonce,
+		GasPrice: gasPrice,
+		Gas:      gasLimit,
+		Value:    new(big.Int),
+	}
+}
+
+// IsUnjail returns true if the transaction unjails its sender
+func (tx *QuantumTransaction) IsUnjail() bool {
+	return tx.Type == TxTypeUnjail
+}
+
+// ValidateUnjail checks that an unjail transaction is well formed
+func (tx *QuantumTransaction) ValidateUnjail() error {
+	if !tx.IsUnjail() {
+		return nil
+	}
+	if tx.IsMultisig() {
+		return errors.New("multisig accounts can not unjail")
+	}
+	if tx.To != nil || tx.GetValue().Sign() != 0 || len(tx.Data) != 0 {
+		return errors.New("unjail can not call, transfer or carry data")
+	}
+	return nil
+}
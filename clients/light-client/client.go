@@ -0,0 +1,314 @@
+// Package lightClient follows the chain without running a node. Starting from
+// a trusted checkpoint it verifies headers by the commit votes of the
+// validator set of their epoch, follows the set from epoch to epoch through
+// the hash the first block of every epoch commits to, and verifies accounts
+// by proofs against the state roots of verified headers.
+package lightClient
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"quantum-blockchain/chain/consensus"
+	"quantum-blockchain/chain/types"
+)
+
+var (
+	// ErrInvalidHeader is returned for headers that do not match the chain
+	// the light client follows
+	ErrInvalidHeader = errors.New("invalid header")
+
+	// ErrUntrustedValidatorSet is returned when the validator set of a new
+	// epoch can not be trusted, because too little of the voting power of the
+	// set before signed its first block
+	ErrUntrustedValidatorSet = errors.New("untrusted validator set")
+)
+
+// Provider serves the headers, commit votes, validator sets and proofs the
+// light client verifies. The wallet SDK client provides them over RPC.
+type Provider interface {
+	GetBlockNumber() (*big.Int, error)
+	GetLightBlock(blockNumber *big.Int) (*types.BlockHeader, []*types.CommitSig, error)
+	GetValidatorSet(epoch uint64) (*consensus.EpochValidatorSet, error)
+	GetAccountProof(address types.Address, blockNumber *big.Int) (*types.AccountProof, error)
+}
+
+// Checkpoint is a block the light client trusts without verifying it, from a
+// source it trusts such as the wallet release
+type Checkpoint struct {
+	Number         uint64     `json:"number"`
+	Hash           types.Hash `json:"hash"`
+	ValidatorsHash types.Hash `json:"validatorsHash"` // Hash of the validator set of the block's epoch
+	EpochBlocks    uint64     `json:"epochBlocks"`
+}
+
+// Client is a light client of the chain
+type Client struct {
+	provider    Provider
+	epochBlocks uint64
+
+	header *types.BlockHeader           // Latest verified header
+	set    *consensus.EpochValidatorSet // Validator set of its epoch
+	mu     sync.RWMutex
+}
+
+// NewClient creates a light client trusting the checkpoint. The provider must
+// serve the checkpoint block and the validator set of its epoch.
+func NewClient(provider Provider, checkpoint *Checkpoint) (*Client, error) {
+	if checkpoint.EpochBlocks == 0 {
+		return nil, errors.New("checkpoint without epoch length")
+	}
+
+	header, _, err := getLightBlock(provider, checkpoint.Number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get checkpoint block: %w", err)
+	}
+	if header.Hash() != checkpoint.Hash {
+		return nil, fmt.Errorf("%w: checkpoint block #%d has hash %s, want %s",
+			ErrInvalidHeader, checkpoint.Number, header.Hash().Hex(), checkpoint.Hash.Hex())
+	}
+
+	epoch := checkpoint.Number / checkpoint.EpochBlocks
+	set, err := provider.GetValidatorSet(epoch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get validator set of epoch %d: %w", epoch, err)
+	}
+	if set.Epoch != epoch || set.Hash() != checkpoint.ValidatorsHash {
+		return nil, fmt.Errorf("%w: validator set of epoch %d does not match the checkpoint", ErrUntrustedValidatorSet, epoch)
+	}
+
+	return &Client{
+		provider:    provider,
+		epochBlocks: checkpoint.EpochBlocks,
+		header:      header,
+		set:         set,
+	}, nil
+}
+
+// Header returns the latest verified header
+func (c *Client) Header() *types.BlockHeader {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.header
+}
+
+// ValidatorSet returns the validator set of the epoch of the latest verified
+// header
+func (c *Client) ValidatorSet() *consensus.EpochValidatorSet {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.set
+}
+
+// Checkpoint returns the latest verified header as a checkpoint to start
+// from next time
+func (c *Client) Checkpoint() *Checkpoint {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return &Checkpoint{
+		Number:         c.header.Number.Uint64(),
+		Hash:           c.header.Hash(),
+		ValidatorsHash: c.set.Hash(),
+		EpochBlocks:    c.epochBlocks,
+	}
+}
+
+// Sync verifies the newest header whose commit votes the provider has,
+// walking through the first block of every epoch in between to follow the
+// validator set, and returns it
+func (c *Client) Sync() (*types.BlockHeader, error) {
+	latest, err := c.provider.GetBlockNumber()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block number: %w", err)
+	}
+	if latest.Sign() == 0 {
+		return c.Header(), nil
+	}
+	// The votes for a block are included in the next one
+	target := latest.Uint64() - 1
+
+	for {
+		trusted := c.Header().Number.Uint64()
+		if target <= trusted {
+			return c.Header(), nil
+		}
+
+		nextEpoch := trusted/c.epochBlocks + 1
+		if first := nextEpoch * c.epochBlocks; first <= target {
+			if err := c.verifyEpochStart(first, target); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return c.verifyLatest(target)
+	}
+}
+
+// verifyLatest verifies the newest header of the current epoch up to target
+// whose commit votes make a quorum. A block includes the votes its proposer
+// knew, so a quorum may only show in an earlier block.
+func (c *Client) verifyLatest(target uint64) (*types.BlockHeader, error) {
+	var lastErr error
+	for number := target; number > c.Header().Number.Uint64(); number-- {
+		header, commit, err := getLightBlock(c.provider, number)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get block #%d: %w", number, err)
+		}
+		err = c.verifyHeader(header, commit, number, c.ValidatorSet())
+		if errors.Is(err, consensus.ErrNoQuorum) {
+			lastErr = err
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		c.header = header
+		c.mu.Unlock()
+		return header, nil
+	}
+	return nil, fmt.Errorf("no block up to #%d with a quorum of commit votes: %w", target, lastErr)
+}
+
+// verifyEpochStart verifies the first block of the next epoch and the
+// validator set it commits to. The votes for the block are cast by the new
+// set, which is trusted when members of the set before holding more than a
+// third of its voting power vote for the block too. A block only carries the
+// votes its proposer knew, so without a quorum for the first block a later
+// block of the epoch up to target with a quorum vouches for it through the
+// parent hashes in between.
+func (c *Client) verifyEpochStart(number, target uint64) error {
+	header, commit, err := getLightBlock(c.provider, number)
+	if err != nil {
+		return fmt.Errorf("failed to get block #%d: %w", number, err)
+	}
+
+	epoch := number / c.epochBlocks
+	set, err := c.provider.GetValidatorSet(epoch)
+	if err != nil {
+		return fmt.Errorf("failed to get validator set of epoch %d: %w", epoch, err)
+	}
+	if set.Epoch != epoch || set.FirstBlock != number || set.Hash() != header.ValidatorsHash {
+		return fmt.Errorf("%w: validator set of epoch %d does not match block #%d", ErrUntrustedValidatorSet, epoch, number)
+	}
+
+	previous := c.ValidatorSet()
+	last := min(target, number+c.epochBlocks-1)
+	var lastErr error
+	for current := number; ; current++ {
+		err := c.verifyHeader(header, commit, current, set)
+		if err != nil && !errors.Is(err, consensus.ErrNoQuorum) {
+			return err
+		}
+		if err == nil {
+			power, err := previous.SignedPower(current, header.Hash(), commit)
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+			}
+			if new(big.Int).Mul(power, big.NewInt(3)).Cmp(previous.TotalVotingPower()) > 0 {
+				c.mu.Lock()
+				c.header, c.set = header, set
+				c.mu.Unlock()
+				return nil
+			}
+			err = fmt.Errorf("%w: validators of epoch %d holding %s of %s voted for block #%d",
+				ErrUntrustedValidatorSet, previous.Epoch, power, previous.TotalVotingPower(), current)
+		}
+		lastErr = err
+		if current == last {
+			return fmt.Errorf("no block from #%d to #%d vouching for epoch %d: %w", number, last, epoch, lastErr)
+		}
+
+		parent := header
+		if header, commit, err = getLightBlock(c.provider, current+1); err != nil {
+			return fmt.Errorf("failed to get block #%d: %w", current+1, err)
+		}
+		if header.ParentHash != parent.Hash() {
+			return fmt.Errorf("%w: block #%d does not extend block #%d", ErrInvalidHeader, current+1, current)
+		}
+	}
+}
+
+// verifyHeader checks a header against the validator set of its epoch: it is
+// signed by a member and a quorum of the set voted for it
+func (c *Client) verifyHeader(header *types.BlockHeader, commit []*types.CommitSig, number uint64, set *consensus.EpochValidatorSet) error {
+	if trusted := c.Header(); number == trusted.Number.Uint64()+1 && header.ParentHash != trusted.Hash() {
+		return fmt.Errorf("%w: block #%d does not extend the verified chain", ErrInvalidHeader, number)
+	}
+	if number%c.epochBlocks != 0 && !header.ValidatorsHash.IsZero() {
+		return fmt.Errorf("%w: block #%d inside an epoch commits to a validator set", ErrInvalidHeader, number)
+	}
+
+	proposer := set.Member(header.ValidatorAddr)
+	if proposer == nil || header.ValidatorSig == nil {
+		return fmt.Errorf("%w: block #%d not signed by a validator of epoch %d", ErrInvalidHeader, number, set.Epoch)
+	}
+	if header.ValidatorSig.Algorithm != proposer.SigAlgorithm || !bytes.Equal(header.ValidatorSig.PublicKey, proposer.PublicKey) {
+		return fmt.Errorf("%w: block #%d signed with another key than its proposer's", ErrInvalidHeader, number)
+	}
+	if valid, err := header.VerifyValidatorSignature(); err != nil || !valid {
+		return fmt.Errorf("%w: bad proposer signature of block #%d", ErrInvalidHeader, number)
+	}
+
+	if err := set.VerifyCommit(number, header.Hash(), commit); err != nil {
+		if errors.Is(err, consensus.ErrNoQuorum) {
+			return err
+		}
+		return fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+	}
+	return nil
+}
+
+// getLightBlock gets a header and the commit votes for it from the provider,
+// checking the header has the fields its hash encodes and the asked number
+func getLightBlock(provider Provider, number uint64) (*types.BlockHeader, []*types.CommitSig, error) {
+	header, commit, err := provider.GetLightBlock(new(big.Int).SetUint64(number))
+	if err != nil {
+		return nil, nil, err
+	}
+	if header == nil {
+		return nil, nil, fmt.Errorf("%w: block #%d without header", ErrInvalidHeader, number)
+	}
+	if err := header.ValidateFields(); err != nil {
+		return nil, nil, fmt.Errorf("%w: block #%d: %v", ErrInvalidHeader, number, err)
+	}
+	if !header.Number.IsUint64() || header.Number.Uint64() != number {
+		return nil, nil, fmt.Errorf("%w: asked for block #%d, got #%s", ErrInvalidHeader, number, header.Number)
+	}
+	return header, commit, nil
+}
+
+// GetAccount returns the state of an account verified against the state root
+// of the latest verified header, which is the state after the block before it
+func (c *Client) GetAccount(address types.Address) (*types.StateAccount, error) {
+	header := c.Header()
+	if header.Number.Sign() == 0 {
+		return nil, errors.New("the genesis block commits to no state, sync first")
+	}
+
+	proof, err := c.provider.GetAccountProof(address, header.Number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account proof: %w", err)
+	}
+	if proof.Address != address {
+		return nil, fmt.Errorf("%w: proof of account %s, want %s", types.ErrInvalidProof, proof.Address.Hex(), address.Hex())
+	}
+	return proof.Verify(header.Root)
+}
+
+// GetBalance returns the balance of an account verified against the state
+// root of the latest verified header
+func (c *Client) GetBalance(address types.Address) (*big.Int, error) {
+	account, err := c.GetAccount(address)
+	if err != nil {
+		return nil, err
+	}
+	return account.Balance, nil
+}
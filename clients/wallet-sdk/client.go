@@ -9,6 +9,7 @@ import (
 	"net/http"
 
 	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/evm"
 	"quantum-blockchain/chain/types"
 )
 
@@ -240,6 +241,53 @@ func (c *Client) EstimateGas(from, to types.Address, value *big.Int, data []byte
 	return gas.Uint64(), nil
 }
 
+// EstimateBatchGas estimates gas for a batch transaction
+func (c *Client) EstimateBatchGas(from types.Address, calls []*types.BatchCall, mode types.BatchMode) (uint64, error) {
+	params := []interface{}{
+		map[string]interface{}{
+			"from":      from.Hex(),
+			"calls":     calls,
+			"batchMode": fmt.Sprintf("0x%x", uint8(mode)),
+		},
+	}
+
+	result, err := c.call("eth_estimateGas", params)
+	if err != nil {
+		return 0, err
+	}
+
+	var gasStr string
+	err = json.Unmarshal(result, &gasStr)
+	if err != nil {
+		return 0, err
+	}
+
+	gas := new(big.Int)
+	gas.SetString(gasStr[2:], 16) // Remove 0x prefix
+	return gas.Uint64(), nil
+}
+
+// SendRawTransaction submits a signed transaction and returns its hash
+func (c *Client) SendRawTransaction(tx *types.QuantumTransaction) (types.Hash, error) {
+	encoded, err := json.Marshal(tx)
+	if err != nil {
+		return types.ZeroHash, fmt.Errorf("failed to encode transaction: %w", err)
+	}
+
+	result, err := c.call("eth_sendRawTransaction", []interface{}{fmt.Sprintf("0x%x", encoded)})
+	if err != nil {
+		return types.ZeroHash, err
+	}
+
+	var hashStr string
+	err = json.Unmarshal(result, &hashStr)
+	if err != nil {
+		return types.ZeroHash, err
+	}
+
+	return types.HexToHash(hashStr)
+}
+
 // GetSupportedAlgorithms returns supported quantum algorithms
 func (c *Client) GetSupportedAlgorithms() (map[string]interface{}, error) {
 	result, err := c.call("quantum_getSupportedAlgorithms", nil)
@@ -260,6 +308,7 @@ func (c *Client) GetSupportedAlgorithms() (map[string]interface{}, error) {
 type Wallet struct {
 	address    types.Address
 	privateKey []byte
+	publicKey  []byte
 	algorithm  crypto.SignatureAlgorithm
 	client     *Client
 }
@@ -295,6 +344,7 @@ func NewWallet(algorithm crypto.SignatureAlgorithm, client *Client) (*Wallet, er
 	return &Wallet{
 		address:    address,
 		privateKey: privateKey,
+		publicKey:  publicKey,
 		algorithm:  algorithm,
 		client:     client,
 	}, nil
@@ -310,18 +360,14 @@ func LoadWallet(privateKey []byte, algorithm crypto.SignatureAlgorithm, client *
 		if err != nil {
 			return nil, err
 		}
-		// Extract public key from private key
-		pubKeyData := priv.Bytes()[:crypto.DilithiumPublicKeySize]
-		publicKey = pubKeyData
+		publicKey = priv.Public().Bytes()
 
 	case crypto.SigAlgFalcon:
 		priv, err := crypto.FalconPrivateKeyFromBytes(privateKey)
 		if err != nil {
 			return nil, err
 		}
-		// Extract public key from private key
-		pubKeyData := priv.Bytes()[:crypto.FalconPublicKeySize]
-		publicKey = pubKeyData
+		publicKey = priv.Public().Bytes()
 
 	default:
 		return nil, fmt.Errorf("unsupported algorithm: %v", algorithm)
@@ -332,6 +378,7 @@ func LoadWallet(privateKey []byte, algorithm crypto.SignatureAlgorithm, client *
 	return &Wallet{
 		address:    address,
 		privateKey: privateKey,
+		publicKey:  publicKey,
 		algorithm:  algorithm,
 		client:     client,
 	}, nil
@@ -367,7 +414,7 @@ func (w *Wallet) CreateTransaction(to *types.Address, value *big.Int, gasLimit u
 	tx := types.NewQuantumTransaction(chainID, nonce, to, value, gasLimit, gasPrice, data)
 
 	// Sign the transaction
-	err = tx.SignTransaction(w.privateKey, w.algorithm)
+	err = w.sign(tx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to sign transaction: %w", err)
 	}
@@ -384,7 +431,8 @@ func (w *Wallet) SendTransaction(to types.Address, value *big.Int, data []byte)
 
 	gasLimit, err := w.client.EstimateGas(w.address, to, value, data)
 	if err != nil {
-		gasLimit = 21000 // Default gas limit
+		sigSize, pubKeySize := evm.SignatureSizes(w.algorithm)
+		gasLimit = evm.IntrinsicGas(w.algorithm, sigSize, pubKeySize) // Default to a plain transfer
 	}
 
 	tx, err := w.CreateTransaction(&to, value, gasLimit, gasPrice, data)
@@ -397,6 +445,43 @@ func (w *Wallet) SendTransaction(to types.Address, value *big.Int, data []byte)
 	return tx.Hash(), nil
 }
 
+// SendBatch signs the calls as a single batch transaction and submits it.
+// Atomic batches revert every call if one fails, best-effort batches keep
+// the calls that succeed.
+func (w *Wallet) SendBatch(calls []*types.BatchCall, mode types.BatchMode) (types.Hash, error) {
+	chainID, err := w.client.GetChainID()
+	if err != nil {
+		return types.ZeroHash, fmt.Errorf("failed to get chain ID: %w", err)
+	}
+
+	nonce, err := w.GetNonce()
+	if err != nil {
+		return types.ZeroHash, fmt.Errorf("failed to get nonce: %w", err)
+	}
+
+	gasPrice, err := w.client.GetGasPrice()
+	if err != nil {
+		return types.ZeroHash, fmt.Errorf("failed to get gas price: %w", err)
+	}
+
+	gasLimit, err := w.client.EstimateBatchGas(w.address, calls, mode)
+	if err != nil {
+		// Default to plain transfers
+		sigSize, pubKeySize := evm.SignatureSizes(w.algorithm)
+		gasLimit = evm.IntrinsicGas(w.algorithm, sigSize, pubKeySize) + uint64(len(calls))*evm.BatchCallGas
+	}
+
+	tx := types.NewBatchTransaction(chainID, nonce, calls, mode, gasLimit, gasPrice)
+	if err := tx.ValidateBatch(); err != nil {
+		return types.ZeroHash, err
+	}
+	if err := w.sign(tx); err != nil {
+		return types.ZeroHash, fmt.Errorf("failed to sign transaction: %w", err)
+	}
+
+	return w.client.SendRawTransaction(tx)
+}
+
 // Transfer sends a simple value transfer
 func (w *Wallet) Transfer(to types.Address, amount *big.Int) (types.Hash, error) {
 	return w.SendTransaction(to, amount, []byte{})
@@ -0,0 +1,94 @@
+package walletSDK
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/evm"
+	"quantum-blockchain/chain/types"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// EncryptionKeys are the keys of the validators the key shares of
+// transactions of an epoch are encrypted to, a threshold of which reveals them
+type EncryptionKeys struct {
+	Epoch     uint64
+	Threshold uint8
+	Keys      []*types.EncryptionKey
+}
+
+// GetEncryptionKeys returns the encryption keys of the epoch of the next block
+func (c *Client) GetEncryptionKeys() (*EncryptionKeys, error) {
+	result, err := c.call("quantum_getEncryptionKey", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Epoch     hexutil.Uint64 `json:"epoch"`
+		Threshold hexutil.Uint64 `json:"threshold"`
+		Keys      []struct {
+			Validator types.Address `json:"validator"`
+			PublicKey hexutil.Bytes `json:"publicKey"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(result, &response); err != nil {
+		return nil, err
+	}
+	if response.Threshold == 0 || response.Threshold > 255 {
+		return nil, fmt.Errorf("invalid key threshold %d", response.Threshold)
+	}
+
+	keys := &EncryptionKeys{Epoch: uint64(response.Epoch), Threshold: uint8(response.Threshold)}
+	for _, key := range response.Keys {
+		publicKey, err := crypto.KyberPublicKeyFromBytes(key.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key of %s: %w", key.Validator.Hex(), err)
+		}
+		keys.Keys = append(keys.Keys, &types.EncryptionKey{Validator: key.Validator, PublicKey: publicKey})
+	}
+	return keys, nil
+}
+
+// SendEncryptedTransaction encrypts the recipient, value and data of a
+// transaction, splitting its key among the validators of the current epoch,
+// and submits it. The payload is revealed once the block ordering the
+// transaction is committed and executes in the next block.
+func (w *Wallet) SendEncryptedTransaction(to *types.Address, value *big.Int, gasLimit uint64, data []byte) (types.Hash, error) {
+	keys, err := w.client.GetEncryptionKeys()
+	if err != nil {
+		return types.ZeroHash, fmt.Errorf("failed to get encryption keys: %w", err)
+	}
+	chainID, err := w.client.GetChainID()
+	if err != nil {
+		return types.ZeroHash, fmt.Errorf("failed to get chain ID: %w", err)
+	}
+	nonce, err := w.GetNonce()
+	if err != nil {
+		return types.ZeroHash, fmt.Errorf("failed to get nonce: %w", err)
+	}
+	gasPrice, err := w.client.GetGasPrice()
+	if err != nil {
+		return types.ZeroHash, fmt.Errorf("failed to get gas price: %w", err)
+	}
+
+	if gasLimit == 0 {
+		// Default to a plain transfer, the payload can not be estimated by the node
+		sigSize, pubKeySize := evm.SignatureSizes(w.algorithm)
+		gasLimit = evm.IntrinsicGas(w.algorithm, sigSize, pubKeySize) + evm.EncryptionGas(len(keys.Keys))
+	}
+
+	payload := &types.EncryptedPayload{To: to, Value: value, Data: data}
+	tx, err := types.NewEncryptedTransaction(chainID, nonce, keys.Epoch, keys.Keys, keys.Threshold, payload, gasLimit, gasPrice)
+	if err != nil {
+		return types.ZeroHash, err
+	}
+	if err := w.sign(tx); err != nil {
+		return types.ZeroHash, fmt.Errorf("failed to sign transaction: %w", err)
+	}
+
+	return w.client.SendRawTransaction(tx)
+}
@@ -0,0 +1,95 @@
+package walletSDK
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"quantum-blockchain/chain/consensus"
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/types"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// GetLightBlock returns the header of a block and the commit votes for it,
+// which are empty until the next block is added. Nothing is verified, the
+// light client checks them against the validator set.
+func (c *Client) GetLightBlock(blockNumber *big.Int) (*types.BlockHeader, []*types.CommitSig, error) {
+	result, err := c.call("quantum_getLightBlock", []interface{}{fmt.Sprintf("0x%x", blockNumber)})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var lightBlock struct {
+		Header *types.BlockHeader `json:"header"`
+		Commit []*types.CommitSig `json:"commit"`
+	}
+	if err := json.Unmarshal(result, &lightBlock); err != nil {
+		return nil, nil, err
+	}
+	if lightBlock.Header == nil || lightBlock.Header.Number == nil {
+		return nil, nil, fmt.Errorf("light block %s without header", blockNumber)
+	}
+	return lightBlock.Header, lightBlock.Commit, nil
+}
+
+// GetValidatorSet returns the validator set of an epoch as the node reports
+// it, the first block of the epoch commits to its hash
+func (c *Client) GetValidatorSet(epoch uint64) (*consensus.EpochValidatorSet, error) {
+	result, err := c.call("quantum_getValidatorSet", []interface{}{fmt.Sprintf("0x%x", epoch)})
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Epoch      hexutil.Uint64 `json:"epoch"`
+		FirstBlock hexutil.Uint64 `json:"firstBlock"`
+		Validators []struct {
+			Address     string        `json:"address"`
+			SigAlg      uint8         `json:"sigAlg"`
+			PublicKey   hexutil.Bytes `json:"publicKey"`
+			VotingPower *hexutil.Big  `json:"votingPower"`
+		} `json:"validators"`
+	}
+	if err := json.Unmarshal(result, &set); err != nil {
+		return nil, err
+	}
+
+	validatorSet := &consensus.EpochValidatorSet{
+		Epoch:      uint64(set.Epoch),
+		FirstBlock: uint64(set.FirstBlock),
+		Validators: make([]*consensus.EpochValidator, 0, len(set.Validators)),
+	}
+	for _, validator := range set.Validators {
+		addr, err := types.HexToAddress(validator.Address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid validator address: %w", err)
+		}
+		if validator.VotingPower == nil {
+			return nil, fmt.Errorf("validator %s without voting power", validator.Address)
+		}
+		validatorSet.Validators = append(validatorSet.Validators, &consensus.EpochValidator{
+			Address:      addr,
+			PublicKey:    validator.PublicKey,
+			SigAlgorithm: crypto.SignatureAlgorithm(validator.SigAlg),
+			VotingPower:  validator.VotingPower.ToInt(),
+		})
+	}
+	return validatorSet, nil
+}
+
+// GetAccountProof returns the proof of an account against the state root of
+// a block, which commits to the state its parent left
+func (c *Client) GetAccountProof(address types.Address, blockNumber *big.Int) (*types.AccountProof, error) {
+	result, err := c.call("quantum_getAccountProof", []interface{}{address.Hex(), fmt.Sprintf("0x%x", blockNumber)})
+	if err != nil {
+		return nil, err
+	}
+
+	var proof types.AccountProof
+	if err := json.Unmarshal(result, &proof); err != nil {
+		return nil, err
+	}
+	return &proof, nil
+}
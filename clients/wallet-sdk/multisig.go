@@ -0,0 +1,101 @@
+package walletSDK
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/evm"
+	"quantum-blockchain/chain/types"
+)
+
+// MultisigKey returns the key of the wallet for use in a multisig policy
+func (w *Wallet) MultisigKey() *types.MultisigKey {
+	return &types.MultisigKey{Algorithm: w.algorithm, PublicKey: w.publicKey}
+}
+
+// CreateMultisigTransaction creates an unsigned transaction sent by the
+// multisig account of policy. A gas limit of 0 estimates the gas, including
+// the signatures of the threshold most expensive keys.
+func (c *Client) CreateMultisigTransaction(policy *types.MultisigPolicy, to *types.Address, value *big.Int, gasLimit uint64, data []byte) (*types.QuantumTransaction, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	from := policy.Address()
+
+	chainID, err := c.GetChainID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chain ID: %w", err)
+	}
+
+	nonce, err := c.GetNonce(from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nonce: %w", err)
+	}
+
+	gasPrice, err := c.GetGasPrice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gas price: %w", err)
+	}
+
+	if gasLimit == 0 {
+		// The node prices a single Dilithium signature, swap it for the policy
+		sigSize, pubKeySize := evm.SignatureSizes(crypto.SigAlgDilithium)
+		single := evm.IntrinsicGas(crypto.SigAlgDilithium, sigSize, pubKeySize)
+		gasLimit = single
+		if to != nil {
+			if estimate, err := c.EstimateGas(from, *to, value, data); err == nil {
+				gasLimit = estimate
+			}
+		}
+		gasLimit = gasLimit - single + evm.TxBaseGas + multisigSignatureGas(policy)
+	}
+
+	tx := types.NewQuantumTransaction(chainID, nonce, to, value, gasLimit, gasPrice, data)
+	tx.SetMultisig(policy)
+	return tx, nil
+}
+
+// SignMultisig returns the partial signature of the wallet over a multisig
+// transaction. It does not modify the transaction, partial signatures are
+// collected with CombineMultisigSignatures.
+func (w *Wallet) SignMultisig(tx *types.QuantumTransaction) (*crypto.QRSignature, error) {
+	return tx.SignMultisig(w.privateKey, w.algorithm)
+}
+
+// CombineMultisigSignatures adds partial signatures to a multisig transaction
+// and checks that the policy threshold is met
+func CombineMultisigSignatures(tx *types.QuantumTransaction, signatures ...*crypto.QRSignature) error {
+	for _, sig := range signatures {
+		if err := tx.AddMultisigSignature(sig); err != nil {
+			return err
+		}
+	}
+
+	valid, err := tx.VerifyMultisig()
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return fmt.Errorf("invalid multisig signatures")
+	}
+	return nil
+}
+
+// multisigSignatureGas returns the gas for the policy keys and the signatures
+// of its threshold most expensive keys
+func multisigSignatureGas(policy *types.MultisigPolicy) uint64 {
+	costs := make([]uint64, 0, len(policy.Keys))
+	for _, key := range policy.Keys {
+		sigSize, pubKeySize := evm.SignatureSizes(key.Algorithm)
+		costs = append(costs, evm.SignatureGas(key.Algorithm, sigSize, pubKeySize))
+	}
+	sort.Slice(costs, func(i, j int) bool { return costs[i] > costs[j] })
+
+	gas := evm.MultisigGas(policy, nil)
+	for _, cost := range costs[:policy.Threshold] {
+		gas += cost
+	}
+	return gas
+}
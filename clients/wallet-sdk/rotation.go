@@ -0,0 +1,70 @@
+package walletSDK
+
+import (
+	"fmt"
+
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/evm"
+	"quantum-blockchain/chain/types"
+)
+
+// LoadRotatedWallet loads a wallet for an account whose key has been rotated,
+// so the private key no longer derives the address
+func LoadRotatedWallet(privateKey []byte, algorithm crypto.SignatureAlgorithm, address types.Address, client *Client) (*Wallet, error) {
+	wallet, err := LoadWallet(privateKey, algorithm, client)
+	if err != nil {
+		return nil, err
+	}
+	wallet.address = address
+	return wallet, nil
+}
+
+// RotateKey binds a new key to the wallet address with a key rotation signed
+// by the current key. The wallet signs with the new key afterwards.
+func (w *Wallet) RotateKey(newPrivateKey []byte, newAlgorithm crypto.SignatureAlgorithm) (types.Hash, error) {
+	rotated, err := LoadRotatedWallet(newPrivateKey, newAlgorithm, w.address, w.client)
+	if err != nil {
+		return types.ZeroHash, fmt.Errorf("failed to load new key: %w", err)
+	}
+
+	chainID, err := w.client.GetChainID()
+	if err != nil {
+		return types.ZeroHash, fmt.Errorf("failed to get chain ID: %w", err)
+	}
+	nonce, err := w.GetNonce()
+	if err != nil {
+		return types.ZeroHash, fmt.Errorf("failed to get nonce: %w", err)
+	}
+	gasPrice, err := w.client.GetGasPrice()
+	if err != nil {
+		return types.ZeroHash, fmt.Errorf("failed to get gas price: %w", err)
+	}
+
+	sigSize, pubKeySize := evm.SignatureSizes(w.algorithm)
+	gasLimit := evm.IntrinsicGas(w.algorithm, sigSize, pubKeySize) + evm.KeyRotationGas +
+		evm.KeyStorageByteGas*uint64(len(rotated.publicKey))
+
+	tx := types.NewKeyRotationTransaction(chainID, nonce, newAlgorithm, rotated.publicKey, gasLimit, gasPrice)
+	if err := w.sign(tx); err != nil {
+		return types.ZeroHash, fmt.Errorf("failed to sign transaction: %w", err)
+	}
+
+	hash, err := w.client.SendRawTransaction(tx)
+	if err != nil {
+		return types.ZeroHash, err
+	}
+
+	w.privateKey = rotated.privateKey
+	w.publicKey = rotated.publicKey
+	w.algorithm = rotated.algorithm
+	return hash, nil
+}
+
+// sign signs a transaction with the wallet key, sending it from the wallet
+// address when the key has been rotated away from it
+func (w *Wallet) sign(tx *types.QuantumTransaction) error {
+	if types.PublicKeyToAddress(w.publicKey) != w.address {
+		tx.SetSender(w.address)
+	}
+	return tx.SignTransaction(w.privateKey, w.algorithm)
+}
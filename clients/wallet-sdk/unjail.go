@@ -0,0 +1,34 @@
+package walletSDK
+
+import (
+	"fmt"
+
+	"quantum-blockchain/chain/evm"
+	"quantum-blockchain/chain/types"
+)
+
+// Unjail sends an unjail transaction returning the wallet address, a
+// validator whose jail term is over, to the validator set
+func (w *Wallet) Unjail() (types.Hash, error) {
+	chainID, err := w.client.GetChainID()
+	if err != nil {
+		return types.ZeroHash, fmt.Errorf("failed to get chain ID: %w", err)
+	}
+	nonce, err := w.GetNonce()
+	if err != nil {
+		return types.ZeroHash, fmt.Errorf("failed to get nonce: %w", err)
+	}
+	gasPrice, err := w.client.GetGasPrice()
+	if err != nil {
+		return types.ZeroHash, fmt.Errorf("failed to get gas price: %w", err)
+	}
+
+	sigSize, pubKeySize := evm.SignatureSizes(w.algorithm)
+	gasLimit := evm.IntrinsicGas(w.algorithm, sigSize, pubKeySize) + evm.UnjailGas
+
+	tx := types.NewUnjailTransaction(chainID, nonce, gasLimit, gasPrice)
+	if err := w.sign(tx); err != nil {
+		return types.ZeroHash, fmt.Errorf("failed to sign transaction: %w", err)
+	}
+	return w.client.SendRawTransaction(tx)
+}
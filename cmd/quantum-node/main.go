@@ -28,11 +28,19 @@ var rootCmd = &cobra.Command{
 }
 
 var (
-	configFile    string
-	port          int
-	rpcPort       int
-	dataDir       string
-	genesisConfig string
+	configFile     string
+	port           int
+	rpcPort        int
+	dataDir        string
+	genesisConfig  string
+	stateHistory   uint64
+	adminSocket    string
+	adminPort      int
+	jwtSecret      string
+	adminKeys      []string
+	validatorPort  int
+	validatorPeers []string
+	mempoolSecret  string
 )
 
 func init() {
@@ -41,6 +49,14 @@ func init() {
 	rootCmd.PersistentFlags().IntVar(&rpcPort, "rpc-port", 8545, "JSON-RPC server port")
 	rootCmd.PersistentFlags().StringVar(&dataDir, "data-dir", "./data", "data directory")
 	rootCmd.PersistentFlags().StringVar(&genesisConfig, "genesis", "./config/genesis.json", "genesis configuration file")
+	rootCmd.PersistentFlags().Uint64Var(&stateHistory, "state-history", node.DefaultStateHistory, "number of recent blocks whose state is kept for historical queries (0 keeps all)")
+	rootCmd.PersistentFlags().StringVar(&adminSocket, "admin-socket", "admin.ipc", "unix socket serving the admin, miner and debug namespaces, relative to the data directory (empty disables)")
+	rootCmd.PersistentFlags().IntVar(&adminPort, "admin-port", 0, "localhost port of the authenticated admin endpoint (0 disables)")
+	rootCmd.PersistentFlags().StringVar(&jwtSecret, "jwt-secret", "jwtsecret", "hex JWT secret file for the admin endpoint, created if missing")
+	rootCmd.PersistentFlags().StringSliceVar(&adminKeys, "admin-key", nil, "hex Dilithium public key allowed to sign admin requests (repeatable)")
+	rootCmd.PersistentFlags().IntVar(&validatorPort, "validator-port", 30304, "port of the validator mesh carrying proposals and votes (0 disables)")
+	rootCmd.PersistentFlags().StringSliceVar(&validatorPeers, "validator-peer", nil, "host:port of another validator's mesh endpoint (repeatable)")
+	rootCmd.PersistentFlags().StringVar(&mempoolSecret, "mempool-secret", "", "hex secret file seeding this validator's encrypted mempool keys, relative to the data directory and created if missing")
 
 	viper.BindPFlags(rootCmd.PersistentFlags())
 }
@@ -61,6 +77,17 @@ func runNode(cmd *cobra.Command, args []string) {
 		Mining:        true,
 		GasLimit:      15000000,
 		GasPrice:      big.NewInt(1000000000), // 1 Gwei
+		StateHistory:  stateHistory,
+		AdminSocket:   adminSocket,
+		AdminHTTPPort: adminPort,
+		JWTSecret:     jwtSecret,
+		AdminKeys:     adminKeys,
+		MempoolSecret: mempoolSecret,
+
+		ValidatorPeers: validatorPeers,
+	}
+	if validatorPort != 0 {
+		config.ValidatorListenAddr = fmt.Sprintf(":%d", validatorPort)
 	}
 
 	// Create and start the node
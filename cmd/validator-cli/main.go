@@ -62,6 +62,13 @@ func main() {
 		cmdImport   = flag.String("import", "", "Import validator configuration from file")
 		cmdBackup   = flag.Bool("backup", false, "Backup validator keys")
 		cmdRestore  = flag.String("restore", "", "Restore validator keys from backup")
+		cmdUnjail   = flag.Bool("unjail", false, "Return the validator to the active set after its jail term")
+
+		// Multisig commands
+		cmdMultisigCreate  = flag.Bool("multisig-create", false, "Create an M-of-N multisig policy")
+		cmdMultisigTx      = flag.Bool("multisig-tx", false, "Create an unsigned multisig transaction")
+		cmdMultisigSign    = flag.String("multisig-sign", "", "Create a partial signature over a multisig transaction file")
+		cmdMultisigCombine = flag.String("multisig-combine", "", "Combine partial signatures into a multisig transaction file")
 
 		// Key generation options
 		algorithm = flag.String("algorithm", "dilithium", "Quantum algorithm: dilithium or falcon")
@@ -80,6 +87,17 @@ func main() {
 		// Security options
 		password = flag.String("password", "", "Password for key encryption")
 		mnemonic = flag.Bool("mnemonic", false, "Generate mnemonic phrase for key recovery")
+
+		// Multisig options
+		threshold  = flag.Uint("threshold", 2, "Number of signatures a multisig transaction needs")
+		keys       = flag.String("keys", "", "Comma-separated key directories of the multisig signers")
+		policyFile = flag.String("policy", "multisig-policy.json", "Multisig policy file")
+		recipient  = flag.String("to", "", "Recipient address of a multisig transaction")
+		nonce      = flag.Uint64("nonce", 0, "Nonce of the multisig account")
+		gasLimit   = flag.Uint64("gas", 100000, "Gas limit of a multisig transaction")
+		gasPrice   = flag.String("gas-price", "1000000000", "Gas price in wei")
+		sigs       = flag.String("sigs", "", "Comma-separated partial signature files")
+		outFile    = flag.String("out", "", "Output file of multisig commands")
 	)
 
 	flag.Parse()
@@ -110,6 +128,21 @@ func main() {
 	case *cmdRestore != "":
 		restoreValidatorKeys(*cmdRestore, *outputDir, *password)
 
+	case *cmdUnjail:
+		unjailValidator(*outputDir, *password, *rpcEndpoint)
+
+	case *cmdMultisigCreate:
+		createMultisigPolicy(*threshold, *keys, outputPath(*outFile, *policyFile))
+
+	case *cmdMultisigTx:
+		createMultisigTransaction(*policyFile, *recipient, *delegateAmount, *nonce, *gasLimit, *gasPrice, outputPath(*outFile, "multisig-tx.json"))
+
+	case *cmdMultisigSign != "":
+		signMultisigTransaction(*cmdMultisigSign, *outputDir, *password, outputPath(*outFile, "multisig-sig.json"))
+
+	case *cmdMultisigCombine != "":
+		combineMultisigSignatures(*cmdMultisigCombine, *sigs, outputPath(*outFile, "multisig-signed.json"))
+
 	default:
 		printHelp()
 	}
@@ -644,6 +677,11 @@ func printHelp() {
 	fmt.Println("  -import      Import validator configuration")
 	fmt.Println("  -backup      Backup validator keys")
 	fmt.Println("  -restore     Restore validator keys")
+	fmt.Println("  -unjail      Rejoin the validator set after a jail term")
+	fmt.Println("  -multisig-create   Create an M-of-N multisig policy")
+	fmt.Println("  -multisig-tx       Create an unsigned multisig transaction")
+	fmt.Println("  -multisig-sign     Create a partial signature over a multisig transaction")
+	fmt.Println("  -multisig-combine  Combine partial signatures into a signed transaction")
 	fmt.Println()
 	fmt.Println("Options:")
 	fmt.Println("  -algorithm   Quantum algorithm (dilithium/falcon)")
@@ -656,6 +694,15 @@ func printHelp() {
 	fmt.Println("  -amount      Delegation amount in QTM")
 	fmt.Println("  -password    Password for key encryption")
 	fmt.Println("  -mnemonic    Generate mnemonic phrase")
+	fmt.Println("  -threshold   Signatures a multisig transaction needs")
+	fmt.Println("  -keys        Key directories of the multisig signers")
+	fmt.Println("  -policy      Multisig policy file")
+	fmt.Println("  -to          Recipient of a multisig transaction")
+	fmt.Println("  -nonce       Nonce of the multisig account")
+	fmt.Println("  -gas         Gas limit of a multisig transaction")
+	fmt.Println("  -gas-price   Gas price in wei")
+	fmt.Println("  -sigs        Partial signature files to combine")
+	fmt.Println("  -out         Output file of multisig commands")
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  # Generate new Dilithium validator keys")
@@ -669,4 +716,21 @@ func printHelp() {
 	fmt.Println()
 	fmt.Println("  # Delegate 1000 QTM to a validator")
 	fmt.Println("  validator-cli -delegate -validator 0x... -amount 1000")
+	fmt.Println()
+	fmt.Println("  # Rejoin the validator set once the jail term is over")
+	fmt.Println("  validator-cli -unjail -rpc http://localhost:8545")
+	fmt.Println()
+	fmt.Println("  # Create a 2-of-3 multisig and sign a transfer offline")
+	fmt.Println("  validator-cli -multisig-create -threshold 2 -keys ./alice,./bob,./carol")
+	fmt.Println("  validator-cli -multisig-tx -to 0x... -amount 1000000000000000000 -nonce 0")
+	fmt.Println("  validator-cli -multisig-sign multisig-tx.json -output ./alice -out alice.sig")
+	fmt.Println("  validator-cli -multisig-combine multisig-tx.json -sigs alice.sig,bob.sig")
+}
+
+// outputPath returns path, or fallback if no path was given
+func outputPath(path, fallback string) string {
+	if path == "" {
+		return fallback
+	}
+	return path
 }
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/types"
+)
+
+// createMultisigPolicy builds an M-of-N policy from the keys of validator key
+// directories and saves it, the policy address is the multisig account
+func createMultisigPolicy(threshold uint, keyDirs, outPath string) {
+	fmt.Println("🔐 Creating Multisig Policy...")
+
+	var keys []*types.MultisigKey
+	for _, keyDir := range splitList(keyDirs) {
+		profile, err := loadValidatorProfile(filepath.Join(keyDir, "validator-profile.json"))
+		if err != nil {
+			fmt.Printf("Error loading profile from %s: %v\n", keyDir, err)
+			return
+		}
+		publicKey, err := hex.DecodeString(profile.Config.QuantumPublicKey)
+		if err != nil {
+			fmt.Printf("Error decoding public key of %s: %v\n", keyDir, err)
+			return
+		}
+		keys = append(keys, &types.MultisigKey{Algorithm: keyAlgorithm(len(publicKey)), PublicKey: publicKey})
+	}
+
+	policy, err := types.NewMultisigPolicy(uint8(threshold), keys)
+	if err != nil {
+		fmt.Printf("Error creating policy: %v\n", err)
+		return
+	}
+	if err := writeJSON(policy, outPath); err != nil {
+		fmt.Printf("Error saving policy: %v\n", err)
+		return
+	}
+
+	fmt.Printf("✅ %d-of-%d multisig policy created\n", policy.Threshold, len(policy.Keys))
+	fmt.Printf("📍 Multisig Address: %s\n", policy.Address().Hex())
+	fmt.Printf("📁 Policy saved to: %s\n", outPath)
+}
+
+// createMultisigTransaction builds an unsigned transfer from a multisig
+// account. It works offline, the nonce and gas are given explicitly.
+func createMultisigTransaction(policyPath, to, amount string, nonce, gasLimit uint64, gasPrice, outPath string) {
+	fmt.Println("📝 Creating Multisig Transaction...")
+
+	var policy types.MultisigPolicy
+	if err := readJSON(policyPath, &policy); err != nil {
+		fmt.Printf("Error loading policy: %v\n", err)
+		return
+	}
+
+	toAddr, err := types.HexToAddress(to)
+	if err != nil {
+		fmt.Printf("Invalid recipient: %v\n", err)
+		return
+	}
+	value, ok := new(big.Int).SetString(amount, 10)
+	if !ok {
+		fmt.Printf("Invalid amount: %s\n", amount)
+		return
+	}
+	price, ok := new(big.Int).SetString(gasPrice, 10)
+	if !ok {
+		fmt.Printf("Invalid gas price: %s\n", gasPrice)
+		return
+	}
+
+	tx := types.NewQuantumTransaction(big.NewInt(8888), nonce, &toAddr, value, gasLimit, price, nil)
+	tx.SetMultisig(&policy)
+	if err := writeJSON(tx, outPath); err != nil {
+		fmt.Printf("Error saving transaction: %v\n", err)
+		return
+	}
+
+	fmt.Printf("✅ Unsigned transaction from %s saved to: %s\n", policy.Address().Hex(), outPath)
+	fmt.Printf("✍️  Collect %d signatures with: validator-cli -multisig-sign %s\n", policy.Threshold, outPath)
+}
+
+// signMultisigTransaction creates the partial signature of one key over a
+// multisig transaction, to be passed on to whoever combines the signatures
+func signMultisigTransaction(txPath, keyDir, password, outPath string) {
+	fmt.Println("✍️  Signing Multisig Transaction...")
+
+	var tx types.QuantumTransaction
+	if err := readJSON(txPath, &tx); err != nil {
+		fmt.Printf("Error loading transaction: %v\n", err)
+		return
+	}
+
+	profile, err := loadValidatorProfile(filepath.Join(keyDir, "validator-profile.json"))
+	if err != nil {
+		fmt.Printf("Error loading profile: %v\n", err)
+		return
+	}
+	privateKey, err := loadPrivateKey(profile.Config.PrivateKeyPath, password)
+	if err != nil {
+		fmt.Printf("Error loading private key: %v\n", err)
+		return
+	}
+	publicKey, err := hex.DecodeString(profile.Config.QuantumPublicKey)
+	if err != nil {
+		fmt.Printf("Error decoding public key: %v\n", err)
+		return
+	}
+
+	sig, err := tx.SignMultisig(privateKey, keyAlgorithm(len(publicKey)))
+	if err != nil {
+		fmt.Printf("Error signing transaction: %v\n", err)
+		return
+	}
+	encoded, err := types.EncodeQRSignature(sig)
+	if err != nil {
+		fmt.Printf("Error encoding signature: %v\n", err)
+		return
+	}
+	if err := ioutil.WriteFile(outPath, encoded, 0644); err != nil {
+		fmt.Printf("Error saving signature: %v\n", err)
+		return
+	}
+
+	fmt.Printf("✅ Partial signature of %s saved to: %s\n", profile.Config.Address, outPath)
+}
+
+// combineMultisigSignatures adds partial signatures to a multisig transaction
+// and prints the raw transaction once the threshold is met
+func combineMultisigSignatures(txPath, sigPaths, outPath string) {
+	fmt.Println("🔗 Combining Multisig Signatures...")
+
+	var tx types.QuantumTransaction
+	if err := readJSON(txPath, &tx); err != nil {
+		fmt.Printf("Error loading transaction: %v\n", err)
+		return
+	}
+
+	for _, sigPath := range splitList(sigPaths) {
+		data, err := ioutil.ReadFile(sigPath)
+		if err != nil {
+			fmt.Printf("Error reading signature %s: %v\n", sigPath, err)
+			return
+		}
+		sig, err := types.DecodeQRSignature(data)
+		if err != nil {
+			fmt.Printf("Error decoding signature %s: %v\n", sigPath, err)
+			return
+		}
+		if err := tx.AddMultisigSignature(sig); err != nil {
+			fmt.Printf("Error adding signature %s: %v\n", sigPath, err)
+			return
+		}
+	}
+
+	if valid, err := tx.VerifyMultisig(); !valid {
+		fmt.Printf("❌ Transaction is not fully signed: %v\n", err)
+		return
+	}
+	if err := writeJSON(&tx, outPath); err != nil {
+		fmt.Printf("Error saving transaction: %v\n", err)
+		return
+	}
+	raw, err := json.Marshal(&tx)
+	if err != nil {
+		fmt.Printf("Error encoding transaction: %v\n", err)
+		return
+	}
+
+	fmt.Printf("✅ Transaction %s signed by %d keys\n", tx.Hash().Hex(), len(tx.MultisigSignatures))
+	fmt.Printf("📁 Signed transaction saved to: %s\n", outPath)
+	fmt.Printf("📤 Submit with eth_sendRawTransaction: 0x%x\n", raw)
+}
+
+// keyAlgorithm returns the signature algorithm of a public key by its size
+func keyAlgorithm(publicKeySize int) crypto.SignatureAlgorithm {
+	if publicKeySize == crypto.FalconPublicKeySize {
+		return crypto.SigAlgFalcon
+	}
+	return crypto.SigAlgDilithium
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func writeJSON(v interface{}, path string) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+
+	walletSDK "quantum-blockchain/clients/wallet-sdk"
+)
+
+// unjailValidator sends an unjail transaction signed by the validator key,
+// returning the validator to the active set once its jail term is over
+func unjailValidator(keyDir, password, rpcEndpoint string) {
+	fmt.Println("🔓 Unjailing Validator...")
+
+	profile, err := loadValidatorProfile(filepath.Join(keyDir, "validator-profile.json"))
+	if err != nil {
+		fmt.Printf("Error loading profile: %v\n", err)
+		return
+	}
+	privateKey, err := loadPrivateKey(profile.Config.PrivateKeyPath, password)
+	if err != nil {
+		fmt.Printf("Error loading private key: %v\n", err)
+		return
+	}
+	publicKey, err := hex.DecodeString(profile.Config.QuantumPublicKey)
+	if err != nil {
+		fmt.Printf("Error decoding public key: %v\n", err)
+		return
+	}
+
+	wallet, err := walletSDK.LoadWallet(privateKey, keyAlgorithm(len(publicKey)), walletSDK.NewClient(rpcEndpoint))
+	if err != nil {
+		fmt.Printf("Error loading validator key: %v\n", err)
+		return
+	}
+	fmt.Printf("📍 Validator Address: %s\n", wallet.GetAddress().Hex())
+	fmt.Printf("🌐 RPC Endpoint: %s\n", rpcEndpoint)
+
+	hash, err := wallet.Unjail()
+	if err != nil {
+		fmt.Printf("Error sending unjail transaction: %v\n", err)
+		return
+	}
+
+	fmt.Printf("\n✅ Unjail transaction sent: %s\n", hash.Hex())
+	fmt.Println("⏰ The validator rejoins the active set once the transaction is")
+	fmt.Println("   included in a block after its jail term")
+}
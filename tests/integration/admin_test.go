@@ -0,0 +1,184 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/node"
+)
+
+// rpcCallAuth posts a JSON-RPC request after letting sign add credentials
+func rpcCallAuth(t *testing.T, client *http.Client, url string, sign func(*http.Request, []byte), method string, params ...interface{}) (json.RawMessage, *rpcError) {
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+		"id":      1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if sign != nil {
+		sign(req, body)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to post %s: %v", method, err)
+	}
+	defer resp.Body.Close()
+
+	var rpcResp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
+		t.Fatalf("Failed to decode %s response: %v", method, err)
+	}
+	return rpcResp.Result, rpcResp.Error
+}
+
+// TestAdminNamespaces tests namespace exposure per endpoint and authentication
+// of privileged methods
+func TestAdminNamespaces(t *testing.T) {
+	testNode, publicURL, _, _ := newRPCTestNode(t, 18648)
+
+	secret := bytes.Repeat([]byte{0x42}, 32)
+	adminPriv, adminPub, err := crypto.GenerateDilithiumKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate admin key: %v", err)
+	}
+	auth := node.MultiAuth{node.NewJWTAuth(secret), node.NewDilithiumAuth(adminPub.Bytes())}
+
+	// Privileged namespaces must stay local and authenticated
+	server := node.NewRPCServer(testNode, 18649, 0)
+	if err := server.AddEndpoint(&node.RPCEndpoint{
+		Name: "exposed", Network: "tcp", Address: "0.0.0.0:18650",
+		Namespaces: node.AdminNamespaces, Auth: auth,
+	}); err == nil {
+		t.Error("Expected admin endpoint on a public address to be rejected")
+	}
+	if err := server.AddEndpoint(&node.RPCEndpoint{
+		Name: "open", Network: "tcp", Address: "127.0.0.1:18650",
+		Namespaces: node.AdminNamespaces,
+	}); err == nil {
+		t.Error("Expected admin endpoint without authentication to be rejected")
+	}
+
+	socketPath := filepath.Join(t.TempDir(), "admin.ipc")
+	for _, ep := range []*node.RPCEndpoint{
+		{Name: "admin-http", Network: "tcp", Address: "127.0.0.1:18650", Namespaces: node.AdminNamespaces, Auth: auth},
+		{Name: "admin-ipc", Network: "unix", Address: socketPath, Namespaces: node.AdminNamespaces},
+	} {
+		if err := server.AddEndpoint(ep); err != nil {
+			t.Fatalf("Failed to add endpoint %s: %v", ep.Name, err)
+		}
+	}
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start RPC server: %v", err)
+	}
+	defer server.Stop()
+	time.Sleep(200 * time.Millisecond)
+
+	// The public endpoint does not serve privileged namespaces at all
+	for _, method := range []string{"miner_stop", "admin_nodeInfo", "debug_traceTransaction"} {
+		if _, rpcErr := rpcCall(t, publicURL, method); rpcErr == nil || rpcErr.Code != -32601 {
+			t.Errorf("Expected %s to be unavailable publicly, got %+v", method, rpcErr)
+		}
+	}
+
+	adminURL := "http://127.0.0.1:18650"
+	client := http.DefaultClient
+
+	// Unauthenticated callers may use public namespaces only
+	if _, rpcErr := rpcCallAuth(t, client, adminURL, nil, "eth_chainId"); rpcErr != nil {
+		t.Errorf("Expected eth_chainId without credentials to succeed: %+v", rpcErr)
+	}
+	if _, rpcErr := rpcCallAuth(t, client, adminURL, nil, "admin_nodeInfo"); rpcErr == nil || rpcErr.Code != -32001 {
+		t.Errorf("Expected unauthorized error, got %+v", rpcErr)
+	}
+
+	bearer := func(token string) func(*http.Request, []byte) {
+		return func(r *http.Request, _ []byte) { r.Header.Set("Authorization", "Bearer "+token) }
+	}
+	rejected := map[string]func(*http.Request, []byte){
+		"wrong secret": bearer(node.NewJWTToken(bytes.Repeat([]byte{0x01}, 32), time.Now())),
+		"stale token":  bearer(node.NewJWTToken(secret, time.Now().Add(-10*time.Minute))),
+	}
+	for name, sign := range rejected {
+		if _, rpcErr := rpcCallAuth(t, client, adminURL, sign, "admin_peers"); rpcErr == nil || rpcErr.Code != -32001 {
+			t.Errorf("Expected %s to be rejected, got %+v", name, rpcErr)
+		}
+	}
+
+	result, rpcErr := rpcCallAuth(t, client, adminURL, bearer(node.NewJWTToken(secret, time.Now())), "admin_nodeInfo")
+	if rpcErr != nil {
+		t.Fatalf("Expected JWT authenticated call to succeed: %+v", rpcErr)
+	}
+	var info node.NodeInfo
+	json.Unmarshal(result, &info)
+	if info.NetworkID != 8888 || len(info.Endpoints) != 3 {
+		t.Errorf("Unexpected node info: %+v", info)
+	}
+
+	signed := func(r *http.Request, body []byte) {
+		if err := node.SignRequest(r, body, adminPriv); err != nil {
+			t.Fatalf("Failed to sign request: %v", err)
+		}
+	}
+	result, rpcErr = rpcCallAuth(t, client, adminURL, signed, "admin_removePeer", "unknown-peer")
+	if rpcErr != nil || string(result) != "false" {
+		t.Errorf("Expected Dilithium signed removePeer to return false, got %s (%+v)", result, rpcErr)
+	}
+	tampered := func(r *http.Request, body []byte) { signed(r, append([]byte(" "), body...)) }
+	if _, rpcErr := rpcCallAuth(t, client, adminURL, tampered, "admin_peers"); rpcErr == nil || rpcErr.Code != -32001 {
+		t.Errorf("Expected signature over a different body to be rejected, got %+v", rpcErr)
+	}
+
+	// A captured request can not be replayed, nor its signature used for another path
+	var captured http.Header
+	capture := func(r *http.Request, body []byte) {
+		signed(r, body)
+		captured = r.Header.Clone()
+	}
+	if _, rpcErr := rpcCallAuth(t, client, adminURL, capture, "admin_peers"); rpcErr != nil {
+		t.Fatalf("Expected Dilithium signed call to succeed: %+v", rpcErr)
+	}
+	replayed := func(r *http.Request, body []byte) { r.Header = captured }
+	if _, rpcErr := rpcCallAuth(t, client, adminURL, replayed, "admin_peers"); rpcErr == nil || rpcErr.Code != -32001 {
+		t.Errorf("Expected replayed request to be rejected, got %+v", rpcErr)
+	}
+	otherPath := func(r *http.Request, body []byte) {
+		path := r.URL.Path
+		r.URL.Path = "/admin"
+		signed(r, body)
+		r.URL.Path = path
+	}
+	if _, rpcErr := rpcCallAuth(t, client, adminURL, otherPath, "admin_peers"); rpcErr == nil || rpcErr.Code != -32001 {
+		t.Errorf("Expected signature for another path to be rejected, got %+v", rpcErr)
+	}
+
+	// The unix socket is trusted through its file permissions
+	ipcClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+		},
+	}}
+	result, rpcErr = rpcCallAuth(t, ipcClient, "http://ipc", nil, "admin_peers")
+	if rpcErr != nil || string(result) != "[]" {
+		t.Errorf("Expected admin_peers over IPC to return no peers, got %s (%+v)", result, rpcErr)
+	}
+}
@@ -0,0 +1,128 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/evm"
+	"quantum-blockchain/chain/types"
+	walletSDK "quantum-blockchain/clients/wallet-sdk"
+)
+
+// TestBatchTransactions tests atomic and best-effort batch execution
+func TestBatchTransactions(t *testing.T) {
+	testNode, url, privKey, sender := newRPCTestNode(t, 18652)
+	bc := testNode.GetBlockchain()
+
+	wallet, err := walletSDK.LoadWallet(privKey.Bytes(), crypto.SigAlgDilithium, walletSDK.NewClient(url))
+	if err != nil {
+		t.Fatalf("Failed to load wallet: %v", err)
+	}
+	if wallet.GetAddress() != sender {
+		t.Fatalf("Expected wallet address %s, got %s", sender.Hex(), wallet.GetAddress().Hex())
+	}
+
+	recipients := []types.Address{
+		types.BytesToAddress([]byte("payee-1")),
+		types.BytesToAddress([]byte("payee-2")),
+		types.BytesToAddress([]byte("payee-3")),
+	}
+	var calls []*types.BatchCall
+	for i, to := range recipients {
+		calls = append(calls, &types.BatchCall{To: to, Value: big.NewInt(int64(i + 1))})
+	}
+
+	// The wallet estimates, signs and submits the batch over RPC
+	hash, err := wallet.SendBatch(calls, types.BatchAtomic)
+	if err != nil {
+		t.Fatalf("Failed to send batch: %v", err)
+	}
+	tx, found := testNode.GetTxPool().GetTransaction(hash)
+	if !found {
+		t.Fatalf("Batch transaction %s not in pool", hash.Hex())
+	}
+	addBlock(t, bc, tx)
+
+	receipt, err := bc.GetTransactionReceipt(hash)
+	if err != nil {
+		t.Fatalf("Failed to get receipt: %v", err)
+	}
+	if want := evm.TransactionIntrinsicGas(tx) + 3*evm.BatchCallGas; receipt.Status != 1 || receipt.GasUsed != want {
+		t.Errorf("Expected successful batch using %d gas, got status %d using %d", want, receipt.Status, receipt.GasUsed)
+	}
+	if len(receipt.CallResults) != 3 {
+		t.Fatalf("Expected 3 call results, got %d", len(receipt.CallResults))
+	}
+	for i, to := range recipients {
+		if receipt.CallResults[i].Status != 1 || bc.GetBalance(to).Int64() != int64(i+1) {
+			t.Errorf("Call %d: status %d, recipient balance %s", i, receipt.CallResults[i].Status, bc.GetBalance(to))
+		}
+	}
+
+	// A failing call reverts an atomic batch but not a best-effort one
+	payee := types.BytesToAddress([]byte("payee-4"))
+	failing := []*types.BatchCall{
+		{To: payee, Value: big.NewInt(1)},
+		{To: types.BytesToAddress(evm.DilithiumVerifyAddress.Bytes()), Value: new(big.Int), Data: []byte{0x01}},
+	}
+	for nonce, mode := range []types.BatchMode{types.BatchAtomic, types.BatchBestEffort} {
+		batch := types.NewBatchTransaction(big.NewInt(8888), uint64(nonce+1), failing, mode, 100000, big.NewInt(1000000000))
+		if err := batch.SignTransaction(privKey.Bytes(), crypto.SigAlgDilithium); err != nil {
+			t.Fatalf("Failed to sign batch: %v", err)
+		}
+		addBlock(t, bc, batch)
+
+		receipt, err := bc.GetTransactionReceipt(batch.Hash())
+		if err != nil {
+			t.Fatalf("Failed to get receipt: %v", err)
+		}
+		if len(receipt.CallResults) != 2 || receipt.CallResults[0].Status != 1 || receipt.CallResults[1].Status != 0 {
+			t.Errorf("%s batch: unexpected call results %+v", mode, receipt.CallResults)
+		}
+
+		wantStatus, wantBalance := uint(0), int64(0)
+		if mode == types.BatchBestEffort {
+			wantStatus, wantBalance = 1, 1
+		}
+		if receipt.Status != wantStatus || bc.GetBalance(payee).Int64() != wantBalance {
+			t.Errorf("%s batch: expected status %d and payee balance %d, got %d and %s",
+				mode, wantStatus, wantBalance, receipt.Status, bc.GetBalance(payee))
+		}
+	}
+}
+
+// TestBatchDecoding tests that batches with empty calls are refused when
+// decoded and hash without a panic when built in code
+func TestBatchDecoding(t *testing.T) {
+	calls := []*types.BatchCall{{To: types.BytesToAddress([]byte("payee")), Value: big.NewInt(1)}}
+	tx := types.NewBatchTransaction(big.NewInt(8888), 0, calls, types.BatchAtomic, 100000, big.NewInt(1000000000))
+	data, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatalf("Failed to marshal batch: %v", err)
+	}
+
+	var decoded types.QuantumTransaction
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.Hash() != tx.Hash() {
+		t.Fatalf("Expected the batch to decode to the same hash, got %v", err)
+	}
+
+	start := bytes.Index(data, []byte(`"calls":[`)) + len(`"calls":[`)
+	end := start + bytes.IndexByte(data[start:], '}') + 1
+	empty := append(append(append([]byte{}, data[:start]...), "null"...), data[end:]...)
+	if err := json.Unmarshal(empty, &decoded); err == nil {
+		t.Error("Expected a batch with an empty call to be refused")
+	}
+
+	for _, calls := range [][]*types.BatchCall{{nil}, {{To: types.BytesToAddress([]byte("payee"))}}} {
+		incomplete := types.NewBatchTransaction(big.NewInt(8888), 0, calls, types.BatchAtomic, 100000, big.NewInt(1000000000))
+		if incomplete.Hash().IsZero() {
+			t.Error("Expected an incomplete batch to hash")
+		}
+		if err := incomplete.ValidateBatch(); err == nil {
+			t.Error("Expected an incomplete batch to be invalid")
+		}
+	}
+}
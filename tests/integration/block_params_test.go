@@ -0,0 +1,140 @@
+package integration
+
+import (
+	"encoding/json"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"quantum-blockchain/chain/node"
+	"quantum-blockchain/chain/types"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// TestBlockParameters tests block tags, numbers and EIP-1898 objects across
+// the state reading methods
+func TestBlockParameters(t *testing.T) {
+	testNode, url, privKey, sender := newRPCTestNode(t, 18647)
+	bc := testNode.GetBlockchain()
+	recipient, _ := types.HexToAddress("0x00000000000000000000000000000000000000bb")
+
+	genesis, err := bc.GetBlockByNumber(big.NewInt(0))
+	if err != nil {
+		t.Fatalf("Failed to load genesis: %v", err)
+	}
+	addBlock(t, bc, signedTx(t, privKey, 0, recipient, big.NewInt(5), 50000, nil))
+
+	getString := func(method string, params ...interface{}) string {
+		t.Helper()
+		result, rpcErr := rpcCall(t, url, method, params...)
+		if rpcErr != nil {
+			t.Fatalf("%s failed: %+v", method, rpcErr)
+		}
+		var value string
+		json.Unmarshal(result, &value)
+		return value
+	}
+
+	// Balances differ between genesis and the head
+	cases := []struct {
+		block    interface{}
+		expected string
+	}{
+		{"earliest", "0x0"},
+		{"0x0", "0x0"},
+		{"latest", "0x5"},
+		{"safe", "0x5"},
+		{"finalized", "0x5"},
+		{map[string]interface{}{"blockNumber": "0x0"}, "0x0"},
+		{map[string]interface{}{"blockHash": genesis.Hash().Hex(), "requireCanonical": true}, "0x0"},
+	}
+	for _, c := range cases {
+		if balance := getString("eth_getBalance", recipient.Hex(), c.block); balance != c.expected {
+			t.Errorf("eth_getBalance at %v: expected %s, got %s", c.block, c.expected, balance)
+		}
+	}
+
+	if nonce := getString("eth_getTransactionCount", sender.Hex(), "0x0"); nonce != "0x0" {
+		t.Errorf("Expected nonce 0x0 at genesis, got %s", nonce)
+	}
+
+	// The pending nonce counts contiguous pool transactions only
+	pool := testNode.GetTxPool()
+	pool.AddTransaction(signedTx(t, privKey, 1, recipient, big.NewInt(1), 50000, nil))
+	pool.AddTransaction(signedTx(t, privKey, 3, recipient, big.NewInt(1), 50000, nil))
+	if nonce := getString("eth_getTransactionCount", sender.Hex(), "latest"); nonce != "0x1" {
+		t.Errorf("Expected latest nonce 0x1, got %s", nonce)
+	}
+	if nonce := getString("eth_getTransactionCount", sender.Hex(), "pending"); nonce != "0x2" {
+		t.Errorf("Expected pending nonce 0x2, got %s", nonce)
+	}
+	if balance := getString("eth_getBalance", recipient.Hex(), "pending"); balance != "0x6" {
+		t.Errorf("Expected pending balance 0x6, got %s", balance)
+	}
+
+	// Blocks resolve by tag as well
+	result, rpcErr := rpcCall(t, url, "eth_getBlockByNumber", "earliest", false)
+	if rpcErr != nil || string(result) == "null" {
+		t.Errorf("Expected earliest block, got %s (%+v)", result, rpcErr)
+	}
+
+	// Malformed and unknown blocks are rejected
+	if _, rpcErr := rpcCall(t, url, "eth_getBalance", recipient.Hex(), "newest"); rpcErr == nil || rpcErr.Code != -32602 {
+		t.Errorf("Expected invalid params error, got %+v", rpcErr)
+	}
+	if _, rpcErr := rpcCall(t, url, "eth_getBalance", recipient.Hex(), "0x10"); rpcErr == nil {
+		t.Error("Expected unknown block to fail")
+	}
+
+	// State outside the retention window is reported as pruned
+	bc.SetStateHistory(1)
+	addBlock(t, bc)
+	if balance := getString("eth_getBalance", recipient.Hex(), "0x1"); balance != "0x5" {
+		t.Errorf("Expected balance 0x5 at block 1, got %s", balance)
+	}
+	_, rpcErr = rpcCall(t, url, "eth_getBalance", recipient.Hex(), "0x0")
+	if rpcErr == nil || !strings.Contains(rpcErr.Message, "pruned") {
+		t.Errorf("Expected pruned state error, got %+v", rpcErr)
+	}
+}
+
+// TestStateHistoryPruning tests that shrinking the retention window prunes
+// every reverse diff that fell out of it, not just the newest one
+func TestStateHistoryPruning(t *testing.T) {
+	tempDir := t.TempDir()
+	genesisPath, privKey, _ := writeFundedGenesis(t, tempDir)
+	bc, err := node.NewBlockchain(filepath.Join(tempDir, "chain"), genesisPath)
+	if err != nil {
+		t.Fatalf("Failed to create blockchain: %v", err)
+	}
+
+	recipient, _ := types.HexToAddress("0x00000000000000000000000000000000000000bb")
+	for nonce := uint64(0); nonce < 4; nonce++ {
+		addBlock(t, bc, signedTx(t, privKey, nonce, recipient, big.NewInt(1), 50000, nil))
+	}
+
+	// Head 5 with a window of one block keeps only the diff of block 5
+	bc.SetStateHistory(1)
+	addBlock(t, bc, signedTx(t, privKey, 4, recipient, big.NewInt(1), 50000, nil))
+	if err := bc.Close(); err != nil {
+		t.Fatalf("Failed to close blockchain: %v", err)
+	}
+
+	db, err := leveldb.OpenFile(filepath.Join(tempDir, "chain", "blockchain.db"), nil)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	prefix := []byte("statediff-")
+	iter := db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+	for iter.Next() {
+		if number := new(big.Int).SetBytes(iter.Key()[len(prefix):]); number.Cmp(big.NewInt(4)) <= 0 {
+			t.Errorf("Expected state diff of block %s to be pruned", number)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/evm"
+	"quantum-blockchain/chain/node"
+	"quantum-blockchain/chain/types"
+)
+
+// rpcError is the error object of a JSON-RPC response
+type rpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
+
+// rpcCall posts a single JSON-RPC request and returns its result or error
+func rpcCall(t *testing.T, url, method string, params ...interface{}) (json.RawMessage, *rpcError) {
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+		"id":      1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+
+	resp, err := http.Post(url, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to post %s: %v", method, err)
+	}
+	defer resp.Body.Close()
+
+	var rpcResp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
+		t.Fatalf("Failed to decode %s response: %v", method, err)
+	}
+	return rpcResp.Result, rpcResp.Error
+}
+
+// newRPCTestNode creates an unstarted node with a funded genesis account and
+// serves its RPC on the given port
+func newRPCTestNode(t *testing.T, port int) (*node.Node, string, *crypto.DilithiumPrivateKey, types.Address) {
+	tempDir := t.TempDir()
+	genesisPath, privKey, addr := writeFundedGenesis(t, tempDir)
+
+	testNode, err := node.NewNode(&node.Config{
+		DataDir:       tempDir,
+		NetworkID:     8888,
+		GenesisConfig: genesisPath,
+		GasLimit:      15000000,
+		GasPrice:      big.NewInt(1000000000),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create node: %v", err)
+	}
+	t.Cleanup(func() { testNode.GetBlockchain().Close() })
+
+	server := node.NewRPCServer(testNode, port, 0)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start RPC server: %v", err)
+	}
+	t.Cleanup(server.Stop)
+
+	// Give the server time to start listening
+	time.Sleep(200 * time.Millisecond)
+
+	return testNode, fmt.Sprintf("http://localhost:%d", port), privKey, addr
+}
+
+// TestEthCallAndEstimateGas tests simulated execution on state overlays
+func TestEthCallAndEstimateGas(t *testing.T) {
+	testNode, url, privKey, sender := newRPCTestNode(t, 18646)
+	stranger := "0x00000000000000000000000000000000000000aa"
+
+	// Failing precompile calls revert with an encoded reason
+	_, rpcErr := rpcCall(t, url, "eth_call", map[string]interface{}{
+		"from": sender.Hex(),
+		"to":   "0x000000000000000000000000000000000000000a",
+		"data": "0x0102",
+	}, "latest")
+	if rpcErr == nil || rpcErr.Code != -32000 || !strings.HasPrefix(rpcErr.Message, "execution reverted") {
+		t.Fatalf("Expected execution reverted error, got %+v", rpcErr)
+	}
+	if data, ok := rpcErr.Data.(string); !ok || !strings.HasPrefix(data, "0x08c379a0") {
+		t.Errorf("Expected Error(string) revert data, got %v", rpcErr.Data)
+	}
+
+	// A plain transfer costs the base gas plus the Dilithium signature bytes and verification
+	result, rpcErr := rpcCall(t, url, "eth_estimateGas", map[string]interface{}{
+		"from":  sender.Hex(),
+		"to":    stranger,
+		"value": "0x1",
+	})
+	if rpcErr != nil {
+		t.Fatalf("Estimate failed: %+v", rpcErr)
+	}
+	var estimate string
+	json.Unmarshal(result, &estimate)
+	if estimate != "0x7250" { // 21000 + 2*2420 + 2*1312 + 800
+		t.Errorf("Expected estimate 0x7250, got %s", estimate)
+	}
+
+	// An unfunded sender can not transfer value unless its balance is overridden
+	transfer := map[string]interface{}{
+		"from":  stranger,
+		"to":    sender.Hex(),
+		"value": "0x1",
+	}
+	if _, rpcErr := rpcCall(t, url, "eth_call", transfer, "latest"); rpcErr == nil {
+		t.Error("Expected unfunded transfer to fail")
+	}
+	overrides := map[string]interface{}{
+		stranger: map[string]interface{}{"balance": "0x10"},
+	}
+	if _, rpcErr := rpcCall(t, url, "eth_call", transfer, "latest", overrides); rpcErr != nil {
+		t.Errorf("Expected transfer with balance override to succeed: %+v", rpcErr)
+	}
+
+	// Fund the stranger in block 1, the transfer then only succeeds after genesis
+	strangerAddr, _ := types.HexToAddress(stranger)
+	addBlock(t, testNode.GetBlockchain(), signedTx(t, privKey, 0, strangerAddr, big.NewInt(16), 50000, nil))
+
+	if _, rpcErr := rpcCall(t, url, "eth_call", transfer, "0x0"); rpcErr == nil {
+		t.Error("Expected transfer at genesis to fail")
+	}
+	if _, rpcErr := rpcCall(t, url, "eth_call", transfer, "latest"); rpcErr != nil {
+		t.Errorf("Expected transfer at latest to succeed: %+v", rpcErr)
+	}
+
+	// Unknown block numbers are reported
+	if _, rpcErr := rpcCall(t, url, "eth_call", transfer, "0x10"); rpcErr == nil {
+		t.Error("Expected call at unknown block to fail")
+	}
+}
+
+// TestStateTransitionRules pins the consensus rules shared by mined
+// transactions and eth_call: contract addresses come from the transaction
+// nonce, value is debited once and execution is bounded by the transaction gas
+func TestStateTransitionRules(t *testing.T) {
+	blockchain, privKey, sender := newFundedBlockchain(t)
+
+	create := types.NewQuantumTransaction(big.NewInt(8888), 0, nil, big.NewInt(1000), 200000, big.NewInt(1000000000), []byte{0x60, 0x00})
+	if err := create.SignTransaction(privKey.Bytes(), crypto.SigAlgDilithium); err != nil {
+		t.Fatalf("Failed to sign transaction: %v", err)
+	}
+	before := blockchain.GetBalance(sender)
+	addBlock(t, blockchain, create)
+
+	receipt, err := blockchain.GetTransactionReceipt(create.Hash())
+	if err != nil {
+		t.Fatalf("Failed to get receipt: %v", err)
+	}
+	if receipt.Status != 1 {
+		t.Fatal("Expected contract creation to succeed")
+	}
+	expected := types.CreateContractAddress(sender, 0)
+	if receipt.ContractAddress == nil || *receipt.ContractAddress != expected {
+		t.Errorf("Expected contract address %s, got %v", expected.Hex(), receipt.ContractAddress)
+	}
+	if balance := blockchain.GetBalance(expected); balance.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("Expected contract balance 1000, got %s", balance)
+	}
+	spent := new(big.Int).Mul(new(big.Int).SetUint64(receipt.GasUsed), receipt.EffectiveGasPrice)
+	spent.Add(spent, big.NewInt(1000))
+	if diff := new(big.Int).Sub(before, blockchain.GetBalance(sender)); diff.Cmp(spent) != 0 {
+		t.Errorf("Expected sender to pay %s once, paid %s", spent, diff)
+	}
+
+	// A creation that needs more gas than the transaction carries runs out of
+	// its own gas, not the block's
+	code := bytes.Repeat([]byte{0x01}, 200)
+	short := types.NewQuantumTransaction(big.NewInt(8888), 1, nil, big.NewInt(0), 0, big.NewInt(1000000000), code)
+	// Sign once to size the signature, then again over the final gas
+	if err := short.SignTransaction(privKey.Bytes(), crypto.SigAlgDilithium); err != nil {
+		t.Fatalf("Failed to sign transaction: %v", err)
+	}
+	short.Gas = evm.TransactionIntrinsicGas(short) + 1000
+	if err := short.SignTransaction(privKey.Bytes(), crypto.SigAlgDilithium); err != nil {
+		t.Fatalf("Failed to sign transaction: %v", err)
+	}
+	addBlock(t, blockchain, short)
+
+	receipt, err = blockchain.GetTransactionReceipt(short.Hash())
+	if err != nil {
+		t.Fatalf("Failed to get receipt: %v", err)
+	}
+	if receipt.Status != 0 || receipt.GasUsed != short.GetGas() {
+		t.Errorf("Expected out of gas at %d, got status %d gas %d", short.GetGas(), receipt.Status, receipt.GasUsed)
+	}
+	if len(blockchain.GetCode(types.CreateContractAddress(sender, 1))) != 0 {
+		t.Error("Expected no code for the failed creation")
+	}
+}
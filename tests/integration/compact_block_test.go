@@ -0,0 +1,121 @@
+package integration
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"time"
+
+	"quantum-blockchain/chain/types"
+)
+
+// TestCompactBlockRelay tests that blocks are rebuilt from the pool of the
+// receiver, which only fetches the transactions it misses
+func TestCompactBlockRelay(t *testing.T) {
+	origin := newGossipNode(t, nil)
+	receiver := newGossipNode(t, []string{origin.p2p.ListenAddr()})
+	deadline := time.Now().Add(10 * time.Second)
+	for len(origin.p2p.GetPeers()) == 0 || len(receiver.p2p.GetPeers()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Networks did not connect")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// The receiver gets most transactions through gossip beforehand
+	var txs []*types.QuantumTransaction
+	for i := uint64(0); i < 20; i++ {
+		tx := types.NewQuantumTransaction(big.NewInt(8888), i, nil, big.NewInt(1), 21000, big.NewInt(1000000000), bytes.Repeat([]byte{byte(i)}, 2048))
+		txs = append(txs, tx)
+		origin.add(tx)
+		if i < 15 {
+			origin.p2p.BroadcastTransaction(tx)
+		}
+	}
+	for receiver.count() < 15 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Receiver got %d of 15 gossiped transactions", receiver.count())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// One gossiped transaction was evicted from the pool of the receiver
+	receiver.remove(txs[3].Hash())
+
+	block := types.NewBlock(types.NewBlockHeader(types.ZeroHash, types.Address{}, types.ZeroHash, big.NewInt(1), 30000000, uint64(time.Now().Unix())), txs, nil)
+	origin.p2p.BroadcastBlock(block)
+
+	select {
+	case got := <-receiver.blocks:
+		if got.Hash() != block.Hash() || len(got.Transactions) != len(txs) {
+			t.Fatalf("Expected block %s with %d transactions, got %s with %d", block.Hash().Hex(), len(txs), got.Hash().Hex(), len(got.Transactions))
+		}
+		for i, tx := range got.Transactions {
+			if tx.Hash() != txs[i].Hash() {
+				t.Errorf("Expected transaction %d to be %s, got %s", i, txs[i].Hash().Hex(), tx.Hash().Hex())
+			}
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Timed out waiting for the block")
+	}
+
+	// Only the transactions never gossiped are sent along, the evicted one is fetched
+	if stats := origin.p2p.CompactBlockStats(); stats.Sent != 1 || stats.Prefilled != 5 {
+		t.Errorf("Expected one compact block with 5 prefilled transactions, got %+v", stats)
+	}
+	if stats := receiver.p2p.CompactBlockStats(); stats.Reconstructed != 1 || stats.Requested != 1 {
+		t.Errorf("Expected the block rebuilt with one requested transaction, got %+v", stats)
+	}
+
+	// A block is handled once
+	origin.p2p.BroadcastBlock(block)
+	select {
+	case <-receiver.blocks:
+		t.Error("Expected a known block not to be delivered again")
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+// TestCompactBlockValidation tests that a block relayed with a body its
+// header does not commit to is refused without shutting out the real block,
+// and that headers missing hashed fields are refused
+func TestCompactBlockValidation(t *testing.T) {
+	origin := newGossipNode(t, nil)
+	receiver := newGossipNode(t, []string{origin.p2p.ListenAddr()})
+	deadline := time.Now().Add(10 * time.Second)
+	for len(origin.p2p.GetPeers()) == 0 || len(receiver.p2p.GetPeers()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Networks did not connect")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	header := types.NewBlockHeader(types.ZeroHash, types.Address{}, types.ZeroHash, big.NewInt(1), 30000000, uint64(time.Now().Unix()))
+	honest := types.NewBlock(header, nil, nil)
+	forged := &types.Block{Header: header, Evidence: [][]byte{[]byte("forged")}}
+	origin.p2p.BroadcastBlock(forged)
+	select {
+	case <-receiver.blocks:
+		t.Fatal("Expected a block with evidence outside its root to be refused")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	origin.p2p.BroadcastBlock(honest)
+	select {
+	case got := <-receiver.blocks:
+		if got.Hash() != honest.Hash() || len(got.Evidence) != 0 {
+			t.Errorf("Expected the honest block %s, got %s with %d evidence", honest.Hash().Hex(), got.Hash().Hex(), len(got.Evidence))
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Expected the honest block after the forged relay")
+	}
+
+	for _, header := range []*types.BlockHeader{{Number: big.NewInt(5)}, {Difficulty: new(big.Int)}, {Number: big.NewInt(-1), Difficulty: new(big.Int)}} {
+		if err := header.ValidateFields(); err == nil {
+			t.Errorf("Expected header %+v to be refused", header)
+		}
+	}
+	if err := honest.Header.ValidateFields(); err != nil {
+		t.Errorf("Expected a complete header to pass, got %v", err)
+	}
+}
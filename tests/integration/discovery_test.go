@@ -0,0 +1,226 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"quantum-blockchain/chain/network"
+	"quantum-blockchain/chain/node"
+	"quantum-blockchain/chain/types"
+)
+
+// newTestRecord creates a record of a fresh identity
+func newTestRecord(t *testing.T, address string, forkID network.ForkID) *network.NodeRecord {
+	t.Helper()
+	identity, err := network.GenerateNodeIdentity()
+	if err != nil {
+		t.Fatalf("Failed to generate identity: %v", err)
+	}
+	record, err := network.NewNodeRecord(identity, 1, address, 8888, forkID)
+	if err != nil {
+		t.Fatalf("Failed to create node record: %v", err)
+	}
+	return record
+}
+
+// TestNodeRecord tests signing and encoding node records
+func TestNodeRecord(t *testing.T) {
+	forkID := network.NewForkID(types.BytesToHash([]byte("genesis")))
+	record := newTestRecord(t, "10.0.0.1:30303", forkID)
+	if err := record.Verify(); err != nil {
+		t.Fatalf("Expected record to verify: %v", err)
+	}
+
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		t.Fatalf("Failed to encode record: %v", err)
+	}
+	var decoded network.NodeRecord
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("Failed to decode record: %v", err)
+	}
+	if decoded.ForkID != forkID || decoded.ID() != record.ID() || decoded.Verify() != nil {
+		t.Errorf("Expected the record to round trip, got %+v", decoded)
+	}
+
+	// Relayed records can not be altered
+	decoded.Address = "10.6.6.6:30303"
+	if err := decoded.Verify(); err == nil {
+		t.Error("Expected a record with a changed address to fail verification")
+	}
+}
+
+// TestRoutingTable tests the Kademlia buckets and closest node queries
+func TestRoutingTable(t *testing.T) {
+	self, err := network.GenerateNodeIdentity()
+	if err != nil {
+		t.Fatalf("Failed to generate identity: %v", err)
+	}
+	table := network.NewRoutingTable(self.ID())
+
+	// Half of all IDs fall in the farthest bucket, fill it past its size
+	var farthest []*network.NodeRecord
+	for len(farthest) <= network.BucketSize {
+		record := newTestRecord(t, "127.0.0.1:1", network.ForkID{})
+		added := table.Add(record)
+		if network.LogDistance(self.ID(), record.ID()) != 256 {
+			continue
+		}
+		farthest = append(farthest, record)
+		if added != (len(farthest) <= network.BucketSize) {
+			t.Fatalf("Expected record %d of the bucket to be added: %v", len(farthest), !added)
+		}
+	}
+	replacement := farthest[network.BucketSize]
+	if table.Get(replacement.ID()) != nil {
+		t.Fatal("Expected the record beyond the bucket size to be a replacement")
+	}
+
+	// Removing an entry promotes the replacement
+	table.Remove(farthest[0].ID())
+	if table.Get(farthest[0].ID()) != nil || table.Get(replacement.ID()) == nil {
+		t.Error("Expected the replacement to take the place of the removed entry")
+	}
+
+	// Closest returns records ordered by distance to the target
+	target := network.RandomNodeID()
+	closest := table.Closest(target, 5)
+	if len(closest) != 5 {
+		t.Fatalf("Expected 5 closest records, got %d", len(closest))
+	}
+	for i := 1; i < len(closest); i++ {
+		if network.LogDistance(target, closest[i-1].ID()) > network.LogDistance(target, closest[i].ID()) {
+			t.Errorf("Expected closest records in distance order at %d", i)
+		}
+	}
+}
+
+// TestPeerDB tests that discovered nodes persist across restarts
+func TestPeerDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.json")
+	db, err := network.OpenPeerDB(path)
+	if err != nil {
+		t.Fatalf("Failed to open peer database: %v", err)
+	}
+
+	stable := newTestRecord(t, "10.0.0.1:30303", network.ForkID{})
+	flaky := newTestRecord(t, "10.0.0.2:30303", network.ForkID{})
+	db.Update(stable)
+	db.Update(flaky)
+	db.MarkSeen(stable.ID())
+	for i := 0; i < network.MaxDialFailures; i++ {
+		db.MarkFailed(flaky.ID())
+	}
+	if db.Get(flaky.ID()) != nil || db.Len() != 1 {
+		t.Fatalf("Expected a node failing %d times to be forgotten", network.MaxDialFailures)
+	}
+	if err := db.Save(); err != nil {
+		t.Fatalf("Failed to save peer database: %v", err)
+	}
+
+	reopened, err := network.OpenPeerDB(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen peer database: %v", err)
+	}
+	if entry := reopened.Get(stable.ID()); entry == nil || entry.Record.Address != stable.Address {
+		t.Fatalf("Expected the stable node to persist, got %+v", entry)
+	}
+
+	// Entries with forged records are dropped on load
+	data, _ := os.ReadFile(path)
+	var entries []map[string]interface{}
+	json.Unmarshal(data, &entries)
+	entries[0]["record"].(map[string]interface{})["address"] = "10.6.6.6:30303"
+	data, _ = json.Marshal(entries)
+	os.WriteFile(path, data, 0600)
+	forged, err := network.OpenPeerDB(path)
+	if err != nil {
+		t.Fatalf("Failed to open peer database: %v", err)
+	}
+	if forged.Len() != 0 {
+		t.Errorf("Expected the forged record to be dropped, got %d nodes", forged.Len())
+	}
+}
+
+// TestDiscovery tests that nodes find each other through a bootstrap node
+// they share, and that nodes of another fork are refused
+func TestDiscovery(t *testing.T) {
+	forkID := network.NewForkID(types.BytesToHash([]byte("genesis")))
+	startNetwork := func(bootstrap []string, forkID network.ForkID, peerDB string) *node.P2PNetwork {
+		t.Helper()
+		identity, err := network.GenerateNodeIdentity()
+		if err != nil {
+			t.Fatalf("Failed to generate identity: %v", err)
+		}
+		p2p := node.NewP2PNetwork("127.0.0.1:0", bootstrap, identity)
+		if err := p2p.ConfigureDiscovery(&node.DiscoveryConfig{ChainID: 8888, ForkID: forkID, PeerDB: peerDB}); err != nil {
+			t.Fatalf("Failed to configure discovery: %v", err)
+		}
+		if err := p2p.Start(context.Background()); err != nil {
+			t.Fatalf("Failed to start P2P network: %v", err)
+		}
+		return p2p
+	}
+	connected := func(a, b *node.P2PNetwork) bool {
+		for _, peer := range a.GetPeers() {
+			if peer.ID == b.NodeID() {
+				return true
+			}
+		}
+		return false
+	}
+	waitFor := func(what string, condition func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(15 * time.Second)
+		for !condition() {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %s", what)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	boot := startNetwork(nil, forkID, "")
+	defer boot.Stop()
+	first := startNetwork([]string{boot.ListenAddr()}, forkID, "")
+	defer first.Stop()
+	waitFor("the first node to join", func() bool { return connected(boot, first) && connected(first, boot) })
+
+	// The second node only knows the bootstrap node, and learns about the
+	// first one from its neighbors
+	peerDB := filepath.Join(t.TempDir(), "peers.json")
+	second := startNetwork([]string{boot.ListenAddr()}, forkID, peerDB)
+	waitFor("the second node to discover the first", func() bool { return connected(second, first) && connected(first, second) })
+
+	info := second.DiscoveryInfo()
+	if info.TableNodes != 2 || info.Lookups == 0 || info.Record.Address != second.ListenAddr() {
+		t.Errorf("Unexpected discovery state %+v", info)
+	}
+
+	// The discovered nodes are saved for the next start
+	second.Stop()
+	db, err := network.OpenPeerDB(peerDB)
+	if err != nil {
+		t.Fatalf("Failed to open peer database: %v", err)
+	}
+	if db.Get(boot.NodeID()) == nil || db.Get(first.NodeID()) == nil {
+		t.Errorf("Expected both nodes in the peer database, got %d nodes", db.Len())
+	}
+
+	// A node restarting from its peer database rejoins without bootstrap peers
+	restarted := startNetwork(nil, forkID, peerDB)
+	defer restarted.Stop()
+	waitFor("the restarted node to rejoin", func() bool { return connected(restarted, boot) && connected(restarted, first) })
+
+	// A node on another fork is refused
+	other := startNetwork([]string{boot.ListenAddr()}, network.ForkID{1, 2, 3, 4}, "")
+	defer other.Stop()
+	time.Sleep(500 * time.Millisecond)
+	if len(other.GetPeers()) != 0 || connected(boot, other) {
+		t.Error("Expected a node on another fork to be refused")
+	}
+}
@@ -0,0 +1,230 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/evm"
+	"quantum-blockchain/chain/node"
+	"quantum-blockchain/chain/types"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// encryptedTx creates a transfer whose key is split among the given validator keys
+func encryptedTx(t *testing.T, privKey *crypto.DilithiumPrivateKey, nonce, epoch uint64, keys []*types.EncryptionKey, threshold uint8, to types.Address, value *big.Int) *types.QuantumTransaction {
+	payload := &types.EncryptedPayload{To: &to, Value: value}
+	tx, err := types.NewEncryptedTransaction(big.NewInt(8888), nonce, epoch, keys, threshold, payload, 100000, big.NewInt(1000000000))
+	if err != nil {
+		t.Fatalf("Failed to encrypt transaction: %v", err)
+	}
+	if err := tx.SignTransaction(privKey.Bytes(), crypto.SigAlgDilithium); err != nil {
+		t.Fatalf("Failed to sign transaction: %v", err)
+	}
+	return tx
+}
+
+// releasedKeys recovers the payload keys of the encrypted transactions of a
+// block from the key shares the given validators release
+func releasedKeys(t *testing.T, block *types.Block, validators []types.Address, keyrings []*node.EpochKeyring) [][]byte {
+	var keys [][]byte
+	for i, tx := range block.EncryptedTransactions() {
+		secrets := make([][]byte, len(tx.KeyShares))
+		for j, validator := range validators {
+			released, _ := keyrings[j].ShareSecrets(block, validator)
+			for k, share := range tx.KeyShares {
+				if share.Validator == validator {
+					secrets[k] = released[i]
+				}
+			}
+		}
+		key, err := tx.RecoverPayloadKey(secrets)
+		if err != nil {
+			t.Fatalf("Failed to recover payload key: %v", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// nextBlock builds a block on top of the current head without adding it
+func nextBlock(blockchain *node.Blockchain, txs ...*types.QuantumTransaction) *types.Block {
+	parent := blockchain.GetCurrentBlock()
+	header := types.NewBlockHeader(parent.Hash(), types.BytesToAddress([]byte("coinbase")), types.ZeroHash,
+		new(big.Int).Add(parent.Number(), big.NewInt(1)), types.DefaultBlockGasLimit, parent.Time()+1)
+	header.BaseFee = types.CalcBaseFee(parent.Header)
+	return types.NewBlock(header, txs, nil)
+}
+
+// TestEncryptedMempool tests transactions whose payload is revealed by the
+// validators' key shares once their block is committed and executes in the next block
+func TestEncryptedMempool(t *testing.T) {
+	bc, privKey, sender := newFundedBlockchain(t)
+	pool := node.NewTxPool(100)
+	pool.SetBalanceSource(bc.GetBalance)
+	recipient := types.BytesToAddress([]byte("recipient"))
+
+	// Three validators, any two of which reveal a transaction
+	var validators []types.Address
+	var keyrings []*node.EpochKeyring
+	var keys []*types.EncryptionKey
+	for i := 0; i < 3; i++ {
+		validator := types.BytesToAddress([]byte{byte(i + 1)})
+		keyring := node.NewEpochKeyring(bytes.Repeat([]byte{byte(i + 1)}, 32))
+		validators = append(validators, validator)
+		keyrings = append(keyrings, keyring)
+		keys = append(keys, &types.EncryptionKey{Validator: validator, PublicKey: keyring.PublicKey(0)})
+	}
+
+	// The recipient and value are hidden in the pool
+	tx := encryptedTx(t, privKey, 0, 0, keys, 2, recipient, big.NewInt(1000))
+	if tx.GetTo() != nil || tx.GetValue().Sign() != 0 || bytes.Contains(tx.Data, recipient.Bytes()) {
+		t.Fatal("Expected the payload to be hidden")
+	}
+	if err := pool.ValidateTransaction(tx); err != nil {
+		t.Fatalf("Expected encrypted transaction to be valid: %v", err)
+	}
+	encoded, _ := json.Marshal(tx)
+	decoded, err := types.DecodeRLPTransaction(encoded)
+	if err != nil || decoded.Hash() != tx.Hash() || decoded.EncryptionEpoch != 0 || !decoded.IsEncrypted() || len(decoded.KeyShares) != 3 {
+		t.Fatalf("Expected encrypted transaction to survive encoding, got %v", err)
+	}
+	if err := encryptedTx(t, privKey, 0, 5, keys, 2, recipient, big.NewInt(1)).CheckEncryptionEpoch(1); !errors.Is(err, types.ErrEncryptionEpoch) {
+		t.Errorf("Expected future epoch to be rejected, got %v", err)
+	}
+
+	// The block ordering the transaction does not execute it
+	ordering := nextBlock(bc, tx)
+	if err := bc.AddBlock(ordering); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+	if _, err := bc.GetTransactionReceipt(tx.Hash()); err == nil || bc.GetNonce(sender) != 0 {
+		t.Fatal("Expected the encrypted transaction to wait for the next block")
+	}
+
+	// One validator's share reveals nothing, two reveal the payload
+	single, _ := keyrings[0].ShareSecrets(ordering, validators[0])
+	if _, err := tx.RecoverPayloadKey([][]byte{single[0], nil, nil}); !errors.Is(err, types.ErrUndecryptable) {
+		t.Fatalf("Expected a single share to reveal nothing, got %v", err)
+	}
+	revealed := releasedKeys(t, ordering, validators[1:], keyrings[1:])
+
+	// The next block must reveal the right key and hold nothing else of the sender
+	if err := bc.AddBlock(nextBlock(bc)); err == nil {
+		t.Fatal("Expected block without decryption keys to be rejected")
+	}
+	forged := nextBlock(bc)
+	forged.SetDecryptionKeys([][]byte{bytes.Repeat([]byte{0x01}, crypto.KyberSharedSecretSize)})
+	if err := bc.AddBlock(forged); err == nil {
+		t.Fatal("Expected block with a wrong decryption key to be rejected")
+	}
+	early := nextBlock(bc, signedTx(t, privKey, 0, recipient, big.NewInt(1), 100000, nil))
+	early.SetDecryptionKeys(revealed)
+	if err := bc.AddBlock(early); err == nil {
+		t.Fatal("Expected block with another transaction of the sender to be rejected")
+	}
+
+	block := nextBlock(bc)
+	block.SetDecryptionKeys(revealed)
+	if err := bc.AddBlock(block); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+	receipt, err := bc.GetTransactionReceipt(tx.Hash())
+	if err != nil {
+		t.Fatalf("Failed to get receipt: %v", err)
+	}
+	if receipt.Status != 1 || receipt.To == nil || *receipt.To != recipient || receipt.BlockHash != block.Hash() {
+		t.Fatalf("Expected successful transfer to the recipient in the next block, got status %d to %v", receipt.Status, receipt.To)
+	}
+	if want := evm.TransactionIntrinsicGas(tx); receipt.GasUsed != want {
+		t.Errorf("Expected %d gas, got %d", want, receipt.GasUsed)
+	}
+	if bc.GetBalance(recipient).Int64() != 1000 || bc.GetNonce(sender) != 1 {
+		t.Errorf("Expected recipient balance 1000 and nonce 1, got %s and %d", bc.GetBalance(recipient), bc.GetNonce(sender))
+	}
+
+	// A transaction whose key is withheld only pays its intrinsic gas
+	withheld := encryptedTx(t, privKey, 1, 0, keys, 2, recipient, big.NewInt(1000))
+	if err := bc.AddBlock(nextBlock(bc, withheld)); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+	block = nextBlock(bc)
+	block.SetDecryptionKeys([][]byte{{}})
+	if err := bc.AddBlock(block); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+	receipt, err = bc.GetTransactionReceipt(withheld.Hash())
+	if err != nil {
+		t.Fatalf("Failed to get receipt: %v", err)
+	}
+	if receipt.Status != 0 || receipt.GasUsed != evm.TransactionIntrinsicGas(withheld) {
+		t.Errorf("Expected failed transaction using intrinsic gas, got status %d using %d", receipt.Status, receipt.GasUsed)
+	}
+	if bc.GetBalance(recipient).Int64() != 1000 || bc.GetNonce(sender) != 2 {
+		t.Errorf("Expected no transfer and nonce 2, got balance %s and nonce %d", bc.GetBalance(recipient), bc.GetNonce(sender))
+	}
+}
+
+// TestEncryptionKeyRPC tests that validators publish their epoch keys over RPC
+func TestEncryptionKeyRPC(t *testing.T) {
+	_, url, _, _ := newRPCTestNode(t, 18654)
+	if _, rpcErr := rpcCall(t, url, "quantum_getEncryptionKey"); rpcErr == nil {
+		t.Error("Expected nodes without a validator key to have no encryption key")
+	}
+
+	tempDir := t.TempDir()
+	validator, err := node.NewNode(&node.Config{
+		DataDir:       tempDir,
+		NetworkID:     8888,
+		ValidatorKey:  "auto",
+		MempoolSecret: "mempool.secret",
+		GasLimit:      15000000,
+		GasPrice:      big.NewInt(1000000000),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create validator: %v", err)
+	}
+	t.Cleanup(func() { validator.GetBlockchain().Close() })
+	server := node.NewRPCServer(validator, 18655, 0)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start RPC server: %v", err)
+	}
+	t.Cleanup(server.Stop)
+
+	result, rpcErr := rpcCall(t, "http://localhost:18655", "quantum_getEncryptionKey", "0x2")
+	if rpcErr != nil {
+		t.Fatalf("quantum_getEncryptionKey failed: %+v", rpcErr)
+	}
+	var key node.EncryptionKeyResult
+	if err := json.Unmarshal(result, &key); err != nil {
+		t.Fatalf("Failed to decode key: %v", err)
+	}
+	if key.Epoch != 2 || key.FirstBlock != hexutil.Uint64(2*types.EncryptionEpochLength) || key.Threshold != 1 {
+		t.Errorf("Expected epoch 2 starting at block %d with threshold 1, got %+v", 2*types.EncryptionEpochLength, key)
+	}
+	if len(key.Keys) != 1 || key.Keys[0].Validator != validator.GetValidatorAddress() ||
+		!bytes.Equal(key.Keys[0].PublicKey, validator.GetEpochKeyring().PublicKey(2).Bytes()) {
+		t.Error("Expected the published key to be the epoch key of the validator")
+	}
+
+	// Every validator of a mesh holds keys of its own
+	meshValidator, err := node.NewNode(&node.Config{
+		DataDir:        t.TempDir(),
+		NetworkID:      8888,
+		ValidatorKey:   "auto",
+		ValidatorPeers: []string{"127.0.0.1:1"},
+		GasLimit:       15000000,
+		GasPrice:       big.NewInt(1000000000),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create validator: %v", err)
+	}
+	t.Cleanup(func() { meshValidator.GetBlockchain().Close() })
+	if meshValidator.GetEpochKeyring() == nil || bytes.Equal(meshValidator.GetEpochKeyring().PublicKey(2).Bytes(), validator.GetEpochKeyring().PublicKey(2).Bytes()) {
+		t.Error("Expected a mesh validator to hold epoch keys of its own")
+	}
+}
@@ -0,0 +1,140 @@
+package integration
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"quantum-blockchain/chain/consensus"
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/node"
+	"quantum-blockchain/chain/types"
+)
+
+// TestEpochTransitions tests that changes to the validators wait for the
+// next epoch, keeping the proposer schedule of the epoch, and that every
+// epoch remembers its set
+func TestEpochTransitions(t *testing.T) {
+	mvc := consensus.NewMultiValidatorConsensus(big.NewInt(8888))
+	stake, _ := new(big.Int).SetString("200000000000000000000000", 10)
+	if err := mvc.SetEpochBlocks(10); err != nil {
+		t.Fatalf("Failed to set epoch blocks: %v", err)
+	}
+
+	addrs := make([]types.Address, 5)
+	keys := make([][]byte, 5)
+	for i := range addrs {
+		_, pub, err := crypto.GenerateDilithiumKeyPair()
+		if err != nil {
+			t.Fatalf("Failed to generate key: %v", err)
+		}
+		addrs[i], keys[i] = types.PublicKeyToAddress(pub.Bytes()), pub.Bytes()
+	}
+	for i := 0; i < 4; i++ {
+		if err := mvc.RegisterValidator(addrs[i], keys[i], stake, crypto.SigAlgDilithium, 0.05); err != nil {
+			t.Fatalf("Failed to register validator: %v", err)
+		}
+	}
+
+	genesis := mvc.StartEpochs(0)
+	if genesis.Epoch != 0 || len(genesis.Validators) != 4 {
+		t.Fatalf("Expected the genesis validators in epoch 0, got %d in epoch %d", len(genesis.Validators), genesis.Epoch)
+	}
+	schedule := make([]types.Address, 10)
+	for height := range schedule {
+		schedule[height], _ = mvc.GetNextProposer(uint64(height))
+	}
+
+	// Registrations, stake changes and jailing wait for the next epoch
+	if err := mvc.RegisterValidator(addrs[4], keys[4], stake, crypto.SigAlgDilithium, 0.05); err != nil {
+		t.Fatalf("Failed to register validator: %v", err)
+	}
+	if err := mvc.Delegate(types.BytesToAddress([]byte("delegator")), addrs[1], stake); err != nil {
+		t.Fatalf("Failed to delegate: %v", err)
+	}
+	half := func(stake *big.Int) *big.Int { return new(big.Int).Div(stake, big.NewInt(2)) }
+	if _, err := mvc.SlashStake(addrs[2], half, "double signing", time.Now()); err != nil {
+		t.Fatalf("Failed to slash: %v", err)
+	}
+	if len(mvc.GetValidatorSet()) != 4 {
+		t.Errorf("Expected the set to keep 4 validators during the epoch, got %d", len(mvc.GetValidatorSet()))
+	}
+	for height, proposer := range schedule {
+		if next, _ := mvc.GetNextProposer(uint64(height)); next != proposer {
+			t.Errorf("Expected the proposer of block %d to stay %s, got %s", height, proposer.Hex(), next.Hex())
+		}
+	}
+
+	// The next epoch applies them
+	if _, err := mvc.BeginEpoch(0); err == nil {
+		t.Error("Expected beginning an epoch again to fail")
+	}
+	next, err := mvc.BeginEpoch(1)
+	if err != nil {
+		t.Fatalf("Failed to begin epoch: %v", err)
+	}
+	if next.FirstBlock != 10 || len(next.Validators) != 4 || mvc.CurrentEpoch() != 1 {
+		t.Fatalf("Expected 4 validators from block 10, got %d from block %d", len(next.Validators), next.FirstBlock)
+	}
+	members := make(map[types.Address]*big.Int)
+	for _, validator := range next.Validators {
+		members[validator.Address] = validator.VotingPower
+	}
+	if members[addrs[2]] != nil || members[addrs[4]] == nil {
+		t.Error("Expected the jailed validator to leave and the registered one to join")
+	}
+	if want := new(big.Int).Mul(stake, big.NewInt(2)); members[addrs[1]] == nil || members[addrs[1]].Cmp(want) != 0 {
+		t.Errorf("Expected the delegation to raise the voting power to %s, got %v", want, members[addrs[1]])
+	}
+	if next.Validators[0].Address != addrs[1] {
+		t.Error("Expected the set ordered by stake")
+	}
+	if next.Hash() == genesis.Hash() {
+		t.Error("Expected the sets of the epochs to hash differently")
+	}
+	if set, ok := mvc.GetEpochValidatorSet(0); !ok || set.Hash() != genesis.Hash() {
+		t.Error("Expected the set of epoch 0 to be kept")
+	}
+	if mvc.EpochOf(19) != 1 || mvc.EpochOf(20) != 2 {
+		t.Error("Expected epochs of 10 blocks")
+	}
+}
+
+// TestSimulationEpochs tests that the first block of every epoch commits to
+// the validator set every node began the epoch with
+func TestSimulationEpochs(t *testing.T) {
+	sim := newSimulator(t, &node.SimulationConfig{
+		Validators:  4,
+		Seed:        13,
+		Latency:     20 * time.Millisecond,
+		Jitter:      100 * time.Millisecond,
+		EpochBlocks: 4,
+	})
+	if !sim.RunUntil(2*time.Minute, func() bool { return minHeight(sim) >= 9 }) {
+		t.Fatalf("Expected all validators to reach block #9, lowest at #%d", minHeight(sim))
+	}
+	checkInvariants(t, sim)
+
+	for i, n := range sim.Nodes() {
+		mvc := n.GetMultiConsensus()
+		for number := uint64(1); number <= 9; number++ {
+			block, err := n.GetBlockchain().GetBlockByNumber(new(big.Int).SetUint64(number))
+			if err != nil {
+				t.Fatalf("Validator %d misses block #%d: %v", i, number, err)
+			}
+			if number%4 != 0 {
+				if !block.Header.ValidatorsHash.IsZero() {
+					t.Errorf("Expected block #%d of validator %d to commit to no set", number, i)
+				}
+				continue
+			}
+			set, ok := mvc.GetEpochValidatorSet(number / 4)
+			if !ok || block.Header.ValidatorsHash != set.Hash() {
+				t.Errorf("Expected block #%d of validator %d to commit to the set of epoch %d", number, i, number/4)
+			}
+		}
+		if mvc.CurrentEpoch() != 2 {
+			t.Errorf("Expected validator %d in epoch 2, got %d", i, mvc.CurrentEpoch())
+		}
+	}
+}
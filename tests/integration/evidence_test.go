@@ -0,0 +1,157 @@
+package integration
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"quantum-blockchain/chain/consensus"
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/economics"
+	"quantum-blockchain/chain/types"
+)
+
+// TestEvidence tests that only conflicting blocks or votes signed by the
+// registered key of a validator prove double signing, and that the pool
+// keeps one evidence per offence
+func TestEvidence(t *testing.T) {
+	mvc := consensus.NewMultiValidatorConsensus(big.NewInt(8888))
+	stake, _ := new(big.Int).SetString("100000000000000000000000", 10)
+
+	privs := make([]*crypto.DilithiumPrivateKey, 3)
+	addrs := make([]types.Address, 3)
+	for i := range privs {
+		priv, pub, err := crypto.GenerateDilithiumKeyPair()
+		if err != nil {
+			t.Fatalf("Failed to generate key: %v", err)
+		}
+		privs[i], addrs[i] = priv, types.PublicKeyToAddress(pub.Bytes())
+		if err := mvc.RegisterValidator(addrs[i], pub.Bytes(), stake, crypto.SigAlgDilithium, 0.05); err != nil {
+			t.Fatalf("Failed to register validator: %v", err)
+		}
+	}
+
+	// The validator votes for one block, then for another at the same height
+	first, err := mvc.SubmitConsensusVote(addrs[0], types.BytesToHash([]byte("block a")), 5, 0, consensus.VoteCommit, privs[0].Bytes())
+	if err != nil {
+		t.Fatalf("Failed to vote: %v", err)
+	}
+	other := consensus.NewMultiValidatorConsensus(big.NewInt(8888))
+	other.RegisterValidator(addrs[0], privs[0].Public().Bytes(), stake, crypto.SigAlgDilithium, 0.05)
+	second, err := other.SubmitConsensusVote(addrs[0], types.BytesToHash([]byte("block b")), 5, 0, consensus.VoteCommit, privs[0].Bytes())
+	if err != nil {
+		t.Fatalf("Failed to vote: %v", err)
+	}
+	if err := mvc.AddVote(second); !errors.Is(err, consensus.ErrConflictingVote) {
+		t.Fatalf("Expected a conflicting vote, got %v", err)
+	}
+
+	evidence := consensus.NewDuplicateVoteEvidence(first, second)
+	if err := mvc.VerifyEvidence(evidence); err != nil {
+		t.Errorf("Expected duplicate votes to prove double signing: %v", err)
+	}
+	if swapped := consensus.NewDuplicateVoteEvidence(second, first); swapped.ID() != evidence.ID() || swapped.Votes[0] != evidence.Votes[0] {
+		t.Error("Expected both orders of the votes to give the same evidence")
+	}
+	encoded, err := evidence.Encode()
+	if err != nil {
+		t.Fatalf("Failed to encode evidence: %v", err)
+	}
+	decoded, err := consensus.DecodeEvidence(encoded)
+	if err != nil || mvc.VerifyEvidence(decoded) != nil {
+		t.Errorf("Expected evidence to survive encoding: %v", err)
+	}
+
+	// The same vote twice or a vote signed by another key prove nothing
+	if err := mvc.VerifyEvidence(consensus.NewDuplicateVoteEvidence(first, first)); !errors.Is(err, consensus.ErrInvalidEvidence) {
+		t.Errorf("Expected a repeated vote to be no evidence, got %v", err)
+	}
+	forger := consensus.NewMultiValidatorConsensus(big.NewInt(8888))
+	forger.RegisterValidator(addrs[0], privs[1].Public().Bytes(), stake, crypto.SigAlgDilithium, 0.05)
+	forged, _ := forger.SubmitConsensusVote(addrs[0], types.BytesToHash([]byte("block c")), 5, 0, consensus.VoteCommit, privs[1].Bytes())
+	if err := mvc.VerifyEvidence(consensus.NewDuplicateVoteEvidence(first, forged)); !errors.Is(err, consensus.ErrInvalidEvidence) {
+		t.Errorf("Expected a vote signed with another key to be no evidence, got %v", err)
+	}
+
+	// A vote for another block in a later round is released by a round change
+	later, err := other.SubmitConsensusVote(addrs[0], types.BytesToHash([]byte("block d")), 5, 1, consensus.VoteCommit, privs[0].Bytes())
+	if err != nil {
+		t.Fatalf("Failed to vote: %v", err)
+	}
+	if err := mvc.AddVote(later); err != nil {
+		t.Errorf("Expected a vote in a later round to be accepted: %v", err)
+	}
+	if err := mvc.VerifyEvidence(consensus.NewDuplicateVoteEvidence(first, later)); !errors.Is(err, consensus.ErrInvalidEvidence) {
+		t.Errorf("Expected votes in different rounds to be no evidence, got %v", err)
+	}
+
+	// Two blocks signed by the validator at the same height
+	headers := make([]*types.BlockHeader, 2)
+	for i := range headers {
+		headers[i] = types.NewBlockHeader(types.ZeroHash, addrs[1], types.ZeroHash, big.NewInt(7), 15000000, uint64(1000+i))
+		if err := headers[i].SignBlock(privs[1].Bytes(), crypto.SigAlgDilithium, addrs[1]); err != nil {
+			t.Fatalf("Failed to sign header: %v", err)
+		}
+	}
+	proposals := consensus.NewDuplicateProposalEvidence(headers[0], headers[1])
+	if err := mvc.VerifyEvidence(proposals); err != nil {
+		t.Errorf("Expected conflicting blocks to prove double signing: %v", err)
+	}
+	tampered := types.NewBlockHeader(types.ZeroHash, addrs[1], types.ZeroHash, big.NewInt(7), 15000000, 1002)
+	tampered.SignBlock(privs[1].Bytes(), crypto.SigAlgDilithium, addrs[1])
+	tampered.Time++
+	if err := mvc.VerifyEvidence(consensus.NewDuplicateProposalEvidence(headers[0], tampered)); !errors.Is(err, consensus.ErrInvalidEvidence) {
+		t.Errorf("Expected a header changed after signing to be no evidence, got %v", err)
+	}
+	incomplete := &consensus.Evidence{
+		Type:      consensus.EvidenceDuplicateProposal,
+		Validator: addrs[1],
+		Height:    7,
+		Headers:   []*types.BlockHeader{{Number: big.NewInt(7)}, {Number: big.NewInt(7)}},
+	}
+	if err := mvc.VerifyEvidence(incomplete); !errors.Is(err, consensus.ErrInvalidEvidence) {
+		t.Errorf("Expected headers without difficulty to be no evidence, got %v", err)
+	}
+
+	// The pool keeps one evidence per offence until a block includes it
+	pool := consensus.NewEvidencePool(mvc)
+	if added, err := pool.Add(evidence); !added || err != nil {
+		t.Fatalf("Expected evidence to be added, got %v (%v)", added, err)
+	}
+	if added, _ := pool.Add(consensus.NewDuplicateVoteEvidence(second, first)); added {
+		t.Error("Expected evidence of a known offence to be ignored")
+	}
+	if added, _ := pool.Add(proposals); !added {
+		t.Error("Expected evidence of another offence to be added")
+	}
+	if pending := pool.Pending(10); len(pending) != 2 || pending[0] != evidence {
+		t.Errorf("Expected 2 pending evidence ordered by height, got %d", len(pending))
+	}
+	pool.MarkCommitted(evidence.ID())
+	if added, _ := pool.Add(evidence); added || !pool.IsCommitted(evidence.ID()) || len(pool.Pending(10)) != 1 {
+		t.Error("Expected committed evidence to leave the pool for good")
+	}
+
+	// Punishment takes the double signing penalty and jails the validator
+	tokenomics := economics.NewTokenomicsEngine()
+	penalty := func(stake *big.Int) *big.Int {
+		return tokenomics.CalculateSlashingPenalty(stake, economics.SlashingDoubleSign, economics.SeverityNormal)
+	}
+	slashed, err := mvc.SlashStake(addrs[0], penalty, "double signing", time.Now())
+	if err != nil {
+		t.Fatalf("Failed to slash: %v", err)
+	}
+	if want := penalty(stake); slashed.Cmp(want) != 0 || slashed.Cmp(new(big.Int).Div(stake, big.NewInt(6))) < 0 {
+		t.Errorf("Expected the double signing penalty %s slashed, got %s", want, slashed)
+	}
+	validator, _ := mvc.GetValidator(addrs[0])
+	if validator.Status != consensus.StatusJailed || validator.TotalStake.Cmp(new(big.Int).Sub(stake, slashed)) != 0 {
+		t.Errorf("Expected the validator jailed with its stake reduced, got status %d and stake %s", validator.Status, validator.TotalStake)
+	}
+	for _, active := range mvc.GetValidatorSet() {
+		if active.Address == addrs[0] {
+			t.Error("Expected the jailed validator to leave the validator set")
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package integration
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/types"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// TestDynamicFees tests base fee burning, tips and the fee RPCs
+func TestDynamicFees(t *testing.T) {
+	testNode, url, privKey, sender := newRPCTestNode(t, 18651)
+	bc := testNode.GetBlockchain()
+
+	recipient := types.BytesToAddress([]byte("fee-recipient"))
+	coinbase := types.BytesToAddress([]byte("coinbase"))
+	tipCap, feeCap := big.NewInt(200000), big.NewInt(3000000)
+
+	tx := types.NewDynamicFeeTransaction(big.NewInt(8888), 0, &recipient, big.NewInt(7), 50000, tipCap, feeCap, nil)
+	if err := tx.SignTransaction(privKey.Bytes(), crypto.SigAlgDilithium); err != nil {
+		t.Fatalf("Failed to sign transaction: %v", err)
+	}
+
+	// Round trip through JSON keeps the fee caps and the hash
+	encoded, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatalf("Failed to marshal transaction: %v", err)
+	}
+	decoded, err := types.DecodeRLPTransaction(encoded)
+	if err != nil {
+		t.Fatalf("Failed to decode transaction: %v", err)
+	}
+	if !decoded.IsDynamicFee() || decoded.Hash() != tx.Hash() {
+		t.Fatalf("Dynamic fee transaction did not survive a JSON round trip")
+	}
+
+	senderBefore := bc.GetBalance(sender)
+	block := addBlock(t, bc, tx)
+	if block.BaseFee().Cmp(big.NewInt(types.InitialBaseFee)) != 0 {
+		t.Fatalf("Expected initial base fee %d, got %s", types.InitialBaseFee, block.BaseFee())
+	}
+
+	receipt, err := bc.GetTransactionReceipt(tx.Hash())
+	if err != nil {
+		t.Fatalf("Failed to get receipt: %v", err)
+	}
+	price := new(big.Int).Add(block.BaseFee(), tipCap)
+	if receipt.EffectiveGasPrice.Cmp(price) != 0 {
+		t.Errorf("Expected effective gas price %s, got %s", price, receipt.EffectiveGasPrice)
+	}
+
+	// The sender pays base fee and tip, only the tip reaches the coinbase
+	gasUsed := new(big.Int).SetUint64(receipt.GasUsed)
+	paid := new(big.Int).Sub(senderBefore, bc.GetBalance(sender))
+	if want := new(big.Int).Add(new(big.Int).Mul(gasUsed, price), big.NewInt(7)); paid.Cmp(want) != 0 {
+		t.Errorf("Expected sender to pay %s, paid %s", want, paid)
+	}
+	if want := new(big.Int).Mul(gasUsed, tipCap); bc.GetBalance(coinbase).Cmp(want) != 0 {
+		t.Errorf("Expected coinbase to receive %s, got %s", want, bc.GetBalance(coinbase))
+	}
+
+	// A fee cap below the base fee cannot be included
+	cheap := types.NewDynamicFeeTransaction(big.NewInt(8888), 1, &recipient, big.NewInt(1), 50000, big.NewInt(1), big.NewInt(types.MinBaseFee), nil)
+	if err := cheap.SignTransaction(privKey.Bytes(), crypto.SigAlgDilithium); err != nil {
+		t.Fatalf("Failed to sign transaction: %v", err)
+	}
+	parent := bc.GetCurrentBlock()
+	header := types.NewBlockHeader(parent.Hash(), coinbase, types.ZeroHash,
+		new(big.Int).Add(parent.Number(), big.NewInt(1)), types.DefaultBlockGasLimit, parent.Time()+1)
+	header.BaseFee = types.CalcBaseFee(parent.Header)
+	if err := bc.AddBlock(types.NewBlock(header, []*types.QuantumTransaction{cheap}, nil)); err == nil {
+		t.Error("Expected block with an underpriced transaction to be rejected")
+	}
+
+	// The tip may not exceed the fee cap
+	invalid := types.NewDynamicFeeTransaction(big.NewInt(8888), 1, &recipient, big.NewInt(1), 50000, feeCap, tipCap, nil)
+	if err := invalid.SignTransaction(privKey.Bytes(), crypto.SigAlgDilithium); err != nil {
+		t.Fatalf("Failed to sign transaction: %v", err)
+	}
+	if err := testNode.AddTransaction(invalid); err == nil {
+		t.Error("Expected transaction with tip above fee cap to be rejected")
+	}
+
+	result, rpcErr := rpcCall(t, url, "eth_feeHistory", "0x2", "latest", []float64{50})
+	if rpcErr != nil {
+		t.Fatalf("eth_feeHistory failed: %+v", rpcErr)
+	}
+	var history struct {
+		OldestBlock  hexutil.Big     `json:"oldestBlock"`
+		BaseFee      []hexutil.Big   `json:"baseFeePerGas"`
+		GasUsedRatio []float64       `json:"gasUsedRatio"`
+		Reward       [][]hexutil.Big `json:"reward"`
+	}
+	json.Unmarshal(result, &history)
+	if history.OldestBlock.ToInt().Sign() != 0 || len(history.BaseFee) != 3 || len(history.GasUsedRatio) != 2 {
+		t.Fatalf("Unexpected fee history: %s", result)
+	}
+	if next := types.CalcBaseFee(block.Header); history.BaseFee[2].ToInt().Cmp(next) != 0 {
+		t.Errorf("Expected next base fee %s, got %s", next, history.BaseFee[2].ToInt())
+	}
+	if len(history.Reward) != 2 || history.Reward[1][0].ToInt().Cmp(tipCap) != 0 {
+		t.Errorf("Expected reward of %s in the newest block, got %s", tipCap, result)
+	}
+
+	result, rpcErr = rpcCall(t, url, "eth_maxPriorityFeePerGas")
+	if rpcErr != nil || string(result) != `"0x30d40"` {
+		t.Errorf("Expected suggested tip 0x30d40, got %s (%+v)", result, rpcErr)
+	}
+}
@@ -0,0 +1,181 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"quantum-blockchain/chain/network"
+	"quantum-blockchain/chain/node"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestFrame tests encoding, compression and validation of binary frames
+func TestFrame(t *testing.T) {
+	payload := bytes.Repeat([]byte(`{"hash":"0x00000000000000000000000000000000","value":"0x1"},`), 100)
+	frame := &network.Frame{Version: network.ProtocolVersion, Type: 7, RequestID: 42, Payload: payload}
+
+	data, err := network.EncodeFrame(frame)
+	if err != nil {
+		t.Fatalf("Failed to encode frame: %v", err)
+	}
+	if len(data) >= len(payload)/4 {
+		t.Errorf("Expected a repetitive payload of %d bytes to compress, got %d", len(payload), len(data))
+	}
+
+	decoded, err := network.DecodeFrame(data)
+	if err != nil {
+		t.Fatalf("Failed to decode frame: %v", err)
+	}
+	if decoded.Version != frame.Version || decoded.Type != frame.Type || decoded.RequestID != frame.RequestID || !bytes.Equal(decoded.Payload, payload) {
+		t.Errorf("Frame did not round trip: %+v", decoded)
+	}
+
+	// Truncated frames and lengths not matching the data are rejected
+	if _, err := network.DecodeFrame(data[:len(data)-1]); !errors.Is(err, network.ErrInvalidFrame) {
+		t.Errorf("Expected a truncated frame to be rejected, got %v", err)
+	}
+	if _, err := network.DecodeFrame(data[:10]); !errors.Is(err, network.ErrInvalidFrame) {
+		t.Errorf("Expected a frame shorter than its header to be rejected, got %v", err)
+	}
+
+	// A payload claiming to decompress beyond the limit is not decompressed
+	bomb := make([]byte, 14, 32)
+	bomb = binary.AppendUvarint(bomb, network.MaxFramePayload+1)
+	bomb = append(bomb, 0x00)
+	binary.BigEndian.PutUint32(bomb[0:4], uint32(len(bomb)-4))
+	if _, err := network.DecodeFrame(bomb); !errors.Is(err, network.ErrInvalidFrame) {
+		t.Errorf("Expected an oversized payload to be rejected, got %v", err)
+	}
+
+	// Incompressible payloads of the largest size still fit a wire message
+	random := make([]byte, network.MaxFramePayload)
+	rand.Read(random)
+	data, err = network.EncodeFrame(&network.Frame{Version: network.ProtocolVersion, Payload: random})
+	if err != nil {
+		t.Fatalf("Failed to encode frame: %v", err)
+	}
+	if sealed := len(data) + 16; sealed > network.MaxWireMessageSize {
+		t.Errorf("Expected a sealed frame of %d bytes to fit the wire limit of %d", sealed, network.MaxWireMessageSize)
+	}
+
+	// Peers speak the highest version both support
+	for remote, expected := range map[uint32]uint32{0: 1, 1: 1, 2: 2, 9: network.ProtocolVersion} {
+		if version, err := network.NegotiateProtocolVersion(remote); err != nil || version != expected {
+			t.Errorf("Expected version %d with a version %d peer, got %d (%v)", expected, remote, version, err)
+		}
+	}
+}
+
+// TestProtocolNegotiation tests that a node speaks binary frames with
+// upgraded peers and JSON with peers on the old protocol version
+func TestProtocolNegotiation(t *testing.T) {
+	identity, err := network.GenerateNodeIdentity()
+	if err != nil {
+		t.Fatalf("Failed to generate identity: %v", err)
+	}
+	listener := node.NewP2PNetwork("127.0.0.1:0", nil, identity)
+	if err := listener.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start P2P network: %v", err)
+	}
+	defer listener.Stop()
+
+	// connect completes the handshake of a peer announcing the given version
+	connect := func(version uint32) *network.SecureConn {
+		t.Helper()
+		peerIdentity, err := network.GenerateNodeIdentity()
+		if err != nil {
+			t.Fatalf("Failed to generate identity: %v", err)
+		}
+		conn, _, err := websocket.DefaultDialer.Dial("ws://"+listener.ListenAddr(), nil)
+		if err != nil {
+			t.Fatalf("Failed to dial: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+
+		handshake, _ := json.Marshal(&node.HandshakeData{Version: version, NetworkID: 8888, NodeID: peerIdentity.ID()})
+		session, err := network.Handshake(conn, peerIdentity, true, handshake)
+		if err != nil {
+			t.Fatalf("Handshake failed: %v", err)
+		}
+		var remote node.HandshakeData
+		if err := json.Unmarshal(session.RemotePayload(), &remote); err != nil || remote.Version != network.ProtocolVersion {
+			t.Fatalf("Expected the node to announce version %d, got %+v (%v)", network.ProtocolVersion, remote, err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		return session
+	}
+
+	// A peer on the old version exchanges JSON messages
+	legacy := connect(1)
+	if err := legacy.WriteJSON(&node.P2PMessage{Type: node.MsgTypePing, Data: []byte("{}")}); err != nil {
+		t.Fatalf("Failed to send ping: %v", err)
+	}
+	// The node may query the peer for neighbors before answering
+	for {
+		var msg node.P2PMessage
+		if err := legacy.ReadJSON(&msg); err != nil {
+			t.Fatalf("Expected a JSON pong: %v", err)
+		}
+		if msg.Type == node.MsgTypePong {
+			break
+		}
+	}
+
+	// An upgraded peer exchanges frames
+	upgraded := connect(network.ProtocolVersion)
+	if _, err := upgraded.WriteMessageFrame(&network.Frame{Version: network.ProtocolVersion, Type: uint8(node.MsgTypePing), Payload: []byte("{}")}); err != nil {
+		t.Fatalf("Failed to send ping frame: %v", err)
+	}
+	for {
+		frame, _, err := upgraded.ReadMessageFrame()
+		if err != nil {
+			t.Fatalf("Expected a pong frame: %v", err)
+		}
+		if frame.Version != network.ProtocolVersion {
+			t.Fatalf("Expected a version %d frame, got %d", network.ProtocolVersion, frame.Version)
+		}
+		if frame.Type == uint8(node.MsgTypePong) {
+			break
+		}
+	}
+
+	protocols := make(map[uint32]int)
+	for _, peer := range listener.GetPeers() {
+		protocols[peer.Protocol]++
+	}
+	if protocols[1] != 1 || protocols[network.ProtocolVersion] != 1 {
+		t.Errorf("Expected one peer on each version, got %v", protocols)
+	}
+
+	// A frame of another version than the negotiated one breaks the session
+	if _, err := upgraded.WriteMessageFrame(&network.Frame{Version: 1, Type: uint8(node.MsgTypePing), Payload: []byte("{}")}); err != nil {
+		t.Fatalf("Failed to send frame: %v", err)
+	}
+	for {
+		if _, _, err := upgraded.ReadMessageFrame(); err != nil {
+			break
+		}
+	}
+	if len(listener.GetPeers()) != 1 {
+		t.Error("Expected the peer sending a frame of the wrong version to be dropped")
+	}
+
+	// Messages beyond the wire limit are refused before they are buffered
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+listener.ListenAddr(), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	conn.WriteMessage(websocket.BinaryMessage, make([]byte, network.MaxWireMessageSize+1))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Errorf("Expected the oversized message to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package integration
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"quantum-blockchain/chain/evm"
+	"quantum-blockchain/chain/node"
+	"quantum-blockchain/chain/types"
+)
+
+// TestIntrinsicGasAndSizeLimits tests that signature bytes are charged and
+// that transaction and block sizes are capped
+func TestIntrinsicGasAndSizeLimits(t *testing.T) {
+	bc, privKey, _ := newFundedBlockchain(t)
+	pool := node.NewTxPool(100)
+	recipient := types.BytesToAddress([]byte("recipient"))
+
+	// A flat 21000 gas no longer covers a post-quantum signature
+	underfunded := signedTx(t, privKey, 0, recipient, big.NewInt(1), 21000, nil)
+	intrinsic := evm.TransactionIntrinsicGas(underfunded)
+	if want := evm.TxBaseGas + 2*uint64(len(underfunded.Signature)+len(underfunded.PublicKey)) + evm.DilithiumVerifyGas; intrinsic != want {
+		t.Fatalf("Expected intrinsic gas %d, got %d", want, intrinsic)
+	}
+	if err := pool.ValidateTransaction(underfunded); err == nil || !strings.Contains(err.Error(), "intrinsic gas too low") {
+		t.Errorf("Expected intrinsic gas error, got %v", err)
+	}
+
+	oversized := signedTx(t, privKey, 0, recipient, big.NewInt(1), 1000000, make([]byte, types.MaxTransactionSize))
+	if err := pool.ValidateTransaction(oversized); err == nil || !strings.Contains(err.Error(), "transaction too large") {
+		t.Errorf("Expected size error, got %v", err)
+	}
+
+	// A transfer uses exactly its intrinsic gas
+	tx := signedTx(t, privKey, 0, recipient, big.NewInt(1), intrinsic, nil)
+	if err := pool.ValidateTransaction(tx); err != nil {
+		t.Fatalf("Expected transaction to be valid: %v", err)
+	}
+	addBlock(t, bc, tx)
+	receipt, err := bc.GetTransactionReceipt(tx.Hash())
+	if err != nil {
+		t.Fatalf("Failed to get receipt: %v", err)
+	}
+	if receipt.Status != 1 || receipt.GasUsed != intrinsic {
+		t.Errorf("Expected successful transfer using %d gas, got status %d using %d", intrinsic, receipt.Status, receipt.GasUsed)
+	}
+
+	// Blocks beyond the byte limit are rejected before execution
+	filler := signedTx(t, privKey, 1, recipient, big.NewInt(1), intrinsic, nil)
+	txs := make([]*types.QuantumTransaction, types.MaxBlockSize/filler.Size()+1)
+	for i := range txs {
+		txs[i] = filler
+	}
+	parent := bc.GetCurrentBlock()
+	header := types.NewBlockHeader(parent.Hash(), recipient, types.ZeroHash,
+		new(big.Int).Add(parent.Number(), big.NewInt(1)), types.DefaultBlockGasLimit, parent.Time()+1)
+	header.BaseFee = types.CalcBaseFee(parent.Header)
+	if err := bc.AddBlock(types.NewBlock(header, txs, nil)); err == nil || !strings.Contains(err.Error(), "block too large") {
+		t.Errorf("Expected oversized block to be rejected, got %v", err)
+	}
+}
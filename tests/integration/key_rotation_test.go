@@ -0,0 +1,124 @@
+package integration
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/evm"
+	"quantum-blockchain/chain/node"
+	"quantum-blockchain/chain/types"
+)
+
+// TestKeyRotation tests binding a new key to an existing address
+func TestKeyRotation(t *testing.T) {
+	testNode, url, oldKey, account := newRPCTestNode(t, 18653)
+	bc := testNode.GetBlockchain()
+	pool := node.NewTxPool(100)
+	pool.SetBalanceSource(bc.GetBalance)
+	pool.SetKeySource(bc.GetKeyBinding)
+	recipient := types.BytesToAddress([]byte("recipient"))
+
+	newKey, newPub, err := crypto.GenerateFalconKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+
+	// The rotation must carry a key of the right size
+	bad := types.NewKeyRotationTransaction(big.NewInt(8888), 0, crypto.SigAlgFalcon, []byte{0x01}, 400000, big.NewInt(1000000000))
+	if err := bad.SignTransaction(oldKey.Bytes(), crypto.SigAlgDilithium); err != nil {
+		t.Fatalf("Failed to sign transaction: %v", err)
+	}
+	if err := pool.ValidateTransaction(bad); err == nil {
+		t.Error("Expected malformed key rotation to be rejected")
+	}
+
+	rotation := types.NewKeyRotationTransaction(big.NewInt(8888), 0, crypto.SigAlgFalcon, newPub.Bytes(), 400000, big.NewInt(1000000000))
+	if err := rotation.SignTransaction(oldKey.Bytes(), crypto.SigAlgDilithium); err != nil {
+		t.Fatalf("Failed to sign transaction: %v", err)
+	}
+	if rotation.From() != account {
+		t.Fatalf("Expected rotation from %s, got %s", account.Hex(), rotation.From().Hex())
+	}
+	if err := pool.ValidateTransaction(rotation); err != nil {
+		t.Fatalf("Expected key rotation to be valid: %v", err)
+	}
+	addBlock(t, bc, rotation)
+
+	receipt, err := bc.GetTransactionReceipt(rotation.Hash())
+	if err != nil {
+		t.Fatalf("Failed to get receipt: %v", err)
+	}
+	want := evm.TransactionIntrinsicGas(rotation) + evm.KeyRotationGas + evm.KeyStorageByteGas*uint64(len(newPub.Bytes()))
+	if receipt.Status != 1 || receipt.GasUsed != want {
+		t.Fatalf("Expected successful rotation using %d gas, got status %d using %d", want, receipt.Status, receipt.GasUsed)
+	}
+	binding := bc.GetKeyBinding(account)
+	if binding == nil || binding.Algorithm != crypto.SigAlgFalcon || binding.BlockNumber != 1 {
+		t.Fatalf("Expected Falcon key bound in block 1, got %+v", binding)
+	}
+
+	// The old key no longer signs for the account
+	stale := signedTx(t, oldKey, 1, recipient, big.NewInt(1000), 100000, nil)
+	if err := pool.ValidateTransaction(stale); !errors.Is(err, evm.ErrKeyNotBound) {
+		t.Errorf("Expected old key to be rejected by the pool, got %v", err)
+	}
+	parent := bc.GetCurrentBlock()
+	header := types.NewBlockHeader(parent.Hash(), types.BytesToAddress([]byte("coinbase")), types.ZeroHash,
+		new(big.Int).Add(parent.Number(), big.NewInt(1)), types.DefaultBlockGasLimit, parent.Time()+1)
+	header.BaseFee = types.CalcBaseFee(parent.Header)
+	if err := bc.AddBlock(types.NewBlock(header, []*types.QuantumTransaction{stale}, nil)); !errors.Is(err, evm.ErrKeyNotBound) {
+		t.Errorf("Expected block with old key to be rejected, got %v", err)
+	}
+
+	// A stranger can not claim the account by naming it as sender
+	strangerKey, _, _ := crypto.GenerateDilithiumKeyPair()
+	claim := types.NewQuantumTransaction(big.NewInt(8888), 1, &recipient, big.NewInt(1000), 100000, big.NewInt(1000000000), nil)
+	claim.SetSender(account)
+	if err := claim.SignTransaction(strangerKey.Bytes(), crypto.SigAlgDilithium); err != nil {
+		t.Fatalf("Failed to sign transaction: %v", err)
+	}
+	if err := pool.ValidateTransaction(claim); !errors.Is(err, evm.ErrKeyNotBound) {
+		t.Errorf("Expected stranger key to be rejected, got %v", err)
+	}
+
+	// The new key signs for the account once it names it as sender
+	tx := types.NewQuantumTransaction(big.NewInt(8888), 1, &recipient, big.NewInt(1000), 100000, big.NewInt(1000000000), nil)
+	tx.SetSender(account)
+	if err := tx.SignTransaction(newKey.Bytes(), crypto.SigAlgFalcon); err != nil {
+		t.Fatalf("Failed to sign transaction: %v", err)
+	}
+	if err := pool.ValidateTransaction(tx); err != nil {
+		t.Fatalf("Expected new key to be valid: %v", err)
+	}
+	addBlock(t, bc, tx)
+	if bc.GetBalance(recipient).Int64() != 1000 || bc.GetNonce(account) != 2 {
+		t.Errorf("Expected recipient balance 1000 and account nonce 2, got %s and %d", bc.GetBalance(recipient), bc.GetNonce(account))
+	}
+
+	// The history is queryable over RPC
+	result, rpcErr := rpcCall(t, url, "quantum_getKeyHistory", account.Hex(), "latest")
+	if rpcErr != nil {
+		t.Fatalf("quantum_getKeyHistory failed: %+v", rpcErr)
+	}
+	var history node.KeyHistoryResult
+	if err := json.Unmarshal(result, &history); err != nil {
+		t.Fatalf("Failed to decode key history: %v", err)
+	}
+	if len(history.History) != 1 || history.Current == nil || history.Current.Algorithm != crypto.SigAlgFalcon.String() {
+		t.Errorf("Expected one Falcon key in the history, got %+v", history)
+	}
+
+	result, rpcErr = rpcCall(t, url, "quantum_getKeyHistory", account.Hex(), "0x0")
+	if rpcErr != nil {
+		t.Fatalf("quantum_getKeyHistory failed: %+v", rpcErr)
+	}
+	if err := json.Unmarshal(result, &history); err != nil {
+		t.Fatalf("Failed to decode key history: %v", err)
+	}
+	if len(history.History) != 0 || history.Current != nil {
+		t.Errorf("Expected no rotations at genesis, got %+v", history)
+	}
+}
@@ -0,0 +1,311 @@
+package integration
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"quantum-blockchain/chain/consensus"
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/node"
+	"quantum-blockchain/chain/types"
+	lightClient "quantum-blockchain/clients/light-client"
+	walletSDK "quantum-blockchain/clients/wallet-sdk"
+)
+
+// TestAccountProofs tests that proofs show the accounts of a state and the
+// addresses missing from it, and that proofs of another state fail
+func TestAccountProofs(t *testing.T) {
+	for size := 1; size <= 9; size++ {
+		accounts := make([]*types.StateAccount, size)
+		for i := range accounts {
+			accounts[i] = &types.StateAccount{
+				Address: types.BytesToAddress([]byte{byte(2*i + 2)}),
+				Balance: big.NewInt(int64(1000 + i)),
+				Nonce:   uint64(i),
+			}
+		}
+		root := types.CalculateStateRoot(accounts)
+
+		for i, account := range accounts {
+			proven, err := types.NewAccountProof(accounts, account.Address).Verify(root)
+			if err != nil || proven.Balance.Cmp(account.Balance) != 0 {
+				t.Fatalf("Expected account %d of %d to be proven, got %v", i, size, err)
+			}
+
+			// Addresses next to the account are missing from the state
+			for _, missing := range []byte{byte(2*i + 1), byte(2*i + 3)} {
+				proven, err := types.NewAccountProof(accounts, types.BytesToAddress([]byte{missing})).Verify(root)
+				if err != nil || proven.Balance.Sign() != 0 {
+					t.Fatalf("Expected address %d to be proven missing from %d accounts, got %v", missing, size, err)
+				}
+			}
+		}
+
+		// Leaving an account out does not prove it missing
+		without := append(append([]*types.StateAccount{}, accounts[:size/2]...), accounts[size/2+1:]...)
+		if _, err := types.NewAccountProof(without, accounts[size/2].Address).Verify(root); !errors.Is(err, types.ErrInvalidProof) {
+			t.Errorf("Expected a proof leaving out an account of %d to fail, got %v", size, err)
+		}
+
+		// A changed balance does not match the root
+		proof := types.NewAccountProof(accounts, accounts[0].Address)
+		proof.Account.Balance = big.NewInt(1)
+		if _, err := proof.Verify(root); !errors.Is(err, types.ErrInvalidProof) {
+			t.Errorf("Expected a proof of a changed balance of %d to fail, got %v", size, err)
+		}
+	}
+
+	if proven, err := types.NewAccountProof(nil, types.BytesToAddress([]byte{1})).Verify(types.ZeroHash); err != nil || proven.Balance.Sign() != 0 {
+		t.Errorf("Expected any account to be missing from an empty state, got %v", err)
+	}
+}
+
+// TestStateTree tests that updating the state and storage trees gives the
+// roots of building them from scratch and leaves the trees before unchanged
+func TestStateTree(t *testing.T) {
+	accounts := make([]*types.StateAccount, 5)
+	tree := types.NewStateTree()
+	for i := range accounts {
+		accounts[i] = &types.StateAccount{Address: types.BytesToAddress([]byte{byte(i + 1)}), Balance: big.NewInt(int64(100 * (i + 1)))}
+		tree = tree.Update(accounts[i])
+	}
+	root := tree.Root()
+	if root != types.CalculateStateRoot(accounts) {
+		t.Fatal("Expected the updated tree to have the root of the accounts")
+	}
+
+	// A changed account gives a new tree, the one before keeps its root
+	changed := &types.StateAccount{Address: accounts[2].Address, Balance: big.NewInt(7), Nonce: 1}
+	next := tree.Update(changed)
+	if tree.Root() != root || next.Root() == root {
+		t.Fatal("Expected an update to leave the tree before unchanged")
+	}
+	if proven, err := tree.Prove(changed.Address).Verify(root); err != nil || proven.Balance.Cmp(accounts[2].Balance) != 0 {
+		t.Errorf("Expected the tree before to prove the account before, got %v", err)
+	}
+	if proven, err := next.Prove(changed.Address).Verify(next.Root()); err != nil || proven.Nonce != 1 {
+		t.Errorf("Expected the new tree to prove the changed account, got %v", err)
+	}
+
+	// An account emptied leaves the tree
+	emptied := next.Update(&types.StateAccount{Address: changed.Address, Balance: new(big.Int)})
+	without := append(append([]*types.StateAccount{}, accounts[:2]...), accounts[3:]...)
+	if emptied.Root() != types.CalculateStateRoot(without) {
+		t.Error("Expected an emptied account to leave the tree")
+	}
+	if proven, err := emptied.Prove(changed.Address).Verify(emptied.Root()); err != nil || proven.Balance.Sign() != 0 {
+		t.Errorf("Expected an emptied account to be proven missing, got %v", err)
+	}
+
+	// Storage slots set to zero leave the storage tree
+	slots := map[types.Hash]types.Hash{}
+	storage := types.NewStorageTree()
+	for i := 1; i <= 4; i++ {
+		slot, value := types.BytesToHash([]byte{byte(i)}), types.BytesToHash([]byte{byte(10 * i)})
+		slots[slot] = value
+		storage = storage.Update(slot, value)
+	}
+	storage = storage.Update(types.BytesToHash([]byte{2}), types.ZeroHash)
+	delete(slots, types.BytesToHash([]byte{2}))
+	if storage.Root() != types.CalculateStorageRoot(slots) {
+		t.Error("Expected the updated storage tree to have the root of the slots")
+	}
+	for slot := range slots {
+		storage = storage.Update(slot, types.ZeroHash)
+	}
+	if !storage.Root().IsZero() {
+		t.Error("Expected a storage tree without slots to have a zero root")
+	}
+}
+
+// tamperedProvider serves what the node serves, changed by the set functions
+type tamperedProvider struct {
+	*walletSDK.Client
+	header func(*types.BlockHeader)
+	commit func(number uint64, commit []*types.CommitSig) []*types.CommitSig
+	set    func(*consensus.EpochValidatorSet)
+	proof  func(*types.AccountProof)
+}
+
+func (p *tamperedProvider) GetLightBlock(blockNumber *big.Int) (*types.BlockHeader, []*types.CommitSig, error) {
+	header, commit, err := p.Client.GetLightBlock(blockNumber)
+	if err == nil && p.header != nil && blockNumber.Sign() > 0 {
+		p.header(header)
+	}
+	if err == nil && p.commit != nil {
+		commit = p.commit(blockNumber.Uint64(), commit)
+	}
+	return header, commit, err
+}
+
+func (p *tamperedProvider) GetValidatorSet(epoch uint64) (*consensus.EpochValidatorSet, error) {
+	set, err := p.Client.GetValidatorSet(epoch)
+	if err == nil && p.set != nil && epoch > 0 {
+		p.set(set)
+	}
+	return set, err
+}
+
+func (p *tamperedProvider) GetAccountProof(address types.Address, blockNumber *big.Int) (*types.AccountProof, error) {
+	proof, err := p.Client.GetAccountProof(address, blockNumber)
+	if err == nil && p.proof != nil {
+		p.proof(proof)
+	}
+	return proof, err
+}
+
+// TestLightClient tests that a light client starting from genesis follows a
+// validator set change to the head and verifies balances, and that headers,
+// validator sets and proofs changed by the node are refused
+func TestLightClient(t *testing.T) {
+	priv, pub, err := crypto.GenerateDilithiumKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	sender := types.PublicKeyToAddress(pub.Bytes())
+	funds, _ := new(big.Int).SetString("1000000000000000000000", 10)
+
+	sim := newSimulator(t, &node.SimulationConfig{
+		Validators:         4,
+		Seed:               5,
+		Latency:            20 * time.Millisecond,
+		Jitter:             100 * time.Millisecond,
+		Accounts:           map[types.Address]*big.Int{sender: funds},
+		SignedBlocksWindow: 10,
+		MinSignedRatio:     0.5,
+		DowntimeJail:       time.Minute,
+		EpochBlocks:        5,
+	})
+	recipient := types.BytesToAddress([]byte("light-recipient"))
+	tx := types.NewQuantumTransaction(big.NewInt(8888), 0, &recipient, big.NewInt(1000), 50000, big.NewInt(1000000000), nil)
+	if err := tx.SignTransaction(priv.Bytes(), crypto.SigAlgDilithium); err != nil {
+		t.Fatalf("Failed to sign transaction: %v", err)
+	}
+	if err := sim.SubmitTransaction(tx); err != nil {
+		t.Fatalf("Failed to submit transaction: %v", err)
+	}
+
+	// A slow validator is jailed and leaves the set at the next epoch
+	sim.SetNodeLatency(3, 3*time.Second)
+	if !sim.RunUntil(5*time.Minute, func() bool { return setSize(sim) == 3 }) {
+		t.Fatalf("Expected the slow validator to leave the set, lowest at #%d", minHeight(sim))
+	}
+	head := minHeight(sim) + 3
+	if !sim.RunUntil(time.Minute, func() bool { return minHeight(sim) >= head }) {
+		t.Fatalf("Expected progress after the set changed, lowest at #%d", minHeight(sim))
+	}
+	checkInvariants(t, sim)
+
+	full := sim.Nodes()[0]
+	server := node.NewRPCServer(full.Node, 18661, 0)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start RPC server: %v", err)
+	}
+	t.Cleanup(server.Stop)
+	time.Sleep(200 * time.Millisecond)
+	rpc := walletSDK.NewClient("http://localhost:18661")
+
+	genesis, err := full.GetBlockchain().GetBlockByNumber(big.NewInt(0))
+	if err != nil {
+		t.Fatalf("Failed to get genesis: %v", err)
+	}
+	genesisSet, _ := full.GetMultiConsensus().GetEpochValidatorSet(0)
+	checkpoint := &lightClient.Checkpoint{
+		Number:         0,
+		Hash:           genesis.Hash(),
+		ValidatorsHash: genesisSet.Hash(),
+		EpochBlocks:    5,
+	}
+
+	light, err := lightClient.NewClient(rpc, checkpoint)
+	if err != nil {
+		t.Fatalf("Failed to start light client: %v", err)
+	}
+	if _, err := light.GetBalance(sender); err == nil {
+		t.Error("Expected no balance before the light client verified a block after genesis")
+	}
+	header, err := light.Sync()
+	if err != nil {
+		t.Fatalf("Failed to sync light client: %v", err)
+	}
+
+	number := header.Number.Uint64()
+	block, _ := full.GetBlockchain().GetBlockByNumber(header.Number)
+	if number+1 < full.GetBlockchain().GetCurrentBlock().Number().Uint64() || block.Hash() != header.Hash() {
+		t.Fatalf("Expected the light client to verify block #%d of the head, got #%d", full.GetBlockchain().GetCurrentBlock().Number(), number)
+	}
+	set, _ := full.GetMultiConsensus().GetEpochValidatorSet(full.GetMultiConsensus().EpochOf(number))
+	if len(light.ValidatorSet().Validators) != 3 || light.ValidatorSet().Hash() != set.Hash() {
+		t.Errorf("Expected the light client to follow the set of 3 validators, got %d", len(light.ValidatorSet().Validators))
+	}
+
+	// Balances are those the full node had after the block before the header
+	state, err := full.GetBlockchain().StateAt(number - 1)
+	if err != nil {
+		t.Fatalf("Failed to get state: %v", err)
+	}
+	defer state.Release()
+	for _, addr := range []types.Address{sender, recipient, full.GetValidatorAddress(), types.BytesToAddress([]byte("nobody"))} {
+		balance, err := light.GetBalance(addr)
+		if err != nil {
+			t.Fatalf("Failed to verify balance of %s: %v", addr.Hex(), err)
+		}
+		if balance.Cmp(state.GetBalance(addr)) != 0 {
+			t.Errorf("Expected verified balance %s of %s, got %s", state.GetBalance(addr), addr.Hex(), balance)
+		}
+	}
+	if balance, _ := light.GetBalance(recipient); balance.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("Expected the transfer to be proven, recipient holds %s", balance)
+	}
+
+	// A checkpoint of the verified header starts a client there
+	if resumed, err := lightClient.NewClient(rpc, light.Checkpoint()); err != nil || resumed.Header().Hash() != header.Hash() {
+		t.Errorf("Expected a client to resume from the checkpoint: %v", err)
+	}
+
+	// Whatever the node changes is refused
+	tampered := []struct {
+		name     string
+		provider *tamperedProvider
+		want     error
+	}{
+		{"state root", &tamperedProvider{Client: rpc, header: func(h *types.BlockHeader) { h.Root = types.Hash{1} }}, lightClient.ErrInvalidHeader},
+		{"difficulty", &tamperedProvider{Client: rpc, header: func(h *types.BlockHeader) { h.Difficulty = nil }}, lightClient.ErrInvalidHeader},
+		{"validator set", &tamperedProvider{Client: rpc, set: func(s *consensus.EpochValidatorSet) { s.Validators[0].VotingPower.SetUint64(1) }}, lightClient.ErrUntrustedValidatorSet},
+	}
+	for _, tc := range tampered {
+		client, err := lightClient.NewClient(tc.provider, checkpoint)
+		if err != nil {
+			t.Fatalf("Failed to start light client: %v", err)
+		}
+		if _, err := client.Sync(); !errors.Is(err, tc.want) {
+			t.Errorf("Expected a changed %s to be refused with %v, got %v", tc.name, tc.want, err)
+		}
+	}
+
+	// Without a quorum of votes for the first block of an epoch a later block
+	// of the epoch vouches for it
+	partial := &tamperedProvider{Client: rpc, commit: func(number uint64, commit []*types.CommitSig) []*types.CommitSig {
+		if number%5 == 0 && len(commit) > 1 {
+			return commit[:1]
+		}
+		return commit
+	}}
+	client, err := lightClient.NewClient(partial, checkpoint)
+	if err != nil {
+		t.Fatalf("Failed to start light client: %v", err)
+	}
+	if synced, err := client.Sync(); err != nil || synced.Number.Uint64() < number-1 {
+		t.Errorf("Expected a light client to sync past epoch starts without a quorum, got %v", err)
+	} else if client.ValidatorSet().Hash() != light.ValidatorSet().Hash() {
+		t.Error("Expected the light client to follow the validator set past epoch starts without a quorum")
+	}
+
+	forged := &tamperedProvider{Client: rpc, proof: func(p *types.AccountProof) { p.Account.Balance.SetUint64(1) }}
+	client, _ = lightClient.NewClient(forged, light.Checkpoint())
+	if _, err := client.GetBalance(sender); !errors.Is(err, types.ErrInvalidProof) {
+		t.Errorf("Expected a changed balance to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package integration
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"quantum-blockchain/chain/consensus"
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/economics"
+	"quantum-blockchain/chain/types"
+)
+
+// TestLiveness tests that blocks carry verifiable commit votes for their
+// parent, that a validator signing too few blocks of a full window is
+// slashed and jailed, and that it can only unjail after its jail term
+func TestLiveness(t *testing.T) {
+	mvc := consensus.NewMultiValidatorConsensus(big.NewInt(8888))
+	stake, _ := new(big.Int).SetString("200000000000000000000000", 10)
+	if err := mvc.SetLivenessParams(10, 0.5, time.Minute); err != nil {
+		t.Fatalf("Failed to set liveness params: %v", err)
+	}
+
+	privs := make([]*crypto.DilithiumPrivateKey, 4)
+	addrs := make([]types.Address, 4)
+	for i := range privs {
+		priv, pub, err := crypto.GenerateDilithiumKeyPair()
+		if err != nil {
+			t.Fatalf("Failed to generate key: %v", err)
+		}
+		privs[i], addrs[i] = priv, types.PublicKeyToAddress(pub.Bytes())
+		if err := mvc.RegisterValidator(addrs[i], pub.Bytes(), stake, crypto.SigAlgDilithium, 0.05); err != nil {
+			t.Fatalf("Failed to register validator: %v", err)
+		}
+	}
+
+	// The commit votes for a block are carried by the next block
+	parent := types.BytesToHash([]byte("parent"))
+	for i := 0; i < 3; i++ {
+		if _, err := mvc.SubmitConsensusVote(addrs[i], parent, 4, 0, consensus.VoteCommit, privs[i].Bytes()); err != nil {
+			t.Fatalf("Failed to vote: %v", err)
+		}
+	}
+	commit := mvc.CommitSigs(4, 0, parent)
+	if len(commit) != 3 {
+		t.Fatalf("Expected 3 commit votes, got %d", len(commit))
+	}
+	signers, err := mvc.VerifyCommit(4, parent, commit)
+	if err != nil || len(signers) != 3 {
+		t.Fatalf("Expected the commit votes to verify, got %d signers (%v)", len(signers), err)
+	}
+	if _, err := mvc.VerifyCommit(4, types.BytesToHash([]byte("other")), commit); !errors.Is(err, consensus.ErrInvalidVote) {
+		t.Errorf("Expected commit votes for another block to fail, got %v", err)
+	}
+	if _, err := mvc.VerifyCommit(4, parent, []*types.CommitSig{commit[1], commit[0]}); !errors.Is(err, consensus.ErrInvalidVote) {
+		t.Errorf("Expected unordered commit votes to fail, got %v", err)
+	}
+
+	block := types.NewBlock(types.NewBlockHeader(parent, addrs[0], types.ZeroHash, big.NewInt(5), 15000000, 1000), nil, nil)
+	hash := block.Hash()
+	block.SetLastCommit(commit)
+	if block.Hash() == hash || block.ValidateLastCommitHash() != nil {
+		t.Error("Expected the header to commit to the votes for the parent")
+	}
+	block.LastCommit = commit[:2]
+	if block.ValidateLastCommitHash() == nil {
+		t.Error("Expected a block dropping a commit vote to fail")
+	}
+
+	// Blocks without a quorum of commit votes are not counted
+	penalty := func(stake *big.Int) *big.Int {
+		return economics.NewTokenomicsEngine().CalculateSlashingPenalty(stake, economics.SlashingDowntime, economics.SeverityNormal)
+	}
+	start := time.Unix(1700000000, 0)
+	mvc.RecordCommit(addrs[:2], penalty, start)
+	if missed, counted := mvc.SigningInfo(addrs[3]); missed != 0 || counted != 0 {
+		t.Errorf("Expected a block without quorum not to count, got %d of %d missed", missed, counted)
+	}
+
+	// Missing every block is only punished once the window is full
+	for i := 0; i < 9; i++ {
+		if slashed := mvc.RecordCommit(addrs[:3], penalty, start); slashed != nil {
+			t.Fatalf("Expected no jailing before the window is full, block %d", i)
+		}
+	}
+	if missed, counted := mvc.SigningInfo(addrs[3]); missed != 9 || counted != 9 {
+		t.Errorf("Expected 9 of 9 blocks missed, got %d of %d", missed, counted)
+	}
+	slashed := mvc.RecordCommit(addrs[:3], penalty, start)
+	if want := penalty(stake); len(slashed) != 1 || slashed[addrs[3]] == nil || slashed[addrs[3]].Cmp(want) != 0 {
+		t.Fatalf("Expected the downtime penalty %s slashed from the offline validator, got %v", want, slashed)
+	}
+	validator, _ := mvc.GetValidator(addrs[3])
+	if validator.Status != consensus.StatusJailed || !validator.JailedUntil.Equal(start.Add(time.Minute)) {
+		t.Errorf("Expected the validator jailed until %s, got status %d until %s", start.Add(time.Minute), validator.Status, validator.JailedUntil)
+	}
+	if len(mvc.GetValidatorSet()) != 3 {
+		t.Errorf("Expected 3 validators left, got %d", len(mvc.GetValidatorSet()))
+	}
+
+	// Unjailing needs the jail term to be over
+	if err := mvc.Unjail(addrs[3], start.Add(30*time.Second)); err == nil {
+		t.Error("Expected unjailing during the jail term to fail")
+	}
+	if err := mvc.Unjail(addrs[0], start.Add(time.Minute)); err == nil {
+		t.Error("Expected unjailing a validator that is not jailed to fail")
+	}
+	if err := mvc.Unjail(addrs[3], start.Add(time.Minute)); err != nil {
+		t.Fatalf("Expected unjailing after the jail term to succeed: %v", err)
+	}
+	if validator, _ := mvc.GetValidator(addrs[3]); validator.Status != consensus.StatusActive || len(mvc.GetValidatorSet()) != 4 {
+		t.Error("Expected the validator back in the validator set")
+	}
+
+	// A validator signing half of the window stays
+	for i := 0; i < 10; i++ {
+		signers := addrs
+		if i%2 == 0 {
+			signers = addrs[1:]
+		}
+		if slashed := mvc.RecordCommit(signers, penalty, start.Add(time.Minute)); slashed != nil {
+			t.Fatalf("Expected no jailing, got %v", slashed)
+		}
+	}
+	if missed, counted := mvc.SigningInfo(addrs[0]); missed != 5 || counted != 10 {
+		t.Errorf("Expected 5 of 10 blocks missed, got %d of %d", missed, counted)
+	}
+	if missed, counted := mvc.SigningInfo(addrs[3]); missed != 0 || counted != 10 {
+		t.Errorf("Expected the unjailed validator to start a new window, got %d of %d missed", missed, counted)
+	}
+
+	// Unjail transactions carry nothing but their type
+	tx := types.NewUnjailTransaction(big.NewInt(8888), 0, 50000, big.NewInt(1000000000))
+	if !tx.IsUnjail() || tx.IsContractCreation() || tx.ValidateUnjail() != nil {
+		t.Error("Expected a well formed unjail transaction")
+	}
+	tx.Data = []byte{1}
+	if tx.ValidateUnjail() == nil {
+		t.Error("Expected an unjail transaction carrying data to fail")
+	}
+}
@@ -0,0 +1,221 @@
+package integration
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/evm"
+	"quantum-blockchain/chain/node"
+	"quantum-blockchain/chain/types"
+)
+
+// TestMultisigTransactions tests M-of-N accounts with keys of mixed algorithms
+func TestMultisigTransactions(t *testing.T) {
+	bc, funderKey, _ := newFundedBlockchain(t)
+	pool := node.NewTxPool(100)
+	pool.SetBalanceSource(bc.GetBalance)
+	recipient := types.BytesToAddress([]byte("recipient"))
+
+	alice, alicePub, _ := crypto.GenerateDilithiumKeyPair()
+	_, bobPub, _ := crypto.GenerateDilithiumKeyPair()
+	carol, carolPub, err := crypto.GenerateFalconKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+	keys := []*types.MultisigKey{
+		{Algorithm: crypto.SigAlgDilithium, PublicKey: alicePub.Bytes()},
+		{Algorithm: crypto.SigAlgDilithium, PublicKey: bobPub.Bytes()},
+		{Algorithm: crypto.SigAlgFalcon, PublicKey: carolPub.Bytes()},
+	}
+
+	policy, err := types.NewMultisigPolicy(2, keys)
+	if err != nil {
+		t.Fatalf("Failed to create policy: %v", err)
+	}
+	reordered, _ := types.NewMultisigPolicy(2, []*types.MultisigKey{keys[2], keys[0], keys[1]})
+	if reordered.Address() != policy.Address() {
+		t.Errorf("Expected key order not to change the address")
+	}
+	if _, err := types.NewMultisigPolicy(4, keys); err == nil {
+		t.Error("Expected threshold above the key count to be rejected")
+	}
+	if _, err := types.NewMultisigPolicy(1, []*types.MultisigKey{keys[0], keys[0]}); err == nil {
+		t.Error("Expected duplicate keys to be rejected")
+	}
+
+	account := policy.Address()
+	addBlock(t, bc, signedTx(t, funderKey, 0, account, big.NewInt(1000000000000000000), 50000, nil))
+
+	tx := types.NewQuantumTransaction(big.NewInt(8888), 0, &recipient, big.NewInt(1000), 200000, big.NewInt(1000000000), nil)
+	tx.SetMultisig(policy)
+	if tx.From() != account {
+		t.Fatalf("Expected sender %s, got %s", account.Hex(), tx.From().Hex())
+	}
+
+	// Signatures are collected one by one, outsiders can not sign
+	if _, err := tx.SignMultisig(funderKey.Bytes(), crypto.SigAlgDilithium); !errors.Is(err, types.ErrNotMultisigSigner) {
+		t.Errorf("Expected outsider to be rejected, got %v", err)
+	}
+	aliceSig, err := tx.SignMultisig(alice.Bytes(), crypto.SigAlgDilithium)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	if err := tx.AddMultisigSignature(aliceSig); err != nil {
+		t.Fatalf("Failed to add signature: %v", err)
+	}
+	if err := tx.AddMultisigSignature(aliceSig); err != nil {
+		t.Fatalf("Failed to add repeated signature: %v", err)
+	}
+	if err := pool.ValidateTransaction(tx); !errors.Is(err, types.ErrMultisigThreshold) {
+		t.Errorf("Expected threshold error with one signature, got %v", err)
+	}
+
+	carolSig, err := tx.SignMultisig(carol.Bytes(), crypto.SigAlgFalcon)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	if err := tx.AddMultisigSignature(carolSig); err != nil {
+		t.Fatalf("Failed to add signature: %v", err)
+	}
+	if len(tx.MultisigSignatures) != 2 {
+		t.Fatalf("Expected 2 signatures, got %d", len(tx.MultisigSignatures))
+	}
+	if err := pool.ValidateTransaction(tx); err != nil {
+		t.Fatalf("Expected multisig transaction to be valid: %v", err)
+	}
+
+	// The policy and signatures survive encoding
+	encoded, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatalf("Failed to encode transaction: %v", err)
+	}
+	decoded, err := types.DecodeRLPTransaction(encoded)
+	if err != nil {
+		t.Fatalf("Failed to decode transaction: %v", err)
+	}
+	if decoded.Hash() != tx.Hash() || decoded.From() != account {
+		t.Fatalf("Decoded transaction differs: hash %s, from %s", decoded.Hash().Hex(), decoded.From().Hex())
+	}
+	if valid, err := decoded.VerifySignature(); !valid || err != nil {
+		t.Fatalf("Expected decoded signatures to verify, got %v, %v", valid, err)
+	}
+	decoded.Value = big.NewInt(2000)
+	if valid, _ := decoded.VerifySignature(); valid {
+		t.Error("Expected modified transaction to be rejected")
+	}
+
+	// Missing keys and signatures and thresholds the keys can't meet are refused
+	malformed := map[string]func(fields map[string]interface{}){
+		"missing key": func(fields map[string]interface{}) {
+			fields["multisig"].(map[string]interface{})["keys"] = []interface{}{nil}
+		},
+		"missing signature": func(fields map[string]interface{}) {
+			fields["multisigSignatures"] = []interface{}{nil}
+		},
+		"zero threshold": func(fields map[string]interface{}) {
+			fields["multisig"].(map[string]interface{})["threshold"] = 0
+		},
+		"threshold above keys": func(fields map[string]interface{}) {
+			fields["multisig"].(map[string]interface{})["threshold"] = 4
+		},
+		"signer outside the keys": func(fields map[string]interface{}) {
+			fields["multisigSignatures"].([]interface{})[0].(map[string]interface{})["keyIndex"] = 3
+		},
+	}
+	for name, change := range malformed {
+		var fields map[string]interface{}
+		if err := json.Unmarshal(encoded, &fields); err != nil {
+			t.Fatalf("Failed to parse transaction: %v", err)
+		}
+		change(fields)
+		data, _ := json.Marshal(fields)
+		if _, err := types.DecodeRLPTransaction(data); err == nil {
+			t.Errorf("Expected a transaction with a %s to be refused", name)
+		}
+	}
+
+	addBlock(t, bc, tx)
+
+	receipt, err := bc.GetTransactionReceipt(tx.Hash())
+	if err != nil {
+		t.Fatalf("Failed to get receipt: %v", err)
+	}
+	if want := evm.TransactionIntrinsicGas(tx); receipt.Status != 1 || receipt.GasUsed != want {
+		t.Errorf("Expected successful transaction using %d gas, got status %d using %d", want, receipt.Status, receipt.GasUsed)
+	}
+	if bc.GetBalance(recipient).Int64() != 1000 || bc.GetNonce(account) != 1 {
+		t.Errorf("Expected recipient balance 1000 and account nonce 1, got %s and %d", bc.GetBalance(recipient), bc.GetNonce(account))
+	}
+}
+
+// TestMultisigLargestPolicy tests that a policy of the most and largest keys,
+// signed by all of them, fits in a transaction
+func TestMultisigLargestPolicy(t *testing.T) {
+	bc, funderKey, _ := newFundedBlockchain(t)
+	pool := node.NewTxPool(100)
+	pool.SetBalanceSource(bc.GetBalance)
+	recipient := types.BytesToAddress([]byte("recipient"))
+
+	privateKeys := make([][]byte, types.MaxMultisigKeys+1)
+	keys := make([]*types.MultisigKey, types.MaxMultisigKeys+1)
+	for i := range keys {
+		priv, pub, err := crypto.GenerateFalconKeyPair()
+		if err != nil {
+			t.Fatalf("Failed to generate key: %v", err)
+		}
+		privateKeys[i] = priv.Bytes()
+		keys[i] = &types.MultisigKey{Algorithm: crypto.SigAlgFalcon, PublicKey: pub.Bytes()}
+	}
+	if _, err := types.NewMultisigPolicy(1, keys); err == nil {
+		t.Errorf("Expected a policy of %d keys to be rejected", len(keys))
+	}
+
+	policy, err := types.NewMultisigPolicy(types.MaxMultisigKeys, keys[:types.MaxMultisigKeys])
+	if err != nil {
+		t.Fatalf("Failed to create policy: %v", err)
+	}
+	account := policy.Address()
+	addBlock(t, bc, signedTx(t, funderKey, 0, account, big.NewInt(1000000000000000000), 50000, nil))
+
+	tx := types.NewQuantumTransaction(big.NewInt(8888), 0, &recipient, big.NewInt(1000), 500000, big.NewInt(1000000000), nil)
+	tx.SetMultisig(policy)
+	for _, priv := range privateKeys[:types.MaxMultisigKeys] {
+		sig, err := tx.SignMultisig(priv, crypto.SigAlgFalcon)
+		if err != nil {
+			t.Fatalf("Failed to sign: %v", err)
+		}
+		if err := tx.AddMultisigSignature(sig); err != nil {
+			t.Fatalf("Failed to add signature: %v", err)
+		}
+	}
+	if tx.Size() > types.MaxTransactionSize {
+		t.Fatalf("Expected a full threshold to fit in %d bytes, got %d", types.MaxTransactionSize, tx.Size())
+	}
+	if err := pool.ValidateTransaction(tx); err != nil {
+		t.Fatalf("Expected largest multisig transaction to be valid: %v", err)
+	}
+
+	encoded, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatalf("Failed to encode transaction: %v", err)
+	}
+	decoded, err := types.DecodeRLPTransaction(encoded)
+	if err != nil {
+		t.Fatalf("Failed to decode transaction: %v", err)
+	}
+	if decoded.Hash() != tx.Hash() || decoded.Size() != tx.Size() {
+		t.Fatalf("Decoded transaction differs: hash %s, size %d", decoded.Hash().Hex(), decoded.Size())
+	}
+
+	addBlock(t, bc, decoded)
+	receipt, err := bc.GetTransactionReceipt(tx.Hash())
+	if err != nil || receipt.Status != 1 {
+		t.Fatalf("Expected largest multisig transaction to succeed, got %+v (%v)", receipt, err)
+	}
+	if bc.GetBalance(recipient).Int64() != 1000 {
+		t.Errorf("Expected recipient balance 1000, got %s", bc.GetBalance(recipient))
+	}
+}
@@ -3,9 +3,12 @@ package integration
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"math/big"
 	"net/http"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -227,18 +230,22 @@ func TestTransactionLifecycle(t *testing.T) {
 	// Create temporary data directory
 	tempDir := t.TempDir()
 
+	// The pool only admits transactions the sender can pay for
+	genesisPath, privKey, _ := writeFundedGenesis(t, tempDir)
+
 	// Create node configuration
 	config := &node.Config{
-		DataDir:      tempDir,
-		NetworkID:    8888,
-		ListenAddr:   "127.0.0.1:0",
-		HTTPPort:     0,
-		WSPort:       0,
-		ValidatorKey: "auto", // Enable validator for mining
-		ValidatorAlg: "dilithium",
-		Mining:       true, // Enable mining for this test
-		GasLimit:     15000000,
-		GasPrice:     big.NewInt(1000000000),
+		DataDir:       tempDir,
+		NetworkID:     8888,
+		ListenAddr:    "127.0.0.1:0",
+		HTTPPort:      0,
+		WSPort:        0,
+		ValidatorKey:  "auto", // Enable validator for mining
+		ValidatorAlg:  "dilithium",
+		Mining:        true, // Enable mining for this test
+		GasLimit:      15000000,
+		GasPrice:      big.NewInt(1000000000),
+		GenesisConfig: genesisPath,
 	}
 
 	// Create and start node
@@ -260,16 +267,11 @@ func TestTransactionLifecycle(t *testing.T) {
 	time.Sleep(5 * time.Second)
 
 	// Create a quantum transaction
-	privKey, _, err := crypto.GenerateDilithiumKeyPair()
-	if err != nil {
-		t.Fatalf("Failed to generate key pair: %v", err)
-	}
-
 	chainID := big.NewInt(8888)
 	nonce := uint64(0)
 	to := types.BytesToAddress([]byte("test recipient"))
 	value := big.NewInt(1000000000000000000) // 1 ETH
-	gasLimit := uint64(21000)
+	gasLimit := uint64(50000)
 	gasPrice := big.NewInt(1000000000)
 	data := []byte{}
 
@@ -476,7 +478,7 @@ func TestTxPool(t *testing.T) {
 	nonce := uint64(0)
 	to := types.BytesToAddress([]byte("recipient"))
 	value := big.NewInt(1000)
-	gasLimit := uint64(21000)
+	gasLimit := uint64(50000)
 	gasPrice := big.NewInt(1000000000)
 	data := []byte{}
 
@@ -524,3 +526,162 @@ func TestTxPool(t *testing.T) {
 		t.Error("Pool should be empty after removal")
 	}
 }
+
+// TestRPCBatchRequests tests JSON-RPC batch handling and error codes
+func TestRPCBatchRequests(t *testing.T) {
+	server := node.NewRPCServer(nil, 18645, 0)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start RPC server: %v", err)
+	}
+	defer server.Stop()
+
+	// Give the server time to start listening
+	time.Sleep(200 * time.Millisecond)
+
+	baseURL := "http://localhost:18645"
+
+	batch := `[
+		{"jsonrpc":"2.0","method":"eth_chainId","params":[],"id":1},
+		{"jsonrpc":"2.0","method":"eth_unknownMethod","params":[],"id":2},
+		{"jsonrpc":"2.0","method":"eth_getBalance","params":[42],"id":3},
+		{"jsonrpc":"2.0","method":"net_version","params":[],"id":4},
+		"not a request"
+	]`
+
+	resp, err := http.Post(baseURL, "application/json", bytes.NewBufferString(batch))
+	if err != nil {
+		t.Fatalf("Failed to post batch: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var results []struct {
+		ID     interface{} `json:"id"`
+		Result interface{} `json:"result"`
+		Error  *struct {
+			Code int `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		t.Fatalf("Failed to decode batch response: %v", err)
+	}
+
+	if len(results) != 5 {
+		t.Fatalf("Expected 5 responses, got %d", len(results))
+	}
+
+	if results[0].Result != "0x22b8" {
+		t.Errorf("Expected chain ID 0x22b8, got %v", results[0].Result)
+	}
+	if results[1].Error == nil || results[1].Error.Code != -32601 {
+		t.Errorf("Expected method not found (-32601), got %+v", results[1].Error)
+	}
+	if results[2].Error == nil || results[2].Error.Code != -32602 {
+		t.Errorf("Expected invalid params (-32602), got %+v", results[2].Error)
+	}
+	if results[3].Result != "8888" {
+		t.Errorf("Expected net version 8888, got %v", results[3].Result)
+	}
+	if results[4].Error == nil || results[4].Error.Code != -32600 {
+		t.Errorf("Expected invalid request (-32600), got %+v", results[4].Error)
+	}
+
+	// Empty batch is an invalid request
+	resp, err = http.Post(baseURL, "application/json", bytes.NewBufferString("[]"))
+	if err != nil {
+		t.Fatalf("Failed to post empty batch: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var single map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&single); err != nil {
+		t.Fatalf("Failed to decode empty batch response: %v", err)
+	}
+	if rpcErr, ok := single["error"].(map[string]interface{}); !ok || rpcErr["code"] != float64(-32600) {
+		t.Errorf("Expected invalid request for empty batch, got %v", single["error"])
+	}
+
+	// Notifications are executed without a response, a null id is still a request
+	postBatch := func(body string) []map[string]interface{} {
+		resp, err := http.Post(baseURL, "application/json", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("Failed to post batch: %v", err)
+		}
+		defer resp.Body.Close()
+
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("Failed to read batch response: %v", err)
+		}
+		if len(bytes.TrimSpace(data)) == 0 {
+			return nil
+		}
+		var replies []map[string]interface{}
+		if err := json.Unmarshal(data, &replies); err != nil {
+			t.Fatalf("Failed to decode batch response %s: %v", data, err)
+		}
+		return replies
+	}
+	replies := postBatch(`[
+		{"jsonrpc":"2.0","method":"eth_chainId","params":[]},
+		{"jsonrpc":"2.0","method":"net_version","params":[],"id":null},
+		{"jsonrpc":"2.0","method":"eth_unknownMethod","params":[]}
+	]`)
+	if len(replies) != 1 || replies[0]["result"] != "8888" {
+		t.Errorf("Expected only the net_version response, got %v", replies)
+	}
+	if replies := postBatch(`[{"jsonrpc":"2.0","method":"eth_chainId","params":[]}]`); replies != nil {
+		t.Errorf("Expected no response for a batch of notifications, got %v", replies)
+	}
+
+	// The same holds for a single notification
+	postSingle := func(body string) []byte {
+		resp, err := http.Post(baseURL, "application/json", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("Failed to post request: %v", err)
+		}
+		defer resp.Body.Close()
+
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+		return bytes.TrimSpace(data)
+	}
+	if data := postSingle(`{"jsonrpc":"2.0","method":"eth_chainId","params":[]}`); len(data) != 0 {
+		t.Errorf("Expected no response for a notification, got %s", data)
+	}
+	if data := postSingle(`{"jsonrpc":"2.0","method":"net_version","params":[],"id":null}`); !strings.Contains(string(data), `"8888"`) {
+		t.Errorf("Expected a response for a null id, got %s", data)
+	}
+}
+
+// TestRPCBatchRateLimit tests that every batch item counts against the rate limit
+func TestRPCBatchRateLimit(t *testing.T) {
+	server := node.NewRPCServer(nil, 18662, 0)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start RPC server: %v", err)
+	}
+	defer server.Stop()
+	time.Sleep(200 * time.Millisecond)
+
+	items := make([]string, 50)
+	for i := range items {
+		items[i] = fmt.Sprintf(`{"jsonrpc":"2.0","method":"net_version","params":[],"id":%d}`, i)
+	}
+	batch := "[" + strings.Join(items, ",") + "]"
+
+	// Two full batches use up the limit of 100 requests per minute
+	for i := 0; i < 3; i++ {
+		resp, err := http.Post("http://localhost:18662", "application/json", bytes.NewBufferString(batch))
+		if err != nil {
+			t.Fatalf("Failed to post batch: %v", err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		limited := strings.Contains(string(data), "Rate limit exceeded")
+		if limited != (i == 2) {
+			t.Errorf("Batch %d: expected rate limited %v, got %s", i, i == 2, data[:min(len(data), 80)])
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"quantum-blockchain/chain/network"
+	"quantum-blockchain/chain/node"
+	"quantum-blockchain/chain/types"
+)
+
+// TestPeerScorer tests scoring, growing bans and their persistence
+func TestPeerScorer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bans.json")
+	scorer, err := network.NewPeerScorer(path)
+	if err != nil {
+		t.Fatalf("Failed to create peer scorer: %v", err)
+	}
+	var banned []string
+	scorer.OnBan(func(ban *network.Ban) { banned = append(banned, ban.PeerID) })
+
+	// Useful data builds up credit, but only up to the cap
+	good := network.RandomNodeID()
+	for i := 0; i < 100; i++ {
+		scorer.Record(good, network.ScoreUsefulBlock)
+	}
+	if score := scorer.Score(good); score > network.MaxPeerScore || score < network.MaxPeerScore-1 {
+		t.Errorf("Expected the score to be capped at %.0f, got %.1f", network.MaxPeerScore, score)
+	}
+
+	// Misbehavior is banned once the score reaches the threshold
+	bad := network.RandomNodeID()
+	if scorer.Record(bad, network.ScoreInvalidSignature) {
+		t.Fatal("Expected a single invalid signature not to ban the peer")
+	}
+	if !scorer.Record(bad, network.ScoreInvalidSignature) || !scorer.IsBanned(bad) {
+		t.Fatal("Expected a second invalid signature to ban the peer")
+	}
+	if len(banned) != 1 || banned[0] != bad {
+		t.Errorf("Expected the ban to be announced, got %v", banned)
+	}
+
+	// Only some errors are the fault of the peer
+	if event, ok := network.ScoreEventForError(fmt.Errorf("block #1: %w", network.ErrInvalidBlock)); !ok || event != network.ScoreInvalidBlock {
+		t.Errorf("Expected an invalid block to be penalized, got %+v", event)
+	}
+	if _, ok := network.ScoreEventForError(fmt.Errorf("already known")); ok {
+		t.Error("Expected a known transaction not to be penalized")
+	}
+
+	// Repeated bans last longer
+	repeat := network.RandomNodeID()
+	first := scorer.Ban(repeat, "test", 0)
+	second := scorer.Ban(repeat, "test", 0)
+	if first.Until.Sub(first.Since) != network.DefaultBanDuration || second.Until.Sub(second.Since) != 2*network.DefaultBanDuration {
+		t.Errorf("Expected the second ban to last twice as long, got %v and %v",
+			first.Until.Sub(first.Since), second.Until.Sub(second.Since))
+	}
+
+	// Bans survive a restart
+	reopened, err := network.NewPeerScorer(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen peer scorer: %v", err)
+	}
+	if !reopened.IsBanned(bad) || !reopened.IsBanned(repeat) || len(reopened.Bans()) != 2 {
+		t.Errorf("Expected both bans to persist, got %d", len(reopened.Bans()))
+	}
+	if !reopened.Unban(bad) || reopened.IsBanned(bad) || reopened.Score(bad) != 0 {
+		t.Error("Expected the unbanned peer to start over")
+	}
+}
+
+// TestPeerBanning tests that a peer sending invalid data is disconnected and
+// refused until it is unbanned
+func TestPeerBanning(t *testing.T) {
+	startNetwork := func(bootstrap []string) *node.P2PNetwork {
+		t.Helper()
+		identity, err := network.GenerateNodeIdentity()
+		if err != nil {
+			t.Fatalf("Failed to generate identity: %v", err)
+		}
+		p2p := node.NewP2PNetwork("127.0.0.1:0", bootstrap, identity)
+		if err := p2p.Start(context.Background()); err != nil {
+			t.Fatalf("Failed to start P2P network: %v", err)
+		}
+		return p2p
+	}
+	waitFor := func(what string, condition func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for !condition() {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %s", what)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	listener := startNetwork(nil)
+	defer listener.Stop()
+	listener.SetTransactionHandler(func(tx *types.QuantumTransaction) error {
+		if string(tx.Data) == "forged" {
+			return fmt.Errorf("transaction %s: %w", tx.Hash().Hex(), network.ErrInvalidSignature)
+		}
+		return nil
+	})
+
+	dialer := startNetwork([]string{listener.ListenAddr()})
+	defer dialer.Stop()
+	waitFor("the networks to connect", func() bool { return len(listener.GetPeers()) == 1 && len(dialer.GetPeers()) == 1 })
+
+	// Useful transactions raise the score
+	dialer.BroadcastTransaction(types.NewQuantumTransaction(big.NewInt(8888), 0, nil, big.NewInt(1), 21000, big.NewInt(1000000000), []byte("useful")))
+	waitFor("the useful transaction", func() bool { return listener.PeerScorer().Score(dialer.NodeID()) > 0 })
+
+	// Forged transactions get the sender banned and disconnected
+	for i := uint64(1); i <= 3; i++ {
+		dialer.BroadcastTransaction(types.NewQuantumTransaction(big.NewInt(8888), i, nil, big.NewInt(1), 21000, big.NewInt(1000000000), []byte("forged")))
+	}
+	waitFor("the peer to be banned", func() bool {
+		return listener.PeerScorer().IsBanned(dialer.NodeID()) && len(listener.GetPeers()) == 0
+	})
+
+	// The banned peer can not reconnect
+	dialer.AddPeer(listener.ListenAddr())
+	time.Sleep(500 * time.Millisecond)
+	if len(listener.GetPeers()) != 0 {
+		t.Fatal("Expected the banned peer to be refused")
+	}
+
+	listener.PeerScorer().Unban(dialer.NodeID())
+	dialer.AddPeer(listener.ListenAddr())
+	waitFor("the unbanned peer to reconnect", func() bool { return len(listener.GetPeers()) == 1 })
+}
+
+// TestAdminBans tests banning peers over the admin RPC
+func TestAdminBans(t *testing.T) {
+	testNode, _, _, _ := newRPCTestNode(t, 18656)
+
+	socketPath := filepath.Join(t.TempDir(), "admin.ipc")
+	server := node.NewRPCServer(testNode, 18657, 0)
+	if err := server.AddEndpoint(&node.RPCEndpoint{
+		Name: "admin-ipc", Network: "unix", Address: socketPath, Namespaces: node.AdminNamespaces,
+	}); err != nil {
+		t.Fatalf("Failed to add admin endpoint: %v", err)
+	}
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start RPC server: %v", err)
+	}
+	defer server.Stop()
+	time.Sleep(200 * time.Millisecond)
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+		},
+	}}
+	call := func(method string, params ...interface{}) (json.RawMessage, *rpcError) {
+		return rpcCallAuth(t, client, "http://ipc", nil, method, params...)
+	}
+
+	if _, rpcErr := call("admin_banPeer", "not-a-peer"); rpcErr == nil || rpcErr.Code != -32602 {
+		t.Errorf("Expected an unknown peer to be rejected, got %+v", rpcErr)
+	}
+	if _, rpcErr := call("admin_banPeer", network.RandomNodeID(), "forever"); rpcErr == nil || rpcErr.Code != -32602 {
+		t.Errorf("Expected an invalid duration to be rejected, got %+v", rpcErr)
+	}
+
+	peerID := network.RandomNodeID()
+	result, rpcErr := call("admin_banPeer", peerID, "30m")
+	if rpcErr != nil {
+		t.Fatalf("Failed to ban peer: %+v", rpcErr)
+	}
+	var ban network.Ban
+	json.Unmarshal(result, &ban)
+	if ban.PeerID != peerID || ban.Until.Sub(ban.Since) != 30*time.Minute {
+		t.Errorf("Unexpected ban %+v", ban)
+	}
+
+	result, _ = call("admin_bans")
+	var bans []*network.Ban
+	json.Unmarshal(result, &bans)
+	if len(bans) != 1 || bans[0].PeerID != peerID {
+		t.Errorf("Expected the ban to be listed, got %s", result)
+	}
+
+	result, _ = call("admin_unbanPeer", peerID)
+	if string(result) != "true" {
+		t.Errorf("Expected the peer to be unbanned, got %s", result)
+	}
+	if result, _ = call("admin_bans"); string(result) != "[]" {
+		t.Errorf("Expected no bans left, got %s", result)
+	}
+}
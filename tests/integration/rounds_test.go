@@ -0,0 +1,118 @@
+package integration
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"quantum-blockchain/chain/consensus"
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/types"
+)
+
+// TestRoundChange tests that later rounds rotate the proposer, that a round
+// is reached once a quorum votes for it or a later round, and that the round
+// is part of the signed header
+func TestRoundChange(t *testing.T) {
+	mvc := consensus.NewMultiValidatorConsensus(big.NewInt(8888))
+	stake, _ := new(big.Int).SetString("200000000000000000000000", 10)
+
+	privs := make([]*crypto.DilithiumPrivateKey, 4)
+	addrs := make([]types.Address, 4)
+	for i := range privs {
+		priv, pub, err := crypto.GenerateDilithiumKeyPair()
+		if err != nil {
+			t.Fatalf("Failed to generate key: %v", err)
+		}
+		privs[i], addrs[i] = priv, types.PublicKeyToAddress(pub.Bytes())
+		if err := mvc.RegisterValidator(addrs[i], pub.Bytes(), stake, crypto.SigAlgDilithium, 0.05); err != nil {
+			t.Fatalf("Failed to register validator: %v", err)
+		}
+	}
+
+	// Every round of a height has another proposer until all had their turn
+	seen := make(map[types.Address]bool)
+	for round := uint64(0); round < 4; round++ {
+		proposer, err := mvc.GetProposer(9, round)
+		if err != nil {
+			t.Fatalf("Failed to get proposer: %v", err)
+		}
+		seen[proposer] = true
+	}
+	if len(seen) != 4 {
+		t.Errorf("Expected 4 proposers over 4 rounds, got %d", len(seen))
+	}
+	if first, _ := mvc.GetProposer(9, 0); first != mustNextProposer(t, mvc, 9) {
+		t.Error("Expected round 0 to be proposed by the scheduled proposer")
+	}
+	if again, _ := mvc.GetProposer(9, 4); again != mustNextProposer(t, mvc, 9) {
+		t.Error("Expected the rotation to wrap around")
+	}
+
+	if err := mvc.SetProposalTimeout(1500 * time.Millisecond); err == nil {
+		t.Error("Expected a proposal timeout in fractions of a second to fail")
+	}
+
+	// Round changes of other validators are verified
+	other := consensus.NewMultiValidatorConsensus(big.NewInt(8888))
+	for i := range addrs {
+		validator, _ := mvc.GetValidator(addrs[i])
+		if err := other.RegisterValidator(addrs[i], validator.PublicKey, stake, crypto.SigAlgDilithium, 0.05); err != nil {
+			t.Fatalf("Failed to register validator: %v", err)
+		}
+	}
+	votes := make([]*consensus.ConsensusVote, 4)
+	for i, round := range []uint64{2, 1, 2, 1} {
+		vote, err := mvc.SubmitRoundChange(addrs[i], 9, round, privs[i].Bytes())
+		if err != nil {
+			t.Fatalf("Failed to vote for round %d: %v", round, err)
+		}
+		votes[i] = vote
+	}
+	if err := other.AddRoundChange(votes[0]); err != nil {
+		t.Fatalf("Expected the round change to verify: %v", err)
+	}
+	forged := *votes[1]
+	forged.Round = 3
+	if err := other.AddRoundChange(&forged); !errors.Is(err, consensus.ErrInvalidVote) {
+		t.Errorf("Expected a round change with a changed round to fail, got %v", err)
+	}
+
+	// Two votes for round 2 and one for round 1 make a quorum for round 1
+	if round := other.RoundChangeQuorum(9); round != 0 {
+		t.Errorf("Expected no round with a single vote, got round %d", round)
+	}
+	for _, vote := range votes[1:3] {
+		if err := other.AddRoundChange(vote); err != nil {
+			t.Fatalf("Expected the round change to verify: %v", err)
+		}
+	}
+	if round := other.RoundChangeQuorum(9); round != 1 {
+		t.Errorf("Expected a quorum for round 1, got round %d", round)
+	}
+	if round := mvc.RoundChangeQuorum(9); round != 1 {
+		t.Errorf("Expected a quorum for round 1 with all votes, got round %d", round)
+	}
+	mvc.PruneVotes(9)
+	if round := mvc.RoundChangeQuorum(9); round != 0 {
+		t.Errorf("Expected the round changes of a committed height to be pruned, got round %d", round)
+	}
+
+	// The round is signed as part of the header
+	round0 := types.NewBlockHeader(types.ZeroHash, addrs[0], types.ZeroHash, big.NewInt(9), 15000000, 1000)
+	round1 := types.NewBlockHeader(types.ZeroHash, addrs[0], types.ZeroHash, big.NewInt(9), 15000000, 1000)
+	round1.Time, round1.Round = round0.Time, 1
+	if round0.SigningHash() == round1.SigningHash() || round0.Hash() == round1.Hash() {
+		t.Error("Expected the round to change the block hash")
+	}
+}
+
+func mustNextProposer(t *testing.T, mvc *consensus.MultiValidatorConsensus, height uint64) types.Address {
+	t.Helper()
+	proposer, err := mvc.GetNextProposer(height)
+	if err != nil {
+		t.Fatalf("Failed to get proposer: %v", err)
+	}
+	return proposer
+}
@@ -0,0 +1,224 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"quantum-blockchain/chain/network"
+	"quantum-blockchain/chain/node"
+	"quantum-blockchain/chain/types"
+
+	"github.com/gorilla/websocket"
+)
+
+// recordingConn keeps the last frame written so tests can replay or tamper with it
+type recordingConn struct {
+	*websocket.Conn
+	last []byte
+}
+
+func (c *recordingConn) WriteMessage(messageType int, data []byte) error {
+	c.last = append([]byte{}, data...)
+	return c.Conn.WriteMessage(messageType, data)
+}
+
+// secureSessionPair establishes a session between two fresh identities over a WebSocket
+func secureSessionPair(t *testing.T, payload []byte) (*network.SecureConn, *recordingConn, *network.SecureConn, *network.NodeIdentity, *network.NodeIdentity) {
+	t.Helper()
+
+	clientID, err := network.GenerateNodeIdentity()
+	if err != nil {
+		t.Fatalf("Failed to generate identity: %v", err)
+	}
+	serverID, err := network.GenerateNodeIdentity()
+	if err != nil {
+		t.Fatalf("Failed to generate identity: %v", err)
+	}
+
+	accepted := make(chan *network.SecureConn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Failed to upgrade: %v", err)
+			return
+		}
+		session, err := network.Handshake(conn, serverID, false, []byte(`{"side":"server"}`))
+		if err != nil {
+			t.Errorf("Server handshake failed: %v", err)
+			conn.Close()
+		}
+		accepted <- session
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	clientConn := &recordingConn{Conn: conn}
+	t.Cleanup(func() { clientConn.Close() })
+
+	client, err := network.Handshake(clientConn, clientID, true, payload)
+	if err != nil {
+		t.Fatalf("Client handshake failed: %v", err)
+	}
+	serverSession := <-accepted
+	if serverSession == nil {
+		t.FailNow()
+	}
+	return client, clientConn, serverSession, clientID, serverID
+}
+
+// TestSecureSession tests the post-quantum handshake and the encrypted frames
+func TestSecureSession(t *testing.T) {
+	client, clientConn, server, clientID, serverID := secureSessionPair(t, []byte(`{"side":"client"}`))
+
+	// Both sides learn the identity the other proved, and its authenticated payload
+	if client.RemoteID() != serverID.ID() || server.RemoteID() != clientID.ID() {
+		t.Fatalf("Expected peer IDs %s/%s, got %s/%s", serverID.ID(), clientID.ID(), client.RemoteID(), server.RemoteID())
+	}
+	if network.NodeIDFromPublicKey(server.RemotePublicKey()) != clientID.ID() {
+		t.Error("Expected the peer ID to derive from the proven identity key")
+	}
+	if string(server.RemotePayload()) != `{"side":"client"}` || string(client.RemotePayload()) != `{"side":"server"}` {
+		t.Errorf("Unexpected handshake payloads %s and %s", server.RemotePayload(), client.RemotePayload())
+	}
+
+	// Frames travel encrypted in both directions
+	secret := []byte("quantum secret frame")
+	if err := client.WriteFrame(secret); err != nil {
+		t.Fatalf("Failed to write frame: %v", err)
+	}
+	if strings.Contains(string(clientConn.last), string(secret)) {
+		t.Error("Expected the frame to be encrypted on the wire")
+	}
+	got, err := server.ReadFrame()
+	if err != nil || string(got) != string(secret) {
+		t.Fatalf("Expected to read %q, got %q (%v)", secret, got, err)
+	}
+	if err := server.WriteJSON(map[string]int{"height": 7}); err != nil {
+		t.Fatalf("Failed to write JSON frame: %v", err)
+	}
+	var reply map[string]int
+	if err := client.ReadJSON(&reply); err != nil || reply["height"] != 7 {
+		t.Fatalf("Expected height 7, got %v (%v)", reply, err)
+	}
+
+	// A replayed frame is rejected
+	if err := clientConn.Conn.WriteMessage(websocket.BinaryMessage, clientConn.last); err != nil {
+		t.Fatalf("Failed to replay frame: %v", err)
+	}
+	if _, err := server.ReadFrame(); !errors.Is(err, network.ErrFrameAuthentication) {
+		t.Errorf("Expected replayed frame to fail authentication, got %v", err)
+	}
+
+	// So is a tampered one
+	client2, clientConn2, server2, _, _ := secureSessionPair(t, nil)
+	if err := client2.WriteFrame(secret); err != nil {
+		t.Fatalf("Failed to write frame: %v", err)
+	}
+	if _, err := server2.ReadFrame(); err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+	tampered := append([]byte{}, clientConn2.last...)
+	tampered[len(tampered)-1] ^= 0x01
+	if err := clientConn2.Conn.WriteMessage(websocket.BinaryMessage, tampered); err != nil {
+		t.Fatalf("Failed to send tampered frame: %v", err)
+	}
+	if _, err := server2.ReadFrame(); !errors.Is(err, network.ErrFrameAuthentication) {
+		t.Errorf("Expected tampered frame to fail authentication, got %v", err)
+	}
+}
+
+// TestNodeIdentity tests that the node key persists the peer ID
+func TestNodeIdentity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nodekey")
+	identity, err := network.LoadNodeIdentity(path)
+	if err != nil {
+		t.Fatalf("Failed to create node key: %v", err)
+	}
+	reloaded, err := network.LoadNodeIdentity(path)
+	if err != nil {
+		t.Fatalf("Failed to load node key: %v", err)
+	}
+	if identity.ID() != reloaded.ID() {
+		t.Errorf("Expected the node ID %s to persist, got %s", identity.ID(), reloaded.ID())
+	}
+	if identity.ID() != network.NodeIDFromPublicKey(identity.PublicKey()) || len(identity.ID()) != 64 {
+		t.Errorf("Expected the node ID to be the hash of the identity key, got %s", identity.ID())
+	}
+}
+
+// TestP2PNetworkEncrypted tests that P2P networks authenticate each other and
+// gossip over the encrypted session
+func TestP2PNetworkEncrypted(t *testing.T) {
+	newIdentity := func() *network.NodeIdentity {
+		identity, err := network.GenerateNodeIdentity()
+		if err != nil {
+			t.Fatalf("Failed to generate identity: %v", err)
+		}
+		return identity
+	}
+
+	listener := node.NewP2PNetwork("127.0.0.1:0", nil, newIdentity())
+	if err := listener.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start P2P network: %v", err)
+	}
+	defer listener.Stop()
+
+	received := make(chan *types.QuantumTransaction, 1)
+	listener.SetTransactionHandler(func(tx *types.QuantumTransaction) error {
+		received <- tx
+		return nil
+	})
+
+	// A peer speaking the old plaintext protocol is dropped
+	plain, _, err := websocket.DefaultDialer.Dial("ws://"+listener.ListenAddr(), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	plain.WriteJSON(&node.P2PMessage{Type: node.MsgTypeHandshake, Data: []byte(`{"networkId":8888,"nodeId":"quantum-node-1"}`)})
+	plain.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := plain.ReadMessage(); err == nil {
+		t.Error("Expected a plaintext handshake to be refused")
+	}
+	plain.Close()
+
+	dialer := node.NewP2PNetwork("127.0.0.1:0", []string{listener.ListenAddr()}, newIdentity())
+	if err := dialer.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start P2P network: %v", err)
+	}
+	defer dialer.Stop()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for len(listener.GetPeers()) == 0 || len(dialer.GetPeers()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Networks did not connect: %d and %d peers", len(listener.GetPeers()), len(dialer.GetPeers()))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if id := listener.GetPeers()[0].ID; id != dialer.NodeID() {
+		t.Errorf("Expected the listener to see peer %s, got %s", dialer.NodeID(), id)
+	}
+	if id := dialer.GetPeers()[0].ID; id != listener.NodeID() {
+		t.Errorf("Expected the dialer to see peer %s, got %s", listener.NodeID(), id)
+	}
+
+	tx := types.NewQuantumTransaction(big.NewInt(8888), 3, nil, big.NewInt(1), 21000, big.NewInt(1000000000), []byte("gossip"))
+	dialer.BroadcastTransaction(tx)
+	select {
+	case got := <-received:
+		if got.Nonce != 3 || string(got.Data) != "gossip" {
+			t.Errorf("Unexpected gossiped transaction: %+v", got)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Transaction was not received over the encrypted session")
+	}
+}
@@ -0,0 +1,594 @@
+package integration
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"quantum-blockchain/chain/consensus"
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/economics"
+	"quantum-blockchain/chain/network"
+	"quantum-blockchain/chain/node"
+	"quantum-blockchain/chain/types"
+)
+
+func newSimulator(t *testing.T, cfg *node.SimulationConfig) *node.Simulator {
+	cfg.DataDir = t.TempDir()
+	sim, err := node.NewSimulator(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create simulator: %v", err)
+	}
+	t.Cleanup(sim.Close)
+	return sim
+}
+
+// minHeight returns the lowest head of the running simulated nodes
+func minHeight(sim *node.Simulator) uint64 {
+	var lowest uint64
+	first := true
+	for _, n := range sim.Nodes() {
+		if n.Crashed() {
+			continue
+		}
+		height := n.GetBlockchain().GetCurrentBlock().Number().Uint64()
+		if first || height < lowest {
+			lowest, first = height, false
+		}
+	}
+	return lowest
+}
+
+func maxHeight(sim *node.Simulator) uint64 {
+	var highest uint64
+	for _, n := range sim.Nodes() {
+		if height := n.GetBlockchain().GetCurrentBlock().Number().Uint64(); height > highest {
+			highest = height
+		}
+	}
+	return highest
+}
+
+// setSize returns the size of the validator set the simulated nodes agree
+// on, 0 if they disagree
+func setSize(sim *node.Simulator) int {
+	size := len(sim.Nodes()[0].GetValidators())
+	for _, n := range sim.Nodes()[1:] {
+		if len(n.GetValidators()) != size {
+			return 0
+		}
+	}
+	return size
+}
+
+func checkInvariants(t *testing.T, sim *node.Simulator) {
+	t.Helper()
+	if err := sim.CheckInvariants(); err != nil {
+		t.Fatalf("Invariant violated: %v", err)
+	}
+}
+
+// TestSimulation tests that simulated validators over a slow network
+// commit the same blocks, including a transfer, and keep the supply
+func TestSimulation(t *testing.T) {
+	priv, pub, err := crypto.GenerateDilithiumKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	sender := types.PublicKeyToAddress(pub.Bytes())
+	funds, _ := new(big.Int).SetString("1000000000000000000000", 10)
+
+	sim := newSimulator(t, &node.SimulationConfig{
+		Validators: 4,
+		Seed:       1,
+		Latency:    50 * time.Millisecond,
+		Jitter:     200 * time.Millisecond,
+		Accounts:   map[types.Address]*big.Int{sender: funds},
+	})
+
+	recipient := types.BytesToAddress([]byte("sim-recipient"))
+	tx := types.NewQuantumTransaction(big.NewInt(8888), 0, &recipient, big.NewInt(1000), 50000, big.NewInt(1000000000), nil)
+	if err := tx.SignTransaction(priv.Bytes(), crypto.SigAlgDilithium); err != nil {
+		t.Fatalf("Failed to sign transaction: %v", err)
+	}
+	if err := sim.SubmitTransaction(tx); err != nil {
+		t.Fatalf("Failed to submit transaction: %v", err)
+	}
+
+	if !sim.RunUntil(2*time.Minute, func() bool { return minHeight(sim) >= 5 }) {
+		t.Fatalf("Expected all validators to reach block #5, lowest at #%d", minHeight(sim))
+	}
+	checkInvariants(t, sim)
+
+	for i, n := range sim.Nodes() {
+		if balance := n.GetBlockchain().GetBalance(recipient); balance.Cmp(big.NewInt(1000)) != 0 {
+			t.Errorf("Expected validator %d to credit the transfer, recipient holds %s", i, balance)
+		}
+		if n.Rejected != 0 {
+			t.Errorf("Expected validator %d to accept all %d messages, rejected %d", i, n.Delivered, n.Rejected)
+		}
+
+		// The base fee of the gas used is burned
+		burned := new(big.Int)
+		bc := n.GetBlockchain()
+		for number := uint64(1); number <= bc.GetCurrentBlock().Number().Uint64(); number++ {
+			block, _ := bc.GetBlockByNumber(new(big.Int).SetUint64(number))
+			burned.Add(burned, new(big.Int).Mul(block.BaseFee(), new(big.Int).SetUint64(block.GasUsed())))
+		}
+		if burned.Sign() == 0 || n.GetTokenSupply().Burned.Cmp(burned) != 0 {
+			t.Errorf("Expected validator %d to record %s burned, got %s", i, burned, n.GetTokenSupply().Burned)
+		}
+	}
+}
+
+// TestSimulationFaults tests that validators stay safe under message loss,
+// a partition and a crash, and make progress again once a quorum can talk
+func TestSimulationFaults(t *testing.T) {
+	sim := newSimulator(t, &node.SimulationConfig{
+		Validators: 4,
+		Seed:       7,
+		Latency:    20 * time.Millisecond,
+		Jitter:     100 * time.Millisecond,
+		Loss:       0.1,
+	})
+
+	// Lost messages are made up for by resent votes and block requests
+	if !sim.RunUntil(2*time.Minute, func() bool { return minHeight(sim) >= 3 }) {
+		t.Fatalf("Expected progress with 10%% loss, lowest at #%d", minHeight(sim))
+	}
+	checkInvariants(t, sim)
+	sim.SetLoss(0)
+
+	// Neither half of a 2/2 partition holds a quorum
+	sim.Run(10 * time.Second)
+	sim.Partition([]int{0, 1}, []int{2, 3})
+	sim.Run(10 * time.Second)
+	stalled := maxHeight(sim)
+	sim.Run(time.Minute)
+	if height := maxHeight(sim); height != stalled {
+		t.Errorf("Expected no blocks while partitioned, went from #%d to #%d", stalled, height)
+	}
+	checkInvariants(t, sim)
+
+	sim.Heal()
+	if !sim.RunUntil(2*time.Minute, func() bool { return minHeight(sim) >= stalled+2 }) {
+		t.Fatalf("Expected progress after healing, lowest at #%d", minHeight(sim))
+	}
+	converged := func() bool { return sim.CheckConvergence() == nil }
+	if !sim.RunUntil(30*time.Second, converged) {
+		t.Errorf("Expected validators to converge after healing: %v", sim.CheckConvergence())
+	}
+	checkInvariants(t, sim)
+
+	// A crashed validator catches up on recovery
+	sim.Crash(3)
+	behind := sim.Nodes()[3].GetBlockchain().GetCurrentBlock().Number().Uint64()
+	sim.Run(time.Minute)
+	sim.Recover(3)
+	if !sim.RunUntil(2*time.Minute, func() bool { return minHeight(sim) >= behind+2 }) {
+		t.Fatalf("Expected progress after recovery, lowest at #%d", minHeight(sim))
+	}
+	if !sim.RunUntil(30*time.Second, converged) {
+		t.Errorf("Expected validators to converge after recovery: %v", sim.CheckConvergence())
+	}
+	checkInvariants(t, sim)
+}
+
+// TestSimulationDoubleSign tests that a validator voting for two blocks at
+// one height is caught, and that a block punishes it on every node
+func TestSimulationDoubleSign(t *testing.T) {
+	sim := newSimulator(t, &node.SimulationConfig{
+		Validators:  4,
+		Seed:        3,
+		Latency:     20 * time.Millisecond,
+		Jitter:      100 * time.Millisecond,
+		EpochBlocks: 5,
+	})
+	if !sim.RunUntil(time.Minute, func() bool { return minHeight(sim) >= 2 }) {
+		t.Fatalf("Expected progress, lowest at #%d", minHeight(sim))
+	}
+
+	offender := sim.Nodes()[0].GetValidatorAddress()
+	stake := new(big.Int).Set(sim.Nodes()[1].GetValidators()[0].TotalStake)
+	if err := sim.DoubleSign(0); err != nil {
+		t.Fatalf("Failed to double sign: %v", err)
+	}
+
+	jailed := func() bool {
+		for _, n := range sim.Nodes() {
+			if validator, ok := n.GetMultiConsensus().GetValidator(offender); !ok || validator.Status != consensus.StatusJailed {
+				return false
+			}
+		}
+		return true
+	}
+	if !sim.RunUntil(time.Minute, jailed) {
+		t.Fatal("Expected every node to jail the double signing validator")
+	}
+	if !sim.RunUntil(time.Minute, func() bool { return setSize(sim) == 3 }) {
+		t.Fatal("Expected every node to drop the jailed validator from the set at the next epoch")
+	}
+	checkInvariants(t, sim)
+
+	penalty := economics.NewTokenomicsEngine().CalculateSlashingPenalty(stake, economics.SlashingDoubleSign, economics.SeverityNormal)
+	for i, n := range sim.Nodes() {
+		validator, _ := n.GetMultiConsensus().GetValidator(offender)
+		if want := new(big.Int).Sub(stake, penalty); validator.TotalStake.Cmp(want) != 0 {
+			t.Errorf("Expected validator %d to slash the stake to %s, got %s", i, want, validator.TotalStake)
+		}
+		if len(n.GetValidators()) != 3 {
+			t.Errorf("Expected validator %d to keep 3 validators, got %d", i, len(n.GetValidators()))
+		}
+	}
+
+	// The other validators go on without it
+	height := maxHeight(sim)
+	if !sim.RunUntil(time.Minute, func() bool { return minHeight(sim) >= height+2 }) {
+		t.Fatalf("Expected progress without the jailed validator, lowest at #%d", minHeight(sim))
+	}
+	checkInvariants(t, sim)
+}
+
+// TestSimulationDowntime tests that a validator too slow to get its votes
+// into blocks is slashed and jailed for downtime while the others go on, and
+// rejoins with an unjail transaction after its jail term
+func TestSimulationDowntime(t *testing.T) {
+	sim := newSimulator(t, &node.SimulationConfig{
+		Validators:         4,
+		Seed:               5,
+		Latency:            20 * time.Millisecond,
+		Jitter:             100 * time.Millisecond,
+		SignedBlocksWindow: 10,
+		MinSignedRatio:     0.5,
+		DowntimeJail:       time.Minute,
+		EpochBlocks:        5,
+	})
+	slow := sim.Nodes()[3].GetValidatorAddress()
+	stake := new(big.Int).Set(sim.Nodes()[0].GetValidators()[0].TotalStake)
+	sim.SetNodeLatency(3, 3*time.Second)
+
+	status := func(n *node.SimNode) consensus.ValidatorStatus {
+		validator, _ := n.GetMultiConsensus().GetValidator(slow)
+		return validator.Status
+	}
+	jailed := func() bool {
+		for _, n := range sim.Nodes() {
+			if status(n) != consensus.StatusJailed {
+				return false
+			}
+		}
+		return true
+	}
+	if !sim.RunUntil(5*time.Minute, jailed) {
+		t.Fatalf("Expected every node to jail the slow validator, lowest at #%d", minHeight(sim))
+	}
+	if !sim.RunUntil(time.Minute, func() bool { return setSize(sim) == 3 }) {
+		t.Fatal("Expected every node to drop the jailed validator from the set at the next epoch")
+	}
+	checkInvariants(t, sim)
+
+	penalty := economics.NewTokenomicsEngine().CalculateSlashingPenalty(stake, economics.SlashingDowntime, economics.SeverityNormal)
+	for i, n := range sim.Nodes() {
+		validator, _ := n.GetMultiConsensus().GetValidator(slow)
+		if want := new(big.Int).Sub(stake, penalty); validator.TotalStake.Cmp(want) != 0 {
+			t.Errorf("Expected validator %d to slash the stake to %s, got %s", i, want, validator.TotalStake)
+		}
+		if len(n.GetValidators()) != 3 {
+			t.Errorf("Expected validator %d to keep 3 validators, got %d", i, len(n.GetValidators()))
+		}
+	}
+
+	// The other validators go on without it, and it catches up once fast
+	sim.SetNodeLatency(3, 0)
+	height := maxHeight(sim)
+	if !sim.RunUntil(time.Minute, func() bool { return minHeight(sim) >= height+2 }) {
+		t.Fatalf("Expected progress without the jailed validator, lowest at #%d", minHeight(sim))
+	}
+
+	// Unjailing fails during the jail term and succeeds after it
+	if err := sim.Unjail(3); err != nil {
+		t.Fatalf("Failed to send unjail transaction: %v", err)
+	}
+	sim.Run(10 * time.Second)
+	if !jailed() {
+		t.Fatal("Expected the validator to stay jailed during its jail term")
+	}
+	sim.Run(time.Minute)
+	if err := sim.Unjail(3); err != nil {
+		t.Fatalf("Failed to send unjail transaction: %v", err)
+	}
+	rejoined := func() bool {
+		for _, n := range sim.Nodes() {
+			if status(n) != consensus.StatusActive || len(n.GetValidators()) != 4 {
+				return false
+			}
+		}
+		return true
+	}
+	if !sim.RunUntil(time.Minute, rejoined) {
+		t.Fatal("Expected every node to return the validator to the validator set")
+	}
+
+	height = maxHeight(sim)
+	if !sim.RunUntil(time.Minute, func() bool { return minHeight(sim) >= height+2 }) {
+		t.Fatalf("Expected progress with the validator back, lowest at #%d", minHeight(sim))
+	}
+	checkInvariants(t, sim)
+}
+
+// TestSimulationProposerTimeout tests that the validators move on to the
+// next round when the scheduled proposer is offline, and that the blocks
+// record the round they were proposed in
+func TestSimulationProposerTimeout(t *testing.T) {
+	sim := newSimulator(t, &node.SimulationConfig{
+		Validators: 4,
+		Seed:       11,
+		Latency:    20 * time.Millisecond,
+		Jitter:     100 * time.Millisecond,
+	})
+	if !sim.RunUntil(time.Minute, func() bool { return minHeight(sim) >= 2 }) {
+		t.Fatalf("Expected all validators to reach block #2, lowest at #%d", minHeight(sim))
+	}
+
+	// Crash the validator scheduled to propose a coming block
+	mvc := sim.Nodes()[0].GetMultiConsensus()
+	height := maxHeight(sim)
+	offline := -1
+	for next := height + 2; offline < 0; next++ {
+		proposer, err := mvc.GetProposer(next, 0)
+		if err != nil {
+			t.Fatalf("Failed to get proposer: %v", err)
+		}
+		for i, n := range sim.Nodes() {
+			if n.GetValidatorAddress() == proposer && i != 0 {
+				offline = i
+			}
+		}
+	}
+	sim.Crash(offline)
+
+	laterRound := func() bool {
+		chain := sim.Nodes()[0].GetBlockchain()
+		for number := height + 1; number <= chain.GetCurrentBlock().Number().Uint64(); number++ {
+			block, err := chain.GetBlockByNumber(new(big.Int).SetUint64(number))
+			if err == nil && block.Header.Round > 0 {
+				return true
+			}
+		}
+		return false
+	}
+	if !sim.RunUntil(3*time.Minute, laterRound) {
+		t.Fatalf("Expected a block proposed in a later round, lowest at #%d", minHeight(sim))
+	}
+	height = maxHeight(sim)
+	if !sim.RunUntil(3*time.Minute, func() bool { return minHeight(sim) >= height+3 }) {
+		t.Fatalf("Expected progress without the offline proposer, lowest at #%d", minHeight(sim))
+	}
+	checkInvariants(t, sim)
+
+	for i, n := range sim.Nodes() {
+		if n.Rejected != 0 {
+			t.Errorf("Expected validator %d to accept all %d messages, rejected %d", i, n.Delivered, n.Rejected)
+		}
+	}
+
+	// The offline validator catches up, the rounds check against the headers
+	sim.Recover(offline)
+	converged := func() bool { return sim.CheckConvergence() == nil }
+	if !sim.RunUntil(time.Minute, converged) {
+		t.Errorf("Expected validators to converge after recovery: %v", sim.CheckConvergence())
+	}
+	checkInvariants(t, sim)
+}
+
+// TestSimulationPartialProposal tests that a height still commits when a
+// proposal only reached some validators before its proposer went offline
+func TestSimulationPartialProposal(t *testing.T) {
+	sim := newSimulator(t, &node.SimulationConfig{
+		Validators: 4,
+		Seed:       17,
+		Latency:    20 * time.Millisecond,
+		Jitter:     50 * time.Millisecond,
+	})
+	if !sim.RunUntil(time.Minute, func() bool { return minHeight(sim) >= 2 }) {
+		t.Fatalf("Expected all validators to reach block #2, lowest at #%d", minHeight(sim))
+	}
+
+	// Wait for a height whose proposer can be cut off together with one peer
+	indexOf := func(addr types.Address) int {
+		for i, n := range sim.Nodes() {
+			if n.GetValidatorAddress() == addr {
+				return i
+			}
+		}
+		return -1
+	}
+	var height uint64
+	proposer := -1
+	sim.RunUntil(time.Minute, func() bool {
+		height = minHeight(sim)
+		if maxHeight(sim) != height {
+			return false
+		}
+		addr, err := sim.Nodes()[0].GetMultiConsensus().GetProposer(height+1, 0)
+		if err != nil {
+			t.Fatalf("Failed to get proposer: %v", err)
+		}
+		proposer = indexOf(addr)
+		return true
+	})
+	if proposer < 0 {
+		t.Fatal("Expected the validators to agree on a head")
+	}
+	peer := (proposer + 1) % 4
+
+	// Only the peer receives the proposal and votes for it
+	sim.Partition([]int{proposer, peer})
+	voted := func() bool {
+		_, ok := sim.Nodes()[peer].GetMultiConsensus().GetVote(height+1, 0, sim.Nodes()[peer].GetValidatorAddress())
+		return ok
+	}
+	if !sim.RunUntil(time.Minute, voted) {
+		t.Fatalf("Expected validator %d to vote at height %d", peer, height+1)
+	}
+	sim.Crash(proposer)
+	sim.Heal()
+
+	if !sim.RunUntil(3*time.Minute, func() bool { return minHeight(sim) >= height+3 }) {
+		t.Fatalf("Expected progress past height %d, lowest at #%d", height+1, minHeight(sim))
+	}
+	checkInvariants(t, sim)
+}
+
+// TestSimulationVoteSplit tests that a height still commits when the
+// validators split their votes between the proposals of two rounds
+func TestSimulationVoteSplit(t *testing.T) {
+	sim := newSimulator(t, &node.SimulationConfig{
+		Validators: 4,
+		Seed:       23,
+		Latency:    20 * time.Millisecond,
+		Jitter:     50 * time.Millisecond,
+	})
+	if !sim.RunUntil(time.Minute, func() bool { return minHeight(sim) >= 2 }) {
+		t.Fatalf("Expected all validators to reach block #2, lowest at #%d", minHeight(sim))
+	}
+
+	// Wait for a height whose proposers of the first two rounds differ
+	indexOf := func(addr types.Address) int {
+		for i, n := range sim.Nodes() {
+			if n.GetValidatorAddress() == addr {
+				return i
+			}
+		}
+		return -1
+	}
+	var height uint64
+	first, second := -1, -1
+	sim.RunUntil(time.Minute, func() bool {
+		height = minHeight(sim)
+		if maxHeight(sim) != height {
+			return false
+		}
+		mvc := sim.Nodes()[0].GetMultiConsensus()
+		addr0, err := mvc.GetProposer(height+1, 0)
+		if err != nil {
+			t.Fatalf("Failed to get proposer: %v", err)
+		}
+		addr1, err := mvc.GetProposer(height+1, 1)
+		if err != nil {
+			t.Fatalf("Failed to get proposer: %v", err)
+		}
+		first, second = indexOf(addr0), indexOf(addr1)
+		return first != second
+	})
+	if first < 0 || first == second {
+		t.Fatal("Expected a height with two different proposers")
+	}
+
+	// The first proposer and one peer vote in round 0, the others only see
+	// the proposal of round 1
+	peer := 0
+	for peer == first || peer == second {
+		peer++
+	}
+	ahead := map[int]bool{first: true, peer: true}
+	sim.SetFilter(func(from, to int, msgType network.MessageType) bool {
+		if msgType != network.MsgConsensusProposal {
+			return true
+		}
+		return ahead[from] == ahead[to]
+	})
+	voteOf := func(index int, round uint64) (*consensus.ConsensusVote, bool) {
+		n := sim.Nodes()[index]
+		return n.GetMultiConsensus().GetVote(height+1, round, n.GetValidatorAddress())
+	}
+	split := func() bool {
+		for i := range sim.Nodes() {
+			round := uint64(1)
+			if ahead[i] {
+				round = 0
+			}
+			if _, ok := voteOf(i, round); !ok {
+				return false
+			}
+		}
+		return true
+	}
+	if !sim.RunUntil(3*time.Minute, split) {
+		t.Fatalf("Expected the votes at height %d to split across rounds", height+1)
+	}
+	early, _ := voteOf(peer, 0)
+	late, _ := voteOf(second, 1)
+	if early.BlockHash == late.BlockHash {
+		t.Fatal("Expected the rounds to vote for different blocks")
+	}
+
+	sim.SetFilter(nil)
+	if !sim.RunUntil(3*time.Minute, func() bool { return minHeight(sim) >= height+2 }) {
+		t.Fatalf("Expected progress past height %d, lowest at #%d", height+1, minHeight(sim))
+	}
+	checkInvariants(t, sim)
+
+	for i, n := range sim.Nodes() {
+		if n.Rejected != 0 {
+			t.Errorf("Expected validator %d to accept all %d messages, rejected %d", i, n.Delivered, n.Rejected)
+		}
+	}
+}
+
+// TestSimulationEncryptedTransaction tests that validators reveal an
+// encrypted transaction from their key shares once the block ordering it is
+// committed, and execute it in the next block
+func TestSimulationEncryptedTransaction(t *testing.T) {
+	priv, pub, err := crypto.GenerateDilithiumKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	sender := types.PublicKeyToAddress(pub.Bytes())
+	recipient := types.BytesToAddress([]byte("sim-recipient"))
+	funds, _ := new(big.Int).SetString("1000000000000000000000", 10)
+
+	sim := newSimulator(t, &node.SimulationConfig{
+		Validators: 4,
+		Seed:       5,
+		Latency:    50 * time.Millisecond,
+		Jitter:     200 * time.Millisecond,
+		Accounts:   map[types.Address]*big.Int{sender: funds, recipient: big.NewInt(0)},
+	})
+
+	// The validators announce their keys as they start
+	sim.Run(5 * time.Second)
+	epoch := types.EncryptionEpoch(maxHeight(sim) + 1)
+	keys := sim.Nodes()[0].EncryptionKeys(epoch)
+	if len(keys) != 4 {
+		t.Fatalf("Expected the keys of 4 validators, got %d", len(keys))
+	}
+
+	tx := encryptedTx(t, priv, 0, epoch, keys, 2, recipient, big.NewInt(1000))
+	if err := sim.SubmitTransaction(tx); err != nil {
+		t.Fatalf("Failed to submit transaction: %v", err)
+	}
+
+	executed := func() bool {
+		for _, n := range sim.Nodes() {
+			if n.GetBlockchain().GetBalance(recipient).Cmp(big.NewInt(1000)) != 0 {
+				return false
+			}
+		}
+		return true
+	}
+	if !sim.RunUntil(2*time.Minute, executed) {
+		t.Fatalf("Expected every validator to execute the encrypted transfer, heads at #%d to #%d", minHeight(sim), maxHeight(sim))
+	}
+	checkInvariants(t, sim)
+
+	for i, n := range sim.Nodes() {
+		receipt, err := n.GetBlockchain().GetTransactionReceipt(tx.Hash())
+		if err != nil || receipt.Status != 1 {
+			t.Errorf("Expected validator %d to record a successful receipt, got %v", i, err)
+		}
+		if n.Rejected != 0 {
+			t.Errorf("Expected validator %d to accept all %d messages, rejected %d", i, n.Delivered, n.Rejected)
+		}
+	}
+}
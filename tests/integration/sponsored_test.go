@@ -0,0 +1,180 @@
+package integration
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/evm"
+	"quantum-blockchain/chain/node"
+	"quantum-blockchain/chain/types"
+)
+
+// sponsoredTx creates a transaction from sender whose gas is paid by feePayer
+func sponsoredTx(t *testing.T, sender *crypto.DilithiumPrivateKey, feePayer types.Address, nonce uint64, to types.Address, value *big.Int) *types.QuantumTransaction {
+	tx := types.NewQuantumTransaction(big.NewInt(8888), nonce, &to, value, 100000, big.NewInt(1000000000), nil)
+	tx.SetFeePayer(feePayer)
+	if err := tx.SignTransaction(sender.Bytes(), crypto.SigAlgDilithium); err != nil {
+		t.Fatalf("Failed to sign transaction: %v", err)
+	}
+	return tx
+}
+
+// TestSponsoredTransactions tests that fee payers pay for the gas of senders without funds
+func TestSponsoredTransactions(t *testing.T) {
+	bc, sponsorKey, sponsor := newFundedBlockchain(t)
+	pool := node.NewTxPool(100)
+	pool.SetBalanceSource(bc.GetBalance)
+	recipient := types.BytesToAddress([]byte("recipient"))
+
+	senderKey, _, err := crypto.GenerateDilithiumKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+
+	// An unfunded sender can not pay for its own gas
+	unsponsored := signedTx(t, senderKey, 0, recipient, big.NewInt(0), 100000, nil)
+	if err := pool.ValidateTransaction(unsponsored); !errors.Is(err, types.ErrInsufficientBalance) {
+		t.Errorf("Expected insufficient balance, got %v", err)
+	}
+
+	// The fee payer signature is required and must come from the fee payer
+	tx := sponsoredTx(t, senderKey, sponsor, 0, recipient, big.NewInt(0))
+	if err := pool.ValidateTransaction(tx); !errors.Is(err, types.ErrMissingFeePayerSignature) {
+		t.Errorf("Expected missing fee payer signature, got %v", err)
+	}
+	if err := tx.SignAsFeePayer(senderKey.Bytes(), crypto.SigAlgDilithium); err != nil {
+		t.Fatalf("Failed to sign as fee payer: %v", err)
+	}
+	if err := pool.ValidateTransaction(tx); !errors.Is(err, types.ErrFeePayerMismatch) {
+		t.Errorf("Expected fee payer mismatch, got %v", err)
+	}
+	if err := tx.SignAsFeePayer(sponsorKey.Bytes(), crypto.SigAlgDilithium); err != nil {
+		t.Fatalf("Failed to sign as fee payer: %v", err)
+	}
+	if err := pool.ValidateTransaction(tx); err != nil {
+		t.Fatalf("Expected sponsored transaction to be valid: %v", err)
+	}
+
+	// The sender still pays the value it transfers
+	withValue := sponsoredTx(t, senderKey, sponsor, 0, recipient, big.NewInt(1))
+	if err := withValue.SignAsFeePayer(sponsorKey.Bytes(), crypto.SigAlgDilithium); err != nil {
+		t.Fatalf("Failed to sign as fee payer: %v", err)
+	}
+	if err := pool.ValidateTransaction(withValue); !errors.Is(err, types.ErrInsufficientBalance) {
+		t.Errorf("Expected insufficient sender balance, got %v", err)
+	}
+
+	// Both signatures survive encoding
+	encoded, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatalf("Failed to encode transaction: %v", err)
+	}
+	decoded, err := types.DecodeRLPTransaction(encoded)
+	if err != nil {
+		t.Fatalf("Failed to decode transaction: %v", err)
+	}
+	if decoded.Hash() != tx.Hash() || decoded.FeePayer == nil || *decoded.FeePayer != sponsor {
+		t.Fatalf("Decoded transaction differs: hash %s, fee payer %v", decoded.Hash().Hex(), decoded.FeePayer)
+	}
+	if valid, err := decoded.VerifySignature(); !valid || err != nil {
+		t.Fatalf("Expected decoded signatures to verify, got %v, %v", valid, err)
+	}
+
+	// Changing the fee payer invalidates the sender signature
+	tampered := *decoded
+	tampered.FeePayer = &recipient
+	if valid, _ := tampered.VerifySignature(); valid {
+		t.Error("Expected tampered fee payer to be rejected")
+	}
+
+	sponsorBefore := bc.GetBalance(sponsor)
+	addBlock(t, bc, tx)
+
+	receipt, err := bc.GetTransactionReceipt(tx.Hash())
+	if err != nil {
+		t.Fatalf("Failed to get receipt: %v", err)
+	}
+	if want := evm.TransactionIntrinsicGas(tx); receipt.Status != 1 || receipt.GasUsed != want {
+		t.Errorf("Expected successful transaction using %d gas, got status %d using %d", want, receipt.Status, receipt.GasUsed)
+	}
+	if receipt.FeePayer == nil || *receipt.FeePayer != sponsor {
+		t.Errorf("Expected receipt fee payer %s, got %v", sponsor.Hex(), receipt.FeePayer)
+	}
+
+	paid := new(big.Int).Sub(sponsorBefore, bc.GetBalance(sponsor))
+	if want := new(big.Int).Mul(new(big.Int).SetUint64(receipt.GasUsed), receipt.EffectiveGasPrice); paid.Cmp(want) != 0 {
+		t.Errorf("Expected fee payer to pay %s, paid %s", want, paid)
+	}
+	if bc.GetBalance(tx.From()).Sign() != 0 || bc.GetNonce(tx.From()) != 1 {
+		t.Errorf("Expected sender balance 0 and nonce 1, got %s and %d", bc.GetBalance(tx.From()), bc.GetNonce(tx.From()))
+	}
+}
+
+// TestSponsorKeyRotation tests that a fee payer signs with the key bound to
+// it after a rotation and no longer with the key it rotated away from
+func TestSponsorKeyRotation(t *testing.T) {
+	bc, oldKey, sponsor := newFundedBlockchain(t)
+	pool := node.NewTxPool(100)
+	pool.SetBalanceSource(bc.GetBalance)
+	pool.SetKeySource(bc.GetKeyBinding)
+	recipient := types.BytesToAddress([]byte("recipient"))
+
+	newKey, newPub, err := crypto.GenerateDilithiumKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	rotation := types.NewKeyRotationTransaction(big.NewInt(8888), 0, crypto.SigAlgDilithium, newPub.Bytes(), 400000, big.NewInt(1000000000))
+	if err := rotation.SignTransaction(oldKey.Bytes(), crypto.SigAlgDilithium); err != nil {
+		t.Fatalf("Failed to sign transaction: %v", err)
+	}
+	addBlock(t, bc, rotation)
+	if bc.GetKeyBinding(sponsor) == nil {
+		t.Fatal("Expected the sponsor key to be rotated")
+	}
+
+	senderKey, _, err := crypto.GenerateDilithiumKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+
+	// The old key can no longer spend the sponsor's balance on gas
+	stale := sponsoredTx(t, senderKey, sponsor, 0, recipient, big.NewInt(0))
+	if err := stale.SignAsFeePayer(oldKey.Bytes(), crypto.SigAlgDilithium); err != nil {
+		t.Fatalf("Failed to sign as fee payer: %v", err)
+	}
+	if err := pool.ValidateTransaction(stale); !errors.Is(err, evm.ErrKeyNotBound) {
+		t.Errorf("Expected old fee payer key to be rejected by the pool, got %v", err)
+	}
+	parent := bc.GetCurrentBlock()
+	header := types.NewBlockHeader(parent.Hash(), types.BytesToAddress([]byte("coinbase")), types.ZeroHash,
+		new(big.Int).Add(parent.Number(), big.NewInt(1)), types.DefaultBlockGasLimit, parent.Time()+1)
+	header.BaseFee = types.CalcBaseFee(parent.Header)
+	if err := bc.AddBlock(types.NewBlock(header, []*types.QuantumTransaction{stale}, nil)); !errors.Is(err, evm.ErrKeyNotBound) {
+		t.Errorf("Expected block with old fee payer key to be rejected, got %v", err)
+	}
+
+	// The new key sponsors for the account
+	tx := sponsoredTx(t, senderKey, sponsor, 0, recipient, big.NewInt(0))
+	if err := tx.SignAsFeePayer(newKey.Bytes(), crypto.SigAlgDilithium); err != nil {
+		t.Fatalf("Failed to sign as fee payer: %v", err)
+	}
+	if err := pool.ValidateTransaction(tx); err != nil {
+		t.Fatalf("Expected new fee payer key to be valid: %v", err)
+	}
+	sponsorBefore := bc.GetBalance(sponsor)
+	addBlock(t, bc, tx)
+
+	receipt, err := bc.GetTransactionReceipt(tx.Hash())
+	if err != nil {
+		t.Fatalf("Failed to get receipt: %v", err)
+	}
+	if receipt.Status != 1 || receipt.FeePayer == nil || *receipt.FeePayer != sponsor {
+		t.Errorf("Expected successful transaction paid by %s, got status %d paid by %v", sponsor.Hex(), receipt.Status, receipt.FeePayer)
+	}
+	if bc.GetBalance(sponsor).Cmp(sponsorBefore) >= 0 {
+		t.Error("Expected the sponsor to pay for gas")
+	}
+}
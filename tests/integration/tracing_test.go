@@ -0,0 +1,172 @@
+package integration
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/node"
+	"quantum-blockchain/chain/types"
+)
+
+// writeFundedGenesis writes a genesis file that funds a fresh Dilithium account
+func writeFundedGenesis(t *testing.T, dir string) (string, *crypto.DilithiumPrivateKey, types.Address) {
+	privKey, pubKey, err := crypto.GenerateDilithiumKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	addr := types.PublicKeyToAddress(pubKey.Bytes())
+
+	genesis := fmt.Sprintf(`{
+		"config": {"chainId": 8888},
+		"difficulty": "0x1",
+		"gasLimit": "0x47b760",
+		"alloc": {"%s": {"balance": "0xd3c21bcecceda1000000"}}
+	}`, addr.Hex())
+	genesisPath := filepath.Join(dir, "genesis.json")
+	if err := os.WriteFile(genesisPath, []byte(genesis), 0644); err != nil {
+		t.Fatalf("Failed to write genesis: %v", err)
+	}
+
+	return genesisPath, privKey, addr
+}
+
+// newFundedBlockchain creates a blockchain whose genesis funds a fresh Dilithium account
+func newFundedBlockchain(t *testing.T) (*node.Blockchain, *crypto.DilithiumPrivateKey, types.Address) {
+	tempDir := t.TempDir()
+	genesisPath, privKey, addr := writeFundedGenesis(t, tempDir)
+
+	blockchain, err := node.NewBlockchain(filepath.Join(tempDir, "chain"), genesisPath)
+	if err != nil {
+		t.Fatalf("Failed to create blockchain: %v", err)
+	}
+	t.Cleanup(func() { blockchain.Close() })
+
+	return blockchain, privKey, addr
+}
+
+// addBlock builds and adds a block on top of the current head
+func addBlock(t *testing.T, blockchain *node.Blockchain, txs ...*types.QuantumTransaction) *types.Block {
+	parent := blockchain.GetCurrentBlock()
+	coinbase := types.BytesToAddress([]byte("coinbase"))
+	header := types.NewBlockHeader(parent.Hash(), coinbase, types.ZeroHash,
+		new(big.Int).Add(parent.Number(), big.NewInt(1)), types.DefaultBlockGasLimit, parent.Time()+1)
+	header.BaseFee = types.CalcBaseFee(parent.Header)
+
+	block := types.NewBlock(header, txs, nil)
+	if err := blockchain.AddBlock(block); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+	return block
+}
+
+// signedTx creates a transaction signed with the given Dilithium key
+func signedTx(t *testing.T, privKey *crypto.DilithiumPrivateKey, nonce uint64, to types.Address, value *big.Int, gas uint64, data []byte) *types.QuantumTransaction {
+	tx := types.NewQuantumTransaction(big.NewInt(8888), nonce, &to, value, gas, big.NewInt(1000000000), data)
+	if err := tx.SignTransaction(privKey.Bytes(), crypto.SigAlgDilithium); err != nil {
+		t.Fatalf("Failed to sign transaction: %v", err)
+	}
+	return tx
+}
+
+// TestTraceTransaction tests re-execution of a mined transaction with each tracer
+func TestTraceTransaction(t *testing.T) {
+	blockchain, privKey, sender := newFundedBlockchain(t)
+
+	// A call to the Dilithium precompile with malformed input fails inside the precompile
+	precompile := types.BytesToAddress([]byte{0x0a})
+	tx := signedTx(t, privKey, 0, precompile, big.NewInt(0), 100000, []byte{0x01, 0x02})
+	block := addBlock(t, blockchain, tx)
+
+	// Mine another block so the traced block is no longer the head
+	addBlock(t, blockchain)
+
+	receipt, err := blockchain.GetTransactionReceipt(tx.Hash())
+	if err != nil {
+		t.Fatalf("Failed to get receipt: %v", err)
+	}
+	if receipt.Status != 0 {
+		t.Errorf("Expected failed receipt for malformed precompile input")
+	}
+
+	// Call tracer shows the nested precompile call and its error
+	raw, err := blockchain.TraceTransaction(tx.Hash(), "callTracer")
+	if err != nil {
+		t.Fatalf("Failed to trace transaction: %v", err)
+	}
+
+	var frame struct {
+		From  string `json:"from"`
+		Error string `json:"error"`
+		Calls []struct {
+			To         string `json:"to"`
+			GasUsed    string `json:"gasUsed"`
+			Error      string `json:"error"`
+			Precompile *struct {
+				Name      string `json:"name"`
+				Algorithm string `json:"algorithm"`
+			} `json:"precompile"`
+		} `json:"calls"`
+	}
+	if err := json.Unmarshal(raw, &frame); err != nil {
+		t.Fatalf("Failed to decode call trace: %v", err)
+	}
+
+	if frame.From != sender.Hex() {
+		t.Errorf("Expected sender %s, got %s", sender.Hex(), frame.From)
+	}
+	if frame.Error == "" {
+		t.Error("Expected top level call to report the precompile error")
+	}
+	if len(frame.Calls) != 1 {
+		t.Fatalf("Expected one nested call, got %d", len(frame.Calls))
+	}
+	call := frame.Calls[0]
+	if call.Precompile == nil || call.Precompile.Name != "DilithiumVerify" || call.Precompile.Algorithm != "dilithium" {
+		t.Errorf("Expected DilithiumVerify annotation, got %+v", call.Precompile)
+	}
+	if call.GasUsed != "0x320" { // 800 gas
+		t.Errorf("Expected precompile gas 0x320, got %s", call.GasUsed)
+	}
+
+	// Prestate tracer reports the sender as funded by genesis with nonce 0
+	raw, err = blockchain.TraceTransaction(tx.Hash(), "prestateTracer")
+	if err != nil {
+		t.Fatalf("Failed to trace transaction: %v", err)
+	}
+
+	var prestate map[string]struct {
+		Balance string `json:"balance"`
+		Nonce   uint64 `json:"nonce"`
+	}
+	if err := json.Unmarshal(raw, &prestate); err != nil {
+		t.Fatalf("Failed to decode prestate trace: %v", err)
+	}
+
+	account, ok := prestate[sender.Hex()]
+	if !ok {
+		t.Fatalf("Sender missing from prestate")
+	}
+	if account.Balance != "0xd3c21bcecceda1000000" || account.Nonce != 0 {
+		t.Errorf("Unexpected sender prestate: %+v", account)
+	}
+
+	// Block trace returns one result per transaction
+	results, err := blockchain.TraceBlock(block, "")
+	if err != nil {
+		t.Fatalf("Failed to trace block: %v", err)
+	}
+	if len(results) != 1 || results[0].Error != "" {
+		t.Fatalf("Unexpected block trace results: %+v", results)
+	}
+
+	// Unknown tracers are rejected
+	if _, err := blockchain.TraceTransaction(tx.Hash(), "noSuchTracer"); err == nil {
+		t.Error("Expected error for unknown tracer")
+	}
+
+}
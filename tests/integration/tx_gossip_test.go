@@ -0,0 +1,150 @@
+package integration
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"quantum-blockchain/chain/network"
+	"quantum-blockchain/chain/node"
+	"quantum-blockchain/chain/types"
+)
+
+// gossipNode is a P2P network with a minimal transaction pool
+type gossipNode struct {
+	p2p    *node.P2PNetwork
+	blocks chan *types.Block
+
+	mu       sync.Mutex
+	pool     map[types.Hash]*types.QuantumTransaction
+	received int
+}
+
+func newGossipNode(t *testing.T, bootstrap []string) *gossipNode {
+	t.Helper()
+	identity, err := network.GenerateNodeIdentity()
+	if err != nil {
+		t.Fatalf("Failed to generate identity: %v", err)
+	}
+	g := &gossipNode{
+		p2p:    node.NewP2PNetwork("127.0.0.1:0", bootstrap, identity),
+		blocks: make(chan *types.Block, 16),
+		pool:   make(map[types.Hash]*types.QuantumTransaction),
+	}
+	g.p2p.SetTransactionHandler(func(tx *types.QuantumTransaction) error {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		g.pool[tx.Hash()] = tx
+		g.received++
+		return nil
+	})
+	g.p2p.SetTransactionSource(func(hash types.Hash) *types.QuantumTransaction {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		return g.pool[hash]
+	})
+	g.p2p.SetPendingTransactions(func() []*types.QuantumTransaction {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		pending := make([]*types.QuantumTransaction, 0, len(g.pool))
+		for _, tx := range g.pool {
+			pending = append(pending, tx)
+		}
+		return pending
+	})
+	g.p2p.SetBlockHandler(func(block *types.Block) error {
+		g.blocks <- block
+		return nil
+	})
+	if err := g.p2p.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start P2P network: %v", err)
+	}
+	t.Cleanup(g.p2p.Stop)
+	return g
+}
+
+func (g *gossipNode) add(tx *types.QuantumTransaction) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.pool[tx.Hash()] = tx
+}
+
+func (g *gossipNode) remove(hash types.Hash) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.pool, hash)
+}
+
+func (g *gossipNode) count() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.received
+}
+
+// TestTxGossip tests that transactions reach every node once, pushed in full
+// to the square root of the peers and fetched by the others
+func TestTxGossip(t *testing.T) {
+	waitFor := func(what string, condition func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(15 * time.Second)
+		for !condition() {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %s", what)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	origin := newGossipNode(t, nil)
+	nodes := []*gossipNode{origin}
+	for i := 0; i < 4; i++ {
+		nodes = append(nodes, newGossipNode(t, []string{origin.p2p.ListenAddr()}))
+	}
+	waitFor("a full mesh", func() bool {
+		for _, g := range nodes {
+			if len(g.p2p.GetPeers()) != len(nodes)-1 {
+				return false
+			}
+		}
+		return true
+	})
+
+	tx := types.NewQuantumTransaction(big.NewInt(8888), 0, nil, big.NewInt(1), 21000, big.NewInt(1000000000), []byte("gossip"))
+	origin.add(tx)
+	origin.p2p.BroadcastTransaction(tx)
+
+	// Two of the four peers get the body, the others the hash
+	if stats := origin.p2p.TxGossipStats(); stats.Sent != 2 || stats.Announced != 2 {
+		t.Errorf("Expected 2 transactions sent and 2 announced, got %+v", stats)
+	}
+	waitFor("every node to receive the transaction", func() bool {
+		for _, g := range nodes[1:] {
+			if g.count() == 0 {
+				return false
+			}
+		}
+		return true
+	})
+
+	// Give relays time to settle, each node handles the transaction once
+	time.Sleep(300 * time.Millisecond)
+	var fetched uint64
+	for i, g := range nodes[1:] {
+		if g.count() != 1 {
+			t.Errorf("Expected node %d to handle the transaction once, got %d", i+1, g.count())
+		}
+		fetched += g.p2p.TxGossipStats().Fetched
+	}
+	if fetched == 0 {
+		t.Error("Expected announced nodes to fetch the transaction")
+	}
+
+	// Peers known to have the transaction are not sent it again
+	before := origin.p2p.TxGossipStats()
+	origin.p2p.BroadcastTransaction(tx)
+	if after := origin.p2p.TxGossipStats(); after.Sent != before.Sent || after.Announced != before.Announced {
+		t.Errorf("Expected no gossip of a known transaction, got %+v", after)
+	}
+}
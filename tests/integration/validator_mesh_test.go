@@ -0,0 +1,179 @@
+package integration
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"quantum-blockchain/chain/config"
+	"quantum-blockchain/chain/consensus"
+	"quantum-blockchain/chain/crypto"
+	"quantum-blockchain/chain/network"
+	"quantum-blockchain/chain/node"
+	"quantum-blockchain/chain/types"
+)
+
+// TestValidatorMesh tests that genesis validators connected over the mesh
+// commit the same blocks, each proposed by one of them and voted for by all
+func TestValidatorMesh(t *testing.T) {
+	const validators = 3
+
+	// Every node knows the validators and the genesis block from the genesis
+	genesis := config.DefaultGenesisConfig()
+	genesis.Timestamp = uint64(time.Now().Unix())
+	keys := make([]string, validators)
+	for i := range keys {
+		priv, pub, err := crypto.GenerateDilithiumKeyPair()
+		if err != nil {
+			t.Fatalf("Failed to generate key: %v", err)
+		}
+		keys[i] = hex.EncodeToString(priv.Bytes())
+		genesis.Validators = append(genesis.Validators, config.GenesisValidator{
+			Address:   types.PublicKeyToAddress(pub.Bytes()).Hex(),
+			Stake:     "100000000000000000000000",
+			PublicKey: hex.EncodeToString(pub.Bytes()),
+		})
+	}
+	genesisPath := filepath.Join(t.TempDir(), "genesis.json")
+	data, _ := json.Marshal(genesis)
+	if err := os.WriteFile(genesisPath, data, 0644); err != nil {
+		t.Fatalf("Failed to write genesis: %v", err)
+	}
+
+	// Each validator dials the mesh of the ones started before it
+	var nodes []*node.Node
+	var meshAddrs []string
+	for i, key := range keys {
+		validator, err := node.NewNode(&node.Config{
+			DataDir:             t.TempDir(),
+			NetworkID:           8888,
+			ListenAddr:          "127.0.0.1:0",
+			ValidatorKey:        key,
+			GenesisConfig:       genesisPath,
+			Mining:              true,
+			GasLimit:            15000000,
+			GasPrice:            big.NewInt(1000000000),
+			ValidatorListenAddr: "127.0.0.1:0",
+			ValidatorPeers:      append([]string(nil), meshAddrs...),
+		})
+		if err != nil {
+			t.Fatalf("Failed to create validator %d: %v", i, err)
+		}
+		if err := validator.Start(); err != nil {
+			t.Fatalf("Failed to start validator %d: %v", i, err)
+		}
+		t.Cleanup(validator.Stop)
+		if got := len(validator.GetValidators()); got != validators {
+			t.Fatalf("Expected validator %d to know %d validators, got %d", i, validators, got)
+		}
+		nodes = append(nodes, validator)
+		meshAddrs = append(meshAddrs, validator.GetValidatorMesh().ListenAddr())
+	}
+
+	// Blocks need the votes of all three validators
+	const height = 4
+	deadline := time.Now().Add(60 * time.Second)
+	for _, n := range nodes {
+		for n.GetBlockchain().GetCurrentBlock().Number().Uint64() < height {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for block #%d, at #%d", height, n.GetBlockchain().GetCurrentBlock().Number())
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	for _, n := range nodes {
+		peers := 0
+		for _, peer := range n.GetValidatorMesh().Peers() {
+			if peer.IsValidator {
+				peers++
+			}
+		}
+		if peers != validators-1 {
+			t.Errorf("Expected %d validator peers, got %d", validators-1, peers)
+		}
+		if stats := n.GetValidatorMesh().GetNetworkMetrics().MessageStats[network.MsgConsensusVote]; stats == nil || stats.Count == 0 {
+			t.Error("Expected votes to be received over the mesh")
+		}
+	}
+
+	// All validators committed the same blocks, signed by their proposers
+	for number := uint64(1); number <= height; number++ {
+		expected, err := nodes[0].GetBlockchain().GetBlockByNumber(new(big.Int).SetUint64(number))
+		if err != nil {
+			t.Fatalf("Failed to get block #%d: %v", number, err)
+		}
+		if valid, err := expected.Header.VerifyValidatorSignature(); err != nil || !valid {
+			t.Errorf("Expected block #%d to be signed by its proposer", number)
+		}
+		for i, n := range nodes[1:] {
+			block, err := n.GetBlockchain().GetBlockByNumber(new(big.Int).SetUint64(number))
+			if err != nil || block.Hash() != expected.Hash() {
+				t.Errorf("Expected validator %d to commit block #%d %s", i+1, number, expected.Hash().Hex())
+			}
+		}
+	}
+}
+
+// TestConsensusVotes tests that votes only count when signed by the
+// registered key of the validator
+func TestConsensusVotes(t *testing.T) {
+	mvc := consensus.NewMultiValidatorConsensus(big.NewInt(8888))
+	stake, _ := new(big.Int).SetString("100000000000000000000000", 10)
+
+	privs := make([]*crypto.DilithiumPrivateKey, 2)
+	addrs := make([]types.Address, 2)
+	for i := range privs {
+		priv, pub, err := crypto.GenerateDilithiumKeyPair()
+		if err != nil {
+			t.Fatalf("Failed to generate key: %v", err)
+		}
+		privs[i], addrs[i] = priv, types.PublicKeyToAddress(pub.Bytes())
+		if err := mvc.RegisterValidator(addrs[i], pub.Bytes(), stake, crypto.SigAlgDilithium, 0.05); err != nil {
+			t.Fatalf("Failed to register validator: %v", err)
+		}
+	}
+
+	hash := types.BytesToHash([]byte("block"))
+	vote, err := mvc.SubmitConsensusVote(addrs[0], hash, 1, 0, consensus.VoteCommit, privs[0].Bytes())
+	if err != nil {
+		t.Fatalf("Failed to vote: %v", err)
+	}
+	if _, quorum := mvc.QuorumVotes(1, 0, hash); quorum {
+		t.Error("Expected one of two validators to be short of a quorum")
+	}
+
+	// A vote signed by another key than the registered one is rejected
+	forged := consensus.NewMultiValidatorConsensus(big.NewInt(8888))
+	forged.RegisterValidator(addrs[1], privs[0].Public().Bytes(), stake, crypto.SigAlgDilithium, 0.05)
+	forgedVote, err := forged.SubmitConsensusVote(addrs[1], hash, 1, 0, consensus.VoteCommit, privs[0].Bytes())
+	if err != nil {
+		t.Fatalf("Failed to vote: %v", err)
+	}
+	if err := mvc.AddVote(forgedVote); !errors.Is(err, consensus.ErrInvalidVote) {
+		t.Errorf("Expected a vote signed with another key to be rejected, got %v", err)
+	}
+
+	// The vote of the second validator completes the quorum
+	other := consensus.NewMultiValidatorConsensus(big.NewInt(8888))
+	other.RegisterValidator(addrs[1], privs[1].Public().Bytes(), stake, crypto.SigAlgDilithium, 0.05)
+	secondVote, err := other.SubmitConsensusVote(addrs[1], hash, 1, 0, consensus.VoteCommit, privs[1].Bytes())
+	if err != nil {
+		t.Fatalf("Failed to vote: %v", err)
+	}
+	if err := mvc.AddVote(secondVote); err != nil {
+		t.Fatalf("Failed to add vote: %v", err)
+	}
+	votes, quorum := mvc.QuorumVotes(1, 0, hash)
+	if !quorum || len(votes) != 2 {
+		t.Errorf("Expected a quorum of 2 votes, got %d (%v)", len(votes), quorum)
+	}
+	if err := mvc.AddVote(vote); err != nil {
+		t.Errorf("Expected a repeated vote to be ignored, got %v", err)
+	}
+}
@@ -167,6 +167,34 @@ func TestKyberEncapsulationAndDecapsulation(t *testing.T) {
 	}
 }
 
+// TestSecretSharing tests that any threshold of shares recovers the secret and fewer do not
+func TestSecretSharing(t *testing.T) {
+	secret := bytes.Repeat([]byte{0x5a, 0x00, 0xff}, 11)
+	shares, err := crypto.SplitSecret(secret, 3, 5)
+	if err != nil {
+		t.Fatalf("Failed to split secret: %v", err)
+	}
+
+	for _, xs := range [][]byte{{1, 2, 3}, {2, 4, 5}, {1, 3, 4, 5}} {
+		subset := make(map[byte][]byte)
+		for _, x := range xs {
+			subset[x] = shares[x-1]
+		}
+		recovered, err := crypto.CombineShares(subset)
+		if err != nil || !bytes.Equal(recovered, secret) {
+			t.Errorf("Expected shares %v to recover the secret, got error %v", xs, err)
+		}
+	}
+
+	recovered, err := crypto.CombineShares(map[byte][]byte{1: shares[0], 5: shares[4]})
+	if err != nil || bytes.Equal(recovered, secret) {
+		t.Error("Expected two shares not to recover the secret")
+	}
+	if _, err := crypto.SplitSecret(secret, 6, 5); err == nil {
+		t.Error("Expected a threshold above the share count to be rejected")
+	}
+}
+
 func TestQuantumSignatureInterface(t *testing.T) {
 	// Test Dilithium
 	privKey, _, err := crypto.GenerateDilithiumKeyPair()
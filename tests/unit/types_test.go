@@ -346,6 +346,33 @@ func TestBlockSigning(t *testing.T) {
 	}
 }
 
+func TestBlockHeaderHashFields(t *testing.T) {
+	root := types.BytesToHash([]byte("root"))
+	slots := []func(*types.BlockHeader){
+		func(h *types.BlockHeader) { h.DecryptionRoot = root },
+		func(h *types.BlockHeader) { h.EvidenceRoot = root },
+		func(h *types.BlockHeader) { h.LastCommitHash = root },
+		func(h *types.BlockHeader) { h.ValidatorsHash = root },
+		func(h *types.BlockHeader) { h.Difficulty = big.NewInt(1); h.Number = big.NewInt(0x0203) },
+		func(h *types.BlockHeader) { h.Difficulty = big.NewInt(0x0102); h.Number = big.NewInt(0x03) },
+		func(h *types.BlockHeader) { h.Extra = []byte{1}; h.Bloom = h.Bloom[:255] },
+	}
+
+	// The same value in another field gives another hash
+	seen := make(map[types.Hash]int)
+	for i, set := range slots {
+		header := types.NewBlockHeader(types.ZeroHash, types.Address{}, types.ZeroHash, big.NewInt(1), 15000000, 1234567890)
+		set(header)
+		if j, ok := seen[header.Hash()]; ok {
+			t.Errorf("Headers %d and %d share hash %s", j, i, header.Hash().Hex())
+		}
+		seen[header.Hash()] = i
+		if header.SigningHash() != header.Hash() {
+			t.Errorf("Expected header %d to sign its hash", i)
+		}
+	}
+}
+
 func TestGenesisBlock(t *testing.T) {
 	genesis := types.Genesis()
 